@@ -0,0 +1,153 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"reflect"
+	"time"
+)
+
+// ActivityEntities are the entity types recorded in the activity log
+var ActivityEntities = []string{
+	EntityProject, EntityTask, EntityProblem, EntityOutcome, EntityGoal,
+	EntityTaskNote, EntityGoalProject, EntityProblemProject, EntityTaskDependency,
+	EntityTaskRecurrence, EntityTag, EntityPerson,
+}
+
+// FieldChange is the value of a field before and after a change. Old is nil
+// for created items and New is nil for deleted ones.
+type FieldChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// Activity is an entry in the activity log
+type Activity struct {
+	ID        int64                  `json:"id"`
+	Entity    string                 `json:"entity"`
+	EntityID  int64                  `json:"entity_id"`
+	Action    string                 `json:"action"`
+	Changes   map[string]FieldChange `json:"changes"`
+	Actor     string                 `json:"actor"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// WithActor returns a Database that records actor as the author of the
+// changes made through it. It shares the connection and event bus with d.
+func (d *Database) WithActor(actor string) *Database {
+	c := *d
+	c.actor = actor
+	return &c
+}
+
+// recordActivity writes an activity log entry with the fields that differ
+// between before and after. Updates that change nothing are not recorded.
+func (d *Database) recordActivity(action, entity string, id int64, before, after interface{}) error {
+	changes, err := diffFields(before, after)
+	if err != nil {
+		return err
+	}
+	if action == ActionUpdated && len(changes) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	_, err = d.db.Exec(
+		"INSERT INTO activity (entity, entity_id, action, changes, actor) VALUES (?, ?, ?, ?, ?)",
+		entity, id, action, string(data), d.actor,
+	)
+	return err
+}
+
+// diffFields compares the JSON fields of two values. IDs, timestamps and
+// fields computed from other rows are ignored, as are fields that are empty
+// on both sides.
+func diffFields(before, after interface{}) (map[string]FieldChange, error) {
+	old, err := jsonFields(before)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := jsonFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]FieldChange{}
+	for _, fields := range []map[string]interface{}{old, updated} {
+		for name := range fields {
+			switch name {
+			case "id", "created_at", "updated_at", "depends_on", "blocked_by", "ready":
+				continue
+			}
+			o, n := old[name], updated[name]
+			if isEmptyField(o) && isEmptyField(n) || reflect.DeepEqual(o, n) {
+				continue
+			}
+			changes[name] = FieldChange{Old: o, New: n}
+		}
+	}
+	return changes, nil
+}
+
+func jsonFields(v interface{}) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if v == nil {
+		return fields, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func isEmptyField(v interface{}) bool {
+	return v == nil || v == ""
+}
+
+// ListActivityPage lists activity log entries, newest first. entityID only
+// applies together with entity.
+func (d *Database) ListActivityPage(entity *string, entityID *int64, actor *string, opts ListOptions) ([]*Activity, *PageInfo, error) {
+	if err := validateOptionalEnum("entity", entity, ActivityEntities); err != nil {
+		return nil, nil, err
+	}
+
+	q := listQuery{
+		table:   "activity",
+		columns: "id, entity, entity_id, action, changes, actor, created_at",
+		sorts:   newestFirstSorts,
+	}
+	if entity != nil {
+		q.filter("entity = ?", *entity)
+		if entityID != nil {
+			q.filter("entity_id = ?", *entityID)
+		}
+	}
+	if actor != nil {
+		q.filter("actor = ?", *actor)
+	}
+
+	var entries []*Activity
+	page, err := d.listPage(q, opts, func(rows *sql.Rows, sortValue *interface{}) (int64, error) {
+		var a Activity
+		var changes string
+		if err := rows.Scan(&a.ID, &a.Entity, &a.EntityID, &a.Action, &changes, &a.Actor, &a.CreatedAt, sortValue); err != nil {
+			return 0, err
+		}
+		if err := json.Unmarshal([]byte(changes), &a.Changes); err != nil {
+			return 0, err
+		}
+		entries = append(entries, &a)
+		return a.ID, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return entries, page, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import "testing"
+
+func listHistory(t *testing.T, db *Database, entity string, id int64) []*Activity {
+	t.Helper()
+	entries, _, err := db.ListActivityPage(&entity, &id, nil, ListOptions{})
+	if err != nil {
+		t.Fatalf("failed to list activity: %v", err)
+	}
+	return entries
+}
+
+func TestActivityRecordsChanges(t *testing.T) {
+	db := newTestDatabase(t)
+	project, _ := db.CreateProject("Project", "", "", "", nil, nil)
+
+	agent := db.WithActor("mcp:agent")
+	task, err := agent.CreateTask(project.ID, nil, "Write docs", "", "", "", "", "", "", "", nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	status := "in_progress"
+	title := "Write the docs"
+	if _, err := agent.UpdateTask(task.ID, &title, nil, &status, nil, nil, nil, nil, nil, nil, nil, nil); err != nil {
+		t.Fatalf("failed to update task: %v", err)
+	}
+	// Setting a field to its current value is not a change
+	if _, err := agent.UpdateTask(task.ID, &title, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil); err != nil {
+		t.Fatalf("failed to update task: %v", err)
+	}
+	if err := db.DeleteTask(task.ID); err != nil {
+		t.Fatalf("failed to delete task: %v", err)
+	}
+
+	entries := listHistory(t, db, EntityTask, task.ID)
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %+v", entries)
+	}
+	deleted, updated, created := entries[0], entries[1], entries[2]
+
+	if created.Action != ActionCreated || created.Actor != "mcp:agent" {
+		t.Errorf("expected create by mcp:agent, got %+v", created)
+	}
+	if c := created.Changes["title"]; c.Old != nil || c.New != "Write docs" {
+		t.Errorf("expected initial title, got %+v", created.Changes)
+	}
+	if _, ok := created.Changes["description"]; ok {
+		t.Errorf("expected empty fields to be left out, got %+v", created.Changes)
+	}
+
+	if updated.Action != ActionUpdated || len(updated.Changes) != 2 {
+		t.Fatalf("expected status and title changes, got %+v", updated)
+	}
+	if c := updated.Changes["status"]; c.Old != "pending" || c.New != "in_progress" {
+		t.Errorf("expected status pending -> in_progress, got %+v", c)
+	}
+
+	if deleted.Action != ActionDeleted || deleted.Actor != "" {
+		t.Errorf("expected delete without actor, got %+v", deleted)
+	}
+	if c := deleted.Changes["title"]; c.Old != "Write the docs" || c.New != nil {
+		t.Errorf("expected deleted title to be kept, got %+v", deleted.Changes)
+	}
+
+	// The actor only applies to the returned Database
+	if _, err := db.CreateProject("Other", "", "", "", nil, nil); err != nil {
+		t.Fatalf("failed to create project: %v", err)
+	}
+	actor := "mcp:agent"
+	entries, page, err := db.ListActivityPage(nil, nil, &actor, ListOptions{Limit: 1})
+	if err != nil {
+		t.Fatalf("failed to list activity: %v", err)
+	}
+	if page.Total != 2 || len(entries) != 1 || entries[0].ID != updated.ID {
+		t.Errorf("expected newest of 2 entries by mcp:agent, got %+v (%+v)", entries, page)
+	}
+}
+
+func TestActivityRecordsLinks(t *testing.T) {
+	db := newTestDatabase(t)
+	project, _ := db.CreateProject("Project", "", "", "", nil, nil)
+	goal, _ := db.CreateGoal(nil, nil, "Goal", "", "", "", nil, nil)
+
+	db.LinkGoalToProject(goal.ID, project.ID)
+	db.LinkGoalToProject(goal.ID, project.ID)
+	db.UnlinkGoalFromProject(goal.ID, project.ID)
+
+	entries := listHistory(t, db, EntityGoalProject, goal.ID)
+	if len(entries) != 2 {
+		t.Fatalf("expected link and unlink, got %+v", entries)
+	}
+	if c := entries[0].Changes["project_id"]; entries[0].Action != ActionDeleted || c.Old != float64(project.ID) || c.New != nil {
+		t.Errorf("expected unlink from project %d, got %+v", project.ID, entries[0])
+	}
+	if c := entries[1].Changes["project_id"]; entries[1].Action != ActionCreated || c.New != float64(project.ID) {
+		t.Errorf("expected link to project %d, got %+v", project.ID, entries[1])
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnauthorized is wrapped by errors returned when a request has no valid
+// API token.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// ErrForbidden is wrapped by errors returned when a token is valid but does
+// not allow the request.
+var ErrForbidden = errors.New("forbidden")
+
+// Access levels of API tokens
+const (
+	AccessRead  = "read"
+	AccessWrite = "write"
+)
+
+var TokenAccessLevels = []string{AccessRead, AccessWrite}
+
+// tokenPrefix marks Loom tokens so they are easy to recognise in config
+// files and secret scanners
+const tokenPrefix = "loom_"
+
+// APIToken is a bearer token that authenticates REST and MCP clients. A
+// read token can only read; a write token can also make changes. A token
+// with a ProjectID can only reach that project and the items in it.
+type APIToken struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Access     string     `json:"access"`
+	ProjectID  *int64     `json:"project_id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// Actor identifies the token in the activity log
+func (t *APIToken) Actor() string {
+	return "token:" + t.Name
+}
+
+const tokenColumns = "id, name, access, project_id, created_at, last_used_at, revoked_at"
+
+func scanToken(scan func(dest ...interface{}) error) (*APIToken, error) {
+	var t APIToken
+	if err := scan(&t.ID, &t.Name, &t.Access, &t.ProjectID, &t.CreatedAt, &t.LastUsedAt, &t.RevokedAt); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// hashToken hashes a token for storage. Tokens are long and random, so a
+// plain SHA-256 is enough to keep them from being recovered.
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIToken creates a token and returns it along with the secret to
+// authenticate with, which is not stored and cannot be shown again
+func (d *Database) CreateAPIToken(name, access string, projectID *int64) (*APIToken, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", fmt.Errorf("%w token: name is required", ErrInvalidValue)
+	}
+	if err := validateEnum("access", access, TokenAccessLevels); err != nil {
+		return nil, "", err
+	}
+	if projectID != nil {
+		if _, err := d.GetProject(*projectID); err != nil {
+			return nil, "", fmt.Errorf("%w: project with ID %d does not exist", ErrInvalidReference, *projectID)
+		}
+	}
+	var existing int64
+	err := d.db.QueryRow("SELECT id FROM api_tokens WHERE name = ? AND revoked_at IS NULL", name).Scan(&existing)
+	if err == nil {
+		return nil, "", fmt.Errorf("%w token: %q is already used by token %d", ErrInvalidValue, name, existing)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, "", err
+	}
+
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, "", err
+	}
+	secret := tokenPrefix + hex.EncodeToString(random)
+
+	result, err := d.db.Exec(
+		"INSERT INTO api_tokens (name, token_hash, access, project_id) VALUES (?, ?, ?, ?)",
+		name, hashToken(secret), access, projectID,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, "", err
+	}
+	token, err := scanToken(d.db.QueryRow("SELECT "+tokenColumns+" FROM api_tokens WHERE id = ?", id).Scan)
+	if err != nil {
+		return nil, "", err
+	}
+	return token, secret, nil
+}
+
+// ListAPITokens lists all tokens, including revoked ones, oldest first
+func (d *Database) ListAPITokens() ([]*APIToken, error) {
+	rows, err := d.db.Query("SELECT " + tokenColumns + " FROM api_tokens ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*APIToken
+	for rows.Next() {
+		t, err := scanToken(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// RevokeAPIToken revokes the live token with the given ID or name
+func (d *Database) RevokeAPIToken(ref string) (*APIToken, error) {
+	ref = strings.TrimSpace(ref)
+	query := "SELECT " + tokenColumns + " FROM api_tokens WHERE name = ? AND revoked_at IS NULL"
+	var arg interface{} = ref
+	if id, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		query = "SELECT " + tokenColumns + " FROM api_tokens WHERE id = ? AND revoked_at IS NULL"
+		arg = id
+	}
+	token, err := scanToken(d.db.QueryRow(query, arg).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: no live token %q", ErrNotFound, ref)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if _, err := d.db.Exec("UPDATE api_tokens SET revoked_at = ? WHERE id = ?", now, token.ID); err != nil {
+		return nil, err
+	}
+	token.RevokedAt = &now
+	return token, nil
+}
+
+// AuthenticateToken returns the live token matching secret and records that
+// it was used
+func (d *Database) AuthenticateToken(secret string) (*APIToken, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("%w: an API token is required", ErrUnauthorized)
+	}
+	token, err := scanToken(d.db.QueryRow(
+		"SELECT "+tokenColumns+" FROM api_tokens WHERE token_hash = ? AND revoked_at IS NULL",
+		hashToken(secret),
+	).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: invalid or revoked API token", ErrUnauthorized)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if _, err := d.db.Exec("UPDATE api_tokens SET last_used_at = ? WHERE id = ?", now, token.ID); err != nil {
+		return nil, err
+	}
+	token.LastUsedAt = &now
+	return token, nil
+}
+
+type tokenContextKey struct{}
+
+// contextWithToken returns a context carrying the token a request was
+// authenticated with
+func contextWithToken(ctx context.Context, token *APIToken) context.Context {
+	return context.WithValue(ctx, tokenContextKey{}, token)
+}
+
+// tokenFromContext returns the token a request was authenticated with, or
+// nil if authentication is disabled
+func tokenFromContext(ctx context.Context) *APIToken {
+	token, _ := ctx.Value(tokenContextKey{}).(*APIToken)
+	return token
+}
+
+// authorizeWrite checks that the token may make changes
+func (t *APIToken) authorizeWrite() error {
+	if t.Access != AccessWrite {
+		return fmt.Errorf("%w: token %q is read-only", ErrForbidden, t.Name)
+	}
+	return nil
+}
+
+// authorizeAllProjects checks that the token is not limited to a project,
+// for requests that reach beyond a single project
+func (t *APIToken) authorizeAllProjects() error {
+	if t.ProjectID != nil {
+		return fmt.Errorf("%w: token %q is limited to project %d", ErrForbidden, t.Name, *t.ProjectID)
+	}
+	return nil
+}
+
+// authorizeProject checks that the token may reach the project
+func (t *APIToken) authorizeProject(projectID int64) error {
+	if t.ProjectID != nil && *t.ProjectID != projectID {
+		return fmt.Errorf("%w: token %q is limited to project %d", ErrForbidden, t.Name, *t.ProjectID)
+	}
+	return nil
+}
+
+// projectItemQueries check whether an item belongs to a project. Problems
+// and goals also belong to the projects they are linked to.
+var projectItemQueries = map[string]string{
+	EntityProject:  "SELECT id = ? FROM projects WHERE id = ?",
+	EntityTask:     "SELECT project_id = ? FROM tasks WHERE id = ?",
+	EntityTaskNote: "SELECT t.project_id = ? FROM task_notes n JOIN tasks t ON t.id = n.task_id WHERE n.id = ?",
+	EntityProblem:  "SELECT EXISTS (SELECT 1 FROM problems WHERE id = ?2 AND project_id = ?1 UNION ALL SELECT 1 FROM problem_projects WHERE problem_id = ?2 AND project_id = ?1)",
+	EntityOutcome:  "SELECT project_id = ? FROM outcomes WHERE id = ?",
+	EntityGoal:     "SELECT EXISTS (SELECT 1 FROM goals WHERE id = ?2 AND project_id = ?1 UNION ALL SELECT 1 FROM goal_projects WHERE goal_id = ?2 AND project_id = ?1)",
+}
+
+// authorizeItem checks that the token may reach an item. Tokens limited to
+// a project can only reach the items in it, and nothing outside the
+// project hierarchy.
+func (d *Database) authorizeItem(token *APIToken, entity string, id int64) error {
+	if token.ProjectID == nil {
+		return nil
+	}
+	query, ok := projectItemQueries[entity]
+	if !ok {
+		return token.authorizeAllProjects()
+	}
+	var inProject bool
+	err := d.db.QueryRow(query, *token.ProjectID, id).Scan(&inProject)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if !inProject {
+		return fmt.Errorf("%w: %s %d is outside project %d that token %q is limited to", ErrForbidden, entity, id, *token.ProjectID, token.Name)
+	}
+	return nil
+}
+
+// referenceEntities maps the arguments that refer to other items, in tool
+// calls and request bodies, to the type of item they refer to
+var referenceEntities = map[string]string{
+	"project_id":     EntityProject,
+	"task_id":        EntityTask,
+	"parent_task_id": EntityTask,
+	"depends_on_id":  EntityTask,
+	"problem_id":     EntityProblem,
+	"goal_id":        EntityGoal,
+}
+
+// authorizeReferences checks that the token may reach every item referred to
+// by the arguments of a tool call or request body
+func (d *Database) authorizeReferences(token *APIToken, args map[string]interface{}) error {
+	for arg, entity := range referenceEntities {
+		id, ok, err := referenceID(args, arg)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := d.authorizeItem(token, entity, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// referenceID reads an ID argument the way the tool handlers do, which
+// accept numbers and numeric strings alike, so that the item checked is the
+// one the handler uses. ok is false if the argument is missing or null, and
+// anything else that is not a number is an error.
+func referenceID(args map[string]interface{}, arg string) (id int64, ok bool, err error) {
+	switch v := args[arg].(type) {
+	case nil:
+		return 0, false, nil
+	case float64:
+		return int64(v), true, nil
+	case int:
+		return int64(v), true, nil
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return int64(f), true, nil
+		}
+	}
+	return 0, false, fmt.Errorf("%w %s: %v is not an ID", ErrInvalidValue, arg, args[arg])
+}
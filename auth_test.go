@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAPITokens(t *testing.T) {
+	db := newTestDatabase(t)
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+
+	token, secret, err := db.CreateAPIToken(" ci ", AccessWrite, &project.ID)
+	if err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+	if token.Name != "ci" || !strings.HasPrefix(secret, tokenPrefix) || token.ProjectID == nil || *token.ProjectID != project.ID {
+		t.Errorf("unexpected token %+v, %q", token, secret)
+	}
+
+	missing := int64(999)
+	for _, bad := range []struct {
+		name, access string
+		projectID    *int64
+	}{
+		{"", AccessRead, nil},
+		{"other", "admin", nil},
+		{"other", AccessRead, &missing},
+		{"ci", AccessRead, nil},
+	} {
+		if _, _, err := db.CreateAPIToken(bad.name, bad.access, bad.projectID); err == nil {
+			t.Errorf("expected an error creating %+v", bad)
+		}
+	}
+
+	authenticated, err := db.AuthenticateToken(secret)
+	if err != nil || authenticated.ID != token.ID || authenticated.LastUsedAt == nil {
+		t.Fatalf("expected to authenticate, got %+v, %v", authenticated, err)
+	}
+	for _, bad := range []string{"", "loom_nope", secret + "x"} {
+		if _, err := db.AuthenticateToken(bad); !errors.Is(err, ErrUnauthorized) {
+			t.Errorf("AuthenticateToken(%q): expected ErrUnauthorized, got %v", bad, err)
+		}
+	}
+
+	if _, err := db.RevokeAPIToken("ci"); err != nil {
+		t.Fatalf("failed to revoke token: %v", err)
+	}
+	if _, err := db.AuthenticateToken(secret); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected a revoked token to be rejected, got %v", err)
+	}
+	if _, err := db.RevokeAPIToken("ci"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound revoking twice, got %v", err)
+	}
+
+	// The name can be reused once revoked
+	if _, _, err := db.CreateAPIToken("ci", AccessRead, nil); err != nil {
+		t.Errorf("expected to reuse a revoked name, got %v", err)
+	}
+	tokens, _ := db.ListAPITokens()
+	if len(tokens) != 2 || tokens[0].RevokedAt == nil || tokens[1].RevokedAt != nil {
+		t.Errorf("expected the revoked and the live token, got %+v", tokens)
+	}
+}
+
+func TestAuthorizeItem(t *testing.T) {
+	db := newTestDatabase(t)
+	mine, _ := db.CreateProject("Mine", "", "", "", nil, nil)
+	other, _ := db.CreateProject("Other", "", "", "", nil, nil)
+	task, _ := db.CreateTask(mine.ID, nil, "Mine", "", "", "", "", "", "", "", nil, nil)
+	otherTask, _ := db.CreateTask(other.ID, nil, "Other", "", "", "", "", "", "", "", nil, nil)
+	note, _ := db.CreateTaskNote(otherTask.ID, "note")
+	shared, _ := db.CreateProblem(&other.ID, nil, "Shared", "", "", "")
+	db.LinkProblemToProject(shared.ID, mine.ID)
+	unlinked, _ := db.CreateGoal(nil, nil, "Unlinked", "", "", "", nil, nil)
+
+	token, _, _ := db.CreateAPIToken("scoped", AccessRead, &mine.ID)
+	for _, c := range []struct {
+		entity string
+		id     int64
+		ok     bool
+	}{
+		{EntityProject, mine.ID, true},
+		{EntityProject, other.ID, false},
+		{EntityTask, task.ID, true},
+		{EntityTask, otherTask.ID, false},
+		{EntityTaskNote, note.ID, false},
+		{EntityProblem, shared.ID, true},
+		{EntityGoal, unlinked.ID, false},
+		{EntityTask, 999, false},
+		{EntityPerson, 1, false},
+	} {
+		err := db.authorizeItem(token, c.entity, c.id)
+		if c.ok && err != nil || !c.ok && !errors.Is(err, ErrForbidden) {
+			t.Errorf("%s %d: expected ok=%v, got %v", c.entity, c.id, c.ok, err)
+		}
+	}
+
+	unscoped, _, _ := db.CreateAPIToken("all", AccessRead, nil)
+	if err := db.authorizeItem(unscoped, EntityTask, otherTask.ID); err != nil {
+		t.Errorf("expected an unscoped token to reach any item, got %v", err)
+	}
+	if err := db.authorizeReferences(token, map[string]interface{}{"project_id": float64(mine.ID), "depends_on_id": float64(otherTask.ID)}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("expected a reference outside the project to be forbidden, got %v", err)
+	}
+}
+
+func TestTokenCommand(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "loom.db")
+
+	var out bytes.Buffer
+	if err := runCommand(&Config{DBPath: dbPath}, []string{"token", "create", "laptop", "-access", "write"}, &out); err != nil {
+		t.Fatalf("token create failed: %v", err)
+	}
+	if !strings.Contains(out.String(), `Created write token 1 "laptop" for all projects`) || !strings.Contains(out.String(), tokenPrefix) {
+		t.Errorf("unexpected create output:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := runCommand(&Config{DBPath: dbPath}, []string{"token", "list"}, &out); err != nil {
+		t.Fatalf("token list failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "laptop") || !strings.Contains(out.String(), "never") {
+		t.Errorf("unexpected list output:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := runCommand(&Config{DBPath: dbPath}, []string{"token", "revoke", "1"}, &out); err != nil {
+		t.Fatalf("token revoke failed: %v", err)
+	}
+	if !strings.Contains(out.String(), `Revoked token 1 "laptop"`) {
+		t.Errorf("unexpected revoke output:\n%s", out.String())
+	}
+
+	for _, args := range [][]string{{"token"}, {"token", "create"}, {"token", "create", "x", "-access", "admin"}, {"token", "revoke", "1"}, {"token", "rotate"}} {
+		if err := runCommand(&Config{DBPath: dbPath}, args, &out); err == nil {
+			t.Errorf("expected %v to fail", args)
+		}
+	}
+}
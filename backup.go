@@ -0,0 +1,406 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// Defaults for scheduled snapshots: one a day, keeping a week of them
+const (
+	DefaultBackupInterval = 24 * time.Hour
+	DefaultBackupKeep     = 7
+)
+
+// Snapshots are named loom-<time>[.<n>][-<label>].db in the backup
+// directory, where n numbers the snapshots taken after the first in the same
+// second
+const (
+	snapshotPrefix     = "loom-"
+	snapshotTimeFormat = "20060102-150405"
+)
+
+var snapshotLabelPattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Backup is a copy of the database. SchemaVersion is only known for backups
+// that were just written.
+type Backup struct {
+	Path          string    `json:"path"`
+	Label         string    `json:"label,omitempty"`
+	Size          int64     `json:"size"`
+	SchemaVersion int       `json:"schema_version,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+
+	// seq orders the snapshots taken in the same second
+	seq int
+}
+
+// SetBackups sets the directory snapshots are written to, how often they
+// are taken and how many are kept. A zero interval turns scheduled snapshots
+// off, and zero keep keeps every snapshot.
+func (d *Database) SetBackups(dir string, interval time.Duration, keep int) {
+	d.backupDir = dir
+	d.backupInterval = interval
+	d.backupKeep = keep
+}
+
+// BackupTo writes a consistent copy of the database to path while it stays
+// in use. The copy is written next to path first, so path never holds a
+// partial backup.
+func (d *Database) BackupTo(path string) (*Backup, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	tmpPath := path + ".tmp"
+	os.Remove(tmpPath)
+	if _, err := d.db.Exec("VACUUM INTO ?", tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("failed to back up database: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("failed to back up database: %w", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	version, err := d.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	return &Backup{Path: path, Size: info.Size(), SchemaVersion: version, CreatedAt: info.ModTime().UTC()}, nil
+}
+
+// Snapshot backs the database up into the backup directory, then removes
+// the oldest snapshots beyond the number kept. The label, if any, is added
+// to the file name to say what the snapshot was taken for.
+func (d *Database) Snapshot(label string) (*Backup, error) {
+	if d.backupDir == "" {
+		return nil, fmt.Errorf("%w backup directory: none is configured", ErrInvalidValue)
+	}
+	label = strings.Trim(snapshotLabelPattern.ReplaceAllString(strings.ToLower(label), "-"), "-")
+	if len(label) > 40 {
+		label = strings.TrimRight(label[:40], "-")
+	}
+
+	// Claim a name no other snapshot has, so snapshots taken in the same
+	// second, even by other processes, don't collide
+	if err := os.MkdirAll(d.backupDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	now := time.Now().UTC()
+	stamp := now.Format(snapshotTimeFormat)
+	backups, err := d.ListBackups()
+	if err != nil {
+		return nil, err
+	}
+	seq := 1
+	for _, backup := range backups {
+		if backup.CreatedAt.Equal(now.Truncate(time.Second)) && backup.seq >= seq {
+			seq = backup.seq + 1
+		}
+	}
+	var path string
+	for ; ; seq++ {
+		name := snapshotPrefix + stamp
+		if seq > 1 {
+			name += "." + strconv.Itoa(seq)
+		}
+		if label != "" {
+			name += "-" + label
+		}
+		path = filepath.Join(d.backupDir, name+".db")
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create snapshot: %w", err)
+		}
+		f.Close()
+		break
+	}
+
+	backup, err := d.BackupTo(path)
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	backup.Label = label
+	if err := d.rotateSnapshots(); err != nil {
+		log.Printf("Failed to remove old snapshots: %v", err)
+	}
+	return backup, nil
+}
+
+// ListBackups lists the snapshots in the backup directory, newest first
+func (d *Database) ListBackups() ([]*Backup, error) {
+	entries, err := os.ReadDir(d.backupDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []*Backup
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, ".db") {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), ".db")
+		if len(stamp) < len(snapshotTimeFormat) {
+			continue
+		}
+		createdAt, err := time.Parse(snapshotTimeFormat, stamp[:len(snapshotTimeFormat)])
+		if err != nil {
+			continue
+		}
+		rest, seq := stamp[len(snapshotTimeFormat):], 1
+		if n, ok := strings.CutPrefix(rest, "."); ok {
+			n, rest, _ = strings.Cut(n, "-")
+			if seq, err = strconv.Atoi(n); err != nil {
+				continue
+			}
+			rest = "-" + rest
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, &Backup{
+			Path:      filepath.Join(d.backupDir, name),
+			Label:     strings.TrimPrefix(rest, "-"),
+			Size:      info.Size(),
+			CreatedAt: createdAt,
+			seq:       seq,
+		})
+	}
+	sort.SliceStable(backups, func(i, j int) bool {
+		if !backups[i].CreatedAt.Equal(backups[j].CreatedAt) {
+			return backups[i].CreatedAt.After(backups[j].CreatedAt)
+		}
+		return backups[i].seq > backups[j].seq
+	})
+	return backups, nil
+}
+
+// rotateSnapshots removes the oldest snapshots beyond the number kept
+func (d *Database) rotateSnapshots() error {
+	if d.backupKeep <= 0 {
+		return nil
+	}
+	backups, err := d.ListBackups()
+	if err != nil {
+		return err
+	}
+	for i := d.backupKeep; i < len(backups); i++ {
+		if err := os.Remove(backups[i].Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshotIfDue takes a snapshot if the newest one is older than the backup
+// interval, returning nil if none was due
+func (d *Database) snapshotIfDue() (*Backup, error) {
+	backups, err := d.ListBackups()
+	if err != nil {
+		return nil, err
+	}
+	if len(backups) > 0 && time.Since(backups[0].CreatedAt) < d.backupInterval {
+		return nil, nil
+	}
+	return d.Snapshot("")
+}
+
+// StartSnapshotScheduler takes a snapshot whenever the newest one is older
+// than the backup interval, checking now and then every check, until the
+// returned function is called. Checking rather than snapshotting on a timer
+// keeps restarts from taking extra snapshots. It does nothing when the
+// interval is zero.
+func (d *Database) StartSnapshotScheduler(check time.Duration) func() {
+	if d.backupInterval <= 0 || d.backupDir == "" {
+		return func() {}
+	}
+
+	snapshot := func() {
+		backup, err := d.snapshotIfDue()
+		if err != nil {
+			log.Printf("Failed to take snapshot: %v", err)
+		} else if backup != nil {
+			log.Printf("Saved snapshot %s", backup.Path)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(check)
+		defer ticker.Stop()
+		snapshot()
+		for {
+			select {
+			case <-ticker.C:
+				snapshot()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// readBackupVersion checks that the file at path is an intact Loom database
+// and returns its schema version, without changing it
+func readBackupVersion(path string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+	uri, err := fileURI(path, "mode=ro")
+	if err != nil {
+		return 0, err
+	}
+	db, err := sql.Open("sqlite", uri)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return 0, fmt.Errorf("%w backup: %s is not a SQLite database: %v", ErrInvalidValue, path, err)
+	}
+	if result != "ok" {
+		return 0, fmt.Errorf("%w backup: %s is corrupt: %s", ErrInvalidValue, path, result)
+	}
+	var version int
+	if err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, fmt.Errorf("%w backup: %s is not a Loom database", ErrInvalidValue, path)
+	}
+	return version, nil
+}
+
+// RestoreDatabase replaces the database at dbPath with the backup at
+// backupPath. It fails if anything else, such as a running Loom server, has
+// the database open, and keeps it locked until the backup is in place. Backups from a newer Loom are refused; older ones are
+// migrated once restored. The database being replaced is first saved next to
+// it, and its path is returned.
+func RestoreDatabase(backupPath, dbPath string) (savedPath string, applied []Migration, err error) {
+	version, err := readBackupVersion(backupPath)
+	if err != nil {
+		return "", nil, err
+	}
+	if version > LatestSchemaVersion() {
+		return "", nil, fmt.Errorf("%w backup: %s has schema version %d, newer than the %d this Loom supports; upgrade Loom first", ErrInvalidValue, backupPath, version, LatestSchemaVersion())
+	}
+
+	// Hold the database locked from the moment it is saved until the backup
+	// is restored into it and migrated, so that nothing else can open it in
+	// between
+	_, statErr := os.Stat(dbPath)
+	current, err := lockDatabase(dbPath)
+	if err != nil {
+		return "", nil, err
+	}
+	defer func() {
+		if closeErr := current.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	// Save the current database, which also folds in its write-ahead log
+	if statErr == nil {
+		savedPath = dbPath + ".before-restore-" + time.Now().UTC().Format(snapshotTimeFormat)
+		if _, err := current.BackupTo(savedPath); err != nil {
+			return "", nil, err
+		}
+	}
+
+	if err := current.restoreFrom(backupPath); err != nil {
+		return savedPath, nil, fmt.Errorf("failed to restore backup: %w", err)
+	}
+	applied, err = current.Migrate()
+	if err != nil {
+		return savedPath, applied, fmt.Errorf("failed to migrate restored database: %w", err)
+	}
+	return savedPath, applied, nil
+}
+
+// lockDatabase opens the database at path and locks it until it is closed,
+// failing if any other connection has it open. In write-ahead log mode,
+// SQLite only grants an exclusive lock when no other connection is using the
+// log.
+func lockDatabase(path string) (*Database, error) {
+	d, err := OpenDatabase(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, stmt := range []string{"PRAGMA busy_timeout = 0", "PRAGMA locking_mode = EXCLUSIVE", "BEGIN EXCLUSIVE", "COMMIT"} {
+		if _, err := d.db.Exec(stmt); err != nil {
+			d.Close()
+			if strings.Contains(err.Error(), "SQLITE_BUSY") {
+				return nil, fmt.Errorf("%w database: %s is in use, for example by a running Loom server; stop it first", ErrInvalidValue, path)
+			}
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// restoreFrom replaces the contents of the database with those of the
+// database at path. It copies the pages in with SQLite's backup API rather
+// than replacing the file, so that the lock on the file is kept throughout.
+func (d *Database) restoreFrom(path string) error {
+	uri, err := fileURI(path, "mode=ro")
+	if err != nil {
+		return err
+	}
+	conn, err := d.db.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(driverConn interface{}) error {
+		restorer, ok := driverConn.(interface {
+			NewRestore(srcURI string) (*sqlite.Backup, error)
+		})
+		if !ok {
+			return errors.New("the SQLite driver cannot restore backups")
+		}
+		restore, err := restorer.NewRestore(uri)
+		if err != nil {
+			return err
+		}
+		if _, err := restore.Step(-1); err != nil {
+			restore.Finish()
+			return err
+		}
+		return restore.Finish()
+	})
+}
+
+// fileURI returns the SQLite URI of the file at path, with query, escaping
+// characters in the path such as ? and # that mean something in a URI
+func fileURI(path, query string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs), RawQuery: query}).String(), nil
+}
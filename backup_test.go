@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "loom.db")
+	db, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	db.CreateProject("Kept", "", "", "", nil, nil)
+
+	backupPath := filepath.Join(dir, "out", "backup.db")
+	backup, err := db.BackupTo(backupPath)
+	if err != nil {
+		t.Fatalf("failed to back up: %v", err)
+	}
+	if backup.Size == 0 || backup.SchemaVersion != LatestSchemaVersion() {
+		t.Errorf("unexpected backup %+v", backup)
+	}
+	if _, err := os.Stat(backupPath + ".tmp"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected no temporary file to be left behind, got %v", err)
+	}
+
+	// Changes made after the backup are undone by restoring it
+	db.CreateProject("Lost", "", "", "", nil, nil)
+	db.Close()
+
+	// The backup is restored into the database file, which stays locked
+	// throughout, rather than replacing it
+	before, _ := os.Stat(dbPath)
+	savedPath, applied, err := RestoreDatabase(backupPath, dbPath)
+	if err != nil {
+		t.Fatalf("failed to restore: %v", err)
+	}
+	if after, err := os.Stat(dbPath); err != nil || !os.SameFile(before, after) {
+		t.Errorf("expected the database file to be restored in place, got %v", err)
+	}
+	if len(applied) != 0 || !strings.HasPrefix(savedPath, dbPath+".before-restore-") {
+		t.Errorf("unexpected restore result %q, %v", savedPath, applied)
+	}
+	restored, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open restored database: %v", err)
+	}
+	defer restored.Close()
+	if projects, _ := restored.ListProjects(nil); len(projects) != 1 || projects[0].Name != "Kept" {
+		t.Errorf("expected only the backed up project, got %+v", projects)
+	}
+	if version, _ := readBackupVersion(savedPath); version != LatestSchemaVersion() {
+		t.Errorf("expected the replaced database to be saved, got version %d", version)
+	}
+}
+
+func TestRestoreChecksBackup(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "loom.db")
+
+	notSQLite := filepath.Join(dir, "notes.txt")
+	os.WriteFile(notSQLite, []byte("not a database"), 0o644)
+	if _, _, err := RestoreDatabase(notSQLite, dbPath); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("expected a file that is not a database to be refused, got %v", err)
+	}
+	if _, _, err := RestoreDatabase(filepath.Join(dir, "missing.db"), dbPath); err == nil {
+		t.Error("expected a missing backup to be refused")
+	}
+
+	// A database in use is left alone
+	inUse := filepath.Join(dir, "in-use.db")
+	server, err := NewDatabase(inUse)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	server.CreateProject("Open", "", "", "", nil, nil)
+	server.BackupTo(filepath.Join(dir, "a?b#c d", "backup.db"))
+	if version, err := readBackupVersion(filepath.Join(dir, "a?b#c d", "backup.db")); version != LatestSchemaVersion() {
+		t.Errorf("expected a backup whose path needs escaping to be read, got version %d, %v", version, err)
+	}
+	if _, _, err := RestoreDatabase(filepath.Join(dir, "a?b#c d", "backup.db"), inUse); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("expected restoring over a database in use to be refused, got %v", err)
+	}
+	if projects, err := server.ListProjects(nil); err != nil || len(projects) != 1 {
+		t.Errorf("expected the database in use to keep working, got %+v, %v", projects, err)
+	}
+	server.Close()
+
+	// A backup from a newer Loom
+	newer, err := NewDatabase(filepath.Join(dir, "newer.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	newer.db.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, 'from the future')", LatestSchemaVersion()+1)
+	newer.Close()
+	if _, _, err := RestoreDatabase(filepath.Join(dir, "newer.db"), dbPath); err == nil || !strings.Contains(err.Error(), "upgrade Loom first") {
+		t.Errorf("expected a newer backup to be refused, got %v", err)
+	}
+	if _, err := os.Stat(dbPath); !errors.Is(err, os.ErrNotExist) {
+		t.Error("expected a refused restore to leave the database alone")
+	}
+
+	// An older backup is migrated once restored
+	older, err := OpenDatabase(filepath.Join(dir, "older.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	older.applyMigrations(migrations[:10])
+	older.Close()
+	_, applied, err := RestoreDatabase(filepath.Join(dir, "older.db"), dbPath)
+	if err != nil || len(applied) != len(migrations)-10 {
+		t.Errorf("expected the older backup to be migrated, got %d migrations, %v", len(applied), err)
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	db := newTestDatabase(t)
+	dir := t.TempDir()
+	db.SetBackups(dir, time.Hour, 2)
+
+	first, err := db.Snapshot("Before Reorg!")
+	if err != nil {
+		t.Fatalf("failed to snapshot: %v", err)
+	}
+	if first.Label != "before-reorg" || filepath.Dir(first.Path) != dir {
+		t.Errorf("unexpected snapshot %+v", first)
+	}
+	second, err := db.Snapshot("before reorg")
+	if err != nil || second.Path == first.Path || second.Label != "before-reorg" {
+		t.Fatalf("expected a second snapshot in the same second to get its own name, got %+v, %v", second, err)
+	}
+	if backups, _ := db.ListBackups(); len(backups) != 2 || backups[0].Path != second.Path || backups[0].Label != "before-reorg" {
+		t.Errorf("expected the second snapshot to be listed first, got %+v", backups)
+	}
+
+	// Older snapshots beyond the number kept are removed
+	for i, stamp := range []string{"20200101-000000", "20210101-000000"} {
+		os.WriteFile(filepath.Join(dir, snapshotPrefix+stamp+".db"), []byte{byte(i)}, 0o644)
+	}
+	os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0o644)
+	if _, err := db.Snapshot(""); err != nil {
+		t.Fatalf("failed to snapshot: %v", err)
+	}
+	backups, _ := db.ListBackups()
+	if len(backups) != 2 || backups[1].CreatedAt.Year() < 2022 || backups[1].Path == first.Path {
+		t.Errorf("expected the two newest snapshots, got %+v, %+v", backups[0], backups[len(backups)-1])
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.txt")); err != nil {
+		t.Errorf("expected other files to be left alone, got %v", err)
+	}
+
+	// Scheduled snapshots are only taken once the newest is old enough
+	if backup, err := db.snapshotIfDue(); backup != nil || err != nil {
+		t.Errorf("expected no snapshot within the interval, got %+v, %v", backup, err)
+	}
+	db.SetBackups(t.TempDir(), time.Hour, 2)
+	if backup, err := db.snapshotIfDue(); backup == nil || err != nil {
+		t.Errorf("expected a snapshot when there are none, got %+v, %v", backup, err)
+	}
+}
+
+func TestBackupCommand(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &Config{DBPath: filepath.Join(dir, "loom.db"), Backup: BackupConfig{Dir: filepath.Join(dir, "backups"), Keep: 3}}
+
+	var out bytes.Buffer
+	if err := runCommand(cfg, []string{"backup", "-label", "manual"}, &out); err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Backed up to "+cfg.Backup.Dir) {
+		t.Errorf("unexpected backup output:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := runCommand(cfg, []string{"backup", "list"}, &out); err != nil {
+		t.Fatalf("backup list failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "manual") {
+		t.Errorf("unexpected list output:\n%s", out.String())
+	}
+
+	backupPath := filepath.Join(dir, "copy.db")
+	if err := runCommand(cfg, []string{"backup", backupPath}, &out); err != nil {
+		t.Fatalf("backup to a path failed: %v", err)
+	}
+	out.Reset()
+	if err := runCommand(cfg, []string{"restore", backupPath}, &out); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Saved the previous database") || !strings.Contains(out.String(), "Restored "+backupPath) {
+		t.Errorf("unexpected restore output:\n%s", out.String())
+	}
+
+	for _, args := range [][]string{{"restore"}, {"backup", "a", "b"}, {"backup", "-label", "x", backupPath}} {
+		if err := runCommand(cfg, args, &out); err == nil {
+			t.Errorf("expected %v to fail", args)
+		}
+	}
+}
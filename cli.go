@@ -0,0 +1,525 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// runCommand runs a maintenance subcommand such as "migrate status" against
+// the configured database, writing human-readable output to out.
+func runCommand(cfg *Config, args []string, out io.Writer) error {
+	switch args[0] {
+	case "migrate":
+		return runMigrate(cfg.DBPath, args[1:], out)
+	case "doctor":
+		return runDoctor(cfg.DBPath, out)
+	case "token":
+		return runToken(cfg.DBPath, args[1:], out)
+	case "config":
+		return runConfig(cfg, args[1:], out)
+	case "backup":
+		return runBackup(cfg, args[1:], out)
+	case "restore":
+		return runRestore(cfg.DBPath, args[1:], out)
+	case "export":
+		return runExport(cfg.DBPath, args[1:], out)
+	case "import":
+		return runImport(cfg.DBPath, args[1:], out)
+	case "sync":
+		return runSync(cfg, args[1:], out)
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+func runMigrate(dbPath string, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: loom migrate status|up")
+	}
+
+	database, err := OpenDatabase(dbPath)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	switch args[0] {
+	case "status":
+		statuses, err := database.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		version, err := database.SchemaVersion()
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "Database: %s\n", dbPath)
+		fmt.Fprintf(out, "Schema version: %d (latest %d)\n\n", version, LatestSchemaVersion())
+		tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return tw.Flush()
+
+	case "up":
+		applied, err := database.Migrate()
+		for _, m := range applied {
+			fmt.Fprintf(out, "Applied %d: %s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(out, "Database is up to date")
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown migrate command %q (expected status or up)", args[0])
+	}
+}
+
+// runDoctor reports rows that break the database invariants without fixing
+// them, and fails if it finds any so it can be used in scripts.
+func runDoctor(dbPath string, out io.Writer) error {
+	database, err := OpenDatabase(dbPath)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	version, err := database.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if version != LatestSchemaVersion() {
+		return fmt.Errorf("database schema version %d does not match %d; run \"loom migrate up\" first", version, LatestSchemaVersion())
+	}
+
+	issues, err := database.CheckIntegrity()
+	if err != nil {
+		return err
+	}
+	if len(issues) == 0 {
+		fmt.Fprintln(out, "No integrity issues found")
+		return nil
+	}
+
+	for _, issue := range issues {
+		fmt.Fprintf(out, "%s %d: %s\n", issue.Entity, issue.ID, issue.Problem)
+	}
+	return fmt.Errorf("found %d integrity issue(s)", len(issues))
+}
+
+// runToken creates, lists and revokes the API tokens that authenticate REST
+// and MCP clients
+func runToken(dbPath string, args []string, out io.Writer) error {
+	usage := fmt.Errorf("usage: loom token create NAME [-access read|write] [-project ID] | list | revoke ID|NAME")
+	if len(args) == 0 {
+		return usage
+	}
+
+	database, err := NewDatabase(dbPath)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	switch args[0] {
+	case "create":
+		if len(args) < 2 {
+			return usage
+		}
+		fs := flag.NewFlagSet("token create", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		access := fs.String("access", AccessRead, "read or write")
+		project := fs.Int64("project", 0, "ID of the only project the token can reach")
+		if err := fs.Parse(args[2:]); err != nil || fs.NArg() > 0 {
+			return usage
+		}
+		var projectID *int64
+		if *project != 0 {
+			projectID = project
+		}
+
+		token, secret, err := database.CreateAPIToken(args[1], *access, projectID)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Created %s token %d %q for %s\n", token.Access, token.ID, token.Name, tokenScope(token))
+		fmt.Fprintf(out, "\n    %s\n\n", secret)
+		fmt.Fprintln(out, "Send it as \"Authorization: Bearer <token>\". It is not stored and cannot be shown again.")
+		return nil
+
+	case "list":
+		if len(args) != 1 {
+			return usage
+		}
+		tokens, err := database.ListAPITokens()
+		if err != nil {
+			return err
+		}
+		if len(tokens) == 0 {
+			fmt.Fprintln(out, "No API tokens")
+			return nil
+		}
+		tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tACCESS\tSCOPE\tCREATED\tLAST USED\tSTATUS")
+		for _, t := range tokens {
+			lastUsed, status := "never", "active"
+			if t.LastUsedAt != nil {
+				lastUsed = t.LastUsedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			if t.RevokedAt != nil {
+				status = "revoked " + t.RevokedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.Name, t.Access, tokenScope(t), t.CreatedAt.Local().Format("2006-01-02 15:04:05"), lastUsed, status)
+		}
+		return tw.Flush()
+
+	case "revoke":
+		if len(args) != 2 {
+			return usage
+		}
+		token, err := database.RevokeAPIToken(args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Revoked token %d %q\n", token.ID, token.Name)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown token command %q (expected create, list or revoke)", args[0])
+	}
+}
+
+// runBackup backs the database up while the server keeps running, either to
+// a given path or as a snapshot in the backup directory, or lists the
+// snapshots
+func runBackup(cfg *Config, args []string, out io.Writer) error {
+	usage := fmt.Errorf("usage: loom backup [-label LABEL] [PATH] | list")
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	label := fs.String("label", "", "what the snapshot is for, added to its file name")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 1 {
+		return usage
+	}
+
+	// Back up the database as it is, without migrating it first
+	database, err := OpenDatabase(cfg.DBPath)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	database.SetBackups(cfg.Backup.Dir, time.Duration(cfg.Backup.IntervalHours)*time.Hour, cfg.Backup.Keep)
+
+	if fs.Arg(0) == "list" {
+		backups, err := database.ListBackups()
+		if err != nil {
+			return err
+		}
+		if len(backups) == 0 {
+			fmt.Fprintf(out, "No snapshots in %s\n", cfg.Backup.Dir)
+			return nil
+		}
+		tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "CREATED\tLABEL\tSIZE\tPATH")
+		for _, b := range backups {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", b.CreatedAt.Local().Format("2006-01-02 15:04:05"), b.Label, b.Size, b.Path)
+		}
+		return tw.Flush()
+	}
+
+	var backup *Backup
+	if path := fs.Arg(0); path != "" {
+		if *label != "" {
+			return usage
+		}
+		backup, err = database.BackupTo(path)
+	} else {
+		backup, err = database.Snapshot(*label)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Backed up to %s (%d bytes, schema version %d)\n", backup.Path, backup.Size, backup.SchemaVersion)
+	return nil
+}
+
+// runRestore replaces the database with a backup. The server must be
+// stopped first, since it would keep using the database being replaced.
+func runRestore(dbPath string, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: loom restore PATH")
+	}
+
+	savedPath, applied, err := RestoreDatabase(args[0], dbPath)
+	if savedPath != "" {
+		fmt.Fprintf(out, "Saved the previous database to %s\n", savedPath)
+	}
+	for _, m := range applied {
+		fmt.Fprintf(out, "Applied %d: %s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Restored %s to %s\n", args[0], dbPath)
+	return nil
+}
+
+// runExport writes the workspace, or one project of it, to a file or out
+func runExport(dbPath string, args []string, out io.Writer) error {
+	usage := fmt.Errorf("usage: loom export [-format json|csv|markdown] [-project ID] [-o PATH]")
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	format := fs.String("format", "json", "json, csv (a zip of CSV files) or markdown")
+	project := fs.Int64("project", 0, "ID of the only project to export")
+	path := fs.String("o", "", "file to write instead of standard output")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return usage
+	}
+	if err := validateEnum("export format", *format, ExportFormats); err != nil {
+		return err
+	}
+	var projectID *int64
+	if *project != 0 {
+		projectID = project
+	}
+
+	database, err := NewDatabase(dbPath)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	workspace, err := database.ExportWorkspace(projectID)
+	if err != nil {
+		return err
+	}
+	if *path == "" {
+		return WriteExport(out, workspace, *format)
+	}
+
+	f, err := os.Create(*path)
+	if err != nil {
+		return err
+	}
+	if err := WriteExport(f, workspace, *format); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Exported %d projects, %d tasks, %d problems, %d outcomes and %d goals to %s\n",
+		len(workspace.Projects), len(workspace.Tasks), len(workspace.Problems), len(workspace.Outcomes), len(workspace.Goals), *path)
+	return nil
+}
+
+// runImport adds a JSON export to the database, giving its items new IDs
+// unless -preserve-ids is set
+func runImport(dbPath string, args []string, out io.Writer) error {
+	usage := fmt.Errorf("usage: loom import [-preserve-ids] PATH")
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	preserveIDs := fs.Bool("preserve-ids", false, "keep the exported IDs, failing if any is taken")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return usage
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	workspace, err := ReadExport(f)
+	if err != nil {
+		return err
+	}
+
+	database, err := NewDatabase(dbPath)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	result, err := database.ImportWorkspace(workspace, *preserveIDs)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Imported %s\n", fs.Arg(0))
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ENTITY\tCREATED")
+	for _, entity := range []string{EntityPerson, EntityTag, EntityProject, EntityTask, EntityTaskNote, EntityProblem, EntityOutcome, EntityGoal} {
+		fmt.Fprintf(tw, "%s\t%d\n", entityName(entity), result.Created[entity])
+	}
+	return tw.Flush()
+}
+
+// runSync links projects to issue trackers and syncs them. Tasks created by
+// a sync get the configured defaults and follow the configured workflows,
+// as they would in the server.
+func runSync(cfg *Config, args []string, out io.Writer) error {
+	usage := fmt.Errorf("usage: loom sync link -project ID PROVIDER REMOTE | list | unlink ID | run [-dry-run] [ID]")
+	if len(args) == 0 {
+		return usage
+	}
+
+	database, err := NewDatabase(cfg.DBPath)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	if cfg.WorkflowPath != "" {
+		workflows, err := LoadWorkflows(cfg.WorkflowPath)
+		if err != nil {
+			return err
+		}
+		if err := database.SetWorkflows(workflows); err != nil {
+			return err
+		}
+	}
+	if err := database.SetDefaults(cfg.Defaults); err != nil {
+		return err
+	}
+	database.SetIssueTrackers(cfg.IssueTrackers())
+
+	switch args[0] {
+	case "link":
+		fs := flag.NewFlagSet("sync link", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		project := fs.Int64("project", 0, "ID of the project to link")
+		if err := fs.Parse(args[1:]); err != nil || fs.NArg() != 2 || *project == 0 {
+			return usage
+		}
+		link, err := database.CreateSyncLink(*project, fs.Arg(0), fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Linked project %d to %s %s as sync link %d\n", link.ProjectID, link.Provider, link.Remote, link.ID)
+		return nil
+
+	case "list":
+		if len(args) != 1 {
+			return usage
+		}
+		links, err := database.ListSyncLinks(nil)
+		if err != nil {
+			return err
+		}
+		if len(links) == 0 {
+			fmt.Fprintln(out, "No sync links")
+			return nil
+		}
+		tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tPROJECT\tPROVIDER\tREMOTE\tLAST SYNCED\tLAST ERROR")
+		for _, l := range links {
+			lastSynced := "never"
+			if l.LastSyncedAt != nil {
+				lastSynced = l.LastSyncedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(tw, "%d\t%d\t%s\t%s\t%s\t%s\n", l.ID, l.ProjectID, l.Provider, l.Remote, lastSynced, l.LastError)
+		}
+		return tw.Flush()
+
+	case "unlink":
+		if len(args) != 2 {
+			return usage
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return usage
+		}
+		if err := database.DeleteSyncLink(id); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Removed sync link %d\n", id)
+		return nil
+
+	case "run":
+		fs := flag.NewFlagSet("sync run", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		dryRun := fs.Bool("dry-run", false, "list the changes a sync would make without making them")
+		if err := fs.Parse(args[1:]); err != nil || fs.NArg() > 1 {
+			return usage
+		}
+		var results []*SyncResult
+		if fs.NArg() == 0 {
+			results, err = database.SyncAllIssues(*dryRun)
+		} else {
+			id, parseErr := strconv.ParseInt(fs.Arg(0), 10, 64)
+			if parseErr != nil {
+				return usage
+			}
+			var result *SyncResult
+			if result, err = database.SyncIssues(id, *dryRun); result != nil {
+				results = append(results, result)
+			}
+		}
+		if len(results) > 0 {
+			tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "LINK\tPROJECTS\tCREATED\tUPDATED\tNOTES\tPUSHED\tCOMMENTS\tCONFLICTS\tERRORS")
+			for _, r := range results {
+				fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n", r.LinkID, r.Projects, r.Created, r.Updated, r.Notes, r.Pushed, r.Comments, r.Conflicts, len(r.Errors))
+			}
+			if flushErr := tw.Flush(); flushErr != nil {
+				return flushErr
+			}
+			for _, r := range results {
+				if *dryRun {
+					for _, c := range r.Changes {
+						fmt.Fprintf(out, "Link %d would %s\n", r.LinkID, c)
+					}
+				}
+				for _, e := range r.Errors {
+					fmt.Fprintf(out, "Link %d: %s\n", r.LinkID, e)
+				}
+			}
+		} else if err == nil {
+			fmt.Fprintln(out, "No sync links")
+		}
+		return err
+
+	default:
+		return fmt.Errorf("unknown sync command %q (expected link, list, unlink or run)", args[0])
+	}
+}
+
+// tokenScope describes which projects a token can reach
+func tokenScope(t *APIToken) string {
+	if t.ProjectID == nil {
+		return "all projects"
+	}
+	return fmt.Sprintf("project %d", *t.ProjectID)
+}
+
+// runConfig prints the effective configuration and where each setting came
+// from
+func runConfig(cfg *Config, args []string, out io.Writer) error {
+	if len(args) != 1 || args[0] != "show" {
+		return fmt.Errorf("usage: loom config show")
+	}
+
+	if cfg.Path() != "" {
+		fmt.Fprintf(out, "Config file: %s\n\n", cfg.Path())
+	} else {
+		fmt.Fprintf(out, "Config file: none (create %s to set defaults)\n\n", DefaultConfigPath())
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tVALUE\tSOURCE")
+	for _, f := range cfg.fields() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", f.key, f, cfg.Source(f.key))
+	}
+	return tw.Flush()
+}
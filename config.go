@@ -0,0 +1,409 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// DefaultTTSEngine is the echogarden engine that speaks voice messages
+const DefaultTTSEngine = "kokoro"
+
+// Config is Loom's configuration. Each setting comes from, in increasing
+// order of precedence, the built-in default, the config file, its
+// environment variable and its command-line flag. The env and flag tags
+// name the variable and flag that can set a field.
+type Config struct {
+	DBPath       string `toml:"db_path" env:"LOOM_DB_PATH"`
+	Timezone     string `toml:"timezone" env:"LOOM_TIMEZONE"`
+	WorkflowPath string `toml:"workflow_path" env:"LOOM_WORKFLOW_PATH"`
+
+	Server   ServerConfig `toml:"server"`
+	Auth     AuthConfig   `toml:"auth"`
+	Voice    VoiceConfig  `toml:"voice"`
+	Trash    TrashConfig  `toml:"trash"`
+	Backup   BackupConfig `toml:"backup"`
+	Sync     SyncConfig   `toml:"sync"`
+	GitHub   GitHubConfig `toml:"github"`
+	Jira     JiraConfig   `toml:"jira"`
+	MCP      MCPConfig    `toml:"mcp"`
+	Defaults Defaults     `toml:"defaults"`
+
+	// path is the config file that was read, and sources records where
+	// each setting that is not a default came from
+	path    string
+	sources map[string]string
+}
+
+// ServerConfig holds the addresses of the API and dashboard servers
+type ServerConfig struct {
+	Addr        string   `toml:"addr" env:"LOOM_ADDR" flag:"addr"`
+	WebAddr     string   `toml:"web_addr" env:"LOOM_WEB_ADDR" flag:"web-addr"`
+	CORSOrigins []string `toml:"cors_origins" env:"LOOM_CORS_ORIGINS"`
+}
+
+// AuthConfig controls API authentication. Token is the API token a stdio
+// server uses to forward voice messages to a running dashboard.
+type AuthConfig struct {
+	LocalOnly bool   `toml:"local_only" env:"LOOM_LOCAL_ONLY" flag:"local-only"`
+	Token     string `toml:"token" env:"LOOM_TOKEN" secret:"true"`
+}
+
+// VoiceConfig controls how voice messages are spoken, and where a stdio
+// server forwards them
+type VoiceConfig struct {
+	Engine       string `toml:"engine" env:"LOOM_TTS_ENGINE"`
+	Voice        string `toml:"voice" env:"LOOM_TTS_VOICE"`
+	DashboardURL string `toml:"dashboard_url" env:"LOOM_DASHBOARD_URL" flag:"dashboard-url"`
+}
+
+// TrashConfig controls how long deleted items are kept; 0 keeps them until
+// they are purged by hand
+type TrashConfig struct {
+	RetentionDays int `toml:"retention_days" env:"LOOM_TRASH_RETENTION_DAYS"`
+}
+
+// BackupConfig controls the snapshots the server takes. Dir defaults to a
+// backups directory next to the database; a zero interval turns snapshots
+// off, and zero keep keeps every one.
+type BackupConfig struct {
+	Dir           string `toml:"dir" env:"LOOM_BACKUP_DIR"`
+	IntervalHours int    `toml:"interval_hours" env:"LOOM_BACKUP_INTERVAL_HOURS"`
+	Keep          int    `toml:"keep" env:"LOOM_BACKUP_KEEP"`
+}
+
+// SyncConfig controls how often the server syncs projects linked to issue
+// trackers; 0 only syncs them on request
+type SyncConfig struct {
+	IntervalMinutes int `toml:"interval_minutes" env:"LOOM_SYNC_INTERVAL_MINUTES"`
+}
+
+// GitHubConfig holds the API and token used to sync GitHub issues
+type GitHubConfig struct {
+	APIURL string `toml:"api_url" env:"LOOM_GITHUB_API_URL"`
+	Token  string `toml:"token" env:"LOOM_GITHUB_TOKEN" secret:"true"`
+}
+
+// JiraConfig holds the site, credentials and status mapping used to sync
+// Jira issues; Jira is only synced when the URL is set. Jira Cloud takes the
+// account's email with an API token, and Server and Data Center a personal
+// access token without one. Statuses maps Jira status names to task
+// statuses, for statuses their category does not map well.
+type JiraConfig struct {
+	URL      string            `toml:"url" env:"LOOM_JIRA_URL"`
+	Email    string            `toml:"email" env:"LOOM_JIRA_EMAIL"`
+	Token    string            `toml:"token" env:"LOOM_JIRA_TOKEN" secret:"true"`
+	Statuses map[string]string `toml:"statuses" env:"LOOM_JIRA_STATUSES"`
+}
+
+// MCPConfig lists the groups of MCP tools to serve
+type MCPConfig struct {
+	Tools []string `toml:"tools" env:"LOOM_MCP_TOOLS"`
+}
+
+// DefaultConfig returns the built-in configuration
+func DefaultConfig() *Config {
+	dbPath := filepath.Join(".loom", "loom.db")
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		dbPath = filepath.Join(homeDir, dbPath)
+	}
+	return &Config{
+		DBPath: dbPath,
+		Server: ServerConfig{
+			Addr:    "127.0.0.1:8080",
+			WebAddr: "127.0.0.1:3000",
+		},
+		Voice:    VoiceConfig{Engine: DefaultTTSEngine},
+		Trash:    TrashConfig{RetentionDays: int(DefaultTrashRetention / (24 * time.Hour))},
+		Backup:   BackupConfig{IntervalHours: int(DefaultBackupInterval / time.Hour), Keep: DefaultBackupKeep},
+		Sync:     SyncConfig{IntervalMinutes: int(DefaultSyncInterval / time.Minute)},
+		GitHub:   GitHubConfig{APIURL: DefaultGitHubAPIURL},
+		MCP:      MCPConfig{Tools: slices.Clone(ToolGroups)},
+		Defaults: DefaultDefaults(),
+		sources:  map[string]string{},
+	}
+}
+
+// DefaultConfigPath returns the path of the config file read when none is
+// given, ~/.loom/config.toml
+func DefaultConfigPath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(homeDir, ".loom", "config.toml")
+}
+
+// LoadConfig builds the effective configuration from the config file at
+// path, the environment and the flags set on the command line, keyed by flag
+// name. A missing file is only an error if required is set.
+func LoadConfig(path string, required bool, getenv func(string) (string, bool), flags map[string]string) (*Config, error) {
+	c := DefaultConfig()
+	c.path = path
+
+	if path != "" {
+		md, err := toml.DecodeFile(path, c)
+		switch {
+		case errors.Is(err, fs.ErrNotExist) && !required:
+			c.path = ""
+		case err != nil:
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		default:
+			if undecoded := md.Undecoded(); len(undecoded) > 0 {
+				return nil, fmt.Errorf("unknown setting %q in config file %s", undecoded[0].String(), path)
+			}
+			for _, f := range c.fields() {
+				if md.IsDefined(strings.Split(f.key, ".")...) {
+					c.sources[f.key] = "config file"
+				}
+			}
+		}
+	}
+
+	for _, f := range c.fields() {
+		if f.env != "" {
+			if value, ok := getenv(f.env); ok {
+				if err := f.set(value); err != nil {
+					return nil, fmt.Errorf("invalid %s %q: %w", f.env, value, err)
+				}
+				c.sources[f.key] = "env " + f.env
+			}
+		}
+		if f.flag != "" {
+			if value, ok := flags[f.flag]; ok {
+				if err := f.set(value); err != nil {
+					return nil, fmt.Errorf("invalid -%s %q: %w", f.flag, value, err)
+				}
+				c.sources[f.key] = "flag -" + f.flag
+			}
+		}
+	}
+
+	for _, path := range []*string{&c.DBPath, &c.WorkflowPath, &c.Backup.Dir} {
+		if strings.HasPrefix(*path, "~/") {
+			if homeDir, err := os.UserHomeDir(); err == nil {
+				*path = filepath.Join(homeDir, (*path)[2:])
+			}
+		}
+	}
+	if c.Backup.Dir == "" {
+		c.Backup.Dir = filepath.Join(filepath.Dir(c.DBPath), "backups")
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// validate checks the settings that can be checked before anything starts
+func (c *Config) validate() error {
+	check := func(key string, err error) error {
+		if err == nil {
+			return nil
+		}
+		return fmt.Errorf("invalid %s (from %s): %w", key, c.Source(key), err)
+	}
+
+	if c.DBPath == "" {
+		return check("db_path", errors.New("a database path is required"))
+	}
+	if _, err := c.Location(); err != nil {
+		return check("timezone", fmt.Errorf("expected an IANA time zone such as Europe/London"))
+	}
+	for key, addr := range map[string]string{"server.addr": c.Server.Addr, "server.web_addr": c.Server.WebAddr} {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return check(key, err)
+		}
+	}
+	if !voiceNamePattern.MatchString(c.Voice.Engine) {
+		return check("voice.engine", fmt.Errorf("%q is not an engine name", c.Voice.Engine))
+	}
+	if c.Voice.Voice != "" && !voiceNamePattern.MatchString(c.Voice.Voice) {
+		return check("voice.voice", fmt.Errorf("%q is not a voice name", c.Voice.Voice))
+	}
+	if c.Trash.RetentionDays < 0 {
+		return check("trash.retention_days", errors.New("expected a number of days"))
+	}
+	if c.Backup.IntervalHours < 0 {
+		return check("backup.interval_hours", errors.New("expected a number of hours"))
+	}
+	if c.Backup.Keep < 0 {
+		return check("backup.keep", errors.New("expected a number of snapshots"))
+	}
+	if c.Sync.IntervalMinutes < 0 {
+		return check("sync.interval_minutes", errors.New("expected a number of minutes"))
+	}
+	urls := map[string]string{"github.api_url": c.GitHub.APIURL}
+	if c.Jira.URL != "" {
+		urls["jira.url"] = c.Jira.URL
+	}
+	for key, value := range urls {
+		if u, err := url.Parse(value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return check(key, fmt.Errorf("%q is not an http or https URL", value))
+		}
+	}
+	for name, status := range c.Jira.Statuses {
+		if err := validateEnum("status for Jira status "+name, status, TaskStatuses); err != nil {
+			return check("jira.statuses", err)
+		}
+	}
+	for _, group := range c.MCP.Tools {
+		if !slices.Contains(ToolGroups, group) {
+			return check("mcp.tools", fmt.Errorf("unknown tool group %q (expected any of: %s)", group, strings.Join(ToolGroups, ", ")))
+		}
+	}
+	return check("defaults", c.Defaults.validate())
+}
+
+// Location returns the time zone natural dates are parsed in
+func (c *Config) Location() (*time.Location, error) {
+	if c.Timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(c.Timezone)
+}
+
+// IssueTrackers returns the clients for each configured sync provider
+func (c *Config) IssueTrackers() map[string]IssueTracker {
+	trackers := map[string]IssueTracker{
+		"github": NewGitHubClient(c.GitHub.APIURL, c.GitHub.Token),
+	}
+	if c.Jira.URL != "" {
+		trackers["jira"] = NewJiraClient(c.Jira.URL, c.Jira.Email, c.Jira.Token, c.Jira.Statuses, nil)
+	}
+	return trackers
+}
+
+// Path returns the config file that was read, or an empty string if there
+// was none
+func (c *Config) Path() string {
+	return c.path
+}
+
+// Source describes where a setting came from: "default", "config file",
+// "env LOOM_..." or "flag -...". Tables report the source of their most
+// specific setting.
+func (c *Config) Source(key string) string {
+	if source, ok := c.sources[key]; ok {
+		return source
+	}
+	for k, source := range c.sources {
+		if strings.HasPrefix(k, key+".") {
+			return source
+		}
+	}
+	return "default"
+}
+
+// configField is a single setting of a Config, found by walking its fields
+type configField struct {
+	key    string
+	env    string
+	flag   string
+	secret bool
+	value  reflect.Value
+}
+
+// fields lists every setting of the config, keyed as in the config file
+func (c *Config) fields() []configField {
+	var fields []configField
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := field.Tag.Get("toml")
+			if name == "" {
+				continue
+			}
+			if field.Type.Kind() == reflect.Struct {
+				walk(v.Field(i), prefix+name+".")
+				continue
+			}
+			fields = append(fields, configField{
+				key:    prefix + name,
+				env:    field.Tag.Get("env"),
+				flag:   field.Tag.Get("flag"),
+				secret: field.Tag.Get("secret") == "true",
+				value:  v.Field(i),
+			})
+		}
+	}
+	walk(reflect.ValueOf(c).Elem(), "")
+	return fields
+}
+
+// set parses value into the field. Lists are separated by commas, and so
+// are the NAME=VALUE pairs of tables.
+func (f configField) set(value string) error {
+	switch f.value.Kind() {
+	case reflect.String:
+		f.value.SetString(strings.TrimSpace(value))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return errors.New("expected true or false")
+		}
+		f.value.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return errors.New("expected a whole number")
+		}
+		f.value.SetInt(int64(n))
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		f.value.Set(reflect.ValueOf(items))
+	case reflect.Map:
+		table := map[string]string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			name, v, ok := strings.Cut(item, "=")
+			if !ok {
+				return fmt.Errorf("expected NAME=VALUE, got %q", item)
+			}
+			table[strings.TrimSpace(name)] = strings.TrimSpace(v)
+		}
+		f.value.Set(reflect.ValueOf(table))
+	default:
+		return fmt.Errorf("unsupported setting type %s", f.value.Type())
+	}
+	return nil
+}
+
+// String formats the field's value for display, hiding secrets
+func (f configField) String() string {
+	switch {
+	case f.secret && f.value.String() != "":
+		return "(set)"
+	case f.value.Kind() == reflect.Slice:
+		return strings.Join(f.value.Interface().([]string), ",")
+	case f.value.Kind() == reflect.Map:
+		var pairs []string
+		for name, value := range f.value.Interface().(map[string]string) {
+			pairs = append(pairs, name+"="+value)
+		}
+		slices.Sort(pairs)
+		return strings.Join(pairs, ",")
+	default:
+		return fmt.Sprint(f.value.Interface())
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	return path
+}
+
+func testEnv(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfigFile(t, `
+db_path = "/data/loom.db"
+timezone = "Europe/London"
+
+[server]
+addr = "127.0.0.1:9090"
+web_addr = "127.0.0.1:4000"
+
+[auth]
+token = "loom_secret"
+
+[voice]
+voice = "af_heart"
+
+[mcp]
+tools = ["tasks", "projects"]
+
+[defaults]
+task_priority = "high"
+`)
+	cfg, err := LoadConfig(path, true, testEnv(map[string]string{
+		"LOOM_ADDR":                 "127.0.0.1:7070",
+		"LOOM_CORS_ORIGINS":         "https://a.example, https://b.example",
+		"LOOM_TRASH_RETENTION_DAYS": "7",
+		"LOOM_JIRA_STATUSES":        "Waiting=blocked, In Review=in_progress",
+	}), map[string]string{"addr": "127.0.0.1:6060", "local-only": "true"})
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	if cfg.DBPath != "/data/loom.db" || cfg.Server.WebAddr != "127.0.0.1:4000" || cfg.Voice.Voice != "af_heart" || cfg.Defaults.TaskPriority != "high" {
+		t.Errorf("expected the config file settings, got %+v", cfg)
+	}
+	if cfg.Server.Addr != "127.0.0.1:6060" || !cfg.Auth.LocalOnly {
+		t.Errorf("expected flags to override the environment, got %+v", cfg.Server)
+	}
+	if !slices.Equal(cfg.Server.CORSOrigins, []string{"https://a.example", "https://b.example"}) || cfg.Trash.RetentionDays != 7 {
+		t.Errorf("expected the environment settings, got %+v, %+v", cfg.Server, cfg.Trash)
+	}
+	if cfg.Voice.Engine != DefaultTTSEngine || cfg.Defaults.TaskStatus != "pending" {
+		t.Errorf("expected unset settings to keep their defaults, got %+v, %+v", cfg.Voice, cfg.Defaults)
+	}
+	if !slices.Equal(cfg.MCP.Tools, []string{"tasks", "projects"}) || len(ToolGroups) != 17 || ToolGroups[0] != "projects" {
+		t.Errorf("expected the tool groups from the file without changing ToolGroups, got %v, %v", cfg.MCP.Tools, ToolGroups)
+	}
+	if want := map[string]string{"Waiting": "blocked", "In Review": "in_progress"}; !maps.Equal(cfg.Jira.Statuses, want) {
+		t.Errorf("expected the Jira status mapping from the environment, got %v", cfg.Jira.Statuses)
+	}
+	if cfg.Backup.Dir != filepath.Join("/data", "backups") || cfg.Backup.Keep != DefaultBackupKeep {
+		t.Errorf("expected snapshots next to the database by default, got %+v", cfg.Backup)
+	}
+
+	for key, want := range map[string]string{
+		"db_path":              "config file",
+		"server.addr":          "flag -addr",
+		"server.cors_origins":  "env LOOM_CORS_ORIGINS",
+		"trash.retention_days": "env LOOM_TRASH_RETENTION_DAYS",
+		"voice.engine":         "default",
+		"defaults":             "config file",
+	} {
+		if got := cfg.Source(key); got != want {
+			t.Errorf("%s: expected source %q, got %q", key, want, got)
+		}
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.toml")
+	if cfg, err := LoadConfig(missing, false, testEnv(nil), nil); err != nil || cfg.Path() != "" {
+		t.Errorf("expected a missing optional config file to be ignored, got %v", err)
+	}
+	if _, err := LoadConfig(missing, true, testEnv(nil), nil); err == nil {
+		t.Error("expected a missing required config file to fail")
+	}
+
+	for _, c := range []struct {
+		file string
+		env  map[string]string
+		want string
+	}{
+		{"[server]\nport = 80\n", nil, `unknown setting "server.port"`},
+		{"timezone = 3\n", nil, "failed to read config file"},
+		{"timezone = \"Mars/Olympus\"\n", nil, "invalid timezone (from config file)"},
+		{"", map[string]string{"LOOM_TRASH_RETENTION_DAYS": "-1"}, "invalid trash.retention_days (from env LOOM_TRASH_RETENTION_DAYS)"},
+		{"", map[string]string{"LOOM_TRASH_RETENTION_DAYS": "a week"}, "invalid LOOM_TRASH_RETENTION_DAYS"},
+		{"", map[string]string{"LOOM_LOCAL_ONLY": "maybe"}, "invalid LOOM_LOCAL_ONLY"},
+		{"[mcp]\ntools = [\"tasks\", \"email\"]\n", nil, `unknown tool group "email"`},
+		{"[voice]\nengine = \"kokoro; rm\"\n", nil, "invalid voice.engine"},
+		{"[defaults]\ntask_status = \"done\"\n", nil, "invalid defaults (from config file)"},
+		{"[server]\naddr = \"8080\"\n", nil, "invalid server.addr"},
+		{"[backup]\nkeep = -2\n", nil, "invalid backup.keep"},
+		{"[sync]\ninterval_minutes = -5\n", nil, "invalid sync.interval_minutes"},
+		{"", map[string]string{"LOOM_GITHUB_API_URL": "api.github.com"}, "invalid github.api_url (from env LOOM_GITHUB_API_URL)"},
+		{"[jira]\nurl = \"https://acme.atlassian.net\"\nstatuses = { Waiting = \"on_hold\" }\n", nil, "invalid jira.statuses (from config file)"},
+	} {
+		_, err := LoadConfig(writeConfigFile(t, c.file), true, testEnv(c.env), nil)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%q %v: expected an error containing %q, got %v", c.file, c.env, c.want, err)
+		}
+	}
+}
+
+func TestConfigShowCommand(t *testing.T) {
+	path := writeConfigFile(t, "[voice]\nengine = \"espeak\"\n")
+	cfg, err := LoadConfig(path, true, testEnv(map[string]string{"LOOM_TOKEN": "loom_secret"}), map[string]string{"web-addr": "127.0.0.1:4000"})
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := runCommand(cfg, []string{"config", "show"}, &out); err != nil {
+		t.Fatalf("config show failed: %v", err)
+	}
+	for _, want := range []string{
+		"Config file: " + path,
+		"voice.engine",
+		"espeak",
+		"server.web_addr",
+		"flag -web-addr",
+		"env LOOM_TOKEN",
+		"projects,tasks,problems",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in output:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "loom_secret") {
+		t.Errorf("expected the token to be hidden:\n%s", out.String())
+	}
+
+	if err := runCommand(cfg, []string{"config"}, &out); err == nil {
+		t.Error("expected config without show to fail")
+	}
+}
+
+func TestDefaultsAndToolGroups(t *testing.T) {
+	db := newTestDatabase(t)
+	defaults := DefaultDefaults()
+	defaults.TaskStatus = "in_progress"
+	defaults.GoalType = "career"
+	if err := db.SetDefaults(defaults); err != nil {
+		t.Fatalf("failed to set defaults: %v", err)
+	}
+	defaults.ProjectStatus = "finished"
+	if err := db.SetDefaults(defaults); err == nil {
+		t.Error("expected an invalid default to be rejected")
+	}
+
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	task, _ := db.CreateTask(project.ID, nil, "T", "", "", "", "", "", "", "", nil, nil)
+	goal, _ := db.CreateGoal(nil, nil, "G", "", "", "", nil, nil)
+	if project.Status != "active" || task.Status != "in_progress" || goal.GoalType != "career" {
+		t.Errorf("expected the configured defaults, got %q, %q, %q", project.Status, task.Status, goal.GoalType)
+	}
+
+	s := NewMCPServer(db, func(VoiceMessage) (int, error) { return 0, nil }, []string{"tasks"})
+	if s.GetTool("create_task") == nil || s.GetTool("create_project") != nil || s.GetTool("send_voice_message") != nil {
+		t.Errorf("expected only the task tools, got %d tools", len(s.ListTools()))
+	}
+}
@@ -2,40 +2,77 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
-	"strings"
 	"time"
 
 	_ "modernc.org/sqlite"
 )
 
+// ErrNotFound is wrapped by errors returned when a delete or unlink targets
+// a row that does not exist.
+var ErrNotFound = errors.New("not found")
+
 type Database struct {
-	db *sql.DB
+	db        *sql.DB
+	events    *EventBus
+	workflows map[string]Workflow
+	defaults  Defaults
+	actor     string
+
+	trashRetention time.Duration
+	location       *time.Location
+
+	backupDir      string
+	backupInterval time.Duration
+	backupKeep     int
+
+	trackers map[string]IssueTracker
 }
 
 type Project struct {
-	ID           int64     `json:"id"`
-	Name         string    `json:"name"`
-	Description  string    `json:"description"`
-	Status       string    `json:"status"`
-	ExternalLink string    `json:"external_link"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           int64      `json:"id"`
+	Name         string     `json:"name"`
+	Description  string     `json:"description"`
+	Status       string     `json:"status"`
+	ExternalLink string     `json:"external_link"`
+	StartAt      *time.Time `json:"start_at"`
+	DueAt        *time.Time `json:"due_at"`
+	Tags         []string   `json:"tags"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
 }
 
 type Task struct {
-	ID           int64     `json:"id"`
-	ProjectID    int64     `json:"project_id"`
-	Title        string    `json:"title"`
-	Description  string    `json:"description"`
-	Status       string    `json:"status"`
-	Priority     string    `json:"priority"`
-	TaskType     string    `json:"task_type"`
-	ExternalLink string    `json:"external_link"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           int64      `json:"id"`
+	ProjectID    int64      `json:"project_id"`
+	ParentTaskID *int64     `json:"parent_task_id"`
+	Title        string     `json:"title"`
+	Description  string     `json:"description"`
+	Status       string     `json:"status"`
+	Priority     string     `json:"priority"`
+	TaskType     string     `json:"task_type"`
+	ExternalLink string     `json:"external_link"`
+	AssigneeID   *int64     `json:"assignee_id"`
+	Assignee     string     `json:"assignee"`
+	ReviewerID   *int64     `json:"reviewer_id"`
+	Reviewer     string     `json:"reviewer"`
+	StartAt      *time.Time `json:"start_at"`
+	DueAt        *time.Time `json:"due_at"`
+	RecurrenceID *int64     `json:"recurrence_id"`
+	Tags         []string   `json:"tags"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+
+	// DependsOn lists the tasks that must be completed before this one, and
+	// BlockedBy the ones among them that are not completed yet. A task is
+	// Ready when it is not completed and nothing blocks it.
+	DependsOn []int64 `json:"depends_on"`
+	BlockedBy []int64 `json:"blocked_by"`
+	Ready     bool    `json:"ready"`
 }
 
 type Problem struct {
@@ -45,32 +82,41 @@ type Problem struct {
 	Title       string    `json:"title"`
 	Description string    `json:"description"`
 	Status      string    `json:"status"`
+	AssigneeID  *int64    `json:"assignee_id"`
 	Assignee    string    `json:"assignee"`
+	Tags        []string  `json:"tags"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
 type Outcome struct {
-	ID          int64     `json:"id"`
-	ProjectID   int64     `json:"project_id"`
-	TaskID      *int64    `json:"task_id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Status      string    `json:"status"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          int64      `json:"id"`
+	ProjectID   int64      `json:"project_id"`
+	TaskID      *int64     `json:"task_id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Status      string     `json:"status"`
+	StartAt     *time.Time `json:"start_at"`
+	DueAt       *time.Time `json:"due_at"`
+	Tags        []string   `json:"tags"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
 }
 
 type Goal struct {
-	ID          int64     `json:"id"`
-	ProjectID   *int64    `json:"project_id"`
-	TaskID      *int64    `json:"task_id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	GoalType    string    `json:"goal_type"`
-	Assignee    string    `json:"assignee"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          int64      `json:"id"`
+	ProjectID   *int64     `json:"project_id"`
+	TaskID      *int64     `json:"task_id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	GoalType    string     `json:"goal_type"`
+	AssigneeID  *int64     `json:"assignee_id"`
+	Assignee    string     `json:"assignee"`
+	StartAt     *time.Time `json:"start_at"`
+	DueAt       *time.Time `json:"due_at"`
+	Tags        []string   `json:"tags"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
 }
 
 type TaskNote struct {
@@ -81,8 +127,23 @@ type TaskNote struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
-// NewDatabase creates a new database connection
+// NewDatabase opens the database and applies any pending migrations
 func NewDatabase(dbPath string) (*Database, error) {
+	database, err := OpenDatabase(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := database.Migrate(); err != nil {
+		database.Close()
+		return nil, fmt.Errorf("failed to migrate schema: %w", err)
+	}
+
+	return database, nil
+}
+
+// OpenDatabase opens a database connection without touching the schema
+func OpenDatabase(dbPath string) (*Database, error) {
 	// Create directory if it doesn't exist
 	dir := filepath.Dir(dbPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -108,229 +169,108 @@ func NewDatabase(dbPath string) (*Database, error) {
 		return nil, fmt.Errorf("failed to enable foreign keys: %w", err)
 	}
 
-	database := &Database{db: db}
-	if err := database.initSchema(); err != nil {
+	// Write-ahead logging lets readers carry on while a write is in progress
+	// and keeps the database file intact if the process is killed mid-write
+	if _, err := db.Exec("PRAGMA journal_mode = WAL"); err != nil {
 		db.Close()
-		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+		return nil, fmt.Errorf("failed to enable write-ahead logging: %w", err)
 	}
 
-	return database, nil
+	// Wait for a running server's writes rather than failing, so commands
+	// such as "loom backup" can share the database with it
+	if _, err := db.Exec("PRAGMA busy_timeout = 5000"); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to set busy timeout: %w", err)
+	}
+
+	return &Database{
+		db:             db,
+		events:         NewEventBus(),
+		workflows:      DefaultWorkflows(),
+		defaults:       DefaultDefaults(),
+		trashRetention: DefaultTrashRetention,
+		location:       time.Local,
+		backupDir:      filepath.Join(dir, "backups"),
+		backupInterval: DefaultBackupInterval,
+		backupKeep:     DefaultBackupKeep,
+	}, nil
 }
 
-// initSchema initializes the database schema
-func (d *Database) initSchema() error {
-	tables := `
-	CREATE TABLE IF NOT EXISTS projects (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL,
-		description TEXT,
-		external_link TEXT,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);
-
-	CREATE TABLE IF NOT EXISTS tasks (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		project_id INTEGER NOT NULL,
-		title TEXT NOT NULL,
-		description TEXT,
-		status TEXT DEFAULT 'pending',
-		priority TEXT DEFAULT 'medium',
-		task_type TEXT DEFAULT 'general',
-		external_link TEXT,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
-	);
-
-	CREATE TABLE IF NOT EXISTS problems (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		project_id INTEGER,
-		task_id INTEGER,
-		title TEXT NOT NULL,
-		description TEXT,
-		status TEXT DEFAULT 'open',
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE SET NULL,
-		FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE SET NULL
-	);
-
-	CREATE TABLE IF NOT EXISTS outcomes (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		project_id INTEGER NOT NULL,
-		task_id INTEGER,
-		title TEXT NOT NULL,
-		description TEXT,
-		status TEXT DEFAULT 'open',
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
-		FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE SET NULL
-	);
-
-	CREATE TABLE IF NOT EXISTS goals (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		project_id INTEGER,
-		task_id INTEGER,
-		title TEXT NOT NULL,
-		description TEXT,
-		goal_type TEXT DEFAULT 'short_term',
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE SET NULL,
-		FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE SET NULL
-	);
-
-	CREATE TABLE IF NOT EXISTS task_notes (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		task_id INTEGER NOT NULL,
-		note TEXT NOT NULL,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE CASCADE
-	);
-	`
-
-	if _, err := d.db.Exec(tables); err != nil {
-		return err
-	}
-
-	if _, err := d.db.Exec("ALTER TABLE tasks ADD COLUMN task_type TEXT DEFAULT 'general'"); err != nil {
-		if !strings.Contains(err.Error(), "duplicate column name") {
-			return err
-		}
-	}
-	if _, err := d.db.Exec("UPDATE tasks SET task_type = 'general' WHERE task_type IS NULL OR task_type = ''"); err != nil {
-		return err
-	}
-
-	// Add status column to projects table
-	if _, err := d.db.Exec("ALTER TABLE projects ADD COLUMN status TEXT DEFAULT 'active'"); err != nil {
-		if !strings.Contains(err.Error(), "duplicate column name") {
-			return err
-		}
-	}
-	if _, err := d.db.Exec("UPDATE projects SET status = 'active' WHERE status IS NULL OR status = ''"); err != nil {
-		return err
+// Close checkpoints the write-ahead log into the database file, so the file
+// is complete on its own, and closes the database connection
+func (d *Database) Close() error {
+	if _, err := d.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		d.db.Close()
+		return fmt.Errorf("failed to checkpoint database: %w", err)
 	}
+	return d.db.Close()
+}
 
-	if err := d.ensureProblemProjectOptional(); err != nil {
-		return err
-	}
+// Subscribe registers fn to receive a ChangeEvent for every mutation made
+// through this Database, and returns a function that unsubscribes it.
+func (d *Database) Subscribe(fn func(ChangeEvent)) func() {
+	return d.events.Subscribe(fn)
+}
 
-	// Add assignee column to problems table
-	if _, err := d.db.Exec("ALTER TABLE problems ADD COLUMN assignee TEXT DEFAULT ''"); err != nil {
-		if !strings.Contains(err.Error(), "duplicate column name") {
+// SetWorkflows replaces the status workflows of the entities in workflows,
+// leaving the others at their defaults.
+func (d *Database) SetWorkflows(workflows map[string]Workflow) error {
+	for entity, workflow := range workflows {
+		if err := workflow.validate(entity); err != nil {
 			return err
 		}
 	}
-
-	// Add assignee column to goals table
-	if _, err := d.db.Exec("ALTER TABLE goals ADD COLUMN assignee TEXT DEFAULT ''"); err != nil {
-		if !strings.Contains(err.Error(), "duplicate column name") {
-			return err
-		}
+	for entity, workflow := range workflows {
+		d.workflows[entity] = workflow
 	}
+	return nil
+}
 
-	// Create junction tables for multiple project linkages
-	junctionTables := `
-	CREATE TABLE IF NOT EXISTS goal_projects (
-		goal_id INTEGER NOT NULL,
-		project_id INTEGER NOT NULL,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		PRIMARY KEY (goal_id, project_id),
-		FOREIGN KEY (goal_id) REFERENCES goals(id) ON DELETE CASCADE,
-		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
-	);
-
-	CREATE TABLE IF NOT EXISTS problem_projects (
-		problem_id INTEGER NOT NULL,
-		project_id INTEGER NOT NULL,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		PRIMARY KEY (problem_id, project_id),
-		FOREIGN KEY (problem_id) REFERENCES problems(id) ON DELETE CASCADE,
-		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
-	);
-	`
-	if _, err := d.db.Exec(junctionTables); err != nil {
+// SetDefaults changes the values new items get for the enumerated fields
+// they are created without
+func (d *Database) SetDefaults(defaults Defaults) error {
+	if err := defaults.validate(); err != nil {
 		return err
 	}
-
-	indexes := `
-	CREATE INDEX IF NOT EXISTS idx_projects_status ON projects(status);
-	CREATE INDEX IF NOT EXISTS idx_tasks_project_id ON tasks(project_id);
-	CREATE INDEX IF NOT EXISTS idx_tasks_status ON tasks(status);
-	CREATE INDEX IF NOT EXISTS idx_tasks_task_type ON tasks(task_type);
-	CREATE INDEX IF NOT EXISTS idx_problems_project_id ON problems(project_id);
-	CREATE INDEX IF NOT EXISTS idx_problems_task_id ON problems(task_id);
-	CREATE INDEX IF NOT EXISTS idx_problems_status ON problems(status);
-	CREATE INDEX IF NOT EXISTS idx_problems_assignee ON problems(assignee);
-	CREATE INDEX IF NOT EXISTS idx_outcomes_project_id ON outcomes(project_id);
-	CREATE INDEX IF NOT EXISTS idx_outcomes_task_id ON outcomes(task_id);
-	CREATE INDEX IF NOT EXISTS idx_outcomes_status ON outcomes(status);
-	CREATE INDEX IF NOT EXISTS idx_goals_project_id ON goals(project_id);
-	CREATE INDEX IF NOT EXISTS idx_goals_task_id ON goals(task_id);
-	CREATE INDEX IF NOT EXISTS idx_goals_goal_type ON goals(goal_type);
-	CREATE INDEX IF NOT EXISTS idx_goals_assignee ON goals(assignee);
-	CREATE INDEX IF NOT EXISTS idx_task_notes_task_id ON task_notes(task_id);
-	CREATE INDEX IF NOT EXISTS idx_goal_projects_goal_id ON goal_projects(goal_id);
-	CREATE INDEX IF NOT EXISTS idx_goal_projects_project_id ON goal_projects(project_id);
-	CREATE INDEX IF NOT EXISTS idx_problem_projects_problem_id ON problem_projects(problem_id);
-	CREATE INDEX IF NOT EXISTS idx_problem_projects_project_id ON problem_projects(project_id);
-	`
-
-	_, err := d.db.Exec(indexes)
-	return err
+	d.defaults = defaults
+	return nil
 }
 
-func (d *Database) ensureProblemProjectOptional() error {
-	var columnNotNull sql.NullString
-	err := d.db.QueryRow("SELECT sql FROM sqlite_master WHERE type='table' AND name='problems'").Scan(&columnNotNull)
-	if err != nil {
-		return err
-	}
-	if !strings.Contains(columnNotNull.String, "project_id INTEGER NOT NULL") {
-		return nil
-	}
-
-	migration := `
-	ALTER TABLE problems RENAME TO problems_old;
-	CREATE TABLE problems (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		project_id INTEGER,
-		task_id INTEGER,
-		title TEXT NOT NULL,
-		description TEXT,
-		status TEXT DEFAULT 'open',
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE SET NULL,
-		FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE SET NULL
-	);
-	INSERT INTO problems (id, project_id, task_id, title, description, status, created_at, updated_at)
-	SELECT id, project_id, task_id, title, description, status, created_at, updated_at
-	FROM problems_old;
-	DROP TABLE problems_old;
-	`
-	_, err = d.db.Exec(migration)
-	return err
+// checkTransition enforces the entity's workflow on a status change
+func (d *Database) checkTransition(entity, from, to string) error {
+	return d.workflows[entity].checkTransition(entity, from, to)
 }
 
-// Close closes the database connection
-func (d *Database) Close() error {
-	return d.db.Close()
+// publish records a change in the activity log and emits a change event to
+// all subscribers. before is the entity as it was before the change, or nil
+// for creates; data is the event payload, which except for deletes is also
+// the entity after the change.
+func (d *Database) publish(action, entity string, id int64, before, data interface{}) {
+	after := data
+	if action == ActionDeleted {
+		after = nil
+	}
+	if err := d.recordActivity(action, entity, id, before, after); err != nil {
+		log.Printf("Failed to record activity for %s %d: %v", entity, id, err)
+	}
+	d.events.Publish(ChangeEvent{Action: action, Entity: entity, ID: id, Data: data, Actor: d.actor})
 }
 
 // Project operations
 
-func (d *Database) CreateProject(name, description, status, externalLink string) (*Project, error) {
+func (d *Database) CreateProject(name, description, status, externalLink string, startAt, dueAt *time.Time) (*Project, error) {
 	if status == "" {
-		status = "active"
+		status = d.defaults.ProjectStatus
+	}
+	if err := validateEnum("project status", status, ProjectStatuses); err != nil {
+		return nil, err
+	}
+	if err := checkDateRange(startAt, dueAt); err != nil {
+		return nil, err
 	}
 	result, err := d.db.Exec(
-		"INSERT INTO projects (name, description, status, external_link) VALUES (?, ?, ?, ?)",
-		name, description, status, externalLink,
+		"INSERT INTO projects (name, description, status, external_link, start_at, due_at) VALUES (?, ?, ?, ?, ?, ?)",
+		name, description, status, externalLink, dbTime(startAt), dbTime(dueAt),
 	)
 	if err != nil {
 		return nil, err
@@ -341,15 +281,20 @@ func (d *Database) CreateProject(name, description, status, externalLink string)
 		return nil, err
 	}
 
-	return d.GetProject(id)
+	project, err := d.GetProject(id)
+	if err != nil {
+		return nil, err
+	}
+	d.publish(ActionCreated, EntityProject, project.ID, nil, project)
+	return project, nil
 }
 
 func (d *Database) GetProject(id int64) (*Project, error) {
 	var p Project
 	err := d.db.QueryRow(
-		"SELECT id, name, description, COALESCE(external_link, ''), created_at, updated_at, COALESCE(status, 'active') FROM projects WHERE id = ?",
+		"SELECT id, name, description, COALESCE(external_link, ''), start_at, due_at, created_at, updated_at, COALESCE(status, 'active'), "+tagColumn(EntityProject, "projects.id")+" FROM projects WHERE id = ? AND deleted_at IS NULL",
 		id,
-	).Scan(&p.ID, &p.Name, &p.Description, &p.ExternalLink, &p.CreatedAt, &p.UpdatedAt, &p.Status)
+	).Scan(&p.ID, &p.Name, &p.Description, &p.ExternalLink, &p.StartAt, &p.DueAt, &p.CreatedAt, &p.UpdatedAt, &p.Status, (*tagList)(&p.Tags))
 	if err != nil {
 		return nil, err
 	}
@@ -357,34 +302,62 @@ func (d *Database) GetProject(id int64) (*Project, error) {
 }
 
 func (d *Database) ListProjects(status *string) ([]*Project, error) {
-	query := "SELECT id, name, description, COALESCE(external_link, ''), created_at, updated_at, COALESCE(status, 'active') FROM projects WHERE 1=1"
-	args := []interface{}{}
+	projects, _, err := d.ListProjectsPage(status, DueFilter{}, TagFilter{}, ListOptions{})
+	return projects, err
+}
 
-	if status != nil {
-		query += " AND COALESCE(status, 'active') = ?"
-		args = append(args, *status)
+// ListProjectsPage lists projects matching the filters, one page at a time
+func (d *Database) ListProjectsPage(status *string, due DueFilter, tags TagFilter, opts ListOptions) ([]*Project, *PageInfo, error) {
+	q := listQuery{
+		table:   "projects",
+		columns: "id, name, description, COALESCE(external_link, ''), start_at, due_at, created_at, updated_at, COALESCE(status, 'active'), " + tagColumn(EntityProject, "projects.id"),
+		where:   []string{"deleted_at IS NULL"},
+		sorts:   projectSorts,
 	}
-
-	query += " ORDER BY updated_at DESC"
-
-	rows, err := d.db.Query(query, args...)
-	if err != nil {
-		return nil, err
+	if status != nil {
+		q.filter("COALESCE(status, 'active') = ?", *status)
 	}
-	defer rows.Close()
+	due.apply(&q, EntityProject)
+	tags.apply(&q, EntityProject)
 
 	var projects []*Project
-	for rows.Next() {
+	page, err := d.listPage(q, opts, func(rows *sql.Rows, sortValue *interface{}) (int64, error) {
 		var p Project
-		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.ExternalLink, &p.CreatedAt, &p.UpdatedAt, &p.Status); err != nil {
-			return nil, err
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.ExternalLink, &p.StartAt, &p.DueAt, &p.CreatedAt, &p.UpdatedAt, &p.Status, (*tagList)(&p.Tags), sortValue); err != nil {
+			return 0, err
 		}
 		projects = append(projects, &p)
+		return p.ID, nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
-	return projects, rows.Err()
+	return projects, page, nil
 }
 
-func (d *Database) UpdateProject(id int64, name, description, status, externalLink *string) (*Project, error) {
+// UpdateProject updates the fields that are set. A zero startAt or dueAt
+// clears the date.
+func (d *Database) UpdateProject(id int64, name, description, status, externalLink *string, startAt, dueAt *time.Time) (*Project, error) {
+	if status != nil {
+		if err := validateEnum("project status", *status, ProjectStatuses); err != nil {
+			return nil, err
+		}
+	}
+	if status != nil || startAt != nil || dueAt != nil {
+		current, err := d.GetProject(id)
+		if err != nil {
+			return nil, err
+		}
+		if status != nil {
+			if err := d.checkTransition(EntityProject, current.Status, *status); err != nil {
+				return nil, err
+			}
+		}
+		if err := checkDateRange(firstTime(startAt, current.StartAt), firstTime(dueAt, current.DueAt)); err != nil {
+			return nil, err
+		}
+	}
+
 	updates := []string{}
 	args := []interface{}{}
 
@@ -404,6 +377,14 @@ func (d *Database) UpdateProject(id int64, name, description, status, externalLi
 		updates = append(updates, "external_link = ?")
 		args = append(args, *externalLink)
 	}
+	if startAt != nil {
+		updates = append(updates, "start_at = ?")
+		args = append(args, dbTime(startAt))
+	}
+	if dueAt != nil {
+		updates = append(updates, "due_at = ?")
+		args = append(args, dbTime(dueAt))
+	}
 
 	if len(updates) == 0 {
 		return d.GetProject(id)
@@ -418,37 +399,91 @@ func (d *Database) UpdateProject(id int64, name, description, status, externalLi
 	}
 	query += " WHERE id = ?"
 
-	_, err := d.db.Exec(query, args...)
+	before, err := d.GetProject(id)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = d.db.Exec(query, args...)
 	if err != nil {
 		return nil, err
 	}
-	return d.GetProject(id)
+
+	project, err := d.GetProject(id)
+	if err != nil {
+		return nil, err
+	}
+	d.publish(ActionUpdated, EntityProject, project.ID, before, project)
+	return project, nil
 }
 
 func (d *Database) DeleteProject(id int64) error {
-	result, err := d.db.Exec("DELETE FROM projects WHERE id = ?", id)
-	if err != nil {
-		return err
+	before, err := d.GetProject(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("project with ID %d %w", id, ErrNotFound)
 	}
-	rows, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
-	if rows == 0 {
-		return fmt.Errorf("project with ID %d not found", id)
+
+	if err := d.moveToTrash(EntityProject, id, before.Name); err != nil {
+		return err
 	}
+	d.publish(ActionDeleted, EntityProject, id, before, nil)
 	return nil
 }
 
 // Task operations
 
-func (d *Database) CreateTask(projectID int64, title, description, status, priority, taskType, externalLink string) (*Task, error) {
+// CreateTask creates a task in a project, nested under parentTaskID if it is
+// set. The parent must be in the same project. assignee and reviewer name
+// people by handle, email or name; see resolvePerson.
+func (d *Database) CreateTask(projectID int64, parentTaskID *int64, title, description, status, priority, taskType, externalLink, assignee, reviewer string, startAt, dueAt *time.Time) (*Task, error) {
+	assigneeID, err := d.resolvePerson(assignee)
+	if err != nil {
+		return nil, err
+	}
+	reviewerID, err := d.resolvePerson(reviewer)
+	if err != nil {
+		return nil, err
+	}
+	return d.createTask(projectID, parentTaskID, nil, title, description, status, priority, taskType, externalLink, assigneeID, reviewerID, startAt, dueAt)
+}
+
+// createTask creates a task, optionally as an instance of a recurrence
+func (d *Database) createTask(projectID int64, parentTaskID, recurrenceID *int64, title, description, status, priority, taskType, externalLink string, assigneeID, reviewerID *int64, startAt, dueAt *time.Time) (*Task, error) {
+	if status == "" {
+		status = d.defaults.TaskStatus
+	}
+	if priority == "" {
+		priority = d.defaults.TaskPriority
+	}
 	if taskType == "" {
-		taskType = "general"
+		taskType = d.defaults.TaskType
+	}
+	if err := validateEnum("task status", status, TaskStatuses); err != nil {
+		return nil, err
+	}
+	if err := validateEnum("task priority", priority, TaskPriorities); err != nil {
+		return nil, err
+	}
+	if err := validateEnum("task type", taskType, TaskTypes); err != nil {
+		return nil, err
+	}
+	if err := checkDateRange(startAt, dueAt); err != nil {
+		return nil, err
+	}
+	if err := d.checkTaskProject(EntityTask, &projectID, nil); err != nil {
+		return nil, err
+	}
+	if parentTaskID != nil {
+		if err := d.checkTaskParent(0, projectID, *parentTaskID); err != nil {
+			return nil, err
+		}
 	}
 	result, err := d.db.Exec(
-		"INSERT INTO tasks (project_id, title, description, status, priority, task_type, external_link) VALUES (?, ?, ?, ?, ?, ?, ?)",
-		projectID, title, description, status, priority, taskType, externalLink,
+		"INSERT INTO tasks (project_id, parent_task_id, recurrence_id, title, description, status, priority, task_type, external_link, assignee_id, reviewer_id, start_at, due_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		projectID, parentTaskID, recurrenceID, title, description, status, priority, taskType, externalLink, assigneeID, reviewerID, dbTime(startAt), dbTime(dueAt),
 	)
 	if err != nil {
 		return nil, err
@@ -459,63 +494,114 @@ func (d *Database) CreateTask(projectID int64, title, description, status, prior
 		return nil, err
 	}
 
-	return d.GetTask(id)
-}
-
-func (d *Database) GetTask(id int64) (*Task, error) {
-	var t Task
-	err := d.db.QueryRow(
-		"SELECT id, project_id, title, description, status, priority, task_type, external_link, created_at, updated_at FROM tasks WHERE id = ?",
-		id,
-	).Scan(&t.ID, &t.ProjectID, &t.Title, &t.Description, &t.Status, &t.Priority, &t.TaskType, &t.ExternalLink, &t.CreatedAt, &t.UpdatedAt)
+	task, err := d.GetTask(id)
 	if err != nil {
 		return nil, err
 	}
-	return &t, nil
+	d.publish(ActionCreated, EntityTask, task.ID, nil, task)
+	return task, nil
+}
+
+func (d *Database) GetTask(id int64) (*Task, error) {
+	return scanTask(d.db.QueryRow("SELECT "+taskColumns+" FROM tasks WHERE id = ? AND deleted_at IS NULL", id).Scan)
 }
 
 func (d *Database) ListTasks(projectID *int64, status *string, taskType *string) ([]*Task, error) {
-	query := "SELECT id, project_id, title, description, status, priority, task_type, external_link, created_at, updated_at FROM tasks WHERE 1=1"
-	args := []interface{}{}
+	tasks, _, err := d.ListTasksPage(projectID, status, taskType, nil, nil, DueFilter{}, TagFilter{}, ListOptions{})
+	return tasks, err
+}
 
+// ListTasksPage lists tasks matching the filters, one page at a time.
+// assignee names a person as resolvePerson does, or is empty for unassigned
+// tasks. ready filters on whether every task a task depends on is completed.
+func (d *Database) ListTasksPage(projectID *int64, status *string, taskType *string, assignee *string, ready *bool, due DueFilter, tags TagFilter, opts ListOptions) ([]*Task, *PageInfo, error) {
+	q := listQuery{
+		table:   "tasks",
+		columns: taskColumns,
+		where:   []string{"deleted_at IS NULL"},
+		sorts:   taskSorts,
+	}
 	if projectID != nil {
-		query += " AND project_id = ?"
-		args = append(args, *projectID)
+		q.filter("project_id = ?", *projectID)
 	}
-
 	if status != nil {
-		query += " AND status = ?"
-		args = append(args, *status)
+		q.filter("status = ?", *status)
 	}
-
 	if taskType != nil {
-		query += " AND task_type = ?"
-		args = append(args, *taskType)
+		q.filter("task_type = ?", *taskType)
 	}
+	if assignee != nil {
+		q.filterPerson("assignee_id", *assignee)
+	}
+	if ready != nil {
+		q.filter(taskReady+" = ?", *ready)
+	}
+	due.apply(&q, EntityTask)
+	tags.apply(&q, EntityTask)
 
-	query += " ORDER BY updated_at DESC"
-
-	rows, err := d.db.Query(query, args...)
+	var tasks []*Task
+	page, err := d.listPage(q, opts, func(rows *sql.Rows, sortValue *interface{}) (int64, error) {
+		t, err := scanTask(rows.Scan, sortValue)
+		if err != nil {
+			return 0, err
+		}
+		tasks = append(tasks, t)
+		return t.ID, nil
+	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	defer rows.Close()
+	return tasks, page, nil
+}
 
-	var tasks []*Task
-	for rows.Next() {
-		var t Task
-		if err := rows.Scan(&t.ID, &t.ProjectID, &t.Title, &t.Description, &t.Status, &t.Priority, &t.TaskType, &t.ExternalLink, &t.CreatedAt, &t.UpdatedAt); err != nil {
+// UpdateTask updates the fields that are set. parentTaskID moves the task,
+// along with its subtasks, under another task in the same project; zero
+// makes it a top-level task. An empty assignee or reviewer clears it, and a
+// zero startAt or dueAt clears the date.
+func (d *Database) UpdateTask(id int64, title, description, status, priority, taskType, externalLink, assignee, reviewer *string, parentTaskID *int64, startAt, dueAt *time.Time) (*Task, error) {
+	if err := validateOptionalEnum("task priority", priority, TaskPriorities); err != nil {
+		return nil, err
+	}
+	if err := validateOptionalEnum("task type", taskType, TaskTypes); err != nil {
+		return nil, err
+	}
+	if status != nil {
+		if err := validateEnum("task status", *status, TaskStatuses); err != nil {
+			return nil, err
+		}
+	}
+	if status != nil || parentTaskID != nil || startAt != nil || dueAt != nil {
+		current, err := d.GetTask(id)
+		if err != nil {
+			return nil, err
+		}
+		if status != nil {
+			if err := d.checkTransition(EntityTask, current.Status, *status); err != nil {
+				return nil, err
+			}
+		}
+		if parentTaskID != nil && *parentTaskID != 0 {
+			if err := d.checkTaskParent(id, current.ProjectID, *parentTaskID); err != nil {
+				return nil, err
+			}
+		}
+		if err := checkDateRange(firstTime(startAt, current.StartAt), firstTime(dueAt, current.DueAt)); err != nil {
 			return nil, err
 		}
-		tasks = append(tasks, &t)
 	}
-	return tasks, rows.Err()
-}
 
-func (d *Database) UpdateTask(id int64, title, description, status, priority, taskType, externalLink *string) (*Task, error) {
 	updates := []string{}
 	args := []interface{}{}
 
+	if parentTaskID != nil {
+		updates = append(updates, "parent_task_id = ?")
+		if *parentTaskID == 0 {
+			args = append(args, nil)
+		} else {
+			args = append(args, *parentTaskID)
+		}
+	}
+
 	if title != nil {
 		updates = append(updates, "title = ?")
 		args = append(args, *title)
@@ -540,6 +626,30 @@ func (d *Database) UpdateTask(id int64, title, description, status, priority, ta
 		updates = append(updates, "external_link = ?")
 		args = append(args, *externalLink)
 	}
+	if assignee != nil {
+		assigneeID, err := d.resolvePerson(*assignee)
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, "assignee_id = ?")
+		args = append(args, assigneeID)
+	}
+	if reviewer != nil {
+		reviewerID, err := d.resolvePerson(*reviewer)
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, "reviewer_id = ?")
+		args = append(args, reviewerID)
+	}
+	if startAt != nil {
+		updates = append(updates, "start_at = ?")
+		args = append(args, dbTime(startAt))
+	}
+	if dueAt != nil {
+		updates = append(updates, "due_at = ?")
+		args = append(args, dbTime(dueAt))
+	}
 
 	if len(updates) == 0 {
 		return d.GetTask(id)
@@ -554,19 +664,71 @@ func (d *Database) UpdateTask(id int64, title, description, status, priority, ta
 	}
 	query += " WHERE id = ?"
 
-	_, err := d.db.Exec(query, args...)
+	before, err := d.GetTask(id)
+	if err != nil {
+		return nil, err
+	}
+	dependents, err := d.GetTaskDependents(id)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = d.db.Exec(query, args...)
 	if err != nil {
 		return nil, err
 	}
-	return d.GetTask(id)
+
+	task, err := d.GetTask(id)
+	if err != nil {
+		return nil, err
+	}
+	d.publish(ActionUpdated, EntityTask, task.ID, before, task)
+	d.publishDependentChanges(dependents)
+
+	// Completing an instance of a recurring task creates the next one. The
+	// update itself has been made, so a failure here is only logged.
+	if task.RecurrenceID != nil && before.Status != "completed" && task.Status == "completed" {
+		if _, err := d.repeatTask(task); err != nil {
+			log.Printf("Failed to create the next instance of task %d: %v", task.ID, err)
+		}
+	}
+	return task, nil
 }
 
 // Problem operations
 
+// problemColumns are the columns of problems read by scanProblem
+var problemColumns = "id, project_id, task_id, title, description, status, assignee_id, " + personName("problems.assignee_id") + ", created_at, updated_at, " + tagColumn(EntityProblem, "problems.id")
+
+// scanProblem scans a row of problemColumns followed by extra
+func scanProblem(scan func(dest ...interface{}) error, extra ...interface{}) (*Problem, error) {
+	var p Problem
+	dest := append([]interface{}{
+		&p.ID, &p.ProjectID, &p.TaskID, &p.Title, &p.Description, &p.Status, &p.AssigneeID, &p.Assignee, &p.CreatedAt, &p.UpdatedAt, (*tagList)(&p.Tags),
+	}, extra...)
+	if err := scan(dest...); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
 func (d *Database) CreateProblem(projectID *int64, taskID *int64, title, description, status, assignee string) (*Problem, error) {
+	if status == "" {
+		status = d.defaults.ProblemStatus
+	}
+	if err := validateEnum("problem status", status, ProblemStatuses); err != nil {
+		return nil, err
+	}
+	if err := d.checkTaskProject(EntityProblem, projectID, taskID); err != nil {
+		return nil, err
+	}
+	assigneeID, err := d.resolvePerson(assignee)
+	if err != nil {
+		return nil, err
+	}
 	result, err := d.db.Exec(
-		"INSERT INTO problems (project_id, task_id, title, description, status, assignee) VALUES (?, ?, ?, ?, ?, ?)",
-		projectID, taskID, title, description, status, assignee,
+		"INSERT INTO problems (project_id, task_id, title, description, status, assignee_id) VALUES (?, ?, ?, ?, ?, ?)",
+		projectID, taskID, title, description, status, assigneeID,
 	)
 	if err != nil {
 		return nil, err
@@ -577,92 +739,95 @@ func (d *Database) CreateProblem(projectID *int64, taskID *int64, title, descrip
 		return nil, err
 	}
 
-	return d.GetProblem(id)
-}
-
-func (d *Database) GetProblem(id int64) (*Problem, error) {
-	var p Problem
-	var projectID sql.NullInt64
-	var taskID sql.NullInt64
-	var assignee sql.NullString
-	err := d.db.QueryRow(
-		"SELECT id, project_id, task_id, title, description, status, COALESCE(assignee, ''), created_at, updated_at FROM problems WHERE id = ?",
-		id,
-	).Scan(&p.ID, &projectID, &taskID, &p.Title, &p.Description, &p.Status, &assignee, &p.CreatedAt, &p.UpdatedAt)
+	problem, err := d.GetProblem(id)
 	if err != nil {
 		return nil, err
 	}
-	if projectID.Valid {
-		p.ProjectID = &projectID.Int64
-	}
-	if taskID.Valid {
-		p.TaskID = &taskID.Int64
-	}
-	if assignee.Valid {
-		p.Assignee = assignee.String
-	}
-	return &p, nil
+	d.publish(ActionCreated, EntityProblem, problem.ID, nil, problem)
+	return problem, nil
+}
+
+func (d *Database) GetProblem(id int64) (*Problem, error) {
+	return scanProblem(d.db.QueryRow("SELECT "+problemColumns+" FROM problems WHERE id = ? AND deleted_at IS NULL", id).Scan)
 }
 
 func (d *Database) ListProblems(projectID *int64, taskID *int64, status *string, assignee *string) ([]*Problem, error) {
-	query := "SELECT id, project_id, task_id, title, description, status, COALESCE(assignee, ''), created_at, updated_at FROM problems WHERE 1=1"
-	args := []interface{}{}
+	problems, _, err := d.ListProblemsPage(projectID, taskID, status, assignee, TagFilter{}, ListOptions{})
+	return problems, err
+}
 
+// ListProblemsPage lists problems matching the filters, one page at a time
+func (d *Database) ListProblemsPage(projectID *int64, taskID *int64, status *string, assignee *string, tags TagFilter, opts ListOptions) ([]*Problem, *PageInfo, error) {
+	q := listQuery{
+		table:   "problems",
+		columns: problemColumns,
+		where:   []string{"deleted_at IS NULL"},
+		sorts:   itemSorts,
+	}
 	if projectID != nil {
-		query += " AND project_id = ?"
-		args = append(args, *projectID)
+		q.filter("project_id = ?", *projectID)
 	}
-
 	if taskID != nil {
-		query += " AND task_id = ?"
-		args = append(args, *taskID)
+		q.filter("task_id = ?", *taskID)
 	}
-
 	if status != nil {
-		query += " AND status = ?"
-		args = append(args, *status)
+		q.filter("status = ?", *status)
 	}
-
 	if assignee != nil {
-		query += " AND assignee = ?"
-		args = append(args, *assignee)
+		q.filterPerson("assignee_id", *assignee)
 	}
+	tags.apply(&q, EntityProblem)
 
-	query += " ORDER BY updated_at DESC"
-
-	rows, err := d.db.Query(query, args...)
+	var problems []*Problem
+	page, err := d.listPage(q, opts, func(rows *sql.Rows, sortValue *interface{}) (int64, error) {
+		p, err := scanProblem(rows.Scan, sortValue)
+		if err != nil {
+			return 0, err
+		}
+		problems = append(problems, p)
+		return p.ID, nil
+	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	defer rows.Close()
+	return problems, page, nil
+}
 
-	var problems []*Problem
-	for rows.Next() {
-		var p Problem
-		var projectID sql.NullInt64
-		var taskID sql.NullInt64
-		var assignee sql.NullString
-		if err := rows.Scan(&p.ID, &projectID, &taskID, &p.Title, &p.Description, &p.Status, &assignee, &p.CreatedAt, &p.UpdatedAt); err != nil {
+// UpdateProblem updates the given fields of a problem. A non-nil projectID
+// or taskID re-links the problem; the task must belong to its project.
+func (d *Database) UpdateProblem(id int64, title, description, status, assignee *string, projectID, taskID *int64) (*Problem, error) {
+	if err := validateOptionalEnum("problem status", status, ProblemStatuses); err != nil {
+		return nil, err
+	}
+	if status != nil || projectID != nil || taskID != nil {
+		current, err := d.GetProblem(id)
+		if err != nil {
 			return nil, err
 		}
-		if projectID.Valid {
-			p.ProjectID = &projectID.Int64
-		}
-		if taskID.Valid {
-			p.TaskID = &taskID.Int64
+		if status != nil {
+			if err := d.checkTransition(EntityProblem, current.Status, *status); err != nil {
+				return nil, err
+			}
 		}
-		if assignee.Valid {
-			p.Assignee = assignee.String
+		if projectID != nil || taskID != nil {
+			if err := d.checkTaskProject(EntityProblem, firstInt64(projectID, current.ProjectID), firstInt64(taskID, current.TaskID)); err != nil {
+				return nil, err
+			}
 		}
-		problems = append(problems, &p)
 	}
-	return problems, rows.Err()
-}
 
-func (d *Database) UpdateProblem(id int64, title, description, status, assignee *string) (*Problem, error) {
 	updates := []string{}
 	args := []interface{}{}
 
+	if projectID != nil {
+		updates = append(updates, "project_id = ?")
+		args = append(args, *projectID)
+	}
+	if taskID != nil {
+		updates = append(updates, "task_id = ?")
+		args = append(args, *taskID)
+	}
+
 	if title != nil {
 		updates = append(updates, "title = ?")
 		args = append(args, *title)
@@ -676,8 +841,12 @@ func (d *Database) UpdateProblem(id int64, title, description, status, assignee
 		args = append(args, *status)
 	}
 	if assignee != nil {
-		updates = append(updates, "assignee = ?")
-		args = append(args, *assignee)
+		assigneeID, err := d.resolvePerson(*assignee)
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, "assignee_id = ?")
+		args = append(args, assigneeID)
 	}
 
 	if len(updates) == 0 {
@@ -693,34 +862,58 @@ func (d *Database) UpdateProblem(id int64, title, description, status, assignee
 	}
 	query += " WHERE id = ?"
 
-	_, err := d.db.Exec(query, args...)
+	before, err := d.GetProblem(id)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = d.db.Exec(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	problem, err := d.GetProblem(id)
 	if err != nil {
 		return nil, err
 	}
-	return d.GetProblem(id)
+	d.publish(ActionUpdated, EntityProblem, problem.ID, before, problem)
+	return problem, nil
 }
 
 func (d *Database) DeleteProblem(id int64) error {
-	result, err := d.db.Exec("DELETE FROM problems WHERE id = ?", id)
-	if err != nil {
-		return err
+	before, err := d.GetProblem(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("problem with ID %d %w", id, ErrNotFound)
 	}
-	rows, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
-	if rows == 0 {
-		return fmt.Errorf("problem with ID %d not found", id)
+
+	if err := d.moveToTrash(EntityProblem, id, before.Title); err != nil {
+		return err
 	}
+	d.publish(ActionDeleted, EntityProblem, id, before, nil)
 	return nil
 }
 
 // Outcome operations
 
-func (d *Database) CreateOutcome(projectID int64, taskID *int64, title, description, status string) (*Outcome, error) {
+func (d *Database) CreateOutcome(projectID int64, taskID *int64, title, description, status string, startAt, dueAt *time.Time) (*Outcome, error) {
+	if status == "" {
+		status = d.defaults.OutcomeStatus
+	}
+	if err := validateEnum("outcome status", status, OutcomeStatuses); err != nil {
+		return nil, err
+	}
+	if err := checkDateRange(startAt, dueAt); err != nil {
+		return nil, err
+	}
+	if err := d.checkTaskProject(EntityOutcome, &projectID, taskID); err != nil {
+		return nil, err
+	}
 	result, err := d.db.Exec(
-		"INSERT INTO outcomes (project_id, task_id, title, description, status) VALUES (?, ?, ?, ?, ?)",
-		projectID, taskID, title, description, status,
+		"INSERT INTO outcomes (project_id, task_id, title, description, status, start_at, due_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		projectID, taskID, title, description, status, dbTime(startAt), dbTime(dueAt),
 	)
 	if err != nil {
 		return nil, err
@@ -731,16 +924,21 @@ func (d *Database) CreateOutcome(projectID int64, taskID *int64, title, descript
 		return nil, err
 	}
 
-	return d.GetOutcome(id)
+	outcome, err := d.GetOutcome(id)
+	if err != nil {
+		return nil, err
+	}
+	d.publish(ActionCreated, EntityOutcome, outcome.ID, nil, outcome)
+	return outcome, nil
 }
 
 func (d *Database) GetOutcome(id int64) (*Outcome, error) {
 	var outcome Outcome
 	var taskID sql.NullInt64
 	err := d.db.QueryRow(
-		"SELECT id, project_id, task_id, title, description, status, created_at, updated_at FROM outcomes WHERE id = ?",
+		"SELECT id, project_id, task_id, title, description, status, start_at, due_at, created_at, updated_at, "+tagColumn(EntityOutcome, "outcomes.id")+" FROM outcomes WHERE id = ? AND deleted_at IS NULL",
 		id,
-	).Scan(&outcome.ID, &outcome.ProjectID, &taskID, &outcome.Title, &outcome.Description, &outcome.Status, &outcome.CreatedAt, &outcome.UpdatedAt)
+	).Scan(&outcome.ID, &outcome.ProjectID, &taskID, &outcome.Title, &outcome.Description, &outcome.Status, &outcome.StartAt, &outcome.DueAt, &outcome.CreatedAt, &outcome.UpdatedAt, (*tagList)(&outcome.Tags))
 	if err != nil {
 		return nil, err
 	}
@@ -751,51 +949,89 @@ func (d *Database) GetOutcome(id int64) (*Outcome, error) {
 }
 
 func (d *Database) ListOutcomes(projectID *int64, taskID *int64, status *string) ([]*Outcome, error) {
-	query := "SELECT id, project_id, task_id, title, description, status, created_at, updated_at FROM outcomes WHERE 1=1"
-	args := []interface{}{}
+	outcomes, _, err := d.ListOutcomesPage(projectID, taskID, status, DueFilter{}, TagFilter{}, ListOptions{})
+	return outcomes, err
+}
 
+// ListOutcomesPage lists outcomes matching the filters, one page at a time
+func (d *Database) ListOutcomesPage(projectID *int64, taskID *int64, status *string, due DueFilter, tags TagFilter, opts ListOptions) ([]*Outcome, *PageInfo, error) {
+	q := listQuery{
+		table:   "outcomes",
+		columns: "id, project_id, task_id, title, description, status, start_at, due_at, created_at, updated_at, " + tagColumn(EntityOutcome, "outcomes.id"),
+		where:   []string{"deleted_at IS NULL"},
+		sorts:   datedItemSorts,
+	}
 	if projectID != nil {
-		query += " AND project_id = ?"
-		args = append(args, *projectID)
+		q.filter("project_id = ?", *projectID)
 	}
-
 	if taskID != nil {
-		query += " AND task_id = ?"
-		args = append(args, *taskID)
+		q.filter("task_id = ?", *taskID)
 	}
-
 	if status != nil {
-		query += " AND status = ?"
-		args = append(args, *status)
+		q.filter("status = ?", *status)
 	}
-
-	query += " ORDER BY updated_at DESC"
-
-	rows, err := d.db.Query(query, args...)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+	due.apply(&q, EntityOutcome)
+	tags.apply(&q, EntityOutcome)
 
 	var outcomes []*Outcome
-	for rows.Next() {
+	page, err := d.listPage(q, opts, func(rows *sql.Rows, sortValue *interface{}) (int64, error) {
 		var outcome Outcome
 		var taskID sql.NullInt64
-		if err := rows.Scan(&outcome.ID, &outcome.ProjectID, &taskID, &outcome.Title, &outcome.Description, &outcome.Status, &outcome.CreatedAt, &outcome.UpdatedAt); err != nil {
-			return nil, err
+		if err := rows.Scan(&outcome.ID, &outcome.ProjectID, &taskID, &outcome.Title, &outcome.Description, &outcome.Status, &outcome.StartAt, &outcome.DueAt, &outcome.CreatedAt, &outcome.UpdatedAt, (*tagList)(&outcome.Tags), sortValue); err != nil {
+			return 0, err
 		}
 		if taskID.Valid {
 			outcome.TaskID = &taskID.Int64
 		}
 		outcomes = append(outcomes, &outcome)
+		return outcome.ID, nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
-	return outcomes, rows.Err()
+	return outcomes, page, nil
 }
 
-func (d *Database) UpdateOutcome(id int64, title, description, status *string) (*Outcome, error) {
+// UpdateOutcome updates the given fields of an outcome. A non-nil projectID
+// or taskID re-links the outcome; the task must belong to its project.
+// UpdateOutcome updates the fields that are set. A zero startAt or dueAt
+// clears the date.
+func (d *Database) UpdateOutcome(id int64, title, description, status *string, projectID, taskID *int64, startAt, dueAt *time.Time) (*Outcome, error) {
+	if err := validateOptionalEnum("outcome status", status, OutcomeStatuses); err != nil {
+		return nil, err
+	}
+	if status != nil || projectID != nil || taskID != nil || startAt != nil || dueAt != nil {
+		current, err := d.GetOutcome(id)
+		if err != nil {
+			return nil, err
+		}
+		if status != nil {
+			if err := d.checkTransition(EntityOutcome, current.Status, *status); err != nil {
+				return nil, err
+			}
+		}
+		if projectID != nil || taskID != nil {
+			if err := d.checkTaskProject(EntityOutcome, firstInt64(projectID, &current.ProjectID), firstInt64(taskID, current.TaskID)); err != nil {
+				return nil, err
+			}
+		}
+		if err := checkDateRange(firstTime(startAt, current.StartAt), firstTime(dueAt, current.DueAt)); err != nil {
+			return nil, err
+		}
+	}
+
 	updates := []string{}
 	args := []interface{}{}
 
+	if projectID != nil {
+		updates = append(updates, "project_id = ?")
+		args = append(args, *projectID)
+	}
+	if taskID != nil {
+		updates = append(updates, "task_id = ?")
+		args = append(args, *taskID)
+	}
+
 	if title != nil {
 		updates = append(updates, "title = ?")
 		args = append(args, *title)
@@ -808,6 +1044,14 @@ func (d *Database) UpdateOutcome(id int64, title, description, status *string) (
 		updates = append(updates, "status = ?")
 		args = append(args, *status)
 	}
+	if startAt != nil {
+		updates = append(updates, "start_at = ?")
+		args = append(args, dbTime(startAt))
+	}
+	if dueAt != nil {
+		updates = append(updates, "due_at = ?")
+		args = append(args, dbTime(dueAt))
+	}
 
 	if len(updates) == 0 {
 		return d.GetOutcome(id)
@@ -822,37 +1066,62 @@ func (d *Database) UpdateOutcome(id int64, title, description, status *string) (
 	}
 	query += " WHERE id = ?"
 
-	_, err := d.db.Exec(query, args...)
+	before, err := d.GetOutcome(id)
 	if err != nil {
 		return nil, err
 	}
-	return d.GetOutcome(id)
+
+	_, err = d.db.Exec(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	outcome, err := d.GetOutcome(id)
+	if err != nil {
+		return nil, err
+	}
+	d.publish(ActionUpdated, EntityOutcome, outcome.ID, before, outcome)
+	return outcome, nil
 }
 
 func (d *Database) DeleteOutcome(id int64) error {
-	result, err := d.db.Exec("DELETE FROM outcomes WHERE id = ?", id)
-	if err != nil {
-		return err
+	before, err := d.GetOutcome(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("outcome with ID %d %w", id, ErrNotFound)
 	}
-	rows, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
-	if rows == 0 {
-		return fmt.Errorf("outcome with ID %d not found", id)
+
+	if err := d.moveToTrash(EntityOutcome, id, before.Title); err != nil {
+		return err
 	}
+	d.publish(ActionDeleted, EntityOutcome, id, before, nil)
 	return nil
 }
 
 // Goal operations
 
-func (d *Database) CreateGoal(projectID *int64, taskID *int64, title, description, goalType, assignee string) (*Goal, error) {
+func (d *Database) CreateGoal(projectID *int64, taskID *int64, title, description, goalType, assignee string, startAt, dueAt *time.Time) (*Goal, error) {
 	if goalType == "" {
-		goalType = "short_term"
+		goalType = d.defaults.GoalType
+	}
+	if err := validateEnum("goal type", goalType, GoalTypes); err != nil {
+		return nil, err
+	}
+	if err := checkDateRange(startAt, dueAt); err != nil {
+		return nil, err
+	}
+	if err := d.checkTaskProject(EntityGoal, projectID, taskID); err != nil {
+		return nil, err
+	}
+	assigneeID, err := d.resolvePerson(assignee)
+	if err != nil {
+		return nil, err
 	}
 	result, err := d.db.Exec(
-		"INSERT INTO goals (project_id, task_id, title, description, goal_type, assignee) VALUES (?, ?, ?, ?, ?, ?)",
-		projectID, taskID, title, description, goalType, assignee,
+		"INSERT INTO goals (project_id, task_id, title, description, goal_type, assignee_id, start_at, due_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		projectID, taskID, title, description, goalType, assigneeID, dbTime(startAt), dbTime(dueAt),
 	)
 	if err != nil {
 		return nil, err
@@ -863,7 +1132,12 @@ func (d *Database) CreateGoal(projectID *int64, taskID *int64, title, descriptio
 		return nil, err
 	}
 
-	return d.GetGoal(id)
+	goal, err := d.GetGoal(id)
+	if err != nil {
+		return nil, err
+	}
+	d.publish(ActionCreated, EntityGoal, goal.ID, nil, goal)
+	return goal, nil
 }
 
 func (d *Database) GetGoal(id int64) (*Goal, error) {
@@ -872,9 +1146,9 @@ func (d *Database) GetGoal(id int64) (*Goal, error) {
 	var taskID sql.NullInt64
 	var assignee sql.NullString
 	err := d.db.QueryRow(
-		"SELECT id, project_id, task_id, title, description, goal_type, COALESCE(assignee, ''), created_at, updated_at FROM goals WHERE id = ?",
+		"SELECT id, project_id, task_id, title, description, goal_type, assignee_id, "+personName("goals.assignee_id")+", start_at, due_at, created_at, updated_at, "+tagColumn(EntityGoal, "goals.id")+" FROM goals WHERE id = ? AND deleted_at IS NULL",
 		id,
-	).Scan(&g.ID, &projectID, &taskID, &g.Title, &g.Description, &g.GoalType, &assignee, &g.CreatedAt, &g.UpdatedAt)
+	).Scan(&g.ID, &projectID, &taskID, &g.Title, &g.Description, &g.GoalType, &g.AssigneeID, &assignee, &g.StartAt, &g.DueAt, &g.CreatedAt, &g.UpdatedAt, (*tagList)(&g.Tags))
 	if err != nil {
 		return nil, err
 	}
@@ -891,45 +1165,41 @@ func (d *Database) GetGoal(id int64) (*Goal, error) {
 }
 
 func (d *Database) ListGoals(projectID *int64, taskID *int64, goalType *string, assignee *string) ([]*Goal, error) {
-	query := "SELECT id, project_id, task_id, title, description, goal_type, COALESCE(assignee, ''), created_at, updated_at FROM goals WHERE 1=1"
-	args := []interface{}{}
+	goals, _, err := d.ListGoalsPage(projectID, taskID, goalType, assignee, DueFilter{}, TagFilter{}, ListOptions{})
+	return goals, err
+}
 
+// ListGoalsPage lists goals matching the filters, one page at a time
+func (d *Database) ListGoalsPage(projectID *int64, taskID *int64, goalType *string, assignee *string, due DueFilter, tags TagFilter, opts ListOptions) ([]*Goal, *PageInfo, error) {
+	q := listQuery{
+		table:   "goals",
+		columns: "id, project_id, task_id, title, description, goal_type, assignee_id, " + personName("goals.assignee_id") + ", start_at, due_at, created_at, updated_at, " + tagColumn(EntityGoal, "goals.id"),
+		where:   []string{"deleted_at IS NULL"},
+		sorts:   datedItemSorts,
+	}
 	if projectID != nil {
-		query += " AND project_id = ?"
-		args = append(args, *projectID)
+		q.filter("project_id = ?", *projectID)
 	}
-
 	if taskID != nil {
-		query += " AND task_id = ?"
-		args = append(args, *taskID)
+		q.filter("task_id = ?", *taskID)
 	}
-
 	if goalType != nil {
-		query += " AND goal_type = ?"
-		args = append(args, *goalType)
+		q.filter("goal_type = ?", *goalType)
 	}
-
 	if assignee != nil {
-		query += " AND assignee = ?"
-		args = append(args, *assignee)
-	}
-
-	query += " ORDER BY updated_at DESC"
-
-	rows, err := d.db.Query(query, args...)
-	if err != nil {
-		return nil, err
+		q.filterPerson("assignee_id", *assignee)
 	}
-	defer rows.Close()
+	due.apply(&q, EntityGoal)
+	tags.apply(&q, EntityGoal)
 
 	var goals []*Goal
-	for rows.Next() {
+	page, err := d.listPage(q, opts, func(rows *sql.Rows, sortValue *interface{}) (int64, error) {
 		var g Goal
 		var projectID sql.NullInt64
 		var taskID sql.NullInt64
 		var assignee sql.NullString
-		if err := rows.Scan(&g.ID, &projectID, &taskID, &g.Title, &g.Description, &g.GoalType, &assignee, &g.CreatedAt, &g.UpdatedAt); err != nil {
-			return nil, err
+		if err := rows.Scan(&g.ID, &projectID, &taskID, &g.Title, &g.Description, &g.GoalType, &g.AssigneeID, &assignee, &g.StartAt, &g.DueAt, &g.CreatedAt, &g.UpdatedAt, (*tagList)(&g.Tags), sortValue); err != nil {
+			return 0, err
 		}
 		if projectID.Valid {
 			g.ProjectID = &projectID.Int64
@@ -941,14 +1211,49 @@ func (d *Database) ListGoals(projectID *int64, taskID *int64, goalType *string,
 			g.Assignee = assignee.String
 		}
 		goals = append(goals, &g)
+		return g.ID, nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
-	return goals, rows.Err()
+	return goals, page, nil
 }
 
-func (d *Database) UpdateGoal(id int64, title, description, goalType, assignee *string) (*Goal, error) {
+// UpdateGoal updates the given fields of a goal. A non-nil projectID or
+// taskID re-links the goal; the task must belong to its project.
+// UpdateGoal updates the fields that are set. A zero startAt or dueAt
+// clears the date.
+func (d *Database) UpdateGoal(id int64, title, description, goalType, assignee *string, projectID, taskID *int64, startAt, dueAt *time.Time) (*Goal, error) {
+	if err := validateOptionalEnum("goal type", goalType, GoalTypes); err != nil {
+		return nil, err
+	}
+	if projectID != nil || taskID != nil || startAt != nil || dueAt != nil {
+		current, err := d.GetGoal(id)
+		if err != nil {
+			return nil, err
+		}
+		if projectID != nil || taskID != nil {
+			if err := d.checkTaskProject(EntityGoal, firstInt64(projectID, current.ProjectID), firstInt64(taskID, current.TaskID)); err != nil {
+				return nil, err
+			}
+		}
+		if err := checkDateRange(firstTime(startAt, current.StartAt), firstTime(dueAt, current.DueAt)); err != nil {
+			return nil, err
+		}
+	}
+
 	updates := []string{}
 	args := []interface{}{}
 
+	if projectID != nil {
+		updates = append(updates, "project_id = ?")
+		args = append(args, *projectID)
+	}
+	if taskID != nil {
+		updates = append(updates, "task_id = ?")
+		args = append(args, *taskID)
+	}
+
 	if title != nil {
 		updates = append(updates, "title = ?")
 		args = append(args, *title)
@@ -962,8 +1267,20 @@ func (d *Database) UpdateGoal(id int64, title, description, goalType, assignee *
 		args = append(args, *goalType)
 	}
 	if assignee != nil {
-		updates = append(updates, "assignee = ?")
-		args = append(args, *assignee)
+		assigneeID, err := d.resolvePerson(*assignee)
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, "assignee_id = ?")
+		args = append(args, assigneeID)
+	}
+	if startAt != nil {
+		updates = append(updates, "start_at = ?")
+		args = append(args, dbTime(startAt))
+	}
+	if dueAt != nil {
+		updates = append(updates, "due_at = ?")
+		args = append(args, dbTime(dueAt))
 	}
 
 	if len(updates) == 0 {
@@ -979,36 +1296,55 @@ func (d *Database) UpdateGoal(id int64, title, description, goalType, assignee *
 	}
 	query += " WHERE id = ?"
 
-	_, err := d.db.Exec(query, args...)
+	before, err := d.GetGoal(id)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = d.db.Exec(query, args...)
 	if err != nil {
 		return nil, err
 	}
-	return d.GetGoal(id)
+
+	goal, err := d.GetGoal(id)
+	if err != nil {
+		return nil, err
+	}
+	d.publish(ActionUpdated, EntityGoal, goal.ID, before, goal)
+	return goal, nil
 }
 
 func (d *Database) DeleteGoal(id int64) error {
-	result, err := d.db.Exec("DELETE FROM goals WHERE id = ?", id)
-	if err != nil {
-		return err
+	before, err := d.GetGoal(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("goal with ID %d %w", id, ErrNotFound)
 	}
-	rows, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
-	if rows == 0 {
-		return fmt.Errorf("goal with ID %d not found", id)
+
+	if err := d.moveToTrash(EntityGoal, id, before.Title); err != nil {
+		return err
 	}
+	d.publish(ActionDeleted, EntityGoal, id, before, nil)
 	return nil
 }
 
 // Goal-Project linkage operations (many-to-many)
 
 func (d *Database) LinkGoalToProject(goalID, projectID int64) error {
-	_, err := d.db.Exec(
+	result, err := d.db.Exec(
 		"INSERT OR IGNORE INTO goal_projects (goal_id, project_id) VALUES (?, ?)",
 		goalID, projectID,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	// Linking twice is a no-op and does not produce an event
+	if rows, err := result.RowsAffected(); err == nil && rows > 0 {
+		d.publish(ActionCreated, EntityGoalProject, goalID, nil, map[string]int64{"goal_id": goalID, "project_id": projectID})
+	}
+	return nil
 }
 
 func (d *Database) UnlinkGoalFromProject(goalID, projectID int64) error {
@@ -1024,17 +1360,19 @@ func (d *Database) UnlinkGoalFromProject(goalID, projectID int64) error {
 		return err
 	}
 	if rows == 0 {
-		return fmt.Errorf("linkage between goal %d and project %d not found", goalID, projectID)
+		return fmt.Errorf("linkage between goal %d and project %d %w", goalID, projectID, ErrNotFound)
 	}
+	link := map[string]int64{"goal_id": goalID, "project_id": projectID}
+	d.publish(ActionDeleted, EntityGoalProject, goalID, link, link)
 	return nil
 }
 
 func (d *Database) GetGoalProjects(goalID int64) ([]*Project, error) {
 	rows, err := d.db.Query(`
-		SELECT p.id, p.name, p.description, COALESCE(p.external_link, ''), p.created_at, p.updated_at, COALESCE(p.status, 'active')
+		SELECT p.id, p.name, p.description, COALESCE(p.external_link, ''), p.start_at, p.due_at, p.created_at, p.updated_at, COALESCE(p.status, 'active'), `+tagColumn(EntityProject, "p.id")+`
 		FROM projects p
 		INNER JOIN goal_projects gp ON p.id = gp.project_id
-		WHERE gp.goal_id = ?
+		WHERE gp.goal_id = ? AND p.deleted_at IS NULL
 		ORDER BY p.name
 	`, goalID)
 	if err != nil {
@@ -1045,7 +1383,7 @@ func (d *Database) GetGoalProjects(goalID int64) ([]*Project, error) {
 	var projects []*Project
 	for rows.Next() {
 		var p Project
-		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.ExternalLink, &p.CreatedAt, &p.UpdatedAt, &p.Status); err != nil {
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.ExternalLink, &p.StartAt, &p.DueAt, &p.CreatedAt, &p.UpdatedAt, &p.Status, (*tagList)(&p.Tags)); err != nil {
 			return nil, err
 		}
 		projects = append(projects, &p)
@@ -1055,10 +1393,10 @@ func (d *Database) GetGoalProjects(goalID int64) ([]*Project, error) {
 
 func (d *Database) GetProjectGoals(projectID int64) ([]*Goal, error) {
 	rows, err := d.db.Query(`
-		SELECT g.id, g.project_id, g.task_id, g.title, g.description, g.goal_type, COALESCE(g.assignee, ''), g.created_at, g.updated_at
+		SELECT g.id, g.project_id, g.task_id, g.title, g.description, g.goal_type, g.assignee_id, `+personName("g.assignee_id")+`, g.start_at, g.due_at, g.created_at, g.updated_at, `+tagColumn(EntityGoal, "g.id")+`
 		FROM goals g
 		INNER JOIN goal_projects gp ON g.id = gp.goal_id
-		WHERE gp.project_id = ?
+		WHERE gp.project_id = ? AND g.deleted_at IS NULL
 		ORDER BY g.updated_at DESC
 	`, projectID)
 	if err != nil {
@@ -1072,7 +1410,7 @@ func (d *Database) GetProjectGoals(projectID int64) ([]*Goal, error) {
 		var projectID sql.NullInt64
 		var taskID sql.NullInt64
 		var assignee sql.NullString
-		if err := rows.Scan(&g.ID, &projectID, &taskID, &g.Title, &g.Description, &g.GoalType, &assignee, &g.CreatedAt, &g.UpdatedAt); err != nil {
+		if err := rows.Scan(&g.ID, &projectID, &taskID, &g.Title, &g.Description, &g.GoalType, &g.AssigneeID, &assignee, &g.StartAt, &g.DueAt, &g.CreatedAt, &g.UpdatedAt, (*tagList)(&g.Tags)); err != nil {
 			return nil, err
 		}
 		if projectID.Valid {
@@ -1092,11 +1430,18 @@ func (d *Database) GetProjectGoals(projectID int64) ([]*Goal, error) {
 // Problem-Project linkage operations (many-to-many)
 
 func (d *Database) LinkProblemToProject(problemID, projectID int64) error {
-	_, err := d.db.Exec(
+	result, err := d.db.Exec(
 		"INSERT OR IGNORE INTO problem_projects (problem_id, project_id) VALUES (?, ?)",
 		problemID, projectID,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	// Linking twice is a no-op and does not produce an event
+	if rows, err := result.RowsAffected(); err == nil && rows > 0 {
+		d.publish(ActionCreated, EntityProblemProject, problemID, nil, map[string]int64{"problem_id": problemID, "project_id": projectID})
+	}
+	return nil
 }
 
 func (d *Database) UnlinkProblemFromProject(problemID, projectID int64) error {
@@ -1112,17 +1457,19 @@ func (d *Database) UnlinkProblemFromProject(problemID, projectID int64) error {
 		return err
 	}
 	if rows == 0 {
-		return fmt.Errorf("linkage between problem %d and project %d not found", problemID, projectID)
+		return fmt.Errorf("linkage between problem %d and project %d %w", problemID, projectID, ErrNotFound)
 	}
+	link := map[string]int64{"problem_id": problemID, "project_id": projectID}
+	d.publish(ActionDeleted, EntityProblemProject, problemID, link, link)
 	return nil
 }
 
 func (d *Database) GetProblemProjects(problemID int64) ([]*Project, error) {
 	rows, err := d.db.Query(`
-		SELECT p.id, p.name, p.description, COALESCE(p.external_link, ''), p.created_at, p.updated_at, COALESCE(p.status, 'active')
+		SELECT p.id, p.name, p.description, COALESCE(p.external_link, ''), p.start_at, p.due_at, p.created_at, p.updated_at, COALESCE(p.status, 'active'), `+tagColumn(EntityProject, "p.id")+`
 		FROM projects p
 		INNER JOIN problem_projects pp ON p.id = pp.project_id
-		WHERE pp.problem_id = ?
+		WHERE pp.problem_id = ? AND p.deleted_at IS NULL
 		ORDER BY p.name
 	`, problemID)
 	if err != nil {
@@ -1133,7 +1480,7 @@ func (d *Database) GetProblemProjects(problemID int64) ([]*Project, error) {
 	var projects []*Project
 	for rows.Next() {
 		var p Project
-		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.ExternalLink, &p.CreatedAt, &p.UpdatedAt, &p.Status); err != nil {
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.ExternalLink, &p.StartAt, &p.DueAt, &p.CreatedAt, &p.UpdatedAt, &p.Status, (*tagList)(&p.Tags)); err != nil {
 			return nil, err
 		}
 		projects = append(projects, &p)
@@ -1143,10 +1490,10 @@ func (d *Database) GetProblemProjects(problemID int64) ([]*Project, error) {
 
 func (d *Database) GetProjectProblems(projectID int64) ([]*Problem, error) {
 	rows, err := d.db.Query(`
-		SELECT p.id, p.project_id, p.task_id, p.title, p.description, p.status, COALESCE(p.assignee, ''), p.created_at, p.updated_at
+		SELECT p.id, p.project_id, p.task_id, p.title, p.description, p.status, p.assignee_id, `+personName("p.assignee_id")+`, p.created_at, p.updated_at, `+tagColumn(EntityProblem, "p.id")+`
 		FROM problems p
 		INNER JOIN problem_projects pp ON p.id = pp.problem_id
-		WHERE pp.project_id = ?
+		WHERE pp.project_id = ? AND p.deleted_at IS NULL
 		ORDER BY p.updated_at DESC
 	`, projectID)
 	if err != nil {
@@ -1160,7 +1507,7 @@ func (d *Database) GetProjectProblems(projectID int64) ([]*Problem, error) {
 		var projectID sql.NullInt64
 		var taskID sql.NullInt64
 		var assignee sql.NullString
-		if err := rows.Scan(&p.ID, &projectID, &taskID, &p.Title, &p.Description, &p.Status, &assignee, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		if err := rows.Scan(&p.ID, &projectID, &taskID, &p.Title, &p.Description, &p.Status, &p.AssigneeID, &assignee, &p.CreatedAt, &p.UpdatedAt, (*tagList)(&p.Tags)); err != nil {
 			return nil, err
 		}
 		if projectID.Valid {
@@ -1180,6 +1527,9 @@ func (d *Database) GetProjectProblems(projectID int64) ([]*Problem, error) {
 // Task note operations
 
 func (d *Database) CreateTaskNote(taskID int64, note string) (*TaskNote, error) {
+	if err := d.checkTaskProject(EntityTaskNote, nil, &taskID); err != nil {
+		return nil, err
+	}
 	result, err := d.db.Exec(
 		"INSERT INTO task_notes (task_id, note) VALUES (?, ?)",
 		taskID, note,
@@ -1193,13 +1543,18 @@ func (d *Database) CreateTaskNote(taskID int64, note string) (*TaskNote, error)
 		return nil, err
 	}
 
-	return d.GetTaskNote(id)
+	taskNote, err := d.GetTaskNote(id)
+	if err != nil {
+		return nil, err
+	}
+	d.publish(ActionCreated, EntityTaskNote, taskNote.ID, nil, taskNote)
+	return taskNote, nil
 }
 
 func (d *Database) GetTaskNote(id int64) (*TaskNote, error) {
 	var note TaskNote
 	err := d.db.QueryRow(
-		"SELECT id, task_id, note, created_at, updated_at FROM task_notes WHERE id = ?",
+		"SELECT id, task_id, note, created_at, updated_at FROM task_notes WHERE id = ? AND deleted_at IS NULL",
 		id,
 	).Scan(&note.ID, &note.TaskID, &note.Note, &note.CreatedAt, &note.UpdatedAt)
 	if err != nil {
@@ -1210,7 +1565,7 @@ func (d *Database) GetTaskNote(id int64) (*TaskNote, error) {
 
 func (d *Database) ListTaskNotes(taskID int64) ([]*TaskNote, error) {
 	rows, err := d.db.Query(
-		"SELECT id, task_id, note, created_at, updated_at FROM task_notes WHERE task_id = ? ORDER BY updated_at DESC",
+		"SELECT id, task_id, note, created_at, updated_at FROM task_notes WHERE task_id = ? AND deleted_at IS NULL ORDER BY updated_at DESC",
 		taskID,
 	)
 	if err != nil {
@@ -1230,39 +1585,58 @@ func (d *Database) ListTaskNotes(taskID int64) ([]*TaskNote, error) {
 }
 
 func (d *Database) UpdateTaskNote(id int64, note string) (*TaskNote, error) {
-	_, err := d.db.Exec("UPDATE task_notes SET note = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", note, id)
+	before, err := d.GetTaskNote(id)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = d.db.Exec("UPDATE task_notes SET note = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", note, id)
+	if err != nil {
+		return nil, err
+	}
+
+	taskNote, err := d.GetTaskNote(id)
 	if err != nil {
 		return nil, err
 	}
-	return d.GetTaskNote(id)
+	d.publish(ActionUpdated, EntityTaskNote, taskNote.ID, before, taskNote)
+	return taskNote, nil
 }
 
 func (d *Database) DeleteTaskNote(id int64) error {
-	result, err := d.db.Exec("DELETE FROM task_notes WHERE id = ?", id)
-	if err != nil {
-		return err
+	before, err := d.GetTaskNote(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("task note with ID %d %w", id, ErrNotFound)
 	}
-	rows, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
-	if rows == 0 {
-		return fmt.Errorf("task note with ID %d not found", id)
+
+	if err := d.moveToTrash(EntityTaskNote, id, trashTitle(before.Note)); err != nil {
+		return err
 	}
+	d.publish(ActionDeleted, EntityTaskNote, id, before, nil)
 	return nil
 }
 
 func (d *Database) DeleteTask(id int64) error {
-	result, err := d.db.Exec("DELETE FROM tasks WHERE id = ?", id)
+	before, err := d.GetTask(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("task with ID %d %w", id, ErrNotFound)
+	}
 	if err != nil {
 		return err
 	}
-	rows, err := result.RowsAffected()
+
+	dependents, err := d.GetTaskDependents(id)
 	if err != nil {
 		return err
 	}
-	if rows == 0 {
-		return fmt.Errorf("task with ID %d not found", id)
+
+	if err := d.moveToTrash(EntityTask, id, before.Title); err != nil {
+		return err
 	}
+	d.publish(ActionDeleted, EntityTask, id, before, nil)
+	d.publishDependentChanges(dependents)
 	return nil
 }
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"errors"
+	"os"
 	"path/filepath"
 	"testing"
 )
@@ -22,12 +24,40 @@ func newTestDatabase(t *testing.T) *Database {
 	return database
 }
 
+func TestCloseCheckpointsLog(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "loom.db")
+	database, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	var mode string
+	if err := database.db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil || mode != "wal" {
+		t.Fatalf("expected write-ahead logging, got %q, %v", mode, err)
+	}
+	database.CreateProject("P", "", "", "", nil, nil)
+	if err := database.Close(); err != nil {
+		t.Fatalf("failed to close database: %v", err)
+	}
+	if info, err := os.Stat(dbPath + "-wal"); err == nil && info.Size() > 0 {
+		t.Errorf("expected the log to be checkpointed on close, found %d bytes", info.Size())
+	}
+
+	reopened, err := OpenDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("failed to reopen database: %v", err)
+	}
+	defer reopened.Close()
+	if projects, _ := reopened.ListProjects(nil); len(projects) != 1 {
+		t.Errorf("expected the project to survive, got %d", len(projects))
+	}
+}
+
 // --- Project CRUD ---
 
 func TestCreateProject(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, err := db.CreateProject("Test Project", "A description", "", "https://example.com")
+	project, err := db.CreateProject("Test Project", "A description", "", "https://example.com", nil, nil)
 	if err != nil {
 		t.Fatalf("failed to create project: %v", err)
 	}
@@ -48,7 +78,7 @@ func TestCreateProject(t *testing.T) {
 func TestGetProject(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, err := db.CreateProject("My Project", "desc", "", "")
+	project, err := db.CreateProject("My Project", "desc", "", "", nil, nil)
 	if err != nil {
 		t.Fatalf("failed to create project: %v", err)
 	}
@@ -82,8 +112,8 @@ func TestListProjects(t *testing.T) {
 		t.Fatalf("expected 0 projects, got %d", len(projects))
 	}
 
-	db.CreateProject("P1", "", "", "")
-	db.CreateProject("P2", "", "", "")
+	db.CreateProject("P1", "", "", "", nil, nil)
+	db.CreateProject("P2", "", "", "", nil, nil)
 
 	projects, err = db.ListProjects(nil)
 	if err != nil {
@@ -97,9 +127,9 @@ func TestListProjects(t *testing.T) {
 func TestListProjectsFiltered(t *testing.T) {
 	db := newTestDatabase(t)
 
-	db.CreateProject("Active Project", "desc", "active", "")
-	db.CreateProject("Completed Project", "desc", "completed", "")
-	db.CreateProject("Archived Project", "desc", "archived", "")
+	db.CreateProject("Active Project", "desc", "active", "", nil, nil)
+	db.CreateProject("Completed Project", "desc", "completed", "", nil, nil)
+	db.CreateProject("Archived Project", "desc", "archived", "", nil, nil)
 
 	// Filter by active status
 	status := "active"
@@ -137,14 +167,14 @@ func TestListProjectsFiltered(t *testing.T) {
 func TestUpdateProject(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, err := db.CreateProject("Original", "original desc", "", "")
+	project, err := db.CreateProject("Original", "original desc", "", "", nil, nil)
 	if err != nil {
 		t.Fatalf("failed to create project: %v", err)
 	}
 
 	newName := "Updated"
 	newDesc := "updated desc"
-	updated, err := db.UpdateProject(project.ID, &newName, &newDesc, nil, nil)
+	updated, err := db.UpdateProject(project.ID, &newName, &newDesc, nil, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("failed to update project: %v", err)
 	}
@@ -159,12 +189,12 @@ func TestUpdateProject(t *testing.T) {
 func TestUpdateProjectNoFields(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, err := db.CreateProject("NoChange", "", "", "")
+	project, err := db.CreateProject("NoChange", "", "", "", nil, nil)
 	if err != nil {
 		t.Fatalf("failed to create project: %v", err)
 	}
 
-	result, err := db.UpdateProject(project.ID, nil, nil, nil, nil)
+	result, err := db.UpdateProject(project.ID, nil, nil, nil, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("failed to update project with no fields: %v", err)
 	}
@@ -176,7 +206,7 @@ func TestUpdateProjectNoFields(t *testing.T) {
 func TestDeleteProject(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, err := db.CreateProject("ToDelete", "", "", "")
+	project, err := db.CreateProject("ToDelete", "", "", "", nil, nil)
 	if err != nil {
 		t.Fatalf("failed to create project: %v", err)
 	}
@@ -205,9 +235,9 @@ func TestDeleteProjectNotFound(t *testing.T) {
 func TestCreateTask(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
 
-	task, err := db.CreateTask(project.ID, "Task 1", "desc", "pending", "medium", "general", "https://jira.example.com/1")
+	task, err := db.CreateTask(project.ID, nil, "Task 1", "desc", "pending", "medium", "general", "https://jira.example.com/1", "", "", nil, nil)
 	if err != nil {
 		t.Fatalf("failed to create task: %v", err)
 	}
@@ -231,9 +261,9 @@ func TestCreateTask(t *testing.T) {
 func TestCreateTaskDefaultType(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
 
-	task, err := db.CreateTask(project.ID, "Task", "", "pending", "low", "", "")
+	task, err := db.CreateTask(project.ID, nil, "Task", "", "pending", "low", "", "", "", "", nil, nil)
 	if err != nil {
 		t.Fatalf("failed to create task: %v", err)
 	}
@@ -245,8 +275,8 @@ func TestCreateTaskDefaultType(t *testing.T) {
 func TestGetTask(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
-	task, _ := db.CreateTask(project.ID, "Task 1", "desc", "pending", "medium", "feature", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	task, _ := db.CreateTask(project.ID, nil, "Task 1", "desc", "pending", "medium", "feature", "", "", "", nil, nil)
 
 	loaded, err := db.GetTask(task.ID)
 	if err != nil {
@@ -272,9 +302,9 @@ func TestGetTaskNotFound(t *testing.T) {
 func TestListTasks(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
-	db.CreateTask(project.ID, "T1", "", "pending", "low", "general", "")
-	db.CreateTask(project.ID, "T2", "", "completed", "high", "bugfix", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	db.CreateTask(project.ID, nil, "T1", "", "pending", "low", "general", "", "", "", nil, nil)
+	db.CreateTask(project.ID, nil, "T2", "", "completed", "high", "bugfix", "", "", "", nil, nil)
 
 	// List all
 	tasks, err := db.ListTasks(nil, nil, nil)
@@ -318,14 +348,14 @@ func TestListTasks(t *testing.T) {
 func TestUpdateTask(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
-	task, _ := db.CreateTask(project.ID, "Original", "", "pending", "low", "general", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	task, _ := db.CreateTask(project.ID, nil, "Original", "", "pending", "low", "general", "", "", "", nil, nil)
 
 	newTitle := "Updated"
 	newStatus := "in_progress"
 	newPriority := "high"
 	newType := "feature"
-	updated, err := db.UpdateTask(task.ID, &newTitle, nil, &newStatus, &newPriority, &newType, nil)
+	updated, err := db.UpdateTask(task.ID, &newTitle, nil, &newStatus, &newPriority, &newType, nil, nil, nil, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("failed to update task: %v", err)
 	}
@@ -346,8 +376,8 @@ func TestUpdateTask(t *testing.T) {
 func TestDeleteTask(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
-	task, _ := db.CreateTask(project.ID, "T", "", "pending", "low", "general", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	task, _ := db.CreateTask(project.ID, nil, "T", "", "pending", "low", "general", "", "", "", nil, nil)
 
 	if err := db.DeleteTask(task.ID); err != nil {
 		t.Fatalf("failed to delete task: %v", err)
@@ -400,7 +430,7 @@ func TestCreateProblemWithoutProject(t *testing.T) {
 func TestCreateProblemWithProject(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
 	problem, err := db.CreateProblem(&project.ID, nil, "Linked problem", "desc", "open", "")
 	if err != nil {
 		t.Fatalf("failed to create problem: %v", err)
@@ -413,8 +443,8 @@ func TestCreateProblemWithProject(t *testing.T) {
 func TestCreateProblemWithTask(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
-	task, _ := db.CreateTask(project.ID, "T", "", "pending", "low", "general", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	task, _ := db.CreateTask(project.ID, nil, "T", "", "pending", "low", "general", "", "", "", nil, nil)
 
 	problem, err := db.CreateProblem(&project.ID, &task.ID, "Task problem", "", "open", "")
 	if err != nil {
@@ -449,8 +479,8 @@ func TestGetProblemNotFound(t *testing.T) {
 func TestListProblemsFiltered(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
-	task, _ := db.CreateTask(project.ID, "T", "", "pending", "low", "general", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	task, _ := db.CreateTask(project.ID, nil, "T", "", "pending", "low", "general", "", "", "", nil, nil)
 
 	db.CreateProblem(&project.ID, &task.ID, "P1", "", "open", "alice")
 	db.CreateProblem(&project.ID, nil, "P2", "", "in_progress", "bob")
@@ -490,7 +520,7 @@ func TestUpdateProblem(t *testing.T) {
 
 	newTitle := "Updated"
 	newStatus := "resolved"
-	updated, err := db.UpdateProblem(problem.ID, &newTitle, nil, &newStatus, nil)
+	updated, err := db.UpdateProblem(problem.ID, &newTitle, nil, &newStatus, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("failed to update problem: %v", err)
 	}
@@ -508,7 +538,7 @@ func TestUpdateProblemAssignee(t *testing.T) {
 	problem, _ := db.CreateProblem(nil, nil, "Problem", "desc", "open", "")
 
 	newAssignee := "jane.doe"
-	updated, err := db.UpdateProblem(problem.ID, nil, nil, nil, &newAssignee)
+	updated, err := db.UpdateProblem(problem.ID, nil, nil, nil, &newAssignee, nil, nil)
 	if err != nil {
 		t.Fatalf("failed to update problem assignee: %v", err)
 	}
@@ -545,9 +575,9 @@ func TestDeleteProblemNotFound(t *testing.T) {
 func TestCreateOutcome(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
 
-	outcome, err := db.CreateOutcome(project.ID, nil, "Outcome 1", "desc", "open")
+	outcome, err := db.CreateOutcome(project.ID, nil, "Outcome 1", "desc", "open", nil, nil)
 	if err != nil {
 		t.Fatalf("failed to create outcome: %v", err)
 	}
@@ -565,10 +595,10 @@ func TestCreateOutcome(t *testing.T) {
 func TestCreateOutcomeWithTask(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
-	task, _ := db.CreateTask(project.ID, "T", "", "pending", "low", "general", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	task, _ := db.CreateTask(project.ID, nil, "T", "", "pending", "low", "general", "", "", "", nil, nil)
 
-	outcome, err := db.CreateOutcome(project.ID, &task.ID, "Outcome", "", "open")
+	outcome, err := db.CreateOutcome(project.ID, &task.ID, "Outcome", "", "open", nil, nil)
 	if err != nil {
 		t.Fatalf("failed to create outcome with task: %v", err)
 	}
@@ -589,13 +619,13 @@ func TestGetOutcomeNotFound(t *testing.T) {
 func TestListOutcomes(t *testing.T) {
 	db := newTestDatabase(t)
 
-	p1, _ := db.CreateProject("P1", "", "", "")
-	p2, _ := db.CreateProject("P2", "", "", "")
-	task, _ := db.CreateTask(p1.ID, "T", "", "pending", "low", "general", "")
+	p1, _ := db.CreateProject("P1", "", "", "", nil, nil)
+	p2, _ := db.CreateProject("P2", "", "", "", nil, nil)
+	task, _ := db.CreateTask(p1.ID, nil, "T", "", "pending", "low", "general", "", "", "", nil, nil)
 
-	db.CreateOutcome(p1.ID, &task.ID, "O1", "", "open")
-	db.CreateOutcome(p1.ID, nil, "O2", "", "completed")
-	db.CreateOutcome(p2.ID, nil, "O3", "", "open")
+	db.CreateOutcome(p1.ID, &task.ID, "O1", "", "open", nil, nil)
+	db.CreateOutcome(p1.ID, nil, "O2", "", "completed", nil, nil)
+	db.CreateOutcome(p2.ID, nil, "O3", "", "open", nil, nil)
 
 	// All
 	outcomes, _ := db.ListOutcomes(nil, nil, nil)
@@ -626,12 +656,12 @@ func TestListOutcomes(t *testing.T) {
 func TestUpdateOutcome(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
-	outcome, _ := db.CreateOutcome(project.ID, nil, "Original", "", "open")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	outcome, _ := db.CreateOutcome(project.ID, nil, "Original", "", "open", nil, nil)
 
 	newTitle := "Updated"
 	newStatus := "completed"
-	updated, err := db.UpdateOutcome(outcome.ID, &newTitle, nil, &newStatus)
+	updated, err := db.UpdateOutcome(outcome.ID, &newTitle, nil, &newStatus, nil, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("failed to update outcome: %v", err)
 	}
@@ -646,8 +676,8 @@ func TestUpdateOutcome(t *testing.T) {
 func TestDeleteOutcome(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
-	outcome, _ := db.CreateOutcome(project.ID, nil, "ToDelete", "", "open")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	outcome, _ := db.CreateOutcome(project.ID, nil, "ToDelete", "", "open", nil, nil)
 
 	if err := db.DeleteOutcome(outcome.ID); err != nil {
 		t.Fatalf("failed to delete outcome: %v", err)
@@ -672,7 +702,7 @@ func TestDeleteOutcomeNotFound(t *testing.T) {
 func TestCreateGoalWithoutProject(t *testing.T) {
 	database := newTestDatabase(t)
 
-	goal, err := database.CreateGoal(nil, nil, "Career goal", "Move into leadership", "career", "")
+	goal, err := database.CreateGoal(nil, nil, "Career goal", "Move into leadership", "career", "", nil, nil)
 	if err != nil {
 		t.Fatalf("failed to create goal: %v", err)
 	}
@@ -693,7 +723,7 @@ func TestCreateGoalWithoutProject(t *testing.T) {
 
 	updatedTitle := "Updated career goal"
 	updatedType := "values"
-	updated, err := database.UpdateGoal(goal.ID, &updatedTitle, nil, &updatedType, nil)
+	updated, err := database.UpdateGoal(goal.ID, &updatedTitle, nil, &updatedType, nil, nil, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("failed to update goal: %v", err)
 	}
@@ -712,8 +742,8 @@ func TestCreateGoalWithoutProject(t *testing.T) {
 func TestCreateGoalWithProject(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
-	goal, err := db.CreateGoal(&project.ID, nil, "Project goal", "", "short_term", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	goal, err := db.CreateGoal(&project.ID, nil, "Project goal", "", "short_term", "", nil, nil)
 	if err != nil {
 		t.Fatalf("failed to create goal with project: %v", err)
 	}
@@ -725,10 +755,10 @@ func TestCreateGoalWithProject(t *testing.T) {
 func TestCreateGoalWithTask(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
-	task, _ := db.CreateTask(project.ID, "T", "", "pending", "low", "general", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	task, _ := db.CreateTask(project.ID, nil, "T", "", "pending", "low", "general", "", "", "", nil, nil)
 
-	goal, err := db.CreateGoal(&project.ID, &task.ID, "Task goal", "", "requirement", "")
+	goal, err := db.CreateGoal(&project.ID, &task.ID, "Task goal", "", "requirement", "", nil, nil)
 	if err != nil {
 		t.Fatalf("failed to create goal with task: %v", err)
 	}
@@ -740,7 +770,7 @@ func TestCreateGoalWithTask(t *testing.T) {
 func TestCreateGoalWithAssignee(t *testing.T) {
 	db := newTestDatabase(t)
 
-	goal, err := db.CreateGoal(nil, nil, "Assigned goal", "desc", "career", "manager@example.com")
+	goal, err := db.CreateGoal(nil, nil, "Assigned goal", "desc", "career", "manager@example.com", nil, nil)
 	if err != nil {
 		t.Fatalf("failed to create goal with assignee: %v", err)
 	}
@@ -752,7 +782,7 @@ func TestCreateGoalWithAssignee(t *testing.T) {
 func TestCreateGoalDefaultType(t *testing.T) {
 	db := newTestDatabase(t)
 
-	goal, err := db.CreateGoal(nil, nil, "Default type goal", "", "", "")
+	goal, err := db.CreateGoal(nil, nil, "Default type goal", "", "", "", nil, nil)
 	if err != nil {
 		t.Fatalf("failed to create goal: %v", err)
 	}
@@ -773,12 +803,12 @@ func TestGetGoalNotFound(t *testing.T) {
 func TestListGoalsFiltered(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
-	task, _ := db.CreateTask(project.ID, "T", "", "pending", "low", "general", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	task, _ := db.CreateTask(project.ID, nil, "T", "", "pending", "low", "general", "", "", "", nil, nil)
 
-	db.CreateGoal(&project.ID, &task.ID, "G1", "", "short_term", "alice")
-	db.CreateGoal(&project.ID, nil, "G2", "", "career", "bob")
-	db.CreateGoal(nil, nil, "G3", "", "short_term", "alice")
+	db.CreateGoal(&project.ID, &task.ID, "G1", "", "short_term", "alice", nil, nil)
+	db.CreateGoal(&project.ID, nil, "G2", "", "career", "bob", nil, nil)
+	db.CreateGoal(nil, nil, "G3", "", "short_term", "alice", nil, nil)
 
 	// By project
 	goals, _ := db.ListGoals(&project.ID, nil, nil, nil)
@@ -810,10 +840,10 @@ func TestListGoalsFiltered(t *testing.T) {
 func TestUpdateGoalAssignee(t *testing.T) {
 	db := newTestDatabase(t)
 
-	goal, _ := db.CreateGoal(nil, nil, "Goal", "desc", "career", "")
+	goal, _ := db.CreateGoal(nil, nil, "Goal", "desc", "career", "", nil, nil)
 
 	newAssignee := "senior.manager"
-	updated, err := db.UpdateGoal(goal.ID, nil, nil, nil, &newAssignee)
+	updated, err := db.UpdateGoal(goal.ID, nil, nil, nil, &newAssignee, nil, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("failed to update goal assignee: %v", err)
 	}
@@ -836,8 +866,8 @@ func TestDeleteGoalNotFound(t *testing.T) {
 func TestCreateTaskNote(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
-	task, _ := db.CreateTask(project.ID, "T", "", "pending", "low", "general", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	task, _ := db.CreateTask(project.ID, nil, "T", "", "pending", "low", "general", "", "", "", nil, nil)
 
 	note, err := db.CreateTaskNote(task.ID, "This is a note")
 	if err != nil {
@@ -854,8 +884,8 @@ func TestCreateTaskNote(t *testing.T) {
 func TestGetTaskNote(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
-	task, _ := db.CreateTask(project.ID, "T", "", "pending", "low", "general", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	task, _ := db.CreateTask(project.ID, nil, "T", "", "pending", "low", "general", "", "", "", nil, nil)
 	note, _ := db.CreateTaskNote(task.ID, "A note")
 
 	loaded, err := db.GetTaskNote(note.ID)
@@ -879,8 +909,8 @@ func TestGetTaskNoteNotFound(t *testing.T) {
 func TestListTaskNotes(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
-	task, _ := db.CreateTask(project.ID, "T", "", "pending", "low", "general", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	task, _ := db.CreateTask(project.ID, nil, "T", "", "pending", "low", "general", "", "", "", nil, nil)
 
 	db.CreateTaskNote(task.ID, "Note 1")
 	db.CreateTaskNote(task.ID, "Note 2")
@@ -897,8 +927,8 @@ func TestListTaskNotes(t *testing.T) {
 func TestListTaskNotesEmpty(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
-	task, _ := db.CreateTask(project.ID, "T", "", "pending", "low", "general", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	task, _ := db.CreateTask(project.ID, nil, "T", "", "pending", "low", "general", "", "", "", nil, nil)
 
 	notes, err := db.ListTaskNotes(task.ID)
 	if err != nil {
@@ -912,8 +942,8 @@ func TestListTaskNotesEmpty(t *testing.T) {
 func TestUpdateTaskNote(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
-	task, _ := db.CreateTask(project.ID, "T", "", "pending", "low", "general", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	task, _ := db.CreateTask(project.ID, nil, "T", "", "pending", "low", "general", "", "", "", nil, nil)
 	note, _ := db.CreateTaskNote(task.ID, "Original note")
 
 	updated, err := db.UpdateTaskNote(note.ID, "Updated note")
@@ -928,8 +958,8 @@ func TestUpdateTaskNote(t *testing.T) {
 func TestDeleteTaskNote(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
-	task, _ := db.CreateTask(project.ID, "T", "", "pending", "low", "general", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	task, _ := db.CreateTask(project.ID, nil, "T", "", "pending", "low", "general", "", "", "", nil, nil)
 	note, _ := db.CreateTaskNote(task.ID, "To delete")
 
 	if err := db.DeleteTaskNote(note.ID); err != nil {
@@ -955,9 +985,9 @@ func TestDeleteTaskNoteNotFound(t *testing.T) {
 func TestDeleteProjectCascadesToTasks(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
-	task1, _ := db.CreateTask(project.ID, "T1", "", "pending", "low", "general", "")
-	task2, _ := db.CreateTask(project.ID, "T2", "", "pending", "low", "general", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	task1, _ := db.CreateTask(project.ID, nil, "T1", "", "pending", "low", "general", "", "", "", nil, nil)
+	task2, _ := db.CreateTask(project.ID, nil, "T2", "", "pending", "low", "general", "", "", "", nil, nil)
 
 	if err := db.DeleteProject(project.ID); err != nil {
 		t.Fatalf("failed to delete project: %v", err)
@@ -977,8 +1007,8 @@ func TestDeleteProjectCascadesToTasks(t *testing.T) {
 func TestDeleteProjectCascadesToOutcomes(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
-	outcome, _ := db.CreateOutcome(project.ID, nil, "O", "", "open")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	outcome, _ := db.CreateOutcome(project.ID, nil, "O", "", "open", nil, nil)
 
 	if err := db.DeleteProject(project.ID); err != nil {
 		t.Fatalf("failed to delete project: %v", err)
@@ -993,12 +1023,16 @@ func TestDeleteProjectCascadesToOutcomes(t *testing.T) {
 func TestDeleteProjectSetsNullOnProblems(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
 	problem, _ := db.CreateProblem(&project.ID, nil, "Problem", "", "open", "")
 
 	if err := db.DeleteProject(project.ID); err != nil {
 		t.Fatalf("failed to delete project: %v", err)
 	}
+	// Links are kept while the project is in the trash
+	if _, err := db.PurgeTrash(0); err != nil {
+		t.Fatalf("failed to purge trash: %v", err)
+	}
 
 	// Problem should still exist but with null project_id
 	loaded, err := db.GetProblem(problem.ID)
@@ -1013,12 +1047,16 @@ func TestDeleteProjectSetsNullOnProblems(t *testing.T) {
 func TestDeleteProjectSetsNullOnGoals(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
-	goal, _ := db.CreateGoal(&project.ID, nil, "Goal", "", "short_term", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	goal, _ := db.CreateGoal(&project.ID, nil, "Goal", "", "short_term", "", nil, nil)
 
 	if err := db.DeleteProject(project.ID); err != nil {
 		t.Fatalf("failed to delete project: %v", err)
 	}
+	// Links are kept while the project is in the trash
+	if _, err := db.PurgeTrash(0); err != nil {
+		t.Fatalf("failed to purge trash: %v", err)
+	}
 
 	loaded, err := db.GetGoal(goal.ID)
 	if err != nil {
@@ -1032,8 +1070,8 @@ func TestDeleteProjectSetsNullOnGoals(t *testing.T) {
 func TestDeleteTaskCascadesToNotes(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
-	task, _ := db.CreateTask(project.ID, "T", "", "pending", "low", "general", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	task, _ := db.CreateTask(project.ID, nil, "T", "", "pending", "low", "general", "", "", "", nil, nil)
 	note, _ := db.CreateTaskNote(task.ID, "A note")
 
 	if err := db.DeleteTask(task.ID); err != nil {
@@ -1049,13 +1087,17 @@ func TestDeleteTaskCascadesToNotes(t *testing.T) {
 func TestDeleteTaskSetsNullOnProblems(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
-	task, _ := db.CreateTask(project.ID, "T", "", "pending", "low", "general", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	task, _ := db.CreateTask(project.ID, nil, "T", "", "pending", "low", "general", "", "", "", nil, nil)
 	problem, _ := db.CreateProblem(&project.ID, &task.ID, "Problem", "", "open", "")
 
 	if err := db.DeleteTask(task.ID); err != nil {
 		t.Fatalf("failed to delete task: %v", err)
 	}
+	// Links are kept while the task is in the trash
+	if _, err := db.PurgeTrash(0); err != nil {
+		t.Fatalf("failed to purge trash: %v", err)
+	}
 
 	loaded, err := db.GetProblem(problem.ID)
 	if err != nil {
@@ -1073,13 +1115,17 @@ func TestDeleteTaskSetsNullOnProblems(t *testing.T) {
 func TestDeleteTaskSetsNullOnOutcomes(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
-	task, _ := db.CreateTask(project.ID, "T", "", "pending", "low", "general", "")
-	outcome, _ := db.CreateOutcome(project.ID, &task.ID, "Outcome", "", "open")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	task, _ := db.CreateTask(project.ID, nil, "T", "", "pending", "low", "general", "", "", "", nil, nil)
+	outcome, _ := db.CreateOutcome(project.ID, &task.ID, "Outcome", "", "open", nil, nil)
 
 	if err := db.DeleteTask(task.ID); err != nil {
 		t.Fatalf("failed to delete task: %v", err)
 	}
+	// Links are kept while the task is in the trash
+	if _, err := db.PurgeTrash(0); err != nil {
+		t.Fatalf("failed to purge trash: %v", err)
+	}
 
 	loaded, err := db.GetOutcome(outcome.ID)
 	if err != nil {
@@ -1093,13 +1139,17 @@ func TestDeleteTaskSetsNullOnOutcomes(t *testing.T) {
 func TestDeleteTaskSetsNullOnGoals(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
-	task, _ := db.CreateTask(project.ID, "T", "", "pending", "low", "general", "")
-	goal, _ := db.CreateGoal(&project.ID, &task.ID, "Goal", "", "short_term", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	task, _ := db.CreateTask(project.ID, nil, "T", "", "pending", "low", "general", "", "", "", nil, nil)
+	goal, _ := db.CreateGoal(&project.ID, &task.ID, "Goal", "", "short_term", "", nil, nil)
 
 	if err := db.DeleteTask(task.ID); err != nil {
 		t.Fatalf("failed to delete task: %v", err)
 	}
+	// Links are kept while the task is in the trash
+	if _, err := db.PurgeTrash(0); err != nil {
+		t.Fatalf("failed to purge trash: %v", err)
+	}
 
 	loaded, err := db.GetGoal(goal.ID)
 	if err != nil {
@@ -1116,7 +1166,7 @@ func TestForeignKeyEnforcement(t *testing.T) {
 	db := newTestDatabase(t)
 
 	// Creating a task with a non-existent project_id should fail
-	_, err := db.CreateTask(9999, "Bad Task", "", "pending", "low", "general", "")
+	_, err := db.CreateTask(9999, nil, "Bad Task", "", "pending", "low", "general", "", "", "", nil, nil)
 	if err == nil {
 		t.Fatal("expected foreign key error when creating task with non-existent project_id")
 	}
@@ -1136,7 +1186,7 @@ func TestForeignKeyEnforcementOutcomes(t *testing.T) {
 	db := newTestDatabase(t)
 
 	// Creating an outcome with a non-existent project_id should fail
-	_, err := db.CreateOutcome(9999, nil, "Bad outcome", "", "open")
+	_, err := db.CreateOutcome(9999, nil, "Bad outcome", "", "open", nil, nil)
 	if err == nil {
 		t.Fatal("expected foreign key error when creating outcome with non-existent project_id")
 	}
@@ -1165,7 +1215,7 @@ func TestNewDatabaseIdempotent(t *testing.T) {
 	}
 
 	// Create some data
-	_, err = db1.CreateProject("Test", "", "", "")
+	_, err = db1.CreateProject("Test", "", "", "", nil, nil)
 	if err != nil {
 		t.Fatalf("failed to create project: %v", err)
 	}
@@ -1192,9 +1242,9 @@ func TestNewDatabaseIdempotent(t *testing.T) {
 func TestLinkGoalToProject(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project1, _ := db.CreateProject("P1", "", "", "")
-	project2, _ := db.CreateProject("P2", "", "", "")
-	goal, _ := db.CreateGoal(nil, nil, "Shared goal", "desc", "career", "")
+	project1, _ := db.CreateProject("P1", "", "", "", nil, nil)
+	project2, _ := db.CreateProject("P2", "", "", "", nil, nil)
+	goal, _ := db.CreateGoal(nil, nil, "Shared goal", "desc", "career", "", nil, nil)
 
 	if err := db.LinkGoalToProject(goal.ID, project1.ID); err != nil {
 		t.Fatalf("failed to link goal to project1: %v", err)
@@ -1216,8 +1266,8 @@ func TestLinkGoalToProject(t *testing.T) {
 func TestUnlinkGoalFromProject(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
-	goal, _ := db.CreateGoal(nil, nil, "Goal", "", "career", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	goal, _ := db.CreateGoal(nil, nil, "Goal", "", "career", "", nil, nil)
 
 	db.LinkGoalToProject(goal.ID, project.ID)
 
@@ -1243,9 +1293,9 @@ func TestUnlinkGoalFromProjectNotFound(t *testing.T) {
 func TestGetProjectGoals(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
-	goal1, _ := db.CreateGoal(nil, nil, "G1", "", "career", "")
-	goal2, _ := db.CreateGoal(nil, nil, "G2", "", "short_term", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	goal1, _ := db.CreateGoal(nil, nil, "G1", "", "career", "", nil, nil)
+	goal2, _ := db.CreateGoal(nil, nil, "G2", "", "short_term", "", nil, nil)
 
 	db.LinkGoalToProject(goal1.ID, project.ID)
 	db.LinkGoalToProject(goal2.ID, project.ID)
@@ -1264,8 +1314,8 @@ func TestGetProjectGoals(t *testing.T) {
 func TestLinkProblemToProject(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project1, _ := db.CreateProject("P1", "", "", "")
-	project2, _ := db.CreateProject("P2", "", "", "")
+	project1, _ := db.CreateProject("P1", "", "", "", nil, nil)
+	project2, _ := db.CreateProject("P2", "", "", "", nil, nil)
 	problem, _ := db.CreateProblem(nil, nil, "Shared problem", "desc", "open", "")
 
 	if err := db.LinkProblemToProject(problem.ID, project1.ID); err != nil {
@@ -1288,7 +1338,7 @@ func TestLinkProblemToProject(t *testing.T) {
 func TestUnlinkProblemFromProject(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
 	problem, _ := db.CreateProblem(nil, nil, "Problem", "", "open", "")
 
 	db.LinkProblemToProject(problem.ID, project.ID)
@@ -1315,7 +1365,7 @@ func TestUnlinkProblemFromProjectNotFound(t *testing.T) {
 func TestGetProjectProblems(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
 	problem1, _ := db.CreateProblem(nil, nil, "P1", "", "open", "")
 	problem2, _ := db.CreateProblem(nil, nil, "P2", "", "in_progress", "")
 
@@ -1336,8 +1386,8 @@ func TestGetProjectProblems(t *testing.T) {
 func TestDeleteGoalCascadesToJunction(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
-	goal, _ := db.CreateGoal(nil, nil, "Goal", "", "career", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	goal, _ := db.CreateGoal(nil, nil, "Goal", "", "career", "", nil, nil)
 	db.LinkGoalToProject(goal.ID, project.ID)
 
 	if err := db.DeleteGoal(goal.ID); err != nil {
@@ -1354,7 +1404,7 @@ func TestDeleteGoalCascadesToJunction(t *testing.T) {
 func TestDeleteProblemCascadesToJunction(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
 	problem, _ := db.CreateProblem(nil, nil, "Problem", "", "open", "")
 	db.LinkProblemToProject(problem.ID, project.ID)
 
@@ -1372,8 +1422,8 @@ func TestDeleteProblemCascadesToJunction(t *testing.T) {
 func TestDeleteProjectCascadesToGoalJunction(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
-	goal, _ := db.CreateGoal(nil, nil, "Goal", "", "career", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	goal, _ := db.CreateGoal(nil, nil, "Goal", "", "career", "", nil, nil)
 	db.LinkGoalToProject(goal.ID, project.ID)
 
 	if err := db.DeleteProject(project.ID); err != nil {
@@ -1395,7 +1445,7 @@ func TestDeleteProjectCascadesToGoalJunction(t *testing.T) {
 func TestDeleteProjectCascadesToProblemJunction(t *testing.T) {
 	db := newTestDatabase(t)
 
-	project, _ := db.CreateProject("P", "", "", "")
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
 	problem, _ := db.CreateProblem(nil, nil, "Problem", "", "open", "")
 	db.LinkProblemToProject(problem.ID, project.ID)
 
@@ -1414,3 +1464,135 @@ func TestDeleteProjectCascadesToProblemJunction(t *testing.T) {
 		t.Fatalf("expected 0 linked projects after project delete, got %d", len(projects))
 	}
 }
+
+func TestEnumValidation(t *testing.T) {
+	db := newTestDatabase(t)
+
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	task, _ := db.CreateTask(project.ID, nil, "T", "", "pending", "low", "general", "", "", "", nil, nil)
+	problem, _ := db.CreateProblem(nil, nil, "Problem", "", "open", "")
+	outcome, _ := db.CreateOutcome(project.ID, nil, "Outcome", "", "open", nil, nil)
+	goal, _ := db.CreateGoal(nil, nil, "Goal", "", "career", "", nil, nil)
+
+	typo := "in-progress"
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"create project", func() error { _, err := db.CreateProject("P", "", "done", "", nil, nil); return err }},
+		{"update project", func() error { _, err := db.UpdateProject(project.ID, nil, nil, &typo, nil, nil, nil); return err }},
+		{"create task status", func() error {
+			_, err := db.CreateTask(project.ID, nil, "T", "", "done", "low", "general", "", "", "", nil, nil)
+			return err
+		}},
+		{"create task priority", func() error {
+			_, err := db.CreateTask(project.ID, nil, "T", "", "pending", "critical", "general", "", "", "", nil, nil)
+			return err
+		}},
+		{"create task type", func() error {
+			_, err := db.CreateTask(project.ID, nil, "T", "", "pending", "low", "epic", "", "", "", nil, nil)
+			return err
+		}},
+		{"update task status", func() error {
+			_, err := db.UpdateTask(task.ID, nil, nil, &typo, nil, nil, nil, nil, nil, nil, nil, nil)
+			return err
+		}},
+		{"update task priority", func() error {
+			_, err := db.UpdateTask(task.ID, nil, nil, nil, &typo, nil, nil, nil, nil, nil, nil, nil)
+			return err
+		}},
+		{"create problem", func() error { _, err := db.CreateProblem(nil, nil, "P", "", "done", ""); return err }},
+		{"update problem", func() error { _, err := db.UpdateProblem(problem.ID, nil, nil, &typo, nil, nil, nil); return err }},
+		{"create outcome", func() error { _, err := db.CreateOutcome(project.ID, nil, "O", "", "done", nil, nil); return err }},
+		{"update outcome", func() error { _, err := db.UpdateOutcome(outcome.ID, nil, nil, &typo, nil, nil, nil, nil); return err }},
+		{"create goal", func() error { _, err := db.CreateGoal(nil, nil, "G", "", "someday", "", nil, nil); return err }},
+		{"update goal", func() error { _, err := db.UpdateGoal(goal.ID, nil, nil, &typo, nil, nil, nil, nil, nil); return err }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			if !errors.Is(err, ErrInvalidValue) {
+				t.Fatalf("expected ErrInvalidValue, got %v", err)
+			}
+		})
+	}
+
+	// Nothing was changed by the rejected updates
+	unchanged, _ := db.GetTask(task.ID)
+	if unchanged.Status != "pending" || unchanged.Priority != "low" {
+		t.Errorf("expected task to be unchanged, got %+v", unchanged)
+	}
+}
+
+func TestCreateDefaultsEnumValues(t *testing.T) {
+	db := newTestDatabase(t)
+
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	task, err := db.CreateTask(project.ID, nil, "T", "", "", "", "", "", "", "", nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	if task.Status != "pending" || task.Priority != "medium" || task.TaskType != "general" {
+		t.Errorf("expected default task values, got %+v", task)
+	}
+
+	problem, _ := db.CreateProblem(nil, nil, "Problem", "", "", "")
+	if problem.Status != "open" {
+		t.Errorf("expected default problem status open, got %q", problem.Status)
+	}
+	outcome, _ := db.CreateOutcome(project.ID, nil, "Outcome", "", "", nil, nil)
+	if outcome.Status != "open" {
+		t.Errorf("expected default outcome status open, got %q", outcome.Status)
+	}
+}
+
+func TestStatusWorkflow(t *testing.T) {
+	db := newTestDatabase(t)
+
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	task, _ := db.CreateTask(project.ID, nil, "T", "", "completed", "low", "general", "", "", "", nil, nil)
+
+	pending := "pending"
+	_, err := db.UpdateTask(task.ID, nil, nil, &pending, nil, nil, nil, nil, nil, nil, nil, nil)
+	if !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("expected completed -> pending to be rejected, got %v", err)
+	}
+
+	// Reopening and staying in the same status are allowed
+	completed := "completed"
+	if _, err := db.UpdateTask(task.ID, nil, nil, &completed, nil, nil, nil, nil, nil, nil, nil, nil); err != nil {
+		t.Fatalf("expected same-status update to be allowed: %v", err)
+	}
+	inProgress := "in_progress"
+	if _, err := db.UpdateTask(task.ID, nil, nil, &inProgress, nil, nil, nil, nil, nil, nil, nil, nil); err != nil {
+		t.Fatalf("expected completed -> in_progress to be allowed: %v", err)
+	}
+
+	problem, _ := db.CreateProblem(nil, nil, "Problem", "", "resolved", "")
+	blocked := "blocked"
+	if _, err := db.UpdateProblem(problem.ID, nil, nil, &blocked, nil, nil, nil); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("expected resolved -> blocked to be rejected, got %v", err)
+	}
+
+	// A custom workflow replaces the default for that entity only
+	err = db.SetWorkflows(map[string]Workflow{
+		EntityTask: {"in_progress": {"completed"}, "completed": {}},
+	})
+	if err != nil {
+		t.Fatalf("failed to set workflows: %v", err)
+	}
+	if _, err := db.UpdateTask(task.ID, nil, nil, &pending, nil, nil, nil, nil, nil, nil, nil, nil); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("expected in_progress -> pending to be rejected by custom workflow, got %v", err)
+	}
+	if _, err := db.UpdateTask(task.ID, nil, nil, &completed, nil, nil, nil, nil, nil, nil, nil, nil); err != nil {
+		t.Fatalf("expected in_progress -> completed to be allowed: %v", err)
+	}
+	if _, err := db.UpdateTask(task.ID, nil, nil, &inProgress, nil, nil, nil, nil, nil, nil, nil, nil); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("expected completed to be terminal, got %v", err)
+	}
+	open := "open"
+	if _, err := db.UpdateProblem(problem.ID, nil, nil, &open, nil, nil, nil); err != nil {
+		t.Errorf("expected problem workflow to keep its default: %v", err)
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dbTimeLayout is the layout SQLite uses for CURRENT_TIMESTAMP. Dates are
+// stored in UTC in this layout so they compare correctly as text.
+const dbTimeLayout = "2006-01-02 15:04:05"
+
+// DateExamples lists inputs accepted by ParseDate, for help texts
+const DateExamples = "2026-03-01, 2026-03-01T17:00:00+01:00, today, tomorrow, friday, next friday, in 3 days or next week, optionally followed by a time such as 17:00 or 5pm"
+
+// absoluteLayouts are the date formats ParseDate accepts before trying
+// natural language. Layouts without a time are date-only.
+var absoluteLayouts = []struct {
+	layout   string
+	dateOnly bool
+}{
+	{time.RFC3339, false},
+	{"2006-01-02T15:04:05", false},
+	{"2006-01-02T15:04", false},
+	{"2006-01-02 15:04:05", false},
+	{"2006-01-02 15:04", false},
+	{"2006-01-02", true},
+}
+
+var (
+	timeSuffixPattern = regexp.MustCompile(`^(.+?)\s+(?:at\s+)?(\d{1,2})(?::(\d{2}))?\s*(am|pm)?$`)
+	inPattern         = regexp.MustCompile(`^in\s+(\d+)\s+(day|week|month)s?$`)
+)
+
+// ParseDate parses a date in the location of now. Absolute dates may carry
+// their own UTC offset. Natural inputs such as "tomorrow", "friday" (today
+// if it is a Friday), "next friday" (the first Friday after today) and
+// "in 2 weeks" are relative to now. Inputs without a time of day fall at the
+// end of the day when endOfDay is set, as for due dates, and at its start
+// otherwise.
+func ParseDate(input string, now time.Time, endOfDay bool) (time.Time, error) {
+	s := strings.Join(strings.Fields(strings.ToLower(input)), " ")
+	loc := now.Location()
+
+	for _, l := range absoluteLayouts {
+		t, err := time.ParseInLocation(l.layout, s, loc)
+		if err != nil {
+			// Layouts are matched against the lower-cased input
+			t, err = time.ParseInLocation(l.layout, strings.ToUpper(s), loc)
+		}
+		if err == nil {
+			if l.dateOnly {
+				return atTimeOfDay(t, endOfDay), nil
+			}
+			return t, nil
+		}
+	}
+
+	if s == "now" {
+		return now, nil
+	}
+
+	hour, minute := -1, 0
+	if m := timeSuffixPattern.FindStringSubmatch(s); m != nil && (m[3] != "" || m[4] != "" || strings.Contains(s, " at ")) {
+		h, _ := strconv.Atoi(m[2])
+		if m[3] != "" {
+			minute, _ = strconv.Atoi(m[3])
+		}
+		switch {
+		case m[4] != "" && (h < 1 || h > 12):
+			return time.Time{}, invalidDate(input)
+		case m[4] == "pm" && h != 12:
+			h += 12
+		case m[4] == "am" && h == 12:
+			h = 0
+		}
+		if h > 23 || minute > 59 {
+			return time.Time{}, invalidDate(input)
+		}
+		s, hour = m[1], h
+	}
+
+	day, ok := parseRelativeDay(s, now)
+	if !ok {
+		return time.Time{}, invalidDate(input)
+	}
+	if hour >= 0 {
+		return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, loc), nil
+	}
+	return atTimeOfDay(day, endOfDay), nil
+}
+
+// parseRelativeDay returns midnight on the day a natural input refers to
+func parseRelativeDay(s string, now time.Time) (time.Time, bool) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch s {
+	case "today", "tonight":
+		return today, true
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), true
+	case "yesterday":
+		return today.AddDate(0, 0, -1), true
+	case "next week":
+		return today.AddDate(0, 0, 7), true
+	case "next month":
+		return today.AddDate(0, 1, 0), true
+	case "end of month":
+		return time.Date(now.Year(), now.Month()+1, 0, 0, 0, 0, 0, now.Location()), true
+	}
+
+	if m := inPattern.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		switch m[2] {
+		case "day":
+			return today.AddDate(0, 0, n), true
+		case "week":
+			return today.AddDate(0, 0, 7*n), true
+		default:
+			return today.AddDate(0, n, 0), true
+		}
+	}
+
+	next := false
+	if rest, ok := strings.CutPrefix(s, "next "); ok {
+		s, next = rest, true
+	} else if rest, ok := strings.CutPrefix(s, "this "); ok {
+		s = rest
+	}
+	for wd := time.Sunday; wd <= time.Saturday; wd++ {
+		name := strings.ToLower(wd.String())
+		if s != name && s != name[:3] {
+			continue
+		}
+		days := (int(wd) - int(today.Weekday()) + 7) % 7
+		if next && days == 0 {
+			days = 7
+		}
+		return today.AddDate(0, 0, days), true
+	}
+	return time.Time{}, false
+}
+
+// atTimeOfDay moves a date to the start or the last second of its day
+func atTimeOfDay(t time.Time, endOfDay bool) time.Time {
+	if endOfDay {
+		return time.Date(t.Year(), t.Month(), t.Day(), 23, 59, 59, 0, t.Location())
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func invalidDate(input string) error {
+	return fmt.Errorf("%w date %q (expected e.g. %s)", ErrInvalidValue, input, DateExamples)
+}
+
+// SetLocation sets the time zone natural dates such as "tomorrow" are
+// parsed in
+func (d *Database) SetLocation(loc *time.Location) {
+	d.location = loc
+}
+
+// Location returns the time zone dates are parsed in
+func (d *Database) Location() *time.Location {
+	return d.location
+}
+
+// ParseDate parses a start or due date in the database's time zone. See
+// ParseDate for the accepted inputs.
+func (d *Database) ParseDate(input string, endOfDay bool) (time.Time, error) {
+	return ParseDate(input, time.Now().In(d.location), endOfDay)
+}
+
+// ParseDates parses the start and due dates of an item given as text. Nil
+// leaves a date unset, and an empty string is returned as the zero time,
+// which clears the date on update.
+func (d *Database) ParseDates(startAt, dueAt *string) (*time.Time, *time.Time, error) {
+	start, err := d.parseOptionalDate("start_at", startAt, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	due, err := d.parseOptionalDate("due_at", dueAt, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	return start, due, nil
+}
+
+// ParseDueFilter builds a DueFilter from dates given as text. Empty dates
+// are ignored. overdue keeps only open items that are past due.
+func (d *Database) ParseDueFilter(before, after string, overdue bool) (DueFilter, error) {
+	var f DueFilter
+	var err error
+	if before != "" {
+		if f.Before, err = d.parseOptionalDate("due_before", &before, true); err != nil {
+			return f, err
+		}
+	}
+	if after != "" {
+		if f.After, err = d.parseOptionalDate("due_after", &after, false); err != nil {
+			return f, err
+		}
+	}
+	if overdue {
+		now := time.Now()
+		if f.Before == nil || f.Before.After(now) {
+			f.Before = &now
+		}
+		f.Open = true
+	}
+	return f, nil
+}
+
+func (d *Database) parseOptionalDate(field string, s *string, endOfDay bool) (*time.Time, error) {
+	if s == nil {
+		return nil, nil
+	}
+	if *s == "" {
+		return &time.Time{}, nil
+	}
+	t, err := d.ParseDate(*s, endOfDay)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", field, err)
+	}
+	return &t, nil
+}
+
+// dbTime converts an optional date to a column value. Nil and the zero time
+// store NULL.
+func dbTime(t *time.Time) interface{} {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(dbTimeLayout)
+}
+
+// checkDateRange verifies that an item does not start after it is due
+func checkDateRange(startAt, dueAt *time.Time) error {
+	if startAt == nil || dueAt == nil || startAt.IsZero() || dueAt.IsZero() {
+		return nil
+	}
+	if startAt.After(*dueAt) {
+		return fmt.Errorf("%w dates: start_at %s is after due_at %s", ErrInvalidValue, startAt.Format(time.RFC3339), dueAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// firstTime returns the first non-nil date
+func firstTime(values ...*time.Time) *time.Time {
+	for _, v := range values {
+		if v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// doneStatuses are the statuses in which an item is no longer overdue.
+// Goals have no status and are overdue once their due date has passed.
+var doneStatuses = map[string][]string{
+	EntityProject: {"completed", "archived"},
+	EntityTask:    {"completed"},
+	EntityOutcome: {"completed"},
+}
+
+// DueFilter restricts a list to items due in a range, bounds included. Open
+// leaves out items that are done, such as completed tasks.
+type DueFilter struct {
+	Before *time.Time
+	After  *time.Time
+	Open   bool
+}
+
+// apply adds the filter's conditions to a query over entity's table
+func (f DueFilter) apply(q *listQuery, entity string) {
+	if f.Before != nil {
+		q.filter("due_at <= ?", dbTime(f.Before))
+	}
+	if f.After != nil {
+		q.filter("due_at >= ?", dbTime(f.After))
+	}
+	if f.Open {
+		if done := doneStatuses[entity]; len(done) > 0 {
+			q.where = append(q.where, "COALESCE(status, '') NOT IN ('"+strings.Join(done, "', '")+"')")
+		}
+	}
+}
+
+// DueItems groups dated items by type, soonest due first
+type DueItems struct {
+	Projects []*Project `json:"projects"`
+	Tasks    []*Task    `json:"tasks"`
+	Outcomes []*Outcome `json:"outcomes"`
+	Goals    []*Goal    `json:"goals"`
+}
+
+// ListOverdue returns the items whose due date has passed and that are not
+// done
+func (d *Database) ListOverdue() (*DueItems, error) {
+	now := time.Now()
+	return d.listDue(DueFilter{Before: &now, Open: true})
+}
+
+// ListDueSoon returns the items that are not done and are due within the
+// given duration from now
+func (d *Database) ListDueSoon(within time.Duration) (*DueItems, error) {
+	now := time.Now()
+	until := now.Add(within)
+	return d.listDue(DueFilter{After: &now, Before: &until, Open: true})
+}
+
+func (d *Database) listDue(due DueFilter) (*DueItems, error) {
+	opts := ListOptions{Sort: "due_at"}
+	items := &DueItems{}
+	var err error
+	if items.Projects, _, err = d.ListProjectsPage(nil, due, TagFilter{}, opts); err != nil {
+		return nil, err
+	}
+	if items.Tasks, _, err = d.ListTasksPage(nil, nil, nil, nil, nil, due, TagFilter{}, opts); err != nil {
+		return nil, err
+	}
+	if items.Outcomes, _, err = d.ListOutcomesPage(nil, nil, nil, due, TagFilter{}, opts); err != nil {
+		return nil, err
+	}
+	if items.Goals, _, err = d.ListGoalsPage(nil, nil, nil, nil, due, TagFilter{}, opts); err != nil {
+		return nil, err
+	}
+	if items.Projects == nil {
+		items.Projects = []*Project{}
+	}
+	if items.Tasks == nil {
+		items.Tasks = []*Task{}
+	}
+	if items.Outcomes == nil {
+		items.Outcomes = []*Outcome{}
+	}
+	if items.Goals == nil {
+		items.Goals = []*Goal{}
+	}
+	return items, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+	// A Wednesday
+	now := time.Date(2026, 3, 4, 15, 30, 0, 0, loc)
+	day := func(month time.Month, d, hour, minute, sec int) time.Time {
+		return time.Date(2026, month, d, hour, minute, sec, 0, loc)
+	}
+
+	tests := []struct {
+		input    string
+		endOfDay bool
+		want     time.Time
+	}{
+		{"2026-03-10", true, day(3, 10, 23, 59, 59)},
+		{"2026-03-10", false, day(3, 10, 0, 0, 0)},
+		{"2026-03-10 09:15", true, day(3, 10, 9, 15, 0)},
+		{"2026-03-10T17:00:00Z", true, time.Date(2026, 3, 10, 17, 0, 0, 0, time.UTC)},
+		{"now", true, now},
+		{"today", true, day(3, 4, 23, 59, 59)},
+		{"Tomorrow", false, day(3, 5, 0, 0, 0)},
+		{"tomorrow at 9am", true, day(3, 5, 9, 0, 0)},
+		{"tomorrow 17:30", true, day(3, 5, 17, 30, 0)},
+		{"friday 12pm", true, day(3, 6, 12, 0, 0)},
+		{"wednesday", true, day(3, 4, 23, 59, 59)},
+		{"next wednesday", true, day(3, 11, 23, 59, 59)},
+		{"mon", true, day(3, 9, 23, 59, 59)},
+		{"in 3 days", true, day(3, 7, 23, 59, 59)},
+		{"in 2 weeks", true, day(3, 18, 23, 59, 59)},
+		{"next month", true, day(4, 4, 23, 59, 59)},
+		{"end of month", true, day(3, 31, 23, 59, 59)},
+	}
+	for _, tt := range tests {
+		got, err := ParseDate(tt.input, now, tt.endOfDay)
+		if err != nil {
+			t.Errorf("ParseDate(%q): %v", tt.input, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("ParseDate(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{"", "someday", "tomorrow at 25:00", "13pm", "2026-02-30"} {
+		if _, err := ParseDate(input, now, true); !errors.Is(err, ErrInvalidValue) {
+			t.Errorf("expected ErrInvalidValue for %q, got %v", input, err)
+		}
+	}
+}
+
+func TestItemDates(t *testing.T) {
+	db := newTestDatabase(t)
+	startAt, dueAt := "2026-03-01", "2026-03-10"
+	start, due, err := db.ParseDates(&startAt, &dueAt)
+	if err != nil {
+		t.Fatalf("failed to parse dates: %v", err)
+	}
+	project, err := db.CreateProject("P", "", "", "", start, due)
+	if err != nil {
+		t.Fatalf("failed to create project: %v", err)
+	}
+	if project.DueAt == nil || !project.DueAt.Equal(*due) || !project.StartAt.Equal(*start) {
+		t.Fatalf("expected the dates to be stored, got %v and %v", project.StartAt, project.DueAt)
+	}
+
+	// A start after the due date is rejected, whichever of them changes
+	late, _ := db.ParseDate("2026-04-01", false)
+	if _, err := db.UpdateProject(project.ID, nil, nil, nil, nil, &late, nil); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("expected ErrInvalidValue for a start after the due date, got %v", err)
+	}
+	if _, err := db.CreateTask(project.ID, nil, "T", "", "", "", "", "", "", "", &late, due); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("expected ErrInvalidValue creating a task that starts after it is due, got %v", err)
+	}
+
+	// The zero time clears a date
+	cleared, err := db.UpdateProject(project.ID, nil, nil, nil, nil, nil, &time.Time{})
+	if err != nil {
+		t.Fatalf("failed to clear due date: %v", err)
+	}
+	if cleared.DueAt != nil || cleared.StartAt == nil {
+		t.Errorf("expected only the due date to be cleared, got %v and %v", cleared.StartAt, cleared.DueAt)
+	}
+}
+
+func TestListOverdueAndDueSoon(t *testing.T) {
+	db := newTestDatabase(t)
+	now := time.Now()
+	lastWeek, yesterday, tomorrow, nextMonth := now.AddDate(0, 0, -7), now.AddDate(0, 0, -1), now.AddDate(0, 0, 1), now.AddDate(0, 1, 0)
+
+	project, _ := db.CreateProject("P", "", "", "", nil, &yesterday)
+	late, _ := db.CreateTask(project.ID, nil, "Late", "", "", "", "", "", "", "", nil, &lastWeek)
+	db.CreateTask(project.ID, nil, "Done", "", "completed", "", "", "", "", "", nil, &yesterday)
+	soon, _ := db.CreateTask(project.ID, nil, "Soon", "", "", "", "", "", "", "", nil, &tomorrow)
+	db.CreateTask(project.ID, nil, "Later", "", "", "", "", "", "", "", nil, &nextMonth)
+	db.CreateTask(project.ID, nil, "Undated", "", "", "", "", "", "", "", nil, nil)
+	goal, _ := db.CreateGoal(nil, nil, "G", "", "", "", nil, &yesterday)
+
+	overdue, err := db.ListOverdue()
+	if err != nil {
+		t.Fatalf("failed to list overdue items: %v", err)
+	}
+	if len(overdue.Projects) != 1 || len(overdue.Tasks) != 1 || overdue.Tasks[0].ID != late.ID || len(overdue.Goals) != 1 || overdue.Goals[0].ID != goal.ID {
+		t.Errorf("expected the project, the late task and the goal to be overdue, got %+v", overdue)
+	}
+
+	dueSoon, err := db.ListDueSoon(7 * 24 * time.Hour)
+	if err != nil {
+		t.Fatalf("failed to list items due soon: %v", err)
+	}
+	if len(dueSoon.Tasks) != 1 || dueSoon.Tasks[0].ID != soon.ID || len(dueSoon.Projects) != 0 || dueSoon.Outcomes == nil {
+		t.Errorf("expected only the task due tomorrow, got %+v", dueSoon)
+	}
+
+	// Lists sort undated items last
+	tasks, _, err := db.ListTasksPage(nil, nil, nil, nil, nil, DueFilter{}, TagFilter{}, ListOptions{Sort: "due_at"})
+	if err != nil {
+		t.Fatalf("failed to list tasks: %v", err)
+	}
+	if len(tasks) != 5 || tasks[0].ID != late.ID || tasks[4].Title != "Undated" {
+		t.Errorf("expected tasks soonest due first, got %+v", tasks)
+	}
+
+	due, err := db.ParseDueFilter("", "", true)
+	if err != nil {
+		t.Fatalf("failed to parse due filter: %v", err)
+	}
+	if tasks, _, _ = db.ListTasksPage(nil, nil, nil, nil, nil, due, TagFilter{}, ListOptions{}); len(tasks) != 1 || tasks[0].ID != late.ID {
+		t.Errorf("expected the overdue filter to match the late task, got %+v", tasks)
+	}
+}
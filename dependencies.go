@@ -0,0 +1,249 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// taskDependencyIDs selects the IDs of the live tasks a task depends on,
+// optionally only those matching cond
+func taskDependencyIDs(cond string) string {
+	return "(SELECT GROUP_CONCAT(b.id) FROM task_dependencies td JOIN tasks b ON b.id = td.depends_on_id WHERE td.task_id = tasks.id AND b.deleted_at IS NULL" + cond + ")"
+}
+
+// taskColumns are the columns of tasks read by scanTask
+var taskColumns = "id, project_id, parent_task_id, title, description, status, priority, task_type, external_link, " +
+	"assignee_id, " + personName("tasks.assignee_id") + ", reviewer_id, " + personName("tasks.reviewer_id") + ", start_at, due_at, recurrence_id, " +
+	tagColumn(EntityTask, "tasks.id") + ", created_at, updated_at, " + taskDependencyIDs("") + ", " + taskDependencyIDs(" AND b.status != 'completed'")
+
+// taskReady is true for tasks that are not completed and depend only on
+// completed tasks
+var taskReady = "(status != 'completed' AND " + taskDependencyIDs(" AND b.status != 'completed'") + " IS NULL)"
+
+// scanTask scans a row of taskColumns followed by extra
+func scanTask(scan func(dest ...interface{}) error, extra ...interface{}) (*Task, error) {
+	var t Task
+	var dependsOn, blockedBy sql.NullString
+	dest := append([]interface{}{
+		&t.ID, &t.ProjectID, &t.ParentTaskID, &t.Title, &t.Description, &t.Status, &t.Priority, &t.TaskType, &t.ExternalLink, &t.AssigneeID, &t.Assignee, &t.ReviewerID, &t.Reviewer, &t.StartAt, &t.DueAt, &t.RecurrenceID, (*tagList)(&t.Tags), &t.CreatedAt, &t.UpdatedAt,
+		&dependsOn, &blockedBy,
+	}, extra...)
+	if err := scan(dest...); err != nil {
+		return nil, err
+	}
+	t.DependsOn = parseIDList(dependsOn.String)
+	t.BlockedBy = parseIDList(blockedBy.String)
+	t.Ready = t.Status != "completed" && len(t.BlockedBy) == 0
+	return &t, nil
+}
+
+// parseIDList parses a comma-separated list of IDs from GROUP_CONCAT
+func parseIDList(s string) []int64 {
+	ids := []int64{}
+	for _, part := range strings.Split(s, ",") {
+		if id, err := strconv.ParseInt(part, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// DependencyCycleError is returned when adding a dependency would make a
+// task wait on itself. Path is the chain of dependencies from DependsOnID
+// back to TaskID.
+type DependencyCycleError struct {
+	TaskID      int64
+	DependsOnID int64
+	Path        []int64
+}
+
+func (e *DependencyCycleError) Error() string {
+	if e.TaskID == e.DependsOnID {
+		return fmt.Sprintf("task %d can't depend on itself", e.TaskID)
+	}
+	steps := make([]string, len(e.Path))
+	for i, id := range e.Path {
+		steps[i] = strconv.FormatInt(id, 10)
+	}
+	return fmt.Sprintf("task %d can't depend on task %d, which already depends on it (%s)", e.TaskID, e.DependsOnID, strings.Join(steps, " -> "))
+}
+
+// findDependencyPath returns the chain of dependencies from one task to
+// another, or nil if from does not depend on to. Trashed tasks are included
+// so that restoring them can't complete a cycle.
+func (d *Database) findDependencyPath(from, to int64) ([]int64, error) {
+	var path string
+	err := d.db.QueryRow(`
+		WITH RECURSIVE chain(id, path) AS (
+			SELECT ?1, CAST(?1 AS TEXT)
+			UNION ALL
+			SELECT td.depends_on_id, chain.path || ',' || td.depends_on_id
+			FROM task_dependencies td JOIN chain ON td.task_id = chain.id
+		)
+		SELECT path FROM chain WHERE id = ?2 LIMIT 1`,
+		from, to,
+	).Scan(&path)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseIDList(path), nil
+}
+
+// AddTaskDependency records that a task can't start until dependsOnID is
+// completed. Tasks may depend on tasks in other projects, but not on
+// themselves, directly or through other tasks.
+func (d *Database) AddTaskDependency(taskID, dependsOnID int64) error {
+	if err := d.checkTaskProject(EntityTask, nil, &taskID); err != nil {
+		return err
+	}
+	if err := d.checkTaskProject(EntityTask, nil, &dependsOnID); err != nil {
+		return err
+	}
+	path, err := d.findDependencyPath(dependsOnID, taskID)
+	if err != nil {
+		return err
+	}
+	if path != nil {
+		return &DependencyCycleError{TaskID: taskID, DependsOnID: dependsOnID, Path: path}
+	}
+
+	before, err := d.GetTask(taskID)
+	if err != nil {
+		return err
+	}
+	result, err := d.db.Exec(
+		"INSERT OR IGNORE INTO task_dependencies (task_id, depends_on_id) VALUES (?, ?)",
+		taskID, dependsOnID,
+	)
+	if err != nil {
+		return err
+	}
+	// Adding a dependency twice is a no-op and does not produce an event
+	if rows, err := result.RowsAffected(); err == nil && rows > 0 {
+		d.publish(ActionCreated, EntityTaskDependency, taskID, nil, map[string]int64{"task_id": taskID, "depends_on_id": dependsOnID})
+		d.publishTaskChange(before)
+	}
+	return nil
+}
+
+// RemoveTaskDependency removes a dependency added by AddTaskDependency
+func (d *Database) RemoveTaskDependency(taskID, dependsOnID int64) error {
+	before, err := d.GetTask(taskID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	result, err := d.db.Exec(
+		"DELETE FROM task_dependencies WHERE task_id = ? AND depends_on_id = ?",
+		taskID, dependsOnID,
+	)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("dependency of task %d on task %d %w", taskID, dependsOnID, ErrNotFound)
+	}
+	link := map[string]int64{"task_id": taskID, "depends_on_id": dependsOnID}
+	d.publish(ActionDeleted, EntityTaskDependency, taskID, link, link)
+	if before != nil {
+		d.publishTaskChange(before)
+	}
+	return nil
+}
+
+// GetTaskDependencies returns the tasks a task depends on
+func (d *Database) GetTaskDependencies(taskID int64) ([]*Task, error) {
+	return d.queryTasks("SELECT "+taskColumns+" FROM tasks WHERE deleted_at IS NULL AND id IN (SELECT depends_on_id FROM task_dependencies WHERE task_id = ?) ORDER BY id", taskID)
+}
+
+// GetTaskDependents returns the tasks that depend on a task
+func (d *Database) GetTaskDependents(taskID int64) ([]*Task, error) {
+	return d.queryTasks("SELECT "+taskColumns+" FROM tasks WHERE deleted_at IS NULL AND id IN (SELECT task_id FROM task_dependencies WHERE depends_on_id = ?) ORDER BY id", taskID)
+}
+
+func (d *Database) queryTasks(query string, args ...interface{}) ([]*Task, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := []*Task{}
+	for rows.Next() {
+		t, err := scanTask(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
+// TaskBlockers explains why a task is or isn't ready. Blockers are the tasks
+// it depends on that are not completed, and Blocking the tasks that wait on
+// it.
+type TaskBlockers struct {
+	Task     *Task   `json:"task"`
+	Ready    bool    `json:"ready"`
+	Blockers []*Task `json:"blockers"`
+	Blocking []*Task `json:"blocking"`
+}
+
+// GetTaskBlockers returns the unfinished tasks that block a task and the
+// tasks it blocks
+func (d *Database) GetTaskBlockers(taskID int64) (*TaskBlockers, error) {
+	task, err := d.GetTask(taskID)
+	if err != nil {
+		return nil, err
+	}
+	dependencies, err := d.GetTaskDependencies(taskID)
+	if err != nil {
+		return nil, err
+	}
+	dependents, err := d.GetTaskDependents(taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &TaskBlockers{Task: task, Ready: task.Ready, Blockers: []*Task{}, Blocking: []*Task{}}
+	for _, t := range dependencies {
+		if t.Status != "completed" {
+			b.Blockers = append(b.Blockers, t)
+		}
+	}
+	if task.Status != "completed" {
+		b.Blocking = dependents
+	}
+	return b, nil
+}
+
+// publishTaskChange sends an update event for a task whose dependencies
+// changed, if that changed which tasks block it
+func (d *Database) publishTaskChange(before *Task) {
+	after, err := d.GetTask(before.ID)
+	if err != nil {
+		return
+	}
+	if after.Ready != before.Ready || fmt.Sprint(after.DependsOn, after.BlockedBy) != fmt.Sprint(before.DependsOn, before.BlockedBy) {
+		d.publish(ActionUpdated, EntityTask, after.ID, before, after)
+	}
+}
+
+// publishDependentChanges sends update events for the dependents of a task
+// that was completed, reopened or deleted. dependents are as they were
+// before the change.
+func (d *Database) publishDependentChanges(dependents []*Task) {
+	for _, t := range dependents {
+		d.publishTaskChange(t)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTaskDependencies(t *testing.T) {
+	db := newTestDatabase(t)
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	other, _ := db.CreateProject("Other", "", "", "", nil, nil)
+	design, _ := db.CreateTask(project.ID, nil, "Design", "", "", "", "", "", "", "", nil, nil)
+	build, _ := db.CreateTask(project.ID, nil, "Build", "", "", "", "", "", "", "", nil, nil)
+	review, _ := db.CreateTask(other.ID, nil, "Security review", "", "", "", "", "", "", "", nil, nil)
+
+	for _, dep := range [][2]int64{{build.ID, design.ID}, {build.ID, review.ID}} {
+		if err := db.AddTaskDependency(dep[0], dep[1]); err != nil {
+			t.Fatalf("failed to add dependency: %v", err)
+		}
+	}
+	// Adding a dependency twice is a no-op
+	if err := db.AddTaskDependency(build.ID, design.ID); err != nil {
+		t.Fatalf("failed to add dependency again: %v", err)
+	}
+
+	loaded, _ := db.GetTask(build.ID)
+	if loaded.Ready || len(loaded.DependsOn) != 2 || len(loaded.BlockedBy) != 2 {
+		t.Fatalf("expected build to wait on 2 tasks, got %+v", loaded)
+	}
+
+	completed := "completed"
+	if _, err := db.UpdateTask(design.ID, nil, nil, &completed, nil, nil, nil, nil, nil, nil, nil, nil); err != nil {
+		t.Fatalf("failed to complete task: %v", err)
+	}
+	blockers, err := db.GetTaskBlockers(build.ID)
+	if err != nil {
+		t.Fatalf("failed to get blockers: %v", err)
+	}
+	if blockers.Ready || len(blockers.Blockers) != 1 || blockers.Blockers[0].ID != review.ID {
+		t.Fatalf("expected only the review to block, got %+v", blockers)
+	}
+
+	if _, err := db.UpdateTask(review.ID, nil, nil, &completed, nil, nil, nil, nil, nil, nil, nil, nil); err != nil {
+		t.Fatalf("failed to complete task: %v", err)
+	}
+	ready := true
+	tasks, _, err := db.ListTasksPage(nil, nil, nil, nil, &ready, DueFilter{}, TagFilter{}, ListOptions{})
+	if err != nil {
+		t.Fatalf("failed to list ready tasks: %v", err)
+	}
+	if len(tasks) != 1 || tasks[0].ID != build.ID || len(tasks[0].BlockedBy) != 0 {
+		t.Errorf("expected build to be the only ready task, got %+v", tasks)
+	}
+
+	if err := db.RemoveTaskDependency(build.ID, review.ID); err != nil {
+		t.Fatalf("failed to remove dependency: %v", err)
+	}
+	if err := db.RemoveTaskDependency(build.ID, review.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound removing twice, got %v", err)
+	}
+	if dependencies, _ := db.GetTaskDependencies(build.ID); len(dependencies) != 1 {
+		t.Errorf("expected 1 dependency left, got %d", len(dependencies))
+	}
+}
+
+func TestTaskDependencyCycles(t *testing.T) {
+	db := newTestDatabase(t)
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	a, _ := db.CreateTask(project.ID, nil, "A", "", "", "", "", "", "", "", nil, nil)
+	b, _ := db.CreateTask(project.ID, nil, "B", "", "", "", "", "", "", "", nil, nil)
+	c, _ := db.CreateTask(project.ID, nil, "C", "", "", "", "", "", "", "", nil, nil)
+
+	db.AddTaskDependency(b.ID, a.ID)
+	db.AddTaskDependency(c.ID, b.ID)
+
+	var cycle *DependencyCycleError
+	if err := db.AddTaskDependency(a.ID, c.ID); !errors.As(err, &cycle) {
+		t.Fatalf("expected a cycle error, got %v", err)
+	}
+	if len(cycle.Path) != 3 || cycle.Path[0] != c.ID || cycle.Path[2] != a.ID {
+		t.Errorf("expected path c -> b -> a, got %v", cycle.Path)
+	}
+	if err := db.AddTaskDependency(a.ID, a.ID); !errors.As(err, &cycle) {
+		t.Errorf("expected a cycle error for a self-dependency, got %v", err)
+	}
+	if err := db.AddTaskDependency(a.ID, 999); !errors.Is(err, ErrInvalidReference) {
+		t.Errorf("expected ErrInvalidReference for a missing task, got %v", err)
+	}
+
+	// A trashed blocker no longer blocks
+	if err := db.DeleteTask(b.ID); err != nil {
+		t.Fatalf("failed to delete task: %v", err)
+	}
+	if loaded, _ := db.GetTask(c.ID); !loaded.Ready {
+		t.Errorf("expected c to be ready once b is trashed, got %+v", loaded)
+	}
+}
+
+func TestTaskDependencyEvents(t *testing.T) {
+	db := newTestDatabase(t)
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	first, _ := db.CreateTask(project.ID, nil, "First", "", "", "", "", "", "", "", nil, nil)
+	second, _ := db.CreateTask(project.ID, nil, "Second", "", "", "", "", "", "", "", nil, nil)
+	db.AddTaskDependency(second.ID, first.ID)
+
+	var events []ChangeEvent
+	db.Subscribe(func(e ChangeEvent) { events = append(events, e) })
+
+	completed := "completed"
+	db.UpdateTask(first.ID, nil, nil, &completed, nil, nil, nil, nil, nil, nil, nil, nil)
+
+	if len(events) != 2 || events[1].ID != second.ID || !events[1].Data.(*Task).Ready {
+		t.Fatalf("expected an update for the unblocked task, got %+v", events)
+	}
+	// The readiness change is not a change of the task's own fields
+	if history := listHistory(t, db, EntityTask, second.ID); len(history) != 1 {
+		t.Errorf("expected only the create in history, got %+v", history)
+	}
+}
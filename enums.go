@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrInvalidValue is wrapped by errors returned when a status, priority or
+// type is not one of the allowed values for its field.
+var ErrInvalidValue = errors.New("invalid")
+
+// ErrInvalidTransition is wrapped by errors returned when a status change is
+// not allowed by the entity's workflow.
+var ErrInvalidTransition = errors.New("transition not allowed")
+
+// Allowed values for enumerated fields
+var (
+	ProjectStatuses = []string{"active", "planning", "on_hold", "completed", "archived"}
+	TaskStatuses    = []string{"pending", "in_progress", "completed", "blocked"}
+	TaskPriorities  = []string{"low", "medium", "high", "urgent"}
+	TaskTypes       = []string{"general", "feature", "bugfix", "chore", "investigation"}
+	ProblemStatuses = []string{"open", "in_progress", "resolved", "blocked"}
+	OutcomeStatuses = []string{"open", "in_progress", "completed", "blocked"}
+	GoalTypes       = []string{"short_term", "career", "values", "requirement"}
+)
+
+// entityStatuses maps each entity with a status workflow to its statuses
+var entityStatuses = map[string][]string{
+	EntityProject: ProjectStatuses,
+	EntityTask:    TaskStatuses,
+	EntityProblem: ProblemStatuses,
+	EntityOutcome: OutcomeStatuses,
+}
+
+// Defaults are the values new items get for the enumerated fields they are
+// created without
+type Defaults struct {
+	ProjectStatus string `toml:"project_status"`
+	TaskStatus    string `toml:"task_status"`
+	TaskPriority  string `toml:"task_priority"`
+	TaskType      string `toml:"task_type"`
+	ProblemStatus string `toml:"problem_status"`
+	OutcomeStatus string `toml:"outcome_status"`
+	GoalType      string `toml:"goal_type"`
+}
+
+// DefaultDefaults returns the built-in defaults
+func DefaultDefaults() Defaults {
+	return Defaults{
+		ProjectStatus: "active",
+		TaskStatus:    "pending",
+		TaskPriority:  "medium",
+		TaskType:      "general",
+		ProblemStatus: "open",
+		OutcomeStatus: "open",
+		GoalType:      "short_term",
+	}
+}
+
+func (d Defaults) validate() error {
+	for _, f := range []struct {
+		field   string
+		value   string
+		allowed []string
+	}{
+		{"default project status", d.ProjectStatus, ProjectStatuses},
+		{"default task status", d.TaskStatus, TaskStatuses},
+		{"default task priority", d.TaskPriority, TaskPriorities},
+		{"default task type", d.TaskType, TaskTypes},
+		{"default problem status", d.ProblemStatus, ProblemStatuses},
+		{"default outcome status", d.OutcomeStatus, OutcomeStatuses},
+		{"default goal type", d.GoalType, GoalTypes},
+	} {
+		if err := validateEnum(f.field, f.value, f.allowed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateEnum checks that value is one of allowed
+func validateEnum(field, value string, allowed []string) error {
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w %s %q (expected one of: %s)", ErrInvalidValue, field, value, strings.Join(allowed, ", "))
+}
+
+// validateOptionalEnum validates value if it is set
+func validateOptionalEnum(field string, value *string, allowed []string) error {
+	if value == nil {
+		return nil
+	}
+	return validateEnum(field, *value, allowed)
+}
+
+// Workflow maps a status to the statuses it may change to. Staying in the
+// same status is always allowed.
+type Workflow map[string][]string
+
+// DefaultWorkflows returns the built-in status workflows. Work that is
+// finished can be reopened, but not sent straight back to the start.
+func DefaultWorkflows() map[string]Workflow {
+	return map[string]Workflow{
+		EntityProject: {
+			"planning":  {"active", "on_hold", "archived"},
+			"active":    {"planning", "on_hold", "completed", "archived"},
+			"on_hold":   {"active", "planning", "archived"},
+			"completed": {"active", "archived"},
+			"archived":  {"active"},
+		},
+		EntityTask: {
+			"pending":     {"in_progress", "blocked", "completed"},
+			"in_progress": {"pending", "blocked", "completed"},
+			"blocked":     {"pending", "in_progress", "completed"},
+			"completed":   {"in_progress"},
+		},
+		EntityProblem: {
+			"open":        {"in_progress", "blocked", "resolved"},
+			"in_progress": {"open", "blocked", "resolved"},
+			"blocked":     {"open", "in_progress", "resolved"},
+			"resolved":    {"open"},
+		},
+		EntityOutcome: {
+			"open":        {"in_progress", "blocked", "completed"},
+			"in_progress": {"open", "blocked", "completed"},
+			"blocked":     {"open", "in_progress", "completed"},
+			"completed":   {"in_progress"},
+		},
+	}
+}
+
+// LoadWorkflows reads workflow overrides from a JSON file keyed by entity,
+// e.g. {"task": {"pending": ["in_progress"], "in_progress": ["completed"]}}.
+// Pass the result to Database.SetWorkflows, which validates it; an entity
+// present in the file replaces its default workflow entirely.
+func LoadWorkflows(path string) (map[string]Workflow, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workflow file: %w", err)
+	}
+
+	var workflows map[string]Workflow
+	if err := json.Unmarshal(data, &workflows); err != nil {
+		return nil, fmt.Errorf("failed to parse workflow file: %w", err)
+	}
+	return workflows, nil
+}
+
+func (w Workflow) validate(entity string) error {
+	statuses, ok := entityStatuses[entity]
+	if !ok {
+		return fmt.Errorf("%w workflow entity %q (expected one of: project, task, problem, outcome)", ErrInvalidValue, entity)
+	}
+	for from, targets := range w {
+		if err := validateEnum(entity+" status", from, statuses); err != nil {
+			return err
+		}
+		for _, to := range targets {
+			if err := validateEnum(entity+" status", to, statuses); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkTransition reports whether the workflow allows moving from one status
+// to another. A status the workflow does not list, including values written
+// before validation existed, may move to any valid status.
+func (w Workflow) checkTransition(entity, from, to string) error {
+	if from == to {
+		return nil
+	}
+	targets, ok := w[from]
+	if !ok {
+		return nil
+	}
+	for _, t := range targets {
+		if t == to {
+			return nil
+		}
+	}
+	allowed := "none"
+	if len(targets) > 0 {
+		allowed = strings.Join(targets, ", ")
+	}
+	return fmt.Errorf("%s status %w: %s -> %s (allowed from %s: %s)", entity, ErrInvalidTransition, from, to, from, allowed)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetWorkflowsValidation(t *testing.T) {
+	db := newTestDatabase(t)
+
+	tests := []struct {
+		name      string
+		workflows map[string]Workflow
+	}{
+		{"unknown entity", map[string]Workflow{"goal": {}}},
+		{"unknown from status", map[string]Workflow{EntityTask: {"done": {"pending"}}}},
+		{"unknown target status", map[string]Workflow{EntityProject: {"active": {"closed"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := db.SetWorkflows(tt.workflows); !errors.Is(err, ErrInvalidValue) {
+				t.Errorf("expected ErrInvalidValue, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadWorkflows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "workflow.json")
+	if err := os.WriteFile(path, []byte(`{"task": {"pending": ["in_progress"]}}`), 0644); err != nil {
+		t.Fatalf("failed to write workflow file: %v", err)
+	}
+
+	workflows, err := LoadWorkflows(path)
+	if err != nil {
+		t.Fatalf("failed to load workflows: %v", err)
+	}
+	if got := workflows[EntityTask]["pending"]; len(got) != 1 || got[0] != "in_progress" {
+		t.Errorf("unexpected workflow: %+v", workflows)
+	}
+
+	os.WriteFile(path, []byte(`{`), 0644)
+	if _, err := LoadWorkflows(path); err == nil {
+		t.Error("expected error for invalid JSON")
+	}
+}
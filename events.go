@@ -0,0 +1,87 @@
+package main
+
+import "sync"
+
+// Change event actions
+const (
+	ActionCreated  = "created"
+	ActionUpdated  = "updated"
+	ActionDeleted  = "deleted"
+	ActionRestored = "restored"
+	ActionPurged   = "purged"
+	ActionImported = "imported"
+)
+
+// Entity types named in change events
+const (
+	EntityProject        = "project"
+	EntityTask           = "task"
+	EntityProblem        = "problem"
+	EntityOutcome        = "outcome"
+	EntityGoal           = "goal"
+	EntityTaskNote       = "task_note"
+	EntityGoalProject    = "goal_project"
+	EntityProblemProject = "problem_project"
+	EntityTaskDependency = "task_dependency"
+	EntityTaskRecurrence = "task_recurrence"
+	EntityTag            = "tag"
+	EntityPerson         = "person"
+	EntityWorkspace      = "workspace"
+)
+
+// ChangeEvent describes a single mutation made through the Database. Data
+// holds the entity as it is after the change, and is omitted for deletes.
+// Actor identifies who made the change, if known.
+// Deleting an entity moves it to the trash along with its dependents, and
+// restoring it brings them back; those rows do not get events of their own.
+// Purged events are sent when items are removed from the trash for good.
+// Importing a workspace sends a single imported event, with the number of
+// items of each type created as data, rather than one per item.
+type ChangeEvent struct {
+	Action string      `json:"action"`
+	Entity string      `json:"entity"`
+	ID     int64       `json:"id"`
+	Data   interface{} `json:"data,omitempty"`
+	Actor  string      `json:"actor,omitempty"`
+}
+
+// EventBus fans change events out to subscribers. Subscribers are called
+// synchronously from the goroutine that made the change, so they must not
+// block or call back into the Database.
+type EventBus struct {
+	mu          sync.RWMutex
+	subscribers map[int]func(ChangeEvent)
+	nextID      int
+}
+
+// NewEventBus creates an event bus with no subscribers
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: make(map[int]func(ChangeEvent))}
+}
+
+// Subscribe registers fn to receive every published event and returns a
+// function that removes the subscription.
+func (b *EventBus) Subscribe(fn func(ChangeEvent)) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	b.subscribers[id] = fn
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers, id)
+	}
+}
+
+// Publish delivers an event to all subscribers
+func (b *EventBus) Publish(event ChangeEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, fn := range b.subscribers {
+		fn(event)
+	}
+}
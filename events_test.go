@@ -0,0 +1,147 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// recordEvents subscribes to db and returns a pointer to the recorded events.
+func recordEvents(t *testing.T, db *Database) *[]ChangeEvent {
+	t.Helper()
+
+	var events []ChangeEvent
+	unsubscribe := db.Subscribe(func(event ChangeEvent) {
+		events = append(events, event)
+	})
+	t.Cleanup(unsubscribe)
+	return &events
+}
+
+func TestEventBusSubscribeAndUnsubscribe(t *testing.T) {
+	bus := NewEventBus()
+
+	var first, second int
+	unsubscribeFirst := bus.Subscribe(func(ChangeEvent) { first++ })
+	bus.Subscribe(func(ChangeEvent) { second++ })
+
+	bus.Publish(ChangeEvent{Action: ActionCreated, Entity: EntityProject, ID: 1})
+	unsubscribeFirst()
+	bus.Publish(ChangeEvent{Action: ActionDeleted, Entity: EntityProject, ID: 1})
+
+	if first != 1 {
+		t.Errorf("expected first subscriber to get 1 event, got %d", first)
+	}
+	if second != 2 {
+		t.Errorf("expected second subscriber to get 2 events, got %d", second)
+	}
+}
+
+func TestDatabaseEmitsChangeEvents(t *testing.T) {
+	db := newTestDatabase(t)
+	events := recordEvents(t, db)
+
+	project, err := db.CreateProject("Project", "", "", "", nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create project: %v", err)
+	}
+	task, _ := db.CreateTask(project.ID, nil, "Task", "", "pending", "medium", "", "", "", "", nil, nil)
+	title := "Renamed"
+	db.UpdateTask(task.ID, &title, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	note, _ := db.CreateTaskNote(task.ID, "note")
+	db.DeleteTaskNote(note.ID)
+	db.DeleteTask(task.ID)
+
+	expected := []struct {
+		action string
+		entity string
+		id     int64
+	}{
+		{ActionCreated, EntityProject, project.ID},
+		{ActionCreated, EntityTask, task.ID},
+		{ActionUpdated, EntityTask, task.ID},
+		{ActionCreated, EntityTaskNote, note.ID},
+		{ActionDeleted, EntityTaskNote, note.ID},
+		{ActionDeleted, EntityTask, task.ID},
+	}
+
+	if len(*events) != len(expected) {
+		t.Fatalf("expected %d events, got %d: %+v", len(expected), len(*events), *events)
+	}
+	for i, want := range expected {
+		got := (*events)[i]
+		if got.Action != want.action || got.Entity != want.entity || got.ID != want.id {
+			t.Errorf("event %d: expected %s %s %d, got %s %s %d", i, want.action, want.entity, want.id, got.Action, got.Entity, got.ID)
+		}
+	}
+
+	updated, ok := (*events)[2].Data.(*Task)
+	if !ok || updated.Title != "Renamed" {
+		t.Errorf("expected updated task payload, got %#v", (*events)[2].Data)
+	}
+	if (*events)[5].Data != nil {
+		t.Errorf("expected no payload on delete, got %#v", (*events)[5].Data)
+	}
+}
+
+func TestDatabaseSkipsEventsForNoOps(t *testing.T) {
+	db := newTestDatabase(t)
+	project, _ := db.CreateProject("Project", "", "", "", nil, nil)
+	goal, _ := db.CreateGoal(nil, nil, "Goal", "", "", "", nil, nil)
+	db.LinkGoalToProject(goal.ID, project.ID)
+
+	events := recordEvents(t, db)
+
+	// Updates without fields, repeated links and failed deletes change nothing
+	db.UpdateProject(project.ID, nil, nil, nil, nil, nil, nil)
+	db.LinkGoalToProject(goal.ID, project.ID)
+	db.DeleteProblem(9999)
+	title := "x"
+	db.UpdateOutcome(9999, &title, nil, nil, nil, nil, nil, nil)
+
+	if len(*events) != 0 {
+		t.Fatalf("expected no events, got %+v", *events)
+	}
+
+	db.UnlinkGoalFromProject(goal.ID, project.ID)
+	if len(*events) != 1 || (*events)[0].Entity != EntityGoalProject || (*events)[0].Action != ActionDeleted {
+		t.Errorf("expected goal_project deleted event, got %+v", *events)
+	}
+}
+
+func TestWebServerBroadcastsChangeEvents(t *testing.T) {
+	ws, db, cleanup := setupTestWebServer(t)
+	defer cleanup()
+
+	clientChan := make(chan string, 10)
+	ws.clientsMux.Lock()
+	ws.clients[clientChan] = true
+	ws.clientsMux.Unlock()
+
+	project, _ := db.CreateProject("Broadcast Project", "", "", "", nil, nil)
+
+	select {
+	case msg := <-clientChan:
+		if !contains(msg, "event: change") {
+			t.Errorf("expected change event, got: %s", msg)
+		}
+		if !contains(msg, `"action":"created"`) || !contains(msg, `"entity":"project"`) {
+			t.Errorf("expected created project event, got: %s", msg)
+		}
+		if !contains(msg, `"name":"Broadcast Project"`) {
+			t.Errorf("expected project payload, got: %s", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for change event")
+	}
+
+	db.DeleteProject(project.ID)
+	msg := <-clientChan
+	if !contains(msg, `"action":"deleted"`) || contains(msg, `"data"`) {
+		t.Errorf("expected deleted event without data, got: %s", msg)
+	}
+
+	ws.clientsMux.Lock()
+	delete(ws.clients, clientChan)
+	close(clientChan)
+	ws.clientsMux.Unlock()
+}
@@ -0,0 +1,1137 @@
+package main
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExportFormats are the formats a workspace can be exported in. Only JSON
+// exports can be imported again.
+var ExportFormats = []string{"json", "csv", "markdown"}
+
+// exportContentTypes and exportExtensions describe the file each export
+// format is written as
+var (
+	exportContentTypes = map[string]string{"json": "application/json", "csv": "application/zip", "markdown": "text/markdown; charset=utf-8"}
+	exportExtensions   = map[string]string{"json": ".json", "csv": ".zip", "markdown": ".md"}
+)
+
+// exportFormatVersion is the version of the Workspace layout. It changes
+// when an export could no longer be imported the same way.
+const exportFormatVersion = 1
+
+// Workspace is everything in a database, or in one project of it, as it is
+// exported and imported. Task dependencies travel in each task's DependsOn
+// and tags in each item's Tags. Recurrences, activity, the trash and API
+// tokens are left out, and tasks lose their link to the recurrence that
+// created them.
+type Workspace struct {
+	Format          int              `json:"format"`
+	SchemaVersion   int              `json:"schema_version"`
+	ExportedAt      time.Time        `json:"exported_at"`
+	ProjectID       *int64           `json:"project_id,omitempty"`
+	People          []*Person        `json:"people"`
+	Tags            []*Tag           `json:"tags"`
+	Projects        []*Project       `json:"projects"`
+	Tasks           []*Task          `json:"tasks"`
+	TaskNotes       []*TaskNote      `json:"task_notes"`
+	Problems        []*Problem       `json:"problems"`
+	Outcomes        []*Outcome       `json:"outcomes"`
+	Goals           []*Goal          `json:"goals"`
+	ProblemProjects []ProblemProject `json:"problem_projects"`
+	GoalProjects    []GoalProject    `json:"goal_projects"`
+}
+
+// ProblemProject links a problem to a project other than its own
+type ProblemProject struct {
+	ProblemID int64 `json:"problem_id"`
+	ProjectID int64 `json:"project_id"`
+}
+
+// GoalProject links a goal to a project other than its own
+type GoalProject struct {
+	GoalID    int64 `json:"goal_id"`
+	ProjectID int64 `json:"project_id"`
+}
+
+// ImportResult counts the items an import created, by entity, and maps the
+// IDs they had in the export to the IDs they were given
+type ImportResult struct {
+	Created map[string]int             `json:"created"`
+	IDs     map[string]map[int64]int64 `json:"ids"`
+}
+
+// ExportWorkspace exports every live item, or only the project with the
+// given ID. A project's export holds its tasks and their notes, its
+// outcomes, the problems and goals that belong or are linked to it, and the
+// people and tags they use; references to anything else are dropped.
+func (d *Database) ExportWorkspace(projectID *int64) (*Workspace, error) {
+	version, err := d.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	w := &Workspace{Format: exportFormatVersion, SchemaVersion: version, ExportedAt: time.Now().UTC(), ProjectID: projectID}
+
+	all := ListOptions{Sort: "id", Order: "asc"}
+	if projectID != nil {
+		project, err := d.GetProject(*projectID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("project with ID %d %w", *projectID, ErrNotFound)
+		}
+		if err != nil {
+			return nil, err
+		}
+		w.Projects = []*Project{project}
+	} else if w.Projects, _, err = d.ListProjectsPage(nil, DueFilter{}, TagFilter{}, all); err != nil {
+		return nil, err
+	}
+	if w.Tasks, _, err = d.ListTasksPage(projectID, nil, nil, nil, nil, DueFilter{}, TagFilter{}, all); err != nil {
+		return nil, err
+	}
+	if w.Problems, _, err = d.ListProblemsPage(nil, nil, nil, nil, TagFilter{}, all); err != nil {
+		return nil, err
+	}
+	if w.Outcomes, _, err = d.ListOutcomesPage(projectID, nil, nil, DueFilter{}, TagFilter{}, all); err != nil {
+		return nil, err
+	}
+	if w.Goals, _, err = d.ListGoalsPage(nil, nil, nil, nil, DueFilter{}, TagFilter{}, all); err != nil {
+		return nil, err
+	}
+	if w.People, err = d.ListPeople(nil); err != nil {
+		return nil, err
+	}
+	if w.Tags, err = d.ListTags(nil); err != nil {
+		return nil, err
+	}
+	if w.TaskNotes, err = d.exportTaskNotes(); err != nil {
+		return nil, err
+	}
+	if w.ProblemProjects, w.GoalProjects, err = d.exportProjectLinks(); err != nil {
+		return nil, err
+	}
+
+	if projectID != nil {
+		w.scopeToProject(*projectID)
+	}
+	w.dropDanglingReferences()
+	return w, nil
+}
+
+// exportTaskNotes lists the notes of live tasks, oldest first
+func (d *Database) exportTaskNotes() ([]*TaskNote, error) {
+	rows, err := d.db.Query(`
+		SELECT n.id, n.task_id, n.note, n.created_at, n.updated_at FROM task_notes n
+		JOIN tasks t ON t.id = n.task_id AND t.deleted_at IS NULL
+		WHERE n.deleted_at IS NULL ORDER BY n.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notes []*TaskNote
+	for rows.Next() {
+		var note TaskNote
+		if err := rows.Scan(&note.ID, &note.TaskID, &note.Note, &note.CreatedAt, &note.UpdatedAt); err != nil {
+			return nil, err
+		}
+		notes = append(notes, &note)
+	}
+	return notes, rows.Err()
+}
+
+// exportProjectLinks lists the links between live problems and goals and
+// the live projects they are linked to
+func (d *Database) exportProjectLinks() ([]ProblemProject, []GoalProject, error) {
+	var problemLinks []ProblemProject
+	var goalLinks []GoalProject
+	for _, l := range []struct {
+		table, column, items string
+		add                  func(itemID, projectID int64)
+	}{
+		{"problem_projects", "problem_id", "problems", func(itemID, projectID int64) {
+			problemLinks = append(problemLinks, ProblemProject{itemID, projectID})
+		}},
+		{"goal_projects", "goal_id", "goals", func(itemID, projectID int64) {
+			goalLinks = append(goalLinks, GoalProject{itemID, projectID})
+		}},
+	} {
+		rows, err := d.db.Query(fmt.Sprintf(`
+			SELECT l.%[2]s, l.project_id FROM %[1]s l
+			JOIN %[3]s i ON i.id = l.%[2]s AND i.deleted_at IS NULL
+			JOIN projects p ON p.id = l.project_id AND p.deleted_at IS NULL
+			ORDER BY l.%[2]s, l.project_id`, l.table, l.column, l.items))
+		if err != nil {
+			return nil, nil, err
+		}
+		for rows.Next() {
+			var itemID, projectID int64
+			if err := rows.Scan(&itemID, &projectID); err != nil {
+				rows.Close()
+				return nil, nil, err
+			}
+			l.add(itemID, projectID)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return problemLinks, goalLinks, nil
+}
+
+// scopeToProject keeps only what belongs to the project, and the people and
+// tags that it uses
+func (w *Workspace) scopeToProject(projectID int64) {
+	w.ProblemProjects = slices.DeleteFunc(w.ProblemProjects, func(l ProblemProject) bool { return l.ProjectID != projectID })
+	w.GoalProjects = slices.DeleteFunc(w.GoalProjects, func(l GoalProject) bool { return l.ProjectID != projectID })
+	linkedProblems, linkedGoals := map[int64]bool{}, map[int64]bool{}
+	for _, l := range w.ProblemProjects {
+		linkedProblems[l.ProblemID] = true
+	}
+	for _, l := range w.GoalProjects {
+		linkedGoals[l.GoalID] = true
+	}
+	inProject := func(id *int64) bool { return id != nil && *id == projectID }
+
+	w.Problems = slices.DeleteFunc(w.Problems, func(p *Problem) bool { return !inProject(p.ProjectID) && !linkedProblems[p.ID] })
+	w.Goals = slices.DeleteFunc(w.Goals, func(g *Goal) bool { return !inProject(g.ProjectID) && !linkedGoals[g.ID] })
+	tasks := w.ids(EntityTask)
+	w.TaskNotes = slices.DeleteFunc(w.TaskNotes, func(n *TaskNote) bool { return !tasks[n.TaskID] })
+
+	people, tags := map[int64]bool{}, map[string]bool{}
+	usePerson := func(id *int64) {
+		if id != nil {
+			people[*id] = true
+		}
+	}
+	useTags := func(names []string) {
+		for _, name := range names {
+			tags[name] = true
+		}
+	}
+	for _, p := range w.Projects {
+		useTags(p.Tags)
+	}
+	for _, t := range w.Tasks {
+		usePerson(t.AssigneeID)
+		usePerson(t.ReviewerID)
+		useTags(t.Tags)
+	}
+	for _, p := range w.Problems {
+		usePerson(p.AssigneeID)
+		useTags(p.Tags)
+	}
+	for _, o := range w.Outcomes {
+		useTags(o.Tags)
+	}
+	for _, g := range w.Goals {
+		usePerson(g.AssigneeID)
+		useTags(g.Tags)
+	}
+	w.People = slices.DeleteFunc(w.People, func(p *Person) bool { return !people[p.ID] })
+	w.Tags = slices.DeleteFunc(w.Tags, func(t *Tag) bool { return !tags[t.Name] })
+}
+
+// ids returns the set of IDs of the workspace's items of one type
+func (w *Workspace) ids(entity string) map[int64]bool {
+	ids := map[int64]bool{}
+	switch entity {
+	case EntityPerson:
+		for _, p := range w.People {
+			ids[p.ID] = true
+		}
+	case EntityProject:
+		for _, p := range w.Projects {
+			ids[p.ID] = true
+		}
+	case EntityTask:
+		for _, t := range w.Tasks {
+			ids[t.ID] = true
+		}
+	case EntityProblem:
+		for _, p := range w.Problems {
+			ids[p.ID] = true
+		}
+	case EntityGoal:
+		for _, g := range w.Goals {
+			ids[g.ID] = true
+		}
+	}
+	return ids
+}
+
+// dropDanglingReferences clears the references to items that were left out
+// of the export
+func (w *Workspace) dropDanglingReferences() {
+	people, projects, tasks := w.ids(EntityPerson), w.ids(EntityProject), w.ids(EntityTask)
+	keep := func(ref *int64, ids map[int64]bool) *int64 {
+		if ref == nil || !ids[*ref] {
+			return nil
+		}
+		return ref
+	}
+	dropped := func(id int64) bool { return !tasks[id] }
+
+	for _, p := range w.People {
+		p.ManagerID = keep(p.ManagerID, people)
+		if p.ManagerID == nil {
+			p.Manager = ""
+		}
+	}
+	for _, t := range w.Tasks {
+		t.RecurrenceID = nil
+		t.AssigneeID, t.ReviewerID = keep(t.AssigneeID, people), keep(t.ReviewerID, people)
+		t.DependsOn = slices.DeleteFunc(t.DependsOn, dropped)
+		t.BlockedBy = slices.DeleteFunc(t.BlockedBy, dropped)
+	}
+	for _, p := range w.Problems {
+		p.ProjectID, p.TaskID, p.AssigneeID = keep(p.ProjectID, projects), keep(p.TaskID, tasks), keep(p.AssigneeID, people)
+	}
+	for _, o := range w.Outcomes {
+		o.TaskID = keep(o.TaskID, tasks)
+	}
+	for _, g := range w.Goals {
+		g.ProjectID, g.TaskID, g.AssigneeID = keep(g.ProjectID, projects), keep(g.TaskID, tasks), keep(g.AssigneeID, people)
+	}
+}
+
+// WriteExport writes the workspace in one of the ExportFormats. CSV is
+// written as a zip archive holding one file per table.
+func WriteExport(out io.Writer, w *Workspace, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(w)
+	case "csv":
+		return writeCSVExport(out, w)
+	case "markdown":
+		return writeMarkdownExport(out, w)
+	default:
+		return validateEnum("export format", format, ExportFormats)
+	}
+}
+
+// ReadExport reads a workspace exported as JSON
+func ReadExport(in io.Reader) (*Workspace, error) {
+	var w Workspace
+	if err := json.NewDecoder(in).Decode(&w); err != nil {
+		return nil, fmt.Errorf("%w export: %v", ErrInvalidValue, err)
+	}
+	return &w, nil
+}
+
+// ImportWorkspace adds an exported workspace to the database in a single
+// transaction. With preserveIDs every item keeps the ID it was exported
+// with, and the import fails if one is taken. Otherwise items get new IDs,
+// and people whose email or handle is already known are matched to the
+// existing person instead of being added again. Tags are matched by name.
+func (d *Database) ImportWorkspace(w *Workspace, preserveIDs bool) (*ImportResult, error) {
+	if err := d.validateImport(w); err != nil {
+		return nil, err
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result := &ImportResult{Created: map[string]int{}, IDs: map[string]map[int64]int64{}}
+	insert := func(entity, table string, id int64, columns string, values ...interface{}) error {
+		if preserveIDs {
+			var taken bool
+			if err := tx.QueryRow(fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE id = ?)", table), id).Scan(&taken); err != nil {
+				return err
+			}
+			if taken {
+				return fmt.Errorf("%w import: %s %d already exists; import without preserving IDs to add it as a new item", ErrInvalidValue, entityName(entity), id)
+			}
+			columns = "id, " + columns
+			values = append([]interface{}{id}, values...)
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+		res, err := tx.Exec(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, columns, placeholders), values...)
+		if err != nil {
+			return fmt.Errorf("failed to import %s %d: %w", entityName(entity), id, err)
+		}
+		newID, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		result.setID(entity, id, newID)
+		result.Created[entity]++
+		return nil
+	}
+	ref := func(entity string, id *int64) *int64 {
+		if id == nil {
+			return nil
+		}
+		newID := result.IDs[entity][*id]
+		return &newID
+	}
+
+	// People, then who they report to once everyone is in
+	matched := map[int64]bool{}
+	for _, p := range w.People {
+		name, email, handle, _ := normalizePerson(p.Name, p.Email, p.Handle)
+		if !preserveIDs {
+			var existing int64
+			err := tx.QueryRow(
+				"SELECT id FROM people WHERE (email != '' AND LOWER(email) = LOWER(?)) OR (handle != '' AND LOWER(handle) = LOWER(?)) ORDER BY id LIMIT 1",
+				email, handle,
+			).Scan(&existing)
+			if err == nil {
+				result.setID(EntityPerson, p.ID, existing)
+				matched[p.ID] = true
+				continue
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				return nil, err
+			}
+		}
+		if err := insert(EntityPerson, "people", p.ID, "name, email, handle, role, created_at, updated_at",
+			name, email, handle, strings.TrimSpace(p.Role), importTime(p.CreatedAt), importTime(p.UpdatedAt)); err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range w.People {
+		if p.ManagerID == nil || matched[p.ID] {
+			continue
+		}
+		if _, err := tx.Exec("UPDATE people SET manager_id = ? WHERE id = ?", ref(EntityPerson, p.ManagerID), *ref(EntityPerson, &p.ID)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Tags are keyed by name, so existing ones are reused
+	for _, t := range w.Tags {
+		name, _ := NormalizeTag(t.Name)
+		color, _ := normalizeTagColor(t.Color)
+		res, err := tx.Exec("INSERT OR IGNORE INTO tags (name, color, created_at, updated_at) VALUES (?, ?, ?, ?)", name, color, importTime(t.CreatedAt), importTime(t.UpdatedAt))
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			result.Created[EntityTag]++
+		}
+	}
+
+	for _, p := range w.Projects {
+		if err := insert(EntityProject, "projects", p.ID, "name, description, status, external_link, start_at, due_at, created_at, updated_at",
+			p.Name, p.Description, orDefault(p.Status, d.defaults.ProjectStatus), p.ExternalLink, dbTime(p.StartAt), dbTime(p.DueAt), importTime(p.CreatedAt), importTime(p.UpdatedAt)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Tasks, then their parents once every task has its new ID
+	for _, t := range w.Tasks {
+		if err := insert(EntityTask, "tasks", t.ID, "project_id, title, description, status, priority, task_type, external_link, assignee_id, reviewer_id, start_at, due_at, created_at, updated_at",
+			*ref(EntityProject, &t.ProjectID), t.Title, t.Description, orDefault(t.Status, d.defaults.TaskStatus), orDefault(t.Priority, d.defaults.TaskPriority),
+			orDefault(t.TaskType, d.defaults.TaskType), t.ExternalLink, ref(EntityPerson, t.AssigneeID), ref(EntityPerson, t.ReviewerID),
+			dbTime(t.StartAt), dbTime(t.DueAt), importTime(t.CreatedAt), importTime(t.UpdatedAt)); err != nil {
+			return nil, err
+		}
+	}
+	for _, t := range w.Tasks {
+		if t.ParentTaskID == nil {
+			continue
+		}
+		if _, err := tx.Exec("UPDATE tasks SET parent_task_id = ? WHERE id = ?", ref(EntityTask, t.ParentTaskID), *ref(EntityTask, &t.ID)); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, n := range w.TaskNotes {
+		if err := insert(EntityTaskNote, "task_notes", n.ID, "task_id, note, created_at, updated_at",
+			*ref(EntityTask, &n.TaskID), n.Note, importTime(n.CreatedAt), importTime(n.UpdatedAt)); err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range w.Problems {
+		if err := insert(EntityProblem, "problems", p.ID, "project_id, task_id, title, description, status, assignee_id, created_at, updated_at",
+			ref(EntityProject, p.ProjectID), ref(EntityTask, p.TaskID), p.Title, p.Description, orDefault(p.Status, d.defaults.ProblemStatus),
+			ref(EntityPerson, p.AssigneeID), importTime(p.CreatedAt), importTime(p.UpdatedAt)); err != nil {
+			return nil, err
+		}
+	}
+	for _, o := range w.Outcomes {
+		if err := insert(EntityOutcome, "outcomes", o.ID, "project_id, task_id, title, description, status, start_at, due_at, created_at, updated_at",
+			*ref(EntityProject, &o.ProjectID), ref(EntityTask, o.TaskID), o.Title, o.Description, orDefault(o.Status, d.defaults.OutcomeStatus),
+			dbTime(o.StartAt), dbTime(o.DueAt), importTime(o.CreatedAt), importTime(o.UpdatedAt)); err != nil {
+			return nil, err
+		}
+	}
+	for _, g := range w.Goals {
+		if err := insert(EntityGoal, "goals", g.ID, "project_id, task_id, title, description, goal_type, assignee_id, start_at, due_at, created_at, updated_at",
+			ref(EntityProject, g.ProjectID), ref(EntityTask, g.TaskID), g.Title, g.Description, orDefault(g.GoalType, d.defaults.GoalType),
+			ref(EntityPerson, g.AssigneeID), dbTime(g.StartAt), dbTime(g.DueAt), importTime(g.CreatedAt), importTime(g.UpdatedAt)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Links between items, which need every item's new ID
+	for _, l := range w.ProblemProjects {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO problem_projects (problem_id, project_id) VALUES (?, ?)", ref(EntityProblem, &l.ProblemID), ref(EntityProject, &l.ProjectID)); err != nil {
+			return nil, err
+		}
+	}
+	for _, l := range w.GoalProjects {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO goal_projects (goal_id, project_id) VALUES (?, ?)", ref(EntityGoal, &l.GoalID), ref(EntityProject, &l.ProjectID)); err != nil {
+			return nil, err
+		}
+	}
+	for _, t := range w.Tasks {
+		for _, dep := range t.DependsOn {
+			if _, err := tx.Exec("INSERT OR IGNORE INTO task_dependencies (task_id, depends_on_id) VALUES (?, ?)", ref(EntityTask, &t.ID), ref(EntityTask, &dep)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, item := range w.taggedItems() {
+		t := tagTables[item.entity]
+		for _, name := range item.tags {
+			name, _ := NormalizeTag(name)
+			res, err := tx.Exec("INSERT OR IGNORE INTO tags (name) VALUES (?)", name)
+			if err != nil {
+				return nil, err
+			}
+			if n, _ := res.RowsAffected(); n > 0 {
+				result.Created[EntityTag]++
+			}
+			query := fmt.Sprintf("INSERT OR IGNORE INTO %s (%s, tag_id) SELECT ?, id FROM tags WHERE name = ?", t.table, t.column)
+			if _, err := tx.Exec(query, ref(item.entity, &item.id), name); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	d.publishImported(w, result, matched)
+	return result, nil
+}
+
+// publishImported records each item an import added in the activity log,
+// people and projects before the items in them, then publishes a single
+// imported event, since an event per item could overflow the dashboard's
+// event buffers
+func (d *Database) publishImported(w *Workspace, result *ImportResult, matched map[int64]bool) {
+	record := func(entity string, oldID int64) {
+		id := result.IDs[entity][oldID]
+		var item interface{}
+		var err error
+		if entity == EntityPerson {
+			item, err = d.GetPerson(id)
+		} else {
+			item, err = d.getItem(entity, id)
+		}
+		if err == nil {
+			err = d.recordActivity(ActionCreated, entity, id, nil, item)
+		}
+		if err != nil {
+			log.Printf("Failed to record activity for imported %s %d: %v", entity, id, err)
+		}
+	}
+	for _, p := range w.People {
+		if !matched[p.ID] {
+			record(EntityPerson, p.ID)
+		}
+	}
+	for _, p := range w.Projects {
+		record(EntityProject, p.ID)
+	}
+	for _, t := range w.Tasks {
+		record(EntityTask, t.ID)
+	}
+	for _, n := range w.TaskNotes {
+		record(EntityTaskNote, n.ID)
+	}
+	for _, p := range w.Problems {
+		record(EntityProblem, p.ID)
+	}
+	for _, o := range w.Outcomes {
+		record(EntityOutcome, o.ID)
+	}
+	for _, g := range w.Goals {
+		record(EntityGoal, g.ID)
+	}
+	d.events.Publish(ChangeEvent{Action: ActionImported, Entity: EntityWorkspace, Data: result.Created, Actor: d.actor})
+}
+
+// setID records the ID an imported item was given
+func (r *ImportResult) setID(entity string, oldID, newID int64) {
+	if r.IDs[entity] == nil {
+		r.IDs[entity] = map[int64]int64{}
+	}
+	r.IDs[entity][oldID] = newID
+}
+
+// importTime formats an exported timestamp for storage, using the current
+// time for one that is missing
+func importTime(t time.Time) interface{} {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	return dbTime(&t)
+}
+
+// orDefault returns value, or def if value is empty
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+// taggedItem is an exported item's tags
+type taggedItem struct {
+	entity string
+	id     int64
+	tags   []string
+}
+
+// taggedItems lists the tags of every item in the workspace
+func (w *Workspace) taggedItems() []taggedItem {
+	var items []taggedItem
+	for _, p := range w.Projects {
+		items = append(items, taggedItem{EntityProject, p.ID, p.Tags})
+	}
+	for _, t := range w.Tasks {
+		items = append(items, taggedItem{EntityTask, t.ID, t.Tags})
+	}
+	for _, p := range w.Problems {
+		items = append(items, taggedItem{EntityProblem, p.ID, p.Tags})
+	}
+	for _, o := range w.Outcomes {
+		items = append(items, taggedItem{EntityOutcome, o.ID, o.Tags})
+	}
+	for _, g := range w.Goals {
+		items = append(items, taggedItem{EntityGoal, g.ID, g.Tags})
+	}
+	return items
+}
+
+// validateImport checks a workspace before any of it is imported: its
+// format, the values of enumerated fields and dates, and that every
+// reference points to an item in the workspace and keeps the invariants the
+// database enforces on each change
+func (d *Database) validateImport(w *Workspace) error {
+	if w.Format != exportFormatVersion {
+		return fmt.Errorf("%w export: format %d is not the %d this Loom reads", ErrInvalidValue, w.Format, exportFormatVersion)
+	}
+
+	seen := map[string]map[int64]bool{}
+	unique := func(entity string, id int64) error {
+		if seen[entity] == nil {
+			seen[entity] = map[int64]bool{}
+		}
+		if seen[entity][id] {
+			return fmt.Errorf("%w export: %s %d appears more than once", ErrInvalidValue, entityName(entity), id)
+		}
+		seen[entity][id] = true
+		return nil
+	}
+	exists := func(entity string, id *int64) error {
+		if id != nil && !seen[entity][*id] {
+			return fmt.Errorf("%w: %s with ID %d is not in the export", ErrInvalidReference, entityName(entity), *id)
+		}
+		return nil
+	}
+
+	people := map[int64]*Person{}
+	for _, p := range w.People {
+		if err := unique(EntityPerson, p.ID); err != nil {
+			return err
+		}
+		if _, _, _, err := normalizePerson(p.Name, p.Email, p.Handle); err != nil {
+			return err
+		}
+		people[p.ID] = p
+	}
+	for _, p := range w.People {
+		if err := exists(EntityPerson, p.ManagerID); err != nil {
+			return err
+		}
+	}
+	for _, p := range w.People {
+		for next, steps := p.ManagerID, 0; next != nil; next, steps = people[*next].ManagerID, steps+1 {
+			if *next == p.ID || steps > len(w.People) {
+				return fmt.Errorf("%w manager: person %d can't report to themselves", ErrInvalidValue, p.ID)
+			}
+		}
+	}
+	for _, t := range w.Tags {
+		if _, err := NormalizeTag(t.Name); err != nil {
+			return err
+		}
+		if _, err := normalizeTagColor(t.Color); err != nil {
+			return err
+		}
+	}
+	for _, item := range w.taggedItems() {
+		for _, name := range item.tags {
+			if _, err := NormalizeTag(name); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, p := range w.Projects {
+		if err := unique(EntityProject, p.ID); err != nil {
+			return err
+		}
+		if err := validateEnum("project status", orDefault(p.Status, d.defaults.ProjectStatus), ProjectStatuses); err != nil {
+			return err
+		}
+		if err := checkDateRange(p.StartAt, p.DueAt); err != nil {
+			return err
+		}
+	}
+
+	tasks := map[int64]*Task{}
+	for _, t := range w.Tasks {
+		if err := unique(EntityTask, t.ID); err != nil {
+			return err
+		}
+		tasks[t.ID] = t
+	}
+	for _, t := range w.Tasks {
+		for _, err := range []error{
+			exists(EntityProject, &t.ProjectID),
+			exists(EntityTask, t.ParentTaskID),
+			exists(EntityPerson, t.AssigneeID),
+			exists(EntityPerson, t.ReviewerID),
+			validateEnum("task status", orDefault(t.Status, d.defaults.TaskStatus), TaskStatuses),
+			validateEnum("task priority", orDefault(t.Priority, d.defaults.TaskPriority), TaskPriorities),
+			validateEnum("task type", orDefault(t.TaskType, d.defaults.TaskType), TaskTypes),
+			checkDateRange(t.StartAt, t.DueAt),
+		} {
+			if err != nil {
+				return err
+			}
+		}
+		if t.ParentTaskID != nil && tasks[*t.ParentTaskID].ProjectID != t.ProjectID {
+			parent := tasks[*t.ParentTaskID]
+			return &ProjectMismatchError{Entity: "subtask", TaskID: parent.ID, TaskProjectID: parent.ProjectID, ProjectID: t.ProjectID}
+		}
+		for _, dep := range t.DependsOn {
+			if err := exists(EntityTask, &dep); err != nil {
+				return err
+			}
+		}
+	}
+	for _, t := range w.Tasks {
+		for next, steps := t.ParentTaskID, 0; next != nil; next, steps = tasks[*next].ParentTaskID, steps+1 {
+			if *next == t.ID || steps > len(w.Tasks) {
+				return fmt.Errorf("%w parent task: task %d is a subtask of itself", ErrInvalidValue, t.ID)
+			}
+		}
+	}
+	if err := checkImportedDependencies(w.Tasks); err != nil {
+		return err
+	}
+
+	// Problems, outcomes and goals must be in the same project as their task
+	checkTask := func(entity string, projectID, taskID *int64) error {
+		if err := exists(EntityProject, projectID); err != nil {
+			return err
+		}
+		if err := exists(EntityTask, taskID); err != nil {
+			return err
+		}
+		if projectID != nil && taskID != nil && tasks[*taskID].ProjectID != *projectID {
+			return &ProjectMismatchError{Entity: entity, TaskID: *taskID, TaskProjectID: tasks[*taskID].ProjectID, ProjectID: *projectID}
+		}
+		return nil
+	}
+	for _, n := range w.TaskNotes {
+		if err := unique(EntityTaskNote, n.ID); err != nil {
+			return err
+		}
+		if err := exists(EntityTask, &n.TaskID); err != nil {
+			return err
+		}
+	}
+	for _, p := range w.Problems {
+		for _, err := range []error{
+			unique(EntityProblem, p.ID),
+			checkTask(EntityProblem, p.ProjectID, p.TaskID),
+			exists(EntityPerson, p.AssigneeID),
+			validateEnum("problem status", orDefault(p.Status, d.defaults.ProblemStatus), ProblemStatuses),
+		} {
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, o := range w.Outcomes {
+		for _, err := range []error{
+			unique(EntityOutcome, o.ID),
+			checkTask(EntityOutcome, &o.ProjectID, o.TaskID),
+			validateEnum("outcome status", orDefault(o.Status, d.defaults.OutcomeStatus), OutcomeStatuses),
+			checkDateRange(o.StartAt, o.DueAt),
+		} {
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, g := range w.Goals {
+		for _, err := range []error{
+			unique(EntityGoal, g.ID),
+			checkTask(EntityGoal, g.ProjectID, g.TaskID),
+			exists(EntityPerson, g.AssigneeID),
+			validateEnum("goal type", orDefault(g.GoalType, d.defaults.GoalType), GoalTypes),
+			checkDateRange(g.StartAt, g.DueAt),
+		} {
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, l := range w.ProblemProjects {
+		if err := exists(EntityProblem, &l.ProblemID); err != nil {
+			return err
+		}
+		if err := exists(EntityProject, &l.ProjectID); err != nil {
+			return err
+		}
+	}
+	for _, l := range w.GoalProjects {
+		if err := exists(EntityGoal, &l.GoalID); err != nil {
+			return err
+		}
+		if err := exists(EntityProject, &l.ProjectID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkImportedDependencies rejects dependencies between imported tasks
+// that form a cycle
+func checkImportedDependencies(tasks []*Task) error {
+	dependsOn := map[int64][]int64{}
+	for _, t := range tasks {
+		dependsOn[t.ID] = t.DependsOn
+	}
+
+	// Depth-first search, where path holds the tasks being visited
+	done := map[int64]bool{}
+	var path []int64
+	var visit func(id int64) error
+	visit = func(id int64) error {
+		path = append(path, id)
+		for _, dep := range dependsOn[id] {
+			if i := slices.Index(path, dep); i >= 0 {
+				return &DependencyCycleError{TaskID: id, DependsOnID: dep, Path: slices.Clone(path[i:])}
+			}
+			if !done[dep] {
+				if err := visit(dep); err != nil {
+					return err
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		done[id] = true
+		return nil
+	}
+	for _, t := range tasks {
+		if !done[t.ID] {
+			if err := visit(t.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeCSVExport writes a zip archive with a CSV file for each table. Lists
+// of IDs and tags are written comma-separated in a single field.
+func writeCSVExport(out io.Writer, w *Workspace) error {
+	z := zip.NewWriter(out)
+	for _, table := range []struct {
+		name   string
+		header []string
+		rows   [][]string
+	}{
+		{"people", []string{"id", "name", "email", "handle", "role", "manager_id", "created_at", "updated_at"}, csvRows(w.People, func(p *Person) []string {
+			return []string{csvID(p.ID), p.Name, p.Email, p.Handle, p.Role, csvRef(p.ManagerID), csvTime(&p.CreatedAt), csvTime(&p.UpdatedAt)}
+		})},
+		{"tags", []string{"id", "name", "color", "created_at", "updated_at"}, csvRows(w.Tags, func(t *Tag) []string {
+			return []string{csvID(t.ID), t.Name, t.Color, csvTime(&t.CreatedAt), csvTime(&t.UpdatedAt)}
+		})},
+		{"projects", []string{"id", "name", "description", "status", "external_link", "start_at", "due_at", "tags", "created_at", "updated_at"}, csvRows(w.Projects, func(p *Project) []string {
+			return []string{csvID(p.ID), p.Name, p.Description, p.Status, p.ExternalLink, csvTime(p.StartAt), csvTime(p.DueAt), strings.Join(p.Tags, ","), csvTime(&p.CreatedAt), csvTime(&p.UpdatedAt)}
+		})},
+		{"tasks", []string{"id", "project_id", "parent_task_id", "title", "description", "status", "priority", "task_type", "external_link", "assignee_id", "reviewer_id", "start_at", "due_at", "depends_on", "tags", "created_at", "updated_at"}, csvRows(w.Tasks, func(t *Task) []string {
+			return []string{csvID(t.ID), csvID(t.ProjectID), csvRef(t.ParentTaskID), t.Title, t.Description, t.Status, t.Priority, t.TaskType, t.ExternalLink,
+				csvRef(t.AssigneeID), csvRef(t.ReviewerID), csvTime(t.StartAt), csvTime(t.DueAt), csvIDs(t.DependsOn), strings.Join(t.Tags, ","), csvTime(&t.CreatedAt), csvTime(&t.UpdatedAt)}
+		})},
+		{"task_notes", []string{"id", "task_id", "note", "created_at", "updated_at"}, csvRows(w.TaskNotes, func(n *TaskNote) []string {
+			return []string{csvID(n.ID), csvID(n.TaskID), n.Note, csvTime(&n.CreatedAt), csvTime(&n.UpdatedAt)}
+		})},
+		{"problems", []string{"id", "project_id", "task_id", "title", "description", "status", "assignee_id", "tags", "created_at", "updated_at"}, csvRows(w.Problems, func(p *Problem) []string {
+			return []string{csvID(p.ID), csvRef(p.ProjectID), csvRef(p.TaskID), p.Title, p.Description, p.Status, csvRef(p.AssigneeID), strings.Join(p.Tags, ","), csvTime(&p.CreatedAt), csvTime(&p.UpdatedAt)}
+		})},
+		{"outcomes", []string{"id", "project_id", "task_id", "title", "description", "status", "start_at", "due_at", "tags", "created_at", "updated_at"}, csvRows(w.Outcomes, func(o *Outcome) []string {
+			return []string{csvID(o.ID), csvID(o.ProjectID), csvRef(o.TaskID), o.Title, o.Description, o.Status, csvTime(o.StartAt), csvTime(o.DueAt), strings.Join(o.Tags, ","), csvTime(&o.CreatedAt), csvTime(&o.UpdatedAt)}
+		})},
+		{"goals", []string{"id", "project_id", "task_id", "title", "description", "goal_type", "assignee_id", "start_at", "due_at", "tags", "created_at", "updated_at"}, csvRows(w.Goals, func(g *Goal) []string {
+			return []string{csvID(g.ID), csvRef(g.ProjectID), csvRef(g.TaskID), g.Title, g.Description, g.GoalType, csvRef(g.AssigneeID), csvTime(g.StartAt), csvTime(g.DueAt), strings.Join(g.Tags, ","), csvTime(&g.CreatedAt), csvTime(&g.UpdatedAt)}
+		})},
+		{"problem_projects", []string{"problem_id", "project_id"}, csvRows(w.ProblemProjects, func(l ProblemProject) []string {
+			return []string{csvID(l.ProblemID), csvID(l.ProjectID)}
+		})},
+		{"goal_projects", []string{"goal_id", "project_id"}, csvRows(w.GoalProjects, func(l GoalProject) []string {
+			return []string{csvID(l.GoalID), csvID(l.ProjectID)}
+		})},
+	} {
+		f, err := z.CreateHeader(&zip.FileHeader{Name: table.name + ".csv", Method: zip.Deflate, Modified: w.ExportedAt})
+		if err != nil {
+			return err
+		}
+		cw := csv.NewWriter(f)
+		if err := cw.Write(table.header); err != nil {
+			return err
+		}
+		if err := cw.WriteAll(table.rows); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+func csvRows[T any](items []T, row func(T) []string) [][]string {
+	rows := make([][]string, len(items))
+	for i, item := range items {
+		rows[i] = row(item)
+	}
+	return rows
+}
+
+func csvID(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
+
+func csvRef(id *int64) string {
+	if id == nil {
+		return ""
+	}
+	return csvID(*id)
+}
+
+func csvIDs(ids []int64) string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = csvID(id)
+	}
+	return strings.Join(s, ",")
+}
+
+func csvTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// writeMarkdownExport writes the workspace as a report to read or paste
+// into a document: each project with its task checklist, subtasks and
+// notes, problems, outcomes and goals, then the problems and goals without
+// a project and the people
+func writeMarkdownExport(out io.Writer, w *Workspace) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Loom export\n\nExported %s.\n", w.ExportedAt.Local().Format("2006-01-02 15:04"))
+
+	people := map[int64]*Person{}
+	for _, p := range w.People {
+		people[p.ID] = p
+	}
+	person := func(label string, id *int64) string {
+		if id == nil || people[*id] == nil {
+			return ""
+		}
+		return label + " " + people[*id].Name
+	}
+	notes := map[int64][]*TaskNote{}
+	for _, n := range w.TaskNotes {
+		notes[n.TaskID] = append(notes[n.TaskID], n)
+	}
+	subtasks := map[int64][]*Task{}
+	for _, t := range w.Tasks {
+		if t.ParentTaskID != nil {
+			subtasks[*t.ParentTaskID] = append(subtasks[*t.ParentTaskID], t)
+		}
+	}
+	linkedProblems, linkedGoals := map[int64][]int64{}, map[int64][]int64{}
+	for _, l := range w.ProblemProjects {
+		linkedProblems[l.ProjectID] = append(linkedProblems[l.ProjectID], l.ProblemID)
+	}
+	for _, l := range w.GoalProjects {
+		linkedGoals[l.ProjectID] = append(linkedGoals[l.ProjectID], l.GoalID)
+	}
+
+	var writeTask func(t *Task, indent string)
+	writeTask = func(t *Task, indent string) {
+		check := " "
+		if t.Status == "completed" {
+			check = "x"
+		}
+		fmt.Fprintf(&b, "%s- [%s] %s (#%d)%s\n", indent, check, markdownLine(t.Title), t.ID, markdownDetails(
+			t.Status, t.Priority, t.TaskType, person("assigned to", t.AssigneeID), person("reviewed by", t.ReviewerID),
+			markdownDate("starts", t.StartAt), markdownDate("due", t.DueAt), markdownDependencies(t.DependsOn), markdownTags(t.Tags),
+		))
+		if t.Description != "" {
+			fmt.Fprintf(&b, "%s  %s\n", indent, markdownLine(t.Description))
+		}
+		for _, n := range notes[t.ID] {
+			fmt.Fprintf(&b, "%s  > %s (%s)\n", indent, markdownLine(n.Note), n.CreatedAt.Local().Format("2006-01-02"))
+		}
+		for _, sub := range subtasks[t.ID] {
+			writeTask(sub, indent+"  ")
+		}
+	}
+	writeProblems := func(problems []*Problem) {
+		if len(problems) == 0 {
+			return
+		}
+		b.WriteString("\n### Problems\n\n")
+		for _, p := range problems {
+			fmt.Fprintf(&b, "- %s (#%d)%s\n", markdownLine(p.Title), p.ID, markdownDetails(p.Status, person("assigned to", p.AssigneeID), markdownTags(p.Tags)))
+		}
+	}
+	writeGoals := func(goals []*Goal) {
+		if len(goals) == 0 {
+			return
+		}
+		b.WriteString("\n### Goals\n\n")
+		for _, g := range goals {
+			fmt.Fprintf(&b, "- %s (#%d)%s\n", markdownLine(g.Title), g.ID, markdownDetails(
+				g.GoalType, person("assigned to", g.AssigneeID), markdownDate("starts", g.StartAt), markdownDate("due", g.DueAt), markdownTags(g.Tags),
+			))
+		}
+	}
+
+	for _, p := range w.Projects {
+		fmt.Fprintf(&b, "\n## %s (#%d)\n\n", markdownLine(p.Name), p.ID)
+		fmt.Fprintf(&b, "%s\n", strings.TrimPrefix(markdownDetails(p.Status, markdownDate("starts", p.StartAt), markdownDate("due", p.DueAt), markdownTags(p.Tags), p.ExternalLink), " — "))
+		if p.Description != "" {
+			fmt.Fprintf(&b, "\n%s\n", strings.TrimSpace(p.Description))
+		}
+
+		var tasks []*Task
+		for _, t := range w.Tasks {
+			if t.ProjectID == p.ID && t.ParentTaskID == nil {
+				tasks = append(tasks, t)
+			}
+		}
+		if len(tasks) > 0 {
+			b.WriteString("\n### Tasks\n\n")
+			for _, t := range tasks {
+				writeTask(t, "")
+			}
+		}
+		writeProblems(slices.DeleteFunc(slices.Clone(w.Problems), func(pr *Problem) bool {
+			return (pr.ProjectID == nil || *pr.ProjectID != p.ID) && !slices.Contains(linkedProblems[p.ID], pr.ID)
+		}))
+		var outcomes []*Outcome
+		for _, o := range w.Outcomes {
+			if o.ProjectID == p.ID {
+				outcomes = append(outcomes, o)
+			}
+		}
+		if len(outcomes) > 0 {
+			b.WriteString("\n### Outcomes\n\n")
+			for _, o := range outcomes {
+				fmt.Fprintf(&b, "- %s (#%d)%s\n", markdownLine(o.Title), o.ID, markdownDetails(o.Status, markdownDate("starts", o.StartAt), markdownDate("due", o.DueAt), markdownTags(o.Tags)))
+			}
+		}
+		writeGoals(slices.DeleteFunc(slices.Clone(w.Goals), func(g *Goal) bool {
+			return (g.ProjectID == nil || *g.ProjectID != p.ID) && !slices.Contains(linkedGoals[p.ID], g.ID)
+		}))
+	}
+
+	linked := func(links map[int64][]int64, id int64) bool {
+		for _, ids := range links {
+			if slices.Contains(ids, id) {
+				return true
+			}
+		}
+		return false
+	}
+	problems := slices.DeleteFunc(slices.Clone(w.Problems), func(p *Problem) bool { return p.ProjectID != nil || linked(linkedProblems, p.ID) })
+	goals := slices.DeleteFunc(slices.Clone(w.Goals), func(g *Goal) bool { return g.ProjectID != nil || linked(linkedGoals, g.ID) })
+	if len(problems) > 0 || len(goals) > 0 {
+		b.WriteString("\n## Without a project\n")
+		writeProblems(problems)
+		writeGoals(goals)
+	}
+
+	if len(w.People) > 0 {
+		b.WriteString("\n## People\n\n")
+		for _, p := range w.People {
+			handle := ""
+			if p.Handle != "" {
+				handle = "@" + p.Handle
+			}
+			fmt.Fprintf(&b, "- %s%s\n", markdownLine(p.Name), markdownDetails(p.Email, handle, p.Role, person("reports to", p.ManagerID)))
+		}
+	}
+
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+// markdownLine flattens text onto a single line so it can't break the
+// surrounding list
+func markdownLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// markdownDetails joins the non-empty details of an item after a dash
+func markdownDetails(details ...string) string {
+	details = slices.DeleteFunc(details, func(s string) bool { return s == "" })
+	if len(details) == 0 {
+		return ""
+	}
+	return " — " + strings.Join(details, ", ")
+}
+
+func markdownDate(label string, t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return label + " " + t.Local().Format("2006-01-02")
+}
+
+func markdownDependencies(ids []int64) string {
+	if len(ids) == 0 {
+		return ""
+	}
+	refs := make([]string, len(ids))
+	for i, id := range ids {
+		refs[i] = fmt.Sprintf("#%d", id)
+	}
+	return "after " + strings.Join(refs, ", ")
+}
+
+func markdownTags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	return "tags " + strings.Join(tags, ", ")
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// seedWorkspace fills a database with one of everything that is exported
+func seedWorkspace(t *testing.T, db *Database) (*Project, *Project, *Task) {
+	t.Helper()
+	due := time.Date(2026, 3, 1, 17, 0, 0, 0, time.UTC)
+	lead, _ := db.CreatePerson("Lead", "lead@example.com", "lead", "manager", nil)
+	if _, err := db.CreatePerson("Alice", "alice@example.com", "alice", "engineer", &lead.ID); err != nil {
+		t.Fatalf("failed to create person: %v", err)
+	}
+	project, _ := db.CreateProject("Launch", "Ship it", "", "", nil, &due)
+	other, _ := db.CreateProject("Other", "", "", "", nil, nil)
+	design, _ := db.CreateTask(project.ID, nil, "Design", "", "completed", "", "", "", "alice", "", nil, nil)
+	build, err := db.CreateTask(project.ID, nil, "Build", "", "", "high", "feature", "", "", "lead", nil, &due)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	db.CreateTask(project.ID, &build.ID, "Backend", "", "", "", "", "", "", "", nil, nil)
+	db.CreateTask(other.ID, nil, "Unrelated", "", "", "", "", "", "", "", nil, nil)
+	if err := db.AddTaskDependency(build.ID, design.ID); err != nil {
+		t.Fatalf("failed to add dependency: %v", err)
+	}
+	db.CreateTaskNote(build.ID, "Started on the API")
+	db.TagItem(EntityTask, build.ID, "backend", "#336699")
+	db.TagItem(EntityProject, other.ID, "later", "")
+
+	problem, _ := db.CreateProblem(&other.ID, nil, "Flaky CI", "", "", "alice")
+	db.LinkProblemToProject(problem.ID, project.ID)
+	db.CreateProblem(nil, nil, "Loose end", "", "", "")
+	db.CreateOutcome(project.ID, &build.ID, "Released", "", "", nil, &due)
+	goal, _ := db.CreateGoal(nil, nil, "Grow", "", "career", "", nil, nil)
+	db.LinkGoalToProject(goal.ID, project.ID)
+	return project, other, build
+}
+
+func TestExportImportPreservingIDs(t *testing.T) {
+	source := newTestDatabase(t)
+	seedWorkspace(t, source)
+	exported, err := source.ExportWorkspace(nil)
+	if err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+	if len(exported.Projects) != 2 || len(exported.Tasks) != 4 || len(exported.TaskNotes) != 1 || len(exported.ProblemProjects) != 1 || len(exported.GoalProjects) != 1 {
+		t.Fatalf("expected everything to be exported, got %+v", exported)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteExport(&buf, exported, "json"); err != nil {
+		t.Fatalf("failed to write export: %v", err)
+	}
+	read, err := ReadExport(&buf)
+	if err != nil {
+		t.Fatalf("failed to read export: %v", err)
+	}
+
+	target := newTestDatabase(t)
+	result, err := target.ImportWorkspace(read, true)
+	if err != nil {
+		t.Fatalf("failed to import: %v", err)
+	}
+	if result.Created[EntityTask] != 4 || result.Created[EntityPerson] != 2 || result.Created[EntityTag] != 2 {
+		t.Errorf("unexpected counts %v", result.Created)
+	}
+
+	imported, err := target.ExportWorkspace(nil)
+	if err != nil {
+		t.Fatalf("failed to export the import: %v", err)
+	}
+	imported.ExportedAt = exported.ExportedAt
+	var want, got bytes.Buffer
+	WriteExport(&want, exported, "json")
+	WriteExport(&got, imported, "json")
+	if want.String() != got.String() {
+		t.Errorf("expected the import to match the export\nwant: %s\ngot:  %s", want.String(), got.String())
+	}
+
+	// Importing again would reuse every ID
+	if _, err := target.ImportWorkspace(read, true); !errors.Is(err, ErrInvalidValue) || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("expected taken IDs to be rejected, got %v", err)
+	}
+	if projects, _ := target.ListProjects(nil); len(projects) != 2 {
+		t.Errorf("expected a failed import to change nothing, got %d projects", len(projects))
+	}
+}
+
+func TestImportRemapsIDs(t *testing.T) {
+	source := newTestDatabase(t)
+	_, _, build := seedWorkspace(t, source)
+	exported, _ := source.ExportWorkspace(nil)
+
+	target := newTestDatabase(t)
+	existing, _ := target.CreateProject("Existing", "", "", "", nil, nil)
+	target.CreateTask(existing.ID, nil, "Existing", "", "", "", "", "", "", "", nil, nil)
+	alice, _ := target.CreatePerson("Alice Smith", "ALICE@example.com", "", "", nil)
+
+	var events []ChangeEvent
+	target.Subscribe(func(e ChangeEvent) { events = append(events, e) })
+	result, err := target.WithActor("cli").ImportWorkspace(exported, false)
+	if err != nil {
+		t.Fatalf("failed to import: %v", err)
+	}
+	if result.Created[EntityProject] != 2 || result.Created[EntityPerson] != 1 {
+		t.Errorf("expected Alice to be matched by email, got %v", result.Created)
+	}
+
+	// The import sends one event, and records each item it added
+	if len(events) != 1 || events[0].Action != ActionImported || events[0].Entity != EntityWorkspace || events[0].Actor != "cli" {
+		t.Errorf("expected a single imported event, got %+v", events)
+	}
+	history := listHistory(t, target, EntityTask, result.IDs[EntityTask][build.ID])
+	if len(history) != 1 || history[0].Action != ActionCreated || history[0].Actor != "cli" || history[0].Changes["title"].New != "Build" {
+		t.Errorf("expected the imported task to be recorded as created, got %+v", history)
+	}
+	if history := listHistory(t, target, EntityPerson, alice.ID); len(history) != 1 {
+		t.Errorf("expected the matched person not to be recorded again, got %+v", history)
+	}
+
+	newBuild, err := target.GetTask(result.IDs[EntityTask][build.ID])
+	if err != nil {
+		t.Fatalf("failed to get the imported task: %v", err)
+	}
+	if newBuild.ID == build.ID || newBuild.ProjectID != result.IDs[EntityProject][build.ProjectID] {
+		t.Errorf("expected new IDs, got %+v", newBuild)
+	}
+	if len(newBuild.DependsOn) != 1 || newBuild.DependsOn[0] != result.IDs[EntityTask][exported.Tasks[0].ID] || !slices.Equal(newBuild.Tags, []string{"backend"}) {
+		t.Errorf("expected the dependency and tag to follow the task, got %+v", newBuild)
+	}
+	design, _ := target.GetTask(newBuild.DependsOn[0])
+	if design.AssigneeID == nil || *design.AssigneeID != alice.ID {
+		t.Errorf("expected the task to be assigned to the existing Alice, got %+v", design)
+	}
+	if notes, _ := target.ListTaskNotes(newBuild.ID); len(notes) != 1 || notes[0].Note != "Started on the API" {
+		t.Errorf("expected the note to follow the task, got %+v", notes)
+	}
+	if problems, _ := target.GetProjectProblems(result.IDs[EntityProject][build.ProjectID]); len(problems) != 1 {
+		t.Errorf("expected the problem link to be remapped, got %+v", problems)
+	}
+}
+
+func TestExportProject(t *testing.T) {
+	db := newTestDatabase(t)
+	project, _, build := seedWorkspace(t, db)
+
+	w, err := db.ExportWorkspace(&project.ID)
+	if err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+	if len(w.Projects) != 1 || len(w.Tasks) != 3 || len(w.Outcomes) != 1 || len(w.TaskNotes) != 1 {
+		t.Errorf("expected only the project's tasks, notes and outcomes, got %+v", w)
+	}
+	if len(w.Problems) != 1 || w.Problems[0].ProjectID != nil || len(w.ProblemProjects) != 1 || len(w.Goals) != 1 {
+		t.Errorf("expected the linked problem without its own project, and the linked goal, got %+v, %+v", w.Problems, w.Goals)
+	}
+	if len(w.People) != 2 || len(w.Tags) != 1 || w.Tags[0].Name != "backend" {
+		t.Errorf("expected only the people and tags the project uses, got %+v, %+v", w.People, w.Tags)
+	}
+
+	target := newTestDatabase(t)
+	result, err := target.ImportWorkspace(w, false)
+	if err != nil {
+		t.Fatalf("failed to import the project: %v", err)
+	}
+	if task, err := target.GetTask(result.IDs[EntityTask][build.ID]); err != nil || len(task.DependsOn) != 1 {
+		t.Errorf("expected the imported task with its dependency, got %+v, %v", task, err)
+	}
+
+	missing := int64(999)
+	if _, err := db.ExportWorkspace(&missing); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a missing project, got %v", err)
+	}
+}
+
+func TestImportValidates(t *testing.T) {
+	db := newTestDatabase(t)
+	seedWorkspace(t, db)
+
+	for _, c := range []struct {
+		name   string
+		change func(w *Workspace)
+		want   string
+	}{
+		{"format", func(w *Workspace) { w.Format = 0 }, "format 0"},
+		{"status", func(w *Workspace) { w.Tasks[0].Status = "done" }, "invalid task status"},
+		{"reference", func(w *Workspace) { w.Projects = w.Projects[1:] }, "is not in the export"},
+		{"duplicate", func(w *Workspace) { w.Goals = append(w.Goals, w.Goals[0]) }, "appears more than once"},
+		{"cycle", func(w *Workspace) { w.Tasks[0].DependsOn = []int64{w.Tasks[1].ID} }, "can't depend on task"},
+		{"mismatch", func(w *Workspace) { w.Outcomes[0].ProjectID = w.Projects[1].ID }, "belongs to project"},
+		{"tag", func(w *Workspace) { w.Tasks[0].Tags = []string{"a,b"} }, "can't contain"},
+	} {
+		w, _ := db.ExportWorkspace(nil)
+		c.change(w)
+		if _, err := newTestDatabase(t).ImportWorkspace(w, true); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", c.name, c.want, err)
+		}
+	}
+}
+
+func TestExportFormats(t *testing.T) {
+	db := newTestDatabase(t)
+	seedWorkspace(t, db)
+	w, _ := db.ExportWorkspace(nil)
+
+	var buf bytes.Buffer
+	if err := WriteExport(&buf, w, "csv"); err != nil {
+		t.Fatalf("failed to write CSV: %v", err)
+	}
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("expected a zip archive: %v", err)
+	}
+	files := map[string][][]string{}
+	for _, f := range z.File {
+		r, _ := f.Open()
+		records, err := csv.NewReader(r).ReadAll()
+		r.Close()
+		if err != nil {
+			t.Fatalf("%s: invalid CSV: %v", f.Name, err)
+		}
+		files[f.Name] = records
+	}
+	if len(files) != 10 || len(files["tasks.csv"]) != 5 || len(files["goal_projects.csv"]) != 2 {
+		t.Errorf("expected a CSV file per table with a header row, got %v", files)
+	}
+	if header := files["tasks.csv"][0]; header[0] != "id" || !slices.Contains(header, "depends_on") {
+		t.Errorf("unexpected tasks header %v", header)
+	}
+
+	buf.Reset()
+	if err := WriteExport(&buf, w, "markdown"); err != nil {
+		t.Fatalf("failed to write markdown: %v", err)
+	}
+	for _, want := range []string{
+		"## Launch (#1)",
+		"- [x] Design (#1) — completed, medium, general, assigned to Alice",
+		"  - [ ] Backend (#3)",
+		"  > Started on the API",
+		"tags backend",
+		"### Problems\n\n- Flaky CI (#1)",
+		"## Without a project",
+		"- Alice — alice@example.com, @alice, engineer, reports to Lead",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected %q in markdown:\n%s", want, buf.String())
+		}
+	}
+
+	if err := WriteExport(&buf, w, "xml"); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("expected an unknown format to be rejected, got %v", err)
+	}
+}
+
+func TestExportImportCommands(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source.db")
+	db, err := NewDatabase(source)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	seedWorkspace(t, db)
+	db.Close()
+
+	var out bytes.Buffer
+	exportPath := filepath.Join(dir, "export.json")
+	if err := runCommand(&Config{DBPath: source}, []string{"export", "-o", exportPath}, &out); err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Exported 2 projects, 4 tasks") {
+		t.Errorf("unexpected export output:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := runCommand(&Config{DBPath: source}, []string{"export", "-format", "markdown", "-project", "2"}, &out); err != nil {
+		t.Fatalf("markdown export failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "## Other (#2)") || strings.Contains(out.String(), "## Launch") {
+		t.Errorf("expected only the project in the markdown:\n%s", out.String())
+	}
+
+	out.Reset()
+	target := filepath.Join(dir, "target.db")
+	if err := runCommand(&Config{DBPath: target}, []string{"import", "-preserve-ids", exportPath}, &out); err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "task note") || !strings.Contains(out.String(), "4") {
+		t.Errorf("unexpected import output:\n%s", out.String())
+	}
+
+	os.WriteFile(filepath.Join(dir, "bad.json"), []byte("not json"), 0o600)
+	for _, args := range [][]string{
+		{"export", "-format", "xml"},
+		{"export", "-project", "99"},
+		{"import"},
+		{"import", filepath.Join(dir, "bad.json")},
+		{"import", "-preserve-ids", exportPath},
+	} {
+		if err := runCommand(&Config{DBPath: target}, args, &out); err == nil {
+			t.Errorf("expected %v to fail", args)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultGitHubAPIURL is the GitHub REST API that issues are synced with
+const DefaultGitHubAPIURL = "https://api.github.com"
+
+// githubLabelTypes and githubLabelPriorities map issue labels to task types
+// and priorities. Labels are matched without case and without any prefix up
+// to a ':' or '/', so "type: bug" and "priority/high" match too.
+var (
+	githubLabelTypes = map[string]string{
+		"bug":           "bugfix",
+		"enhancement":   "feature",
+		"feature":       "feature",
+		"chore":         "chore",
+		"maintenance":   "chore",
+		"question":      "investigation",
+		"investigation": "investigation",
+	}
+	githubLabelPriorities = map[string]string{
+		"p0":       "urgent",
+		"critical": "urgent",
+		"urgent":   "urgent",
+		"p1":       "high",
+		"high":     "high",
+		"p2":       "medium",
+		"medium":   "medium",
+		"p3":       "low",
+		"low":      "low",
+	}
+)
+
+// GitHubClient syncs issues with GitHub repositories, named owner/repo,
+// through the REST API
+type GitHubClient struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+// NewGitHubClient returns a client for the GitHub API at baseURL, which is
+// DefaultGitHubAPIURL unless it's GitHub Enterprise or a fake for testing
+func NewGitHubClient(baseURL, token string) *GitHubClient {
+	return &GitHubClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type githubIssue struct {
+	Number      int64     `json:"number"`
+	Title       string    `json:"title"`
+	Body        string    `json:"body"`
+	State       string    `json:"state"`
+	HTMLURL     string    `json:"html_url"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	PullRequest *struct{} `json:"pull_request"`
+	Labels      []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+}
+
+func (i *githubIssue) remote() *RemoteIssue {
+	issue := &RemoteIssue{
+		ID:        strconv.FormatInt(i.Number, 10),
+		Title:     i.Title,
+		Body:      i.Body,
+		URL:       i.HTMLURL,
+		Done:      i.State == "closed",
+		UpdatedAt: i.UpdatedAt,
+	}
+	for _, label := range i.Labels {
+		name := strings.ToLower(label.Name)
+		if n := strings.LastIndexAny(name, ":/"); n >= 0 {
+			name = name[n+1:]
+		}
+		name = strings.TrimSpace(name)
+		if t, ok := githubLabelTypes[name]; ok && issue.TaskType == "" {
+			issue.TaskType = t
+		}
+		if p, ok := githubLabelPriorities[name]; ok && issue.Priority == "" {
+			issue.Priority = p
+		}
+	}
+	return issue
+}
+
+// ListIssues returns the issues of a repository, open or closed, that were
+// updated since a time if one is given. Pull requests, which GitHub lists as
+// issues too, are left out.
+func (c *GitHubClient) ListIssues(repo string, since *time.Time) ([]*RemoteIssue, error) {
+	query := url.Values{"state": {"all"}, "per_page": {"100"}}
+	if since != nil {
+		query.Set("since", since.UTC().Format(time.RFC3339))
+	}
+	var issues []*RemoteIssue
+	for page := 1; ; page++ {
+		var batch []*githubIssue
+		query.Set("page", strconv.Itoa(page))
+		path := fmt.Sprintf("/repos/%s/issues?%s", repo, query.Encode())
+		if err := c.do(http.MethodGet, path, nil, &batch); err != nil {
+			return nil, err
+		}
+		for _, i := range batch {
+			if i.PullRequest == nil {
+				issues = append(issues, i.remote())
+			}
+		}
+		if len(batch) < 100 {
+			return issues, nil
+		}
+	}
+}
+
+// GetIssue returns an issue of a repository
+func (c *GitHubClient) GetIssue(repo, id string) (*RemoteIssue, error) {
+	var issue githubIssue
+	if err := c.do(http.MethodGet, fmt.Sprintf("/repos/%s/issues/%s", repo, id), nil, &issue); err != nil {
+		return nil, err
+	}
+	return issue.remote(), nil
+}
+
+// SetIssueStatus closes an issue for completed tasks and reopens it for the
+// rest
+func (c *GitHubClient) SetIssueStatus(repo, id, status string) (*RemoteIssue, error) {
+	state := "open"
+	if status == "completed" {
+		state = "closed"
+	}
+	var issue githubIssue
+	if err := c.do(http.MethodPatch, fmt.Sprintf("/repos/%s/issues/%s", repo, id), map[string]string{"state": state}, &issue); err != nil {
+		return nil, err
+	}
+	return issue.remote(), nil
+}
+
+// AddComment comments on an issue
+func (c *GitHubClient) AddComment(repo, id, body string) (*RemoteComment, error) {
+	var comment struct {
+		ID        int64     `json:"id"`
+		Body      string    `json:"body"`
+		CreatedAt time.Time `json:"created_at"`
+		User      struct {
+			Login string `json:"login"`
+		} `json:"user"`
+	}
+	if err := c.do(http.MethodPost, fmt.Sprintf("/repos/%s/issues/%s/comments", repo, id), map[string]string{"body": body}, &comment); err != nil {
+		return nil, err
+	}
+	return &RemoteComment{ID: strconv.FormatInt(comment.ID, 10), Author: comment.User.Login, Body: comment.Body, CreatedAt: comment.CreatedAt}, nil
+}
+
+// do sends a request to the API, decoding the JSON response into result
+func (c *GitHubClient) do(method, path string, body, result interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.baseURL+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach GitHub at %s: %w", c.baseURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("GitHub %s %s returned %s: %s", method, path, resp.Status, apiErr.Message)
+		}
+		return fmt.Errorf("GitHub %s %s returned %s", method, path, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("invalid response from GitHub: %w", err)
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ go 1.23.2
 toolchain go1.24.12
 
 require (
+	github.com/BurntSushi/toml v1.5.0
 	github.com/mark3labs/mcp-go v0.43.2
 	modernc.org/sqlite v1.34.4
 )
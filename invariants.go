@@ -0,0 +1,136 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidReference is wrapped by errors returned when a create or update
+// refers to a project or task that does not exist.
+var ErrInvalidReference = errors.New("invalid reference")
+
+// ProjectMismatchError is returned when a problem, goal or outcome is linked
+// to a task that belongs to a different project than the item itself.
+type ProjectMismatchError struct {
+	Entity        string
+	TaskID        int64
+	TaskProjectID int64
+	ProjectID     int64
+}
+
+func (e *ProjectMismatchError) Error() string {
+	return fmt.Sprintf("task %d belongs to project %d, but the %s is in project %d", e.TaskID, e.TaskProjectID, e.Entity, e.ProjectID)
+}
+
+// checkTaskProject verifies that the referenced project and task exist and,
+// when both are set, that the task belongs to that project.
+func (d *Database) checkTaskProject(entity string, projectID, taskID *int64) error {
+	if projectID != nil {
+		if _, err := d.GetProject(*projectID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("%w: project with ID %d does not exist", ErrInvalidReference, *projectID)
+			}
+			return err
+		}
+	}
+	if taskID == nil {
+		return nil
+	}
+
+	task, err := d.GetTask(*taskID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: task with ID %d does not exist", ErrInvalidReference, *taskID)
+		}
+		return err
+	}
+	if projectID != nil && task.ProjectID != *projectID {
+		return &ProjectMismatchError{Entity: entity, TaskID: task.ID, TaskProjectID: task.ProjectID, ProjectID: *projectID}
+	}
+	return nil
+}
+
+// firstInt64 returns the first non-nil value
+func firstInt64(values ...*int64) *int64 {
+	for _, v := range values {
+		if v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// IntegrityIssue describes a row that breaks one of the database invariants
+type IntegrityIssue struct {
+	Entity  string `json:"entity"`
+	ID      int64  `json:"id"`
+	Problem string `json:"problem"`
+}
+
+// CheckIntegrity reports rows that reference missing rows, and problems,
+// goals, outcomes and subtasks whose task belongs to a different project. It
+// does not modify the database.
+func (d *Database) CheckIntegrity() ([]IntegrityIssue, error) {
+	issues := []IntegrityIssue{}
+
+	rows, err := d.db.Query("PRAGMA foreign_key_check")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var table, parent string
+		var rowID sql.NullInt64
+		var fkID int
+		if err := rows.Scan(&table, &rowID, &parent, &fkID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		issues = append(issues, IntegrityIssue{
+			Entity:  table,
+			ID:      rowID.Int64,
+			Problem: fmt.Sprintf("references a missing row in %s", parent),
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, check := range []struct {
+		entity string
+		table  string
+		column string
+		name   string
+	}{
+		{EntityProblem, "problems", "task_id", EntityProblem},
+		{EntityGoal, "goals", "task_id", EntityGoal},
+		{EntityOutcome, "outcomes", "task_id", EntityOutcome},
+		{EntityTask, "tasks", "parent_task_id", "subtask"},
+	} {
+		rows, err := d.db.Query(fmt.Sprintf(`
+			SELECT x.id, x.project_id, t.id, t.project_id
+			FROM %s x JOIN tasks t ON t.id = x.%s
+			WHERE x.project_id IS NOT NULL AND x.project_id != t.project_id
+			ORDER BY x.id`, check.table, check.column))
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var e ProjectMismatchError
+			var id int64
+			if err := rows.Scan(&id, &e.ProjectID, &e.TaskID, &e.TaskProjectID); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			e.Entity = check.name
+			issues = append(issues, IntegrityIssue{Entity: check.entity, ID: id, Problem: e.Error()})
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return issues, nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreateRejectsMismatchedTaskProject(t *testing.T) {
+	db := newTestDatabase(t)
+
+	p1, _ := db.CreateProject("P1", "", "", "", nil, nil)
+	p2, _ := db.CreateProject("P2", "", "", "", nil, nil)
+	task, _ := db.CreateTask(p1.ID, nil, "T", "", "pending", "low", "general", "", "", "", nil, nil)
+
+	var mismatch *ProjectMismatchError
+	if _, err := db.CreateProblem(&p2.ID, &task.ID, "Problem", "", "open", ""); !errors.As(err, &mismatch) {
+		t.Errorf("expected ProjectMismatchError for problem, got %v", err)
+	} else if mismatch.TaskProjectID != p1.ID || mismatch.ProjectID != p2.ID {
+		t.Errorf("unexpected mismatch details: %+v", mismatch)
+	}
+	if _, err := db.CreateGoal(&p2.ID, &task.ID, "Goal", "", "career", "", nil, nil); !errors.As(err, &mismatch) {
+		t.Errorf("expected ProjectMismatchError for goal, got %v", err)
+	}
+	if _, err := db.CreateOutcome(p2.ID, &task.ID, "Outcome", "", "open", nil, nil); !errors.As(err, &mismatch) {
+		t.Errorf("expected ProjectMismatchError for outcome, got %v", err)
+	}
+
+	// Matching pairs and task-only links are fine
+	if _, err := db.CreateProblem(&p1.ID, &task.ID, "Problem", "", "open", ""); err != nil {
+		t.Errorf("expected matching problem to be created: %v", err)
+	}
+	if _, err := db.CreateGoal(nil, &task.ID, "Goal", "", "career", "", nil, nil); err != nil {
+		t.Errorf("expected task-only goal to be created: %v", err)
+	}
+}
+
+func TestCreateRejectsMissingReferences(t *testing.T) {
+	db := newTestDatabase(t)
+
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	missing := int64(9999)
+
+	if _, err := db.CreateTask(missing, nil, "T", "", "pending", "low", "general", "", "", "", nil, nil); !errors.Is(err, ErrInvalidReference) {
+		t.Errorf("expected ErrInvalidReference for task, got %v", err)
+	}
+	if _, err := db.CreateProblem(nil, &missing, "Problem", "", "open", ""); !errors.Is(err, ErrInvalidReference) {
+		t.Errorf("expected ErrInvalidReference for problem task, got %v", err)
+	}
+	if _, err := db.CreateGoal(&missing, nil, "Goal", "", "career", "", nil, nil); !errors.Is(err, ErrInvalidReference) {
+		t.Errorf("expected ErrInvalidReference for goal project, got %v", err)
+	}
+	if _, err := db.CreateOutcome(project.ID, &missing, "Outcome", "", "open", nil, nil); !errors.Is(err, ErrInvalidReference) {
+		t.Errorf("expected ErrInvalidReference for outcome task, got %v", err)
+	}
+}
+
+func TestUpdateRelinkChecksTaskProject(t *testing.T) {
+	db := newTestDatabase(t)
+
+	p1, _ := db.CreateProject("P1", "", "", "", nil, nil)
+	p2, _ := db.CreateProject("P2", "", "", "", nil, nil)
+	t1, _ := db.CreateTask(p1.ID, nil, "T1", "", "pending", "low", "general", "", "", "", nil, nil)
+	t2, _ := db.CreateTask(p2.ID, nil, "T2", "", "pending", "low", "general", "", "", "", nil, nil)
+
+	problem, _ := db.CreateProblem(&p1.ID, &t1.ID, "Problem", "", "open", "")
+	outcome, _ := db.CreateOutcome(p1.ID, &t1.ID, "Outcome", "", "open", nil, nil)
+	goal, _ := db.CreateGoal(&p1.ID, nil, "Goal", "", "career", "", nil, nil)
+
+	var mismatch *ProjectMismatchError
+	if _, err := db.UpdateProblem(problem.ID, nil, nil, nil, nil, nil, &t2.ID); !errors.As(err, &mismatch) {
+		t.Errorf("expected moving problem to another project's task to fail, got %v", err)
+	}
+	if _, err := db.UpdateOutcome(outcome.ID, nil, nil, nil, &p2.ID, nil, nil, nil); !errors.As(err, &mismatch) {
+		t.Errorf("expected moving outcome away from its task's project to fail, got %v", err)
+	}
+	if _, err := db.UpdateGoal(goal.ID, nil, nil, nil, nil, nil, &t2.ID, nil, nil); !errors.As(err, &mismatch) {
+		t.Errorf("expected linking goal to another project's task to fail, got %v", err)
+	}
+
+	// Moving project and task together is allowed
+	moved, err := db.UpdateProblem(problem.ID, nil, nil, nil, nil, &p2.ID, &t2.ID)
+	if err != nil {
+		t.Fatalf("failed to re-link problem: %v", err)
+	}
+	if *moved.ProjectID != p2.ID || *moved.TaskID != t2.ID {
+		t.Errorf("unexpected problem after re-link: %+v", moved)
+	}
+	updatedOutcome, err := db.UpdateOutcome(outcome.ID, nil, nil, nil, &p2.ID, &t2.ID, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to re-link outcome: %v", err)
+	}
+	if updatedOutcome.ProjectID != p2.ID || *updatedOutcome.TaskID != t2.ID {
+		t.Errorf("unexpected outcome after re-link: %+v", updatedOutcome)
+	}
+}
+
+func TestCheckIntegrity(t *testing.T) {
+	db := newTestDatabase(t)
+
+	p1, _ := db.CreateProject("P1", "", "", "", nil, nil)
+	p2, _ := db.CreateProject("P2", "", "", "", nil, nil)
+	task, _ := db.CreateTask(p1.ID, nil, "T", "", "pending", "low", "general", "", "", "", nil, nil)
+	problem, _ := db.CreateProblem(&p1.ID, &task.ID, "Problem", "", "open", "")
+
+	issues, err := db.CheckIntegrity()
+	if err != nil {
+		t.Fatalf("failed to check integrity: %v", err)
+	}
+	if len(issues) != 0 {
+		t.Fatalf("expected no issues, got %+v", issues)
+	}
+
+	// Simulate data written before the invariants were enforced
+	if _, err := db.db.Exec("UPDATE problems SET project_id = ? WHERE id = ?", p2.ID, problem.ID); err != nil {
+		t.Fatalf("failed to corrupt problem: %v", err)
+	}
+
+	issues, err = db.CheckIntegrity()
+	if err != nil {
+		t.Fatalf("failed to check integrity: %v", err)
+	}
+	if len(issues) != 1 || issues[0].Entity != EntityProblem || issues[0].ID != problem.ID {
+		t.Fatalf("expected one problem issue, got %+v", issues)
+	}
+}
+
+func TestDoctorCommand(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "loom.db")
+	db, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	p1, _ := db.CreateProject("P1", "", "", "", nil, nil)
+	p2, _ := db.CreateProject("P2", "", "", "", nil, nil)
+	task, _ := db.CreateTask(p1.ID, nil, "T", "", "pending", "low", "general", "", "", "", nil, nil)
+	goal, _ := db.CreateGoal(&p1.ID, &task.ID, "Goal", "", "career", "", nil, nil)
+
+	var out bytes.Buffer
+	if err := runCommand(&Config{DBPath: dbPath}, []string{"doctor"}, &out); err != nil {
+		t.Fatalf("expected clean database to pass: %v\n%s", err, out.String())
+	}
+
+	db.db.Exec("UPDATE goals SET project_id = ? WHERE id = ?", p2.ID, goal.ID)
+	db.Close()
+
+	out.Reset()
+	if err := runCommand(&Config{DBPath: dbPath}, []string{"doctor"}, &out); err == nil {
+		t.Fatal("expected doctor to fail on a mismatched goal")
+	}
+	if !strings.Contains(out.String(), "goal 1: task 1 belongs to project 1") {
+		t.Errorf("unexpected doctor output:\n%s", out.String())
+	}
+}
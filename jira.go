@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// jiraFields are the issue fields sync reads
+const jiraFields = "summary,description,status,priority,issuetype,parent,updated,comment"
+
+// jiraIssueTypes and jiraPriorities map Jira issue types and priorities,
+// matched without case, to task types and priorities. Epics are synced as
+// projects instead.
+var (
+	jiraIssueTypes = map[string]string{
+		"bug":           "bugfix",
+		"story":         "feature",
+		"feature":       "feature",
+		"new feature":   "feature",
+		"improvement":   "feature",
+		"chore":         "chore",
+		"spike":         "investigation",
+		"research":      "investigation",
+		"investigation": "investigation",
+	}
+	jiraPriorities = map[string]string{
+		"highest":  "urgent",
+		"blocker":  "urgent",
+		"critical": "urgent",
+		"high":     "high",
+		"major":    "high",
+		"medium":   "medium",
+		"low":      "low",
+		"minor":    "low",
+		"lowest":   "low",
+		"trivial":  "low",
+	}
+)
+
+// jiraCategoryStatuses map Jira's status categories to task statuses, for
+// Jira statuses the status mapping does not name
+var jiraCategoryStatuses = map[string]string{
+	"new":           "pending",
+	"indeterminate": "in_progress",
+	"done":          "completed",
+}
+
+// JiraClient syncs issues with Jira projects, named by their key, through
+// the REST API of Jira Cloud, Server or Data Center
+type JiraClient struct {
+	baseURL  string
+	email    string
+	token    string
+	statuses map[string]string
+	client   *http.Client
+}
+
+// NewJiraClient returns a client for the Jira site at baseURL. Jira Cloud
+// takes the account's email with an API token, and Server and Data Center a
+// personal access token alone. statuses maps Jira status names to task
+// statuses. Requests go through transport, or http.DefaultTransport if it
+// is nil, so they can be served by a mock or replayed from a recording.
+func NewJiraClient(baseURL, email, token string, statuses map[string]string, transport http.RoundTripper) *JiraClient {
+	lower := map[string]string{}
+	for name, status := range statuses {
+		lower[strings.ToLower(name)] = status
+	}
+	return &JiraClient{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		email:    email,
+		token:    token,
+		statuses: lower,
+		client:   &http.Client{Timeout: 30 * time.Second, Transport: transport},
+	}
+}
+
+// jiraTime reads Jira's timestamps, such as 2026-03-01T09:30:00.000+0000
+type jiraTime struct {
+	time.Time
+}
+
+func (t *jiraTime) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.Parse("2006-01-02T15:04:05.000-0700", s)
+	if err != nil {
+		return fmt.Errorf("invalid Jira time %q", s)
+	}
+	t.Time = parsed
+	return nil
+}
+
+type jiraComment struct {
+	ID     string `json:"id"`
+	Body   string `json:"body"`
+	Author struct {
+		DisplayName string `json:"displayName"`
+	} `json:"author"`
+	Created jiraTime `json:"created"`
+}
+
+type jiraIssue struct {
+	Key    string `json:"key"`
+	Fields struct {
+		Summary     string `json:"summary"`
+		Description string `json:"description"`
+		Status      struct {
+			Name           string `json:"name"`
+			StatusCategory struct {
+				Key string `json:"key"`
+			} `json:"statusCategory"`
+		} `json:"status"`
+		Priority *struct {
+			Name string `json:"name"`
+		} `json:"priority"`
+		IssueType struct {
+			Name string `json:"name"`
+		} `json:"issuetype"`
+		Parent *struct {
+			Key    string `json:"key"`
+			Fields struct {
+				IssueType struct {
+					Name string `json:"name"`
+				} `json:"issuetype"`
+			} `json:"fields"`
+		} `json:"parent"`
+		Updated jiraTime `json:"updated"`
+		Comment struct {
+			Comments []*jiraComment `json:"comments"`
+		} `json:"comment"`
+	} `json:"fields"`
+}
+
+func (c *JiraClient) remote(i *jiraIssue) *RemoteIssue {
+	f := &i.Fields
+	status := c.statuses[strings.ToLower(f.Status.Name)]
+	if status == "" {
+		status = jiraCategoryStatuses[f.Status.StatusCategory.Key]
+	}
+	issue := &RemoteIssue{
+		ID:        i.Key,
+		Title:     f.Summary,
+		Body:      f.Description,
+		URL:       c.baseURL + "/browse/" + i.Key,
+		Done:      f.Status.StatusCategory.Key == "done",
+		Status:    status,
+		TaskType:  jiraIssueTypes[strings.ToLower(f.IssueType.Name)],
+		IsEpic:    strings.EqualFold(f.IssueType.Name, "epic"),
+		UpdatedAt: f.Updated.Time,
+	}
+	if f.Priority != nil {
+		issue.Priority = jiraPriorities[strings.ToLower(f.Priority.Name)]
+	}
+	if f.Parent != nil && strings.EqualFold(f.Parent.Fields.IssueType.Name, "epic") {
+		issue.Epic = f.Parent.Key
+	}
+	for _, comment := range f.Comment.Comments {
+		issue.Comments = append(issue.Comments, comment.remote())
+	}
+	return issue
+}
+
+func (c *jiraComment) remote() *RemoteComment {
+	return &RemoteComment{ID: c.ID, Author: c.Author.DisplayName, Body: c.Body, CreatedAt: c.Created.Time}
+}
+
+// ListIssues returns the issues of a Jira project, epics included, oldest
+// update first. Given a time, it only returns the issues updated since,
+// asking for them relative to Jira's clock, since JQL dates are read in the
+// Jira user's time zone. A minute's margin allows for the two clocks
+// differing.
+func (c *JiraClient) ListIssues(project string, since *time.Time) ([]*RemoteIssue, error) {
+	jql := fmt.Sprintf("project = %q", project)
+	if since != nil {
+		minutes := max(int(math.Ceil(time.Since(*since).Minutes())), 0) + 1
+		jql += fmt.Sprintf(" AND updated >= -%dm", minutes)
+	}
+	jql += " ORDER BY updated ASC"
+
+	var issues []*RemoteIssue
+	for start := 0; ; {
+		query := url.Values{"jql": {jql}, "fields": {jiraFields}, "startAt": {fmt.Sprint(start)}, "maxResults": {"100"}}
+		var page struct {
+			Total  int          `json:"total"`
+			Issues []*jiraIssue `json:"issues"`
+		}
+		if err := c.do(http.MethodGet, "/rest/api/2/search?"+query.Encode(), nil, &page); err != nil {
+			return nil, err
+		}
+		for _, i := range page.Issues {
+			issues = append(issues, c.remote(i))
+		}
+		start += len(page.Issues)
+		if len(page.Issues) == 0 || start >= page.Total {
+			return issues, nil
+		}
+	}
+}
+
+// GetIssue returns an issue by its key
+func (c *JiraClient) GetIssue(project, key string) (*RemoteIssue, error) {
+	var issue jiraIssue
+	if err := c.do(http.MethodGet, "/rest/api/2/issue/"+url.PathEscape(key)+"?fields="+jiraFields, nil, &issue); err != nil {
+		return nil, err
+	}
+	return c.remote(&issue), nil
+}
+
+// SetIssueStatus moves an issue to the Jira status a task status maps to,
+// through one of the workflow transitions open to it. Transitions to a
+// status the mapping names win over those to a status in the same category.
+func (c *JiraClient) SetIssueStatus(project, key, status string) (*RemoteIssue, error) {
+	var names []string
+	for name, s := range c.statuses {
+		if s == status {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var category string
+	for k, s := range jiraCategoryStatuses {
+		if s == status {
+			category = k
+		}
+	}
+
+	path := "/rest/api/2/issue/" + url.PathEscape(key) + "/transitions"
+	var result struct {
+		Transitions []struct {
+			ID string `json:"id"`
+			To struct {
+				Name           string `json:"name"`
+				StatusCategory struct {
+					Key string `json:"key"`
+				} `json:"statusCategory"`
+			} `json:"to"`
+		} `json:"transitions"`
+	}
+	if err := c.do(http.MethodGet, path, nil, &result); err != nil {
+		return nil, err
+	}
+	transition := ""
+	for _, t := range result.Transitions {
+		for _, name := range names {
+			if strings.EqualFold(t.To.Name, name) {
+				transition = t.ID
+				break
+			}
+		}
+		if transition != "" {
+			break
+		}
+	}
+	if transition == "" && category != "" {
+		for _, t := range result.Transitions {
+			if t.To.StatusCategory.Key == category && c.statuses[strings.ToLower(t.To.Name)] == "" {
+				transition = t.ID
+				break
+			}
+		}
+	}
+	if transition == "" {
+		return nil, fmt.Errorf("no transition of Jira issue %s leads to a status for %s", key, status)
+	}
+
+	body := map[string]interface{}{"transition": map[string]string{"id": transition}}
+	if err := c.do(http.MethodPost, path, body, nil); err != nil {
+		return nil, err
+	}
+	return c.GetIssue(project, key)
+}
+
+// AddComment comments on an issue
+func (c *JiraClient) AddComment(project, key, body string) (*RemoteComment, error) {
+	var comment jiraComment
+	if err := c.do(http.MethodPost, "/rest/api/2/issue/"+url.PathEscape(key)+"/comment", map[string]string{"body": body}, &comment); err != nil {
+		return nil, err
+	}
+	return comment.remote(), nil
+}
+
+// do sends a request to the API, decoding the JSON response into result
+// unless it is nil
+func (c *JiraClient) do(method, path string, body, result interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.baseURL+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	switch {
+	case c.email != "":
+		req.SetBasicAuth(c.email, c.token)
+	case c.token != "":
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach Jira at %s: %w", c.baseURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiErr struct {
+			ErrorMessages []string `json:"errorMessages"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && len(apiErr.ErrorMessages) > 0 {
+			return fmt.Errorf("Jira %s %s returned %s: %s", method, path, resp.Status, strings.Join(apiErr.ErrorMessages, "; "))
+		}
+		return fmt.Errorf("Jira %s %s returned %s", method, path, resp.Status)
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("invalid response from Jira: %w", err)
+	}
+	return nil
+}
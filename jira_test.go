@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const jiraTimeLayout = "2006-01-02T15:04:05.000-0700"
+
+// jiraStatusCategories are the statuses of the fake Jira's workflow, by
+// name, with their category
+var jiraStatusCategories = map[string]string{"To Do": "new", "In Progress": "indeterminate", "Waiting": "indeterminate", "Done": "done"}
+
+// fakeJira serves the parts of the Jira REST API that sync uses, for the
+// APP project, with a workflow that can move any issue to any status
+type fakeJira struct {
+	mu       sync.Mutex
+	issues   []map[string]interface{}
+	comments int
+	jql      []string
+}
+
+func newFakeJira(t *testing.T) (*fakeJira, *httptest.Server) {
+	t.Helper()
+	jira := &fakeJira{}
+	updatedPattern := regexp.MustCompile(`updated >= -(\d+)m`)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /rest/api/2/search", func(w http.ResponseWriter, r *http.Request) {
+		jira.mu.Lock()
+		defer jira.mu.Unlock()
+		jql := r.URL.Query().Get("jql")
+		jira.jql = append(jira.jql, jql)
+		var issues []map[string]interface{}
+		for _, issue := range jira.issues {
+			if m := updatedPattern.FindStringSubmatch(jql); m != nil {
+				minutes, _ := strconv.Atoi(m[1])
+				updated, _ := time.Parse(jiraTimeLayout, issue["fields"].(map[string]interface{})["updated"].(string))
+				if updated.Before(time.Now().Add(-time.Duration(minutes) * time.Minute)) {
+					continue
+				}
+			}
+			issues = append(issues, issue)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"startAt": 0, "maxResults": 100, "total": len(issues), "issues": issues})
+	})
+	mux.HandleFunc("GET /rest/api/2/issue/{key}", func(w http.ResponseWriter, r *http.Request) {
+		jira.mu.Lock()
+		defer jira.mu.Unlock()
+		json.NewEncoder(w).Encode(jira.issue(r.PathValue("key")))
+	})
+	mux.HandleFunc("GET /rest/api/2/issue/{key}/transitions", func(w http.ResponseWriter, r *http.Request) {
+		var transitions []map[string]interface{}
+		for _, name := range []string{"To Do", "In Progress", "Waiting", "Done"} {
+			transitions = append(transitions, map[string]interface{}{
+				"id": "t-" + name,
+				"to": map[string]interface{}{"name": name, "statusCategory": map[string]string{"key": jiraStatusCategories[name]}},
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"transitions": transitions})
+	})
+	mux.HandleFunc("POST /rest/api/2/issue/{key}/transitions", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Transition struct {
+				ID string `json:"id"`
+			} `json:"transition"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		jira.update(r.PathValue("key"), time.Now(), map[string]interface{}{"status": jiraStatus(strings.TrimPrefix(req.Transition.ID, "t-"))})
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /rest/api/2/issue/{key}/comment", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		jira.mu.Lock()
+		jira.comments++
+		comment := jiraCommentJSON(fmt.Sprint(10000+jira.comments), "Loom Bot", req["body"], time.Now())
+		jira.mu.Unlock()
+		jira.update(r.PathValue("key"), time.Now(), nil)
+		jira.mu.Lock()
+		fields := jira.issue(r.PathValue("key"))["fields"].(map[string]interface{})
+		c := fields["comment"].(map[string]interface{})
+		c["comments"] = append(c["comments"].([]interface{}), comment)
+		jira.mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(comment)
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "me@example.com" || pass != "jira_test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string][]string{"errorMessages": {"You are not authenticated"}})
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return jira, srv
+}
+
+func jiraStatus(name string) map[string]interface{} {
+	return map[string]interface{}{"name": name, "statusCategory": map[string]string{"key": jiraStatusCategories[name]}}
+}
+
+func jiraCommentJSON(id, author, body string, created time.Time) map[string]interface{} {
+	return map[string]interface{}{"id": id, "body": body, "author": map[string]string{"displayName": author}, "created": created.Format(jiraTimeLayout)}
+}
+
+// add adds an issue of a type, in a status and with a priority, belonging
+// to an epic if epic is set
+func (jira *fakeJira) add(key, issueType, summary, status, priority, epic string, comments ...interface{}) {
+	fields := map[string]interface{}{
+		"summary":     summary,
+		"description": "About " + summary,
+		"status":      jiraStatus(status),
+		"issuetype":   map[string]string{"name": issueType},
+		"updated":     time.Now().Add(-time.Hour).Format(jiraTimeLayout),
+		"comment":     map[string]interface{}{"comments": append([]interface{}{}, comments...)},
+	}
+	if priority != "" {
+		fields["priority"] = map[string]string{"name": priority}
+	}
+	if epic != "" {
+		fields["parent"] = map[string]interface{}{"key": epic, "fields": map[string]interface{}{"issuetype": map[string]string{"name": "Epic"}}}
+	}
+	jira.issues = append(jira.issues, map[string]interface{}{"key": key, "fields": fields})
+}
+
+// update changes an issue's fields as if someone edited it at time at
+func (jira *fakeJira) update(key string, at time.Time, fields map[string]interface{}) {
+	jira.mu.Lock()
+	defer jira.mu.Unlock()
+	f := jira.issue(key)["fields"].(map[string]interface{})
+	for k, v := range fields {
+		f[k] = v
+	}
+	f["updated"] = at.Format(jiraTimeLayout)
+}
+
+func (jira *fakeJira) issue(key string) map[string]interface{} {
+	for _, issue := range jira.issues {
+		if issue["key"] == key {
+			return issue
+		}
+	}
+	return nil
+}
+
+func (jira *fakeJira) status(key string) string {
+	jira.mu.Lock()
+	defer jira.mu.Unlock()
+	return jira.issue(key)["fields"].(map[string]interface{})["status"].(map[string]interface{})["name"].(string)
+}
+
+func TestSyncJiraIssues(t *testing.T) {
+	db := newTestDatabase(t)
+	jira, srv := newFakeJira(t)
+	db.SetIssueTrackers(map[string]IssueTracker{"jira": NewJiraClient(srv.URL, "me@example.com", "jira_test", map[string]string{"Waiting": "blocked"}, nil)})
+
+	platform, _ := db.CreateProject("Platform", "", "", "", nil, nil)
+	link, err := db.CreateSyncLink(platform.ID, "jira", "APP")
+	if err != nil {
+		t.Fatalf("failed to create sync link: %v", err)
+	}
+	jira.add("APP-1", "Epic", "Checkout", "To Do", "", "")
+	jira.add("APP-2", "Story", "Pay by card", "In Progress", "High", "APP-1", jiraCommentJSON("500", "Ana", "Use the card provider's SDK", time.Now().Add(-time.Hour)))
+	jira.add("APP-3", "Bug", "Crash on start", "Waiting", "Highest", "")
+
+	// A dry run only describes the changes
+	result, err := db.SyncIssues(link.ID, true)
+	if err != nil {
+		t.Fatalf("failed to dry-run sync: %v", err)
+	}
+	if !result.DryRun || result.Projects != 1 || result.Created != 2 || result.Notes != 1 || len(result.Changes) != 4 {
+		t.Errorf("expected an epic, 2 issues and a comment to be imported, got %+v", result)
+	}
+	if result.Changes[0] != `create project "Checkout" from epic APP-1` {
+		t.Errorf("expected the epic first, got %v", result.Changes)
+	}
+	projects, _ := db.ListProjects(nil)
+	link, _ = db.GetSyncLink(link.ID)
+	if len(projects) != 1 || link.LastSyncedAt != nil {
+		t.Errorf("expected the dry run to change nothing, got %d projects and %+v", len(projects), link)
+	}
+
+	// Epics become projects, issues tasks and comments notes
+	result, err = db.SyncIssues(link.ID, false)
+	if err != nil || len(result.Errors) != 0 {
+		t.Fatalf("failed to sync: %v %v", err, result)
+	}
+	if result.Projects != 1 || result.Created != 2 || result.Notes != 1 {
+		t.Errorf("expected the same changes as the dry run, got %+v", result)
+	}
+	pay, _ := db.GetTask(syncedTaskID(t, db, "APP-2"))
+	crash, _ := db.GetTask(syncedTaskID(t, db, "APP-3"))
+	checkout, _ := db.GetProject(pay.ProjectID)
+	if checkout.Name != "Checkout" || checkout.ExternalLink != srv.URL+"/browse/APP-1" {
+		t.Errorf("expected the epic's project, got %+v", checkout)
+	}
+	if pay.TaskType != "feature" || pay.Priority != "high" || pay.Status != "in_progress" {
+		t.Errorf("expected the story's fields, got %+v", pay)
+	}
+	if crash.ProjectID != platform.ID || crash.TaskType != "bugfix" || crash.Priority != "urgent" || crash.Status != "blocked" {
+		t.Errorf("expected the bug in the linked project with the mapped status, got %+v", crash)
+	}
+	notes, _ := db.ListTaskNotes(pay.ID)
+	if len(notes) != 1 || notes[0].Note != "Ana: Use the card provider's SDK" {
+		t.Errorf("expected the comment as a note, got %+v", notes)
+	}
+
+	// Later syncs only ask for recent updates
+	if result, _ := db.SyncIssues(link.ID, false); len(result.Changes) != 0 {
+		t.Errorf("expected an idle sync, got %+v", result.Changes)
+	}
+	if jql := jira.jql[len(jira.jql)-1]; !strings.Contains(jql, `project = "APP" AND updated >= -`) {
+		t.Errorf("expected an incremental search, got %q", jql)
+	}
+
+	// Task changes and notes are pushed, and pushed notes are not pulled back
+	completed := "completed"
+	db.UpdateTask(pay.ID, nil, nil, &completed, nil, nil, nil, nil, nil, nil, nil, nil)
+	touchTask(t, db, pay.ID, time.Now().Add(time.Minute))
+	db.CreateTaskNote(pay.ID, "Shipped behind a flag")
+	result, _ = db.SyncIssues(link.ID, false)
+	if result.Pushed != 1 || result.Comments != 1 || jira.status("APP-2") != "Done" {
+		t.Errorf("expected the issue to be done with a comment, got %+v, %s", result, jira.status("APP-2"))
+	}
+	if result, _ := db.SyncIssues(link.ID, false); len(result.Changes) != 0 {
+		t.Errorf("expected the pushed changes not to come back, got %+v", result.Changes)
+	}
+	if notes, _ := db.ListTaskNotes(pay.ID); len(notes) != 2 {
+		t.Errorf("expected 2 notes, got %+v", notes)
+	}
+
+	// Issue changes update their tasks and epics their projects
+	jira.update("APP-3", time.Now(), map[string]interface{}{"status": jiraStatus("Done")})
+	jira.update("APP-1", time.Now(), map[string]interface{}{"summary": "Checkout v2"})
+	result, _ = db.SyncIssues(link.ID, false)
+	crash, _ = db.GetTask(crash.ID)
+	checkout, _ = db.GetProject(checkout.ID)
+	if result.Updated != 2 || crash.Status != "completed" || checkout.Name != "Checkout v2" {
+		t.Errorf("expected the changes to be pulled, got %+v, %q, %q", result, crash.Status, checkout.Name)
+	}
+
+	// Reopened issues move their tasks to a status the workflow allows from
+	// completed, rather than the pending their category maps to
+	jira.update("APP-3", time.Now().Add(time.Minute), map[string]interface{}{"status": jiraStatus("To Do")})
+	result, _ = db.SyncIssues(link.ID, false)
+	crash, _ = db.GetTask(crash.ID)
+	if result.Updated != 1 || len(result.Errors) != 0 || crash.Status != "in_progress" {
+		t.Errorf("expected the reopened issue to reopen its task, got %+v, %q", result, crash.Status)
+	}
+
+	// Statuses with nowhere to go in Jira are reported
+	pending := "pending"
+	db.UpdateTask(crash.ID, nil, nil, &pending, nil, nil, nil, nil, nil, nil, nil, nil)
+	touchTask(t, db, crash.ID, time.Now().Add(time.Minute))
+	jira.mu.Lock()
+	jira.issues = jira.issues[:2]
+	jira.mu.Unlock()
+	result, _ = db.SyncIssues(link.ID, false)
+	if len(result.Errors) != 1 || !strings.Contains(result.Errors[0], "issue APP-3") {
+		t.Errorf("expected the missing issue to fail, got %+v", result)
+	}
+}
+
+// recordedTransport replays recorded Jira responses, keyed by method and
+// path, and fails on any other request. Bodies recorded under a status code,
+// such as "404 {...}", are returned with it.
+type recordedTransport struct {
+	t         *testing.T
+	responses map[string]string
+	requests  []*http.Request
+}
+
+func (rt *recordedTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	rt.requests = append(rt.requests, r)
+	body, ok := rt.responses[r.Method+" "+r.URL.Path]
+	if !ok {
+		rt.t.Errorf("unexpected request %s %s", r.Method, r.URL)
+	}
+	status := http.StatusOK
+	if code, rest, found := strings.Cut(body, " "); found {
+		if n, err := strconv.Atoi(code); err == nil {
+			status, body = n, rest
+		}
+	}
+	return &http.Response{StatusCode: status, Status: http.StatusText(status), Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body)), Request: r}, nil
+}
+
+func TestJiraClientRecorded(t *testing.T) {
+	rt := &recordedTransport{t: t, responses: map[string]string{
+		"GET /rest/api/2/search": `{"startAt":0,"maxResults":100,"total":1,"issues":[{"key":"OPS-7","fields":{
+			"summary":"Rotate certificates","description":null,
+			"status":{"name":"Awaiting Deploy","statusCategory":{"key":"indeterminate"}},
+			"priority":null,"issuetype":{"name":"Spike"},
+			"parent":{"key":"OPS-2","fields":{"issuetype":{"name":"Sub-task"}}},
+			"updated":"2026-03-01T09:30:00.000+0100",
+			"comment":{"comments":[]}}}]}`,
+		"GET /rest/api/2/issue/OPS-7/transitions": `{"transitions":[
+			{"id":"5","name":"Start","to":{"name":"In Progress","statusCategory":{"key":"indeterminate"}}},
+			{"id":"9","name":"Close","to":{"name":"Closed","statusCategory":{"key":"done"}}}]}`,
+		"GET /rest/api/2/issue/OPS-8": `404 {"errorMessages":["Issue does not exist or you do not have permission to see it."]}`,
+	}}
+	client := NewJiraClient("https://jira.example.com/", "", "pat_secret", map[string]string{"awaiting deploy": "blocked"}, rt)
+
+	issues, err := client.ListIssues("OPS", nil)
+	if err != nil || len(issues) != 1 {
+		t.Fatalf("failed to list issues: %v %+v", err, issues)
+	}
+	issue := issues[0]
+	if issue.ID != "OPS-7" || issue.Body != "" || issue.Status != "blocked" || issue.Done || issue.TaskType != "investigation" || issue.Priority != "" || issue.Epic != "" {
+		t.Errorf("expected the recorded issue mapped to task values, got %+v", issue)
+	}
+	if want := time.Date(2026, 3, 1, 8, 30, 0, 0, time.UTC); !issue.UpdatedAt.Equal(want) || issue.URL != "https://jira.example.com/browse/OPS-7" {
+		t.Errorf("expected the update time and URL, got %v, %s", issue.UpdatedAt, issue.URL)
+	}
+	if auth := rt.requests[0].Header.Get("Authorization"); auth != "Bearer pat_secret" {
+		t.Errorf("expected a personal access token without an email, got %q", auth)
+	}
+	if jql := rt.requests[0].URL.Query().Get("jql"); jql != `project = "OPS" ORDER BY updated ASC` {
+		t.Errorf("expected a full search, got %q", jql)
+	}
+
+	// No transition leads to a status for pending, or a mapped one for blocked
+	for _, status := range []string{"pending", "blocked"} {
+		if _, err := client.SetIssueStatus("OPS", "OPS-7", status); err == nil || !strings.Contains(err.Error(), "no transition") {
+			t.Errorf("%s: expected no transition to be found, got %v", status, err)
+		}
+	}
+	if _, err := client.GetIssue("OPS", "OPS-8"); err == nil || !strings.Contains(err.Error(), "Issue does not exist") {
+		t.Errorf("expected Jira's error message, got %v", err)
+	}
+}
+
+func TestSyncJiraCommand(t *testing.T) {
+	jira, srv := newFakeJira(t)
+	jira.add("APP-1", "Task", "Write docs", "To Do", "Low", "")
+	dbPath := t.TempDir() + "/loom.db"
+	db, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	project, _ := db.CreateProject("Docs", "", "", "", nil, nil)
+	db.Close()
+
+	cfg := DefaultConfig()
+	cfg.DBPath = dbPath
+	cfg.Jira = JiraConfig{URL: srv.URL, Email: "me@example.com", Token: "jira_test"}
+
+	var out bytes.Buffer
+	if err := runCommand(cfg, []string{"sync", "link", "-project", fmt.Sprint(project.ID), "jira", "APP"}, &out); err != nil {
+		t.Fatalf("sync link failed: %v", err)
+	}
+	out.Reset()
+	if err := runCommand(cfg, []string{"sync", "run", "-dry-run", "1"}, &out); err != nil {
+		t.Fatalf("sync run -dry-run failed: %v", err)
+	}
+	if !strings.Contains(out.String(), `Link 1 would create task "Write docs" from issue APP-1`) {
+		t.Errorf("expected the planned changes, got:\n%s", out.String())
+	}
+
+	cfg.Jira.URL = ""
+	if err := runCommand(cfg, []string{"sync", "run", "1"}, &out); err == nil || !strings.Contains(err.Error(), "not configured") {
+		t.Errorf("expected syncing without a Jira URL to fail, got %v", err)
+	}
+}
+
+func TestSyncImportFailures(t *testing.T) {
+	db := newTestDatabase(t)
+	jira, srv := newFakeJira(t)
+	db.SetIssueTrackers(map[string]IssueTracker{"jira": NewJiraClient(srv.URL, "me@example.com", "jira_test", nil, nil)})
+
+	project, _ := db.CreateProject("Platform", "", "", "", nil, nil)
+	link, _ := db.CreateSyncLink(project.ID, "jira", "APP")
+	jira.add("APP-1", "Story", "Pay by card", "In Progress", "", "", jiraCommentJSON("500", "Ana", "Use the SDK", time.Now().Add(-time.Hour)))
+	jira.add("APP-2", "Bug", "Crash on start", "To Do", "", "")
+	jira.update("APP-2", time.Now(), nil)
+
+	// An issue whose comments fail to import keeps its task, and doesn't
+	// hold back the other issues
+	db.db.Exec("CREATE TRIGGER fail_notes BEFORE INSERT ON task_notes BEGIN SELECT RAISE(ABORT, 'notes unavailable'); END")
+	if result, _ := db.SyncIssues(link.ID, false); result.Created != 2 || len(result.Errors) != 1 {
+		t.Fatalf("expected the comment to fail, got %+v", result)
+	}
+	link, _ = db.GetSyncLink(link.ID)
+	if link.SyncedUntil == nil || time.Since(*link.SyncedUntil) > time.Minute || !strings.Contains(link.LastError, "notes unavailable") {
+		t.Errorf("expected the link to be synced up to the newest issue with the failure, got %+v", link)
+	}
+
+	// The next sync asks for the failed issue again, though it has not
+	// changed since, and finishes its task rather than importing it again
+	db.db.Exec("DROP TRIGGER fail_notes")
+	result, err := db.SyncIssues(link.ID, false)
+	if err != nil || result.Created != 0 || result.Notes != 1 || len(result.Errors) != 0 {
+		t.Errorf("expected the next sync to add the comment to the same task, got %+v, %v", result, err)
+	}
+	if tasks, _ := db.ListTasks(&project.ID, nil, nil); len(tasks) != 2 {
+		t.Errorf("expected each issue to be imported once, got %d tasks", len(tasks))
+	}
+	if result, _ := db.SyncIssues(link.ID, false); len(result.Changes) != 0 || len(result.Errors) != 0 {
+		t.Errorf("expected an idle sync once the issue synced, got %+v", result)
+	}
+}
@@ -1,53 +1,199 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
 )
 
 var db *Database
 
 func main() {
-	// Parse command-line flags
-	webAddr := flag.String("addr", ":8080", "API server address (default :8080)")
-	dashboardAddr := flag.String("web-addr", ":3000", "Website server address (default :3000)")
+	// Parse command-line flags. Flags that are set override the config file
+	// and environment.
+	configPath := flag.String("config", "", "Config file (default ~/.loom/config.toml, or LOOM_CONFIG)")
+	flag.String("addr", "127.0.0.1:8080", "API server address")
+	flag.String("web-addr", "127.0.0.1:3000", "Website server address")
+	transport := flag.String("transport", "http", "MCP transport: http (API, MCP and dashboard servers) or stdio (MCP only, over stdin/stdout)")
+	flag.String("dashboard-url", "", "With -transport stdio, URL of a running Loom API server to forward voice announcements to (e.g. http://localhost:8080)")
+	flag.Bool("local-only", false, "Serve the API and MCP without authentication, listening on localhost only")
 	flag.Parse()
 
-	// Determine database path
-	dbPath := os.Getenv("LOOM_DB_PATH")
-	if dbPath == "" {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			log.Fatal("Failed to get home directory:", err)
+	if *transport != "http" && *transport != "stdio" {
+		log.Fatalf("Unknown transport %q (expected http or stdio)", *transport)
+	}
+
+	// Load the config file, then layer the environment and flags over it.
+	// A config file that was asked for must exist.
+	path, required := *configPath, *configPath != ""
+	if !required {
+		path, required = os.LookupEnv("LOOM_CONFIG")
+	}
+	if !required {
+		path = DefaultConfigPath()
+	}
+	flags := map[string]string{}
+	flag.Visit(func(f *flag.Flag) {
+		flags[f.Name] = f.Value.String()
+	})
+	cfg, err := LoadConfig(path, required, os.LookupEnv, flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Run a maintenance subcommand (e.g. "loom migrate status") and exit
+	if flag.NArg() > 0 {
+		if err := runCommand(cfg, flag.Args(), os.Stdout); err != nil {
+			log.Fatal(err)
 		}
-		dbPath = filepath.Join(homeDir, ".loom", "loom.db")
+		return
 	}
 
-	// Initialize database
-	var err error
-	db, err = NewDatabase(dbPath)
+	// Initialize database. It is closed last on the way out, once the
+	// servers and background jobs have stopped using it; a failure after
+	// this point sets the exit code rather than exiting, so that it is.
+	db, err = NewDatabase(cfg.DBPath)
 	if err != nil {
 		log.Fatal("Failed to initialize database:", err)
 	}
-	defer db.Close()
+	exitCode := 0
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Printf("Failed to close database: %v", err)
+			exitCode = 1
+		}
+		os.Exit(exitCode)
+	}()
+
+	// Apply status workflow overrides
+	if cfg.WorkflowPath != "" {
+		workflows, err := LoadWorkflows(cfg.WorkflowPath)
+		if err != nil {
+			log.Printf("Failed to load workflow: %v", err)
+			exitCode = 1
+			return
+		}
+		if err := db.SetWorkflows(workflows); err != nil {
+			log.Printf("Invalid workflow: %v", err)
+			exitCode = 1
+			return
+		}
+	}
+	if err := db.SetDefaults(cfg.Defaults); err != nil {
+		log.Printf("Invalid defaults: %v", err)
+		exitCode = 1
+		return
+	}
+
+	// Parse natural dates such as "tomorrow" in the configured time zone
+	// rather than the machine's
+	loc, err := cfg.Location()
+	if err != nil {
+		log.Printf("Invalid timezone: %v", err)
+		exitCode = 1
+		return
+	}
+	db.SetLocation(loc)
+
+	// Purge the trash after the retention period; 0 keeps deleted items
+	// until they are purged by hand
+	db.SetTrashRetention(time.Duration(cfg.Trash.RetentionDays) * 24 * time.Hour)
+
+	// Snapshot the database into the backup directory, keeping the newest
+	db.SetBackups(cfg.Backup.Dir, time.Duration(cfg.Backup.IntervalHours)*time.Hour, cfg.Backup.Keep)
+
+	// Reach the issue trackers that linked projects sync with
+	db.SetIssueTrackers(cfg.IssueTrackers())
+
+	// Shut down gracefully on Ctrl-C and SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *transport == "stdio" {
+		// Serve MCP over stdin/stdout without binding any ports. Voice
+		// messages are only delivered if a dashboard URL was given, using
+		// the configured token to authenticate with it.
+		voiceFunc := func(VoiceMessage) (int, error) { return 0, nil }
+		if cfg.Voice.DashboardURL != "" {
+			voiceFunc = NewRemoteVoiceFunc(cfg.Voice.DashboardURL, cfg.Auth.Token)
+		}
+
+		log.Printf("Loom MCP server starting on stdio, database at: %s", cfg.DBPath)
+		if err := ServeMCPStdio(ctx, NewMCPServer(db, voiceFunc, cfg.MCP.Tools), os.Stdin, os.Stdout); err != nil && ctx.Err() == nil {
+			log.Printf("MCP stdio server failed: %v", err)
+			exitCode = 1
+		}
+		return
+	}
+
+	// Background jobs run in the HTTP server only, so that the stdio
+	// servers agents start alongside it don't run them a second time.
+	// Purge expired trash hourly.
+	stopPurger := db.StartTrashPurger(time.Hour)
+	defer stopPurger()
+
+	// Create upcoming instances of recurring tasks
+	stopScheduler := db.StartRecurrenceScheduler(15 * time.Minute)
+	defer stopScheduler()
+
+	// Take scheduled snapshots
+	stopSnapshots := db.StartSnapshotScheduler(time.Hour)
+	defer stopSnapshots()
+
+	// Sync projects linked to issue trackers
+	stopSync := db.StartSyncScheduler(time.Duration(cfg.Sync.IntervalMinutes) * time.Minute)
+	defer stopSync()
+
+	// Without authentication anyone who can reach the API can change
+	// everything, so only serve it to this machine
+	webAddr, dashboardAddr := cfg.Server.Addr, cfg.Server.WebAddr
+	if cfg.Auth.LocalOnly {
+		addr, err := loopbackAddr(webAddr)
+		if err != nil {
+			log.Printf("Invalid server address with local-only: %v", err)
+			exitCode = 1
+			return
+		}
+		webAddr = addr
+		log.Printf("Authentication disabled with local-only; API only reachable from this machine")
+	} else if tokens, err := db.ListAPITokens(); err == nil && len(tokens) == 0 {
+		log.Printf("API tokens are required but none exist; create one with \"loom token create NAME\" or pass -local-only")
+	}
+
+	if exposedAddr(webAddr) {
+		log.Printf("WARNING: the API at %s can be reached from other machines; anyone on the network with a token can read and change your data. Use -addr 127.0.0.1:PORT unless you mean to share it", webAddr)
+	}
+
+	// Let browsers call the API from other origins besides the dashboard
+	if slices.Contains(cfg.Server.CORSOrigins, "*") {
+		log.Printf("WARNING: cors_origins allows any origin, so any web page you visit can call the API")
+	}
 
 	// Start the API (with MCP) and dashboard servers
-	log.Printf("Loom starting - API at http://%s, MCP at http://%s/sse, Dashboard at http://%s, database at: %s", *webAddr, *webAddr, *dashboardAddr, dbPath)
-	ws := NewWebServer(db, *webAddr, *dashboardAddr, nil)
+	log.Printf("Loom starting - API at http://%s, MCP at http://%s/sse, Dashboard at http://%s, database at: %s", webAddr, webAddr, dashboardAddr, cfg.DBPath)
+	ws := NewWebServer(db, webAddr, dashboardAddr, nil)
+	ws.requireToken = !cfg.Auth.LocalOnly
+	ws.corsOrigins = cfg.Server.CORSOrigins
+	ws.ttsEngine = cfg.Voice.Engine
+	ws.ttsVoice = cfg.Voice.Voice
 
-	// Create announce function that broadcasts voice events to SSE clients
-	announceFunc := func(text string) {
-		ws.broadcast("voice", map[string]string{"text": text})
+	// Deliver voice messages to SSE clients as voice events
+	voiceFunc := func(msg VoiceMessage) (int, error) {
+		return ws.broadcast("voice", msg), nil
 	}
 
 	// Create MCP handler to be mounted on the API server
-	mcpServer := NewMCPServer(db, announceFunc)
+	mcpServer := NewMCPServer(db, voiceFunc, cfg.MCP.Tools)
 	mcpHandler := NewMCPHandler(mcpServer)
 	ws.mcpHandler = mcpHandler
 
-	if err := ws.Start(); err != nil {
-		log.Fatal("Failed to start server:", err)
+	if err := ws.Start(ctx); err != nil {
+		log.Printf("Server failed: %v", err)
+		exitCode = 1
 	}
 }
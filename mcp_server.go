@@ -1,29 +1,109 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 )
 
-// NewMCPServer creates a new MCP server with all Loom tools registered.
-func NewMCPServer(database *Database, announceFunc func(string)) *server.MCPServer {
+// VoiceMessage is a spoken message delivered to dashboard clients through the
+// SSE "voice" event.
+type VoiceMessage struct {
+	Text    string `json:"text"`
+	Voice   string `json:"voice,omitempty"`
+	Urgency string `json:"urgency,omitempty"`
+}
+
+// voiceNamePattern restricts voice names to what TTS engines use, since the
+// name is passed on to the echogarden command line.
+var voiceNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Validate checks that the message has text and a known voice and urgency.
+func (m VoiceMessage) Validate() error {
+	if m.Text == "" {
+		return errors.New("text is required")
+	}
+	if len(m.Text) > 5000 {
+		return errors.New("text too long (max 5000 characters)")
+	}
+	if m.Voice != "" && !voiceNamePattern.MatchString(m.Voice) {
+		return fmt.Errorf("invalid voice %q", m.Voice)
+	}
+	switch m.Urgency {
+	case "", "low", "normal", "high":
+	default:
+		return fmt.Errorf("invalid urgency %q (expected low, normal or high)", m.Urgency)
+	}
+	return nil
+}
+
+// VoiceFunc delivers a voice message to dashboard clients and returns the
+// number of clients that were connected to receive it.
+type VoiceFunc func(msg VoiceMessage) (int, error)
+
+// ToolGroups are the groups of MCP tools that can be enabled one by one
+var ToolGroups = []string{
+	"projects", "tasks", "problems", "outcomes", "goals", "notes", "summary", "search",
+	"activity", "trash", "dates", "recurrences", "tags", "people", "backups", "sync",
+	"voice",
+}
+
+// NewMCPServer creates a new MCP server with the Loom tools in the given
+// groups registered, or all of them if groups is empty. Voice messages,
+// including the announcements made when items are created, are delivered
+// through voiceFunc.
+func NewMCPServer(database *Database, voiceFunc VoiceFunc, groups []string) *server.MCPServer {
+	announceFunc := func(text string) {
+		if _, err := voiceFunc(VoiceMessage{Text: text}); err != nil {
+			log.Printf("Failed to announce %q: %v", text, err)
+		}
+	}
+
 	s := server.NewMCPServer(
 		"Loom",
 		"1.0.0",
 		server.WithToolCapabilities(true),
+		server.WithToolFilter(filterTokenTools),
+		server.WithToolHandlerMiddleware(authorizeToolCalls(database)),
 	)
 
-	s.AddTools(projectTools(database, announceFunc)...)
-	s.AddTools(taskTools(database, announceFunc)...)
-	s.AddTools(problemTools(database, announceFunc)...)
-	s.AddTools(outcomeTools(database, announceFunc)...)
-	s.AddTools(goalTools(database, announceFunc)...)
-	s.AddTools(taskNoteTools(database, announceFunc)...)
-	s.AddTools(summaryTools(database)...)
+	tools := map[string][]server.ServerTool{
+		"projects":    projectTools(database, announceFunc),
+		"tasks":       taskTools(database, announceFunc),
+		"problems":    problemTools(database, announceFunc),
+		"outcomes":    outcomeTools(database, announceFunc),
+		"goals":       goalTools(database, announceFunc),
+		"notes":       taskNoteTools(database, announceFunc),
+		"summary":     summaryTools(database),
+		"search":      searchTools(database),
+		"activity":    activityTools(database),
+		"trash":       trashTools(database),
+		"dates":       dueTools(database),
+		"recurrences": recurrenceTools(database),
+		"tags":        tagTools(database),
+		"people":      peopleTools(database),
+		"backups":     backupTools(database),
+		"sync":        syncTools(database),
+		"voice":       voiceTools(voiceFunc),
+	}
+	if len(groups) == 0 {
+		groups = ToolGroups
+	}
+	for _, group := range groups {
+		s.AddTools(tools[group]...)
+	}
 
 	return s
 }
@@ -34,6 +114,56 @@ func NewMCPHandler(mcpServer *server.MCPServer) *server.StreamableHTTPServer {
 	return server.NewStreamableHTTPServer(mcpServer)
 }
 
+// ServeMCPStdio serves the MCP server over the stdio transport, reading
+// JSON-RPC messages from in and writing responses to out. It blocks until in
+// is closed or ctx is cancelled.
+func ServeMCPStdio(ctx context.Context, mcpServer *server.MCPServer, in io.Reader, out io.Writer) error {
+	stdioServer := server.NewStdioServer(mcpServer)
+	// stdout carries the protocol, so errors must only ever go to stderr
+	stdioServer.SetErrorLogger(log.New(os.Stderr, "", log.LstdFlags))
+	return stdioServer.Listen(ctx, in, out)
+}
+
+// NewRemoteVoiceFunc returns a VoiceFunc that forwards voice messages to the
+// /api/announce endpoint of a running Loom API server, so that an MCP server
+// running outside that process can still reach the dashboard. The API token,
+// if given, must allow writes.
+func NewRemoteVoiceFunc(apiURL, token string) VoiceFunc {
+	endpoint := strings.TrimRight(apiURL, "/") + "/api/announce"
+	client := &http.Client{Timeout: 2 * time.Second}
+
+	return func(msg VoiceMessage) (int, error) {
+		body, err := json.Marshal(msg)
+		if err != nil {
+			return 0, err
+		}
+		req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, fmt.Errorf("failed to reach dashboard at %s: %w", endpoint, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return 0, fmt.Errorf("dashboard at %s returned %s", endpoint, resp.Status)
+		}
+
+		var result struct {
+			Listeners int `json:"listeners"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return 0, fmt.Errorf("invalid response from dashboard: %w", err)
+		}
+		return result.Listeners, nil
+	}
+}
+
 // --- Project Tools ---
 
 func projectTools(db *Database, announceFunc func(string)) []server.ServerTool {
@@ -43,8 +173,9 @@ func projectTools(db *Database, announceFunc func(string)) []server.ServerTool {
 				mcp.WithDescription("Create a new project in Loom"),
 				mcp.WithString("name", mcp.Required(), mcp.Description("Project name")),
 				mcp.WithString("description", mcp.Description("Project description")),
-				mcp.WithString("status", mcp.Description("Project status (e.g. active, planning, on_hold, completed, archived)")),
+				mcp.WithString("status", mcp.Description("Project status"), mcp.Enum(ProjectStatuses...)),
 				mcp.WithString("external_link", mcp.Description("External link URL")),
+				dateParams(false),
 			),
 			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 				name, err := req.RequireString("name")
@@ -55,7 +186,12 @@ func projectTools(db *Database, announceFunc func(string)) []server.ServerTool {
 				status := req.GetString("status", "")
 				externalLink := req.GetString("external_link", "")
 
-				project, err := db.CreateProject(name, description, status, externalLink)
+				startAt, dueAt, err := itemDates(db, req)
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+
+				project, err := db.WithActor(toolActor(ctx)).CreateProject(name, description, status, externalLink, startAt, dueAt)
 				if err != nil {
 					return mcp.NewToolResultError(fmt.Sprintf("failed to create project: %v", err)), nil
 				}
@@ -65,19 +201,31 @@ func projectTools(db *Database, announceFunc func(string)) []server.ServerTool {
 		},
 		{
 			Tool: mcp.NewTool("list_projects",
-				mcp.WithDescription("List all projects in Loom, optionally filtered by status"),
-				mcp.WithString("status", mcp.Description("Filter by status (e.g. active, planning, on_hold, completed, archived)")),
+				mcp.WithDescription("List projects in Loom, optionally filtered by status. Returns a page of results with the total count and a cursor for the next page"),
+				mcp.WithString("status", mcp.Description("Filter by status"), mcp.Enum(ProjectStatuses...)),
+				dueFilterParams(),
+				tagFilterParams(),
+				listParams(ProjectSortFields),
 			),
 			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 				status := optionalString(req, "status")
-				projects, err := db.ListProjects(status)
+				due, err := dueFilter(db, req)
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				tags, err := tagFilter(req)
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				opts, fields := listOptions(req)
+				projects, page, err := db.ListProjectsPage(status, due, tags, opts)
 				if err != nil {
 					return mcp.NewToolResultError(fmt.Sprintf("failed to list projects: %v", err)), nil
 				}
 				if projects == nil {
 					projects = []*Project{}
 				}
-				return jsonToolResult(projects)
+				return listToolResult(projects, page, fields)
 			},
 		},
 		{
@@ -103,8 +251,9 @@ func projectTools(db *Database, announceFunc func(string)) []server.ServerTool {
 				mcp.WithNumber("id", mcp.Required(), mcp.Description("Project ID")),
 				mcp.WithString("name", mcp.Description("New project name")),
 				mcp.WithString("description", mcp.Description("New project description")),
-				mcp.WithString("status", mcp.Description("New project status")),
+				mcp.WithString("status", mcp.Description("New project status; the change must be allowed by the project status workflow"), mcp.Enum(ProjectStatuses...)),
 				mcp.WithString("external_link", mcp.Description("New external link URL")),
+				dateParams(true),
 			),
 			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 				id, err := req.RequireFloat("id")
@@ -116,7 +265,12 @@ func projectTools(db *Database, announceFunc func(string)) []server.ServerTool {
 				status := optionalString(req, "status")
 				externalLink := optionalString(req, "external_link")
 
-				project, err := db.UpdateProject(int64(id), name, description, status, externalLink)
+				startAt, dueAt, err := itemDates(db, req)
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+
+				project, err := db.WithActor(toolActor(ctx)).UpdateProject(int64(id), name, description, status, externalLink, startAt, dueAt)
 				if err != nil {
 					return mcp.NewToolResultError(fmt.Sprintf("failed to update project: %v", err)), nil
 				}
@@ -125,7 +279,7 @@ func projectTools(db *Database, announceFunc func(string)) []server.ServerTool {
 		},
 		{
 			Tool: mcp.NewTool("delete_project",
-				mcp.WithDescription("Delete a project and all its tasks"),
+				mcp.WithDescription("Move a project to the trash along with its tasks, outcomes and task notes. restore_project brings them all back."),
 				mcp.WithNumber("id", mcp.Required(), mcp.Description("Project ID")),
 			),
 			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
@@ -133,7 +287,7 @@ func projectTools(db *Database, announceFunc func(string)) []server.ServerTool {
 				if err != nil {
 					return mcp.NewToolResultError(err.Error()), nil
 				}
-				if err := db.DeleteProject(int64(id)); err != nil {
+				if err := db.WithActor(toolActor(ctx)).DeleteProject(int64(id)); err != nil {
 					return mcp.NewToolResultError(fmt.Sprintf("failed to delete project: %v", err)), nil
 				}
 				return mcp.NewToolResultText("project deleted successfully"), nil
@@ -148,14 +302,19 @@ func taskTools(db *Database, announceFunc func(string)) []server.ServerTool {
 	return []server.ServerTool{
 		{
 			Tool: mcp.NewTool("create_task",
-				mcp.WithDescription("Create a new task in a project"),
+				mcp.WithDescription("Create a new task in a project, optionally as a subtask of another task in the same project"),
 				mcp.WithNumber("project_id", mcp.Required(), mcp.Description("Project ID")),
+				mcp.WithNumber("parent_task_id", mcp.Description("ID of the parent task, to create a subtask")),
 				mcp.WithString("title", mcp.Required(), mcp.Description("Task title")),
 				mcp.WithString("description", mcp.Description("Task description")),
-				mcp.WithString("status", mcp.Description("Task status (e.g. pending, in_progress, completed)")),
-				mcp.WithString("priority", mcp.Description("Task priority (e.g. high, medium, low)")),
-				mcp.WithString("task_type", mcp.Description("Task type (e.g. feature, bugfix, chore)")),
+				mcp.WithString("status", mcp.Description("Task status"), mcp.Enum(TaskStatuses...)),
+				mcp.WithString("priority", mcp.Description("Task priority"), mcp.Enum(TaskPriorities...)),
+				mcp.WithString("task_type", mcp.Description("Task type"), mcp.Enum(TaskTypes...)),
 				mcp.WithString("external_link", mcp.Description("External link URL")),
+				mcp.WithString("assignee", mcp.Description(personParamDescription("Assignee"))),
+				mcp.WithString("reviewer", mcp.Description(personParamDescription("Reviewer"))),
+				dateParams(false),
+				recurrenceParam(false),
 			),
 			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 				projectID, err := req.RequireFloat("project_id")
@@ -171,35 +330,70 @@ func taskTools(db *Database, announceFunc func(string)) []server.ServerTool {
 				priority := req.GetString("priority", "")
 				taskType := req.GetString("task_type", "")
 				externalLink := req.GetString("external_link", "")
+				assignee := req.GetString("assignee", "")
+				reviewer := req.GetString("reviewer", "")
+				parentTaskID := optionalInt64(req, "parent_task_id")
+
+				startAt, dueAt, err := itemDates(db, req)
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+
+				recurrence := req.GetString("recurrence", "")
+				if err := checkRecurrence(recurrence, dueAt); err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
 
-				task, err := db.CreateTask(int64(projectID), title, description, status, priority, taskType, externalLink)
+				actorDB := db.WithActor(toolActor(ctx))
+				task, err := actorDB.CreateTask(int64(projectID), parentTaskID, title, description, status, priority, taskType, externalLink, assignee, reviewer, startAt, dueAt)
 				if err != nil {
 					return mcp.NewToolResultError(fmt.Sprintf("failed to create task: %v", err)), nil
 				}
+				if recurrence != "" {
+					if task, err = setTaskRecurrence(actorDB, task.ID, recurrence); err != nil {
+						return mcp.NewToolResultError(fmt.Sprintf("failed to make task recur: %v", err)), nil
+					}
+				}
 				announceFunc(fmt.Sprintf("Task %s created", title))
 				return jsonToolResult(task)
 			},
 		},
 		{
 			Tool: mcp.NewTool("list_tasks",
-				mcp.WithDescription("List tasks, optionally filtered by project and/or status"),
+				mcp.WithDescription("List tasks, optionally filtered by project and/or status. Returns a page of results with the total count and a cursor for the next page"),
 				mcp.WithNumber("project_id", mcp.Description("Filter by project ID")),
-				mcp.WithString("status", mcp.Description("Filter by status")),
-				mcp.WithString("task_type", mcp.Description("Filter by task type")),
+				mcp.WithString("status", mcp.Description("Filter by status"), mcp.Enum(TaskStatuses...)),
+				mcp.WithString("task_type", mcp.Description("Filter by task type"), mcp.Enum(TaskTypes...)),
+				mcp.WithString("assignee", mcp.Description("Filter by assignee: a person's handle, email or name; empty for unassigned")),
+				mcp.WithBoolean("ready", mcp.Description("true for tasks that can start because every task they depend on is completed, false for tasks still waiting on a dependency or already completed")),
+				dueFilterParams(),
+				tagFilterParams(),
+				listParams(TaskSortFields),
 			),
 			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 				projectID := optionalInt64(req, "project_id")
 				status := optionalString(req, "status")
 				taskType := optionalString(req, "task_type")
+				assignee := optionalString(req, "assignee")
+				ready := optionalBool(req, "ready")
+				due, err := dueFilter(db, req)
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				tags, err := tagFilter(req)
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				opts, fields := listOptions(req)
 
-				tasks, err := db.ListTasks(projectID, status, taskType)
+				tasks, page, err := db.ListTasksPage(projectID, status, taskType, assignee, ready, due, tags, opts)
 				if err != nil {
 					return mcp.NewToolResultError(fmt.Sprintf("failed to list tasks: %v", err)), nil
 				}
 				if tasks == nil {
 					tasks = []*Task{}
 				}
-				return jsonToolResult(tasks)
+				return listToolResult(tasks, page, fields)
 			},
 		},
 		{
@@ -225,10 +419,15 @@ func taskTools(db *Database, announceFunc func(string)) []server.ServerTool {
 				mcp.WithNumber("id", mcp.Required(), mcp.Description("Task ID")),
 				mcp.WithString("title", mcp.Description("New task title")),
 				mcp.WithString("description", mcp.Description("New task description")),
-				mcp.WithString("status", mcp.Description("New task status")),
-				mcp.WithString("priority", mcp.Description("New task priority")),
-				mcp.WithString("task_type", mcp.Description("New task type")),
+				mcp.WithString("status", mcp.Description("New task status; the change must be allowed by the task status workflow"), mcp.Enum(TaskStatuses...)),
+				mcp.WithString("priority", mcp.Description("New task priority"), mcp.Enum(TaskPriorities...)),
+				mcp.WithString("task_type", mcp.Description("New task type"), mcp.Enum(TaskTypes...)),
 				mcp.WithString("external_link", mcp.Description("New external link URL")),
+				mcp.WithString("assignee", mcp.Description(personParamDescription("New assignee")+"; empty to unassign")),
+				mcp.WithString("reviewer", mcp.Description(personParamDescription("New reviewer")+"; empty to remove")),
+				mcp.WithNumber("parent_task_id", mcp.Description("Move the task and its subtasks under another task in the same project; 0 makes it a top-level task")),
+				dateParams(true),
+				recurrenceParam(true),
 			),
 			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 				id, err := req.RequireFloat("id")
@@ -241,17 +440,38 @@ func taskTools(db *Database, announceFunc func(string)) []server.ServerTool {
 				priority := optionalString(req, "priority")
 				taskType := optionalString(req, "task_type")
 				externalLink := optionalString(req, "external_link")
+				assignee := optionalString(req, "assignee")
+				reviewer := optionalString(req, "reviewer")
+				parentTaskID := optionalInt64(req, "parent_task_id")
+
+				startAt, dueAt, err := itemDates(db, req)
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+
+				recurrence := optionalString(req, "recurrence")
+				if recurrence != nil && *recurrence != "" {
+					if _, err := ParseRecurrenceRule(*recurrence); err != nil {
+						return mcp.NewToolResultError(err.Error()), nil
+					}
+				}
 
-				task, err := db.UpdateTask(int64(id), title, description, status, priority, taskType, externalLink)
+				actorDB := db.WithActor(toolActor(ctx))
+				task, err := actorDB.UpdateTask(int64(id), title, description, status, priority, taskType, externalLink, assignee, reviewer, parentTaskID, startAt, dueAt)
 				if err != nil {
 					return mcp.NewToolResultError(fmt.Sprintf("failed to update task: %v", err)), nil
 				}
+				if recurrence != nil {
+					if task, err = setTaskRecurrence(actorDB, task.ID, *recurrence); err != nil {
+						return mcp.NewToolResultError(fmt.Sprintf("failed to set recurrence: %v", err)), nil
+					}
+				}
 				return jsonToolResult(task)
 			},
 		},
 		{
 			Tool: mcp.NewTool("delete_task",
-				mcp.WithDescription("Delete a task"),
+				mcp.WithDescription("Move a task, its subtasks and their notes to the trash. restore_task brings them back."),
 				mcp.WithNumber("id", mcp.Required(), mcp.Description("Task ID")),
 			),
 			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
@@ -259,12 +479,88 @@ func taskTools(db *Database, announceFunc func(string)) []server.ServerTool {
 				if err != nil {
 					return mcp.NewToolResultError(err.Error()), nil
 				}
-				if err := db.DeleteTask(int64(id)); err != nil {
+				if err := db.WithActor(toolActor(ctx)).DeleteTask(int64(id)); err != nil {
 					return mcp.NewToolResultError(fmt.Sprintf("failed to delete task: %v", err)), nil
 				}
 				return mcp.NewToolResultText("task deleted successfully"), nil
 			},
 		},
+		{
+			Tool: mcp.NewTool("add_dependency",
+				mcp.WithDescription("Record that a task can't start until another task is completed. Tasks may depend on tasks in other projects; dependencies that would form a cycle are rejected."),
+				mcp.WithNumber("task_id", mcp.Required(), mcp.Description("ID of the task that has to wait")),
+				mcp.WithNumber("depends_on_id", mcp.Required(), mcp.Description("ID of the task it waits on")),
+			),
+			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				taskID, err := req.RequireFloat("task_id")
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				dependsOnID, err := req.RequireFloat("depends_on_id")
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				if err := db.WithActor(toolActor(ctx)).AddTaskDependency(int64(taskID), int64(dependsOnID)); err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("failed to add dependency: %v", err)), nil
+				}
+				return mcp.NewToolResultText("dependency added successfully"), nil
+			},
+		},
+		{
+			Tool: mcp.NewTool("remove_dependency",
+				mcp.WithDescription("Remove a dependency between two tasks"),
+				mcp.WithNumber("task_id", mcp.Required(), mcp.Description("ID of the waiting task")),
+				mcp.WithNumber("depends_on_id", mcp.Required(), mcp.Description("ID of the task it waits on")),
+			),
+			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				taskID, err := req.RequireFloat("task_id")
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				dependsOnID, err := req.RequireFloat("depends_on_id")
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				if err := db.WithActor(toolActor(ctx)).RemoveTaskDependency(int64(taskID), int64(dependsOnID)); err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("failed to remove dependency: %v", err)), nil
+				}
+				return mcp.NewToolResultText("dependency removed successfully"), nil
+			},
+		},
+		{
+			Tool: mcp.NewTool("get_blockers",
+				mcp.WithDescription("Explain why a task is or isn't ready: the unfinished tasks it depends on (blockers) and the tasks waiting on it (blocking). Each blocker's blocked_by lists what blocks it in turn."),
+				mcp.WithNumber("id", mcp.Required(), mcp.Description("Task ID")),
+			),
+			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				id, err := req.RequireFloat("id")
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				blockers, err := db.GetTaskBlockers(int64(id))
+				if err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("failed to get blockers: %v", err)), nil
+				}
+				return jsonToolResult(blockers)
+			},
+		},
+		{
+			Tool: mcp.NewTool("get_task_tree",
+				mcp.WithDescription("Get a task with its subtasks nested under it, at any depth. Each task has a progress percentage rolled up from its completed subtasks, along with total_subtasks and completed_subtasks."),
+				mcp.WithNumber("id", mcp.Required(), mcp.Description("Task ID")),
+			),
+			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				id, err := req.RequireFloat("id")
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				tree, err := db.GetTaskTree(int64(id))
+				if err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("failed to get task tree: %v", err)), nil
+				}
+				return jsonToolResult(tree)
+			},
+		},
 	}
 }
 
@@ -277,8 +573,8 @@ func problemTools(db *Database, announceFunc func(string)) []server.ServerTool {
 				mcp.WithDescription("Create a new problem with optional project or task links and assignee"),
 				mcp.WithString("title", mcp.Required(), mcp.Description("Problem title")),
 				mcp.WithString("description", mcp.Description("Problem description")),
-				mcp.WithString("status", mcp.Description("Problem status (e.g. open, resolved)")),
-				mcp.WithString("assignee", mcp.Description("Assignee name")),
+				mcp.WithString("status", mcp.Description("Problem status"), mcp.Enum(ProblemStatuses...)),
+				mcp.WithString("assignee", mcp.Description(personParamDescription("Assignee"))),
 				mcp.WithNumber("project_id", mcp.Description("Linked project ID")),
 				mcp.WithNumber("task_id", mcp.Description("Linked task ID")),
 			),
@@ -293,7 +589,7 @@ func problemTools(db *Database, announceFunc func(string)) []server.ServerTool {
 				projectID := optionalInt64(req, "project_id")
 				taskID := optionalInt64(req, "task_id")
 
-				problem, err := db.CreateProblem(projectID, taskID, title, description, status, assignee)
+				problem, err := db.WithActor(toolActor(ctx)).CreateProblem(projectID, taskID, title, description, status, assignee)
 				if err != nil {
 					return mcp.NewToolResultError(fmt.Sprintf("failed to create problem: %v", err)), nil
 				}
@@ -303,26 +599,33 @@ func problemTools(db *Database, announceFunc func(string)) []server.ServerTool {
 		},
 		{
 			Tool: mcp.NewTool("list_problems",
-				mcp.WithDescription("List problems, optionally filtered by project, task, status, and assignee"),
+				mcp.WithDescription("List problems, optionally filtered by project, task, status, and assignee. Returns a page of results with the total count and a cursor for the next page"),
 				mcp.WithNumber("project_id", mcp.Description("Filter by project ID")),
 				mcp.WithNumber("task_id", mcp.Description("Filter by task ID")),
-				mcp.WithString("status", mcp.Description("Filter by status")),
-				mcp.WithString("assignee", mcp.Description("Filter by assignee")),
+				mcp.WithString("status", mcp.Description("Filter by status"), mcp.Enum(ProblemStatuses...)),
+				mcp.WithString("assignee", mcp.Description("Filter by assignee: a person's handle, email or name; empty for unassigned")),
+				tagFilterParams(),
+				listParams(ItemSortFields),
 			),
 			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 				projectID := optionalInt64(req, "project_id")
 				taskID := optionalInt64(req, "task_id")
 				status := optionalString(req, "status")
 				assignee := optionalString(req, "assignee")
+				tags, err := tagFilter(req)
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				opts, fields := listOptions(req)
 
-				problems, err := db.ListProblems(projectID, taskID, status, assignee)
+				problems, page, err := db.ListProblemsPage(projectID, taskID, status, assignee, tags, opts)
 				if err != nil {
 					return mcp.NewToolResultError(fmt.Sprintf("failed to list problems: %v", err)), nil
 				}
 				if problems == nil {
 					problems = []*Problem{}
 				}
-				return jsonToolResult(problems)
+				return listToolResult(problems, page, fields)
 			},
 		},
 		{
@@ -348,8 +651,10 @@ func problemTools(db *Database, announceFunc func(string)) []server.ServerTool {
 				mcp.WithNumber("id", mcp.Required(), mcp.Description("Problem ID")),
 				mcp.WithString("title", mcp.Description("New problem title")),
 				mcp.WithString("description", mcp.Description("New problem description")),
-				mcp.WithString("status", mcp.Description("New problem status")),
-				mcp.WithString("assignee", mcp.Description("New assignee")),
+				mcp.WithString("status", mcp.Description("New problem status; the change must be allowed by the problem status workflow"), mcp.Enum(ProblemStatuses...)),
+				mcp.WithString("assignee", mcp.Description(personParamDescription("New assignee")+"; empty to unassign")),
+				mcp.WithNumber("project_id", mcp.Description("Move the problem to this project")),
+				mcp.WithNumber("task_id", mcp.Description("Link the problem to this task, which must belong to the problem's project")),
 			),
 			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 				id, err := req.RequireFloat("id")
@@ -360,8 +665,10 @@ func problemTools(db *Database, announceFunc func(string)) []server.ServerTool {
 				description := optionalString(req, "description")
 				status := optionalString(req, "status")
 				assignee := optionalString(req, "assignee")
+				projectID := optionalInt64(req, "project_id")
+				taskID := optionalInt64(req, "task_id")
 
-				problem, err := db.UpdateProblem(int64(id), title, description, status, assignee)
+				problem, err := db.WithActor(toolActor(ctx)).UpdateProblem(int64(id), title, description, status, assignee, projectID, taskID)
 				if err != nil {
 					return mcp.NewToolResultError(fmt.Sprintf("failed to update problem: %v", err)), nil
 				}
@@ -370,7 +677,7 @@ func problemTools(db *Database, announceFunc func(string)) []server.ServerTool {
 		},
 		{
 			Tool: mcp.NewTool("delete_problem",
-				mcp.WithDescription("Delete a problem"),
+				mcp.WithDescription("Move a problem to the trash. restore_problem brings it back."),
 				mcp.WithNumber("id", mcp.Required(), mcp.Description("Problem ID")),
 			),
 			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
@@ -378,7 +685,7 @@ func problemTools(db *Database, announceFunc func(string)) []server.ServerTool {
 				if err != nil {
 					return mcp.NewToolResultError(err.Error()), nil
 				}
-				if err := db.DeleteProblem(int64(id)); err != nil {
+				if err := db.WithActor(toolActor(ctx)).DeleteProblem(int64(id)); err != nil {
 					return mcp.NewToolResultError(fmt.Sprintf("failed to delete problem: %v", err)), nil
 				}
 				return mcp.NewToolResultText("problem deleted successfully"), nil
@@ -399,7 +706,7 @@ func problemTools(db *Database, announceFunc func(string)) []server.ServerTool {
 				if err != nil {
 					return mcp.NewToolResultError(err.Error()), nil
 				}
-				if err := db.LinkProblemToProject(int64(problemID), int64(projectID)); err != nil {
+				if err := db.WithActor(toolActor(ctx)).LinkProblemToProject(int64(problemID), int64(projectID)); err != nil {
 					return mcp.NewToolResultError(fmt.Sprintf("failed to link problem to project: %v", err)), nil
 				}
 				return mcp.NewToolResultText("problem linked to project successfully"), nil
@@ -420,7 +727,7 @@ func problemTools(db *Database, announceFunc func(string)) []server.ServerTool {
 				if err != nil {
 					return mcp.NewToolResultError(err.Error()), nil
 				}
-				if err := db.UnlinkProblemFromProject(int64(problemID), int64(projectID)); err != nil {
+				if err := db.WithActor(toolActor(ctx)).UnlinkProblemFromProject(int64(problemID), int64(projectID)); err != nil {
 					return mcp.NewToolResultError(fmt.Sprintf("failed to unlink problem from project: %v", err)), nil
 				}
 				return mcp.NewToolResultText("problem unlinked from project successfully"), nil
@@ -479,8 +786,9 @@ func outcomeTools(db *Database, announceFunc func(string)) []server.ServerTool {
 				mcp.WithNumber("project_id", mcp.Required(), mcp.Description("Project ID")),
 				mcp.WithString("title", mcp.Required(), mcp.Description("Outcome title")),
 				mcp.WithString("description", mcp.Description("Outcome description")),
-				mcp.WithString("status", mcp.Description("Outcome status (e.g. open, completed)")),
+				mcp.WithString("status", mcp.Description("Outcome status"), mcp.Enum(OutcomeStatuses...)),
 				mcp.WithNumber("task_id", mcp.Description("Linked task ID")),
+				dateParams(false),
 			),
 			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 				projectID, err := req.RequireFloat("project_id")
@@ -495,7 +803,12 @@ func outcomeTools(db *Database, announceFunc func(string)) []server.ServerTool {
 				status := req.GetString("status", "")
 				taskID := optionalInt64(req, "task_id")
 
-				outcome, err := db.CreateOutcome(int64(projectID), taskID, title, description, status)
+				startAt, dueAt, err := itemDates(db, req)
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+
+				outcome, err := db.WithActor(toolActor(ctx)).CreateOutcome(int64(projectID), taskID, title, description, status, startAt, dueAt)
 				if err != nil {
 					return mcp.NewToolResultError(fmt.Sprintf("failed to create outcome: %v", err)), nil
 				}
@@ -505,24 +818,36 @@ func outcomeTools(db *Database, announceFunc func(string)) []server.ServerTool {
 		},
 		{
 			Tool: mcp.NewTool("list_outcomes",
-				mcp.WithDescription("List outcomes, optionally filtered by project, task, and status"),
+				mcp.WithDescription("List outcomes, optionally filtered by project, task, and status. Returns a page of results with the total count and a cursor for the next page"),
 				mcp.WithNumber("project_id", mcp.Description("Filter by project ID")),
 				mcp.WithNumber("task_id", mcp.Description("Filter by task ID")),
-				mcp.WithString("status", mcp.Description("Filter by status")),
+				mcp.WithString("status", mcp.Description("Filter by status"), mcp.Enum(OutcomeStatuses...)),
+				dueFilterParams(),
+				tagFilterParams(),
+				listParams(DatedSortFields),
 			),
 			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 				projectID := optionalInt64(req, "project_id")
 				taskID := optionalInt64(req, "task_id")
 				status := optionalString(req, "status")
+				due, err := dueFilter(db, req)
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				tags, err := tagFilter(req)
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				opts, fields := listOptions(req)
 
-				outcomes, err := db.ListOutcomes(projectID, taskID, status)
+				outcomes, page, err := db.ListOutcomesPage(projectID, taskID, status, due, tags, opts)
 				if err != nil {
 					return mcp.NewToolResultError(fmt.Sprintf("failed to list outcomes: %v", err)), nil
 				}
 				if outcomes == nil {
 					outcomes = []*Outcome{}
 				}
-				return jsonToolResult(outcomes)
+				return listToolResult(outcomes, page, fields)
 			},
 		},
 		{
@@ -548,7 +873,10 @@ func outcomeTools(db *Database, announceFunc func(string)) []server.ServerTool {
 				mcp.WithNumber("id", mcp.Required(), mcp.Description("Outcome ID")),
 				mcp.WithString("title", mcp.Description("New outcome title")),
 				mcp.WithString("description", mcp.Description("New outcome description")),
-				mcp.WithString("status", mcp.Description("New outcome status")),
+				mcp.WithString("status", mcp.Description("New outcome status; the change must be allowed by the outcome status workflow"), mcp.Enum(OutcomeStatuses...)),
+				mcp.WithNumber("project_id", mcp.Description("Move the outcome to this project")),
+				mcp.WithNumber("task_id", mcp.Description("Link the outcome to this task, which must belong to the outcome's project")),
+				dateParams(true),
 			),
 			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 				id, err := req.RequireFloat("id")
@@ -558,8 +886,15 @@ func outcomeTools(db *Database, announceFunc func(string)) []server.ServerTool {
 				title := optionalString(req, "title")
 				description := optionalString(req, "description")
 				status := optionalString(req, "status")
+				projectID := optionalInt64(req, "project_id")
+				taskID := optionalInt64(req, "task_id")
+
+				startAt, dueAt, err := itemDates(db, req)
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
 
-				outcome, err := db.UpdateOutcome(int64(id), title, description, status)
+				outcome, err := db.WithActor(toolActor(ctx)).UpdateOutcome(int64(id), title, description, status, projectID, taskID, startAt, dueAt)
 				if err != nil {
 					return mcp.NewToolResultError(fmt.Sprintf("failed to update outcome: %v", err)), nil
 				}
@@ -568,7 +903,7 @@ func outcomeTools(db *Database, announceFunc func(string)) []server.ServerTool {
 		},
 		{
 			Tool: mcp.NewTool("delete_outcome",
-				mcp.WithDescription("Delete an outcome"),
+				mcp.WithDescription("Move an outcome to the trash. restore_outcome brings it back."),
 				mcp.WithNumber("id", mcp.Required(), mcp.Description("Outcome ID")),
 			),
 			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
@@ -576,7 +911,7 @@ func outcomeTools(db *Database, announceFunc func(string)) []server.ServerTool {
 				if err != nil {
 					return mcp.NewToolResultError(err.Error()), nil
 				}
-				if err := db.DeleteOutcome(int64(id)); err != nil {
+				if err := db.WithActor(toolActor(ctx)).DeleteOutcome(int64(id)); err != nil {
 					return mcp.NewToolResultError(fmt.Sprintf("failed to delete outcome: %v", err)), nil
 				}
 				return mcp.NewToolResultText("outcome deleted successfully"), nil
@@ -594,10 +929,11 @@ func goalTools(db *Database, announceFunc func(string)) []server.ServerTool {
 				mcp.WithDescription("Create a goal with optional project or task links and assignee"),
 				mcp.WithString("title", mcp.Required(), mcp.Description("Goal title")),
 				mcp.WithString("description", mcp.Description("Goal description")),
-				mcp.WithString("goal_type", mcp.Description("Goal type (e.g. short_term, career, values, requirement)")),
-				mcp.WithString("assignee", mcp.Description("Assignee name")),
+				mcp.WithString("goal_type", mcp.Description("Goal type"), mcp.Enum(GoalTypes...)),
+				mcp.WithString("assignee", mcp.Description(personParamDescription("Assignee"))),
 				mcp.WithNumber("project_id", mcp.Description("Linked project ID")),
 				mcp.WithNumber("task_id", mcp.Description("Linked task ID")),
+				dateParams(false),
 			),
 			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 				title, err := req.RequireString("title")
@@ -610,7 +946,12 @@ func goalTools(db *Database, announceFunc func(string)) []server.ServerTool {
 				projectID := optionalInt64(req, "project_id")
 				taskID := optionalInt64(req, "task_id")
 
-				goal, err := db.CreateGoal(projectID, taskID, title, description, goalType, assignee)
+				startAt, dueAt, err := itemDates(db, req)
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+
+				goal, err := db.WithActor(toolActor(ctx)).CreateGoal(projectID, taskID, title, description, goalType, assignee, startAt, dueAt)
 				if err != nil {
 					return mcp.NewToolResultError(fmt.Sprintf("failed to create goal: %v", err)), nil
 				}
@@ -620,26 +961,38 @@ func goalTools(db *Database, announceFunc func(string)) []server.ServerTool {
 		},
 		{
 			Tool: mcp.NewTool("list_goals",
-				mcp.WithDescription("List goals, optionally filtered by project, task, goal type, and assignee"),
+				mcp.WithDescription("List goals, optionally filtered by project, task, goal type, and assignee. Returns a page of results with the total count and a cursor for the next page"),
 				mcp.WithNumber("project_id", mcp.Description("Filter by project ID")),
 				mcp.WithNumber("task_id", mcp.Description("Filter by task ID")),
-				mcp.WithString("goal_type", mcp.Description("Filter by goal type")),
-				mcp.WithString("assignee", mcp.Description("Filter by assignee")),
+				mcp.WithString("goal_type", mcp.Description("Filter by goal type"), mcp.Enum(GoalTypes...)),
+				mcp.WithString("assignee", mcp.Description("Filter by assignee: a person's handle, email or name; empty for unassigned")),
+				dueFilterParams(),
+				tagFilterParams(),
+				listParams(DatedSortFields),
 			),
 			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 				projectID := optionalInt64(req, "project_id")
 				taskID := optionalInt64(req, "task_id")
 				goalType := optionalString(req, "goal_type")
 				assignee := optionalString(req, "assignee")
+				due, err := dueFilter(db, req)
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				tags, err := tagFilter(req)
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				opts, fields := listOptions(req)
 
-				goals, err := db.ListGoals(projectID, taskID, goalType, assignee)
+				goals, page, err := db.ListGoalsPage(projectID, taskID, goalType, assignee, due, tags, opts)
 				if err != nil {
 					return mcp.NewToolResultError(fmt.Sprintf("failed to list goals: %v", err)), nil
 				}
 				if goals == nil {
 					goals = []*Goal{}
 				}
-				return jsonToolResult(goals)
+				return listToolResult(goals, page, fields)
 			},
 		},
 		{
@@ -665,8 +1018,11 @@ func goalTools(db *Database, announceFunc func(string)) []server.ServerTool {
 				mcp.WithNumber("id", mcp.Required(), mcp.Description("Goal ID")),
 				mcp.WithString("title", mcp.Description("New goal title")),
 				mcp.WithString("description", mcp.Description("New goal description")),
-				mcp.WithString("goal_type", mcp.Description("New goal type")),
-				mcp.WithString("assignee", mcp.Description("New assignee")),
+				mcp.WithString("goal_type", mcp.Description("New goal type"), mcp.Enum(GoalTypes...)),
+				mcp.WithString("assignee", mcp.Description(personParamDescription("New assignee")+"; empty to unassign")),
+				mcp.WithNumber("project_id", mcp.Description("Move the goal to this project")),
+				mcp.WithNumber("task_id", mcp.Description("Link the goal to this task, which must belong to the goal's project")),
+				dateParams(true),
 			),
 			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 				id, err := req.RequireFloat("id")
@@ -677,8 +1033,15 @@ func goalTools(db *Database, announceFunc func(string)) []server.ServerTool {
 				description := optionalString(req, "description")
 				goalType := optionalString(req, "goal_type")
 				assignee := optionalString(req, "assignee")
+				projectID := optionalInt64(req, "project_id")
+				taskID := optionalInt64(req, "task_id")
 
-				goal, err := db.UpdateGoal(int64(id), title, description, goalType, assignee)
+				startAt, dueAt, err := itemDates(db, req)
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+
+				goal, err := db.WithActor(toolActor(ctx)).UpdateGoal(int64(id), title, description, goalType, assignee, projectID, taskID, startAt, dueAt)
 				if err != nil {
 					return mcp.NewToolResultError(fmt.Sprintf("failed to update goal: %v", err)), nil
 				}
@@ -687,7 +1050,7 @@ func goalTools(db *Database, announceFunc func(string)) []server.ServerTool {
 		},
 		{
 			Tool: mcp.NewTool("delete_goal",
-				mcp.WithDescription("Delete a goal"),
+				mcp.WithDescription("Move a goal to the trash. restore_goal brings it back."),
 				mcp.WithNumber("id", mcp.Required(), mcp.Description("Goal ID")),
 			),
 			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
@@ -695,7 +1058,7 @@ func goalTools(db *Database, announceFunc func(string)) []server.ServerTool {
 				if err != nil {
 					return mcp.NewToolResultError(err.Error()), nil
 				}
-				if err := db.DeleteGoal(int64(id)); err != nil {
+				if err := db.WithActor(toolActor(ctx)).DeleteGoal(int64(id)); err != nil {
 					return mcp.NewToolResultError(fmt.Sprintf("failed to delete goal: %v", err)), nil
 				}
 				return mcp.NewToolResultText("goal deleted successfully"), nil
@@ -716,7 +1079,7 @@ func goalTools(db *Database, announceFunc func(string)) []server.ServerTool {
 				if err != nil {
 					return mcp.NewToolResultError(err.Error()), nil
 				}
-				if err := db.LinkGoalToProject(int64(goalID), int64(projectID)); err != nil {
+				if err := db.WithActor(toolActor(ctx)).LinkGoalToProject(int64(goalID), int64(projectID)); err != nil {
 					return mcp.NewToolResultError(fmt.Sprintf("failed to link goal to project: %v", err)), nil
 				}
 				return mcp.NewToolResultText("goal linked to project successfully"), nil
@@ -737,7 +1100,7 @@ func goalTools(db *Database, announceFunc func(string)) []server.ServerTool {
 				if err != nil {
 					return mcp.NewToolResultError(err.Error()), nil
 				}
-				if err := db.UnlinkGoalFromProject(int64(goalID), int64(projectID)); err != nil {
+				if err := db.WithActor(toolActor(ctx)).UnlinkGoalFromProject(int64(goalID), int64(projectID)); err != nil {
 					return mcp.NewToolResultError(fmt.Sprintf("failed to unlink goal from project: %v", err)), nil
 				}
 				return mcp.NewToolResultText("goal unlinked from project successfully"), nil
@@ -805,7 +1168,7 @@ func taskNoteTools(db *Database, announceFunc func(string)) []server.ServerTool
 				if err != nil {
 					return mcp.NewToolResultError(err.Error()), nil
 				}
-				taskNote, err := db.CreateTaskNote(int64(taskID), note)
+				taskNote, err := db.WithActor(toolActor(ctx)).CreateTaskNote(int64(taskID), note)
 				if err != nil {
 					return mcp.NewToolResultError(fmt.Sprintf("failed to create task note: %v", err)), nil
 				}
@@ -865,7 +1228,7 @@ func taskNoteTools(db *Database, announceFunc func(string)) []server.ServerTool
 				if err != nil {
 					return mcp.NewToolResultError(err.Error()), nil
 				}
-				taskNote, err := db.UpdateTaskNote(int64(id), note)
+				taskNote, err := db.WithActor(toolActor(ctx)).UpdateTaskNote(int64(id), note)
 				if err != nil {
 					return mcp.NewToolResultError(fmt.Sprintf("failed to update task note: %v", err)), nil
 				}
@@ -874,7 +1237,7 @@ func taskNoteTools(db *Database, announceFunc func(string)) []server.ServerTool
 		},
 		{
 			Tool: mcp.NewTool("delete_task_note",
-				mcp.WithDescription("Delete a task note"),
+				mcp.WithDescription("Move a task note to the trash. restore_task_note brings it back."),
 				mcp.WithNumber("id", mcp.Required(), mcp.Description("Task note ID")),
 			),
 			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
@@ -882,7 +1245,7 @@ func taskNoteTools(db *Database, announceFunc func(string)) []server.ServerTool
 				if err != nil {
 					return mcp.NewToolResultError(err.Error()), nil
 				}
-				if err := db.DeleteTaskNote(int64(id)); err != nil {
+				if err := db.WithActor(toolActor(ctx)).DeleteTaskNote(int64(id)); err != nil {
 					return mcp.NewToolResultError(fmt.Sprintf("failed to delete task note: %v", err)), nil
 				}
 				return mcp.NewToolResultText("task note deleted successfully"), nil
@@ -974,6 +1337,528 @@ func summaryTools(db *Database) []server.ServerTool {
 	}
 }
 
+// --- Search Tools ---
+
+func searchTools(db *Database) []server.ServerTool {
+	return []server.ServerTool{
+		{
+			Tool: mcp.NewTool("search",
+				mcp.WithDescription("Full-text search across projects, tasks, problems, outcomes, goals and task notes. Matches every word of the query as a prefix against titles, descriptions and notes, and returns ranked results with highlighted snippets. Use this to find prior context instead of listing everything."),
+				mcp.WithString("query", mcp.Required(), mcp.Description("Words to search for")),
+				mcp.WithString("entity", mcp.Description("Only return results of this type"), mcp.Enum(SearchEntities...)),
+				mcp.WithNumber("limit", mcp.Description("Maximum number of results (default 20, max 100)")),
+			),
+			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				query, err := req.RequireString("query")
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				entity := optionalString(req, "entity")
+				limit := req.GetInt("limit", 0)
+
+				results, err := db.Search(query, entity, limit)
+				if err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("failed to search: %v", err)), nil
+				}
+				return jsonToolResult(results)
+			},
+		},
+	}
+}
+
+// --- Activity Tools ---
+
+func activityTools(db *Database) []server.ServerTool {
+	return []server.ServerTool{
+		{
+			Tool: mcp.NewTool("get_history",
+				mcp.WithDescription("Get the activity log, newest first: who created, changed or deleted what, with the old and new value of each changed field. Pass entity and id to get the history of one item."),
+				mcp.WithString("entity", mcp.Description("Only return activity for this type of item"), mcp.Enum(ActivityEntities...)),
+				mcp.WithNumber("id", mcp.Description("Only return activity for the item with this ID (requires entity)")),
+				mcp.WithString("actor", mcp.Description("Only return changes made by this actor, e.g. \"rest:127.0.0.1\"")),
+				mcp.WithNumber("limit", mcp.Description(fmt.Sprintf("Maximum number of entries to return (default %d, max %d)", defaultListLimit, maxListLimit))),
+				mcp.WithString("cursor", mcp.Description("next_cursor from the previous page, to fetch older entries")),
+			),
+			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				entity := optionalString(req, "entity")
+				id := optionalInt64(req, "id")
+				if id != nil && entity == nil {
+					return mcp.NewToolResultError("entity is required when id is given"), nil
+				}
+				actor := optionalString(req, "actor")
+				opts := ListOptions{
+					Limit:  req.GetInt("limit", defaultListLimit),
+					Cursor: req.GetString("cursor", ""),
+				}
+
+				entries, page, err := db.ListActivityPage(entity, id, actor, opts)
+				if err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("failed to get history: %v", err)), nil
+				}
+				if entries == nil {
+					entries = []*Activity{}
+				}
+				return listToolResult(entries, page, nil)
+			},
+		},
+	}
+}
+
+// --- Due Date Tools ---
+
+func dueTools(db *Database) []server.ServerTool {
+	return []server.ServerTool{
+		{
+			Tool: mcp.NewTool("list_overdue",
+				mcp.WithDescription("List the projects, tasks, outcomes and goals whose due date has passed and that are not completed (or archived), soonest due first"),
+			),
+			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				items, err := db.ListOverdue()
+				if err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("failed to list overdue items: %v", err)), nil
+				}
+				return jsonToolResult(items)
+			},
+		},
+		{
+			Tool: mcp.NewTool("list_due_soon",
+				mcp.WithDescription("List the projects, tasks, outcomes and goals that are not completed (or archived) and are due within the next few days, soonest due first"),
+				mcp.WithNumber("days", mcp.Description("How many days ahead to look (default 7)")),
+			),
+			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				days := req.GetFloat("days", 7)
+				if days < 0 {
+					return mcp.NewToolResultError("days must not be negative"), nil
+				}
+				items, err := db.ListDueSoon(time.Duration(days * float64(24*time.Hour)))
+				if err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("failed to list items due soon: %v", err)), nil
+				}
+				return jsonToolResult(items)
+			},
+		},
+	}
+}
+
+// --- Tag Tools ---
+
+func tagTools(db *Database) []server.ServerTool {
+	return []server.ServerTool{
+		{
+			Tool: mcp.NewTool("tag_item",
+				mcp.WithDescription("Put a tag on a project, task, problem, outcome or goal, creating the tag if it is new. Returns the item with its tags."),
+				mcp.WithString("entity", mcp.Required(), mcp.Description("Type of the item"), mcp.Enum(TagEntities...)),
+				mcp.WithNumber("id", mcp.Required(), mcp.Description("ID of the item")),
+				mcp.WithString("tag", mcp.Required(), mcp.Description("Tag name, e.g. backend; names are stored in lower case")),
+				mcp.WithString("color", mcp.Description("Colour of the tag as #rrggbb, e.g. #3b82f6; keeps the current colour if omitted")),
+			),
+			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				entity, err := req.RequireString("entity")
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				id, err := req.RequireFloat("id")
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				tag, err := req.RequireString("tag")
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				if _, err := db.WithActor(toolActor(ctx)).TagItem(entity, int64(id), tag, req.GetString("color", "")); err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("failed to tag item: %v", err)), nil
+				}
+				item, err := db.getItem(entity, int64(id))
+				if err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("failed to get item: %v", err)), nil
+				}
+				return jsonToolResult(item)
+			},
+		},
+		{
+			Tool: mcp.NewTool("untag_item",
+				mcp.WithDescription("Remove a tag from a project, task, problem, outcome or goal. Returns the item with its remaining tags."),
+				mcp.WithString("entity", mcp.Required(), mcp.Description("Type of the item"), mcp.Enum(TagEntities...)),
+				mcp.WithNumber("id", mcp.Required(), mcp.Description("ID of the item")),
+				mcp.WithString("tag", mcp.Required(), mcp.Description("Tag name")),
+			),
+			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				entity, err := req.RequireString("entity")
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				id, err := req.RequireFloat("id")
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				tag, err := req.RequireString("tag")
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				if err := db.WithActor(toolActor(ctx)).UntagItem(entity, int64(id), tag); err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("failed to untag item: %v", err)), nil
+				}
+				item, err := db.getItem(entity, int64(id))
+				if err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("failed to get item: %v", err)), nil
+				}
+				return jsonToolResult(item)
+			},
+		},
+		{
+			Tool: mcp.NewTool("list_tags",
+				mcp.WithDescription("List tags by name, with their colour and how many items carry them. Filter list tools with tag= to find the tagged items."),
+				mcp.WithString("entity", mcp.Description("Only list tags used on this type of item"), mcp.Enum(TagEntities...)),
+			),
+			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				tags, err := db.ListTags(optionalString(req, "entity"))
+				if err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("failed to list tags: %v", err)), nil
+				}
+				return jsonToolResult(tags)
+			},
+		},
+	}
+}
+
+// --- People Tools ---
+
+func peopleTools(db *Database) []server.ServerTool {
+	return []server.ServerTool{
+		{
+			Tool: mcp.NewTool("create_person",
+				mcp.WithDescription("Add someone to the people directory. Work can then be assigned to them by handle, email or name."),
+				mcp.WithString("name", mcp.Required(), mcp.Description("Full name")),
+				mcp.WithString("email", mcp.Description("Email address; unique")),
+				mcp.WithString("handle", mcp.Description("Handle such as a chat or GitHub username, with or without @; unique")),
+				mcp.WithString("role", mcp.Description("Role in the team, e.g. backend engineer")),
+				mcp.WithNumber("manager_id", mcp.Description("ID of the person they report to")),
+			),
+			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				name, err := req.RequireString("name")
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				person, err := db.WithActor(toolActor(ctx)).CreatePerson(name, req.GetString("email", ""), req.GetString("handle", ""), req.GetString("role", ""), optionalInt64(req, "manager_id"))
+				if err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("failed to create person: %v", err)), nil
+				}
+				return jsonToolResult(person)
+			},
+		},
+		{
+			Tool: mcp.NewTool("list_people",
+				mcp.WithDescription("List the people directory by name, with each person's manager and counts of their open tasks and problems"),
+				mcp.WithString("role", mcp.Description("Filter by role")),
+			),
+			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				people, err := db.ListPeople(optionalString(req, "role"))
+				if err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("failed to list people: %v", err)), nil
+				}
+				return jsonToolResult(people)
+			},
+		},
+		{
+			Tool: mcp.NewTool("update_person",
+				mcp.WithDescription("Update someone in the people directory"),
+				mcp.WithNumber("id", mcp.Required(), mcp.Description("Person ID")),
+				mcp.WithString("name", mcp.Description("New name")),
+				mcp.WithString("email", mcp.Description("New email address; an empty string clears it")),
+				mcp.WithString("handle", mcp.Description("New handle; an empty string clears it")),
+				mcp.WithString("role", mcp.Description("New role")),
+				mcp.WithNumber("manager_id", mcp.Description("ID of the person they report to; 0 removes their manager")),
+			),
+			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				id, err := req.RequireFloat("id")
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				person, err := db.WithActor(toolActor(ctx)).UpdatePerson(int64(id), optionalString(req, "name"), optionalString(req, "email"), optionalString(req, "handle"), optionalString(req, "role"), optionalInt64(req, "manager_id"))
+				if err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("failed to update person: %v", err)), nil
+				}
+				return jsonToolResult(person)
+			},
+		},
+		{
+			Tool: mcp.NewTool("delete_person",
+				mcp.WithDescription("Remove someone from the people directory. Their tasks, problems and goals become unassigned."),
+				mcp.WithNumber("id", mcp.Required(), mcp.Description("Person ID")),
+			),
+			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				id, err := req.RequireFloat("id")
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				if err := db.WithActor(toolActor(ctx)).DeletePerson(int64(id)); err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("failed to delete person: %v", err)), nil
+				}
+				return mcp.NewToolResultText("person deleted successfully"), nil
+			},
+		},
+		{
+			Tool: mcp.NewTool("get_workload",
+				mcp.WithDescription("Get a person's open work: the tasks and problems assigned to them that are not done and the open tasks they review, soonest due first"),
+				mcp.WithNumber("id", mcp.Description("Person ID")),
+				mcp.WithString("person", mcp.Description("The person's handle, email or name, instead of id")),
+			),
+			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				id := optionalInt64(req, "id")
+				if id == nil {
+					ref, err := req.RequireString("person")
+					if err != nil {
+						return mcp.NewToolResultError("id or person is required"), nil
+					}
+					person, err := db.FindPerson(ref)
+					if err != nil {
+						return mcp.NewToolResultError(fmt.Sprintf("failed to find person: %v", err)), nil
+					}
+					id = &person.ID
+				}
+				workload, err := db.GetWorkload(*id)
+				if err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("failed to get workload: %v", err)), nil
+				}
+				return jsonToolResult(workload)
+			},
+		},
+	}
+}
+
+// --- Recurrence Tools ---
+
+func recurrenceTools(db *Database) []server.ServerTool {
+	return []server.ServerTool{
+		{
+			Tool: mcp.NewTool("list_recurrences",
+				mcp.WithDescription("List recurring tasks with their rule, the latest instance (task_id) and when the next instance is due (next_at, null once the rule has ended), next due first"),
+				mcp.WithNumber("project_id", mcp.Description("Filter by the project of the latest instance")),
+			),
+			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				recurrences, err := db.ListRecurrences(optionalInt64(req, "project_id"))
+				if err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("failed to list recurrences: %v", err)), nil
+				}
+				return jsonToolResult(recurrences)
+			},
+		},
+		{
+			Tool: mcp.NewTool("pause_recurrence",
+				mcp.WithDescription("Stop a recurring task from creating new instances, or resume it with resume=true. Occurrences that fall while it is paused are skipped."),
+				mcp.WithNumber("id", mcp.Required(), mcp.Description("Recurrence ID, as returned by list_recurrences or a task's recurrence_id")),
+				mcp.WithBoolean("resume", mcp.Description("true to resume a paused recurrence")),
+			),
+			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				id, err := req.RequireFloat("id")
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				actorDB := db.WithActor(toolActor(ctx))
+				var recurrence *Recurrence
+				if req.GetBool("resume", false) {
+					recurrence, err = actorDB.ResumeRecurrence(int64(id))
+				} else {
+					recurrence, err = actorDB.PauseRecurrence(int64(id))
+				}
+				if err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("failed to pause recurrence: %v", err)), nil
+				}
+				return jsonToolResult(recurrence)
+			},
+		},
+	}
+}
+
+// --- Trash Tools ---
+
+func trashTools(db *Database) []server.ServerTool {
+	var tools []server.ServerTool
+	for _, entity := range TrashEntities {
+		entity := entity
+		name := entityName(entity)
+		tools = append(tools, server.ServerTool{
+			Tool: mcp.NewTool("restore_"+entity,
+				mcp.WithDescription(fmt.Sprintf("Restore a deleted %s from the trash, along with everything that was deleted with it", name)),
+				mcp.WithNumber("id", mcp.Required(), mcp.Description(fmt.Sprintf("ID of the deleted %s", name))),
+			),
+			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				id, err := req.RequireFloat("id")
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				item, err := db.WithActor(toolActor(ctx)).Restore(entity, int64(id))
+				if err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("failed to restore %s: %v", name, err)), nil
+				}
+				return jsonToolResult(item)
+			},
+		})
+	}
+
+	return append(tools,
+		server.ServerTool{
+			Tool: mcp.NewTool("list_trash",
+				mcp.WithDescription("List deleted items in the trash, most recently deleted first. Each entry counts the items deleted with it, such as a project's tasks. Items are purged after the retention period."),
+				mcp.WithString("entity", mcp.Description("Only list deleted items of this type"), mcp.Enum(TrashEntities...)),
+				mcp.WithNumber("limit", mcp.Description(fmt.Sprintf("Maximum number of entries to return (default %d, max %d)", defaultListLimit, maxListLimit))),
+				mcp.WithString("cursor", mcp.Description("next_cursor from the previous page, to fetch older entries")),
+			),
+			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				opts := ListOptions{
+					Limit:  req.GetInt("limit", defaultListLimit),
+					Cursor: req.GetString("cursor", ""),
+				}
+				entries, page, err := db.ListTrashPage(optionalString(req, "entity"), opts)
+				if err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("failed to list trash: %v", err)), nil
+				}
+				if entries == nil {
+					entries = []*TrashEntry{}
+				}
+				return listToolResult(entries, page, nil)
+			},
+		},
+		server.ServerTool{
+			Tool: mcp.NewTool("purge_trash",
+				mcp.WithDescription("Permanently delete items from the trash. This cannot be undone. Purges one entry if trash_id is given, otherwise every entry deleted more than older_than_days ago."),
+				mcp.WithNumber("trash_id", mcp.Description("ID of the trash entry to purge, from list_trash")),
+				mcp.WithNumber("older_than_days", mcp.Description("Only purge entries deleted more than this many days ago; 0 empties the trash")),
+			),
+			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				purger := db.WithActor(toolActor(ctx))
+				if trashID := optionalInt64(req, "trash_id"); trashID != nil {
+					if err := purger.PurgeTrashEntry(*trashID); err != nil {
+						return mcp.NewToolResultError(fmt.Sprintf("failed to purge trash: %v", err)), nil
+					}
+					return jsonToolResult(map[string]int{"purged": 1})
+				}
+
+				days := optionalInt64(req, "older_than_days")
+				if days == nil || *days < 0 {
+					return mcp.NewToolResultError("trash_id or a non-negative older_than_days is required"), nil
+				}
+				n, err := purger.PurgeTrash(time.Duration(*days) * 24 * time.Hour)
+				if err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("failed to purge trash: %v", err)), nil
+				}
+				return jsonToolResult(map[string]int{"purged": n})
+			},
+		},
+	)
+}
+
+// --- Voice Tools ---
+
+// VoiceMessageResult reports the delivery of a voice message.
+type VoiceMessageResult struct {
+	Delivered bool `json:"delivered"`
+	Listeners int  `json:"listeners"`
+}
+
+func backupTools(db *Database) []server.ServerTool {
+	return []server.ServerTool{
+		{
+			Tool: mcp.NewTool("create_backup",
+				mcp.WithDescription("Snapshot the whole database into the backup directory. Take one before a large reorganisation, such as moving or deleting many items, so it can be undone by restoring the snapshot."),
+				mcp.WithString("label", mcp.Description("What the snapshot is for, added to its file name, e.g. before-reorg")),
+			),
+			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				backup, err := db.Snapshot(req.GetString("label", ""))
+				if err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("failed to create backup: %v", err)), nil
+				}
+				return jsonToolResult(backup)
+			},
+		},
+		{
+			Tool: mcp.NewTool("list_backups",
+				mcp.WithDescription("List the snapshots in the backup directory, newest first. Restoring one is done with the loom restore command while Loom is stopped."),
+			),
+			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				backups, err := db.ListBackups()
+				if err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("failed to list backups: %v", err)), nil
+				}
+				return jsonToolResult(backups)
+			},
+		},
+	}
+}
+
+func syncTools(db *Database) []server.ServerTool {
+	return []server.ServerTool{
+		{
+			Tool: mcp.NewTool("list_sync_links",
+				mcp.WithDescription("List the projects linked to issue trackers such as GitHub, with when each was last synced and any error"),
+				mcp.WithNumber("project_id", mcp.Description("Filter by project ID")),
+			),
+			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				links, err := db.ListSyncLinks(optionalInt64(req, "project_id"))
+				if err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("failed to list sync links: %v", err)), nil
+				}
+				return jsonToolResult(links)
+			},
+		},
+		{
+			Tool: mcp.NewTool("sync_issues",
+				mcp.WithDescription("Sync linked projects with their issue trackers now rather than waiting for the next scheduled sync: new epics become projects, new issues become tasks, issue changes update their tasks and comments become notes, and task status changes and new notes are pushed back"),
+				mcp.WithNumber("link_id", mcp.Description("Sync link ID; all links are synced if omitted")),
+				mcp.WithBoolean("dry_run", mcp.Description("List the changes the sync would make without making them")),
+			),
+			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				dryRun := req.GetBool("dry_run", false)
+				if linkID := optionalInt64(req, "link_id"); linkID != nil {
+					result, err := db.SyncIssues(*linkID, dryRun)
+					if err != nil {
+						return mcp.NewToolResultError(fmt.Sprintf("failed to sync issues: %v", err)), nil
+					}
+					return jsonToolResult(result)
+				}
+				results, err := db.SyncAllIssues(dryRun)
+				if err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("failed to sync issues: %v", err)), nil
+				}
+				return jsonToolResult(results)
+			},
+		},
+	}
+}
+
+func voiceTools(voiceFunc VoiceFunc) []server.ServerTool {
+	return []server.ServerTool{
+		{
+			Tool: mcp.NewTool("send_voice_message",
+				mcp.WithDescription("Send a voice message to the user using text-to-speech. The message will be spoken aloud using a UK woman's voice unless the user has muted voice notifications. Reports whether any dashboard was connected to hear it."),
+				mcp.WithString("text", mcp.Required(), mcp.Description("Text to speak (max 5000 characters)")),
+				mcp.WithString("voice", mcp.Description("TTS voice name (e.g. Emma, Isabella); defaults to the dashboard's voice")),
+				mcp.WithString("urgency", mcp.Description("Urgency of the message; high interrupts any message currently playing"), mcp.Enum("low", "normal", "high")),
+			),
+			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				text, err := req.RequireString("text")
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				msg := VoiceMessage{
+					Text:    text,
+					Voice:   req.GetString("voice", ""),
+					Urgency: req.GetString("urgency", ""),
+				}
+				if err := msg.Validate(); err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+
+				listeners, err := voiceFunc(msg)
+				if err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("failed to send voice message: %v", err)), nil
+				}
+				return jsonToolResult(VoiceMessageResult{Delivered: listeners > 0, Listeners: listeners})
+			},
+		},
+	}
+}
+
 // --- Helpers ---
 
 // jsonToolResult marshals data to JSON and returns it as a tool result.
@@ -985,6 +1870,263 @@ func jsonToolResult(data interface{}) (*mcp.CallToolResult, error) {
 	return mcp.NewToolResultText(string(jsonBytes)), nil
 }
 
+// toolActor identifies the MCP client making a tool call for the activity
+// log, e.g. "mcp:claude-code/<session id>", or the API token it
+// authenticated with
+func toolActor(ctx context.Context) string {
+	if token := tokenFromContext(ctx); token != nil {
+		return token.Actor()
+	}
+	actor := "mcp"
+	session := server.ClientSessionFromContext(ctx)
+	if session == nil {
+		return actor
+	}
+	if s, ok := session.(server.SessionWithClientInfo); ok {
+		if name := s.GetClientInfo().Name; name != "" {
+			actor += ":" + name
+		}
+	}
+	if id := session.SessionID(); id != "" {
+		actor += "/" + id
+	}
+	return actor
+}
+
+// readOnlyTool reports whether a tool only reads, so read tokens may call it
+func readOnlyTool(name string) bool {
+	return name == "search" || strings.HasPrefix(name, "list_") || strings.HasPrefix(name, "get_")
+}
+
+// itemTools maps the tools that act on one item, named by their id
+// argument, to the item's entity type
+var itemTools = map[string]string{
+	"get_project":      EntityProject,
+	"update_project":   EntityProject,
+	"delete_project":   EntityProject,
+	"get_task":         EntityTask,
+	"update_task":      EntityTask,
+	"delete_task":      EntityTask,
+	"get_blockers":     EntityTask,
+	"get_task_tree":    EntityTask,
+	"get_problem":      EntityProblem,
+	"update_problem":   EntityProblem,
+	"delete_problem":   EntityProblem,
+	"get_outcome":      EntityOutcome,
+	"update_outcome":   EntityOutcome,
+	"delete_outcome":   EntityOutcome,
+	"get_goal":         EntityGoal,
+	"update_goal":      EntityGoal,
+	"delete_goal":      EntityGoal,
+	"get_task_note":    EntityTaskNote,
+	"update_task_note": EntityTaskNote,
+	"delete_task_note": EntityTaskNote,
+}
+
+// projectScopedTools are the other tools a token limited to a project may call.
+// Their project_id defaults to the token's project, and the items their
+// arguments refer to must be in it.
+var projectScopedTools = map[string]bool{
+	"create_task": true, "create_problem": true, "create_outcome": true, "create_goal": true,
+	"list_tasks": true, "list_problems": true, "list_outcomes": true, "list_goals": true, "list_recurrences": true,
+	"create_task_note": true, "list_task_notes": true,
+	"add_dependency": true, "remove_dependency": true,
+	"link_problem_to_project": true, "unlink_problem_from_project": true, "get_problem_projects": true, "get_project_problems": true,
+	"link_goal_to_project": true, "unlink_goal_from_project": true, "get_goal_projects": true, "get_project_goals": true,
+	"tag_item": true, "untag_item": true,
+}
+
+// filterTokenTools hides the tools a client's API token does not allow
+func filterTokenTools(ctx context.Context, tools []mcp.Tool) []mcp.Tool {
+	token := tokenFromContext(ctx)
+	if token == nil {
+		return tools
+	}
+	var allowed []mcp.Tool
+	for _, tool := range tools {
+		if token.Access != AccessWrite && !readOnlyTool(tool.Name) {
+			continue
+		}
+		if token.ProjectID != nil && itemTools[tool.Name] == "" && !projectScopedTools[tool.Name] {
+			continue
+		}
+		allowed = append(allowed, tool)
+	}
+	return allowed
+}
+
+// authorizeToolCalls checks each tool call against the API token the client
+// authenticated with. Calls made without a token, over stdio or with
+// authentication disabled, are not checked.
+func authorizeToolCalls(db *Database) server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			token := tokenFromContext(ctx)
+			if token == nil {
+				return next(ctx, req)
+			}
+			if err := authorizeToolCall(db, token, &req); err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("not allowed: %v", err)), nil
+			}
+			return next(ctx, req)
+		}
+	}
+}
+
+func authorizeToolCall(db *Database, token *APIToken, req *mcp.CallToolRequest) error {
+	name := req.Params.Name
+	if !readOnlyTool(name) {
+		if err := token.authorizeWrite(); err != nil {
+			return err
+		}
+	}
+	if token.ProjectID == nil {
+		return nil
+	}
+
+	args := req.GetArguments()
+	if args == nil {
+		args = map[string]interface{}{}
+		req.Params.Arguments = args
+	}
+	if entity := itemTools[name]; entity != "" {
+		id, _, err := referenceID(args, "id")
+		if err != nil {
+			return err
+		}
+		if err := db.authorizeItem(token, entity, id); err != nil {
+			return err
+		}
+	} else if projectScopedTools[name] {
+		if name == "tag_item" || name == "untag_item" {
+			entity, _ := args["entity"].(string)
+			id, _, err := referenceID(args, "id")
+			if err != nil {
+				return err
+			}
+			if err := db.authorizeItem(token, entity, id); err != nil {
+				return err
+			}
+		}
+		// A missing or null project_id would reach every project, so it
+		// becomes the token's
+		if _, ok, err := referenceID(args, "project_id"); !ok && err == nil {
+			args["project_id"] = float64(*token.ProjectID)
+		}
+	} else {
+		return token.authorizeAllProjects()
+	}
+	return db.authorizeReferences(token, args)
+}
+
+// listParams adds the paging, sorting and field projection parameters shared
+// by the list tools
+func listParams(sortFields []string) mcp.ToolOption {
+	return func(t *mcp.Tool) {
+		for _, opt := range []mcp.ToolOption{
+			mcp.WithNumber("limit", mcp.Description(fmt.Sprintf("Maximum number of results to return (default %d, max %d)", defaultListLimit, maxListLimit))),
+			mcp.WithString("cursor", mcp.Description("next_cursor from the previous page, to fetch the page after it")),
+			mcp.WithString("sort", mcp.Description("Field to sort by (default updated_at)"), mcp.Enum(sortFields...)),
+			mcp.WithString("order", mcp.Description("Sort order (default desc for dates and priority, asc otherwise)"), mcp.Enum(SortOrders...)),
+			mcp.WithString("fields", mcp.Description("Comma-separated fields to return for each item, e.g. \"id,title\"; returns every field if omitted")),
+		} {
+			opt(t)
+		}
+	}
+}
+
+// dateParams adds the start_at and due_at parameters of the create and
+// update tools
+func dateParams(update bool) mcp.ToolOption {
+	clear := ""
+	if update {
+		clear = "; an empty string clears it"
+	}
+	return func(t *mcp.Tool) {
+		mcp.WithString("start_at", mcp.Description("Start date, e.g. "+DateExamples+clear))(t)
+		mcp.WithString("due_at", mcp.Description("Due date; a date without a time is due at the end of that day"+clear))(t)
+	}
+}
+
+// itemDates reads the arguments added by dateParams
+func itemDates(db *Database, req mcp.CallToolRequest) (startAt, dueAt *time.Time, err error) {
+	return db.ParseDates(optionalString(req, "start_at"), optionalString(req, "due_at"))
+}
+
+// recurrenceParam adds the recurrence parameter of create_task and
+// update_task
+func recurrenceParam(update bool) mcp.ToolOption {
+	description := "Repeat the task on an iCalendar RRULE counted from its due_at, which is required, e.g. FREQ=WEEKLY;BYDAY=MO or FREQ=MONTHLY;BYMONTHDAY=-1. Supports FREQ (DAILY, WEEKLY, MONTHLY, YEARLY), INTERVAL, BYDAY (weekly), BYMONTHDAY (monthly), COUNT and UNTIL. Completing an instance creates the next one."
+	if update {
+		description += " An empty string stops the task from repeating."
+	}
+	return mcp.WithString("recurrence", mcp.Description(description))
+}
+
+// personParamDescription describes a parameter that names a person
+func personParamDescription(what string) string {
+	return what + ": a person's handle, email or name; names not in the people directory are added to it"
+}
+
+// setTaskRecurrence sets the recurrence rule of a task and returns the task
+func setTaskRecurrence(db *Database, taskID int64, rule string) (*Task, error) {
+	if _, err := db.SetTaskRecurrence(taskID, rule); err != nil {
+		return nil, err
+	}
+	return db.GetTask(taskID)
+}
+
+// dueFilterParams adds the due date filters of the list tools
+func dueFilterParams() mcp.ToolOption {
+	return func(t *mcp.Tool) {
+		mcp.WithString("due_before", mcp.Description("Only items due on or before this date, e.g. friday or 2026-03-01"))(t)
+		mcp.WithString("due_after", mcp.Description("Only items due on or after this date, e.g. today"))(t)
+		mcp.WithBoolean("overdue", mcp.Description("true for only items that are past their due date and not completed"))(t)
+	}
+}
+
+// dueFilter reads the arguments added by dueFilterParams
+func dueFilter(db *Database, req mcp.CallToolRequest) (DueFilter, error) {
+	return db.ParseDueFilter(req.GetString("due_before", ""), req.GetString("due_after", ""), req.GetBool("overdue", false))
+}
+
+// tagFilterParams adds the tag filters of the list tools
+func tagFilterParams() mcp.ToolOption {
+	return func(t *mcp.Tool) {
+		mcp.WithString("tag", mcp.Description("Only items with these comma-separated tags, e.g. backend,urgent; separate them with | instead for items with any of them"))(t)
+		mcp.WithString("tag_match", mcp.Description("Whether items need all of the tags (default) or any of them"), mcp.Enum(TagMatches...))(t)
+	}
+}
+
+// tagFilter reads the arguments added by tagFilterParams
+func tagFilter(req mcp.CallToolRequest) (TagFilter, error) {
+	return ParseTagFilter(req.GetString("tag", ""), req.GetString("tag_match", ""))
+}
+
+// listOptions reads the arguments added by listParams
+func listOptions(req mcp.CallToolRequest) (ListOptions, []string) {
+	opts := ListOptions{
+		Limit:  req.GetInt("limit", defaultListLimit),
+		Cursor: req.GetString("cursor", ""),
+		Sort:   req.GetString("sort", ""),
+		Order:  req.GetString("order", ""),
+	}
+	return opts, parseFields(req.GetString("fields", ""))
+}
+
+// listToolResult returns a page of items together with the total count and
+// the cursor for the next page, keeping only the given fields of each item
+func listToolResult(items interface{}, page *PageInfo, fields []string) (*mcp.CallToolResult, error) {
+	projected, err := projectFields(items, fields)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	return jsonToolResult(struct {
+		Items interface{} `json:"items"`
+		*PageInfo
+	}{projected, page})
+}
+
 // optionalString returns a pointer to the string value of the given argument,
 // or nil if the argument is not present.
 func optionalString(req mcp.CallToolRequest, key string) *string {
@@ -997,15 +2139,25 @@ func optionalString(req mcp.CallToolRequest, key string) *string {
 	return nil
 }
 
-// optionalInt64 returns a pointer to the int64 value of the given numeric argument,
+// optionalBool returns a pointer to the boolean value of the given argument,
 // or nil if the argument is not present.
-func optionalInt64(req mcp.CallToolRequest, key string) *int64 {
+func optionalBool(req mcp.CallToolRequest, key string) *bool {
 	args := req.GetArguments()
 	if v, ok := args[key]; ok {
-		if f, ok := v.(float64); ok {
-			i := int64(f)
-			return &i
+		if b, ok := v.(bool); ok {
+			return &b
 		}
 	}
 	return nil
 }
+
+// optionalInt64 returns a pointer to the int64 value of the given numeric argument,
+// or nil if the argument is not present. Numeric strings are read as numbers,
+// as referenceID reads them when authorizing the call.
+func optionalInt64(req mcp.CallToolRequest, key string) *int64 {
+	i, ok, err := referenceID(req.GetArguments(), key)
+	if !ok || err != nil {
+		return nil
+	}
+	return &i
+}
@@ -1,10 +1,15 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/mark3labs/mcp-go/mcp"
@@ -35,6 +40,15 @@ func setupTestMCPServer(t *testing.T) (*mcptest.Server, *Database, func()) {
 	srv.AddTools(goalTools(testDB, func(string) {})...)
 	srv.AddTools(taskNoteTools(testDB, func(string) {})...)
 	srv.AddTools(summaryTools(testDB)...)
+	srv.AddTools(searchTools(testDB)...)
+	srv.AddTools(activityTools(testDB)...)
+	srv.AddTools(trashTools(testDB)...)
+	srv.AddTools(dueTools(testDB)...)
+	srv.AddTools(recurrenceTools(testDB)...)
+	srv.AddTools(tagTools(testDB)...)
+	srv.AddTools(peopleTools(testDB)...)
+	srv.AddTools(backupTools(testDB)...)
+	srv.AddTools(syncTools(testDB)...)
 
 	if err := srv.Start(context.Background()); err != nil {
 		os.RemoveAll(tempDir)
@@ -79,6 +93,17 @@ func getTextContent(result *mcp.CallToolResult) string {
 	return ""
 }
 
+// unmarshalListItems decodes the items of a list tool result into v
+func unmarshalListItems(text string, v interface{}) error {
+	var page struct {
+		Items json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(text), &page); err != nil {
+		return err
+	}
+	return json.Unmarshal(page.Items, v)
+}
+
 func TestNewMCPServer(t *testing.T) {
 	s, _, cleanup := setupTestMCPServer(t)
 	defer cleanup()
@@ -107,7 +132,7 @@ func TestMCPCreateAndListProjects(t *testing.T) {
 	}
 
 	var projects []Project
-	if err := json.Unmarshal([]byte(getTextContent(result)), &projects); err != nil {
+	if err := unmarshalListItems(getTextContent(result), &projects); err != nil {
 		t.Fatalf("Failed to parse projects JSON: %v", err)
 	}
 	if len(projects) != 1 {
@@ -122,7 +147,7 @@ func TestMCPGetAndUpdateProject(t *testing.T) {
 	s, testDB, cleanup := setupTestMCPServer(t)
 	defer cleanup()
 
-	project, _ := testDB.CreateProject("Original", "desc", "active", "")
+	project, _ := testDB.CreateProject("Original", "desc", "active", "", nil, nil)
 
 	result := callMCPTool(t, s, "get_project", map[string]interface{}{
 		"id": float64(project.ID),
@@ -152,7 +177,7 @@ func TestMCPDeleteProject(t *testing.T) {
 	s, testDB, cleanup := setupTestMCPServer(t)
 	defer cleanup()
 
-	project, _ := testDB.CreateProject("ToDelete", "", "", "")
+	project, _ := testDB.CreateProject("ToDelete", "", "", "", nil, nil)
 
 	result := callMCPTool(t, s, "delete_project", map[string]interface{}{
 		"id": float64(project.ID),
@@ -163,7 +188,7 @@ func TestMCPDeleteProject(t *testing.T) {
 
 	result = callMCPTool(t, s, "list_projects", map[string]interface{}{})
 	var projects []Project
-	if err := json.Unmarshal([]byte(getTextContent(result)), &projects); err != nil {
+	if err := unmarshalListItems(getTextContent(result), &projects); err != nil {
 		t.Fatalf("Failed to parse projects JSON: %v", err)
 	}
 	if len(projects) != 0 {
@@ -175,7 +200,7 @@ func TestMCPCreateAndListTasks(t *testing.T) {
 	s, testDB, cleanup := setupTestMCPServer(t)
 	defer cleanup()
 
-	project, _ := testDB.CreateProject("Test Project", "", "", "")
+	project, _ := testDB.CreateProject("Test Project", "", "", "", nil, nil)
 
 	result := callMCPTool(t, s, "create_task", map[string]interface{}{
 		"project_id": float64(project.ID),
@@ -190,7 +215,7 @@ func TestMCPCreateAndListTasks(t *testing.T) {
 
 	result = callMCPTool(t, s, "list_tasks", map[string]interface{}{})
 	var tasks []Task
-	if err := json.Unmarshal([]byte(getTextContent(result)), &tasks); err != nil {
+	if err := unmarshalListItems(getTextContent(result), &tasks); err != nil {
 		t.Fatalf("Failed to parse tasks JSON: %v", err)
 	}
 	if len(tasks) != 1 {
@@ -216,7 +241,7 @@ func TestMCPCreateAndListProblems(t *testing.T) {
 
 	result = callMCPTool(t, s, "list_problems", map[string]interface{}{})
 	var problems []Problem
-	if err := json.Unmarshal([]byte(getTextContent(result)), &problems); err != nil {
+	if err := unmarshalListItems(getTextContent(result), &problems); err != nil {
 		t.Fatalf("Failed to parse problems JSON: %v", err)
 	}
 	if len(problems) != 1 {
@@ -241,7 +266,7 @@ func TestMCPCreateAndListGoals(t *testing.T) {
 
 	result = callMCPTool(t, s, "list_goals", map[string]interface{}{})
 	var goals []Goal
-	if err := json.Unmarshal([]byte(getTextContent(result)), &goals); err != nil {
+	if err := unmarshalListItems(getTextContent(result), &goals); err != nil {
 		t.Fatalf("Failed to parse goals JSON: %v", err)
 	}
 	if len(goals) != 1 {
@@ -256,7 +281,7 @@ func TestMCPCreateAndListOutcomes(t *testing.T) {
 	s, testDB, cleanup := setupTestMCPServer(t)
 	defer cleanup()
 
-	project, _ := testDB.CreateProject("Test Project", "", "", "")
+	project, _ := testDB.CreateProject("Test Project", "", "", "", nil, nil)
 
 	result := callMCPTool(t, s, "create_outcome", map[string]interface{}{
 		"project_id":  float64(project.ID),
@@ -270,7 +295,7 @@ func TestMCPCreateAndListOutcomes(t *testing.T) {
 
 	result = callMCPTool(t, s, "list_outcomes", map[string]interface{}{})
 	var outcomes []Outcome
-	if err := json.Unmarshal([]byte(getTextContent(result)), &outcomes); err != nil {
+	if err := unmarshalListItems(getTextContent(result), &outcomes); err != nil {
 		t.Fatalf("Failed to parse outcomes JSON: %v", err)
 	}
 	if len(outcomes) != 1 {
@@ -285,8 +310,8 @@ func TestMCPCreateAndListTaskNotes(t *testing.T) {
 	s, testDB, cleanup := setupTestMCPServer(t)
 	defer cleanup()
 
-	project, _ := testDB.CreateProject("Test Project", "", "", "")
-	task, _ := testDB.CreateTask(project.ID, "Test Task", "", "pending", "high", "feature", "")
+	project, _ := testDB.CreateProject("Test Project", "", "", "", nil, nil)
+	task, _ := testDB.CreateTask(project.ID, nil, "Test Task", "", "pending", "high", "feature", "", "", "", nil, nil)
 
 	result := callMCPTool(t, s, "create_task_note", map[string]interface{}{
 		"task_id": float64(task.ID),
@@ -344,18 +369,18 @@ func TestMCPGetActiveWorkSummary(t *testing.T) {
 	defer cleanup()
 
 	// Create test data: mix of active and inactive items
-	activeProject, _ := db.CreateProject("Active Project", "desc", "active", "")
-	db.CreateProject("Completed Project", "desc", "completed", "")
+	activeProject, _ := db.CreateProject("Active Project", "desc", "active", "", nil, nil)
+	db.CreateProject("Completed Project", "desc", "completed", "", nil, nil)
 
-	db.CreateTask(activeProject.ID, "Pending Task", "", "pending", "low", "general", "")
-	db.CreateTask(activeProject.ID, "In-Progress Task", "", "in_progress", "high", "feature", "")
-	db.CreateTask(activeProject.ID, "Completed Task", "", "completed", "low", "general", "")
+	db.CreateTask(activeProject.ID, nil, "Pending Task", "", "pending", "low", "general", "", "", "", nil, nil)
+	db.CreateTask(activeProject.ID, nil, "In-Progress Task", "", "in_progress", "high", "feature", "", "", "", nil, nil)
+	db.CreateTask(activeProject.ID, nil, "Completed Task", "", "completed", "low", "general", "", "", "", nil, nil)
 
 	db.CreateProblem(nil, nil, "Open Problem", "desc", "open", "")
 	db.CreateProblem(nil, nil, "Resolved Problem", "desc", "resolved", "")
 
-	db.CreateOutcome(activeProject.ID, nil, "Open Outcome", "desc", "open")
-	db.CreateOutcome(activeProject.ID, nil, "Completed Outcome", "desc", "completed")
+	db.CreateOutcome(activeProject.ID, nil, "Open Outcome", "desc", "open", nil, nil)
+	db.CreateOutcome(activeProject.ID, nil, "Completed Outcome", "desc", "completed", nil, nil)
 
 	result := callMCPTool(t, s, "get_active_work_summary", map[string]interface{}{})
 	text := getTextContent(result)
@@ -383,8 +408,8 @@ func TestMCPListProjectsWithStatusFilter(t *testing.T) {
 	s, db, cleanup := setupTestMCPServer(t)
 	defer cleanup()
 
-	db.CreateProject("Active", "desc", "active", "")
-	db.CreateProject("Completed", "desc", "completed", "")
+	db.CreateProject("Active", "desc", "active", "", nil, nil)
+	db.CreateProject("Completed", "desc", "completed", "", nil, nil)
 
 	// Filter by active status
 	result := callMCPTool(t, s, "list_projects", map[string]interface{}{
@@ -393,7 +418,7 @@ func TestMCPListProjectsWithStatusFilter(t *testing.T) {
 	text := getTextContent(result)
 
 	var projects []*Project
-	if err := json.Unmarshal([]byte(text), &projects); err != nil {
+	if err := unmarshalListItems(text, &projects); err != nil {
 		t.Fatalf("failed to unmarshal projects: %v", err)
 	}
 	if len(projects) != 1 {
@@ -404,10 +429,841 @@ func TestMCPListProjectsWithStatusFilter(t *testing.T) {
 	result = callMCPTool(t, s, "list_projects", map[string]interface{}{})
 	text = getTextContent(result)
 
-	if err := json.Unmarshal([]byte(text), &projects); err != nil {
+	if err := unmarshalListItems(text, &projects); err != nil {
 		t.Fatalf("failed to unmarshal projects: %v", err)
 	}
 	if len(projects) != 2 {
 		t.Errorf("expected 2 projects, got %d", len(projects))
 	}
 }
+
+func TestMCPEnumValidation(t *testing.T) {
+	srv, db, cleanup := setupTestMCPServer(t)
+	defer cleanup()
+
+	tools, err := srv.Client().ListTools(context.Background(), mcp.ListToolsRequest{})
+	if err != nil {
+		t.Fatalf("ListTools failed: %v", err)
+	}
+	found := false
+	for _, tool := range tools.Tools {
+		if tool.Name != "create_task" {
+			continue
+		}
+		found = true
+		status, _ := tool.InputSchema.Properties["status"].(map[string]interface{})
+		enum, _ := status["enum"].([]interface{})
+		if len(enum) != len(TaskStatuses) {
+			t.Errorf("Expected status enum %v in create_task schema, got %v", TaskStatuses, status["enum"])
+		}
+	}
+	if !found {
+		t.Fatal("create_task tool not found")
+	}
+
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	result := callMCPTool(t, srv, "create_task", map[string]interface{}{
+		"project_id": float64(project.ID),
+		"title":      "Typo",
+		"status":     "done",
+	})
+	if !result.IsError {
+		t.Fatal("Expected error for invalid task status")
+	}
+	if !strings.Contains(getTextContent(result), "expected one of") {
+		t.Errorf("Expected error to list allowed values, got %s", getTextContent(result))
+	}
+
+	task, _ := db.CreateTask(project.ID, nil, "Done", "", "completed", "low", "general", "", "", "", nil, nil)
+	result = callMCPTool(t, srv, "update_task", map[string]interface{}{
+		"id":     float64(task.ID),
+		"status": "pending",
+	})
+	if !result.IsError || !strings.Contains(getTextContent(result), "transition not allowed") {
+		t.Errorf("Expected error for forbidden status transition, got %s", getTextContent(result))
+	}
+}
+
+func TestMCPSearch(t *testing.T) {
+	srv, db, cleanup := setupTestMCPServer(t)
+	defer cleanup()
+
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	task, _ := db.CreateTask(project.ID, nil, "Migrate auth service", "", "pending", "low", "general", "", "", "", nil, nil)
+	db.CreateTaskNote(task.ID, "Auth tokens must be rotated first")
+
+	result := callMCPTool(t, srv, "search", map[string]interface{}{"query": "auth"})
+	if result.IsError {
+		t.Fatalf("search returned error: %s", getTextContent(result))
+	}
+	var results []SearchResult
+	if err := json.Unmarshal([]byte(getTextContent(result)), &results); err != nil {
+		t.Fatalf("Failed to parse result JSON: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected task and note results, got %+v", results)
+	}
+
+	result = callMCPTool(t, srv, "search", map[string]interface{}{"query": "auth", "entity": "task", "limit": float64(5)})
+	json.Unmarshal([]byte(getTextContent(result)), &results)
+	if len(results) != 1 || results[0].Entity != "task" || results[0].ID != task.ID {
+		t.Errorf("Expected only the task, got %+v", results)
+	}
+
+	result = callMCPTool(t, srv, "search", map[string]interface{}{"query": "nothing matches this"})
+	if result.IsError || strings.TrimSpace(getTextContent(result)) != "[]" {
+		t.Errorf("Expected empty result list, got %s", getTextContent(result))
+	}
+
+	result = callMCPTool(t, srv, "search", map[string]interface{}{})
+	if !result.IsError {
+		t.Error("Expected error for missing query")
+	}
+}
+
+func TestMCPListPagination(t *testing.T) {
+	srv, db, cleanup := setupTestMCPServer(t)
+	defer cleanup()
+
+	for _, name := range []string{"Alpha", "Bravo", "Charlie"} {
+		db.CreateProject(name, "A description", "", "", nil, nil)
+	}
+
+	result := callMCPTool(t, srv, "list_projects", map[string]interface{}{
+		"limit":  float64(2),
+		"sort":   "name",
+		"fields": "id, name",
+	})
+	if result.IsError {
+		t.Fatalf("list_projects returned error: %s", getTextContent(result))
+	}
+	var page struct {
+		Items      []map[string]interface{} `json:"items"`
+		Total      int                      `json:"total"`
+		NextCursor string                   `json:"next_cursor"`
+	}
+	if err := json.Unmarshal([]byte(getTextContent(result)), &page); err != nil {
+		t.Fatalf("Failed to parse result JSON: %v", err)
+	}
+	if page.Total != 3 || len(page.Items) != 2 || page.NextCursor == "" {
+		t.Fatalf("Expected first 2 of 3 projects with a cursor, got %+v", page)
+	}
+	if len(page.Items[0]) != 2 || page.Items[0]["name"] != "Alpha" {
+		t.Errorf("Expected only id and name of Alpha, got %v", page.Items[0])
+	}
+
+	result = callMCPTool(t, srv, "list_projects", map[string]interface{}{
+		"limit":  float64(2),
+		"sort":   "name",
+		"cursor": page.NextCursor,
+	})
+	page.NextCursor = ""
+	if err := json.Unmarshal([]byte(getTextContent(result)), &page); err != nil {
+		t.Fatalf("Failed to parse result JSON: %v", err)
+	}
+	if len(page.Items) != 1 || page.Items[0]["name"] != "Charlie" || page.NextCursor != "" {
+		t.Errorf("Expected last page with Charlie, got %+v", page)
+	}
+
+	for _, args := range []map[string]interface{}{
+		{"sort": "priority"},
+		{"fields": "id,colour"},
+		{"cursor": "bogus"},
+	} {
+		if result := callMCPTool(t, srv, "list_projects", args); !result.IsError {
+			t.Errorf("Expected error for %v, got %s", args, getTextContent(result))
+		}
+	}
+}
+
+func TestMCPGetHistory(t *testing.T) {
+	srv, _, cleanup := setupTestMCPServer(t)
+	defer cleanup()
+
+	result := callMCPTool(t, srv, "create_project", map[string]interface{}{"name": "Tracked"})
+	var project Project
+	json.Unmarshal([]byte(getTextContent(result)), &project)
+	callMCPTool(t, srv, "update_project", map[string]interface{}{"id": float64(project.ID), "status": "on_hold"})
+
+	result = callMCPTool(t, srv, "get_history", map[string]interface{}{"entity": "project", "id": float64(project.ID)})
+	if result.IsError {
+		t.Fatalf("get_history returned error: %s", getTextContent(result))
+	}
+	var entries []Activity
+	if err := unmarshalListItems(getTextContent(result), &entries); err != nil {
+		t.Fatalf("Failed to parse result JSON: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Action != ActionUpdated || entries[1].Action != ActionCreated {
+		t.Fatalf("Expected update then create, got %+v", entries)
+	}
+	if change := entries[0].Changes["status"]; change.Old != "active" || change.New != "on_hold" {
+		t.Errorf("Expected status change active -> on_hold, got %+v", entries[0].Changes)
+	}
+	if !strings.HasPrefix(entries[0].Actor, "mcp") {
+		t.Errorf("Expected an MCP actor, got %q", entries[0].Actor)
+	}
+
+	result = callMCPTool(t, srv, "get_history", map[string]interface{}{"id": float64(project.ID)})
+	if !result.IsError {
+		t.Error("Expected error for id without entity")
+	}
+}
+
+func TestMCPTrash(t *testing.T) {
+	srv, _, cleanup := setupTestMCPServer(t)
+	defer cleanup()
+
+	result := callMCPTool(t, srv, "create_project", map[string]interface{}{"name": "Doomed"})
+	var project Project
+	json.Unmarshal([]byte(getTextContent(result)), &project)
+	callMCPTool(t, srv, "create_task", map[string]interface{}{"project_id": float64(project.ID), "title": "Child"})
+	callMCPTool(t, srv, "delete_project", map[string]interface{}{"id": float64(project.ID)})
+
+	result = callMCPTool(t, srv, "list_trash", map[string]interface{}{})
+	var entries []TrashEntry
+	if err := unmarshalListItems(getTextContent(result), &entries); err != nil {
+		t.Fatalf("Failed to parse result JSON: %v", err)
+	}
+	if len(entries) != 1 || entries[0].EntityID != project.ID || entries[0].Items != 2 {
+		t.Fatalf("Expected the project and its task in the trash, got %+v", entries)
+	}
+
+	result = callMCPTool(t, srv, "restore_project", map[string]interface{}{"id": float64(project.ID)})
+	if result.IsError {
+		t.Fatalf("restore_project returned error: %s", getTextContent(result))
+	}
+	result = callMCPTool(t, srv, "list_tasks", map[string]interface{}{"project_id": float64(project.ID)})
+	var tasks []Task
+	unmarshalListItems(getTextContent(result), &tasks)
+	if len(tasks) != 1 {
+		t.Errorf("Expected the task to be restored, got %+v", tasks)
+	}
+
+	result = callMCPTool(t, srv, "restore_project", map[string]interface{}{"id": float64(project.ID)})
+	if !result.IsError {
+		t.Error("Expected error restoring a project that is not in the trash")
+	}
+
+	callMCPTool(t, srv, "delete_project", map[string]interface{}{"id": float64(project.ID)})
+	result = callMCPTool(t, srv, "purge_trash", map[string]interface{}{})
+	if !result.IsError {
+		t.Error("Expected error purging without trash_id or older_than_days")
+	}
+	result = callMCPTool(t, srv, "purge_trash", map[string]interface{}{"older_than_days": float64(0)})
+	if result.IsError || getTextContent(result) != `{"purged":1}` {
+		t.Fatalf("Expected one entry purged, got %s", getTextContent(result))
+	}
+	result = callMCPTool(t, srv, "restore_project", map[string]interface{}{"id": float64(project.ID)})
+	if !result.IsError {
+		t.Error("Expected error restoring a purged project")
+	}
+}
+
+func TestMCPTaskDependencies(t *testing.T) {
+	srv, _, cleanup := setupTestMCPServer(t)
+	defer cleanup()
+
+	result := callMCPTool(t, srv, "create_project", map[string]interface{}{"name": "P"})
+	var project Project
+	json.Unmarshal([]byte(getTextContent(result)), &project)
+	var first, second Task
+	result = callMCPTool(t, srv, "create_task", map[string]interface{}{"project_id": float64(project.ID), "title": "First"})
+	json.Unmarshal([]byte(getTextContent(result)), &first)
+	result = callMCPTool(t, srv, "create_task", map[string]interface{}{"project_id": float64(project.ID), "title": "Second"})
+	json.Unmarshal([]byte(getTextContent(result)), &second)
+
+	result = callMCPTool(t, srv, "add_dependency", map[string]interface{}{"task_id": float64(second.ID), "depends_on_id": float64(first.ID)})
+	if result.IsError {
+		t.Fatalf("add_dependency returned error: %s", getTextContent(result))
+	}
+	result = callMCPTool(t, srv, "add_dependency", map[string]interface{}{"task_id": float64(first.ID), "depends_on_id": float64(second.ID)})
+	if !result.IsError || !strings.Contains(getTextContent(result), "already depends on it") {
+		t.Errorf("Expected a cycle error, got %s", getTextContent(result))
+	}
+
+	result = callMCPTool(t, srv, "list_tasks", map[string]interface{}{"ready": true})
+	var tasks []Task
+	unmarshalListItems(getTextContent(result), &tasks)
+	if len(tasks) != 1 || tasks[0].ID != first.ID {
+		t.Errorf("Expected only the first task to be ready, got %+v", tasks)
+	}
+
+	result = callMCPTool(t, srv, "get_blockers", map[string]interface{}{"id": float64(second.ID)})
+	var blockers TaskBlockers
+	if err := json.Unmarshal([]byte(getTextContent(result)), &blockers); err != nil {
+		t.Fatalf("Failed to parse result JSON: %v", err)
+	}
+	if blockers.Ready || len(blockers.Blockers) != 1 || blockers.Blockers[0].ID != first.ID {
+		t.Errorf("Expected the first task to block, got %+v", blockers)
+	}
+
+	result = callMCPTool(t, srv, "remove_dependency", map[string]interface{}{"task_id": float64(second.ID), "depends_on_id": float64(first.ID)})
+	if result.IsError {
+		t.Fatalf("remove_dependency returned error: %s", getTextContent(result))
+	}
+	result = callMCPTool(t, srv, "remove_dependency", map[string]interface{}{"task_id": float64(second.ID), "depends_on_id": float64(first.ID)})
+	if !result.IsError {
+		t.Error("Expected error removing a missing dependency")
+	}
+}
+
+func TestMCPTaskTree(t *testing.T) {
+	srv, _, cleanup := setupTestMCPServer(t)
+	defer cleanup()
+
+	result := callMCPTool(t, srv, "create_project", map[string]interface{}{"name": "P"})
+	var project Project
+	json.Unmarshal([]byte(getTextContent(result)), &project)
+	var parent, child Task
+	result = callMCPTool(t, srv, "create_task", map[string]interface{}{"project_id": float64(project.ID), "title": "Parent"})
+	json.Unmarshal([]byte(getTextContent(result)), &parent)
+	result = callMCPTool(t, srv, "create_task", map[string]interface{}{"project_id": float64(project.ID), "title": "Child", "parent_task_id": float64(parent.ID), "status": "completed"})
+	json.Unmarshal([]byte(getTextContent(result)), &child)
+	if child.ParentTaskID == nil || *child.ParentTaskID != parent.ID {
+		t.Fatalf("Expected a subtask of the parent, got %s", getTextContent(result))
+	}
+
+	result = callMCPTool(t, srv, "get_task_tree", map[string]interface{}{"id": float64(parent.ID)})
+	var tree TaskTree
+	if err := json.Unmarshal([]byte(getTextContent(result)), &tree); err != nil {
+		t.Fatalf("Failed to parse result JSON: %v", err)
+	}
+	if tree.ID != parent.ID || len(tree.Subtasks) != 1 || tree.Subtasks[0].ID != child.ID || tree.Progress != 100 {
+		t.Errorf("Expected the parent at 100%% with its subtask, got %s", getTextContent(result))
+	}
+
+	result = callMCPTool(t, srv, "update_task", map[string]interface{}{"id": float64(parent.ID), "parent_task_id": float64(child.ID)})
+	if !result.IsError {
+		t.Error("Expected error moving a task under its own subtask")
+	}
+	result = callMCPTool(t, srv, "update_task", map[string]interface{}{"id": float64(child.ID), "parent_task_id": float64(0)})
+	var moved Task
+	json.Unmarshal([]byte(getTextContent(result)), &moved)
+	if result.IsError || moved.ParentTaskID != nil {
+		t.Errorf("Expected the subtask to become a top-level task, got %s", getTextContent(result))
+	}
+}
+
+func TestMCPDueDates(t *testing.T) {
+	srv, _, cleanup := setupTestMCPServer(t)
+	defer cleanup()
+
+	result := callMCPTool(t, srv, "create_project", map[string]interface{}{"name": "P"})
+	var project Project
+	json.Unmarshal([]byte(getTextContent(result)), &project)
+	var late, soon Task
+	result = callMCPTool(t, srv, "create_task", map[string]interface{}{"project_id": float64(project.ID), "title": "Late", "start_at": "2020-01-01", "due_at": "2020-01-31"})
+	json.Unmarshal([]byte(getTextContent(result)), &late)
+	if result.IsError || late.DueAt == nil || late.StartAt == nil {
+		t.Fatalf("Expected a task with dates, got %s", getTextContent(result))
+	}
+	result = callMCPTool(t, srv, "create_task", map[string]interface{}{"project_id": float64(project.ID), "title": "Soon", "due_at": "tomorrow 9am"})
+	json.Unmarshal([]byte(getTextContent(result)), &soon)
+
+	result = callMCPTool(t, srv, "create_task", map[string]interface{}{"project_id": float64(project.ID), "title": "Bad", "due_at": "someday"})
+	if !result.IsError || !strings.Contains(getTextContent(result), "tomorrow") {
+		t.Errorf("Expected an error listing accepted dates, got %s", getTextContent(result))
+	}
+
+	result = callMCPTool(t, srv, "list_overdue", map[string]interface{}{})
+	var overdue DueItems
+	if err := json.Unmarshal([]byte(getTextContent(result)), &overdue); err != nil {
+		t.Fatalf("Failed to parse result JSON: %v", err)
+	}
+	if len(overdue.Tasks) != 1 || overdue.Tasks[0].ID != late.ID {
+		t.Errorf("Expected the late task to be overdue, got %s", getTextContent(result))
+	}
+
+	result = callMCPTool(t, srv, "list_due_soon", map[string]interface{}{"days": float64(2)})
+	var dueSoon DueItems
+	json.Unmarshal([]byte(getTextContent(result)), &dueSoon)
+	if len(dueSoon.Tasks) != 1 || dueSoon.Tasks[0].ID != soon.ID {
+		t.Errorf("Expected the task due tomorrow, got %s", getTextContent(result))
+	}
+
+	result = callMCPTool(t, srv, "list_tasks", map[string]interface{}{"due_before": "next week", "sort": "due_at"})
+	var tasks []Task
+	unmarshalListItems(getTextContent(result), &tasks)
+	if len(tasks) != 2 || tasks[0].ID != late.ID {
+		t.Errorf("Expected both tasks soonest due first, got %s", getTextContent(result))
+	}
+
+	// An empty date clears it
+	result = callMCPTool(t, srv, "update_task", map[string]interface{}{"id": float64(late.ID), "due_at": ""})
+	var updated Task
+	json.Unmarshal([]byte(getTextContent(result)), &updated)
+	if result.IsError || updated.DueAt != nil || updated.StartAt == nil {
+		t.Errorf("Expected the due date to be cleared, got %s", getTextContent(result))
+	}
+}
+
+func TestMCPRecurrences(t *testing.T) {
+	srv, _, cleanup := setupTestMCPServer(t)
+	defer cleanup()
+
+	result := callMCPTool(t, srv, "create_project", map[string]interface{}{"name": "P"})
+	var project Project
+	json.Unmarshal([]byte(getTextContent(result)), &project)
+
+	result = callMCPTool(t, srv, "create_task", map[string]interface{}{"project_id": float64(project.ID), "title": "Undated", "recurrence": "FREQ=DAILY"})
+	if !result.IsError || !strings.Contains(getTextContent(result), "due_at") {
+		t.Errorf("Expected an error asking for a due date, got %s", getTextContent(result))
+	}
+
+	result = callMCPTool(t, srv, "create_task", map[string]interface{}{"project_id": float64(project.ID), "title": "Weekly review", "due_at": "tomorrow 9am", "recurrence": "FREQ=WEEKLY"})
+	var task Task
+	json.Unmarshal([]byte(getTextContent(result)), &task)
+	if result.IsError || task.RecurrenceID == nil {
+		t.Fatalf("Expected a recurring task, got %s", getTextContent(result))
+	}
+
+	callMCPTool(t, srv, "update_task", map[string]interface{}{"id": float64(task.ID), "status": "completed"})
+	result = callMCPTool(t, srv, "list_tasks", map[string]interface{}{"status": "pending"})
+	var tasks []Task
+	unmarshalListItems(getTextContent(result), &tasks)
+	if len(tasks) != 1 || tasks[0].ID == task.ID || tasks[0].Title != "Weekly review" {
+		t.Fatalf("Expected the next instance to be pending, got %s", getTextContent(result))
+	}
+
+	result = callMCPTool(t, srv, "list_recurrences", map[string]interface{}{"project_id": float64(project.ID)})
+	var recurrences []Recurrence
+	if err := json.Unmarshal([]byte(getTextContent(result)), &recurrences); err != nil {
+		t.Fatalf("Failed to parse result JSON: %v", err)
+	}
+	if len(recurrences) != 1 || *recurrences[0].TaskID != tasks[0].ID || recurrences[0].Rule != "FREQ=WEEKLY" {
+		t.Errorf("Expected the recurrence to point at the next instance, got %s", getTextContent(result))
+	}
+
+	result = callMCPTool(t, srv, "pause_recurrence", map[string]interface{}{"id": float64(*task.RecurrenceID)})
+	var recurrence Recurrence
+	json.Unmarshal([]byte(getTextContent(result)), &recurrence)
+	if result.IsError || !recurrence.Paused {
+		t.Errorf("Expected the recurrence to be paused, got %s", getTextContent(result))
+	}
+	result = callMCPTool(t, srv, "pause_recurrence", map[string]interface{}{"id": float64(*task.RecurrenceID), "resume": true})
+	json.Unmarshal([]byte(getTextContent(result)), &recurrence)
+	if result.IsError || recurrence.Paused {
+		t.Errorf("Expected the recurrence to be resumed, got %s", getTextContent(result))
+	}
+
+	result = callMCPTool(t, srv, "update_task", map[string]interface{}{"id": float64(tasks[0].ID), "recurrence": "FREQ=FORTNIGHTLY"})
+	if !result.IsError {
+		t.Errorf("Expected an error for an invalid rule, got %s", getTextContent(result))
+	}
+	result = callMCPTool(t, srv, "update_task", map[string]interface{}{"id": float64(tasks[0].ID), "recurrence": ""})
+	var stopped Task
+	json.Unmarshal([]byte(getTextContent(result)), &stopped)
+	if result.IsError || stopped.RecurrenceID != nil {
+		t.Errorf("Expected the task to stop recurring, got %s", getTextContent(result))
+	}
+}
+
+func TestMCPTags(t *testing.T) {
+	srv, db, cleanup := setupTestMCPServer(t)
+	defer cleanup()
+
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	api, _ := db.CreateTask(project.ID, nil, "API", "", "", "", "", "", "", "", nil, nil)
+	db.CreateTask(project.ID, nil, "UI", "", "", "", "", "", "", "", nil, nil)
+
+	result := callMCPTool(t, srv, "tag_item", map[string]interface{}{"entity": "task", "id": float64(api.ID), "tag": "Backend", "color": "#3b82f6"})
+	var tagged Task
+	json.Unmarshal([]byte(getTextContent(result)), &tagged)
+	if result.IsError || len(tagged.Tags) != 1 || tagged.Tags[0] != "backend" {
+		t.Fatalf("Expected the task with its tag, got %s", getTextContent(result))
+	}
+	callMCPTool(t, srv, "tag_item", map[string]interface{}{"entity": "project", "id": float64(project.ID), "tag": "backend"})
+
+	result = callMCPTool(t, srv, "list_tasks", map[string]interface{}{"tag": "backend"})
+	var tasks []Task
+	unmarshalListItems(getTextContent(result), &tasks)
+	if len(tasks) != 1 || tasks[0].ID != api.ID {
+		t.Errorf("Expected only the tagged task, got %s", getTextContent(result))
+	}
+	result = callMCPTool(t, srv, "list_projects", map[string]interface{}{"tag": "backend,frontend", "tag_match": "any"})
+	var projects []Project
+	unmarshalListItems(getTextContent(result), &projects)
+	if len(projects) != 1 {
+		t.Errorf("Expected the tagged project, got %s", getTextContent(result))
+	}
+
+	result = callMCPTool(t, srv, "list_tags", map[string]interface{}{})
+	var tags []Tag
+	if err := json.Unmarshal([]byte(getTextContent(result)), &tags); err != nil {
+		t.Fatalf("Failed to parse result JSON: %v", err)
+	}
+	if len(tags) != 1 || tags[0].Color != "#3b82f6" || tags[0].Items != 2 {
+		t.Errorf("Expected one tag on two items, got %s", getTextContent(result))
+	}
+
+	result = callMCPTool(t, srv, "untag_item", map[string]interface{}{"entity": "task", "id": float64(api.ID), "tag": "backend"})
+	json.Unmarshal([]byte(getTextContent(result)), &tagged)
+	if result.IsError || len(tagged.Tags) != 0 {
+		t.Errorf("Expected the tag to be removed, got %s", getTextContent(result))
+	}
+	result = callMCPTool(t, srv, "tag_item", map[string]interface{}{"entity": "task_note", "id": float64(1), "tag": "x"})
+	if !result.IsError {
+		t.Errorf("Expected an error for an entity that can't be tagged, got %s", getTextContent(result))
+	}
+}
+
+func TestMCPPeople(t *testing.T) {
+	srv, db, cleanup := setupTestMCPServer(t)
+	defer cleanup()
+
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+
+	result := callMCPTool(t, srv, "create_person", map[string]interface{}{"name": "Alice Smith", "handle": "alice", "role": "Backend engineer"})
+	var alice Person
+	if err := json.Unmarshal([]byte(getTextContent(result)), &alice); err != nil || result.IsError {
+		t.Fatalf("Expected the new person, got %s", getTextContent(result))
+	}
+	result = callMCPTool(t, srv, "create_person", map[string]interface{}{"name": "Imposter", "handle": "ALICE"})
+	if !result.IsError {
+		t.Errorf("Expected an error for a duplicate handle, got %s", getTextContent(result))
+	}
+
+	result = callMCPTool(t, srv, "create_task", map[string]interface{}{"project_id": float64(project.ID), "title": "API", "assignee": "@alice", "reviewer": "bob"})
+	var task Task
+	json.Unmarshal([]byte(getTextContent(result)), &task)
+	if task.Assignee != "Alice Smith" || task.Reviewer != "bob" {
+		t.Fatalf("Expected the task to be assigned, got %s", getTextContent(result))
+	}
+	callMCPTool(t, srv, "create_problem", map[string]interface{}{"title": "Flaky build", "assignee": "alice"})
+
+	result = callMCPTool(t, srv, "list_tasks", map[string]interface{}{"assignee": "Alice Smith"})
+	var tasks []Task
+	unmarshalListItems(getTextContent(result), &tasks)
+	if len(tasks) != 1 || tasks[0].ID != task.ID {
+		t.Errorf("Expected alice's task, got %s", getTextContent(result))
+	}
+
+	result = callMCPTool(t, srv, "list_people", map[string]interface{}{})
+	var people []Person
+	json.Unmarshal([]byte(getTextContent(result)), &people)
+	if len(people) != 2 || people[0].Name != "Alice Smith" || people[0].OpenTasks != 1 || people[0].OpenProblems != 1 {
+		t.Errorf("Expected alice with her open work and bob, got %s", getTextContent(result))
+	}
+
+	result = callMCPTool(t, srv, "get_workload", map[string]interface{}{"person": "bob"})
+	var workload Workload
+	json.Unmarshal([]byte(getTextContent(result)), &workload)
+	if result.IsError || len(workload.Reviews) != 1 || len(workload.Tasks) != 0 {
+		t.Errorf("Expected bob to review the task, got %s", getTextContent(result))
+	}
+	result = callMCPTool(t, srv, "get_workload", map[string]interface{}{"id": float64(alice.ID)})
+	json.Unmarshal([]byte(getTextContent(result)), &workload)
+	if len(workload.Tasks) != 1 || len(workload.Problems) != 1 {
+		t.Errorf("Expected alice's task and problem, got %s", getTextContent(result))
+	}
+	if result = callMCPTool(t, srv, "get_workload", map[string]interface{}{}); !result.IsError {
+		t.Errorf("Expected an error without a person, got %s", getTextContent(result))
+	}
+
+	result = callMCPTool(t, srv, "update_person", map[string]interface{}{"id": float64(alice.ID), "role": "Tech lead"})
+	json.Unmarshal([]byte(getTextContent(result)), &alice)
+	if alice.Role != "Tech lead" {
+		t.Errorf("Expected the role to change, got %s", getTextContent(result))
+	}
+	if result = callMCPTool(t, srv, "delete_person", map[string]interface{}{"id": float64(alice.ID)}); result.IsError {
+		t.Errorf("Expected the person to be deleted, got %s", getTextContent(result))
+	}
+	if task, _ := db.GetTask(task.ID); task.AssigneeID != nil {
+		t.Errorf("Expected the task to be unassigned, got %+v", task)
+	}
+}
+
+func TestMCPTokenAuthorization(t *testing.T) {
+	db := newTestDatabase(t)
+	mine, _ := db.CreateProject("Mine", "", "", "", nil, nil)
+	other, _ := db.CreateProject("Other", "", "", "", nil, nil)
+	otherTask, _ := db.CreateTask(other.ID, nil, "Other", "", "", "", "", "", "", "", nil, nil)
+	reader, _, _ := db.CreateAPIToken("reader", AccessRead, nil)
+	scoped, _, _ := db.CreateAPIToken("scoped", AccessWrite, &mine.ID)
+
+	var called map[string]interface{}
+	handler := authorizeToolCalls(db)(func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		called = req.GetArguments()
+		return mcp.NewToolResultText(toolActor(ctx)), nil
+	})
+	call := func(token *APIToken, name string, args map[string]interface{}) *mcp.CallToolResult {
+		called = nil
+		var req mcp.CallToolRequest
+		req.Params.Name = name
+		req.Params.Arguments = args
+		result, err := handler(contextWithToken(context.Background(), token), req)
+		if err != nil {
+			t.Fatalf("%s failed: %v", name, err)
+		}
+		return result
+	}
+
+	if result := call(reader, "list_projects", map[string]interface{}{}); result.IsError || getTextContent(result) != "token:reader" {
+		t.Errorf("Expected the reader to list projects as itself, got %s", getTextContent(result))
+	}
+	if result := call(reader, "create_project", map[string]interface{}{"name": "Nope"}); !result.IsError || called != nil {
+		t.Errorf("Expected a read token to be refused, got %s", getTextContent(result))
+	}
+
+	// A scoped token's list and create calls default to its project
+	if result := call(scoped, "list_tasks", map[string]interface{}{}); result.IsError || called["project_id"] != float64(mine.ID) {
+		t.Errorf("Expected list_tasks to be limited to the project, got %v: %s", called, getTextContent(result))
+	}
+	for _, args := range []map[string]interface{}{nil, {"project_id": nil}} {
+		if result := call(scoped, "list_tasks", args); result.IsError || called["project_id"] != float64(mine.ID) {
+			t.Errorf("Expected list_tasks with %v to be limited to the project, got %v: %s", args, called, getTextContent(result))
+		}
+	}
+	if result := call(scoped, "list_tasks", map[string]interface{}{"project_id": strconv.FormatInt(mine.ID, 10)}); result.IsError {
+		t.Errorf("Expected list_tasks with the project's ID as a string to be allowed, got %s", getTextContent(result))
+	}
+	for _, c := range []struct {
+		name string
+		args map[string]interface{}
+	}{
+		{"list_projects", map[string]interface{}{}},
+		{"search", map[string]interface{}{"query": "x"}},
+		{"get_task", map[string]interface{}{"id": float64(otherTask.ID)}},
+		{"list_tasks", map[string]interface{}{"project_id": float64(other.ID)}},
+		{"tag_item", map[string]interface{}{"entity": "task", "id": float64(otherTask.ID), "tag": "x"}},
+		{"create_task_note", map[string]interface{}{"task_id": float64(otherTask.ID), "note": "x"}},
+		{"create_task", map[string]interface{}{"project_id": strconv.FormatInt(other.ID, 10), "title": "x"}},
+		{"get_task", map[string]interface{}{"id": strconv.FormatInt(otherTask.ID, 10)}},
+		{"create_task", map[string]interface{}{"project_id": []interface{}{float64(mine.ID)}, "title": "x"}},
+	} {
+		if result := call(scoped, c.name, c.args); !result.IsError || called != nil {
+			t.Errorf("%s: expected a scoped token to be refused, got %s", c.name, getTextContent(result))
+		}
+	}
+
+	// The tool lists what the check allowed, whatever form project_id takes
+	listTasks := authorizeToolCalls(db)(NewMCPServer(db, func(VoiceMessage) (int, error) { return 0, nil }, nil).GetTool("list_tasks").Handler)
+	db.CreateTask(mine.ID, nil, "Mine", "", "", "", "", "", "", "", nil, nil)
+	for _, args := range []map[string]interface{}{nil, {"project_id": nil}, {"project_id": strconv.FormatInt(mine.ID, 10)}} {
+		var req mcp.CallToolRequest
+		req.Params.Name = "list_tasks"
+		req.Params.Arguments = args
+		result, _ := listTasks(contextWithToken(context.Background(), scoped), req)
+		var tasks []Task
+		unmarshalListItems(getTextContent(result), &tasks)
+		if len(tasks) != 1 || tasks[0].ProjectID != mine.ID {
+			t.Errorf("Expected list_tasks with %v to list only the project's tasks, got %s", args, getTextContent(result))
+		}
+	}
+
+	tools := filterTokenTools(contextWithToken(context.Background(), reader), []mcp.Tool{{Name: "list_tasks"}, {Name: "update_task"}})
+	if len(tools) != 1 || tools[0].Name != "list_tasks" {
+		t.Errorf("Expected only the read-only tool, got %+v", tools)
+	}
+	tools = filterTokenTools(contextWithToken(context.Background(), scoped), []mcp.Tool{{Name: "list_people"}, {Name: "update_task"}})
+	if len(tools) != 1 || tools[0].Name != "update_task" {
+		t.Errorf("Expected only the project tool, got %+v", tools)
+	}
+}
+
+func TestServeMCPStdio(t *testing.T) {
+	db := newTestDatabase(t)
+	mcpServer := NewMCPServer(db, func(VoiceMessage) (int, error) { return 0, nil }, nil)
+
+	input := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test","version":"1.0.0"}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"create_project","arguments":{"name":"Stdio Project"}}}`,
+	}, "\n") + "\n"
+
+	var output bytes.Buffer
+	if err := ServeMCPStdio(context.Background(), mcpServer, strings.NewReader(input), &output); err != nil {
+		t.Fatalf("ServeMCPStdio failed: %v", err)
+	}
+
+	if !strings.Contains(output.String(), `"id":1`) {
+		t.Errorf("Expected initialize response, got: %s", output.String())
+	}
+	if !strings.Contains(output.String(), `"id":2`) {
+		t.Errorf("Expected tools/call response, got: %s", output.String())
+	}
+
+	projects, err := db.ListProjects(nil)
+	if err != nil {
+		t.Fatalf("failed to list projects: %v", err)
+	}
+	if len(projects) != 1 || projects[0].Name != "Stdio Project" {
+		t.Errorf("Expected project created over stdio, got %v", projects)
+	}
+}
+
+func TestRemoteVoiceFunc(t *testing.T) {
+	received := make(chan VoiceMessage, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/announce" {
+			t.Errorf("Expected path /api/announce, got %s", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer loom_secret" {
+			t.Errorf("Expected the token to be sent, got %q", auth)
+		}
+		var msg VoiceMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Errorf("Failed to decode body: %v", err)
+		}
+		received <- msg
+		w.Write([]byte(`{"listeners":2}`))
+	}))
+	defer srv.Close()
+
+	voiceFunc := NewRemoteVoiceFunc(srv.URL+"/", "loom_secret")
+	listeners, err := voiceFunc(VoiceMessage{Text: "Task Hello created", Urgency: "high"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if listeners != 2 {
+		t.Errorf("Expected 2 listeners, got %d", listeners)
+	}
+
+	msg := <-received
+	if msg.Text != "Task Hello created" || msg.Urgency != "high" {
+		t.Errorf("Unexpected forwarded message: %+v", msg)
+	}
+}
+
+func TestRemoteVoiceFuncUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	if _, err := NewRemoteVoiceFunc(url, "")(VoiceMessage{Text: "nobody is listening"}); err == nil {
+		t.Error("Expected error when no dashboard is running")
+	}
+}
+
+func TestVoiceMessageValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     VoiceMessage
+		wantErr bool
+	}{
+		{"text only", VoiceMessage{Text: "hello"}, false},
+		{"voice and urgency", VoiceMessage{Text: "hello", Voice: "Emma", Urgency: "high"}, false},
+		{"empty text", VoiceMessage{}, true},
+		{"too long", VoiceMessage{Text: strings.Repeat("a", 5001)}, true},
+		{"option injection", VoiceMessage{Text: "hello", Voice: "--engine=espeak"}, true},
+		{"voice with spaces", VoiceMessage{Text: "hello", Voice: "Emma; rm"}, true},
+		{"unknown urgency", VoiceMessage{Text: "hello", Urgency: "critical"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.msg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMCPSendVoiceMessage(t *testing.T) {
+	var sent []VoiceMessage
+	listeners := 0
+
+	srv := mcptest.NewUnstartedServer(t)
+	srv.AddTools(voiceTools(func(msg VoiceMessage) (int, error) {
+		sent = append(sent, msg)
+		return listeners, nil
+	})...)
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start MCP server: %v", err)
+	}
+	defer srv.Close()
+
+	result := callMCPTool(t, srv, "send_voice_message", map[string]interface{}{
+		"text":    "Build finished",
+		"voice":   "Emma",
+		"urgency": "high",
+	})
+	if result.IsError {
+		t.Fatalf("send_voice_message returned error: %s", getTextContent(result))
+	}
+	var res VoiceMessageResult
+	if err := json.Unmarshal([]byte(getTextContent(result)), &res); err != nil {
+		t.Fatalf("Failed to parse result JSON: %v", err)
+	}
+	if res.Delivered || res.Listeners != 0 {
+		t.Errorf("Expected undelivered result with no dashboards, got %+v", res)
+	}
+	if len(sent) != 1 || sent[0].Voice != "Emma" || sent[0].Urgency != "high" {
+		t.Errorf("Unexpected sent messages: %+v", sent)
+	}
+
+	listeners = 1
+	result = callMCPTool(t, srv, "send_voice_message", map[string]interface{}{"text": "Hello"})
+	json.Unmarshal([]byte(getTextContent(result)), &res)
+	if !res.Delivered || res.Listeners != 1 {
+		t.Errorf("Expected delivered result, got %+v", res)
+	}
+
+	result = callMCPTool(t, srv, "send_voice_message", map[string]interface{}{"text": "Hello", "urgency": "urgent"})
+	if !result.IsError {
+		t.Error("Expected error for invalid urgency")
+	}
+}
+
+func TestMCPCreateBackup(t *testing.T) {
+	srv, db, cleanup := setupTestMCPServer(t)
+	defer cleanup()
+	db.CreateProject("P", "", "", "", nil, nil)
+
+	result := callMCPTool(t, srv, "create_backup", map[string]interface{}{"label": "before reorg"})
+	if result.IsError {
+		t.Fatalf("create_backup returned error: %s", getTextContent(result))
+	}
+	var backup Backup
+	if err := json.Unmarshal([]byte(getTextContent(result)), &backup); err != nil {
+		t.Fatalf("Failed to parse result JSON: %v", err)
+	}
+	if backup.Label != "before-reorg" || backup.SchemaVersion != LatestSchemaVersion() {
+		t.Errorf("Unexpected backup %+v", backup)
+	}
+	if version, err := readBackupVersion(backup.Path); err != nil || version != LatestSchemaVersion() {
+		t.Errorf("Expected a readable backup, got version %d, %v", version, err)
+	}
+
+	result = callMCPTool(t, srv, "list_backups", map[string]interface{}{})
+	var backups []Backup
+	json.Unmarshal([]byte(getTextContent(result)), &backups)
+	if len(backups) != 1 || backups[0].Path != backup.Path {
+		t.Errorf("Expected the new backup to be listed, got %+v", backups)
+	}
+}
+
+func TestMCPSyncIssues(t *testing.T) {
+	srv, db, cleanup := setupTestMCPServer(t)
+	defer cleanup()
+	gh, ghSrv := newFakeGitHub(t)
+	gh.add(1, "Login fails", "open", "bug")
+	db.SetIssueTrackers(map[string]IssueTracker{"github": NewGitHubClient(ghSrv.URL, "gh_test")})
+	project, _ := db.CreateProject("App", "", "", "", nil, nil)
+	link, _ := db.CreateSyncLink(project.ID, "github", "acme/app")
+
+	result := callMCPTool(t, srv, "sync_issues", map[string]interface{}{})
+	if result.IsError {
+		t.Fatalf("sync_issues returned error: %s", getTextContent(result))
+	}
+	var results []SyncResult
+	if err := json.Unmarshal([]byte(getTextContent(result)), &results); err != nil {
+		t.Fatalf("Failed to parse result JSON: %v", err)
+	}
+	if len(results) != 1 || results[0].LinkID != link.ID || results[0].Created != 1 {
+		t.Errorf("Expected the issue to be imported, got %+v", results)
+	}
+
+	result = callMCPTool(t, srv, "sync_issues", map[string]interface{}{"link_id": 99})
+	if !result.IsError {
+		t.Error("Expected syncing a missing link to fail")
+	}
+
+	result = callMCPTool(t, srv, "list_sync_links", map[string]interface{}{"project_id": project.ID})
+	var links []SyncLink
+	json.Unmarshal([]byte(getTextContent(result)), &links)
+	if len(links) != 1 || links[0].Remote != "acme/app" || links[0].LastSyncedAt == nil {
+		t.Errorf("Expected the synced link, got %+v", links)
+	}
+}
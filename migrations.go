@@ -0,0 +1,805 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Migration is a numbered schema change. Migrations run in version order,
+// each inside its own transaction together with the schema_migrations row
+// that records it, so a failure leaves the database at the last fully
+// applied version.
+//
+// Databases created before versioned migrations existed have the tables but
+// no schema_migrations rows, so the early migrations must be idempotent: they
+// use CREATE ... IF NOT EXISTS and check for existing columns instead of
+// relying on errors.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *sql.Tx) error
+}
+
+// MigrationStatus reports whether a migration has been applied
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+// migrations lists every schema change in order. Append new migrations to
+// the end; never renumber or edit one that has shipped.
+var migrations = []Migration{
+	{1, "create core tables", migrateCoreTables},
+	{2, "add task type", migrateTaskType},
+	{3, "add project status", migrateProjectStatus},
+	{4, "make problem project optional", migrateProblemProjectOptional},
+	{5, "add problem and goal assignees", migrateAssignees},
+	{6, "add project junction tables", migrateJunctionTables},
+	{7, "add indexes", migrateIndexes},
+	{8, "add full-text search index", migrateSearchIndex},
+	{9, "add activity log", migrateActivity},
+	{10, "add trash", migrateTrash},
+	{11, "add task dependencies", migrateTaskDependencies},
+	{12, "add subtasks", migrateSubtasks},
+	{13, "add start and due dates", migrateDates},
+	{14, "add recurring tasks", migrateRecurrences},
+	{15, "add tags", migrateTags},
+	{16, "add people", migratePeople},
+	{17, "add API tokens", migrateAPITokens},
+	{18, "add issue sync", migrateIssueSync},
+	{19, "add incremental and epic sync", migrateEpicSync},
+	{20, "add sync failures", migrateSyncFailures},
+}
+
+// SchemaVersion returns the version of the newest applied migration, or 0
+// for an empty database.
+func (d *Database) SchemaVersion() (int, error) {
+	if err := d.ensureMigrationsTable(); err != nil {
+		return 0, err
+	}
+	var version int
+	err := d.db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
+
+// LatestSchemaVersion returns the version this binary migrates databases to
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// MigrationStatus lists every known migration and when it was applied
+func (d *Database) MigrationStatus() ([]MigrationStatus, error) {
+	if err := d.ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+
+	applied := map[int]time.Time{}
+	rows, err := d.db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if appliedAt, ok := applied[m.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Migrate applies all pending migrations and returns the ones it applied
+func (d *Database) Migrate() ([]Migration, error) {
+	return d.applyMigrations(migrations)
+}
+
+func (d *Database) applyMigrations(list []Migration) ([]Migration, error) {
+	current, err := d.SchemaVersion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	latest := 0
+	if len(list) > 0 {
+		latest = list[len(list)-1].Version
+	}
+	if current > latest {
+		return nil, fmt.Errorf("database schema version %d is newer than this version of Loom supports (%d)", current, latest)
+	}
+
+	var applied []Migration
+	for _, m := range list {
+		if m.Version <= current {
+			continue
+		}
+		if err := d.applyMigration(m); err != nil {
+			return applied, fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
+
+func (d *Database) applyMigration(m Migration) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.Up(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.Version, m.Name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *Database) ensureMigrationsTable() error {
+	_, err := d.db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	return err
+}
+
+// columnInfo describes a column as reported by PRAGMA table_info
+type columnInfo struct {
+	name    string
+	notNull bool
+}
+
+// tableColumns returns the columns of a table, or none if it does not exist
+func tableColumns(tx *sql.Tx, table string) (map[string]columnInfo, error) {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%q)", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := map[string]columnInfo{}
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return nil, err
+		}
+		columns[name] = columnInfo{name: name, notNull: notNull == 1}
+	}
+	return columns, rows.Err()
+}
+
+// addColumnIfMissing adds a column unless the table already has it
+func addColumnIfMissing(tx *sql.Tx, table, column, definition string) error {
+	columns, err := tableColumns(tx, table)
+	if err != nil {
+		return err
+	}
+	if _, ok := columns[column]; ok {
+		return nil
+	}
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// --- Migrations ---
+
+func migrateCoreTables(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS projects (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		description TEXT,
+		external_link TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS tasks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		project_id INTEGER NOT NULL,
+		title TEXT NOT NULL,
+		description TEXT,
+		status TEXT DEFAULT 'pending',
+		priority TEXT DEFAULT 'medium',
+		task_type TEXT DEFAULT 'general',
+		external_link TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS problems (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		project_id INTEGER,
+		task_id INTEGER,
+		title TEXT NOT NULL,
+		description TEXT,
+		status TEXT DEFAULT 'open',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE SET NULL,
+		FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE SET NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS outcomes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		project_id INTEGER NOT NULL,
+		task_id INTEGER,
+		title TEXT NOT NULL,
+		description TEXT,
+		status TEXT DEFAULT 'open',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+		FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE SET NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS goals (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		project_id INTEGER,
+		task_id INTEGER,
+		title TEXT NOT NULL,
+		description TEXT,
+		goal_type TEXT DEFAULT 'short_term',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE SET NULL,
+		FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE SET NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS task_notes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		task_id INTEGER NOT NULL,
+		note TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE CASCADE
+	);
+	`)
+	return err
+}
+
+func migrateTaskType(tx *sql.Tx) error {
+	if err := addColumnIfMissing(tx, "tasks", "task_type", "TEXT DEFAULT 'general'"); err != nil {
+		return err
+	}
+	_, err := tx.Exec("UPDATE tasks SET task_type = 'general' WHERE task_type IS NULL OR task_type = ''")
+	return err
+}
+
+func migrateProjectStatus(tx *sql.Tx) error {
+	if err := addColumnIfMissing(tx, "projects", "status", "TEXT DEFAULT 'active'"); err != nil {
+		return err
+	}
+	_, err := tx.Exec("UPDATE projects SET status = 'active' WHERE status IS NULL OR status = ''")
+	return err
+}
+
+// migrateProblemProjectOptional rebuilds the problems table of early
+// databases, where project_id was NOT NULL, since SQLite cannot drop a
+// constraint in place.
+func migrateProblemProjectOptional(tx *sql.Tx) error {
+	columns, err := tableColumns(tx, "problems")
+	if err != nil {
+		return err
+	}
+	if !columns["project_id"].notNull {
+		return nil
+	}
+
+	_, err = tx.Exec(`
+	ALTER TABLE problems RENAME TO problems_old;
+	CREATE TABLE problems (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		project_id INTEGER,
+		task_id INTEGER,
+		title TEXT NOT NULL,
+		description TEXT,
+		status TEXT DEFAULT 'open',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE SET NULL,
+		FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE SET NULL
+	);
+	INSERT INTO problems (id, project_id, task_id, title, description, status, created_at, updated_at)
+	SELECT id, project_id, task_id, title, description, status, created_at, updated_at
+	FROM problems_old;
+	DROP TABLE problems_old;
+	`)
+	return err
+}
+
+func migrateAssignees(tx *sql.Tx) error {
+	if err := addColumnIfMissing(tx, "problems", "assignee", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	return addColumnIfMissing(tx, "goals", "assignee", "TEXT DEFAULT ''")
+}
+
+func migrateJunctionTables(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS goal_projects (
+		goal_id INTEGER NOT NULL,
+		project_id INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (goal_id, project_id),
+		FOREIGN KEY (goal_id) REFERENCES goals(id) ON DELETE CASCADE,
+		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS problem_projects (
+		problem_id INTEGER NOT NULL,
+		project_id INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (problem_id, project_id),
+		FOREIGN KEY (problem_id) REFERENCES problems(id) ON DELETE CASCADE,
+		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+	);
+	`)
+	return err
+}
+
+func migrateIndexes(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE INDEX IF NOT EXISTS idx_projects_status ON projects(status);
+	CREATE INDEX IF NOT EXISTS idx_tasks_project_id ON tasks(project_id);
+	CREATE INDEX IF NOT EXISTS idx_tasks_status ON tasks(status);
+	CREATE INDEX IF NOT EXISTS idx_tasks_task_type ON tasks(task_type);
+	CREATE INDEX IF NOT EXISTS idx_problems_project_id ON problems(project_id);
+	CREATE INDEX IF NOT EXISTS idx_problems_task_id ON problems(task_id);
+	CREATE INDEX IF NOT EXISTS idx_problems_status ON problems(status);
+	CREATE INDEX IF NOT EXISTS idx_problems_assignee ON problems(assignee);
+	CREATE INDEX IF NOT EXISTS idx_outcomes_project_id ON outcomes(project_id);
+	CREATE INDEX IF NOT EXISTS idx_outcomes_task_id ON outcomes(task_id);
+	CREATE INDEX IF NOT EXISTS idx_outcomes_status ON outcomes(status);
+	CREATE INDEX IF NOT EXISTS idx_goals_project_id ON goals(project_id);
+	CREATE INDEX IF NOT EXISTS idx_goals_task_id ON goals(task_id);
+	CREATE INDEX IF NOT EXISTS idx_goals_goal_type ON goals(goal_type);
+	CREATE INDEX IF NOT EXISTS idx_goals_assignee ON goals(assignee);
+	CREATE INDEX IF NOT EXISTS idx_task_notes_task_id ON task_notes(task_id);
+	CREATE INDEX IF NOT EXISTS idx_goal_projects_goal_id ON goal_projects(goal_id);
+	CREATE INDEX IF NOT EXISTS idx_goal_projects_project_id ON goal_projects(project_id);
+	CREATE INDEX IF NOT EXISTS idx_problem_projects_problem_id ON problem_projects(problem_id);
+	CREATE INDEX IF NOT EXISTS idx_problem_projects_project_id ON problem_projects(project_id);
+	`)
+	return err
+}
+
+// searchSources lists the tables kept in the search index by triggers. A
+// migration that rebuilds one of these tables drops its triggers and must
+// recreate them with createSearchTriggers followed by
+// replaceSearchUpdateTrigger.
+var searchSources = []struct {
+	entity string
+	table  string
+	title  string
+	body   string
+}{
+	{EntityProject, "projects", "new.name", "new.description"},
+	{EntityTask, "tasks", "new.title", "new.description"},
+	{EntityProblem, "problems", "new.title", "new.description"},
+	{EntityOutcome, "outcomes", "new.title", "new.description"},
+	{EntityGoal, "goals", "new.title", "new.description"},
+	{EntityTaskNote, "task_notes", "''", "new.note"},
+}
+
+func migrateSearchIndex(tx *sql.Tx) error {
+	if _, err := tx.Exec(`
+	CREATE VIRTUAL TABLE search_index USING fts5(
+		entity UNINDEXED,
+		entity_id UNINDEXED,
+		title,
+		body,
+		tokenize = 'porter unicode61'
+	)`); err != nil {
+		return err
+	}
+
+	for _, s := range searchSources {
+		if err := createSearchTriggers(tx, s.entity, s.table, s.title, s.body); err != nil {
+			return err
+		}
+		old := func(expr string) string { return strings.ReplaceAll(expr, "new.", "") }
+		if _, err := tx.Exec(fmt.Sprintf(
+			"INSERT INTO search_index (entity, entity_id, title, body) SELECT '%s', id, COALESCE(%s, ''), COALESCE(%s, '') FROM %s",
+			s.entity, old(s.title), old(s.body), s.table,
+		)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createSearchTriggers keeps search_index in sync with a source table
+func createSearchTriggers(tx *sql.Tx, entity, table, title, body string) error {
+	insert := fmt.Sprintf(
+		"INSERT INTO search_index (entity, entity_id, title, body) VALUES ('%s', new.id, COALESCE(%s, ''), COALESCE(%s, ''));",
+		entity, title, body,
+	)
+	remove := fmt.Sprintf("DELETE FROM search_index WHERE entity = '%s' AND entity_id = old.id;", entity)
+
+	_, err := tx.Exec(fmt.Sprintf(`
+	CREATE TRIGGER %[1]s_search_insert AFTER INSERT ON %[1]s BEGIN
+		%[2]s
+	END;
+	CREATE TRIGGER %[1]s_search_update AFTER UPDATE ON %[1]s BEGIN
+		%[3]s
+		%[2]s
+	END;
+	CREATE TRIGGER %[1]s_search_delete AFTER DELETE ON %[1]s BEGIN
+		%[3]s
+	END;
+	`, table, insert, remove))
+	return err
+}
+
+// migrateActivity adds the activity log. It has no foreign keys so that the
+// history of deleted items is kept.
+func migrateActivity(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE activity (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		entity TEXT NOT NULL,
+		entity_id INTEGER NOT NULL,
+		action TEXT NOT NULL,
+		changes TEXT NOT NULL DEFAULT '{}',
+		actor TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX idx_activity_entity ON activity(entity, entity_id);
+	CREATE INDEX idx_activity_actor ON activity(actor);
+	`)
+	return err
+}
+
+// trashTables are the tables whose rows can be moved to the trash, keyed by
+// entity, in the order their rows are purged: dependents first.
+var trashTables = []struct {
+	entity string
+	table  string
+}{
+	{EntityTaskNote, "task_notes"},
+	{EntityOutcome, "outcomes"},
+	{EntityProblem, "problems"},
+	{EntityGoal, "goals"},
+	{EntityTask, "tasks"},
+	{EntityProject, "projects"},
+}
+
+// migrateTrash adds soft delete. Trashed rows keep their place in the tables
+// with deleted_at set, and trash_id groups an item with the dependents that
+// were trashed along with it.
+func migrateTrash(tx *sql.Tx) error {
+	if _, err := tx.Exec(`
+	CREATE TABLE trash (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		entity TEXT NOT NULL,
+		entity_id INTEGER NOT NULL,
+		title TEXT NOT NULL DEFAULT '',
+		actor TEXT NOT NULL DEFAULT '',
+		deleted_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX idx_trash_entity ON trash(entity, entity_id);
+	`); err != nil {
+		return err
+	}
+
+	for _, t := range trashTables {
+		if err := addColumnIfMissing(tx, t.table, "deleted_at", "DATETIME"); err != nil {
+			return err
+		}
+		if err := addColumnIfMissing(tx, t.table, "trash_id", "INTEGER"); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(fmt.Sprintf("CREATE INDEX idx_%[1]s_trash_id ON %[1]s(trash_id)", t.table)); err != nil {
+			return err
+		}
+	}
+
+	for _, s := range searchSources {
+		if err := replaceSearchUpdateTrigger(tx, s.entity, s.table, s.title, s.body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceSearchUpdateTrigger replaces the update trigger made by
+// createSearchTriggers with one that drops trashed rows from the index
+func replaceSearchUpdateTrigger(tx *sql.Tx, entity, table, title, body string) error {
+	_, err := tx.Exec(fmt.Sprintf(`
+	DROP TRIGGER IF EXISTS %[1]s_search_update;
+	CREATE TRIGGER %[1]s_search_update AFTER UPDATE ON %[1]s BEGIN
+		DELETE FROM search_index WHERE entity = '%[2]s' AND entity_id = old.id;
+		INSERT INTO search_index (entity, entity_id, title, body)
+		SELECT '%[2]s', new.id, COALESCE(%[3]s, ''), COALESCE(%[4]s, '') WHERE new.deleted_at IS NULL;
+	END;
+	`, table, entity, title, body))
+	return err
+}
+
+// migrateTaskDependencies adds the graph of tasks that must be completed
+// before another task can start
+func migrateTaskDependencies(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE task_dependencies (
+		task_id INTEGER NOT NULL,
+		depends_on_id INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (task_id, depends_on_id),
+		CHECK (task_id != depends_on_id),
+		FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE CASCADE,
+		FOREIGN KEY (depends_on_id) REFERENCES tasks(id) ON DELETE CASCADE
+	);
+	CREATE INDEX idx_task_dependencies_depends_on_id ON task_dependencies(depends_on_id);
+	`)
+	return err
+}
+
+// migrateSubtasks lets tasks be nested under a parent task in the same
+// project
+func migrateSubtasks(tx *sql.Tx) error {
+	if err := addColumnIfMissing(tx, "tasks", "parent_task_id", "INTEGER REFERENCES tasks(id) ON DELETE CASCADE"); err != nil {
+		return err
+	}
+	_, err := tx.Exec("CREATE INDEX IF NOT EXISTS idx_tasks_parent_task_id ON tasks(parent_task_id)")
+	return err
+}
+
+// migrateDates adds optional start and due dates to projects, tasks,
+// outcomes and goals. Dates are stored in UTC.
+func migrateDates(tx *sql.Tx) error {
+	for _, table := range []string{"projects", "tasks", "outcomes", "goals"} {
+		if err := addColumnIfMissing(tx, table, "start_at", "DATETIME"); err != nil {
+			return err
+		}
+		if err := addColumnIfMissing(tx, table, "due_at", "DATETIME"); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%[1]s_due_at ON %[1]s(due_at)", table)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateRecurrences adds recurrence rules that repeat a task. Each instance
+// of a recurring task is a task of its own pointing at the rule.
+func migrateRecurrences(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE task_recurrences (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		rule TEXT NOT NULL,
+		dtstart DATETIME NOT NULL,
+		next_at DATETIME,
+		paused BOOLEAN NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX idx_task_recurrences_next_at ON task_recurrences(next_at);
+	`)
+	if err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(tx, "tasks", "recurrence_id", "INTEGER REFERENCES task_recurrences(id) ON DELETE SET NULL"); err != nil {
+		return err
+	}
+	_, err = tx.Exec("CREATE INDEX IF NOT EXISTS idx_tasks_recurrence_id ON tasks(recurrence_id)")
+	return err
+}
+
+// tagTables are the junction tables linking each entity type to its tags
+var tagTables = map[string]struct {
+	table  string
+	column string
+	items  string
+}{
+	EntityProject: {"project_tags", "project_id", "projects"},
+	EntityTask:    {"task_tags", "task_id", "tasks"},
+	EntityProblem: {"problem_tags", "problem_id", "problems"},
+	EntityOutcome: {"outcome_tags", "outcome_id", "outcomes"},
+	EntityGoal:    {"goal_tags", "goal_id", "goals"},
+}
+
+// migrateTags adds tags and a junction table for each taggable entity type.
+// Tags stay on trashed items and are removed with them when they are purged.
+func migrateTags(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE tags (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		color TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	`)
+	if err != nil {
+		return err
+	}
+	for _, t := range tagTables {
+		_, err := tx.Exec(fmt.Sprintf(`
+		CREATE TABLE %[1]s (
+			%[2]s INTEGER NOT NULL,
+			tag_id INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (%[2]s, tag_id),
+			FOREIGN KEY (%[2]s) REFERENCES %[3]s(id) ON DELETE CASCADE,
+			FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+		);
+		CREATE INDEX idx_%[1]s_tag_id ON %[1]s(tag_id);
+		`, t.table, t.column, t.items))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migratePeople adds a directory of people and replaces the free-text
+// assignees of problems and goals with links to it. Each distinct assignee
+// becomes a person named after it. Tasks gain an assignee and a reviewer.
+func migratePeople(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE people (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		email TEXT NOT NULL DEFAULT '',
+		handle TEXT NOT NULL DEFAULT '',
+		role TEXT NOT NULL DEFAULT '',
+		manager_id INTEGER REFERENCES people(id) ON DELETE SET NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE UNIQUE INDEX idx_people_email ON people(email COLLATE NOCASE) WHERE email != '';
+	CREATE UNIQUE INDEX idx_people_handle ON people(handle COLLATE NOCASE) WHERE handle != '';
+	CREATE INDEX idx_people_manager_id ON people(manager_id);
+
+	INSERT INTO people (name)
+	SELECT MIN(TRIM(assignee)) FROM (SELECT assignee FROM problems UNION ALL SELECT assignee FROM goals)
+	WHERE TRIM(COALESCE(assignee, '')) != ''
+	GROUP BY LOWER(TRIM(assignee))
+	ORDER BY MIN(TRIM(assignee));
+	`)
+	if err != nil {
+		return err
+	}
+	columns := []struct{ table, column string }{
+		{"tasks", "assignee_id"},
+		{"tasks", "reviewer_id"},
+		{"problems", "assignee_id"},
+		{"goals", "assignee_id"},
+	}
+	for _, c := range columns {
+		if err := addColumnIfMissing(tx, c.table, c.column, "INTEGER REFERENCES people(id) ON DELETE SET NULL"); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%[1]s_%[2]s ON %[1]s(%[2]s)", c.table, c.column)); err != nil {
+			return err
+		}
+	}
+	for _, table := range []string{"problems", "goals"} {
+		_, err := tx.Exec(fmt.Sprintf(`
+		UPDATE %[1]s SET assignee_id = (SELECT id FROM people WHERE LOWER(name) = LOWER(TRIM(%[1]s.assignee)))
+		WHERE TRIM(COALESCE(assignee, '')) != '';
+		DROP INDEX IF EXISTS idx_%[1]s_assignee;
+		ALTER TABLE %[1]s DROP COLUMN assignee;
+		`, table))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateAPITokens adds the bearer tokens that authenticate API and MCP
+// clients. Only a hash of each token is stored. Revoked tokens are kept so
+// their name still explains past activity.
+func migrateAPITokens(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE api_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		access TEXT NOT NULL CHECK (access IN ('read', 'write')),
+		project_id INTEGER REFERENCES projects(id) ON DELETE CASCADE,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_used_at DATETIME,
+		revoked_at DATETIME
+	);
+	CREATE UNIQUE INDEX idx_api_tokens_name ON api_tokens(name) WHERE revoked_at IS NULL;
+	`)
+	return err
+}
+
+// migrateIssueSync links projects to issue trackers. synced_tasks records
+// which issue each imported task came from and when each side last changed
+// as of the last sync; synced_notes records the comments notes were pushed
+// as, so they are only pushed once. Neither refers to its task or note with
+// a foreign key, so that an issue whose task was purged is not imported
+// again.
+func migrateIssueSync(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE sync_links (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+		provider TEXT NOT NULL,
+		remote TEXT NOT NULL,
+		last_synced_at DATETIME,
+		last_error TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (provider, remote)
+	);
+	CREATE INDEX idx_sync_links_project_id ON sync_links(project_id);
+
+	CREATE TABLE synced_tasks (
+		link_id INTEGER NOT NULL REFERENCES sync_links(id) ON DELETE CASCADE,
+		remote_id TEXT NOT NULL,
+		task_id INTEGER NOT NULL UNIQUE,
+		remote_updated_at DATETIME NOT NULL,
+		task_updated_at DATETIME NOT NULL,
+		PRIMARY KEY (link_id, remote_id)
+	);
+
+	CREATE TABLE synced_notes (
+		note_id INTEGER PRIMARY KEY,
+		remote_id TEXT NOT NULL
+	);
+	`)
+	return err
+}
+
+// migrateEpicSync records how far each link has been synced, so later syncs
+// only ask for issues updated since, and which project each epic was
+// imported as
+func migrateEpicSync(tx *sql.Tx) error {
+	if err := addColumnIfMissing(tx, "sync_links", "synced_until", "DATETIME"); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`
+	CREATE TABLE synced_projects (
+		link_id INTEGER NOT NULL REFERENCES sync_links(id) ON DELETE CASCADE,
+		remote_id TEXT NOT NULL,
+		project_id INTEGER NOT NULL UNIQUE,
+		remote_updated_at DATETIME NOT NULL,
+		PRIMARY KEY (link_id, remote_id)
+	);
+	`)
+	return err
+}
+
+// migrateSyncFailures records the issues each link failed to sync, which are
+// asked for again by the next sync however long ago they changed
+func migrateSyncFailures(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE sync_failures (
+		link_id INTEGER NOT NULL REFERENCES sync_links(id) ON DELETE CASCADE,
+		remote_id TEXT NOT NULL,
+		error TEXT NOT NULL,
+		PRIMARY KEY (link_id, remote_id)
+	);
+	`)
+	return err
+}
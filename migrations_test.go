@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMigrateFreshDatabase(t *testing.T) {
+	database := newTestDatabase(t)
+
+	version, err := database.SchemaVersion()
+	if err != nil {
+		t.Fatalf("failed to read schema version: %v", err)
+	}
+	if version != LatestSchemaVersion() {
+		t.Errorf("expected schema version %d, got %d", LatestSchemaVersion(), version)
+	}
+
+	statuses, err := database.MigrationStatus()
+	if err != nil {
+		t.Fatalf("failed to read migration status: %v", err)
+	}
+	for _, s := range statuses {
+		if s.AppliedAt == nil {
+			t.Errorf("expected migration %d to be applied", s.Version)
+		}
+	}
+
+	// Running again is a no-op
+	applied, err := database.Migrate()
+	if err != nil {
+		t.Fatalf("failed to re-run migrations: %v", err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("expected no migrations to be applied, got %d", len(applied))
+	}
+}
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "loom.db")
+
+	// Build the schema of an early release: no schema_migrations table,
+	// no project status, problems.project_id NOT NULL, no assignees.
+	legacy, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("failed to open legacy database: %v", err)
+	}
+	_, err = legacy.Exec(`
+	CREATE TABLE projects (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		description TEXT,
+		external_link TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE tasks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		project_id INTEGER NOT NULL,
+		title TEXT NOT NULL,
+		description TEXT,
+		status TEXT DEFAULT 'pending',
+		priority TEXT DEFAULT 'medium',
+		external_link TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+	);
+	CREATE TABLE problems (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		project_id INTEGER NOT NULL,
+		task_id INTEGER,
+		title TEXT NOT NULL,
+		description TEXT,
+		status TEXT DEFAULT 'open',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+		FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE SET NULL
+	);
+	INSERT INTO projects (name, description, external_link) VALUES ('Legacy', 'old project', '');
+	INSERT INTO tasks (project_id, title, description, external_link) VALUES (1, 'Old task', '', '');
+	INSERT INTO problems (project_id, task_id, title, description) VALUES (1, 1, 'Old problem', '');
+	`)
+	if err != nil {
+		t.Fatalf("failed to create legacy schema: %v", err)
+	}
+	legacy.Close()
+
+	database, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("failed to migrate legacy database: %v", err)
+	}
+	defer database.Close()
+
+	project, err := database.GetProject(1)
+	if err != nil {
+		t.Fatalf("failed to get project: %v", err)
+	}
+	if project.Name != "Legacy" || project.Status != "active" {
+		t.Errorf("unexpected project after migration: %+v", project)
+	}
+
+	task, err := database.GetTask(1)
+	if err != nil {
+		t.Fatalf("failed to get task: %v", err)
+	}
+	if task.TaskType != "general" {
+		t.Errorf("expected task type to be backfilled, got %q", task.TaskType)
+	}
+
+	problem, err := database.GetProblem(1)
+	if err != nil {
+		t.Fatalf("failed to get problem: %v", err)
+	}
+	if problem.Title != "Old problem" || problem.ProjectID == nil || *problem.ProjectID != 1 {
+		t.Errorf("unexpected problem after migration: %+v", problem)
+	}
+
+	// problems.project_id is now optional
+	if _, err := database.CreateProblem(nil, nil, "Unscoped", "", "open", "alice"); err != nil {
+		t.Errorf("expected problem without project to be allowed: %v", err)
+	}
+}
+
+func TestMigrateRollsBackFailedMigration(t *testing.T) {
+	database := newTestDatabase(t)
+	latest := LatestSchemaVersion()
+
+	failing := append(append([]Migration{}, migrations...), Migration{
+		Version: latest + 1,
+		Name:    "broken",
+		Up: func(tx *sql.Tx) error {
+			if _, err := tx.Exec("CREATE TABLE half_done (id INTEGER)"); err != nil {
+				return err
+			}
+			return errors.New("boom")
+		},
+	})
+
+	applied, err := database.applyMigrations(failing)
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("expected migration failure, got %v", err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("expected no migrations to be recorded, got %d", len(applied))
+	}
+
+	version, err := database.SchemaVersion()
+	if err != nil {
+		t.Fatalf("failed to read schema version: %v", err)
+	}
+	if version != latest {
+		t.Errorf("expected schema version to stay at %d, got %d", latest, version)
+	}
+
+	var count int
+	database.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'half_done'").Scan(&count)
+	if count != 0 {
+		t.Error("expected partial changes of the failed migration to be rolled back")
+	}
+}
+
+func TestMigrateRefusesNewerDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "loom.db")
+	database, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	if _, err := database.db.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, 'from the future')", LatestSchemaVersion()+1); err != nil {
+		t.Fatalf("failed to record future migration: %v", err)
+	}
+	database.Close()
+
+	if _, err := NewDatabase(dbPath); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("expected newer schema to be refused, got %v", err)
+	}
+}
+
+func TestMigrateCommand(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "loom.db")
+
+	var out bytes.Buffer
+	if err := runCommand(&Config{DBPath: dbPath}, []string{"migrate", "status"}, &out); err != nil {
+		t.Fatalf("migrate status failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Schema version: 0") || !strings.Contains(out.String(), "pending") {
+		t.Errorf("expected pending migrations in status output, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := runCommand(&Config{DBPath: dbPath}, []string{"migrate", "up"}, &out); err != nil {
+		t.Fatalf("migrate up failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Applied 1: create core tables") {
+		t.Errorf("expected applied migrations in output, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := runCommand(&Config{DBPath: dbPath}, []string{"migrate", "up"}, &out); err != nil {
+		t.Fatalf("second migrate up failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "up to date") {
+		t.Errorf("expected up to date message, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := runCommand(&Config{DBPath: dbPath}, []string{"migrate", "status"}, &out); err != nil {
+		t.Fatalf("migrate status failed: %v", err)
+	}
+	if strings.Contains(out.String(), "pending") {
+		t.Errorf("expected no pending migrations, got:\n%s", out.String())
+	}
+
+	if err := runCommand(&Config{DBPath: dbPath}, []string{"migrate", "down"}, &out); err == nil {
+		t.Error("expected error for unknown migrate command")
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Limits for paginated list operations. A zero limit returns every row;
+// larger limits are capped at maxListLimit.
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+// ListOptions controls the page of rows returned by the List*Page methods
+type ListOptions struct {
+	Limit  int    // maximum rows to return; 0 returns every row
+	Cursor string // NextCursor from the previous page
+	Sort   string // sort field; defaults to updated_at, or id for activity and trash
+	Order  string // "asc" or "desc"; defaults to desc for dates and priority
+}
+
+// PageInfo describes a page of list results. Total counts every row matching
+// the filters, and NextCursor is empty on the last page.
+type PageInfo struct {
+	Total      int    `json:"total"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// sortField is a field a list can be sorted by. Rows with equal values are
+// ordered by ID so that cursors are stable.
+type sortField struct {
+	name    string
+	expr    string
+	numeric bool
+	desc    bool
+}
+
+var (
+	updatedAtSort = sortField{name: "updated_at", expr: "updated_at", desc: true}
+	createdAtSort = sortField{name: "created_at", expr: "created_at", desc: true}
+	titleSort     = sortField{name: "title", expr: "LOWER(title)"}
+	idSort        = sortField{name: "id", expr: "id", numeric: true}
+
+	// dueAtSort orders the soonest due first and undated items last
+	dueAtSort = sortField{name: "due_at", expr: "COALESCE(due_at, '9999-12-31 23:59:59')"}
+
+	projectSorts = []sortField{updatedAtSort, createdAtSort, {name: "name", expr: "LOWER(name)"}, dueAtSort, idSort}
+	taskSorts    = []sortField{updatedAtSort, createdAtSort, titleSort, dueAtSort, {
+		name:    "priority",
+		expr:    "CASE priority WHEN 'urgent' THEN 4 WHEN 'high' THEN 3 WHEN 'medium' THEN 2 WHEN 'low' THEN 1 ELSE 0 END",
+		numeric: true,
+		desc:    true,
+	}, idSort}
+	itemSorts      = []sortField{updatedAtSort, createdAtSort, titleSort, idSort}
+	datedItemSorts = []sortField{updatedAtSort, createdAtSort, titleSort, dueAtSort, idSort}
+
+	// newestFirstSorts orders logs such as the activity log and the trash
+	newestFirstSorts = []sortField{{name: "id", expr: "id", numeric: true, desc: true}}
+)
+
+// Sort fields accepted by each list operation
+var (
+	ProjectSortFields = sortFieldNames(projectSorts)
+	TaskSortFields    = sortFieldNames(taskSorts)
+	ItemSortFields    = sortFieldNames(itemSorts)
+	DatedSortFields   = sortFieldNames(datedItemSorts)
+	SortOrders        = []string{"asc", "desc"}
+)
+
+func sortFieldNames(sorts []sortField) []string {
+	names := make([]string, len(sorts))
+	for i, s := range sorts {
+		names[i] = s.name
+	}
+	return names
+}
+
+// listQuery is a filtered SELECT over one table
+type listQuery struct {
+	table   string
+	columns string
+	where   []string
+	args    []interface{}
+	sorts   []sortField
+}
+
+// filter adds a condition to the query
+func (q *listQuery) filter(cond string, arg interface{}) {
+	q.where = append(q.where, cond)
+	q.args = append(q.args, arg)
+}
+
+// listCursor is the decoded form of a page cursor. The sort and order are
+// kept so a cursor cannot be reused with a different ordering.
+type listCursor struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	Value string `json:"v"`
+	ID    int64  `json:"id"`
+}
+
+func encodeCursor(c listCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (listCursor, error) {
+	var c listCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+	if err != nil {
+		return c, fmt.Errorf("%w cursor %q", ErrInvalidValue, s)
+	}
+	return c, nil
+}
+
+// listPage runs q with the sorting and paging in opts. scan is called for
+// each row; it must scan the table's columns followed by sortValue and return
+// the row's ID.
+func (d *Database) listPage(q listQuery, opts ListOptions, scan func(rows *sql.Rows, sortValue *interface{}) (int64, error)) (*PageInfo, error) {
+	sortName := opts.Sort
+	if sortName == "" {
+		sortName = q.sorts[0].name
+	}
+	var sort *sortField
+	for i := range q.sorts {
+		if q.sorts[i].name == sortName {
+			sort = &q.sorts[i]
+		}
+	}
+	if sort == nil {
+		return nil, validateEnum("sort field", sortName, sortFieldNames(q.sorts))
+	}
+
+	order := opts.Order
+	if order == "" {
+		order = "asc"
+		if sort.desc {
+			order = "desc"
+		}
+	}
+	if err := validateEnum("sort order", order, SortOrders); err != nil {
+		return nil, err
+	}
+
+	limit := opts.Limit
+	if limit < 0 {
+		return nil, fmt.Errorf("%w limit %d (must not be negative)", ErrInvalidValue, limit)
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	filters := "1=1"
+	if len(q.where) > 0 {
+		filters = strings.Join(q.where, " AND ")
+	}
+
+	page := &PageInfo{}
+	paged := limit > 0 || opts.Cursor != ""
+	if paged {
+		err := d.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", q.table, filters), q.args...).Scan(&page.Total)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	where := filters
+	args := append([]interface{}{}, q.args...)
+	cmp := ">"
+	if order == "desc" {
+		cmp = "<"
+	}
+	if opts.Cursor != "" {
+		c, err := decodeCursor(opts.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if c.Sort != sort.name || c.Order != order {
+			return nil, fmt.Errorf("%w cursor: it was issued for sort %s %s", ErrInvalidValue, c.Sort, c.Order)
+		}
+		var value interface{} = c.Value
+		if sort.numeric {
+			n, err := strconv.ParseInt(c.Value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w cursor %q", ErrInvalidValue, opts.Cursor)
+			}
+			value = n
+		}
+		where += fmt.Sprintf(" AND (%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", sort.expr, cmp)
+		args = append(args, value, value, c.ID)
+	}
+
+	sortColumn := sort.expr
+	if !sort.numeric {
+		sortColumn = fmt.Sprintf("CAST(%s AS TEXT)", sort.expr)
+	}
+	query := fmt.Sprintf("SELECT %s, %s FROM %s WHERE %s ORDER BY %s %s, id %s",
+		q.columns, sortColumn, q.table, where, sort.expr, order, order)
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit+1)
+	}
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	n := 0
+	var lastID int64
+	var lastValue interface{}
+	for rows.Next() {
+		if limit > 0 && n == limit {
+			if b, ok := lastValue.([]byte); ok {
+				lastValue = string(b)
+			}
+			page.NextCursor = encodeCursor(listCursor{
+				Sort:  sort.name,
+				Order: order,
+				Value: fmt.Sprint(lastValue),
+				ID:    lastID,
+			})
+			break
+		}
+		var sortValue interface{}
+		id, err := scan(rows, &sortValue)
+		if err != nil {
+			return nil, err
+		}
+		lastID, lastValue = id, sortValue
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if !paged {
+		page.Total = n
+	}
+	return page, nil
+}
+
+// parseFields splits a comma-separated list of field names
+func parseFields(s string) []string {
+	var fields []string
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// projectFields returns the items of a slice of struct pointers as JSON
+// objects holding only the given fields, e.g. "id" and "title". Field names
+// are the JSON names of the struct's fields. With no fields, items is
+// returned unchanged.
+func projectFields(items interface{}, fields []string) (interface{}, error) {
+	if len(fields) == 0 {
+		return items, nil
+	}
+
+	v := reflect.ValueOf(items)
+	t := v.Type().Elem().Elem()
+	index := map[string]int{}
+	names := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			index[name] = i
+			names = append(names, name)
+		}
+	}
+	for _, f := range fields {
+		if _, ok := index[f]; !ok {
+			return nil, validateEnum("field", f, names)
+		}
+	}
+
+	projected := make([]map[string]interface{}, v.Len())
+	for i := range projected {
+		item := v.Index(i).Elem()
+		m := make(map[string]interface{}, len(fields))
+		for _, f := range fields {
+			m[f] = item.Field(index[f]).Interface()
+		}
+		projected[i] = m
+	}
+	return projected, nil
+}
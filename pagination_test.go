@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// collectTaskPages pages through every task with the given options and
+// returns the task IDs in order
+func collectTaskPages(t *testing.T, db *Database, opts ListOptions) []int64 {
+	t.Helper()
+	var ids []int64
+	for pages := 0; ; pages++ {
+		if pages > 20 {
+			t.Fatal("too many pages")
+		}
+		tasks, page, err := db.ListTasksPage(nil, nil, nil, nil, nil, DueFilter{}, TagFilter{}, opts)
+		if err != nil {
+			t.Fatalf("failed to list tasks: %v", err)
+		}
+		if page.Total != 5 {
+			t.Errorf("expected total 5, got %d", page.Total)
+		}
+		for _, task := range tasks {
+			ids = append(ids, task.ID)
+		}
+		if page.NextCursor == "" {
+			return ids
+		}
+		opts.Cursor = page.NextCursor
+	}
+}
+
+func TestListTasksPagination(t *testing.T) {
+	db := newTestDatabase(t)
+	project, _ := db.CreateProject("Project", "", "", "", nil, nil)
+
+	var ids []int64
+	for i, tc := range []struct{ title, priority string }{
+		{"delta", "low"},
+		{"Alpha", "urgent"},
+		{"charlie", "medium"},
+		{"bravo", "high"},
+		{"echo", "medium"},
+	} {
+		task, err := db.CreateTask(project.ID, nil, tc.title, "", "", tc.priority, "", "", "", "", nil, nil)
+		if err != nil {
+			t.Fatalf("failed to create task: %v", err)
+		}
+		ids = append(ids, task.ID)
+		// Two tasks share an updated_at so ties must be broken by ID
+		updatedAt := []string{"2026-01-03 00:00:00", "2026-01-01 00:00:00", "2026-01-02 00:00:00", "2026-01-02 00:00:00", "2026-01-04 00:00:00"}[i]
+		if _, err := db.db.Exec("UPDATE tasks SET updated_at = ? WHERE id = ?", updatedAt, task.ID); err != nil {
+			t.Fatalf("failed to set updated_at: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		opts ListOptions
+		want []int64
+	}{
+		{"default", ListOptions{Limit: 2}, []int64{ids[4], ids[0], ids[3], ids[2], ids[1]}},
+		{"updated_at asc", ListOptions{Limit: 2, Order: "asc"}, []int64{ids[1], ids[2], ids[3], ids[0], ids[4]}},
+		{"title", ListOptions{Limit: 2, Sort: "title"}, []int64{ids[1], ids[3], ids[2], ids[0], ids[4]}},
+		{"priority", ListOptions{Limit: 3, Sort: "priority"}, []int64{ids[1], ids[3], ids[4], ids[2], ids[0]}},
+		{"id desc", ListOptions{Limit: 4, Sort: "id", Order: "desc"}, []int64{ids[4], ids[3], ids[2], ids[1], ids[0]}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := collectTaskPages(t, db, tt.opts)
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("expected %v, got %v", tt.want, got)
+				}
+			}
+		})
+	}
+
+	// Without a limit every row is returned on one page
+	tasks, page, err := db.ListTasksPage(nil, nil, nil, nil, nil, DueFilter{}, TagFilter{}, ListOptions{})
+	if err != nil {
+		t.Fatalf("failed to list tasks: %v", err)
+	}
+	if len(tasks) != 5 || page.Total != 5 || page.NextCursor != "" {
+		t.Errorf("expected all 5 tasks on one page, got %d (%+v)", len(tasks), page)
+	}
+
+	// Filters apply to the total
+	pending := "pending"
+	tasks, page, err = db.ListTasksPage(&project.ID, &pending, nil, nil, nil, DueFilter{}, TagFilter{}, ListOptions{Limit: 1})
+	if err != nil {
+		t.Fatalf("failed to list tasks: %v", err)
+	}
+	if len(tasks) != 1 || page.Total != 5 || page.NextCursor == "" {
+		t.Errorf("expected first of 5 pending tasks, got %d (%+v)", len(tasks), page)
+	}
+}
+
+func TestListOptionsValidation(t *testing.T) {
+	db := newTestDatabase(t)
+	project, _ := db.CreateProject("Project", "", "", "", nil, nil)
+	db.CreateTask(project.ID, nil, "One", "", "", "", "", "", "", "", nil, nil)
+	db.CreateTask(project.ID, nil, "Two", "", "", "", "", "", "", "", nil, nil)
+
+	_, page, err := db.ListTasksPage(nil, nil, nil, nil, nil, DueFilter{}, TagFilter{}, ListOptions{Limit: 1})
+	if err != nil {
+		t.Fatalf("failed to list tasks: %v", err)
+	}
+
+	for _, opts := range []ListOptions{
+		{Sort: "colour"},
+		{Sort: "priority", Order: "sideways"},
+		{Limit: -1},
+		{Cursor: "not a cursor"},
+		{Cursor: page.NextCursor, Sort: "title"},
+	} {
+		if _, _, err := db.ListTasksPage(nil, nil, nil, nil, nil, DueFilter{}, TagFilter{}, opts); !errors.Is(err, ErrInvalidValue) {
+			t.Errorf("expected ErrInvalidValue for %+v, got %v", opts, err)
+		}
+	}
+
+	// Projects can't be sorted by priority
+	if _, _, err := db.ListProjectsPage(nil, DueFilter{}, TagFilter{}, ListOptions{Sort: "priority"}); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("expected ErrInvalidValue, got %v", err)
+	}
+}
+
+func TestProjectFields(t *testing.T) {
+	db := newTestDatabase(t)
+	project, _ := db.CreateProject("Project", "", "", "", nil, nil)
+	db.CreateTask(project.ID, nil, "One", "A long description", "", "", "", "", "", "", nil, nil)
+
+	tasks, _ := db.ListTasks(nil, nil, nil)
+	projected, err := projectFields(tasks, []string{"id", "title"})
+	if err != nil {
+		t.Fatalf("failed to project fields: %v", err)
+	}
+	items := projected.([]map[string]interface{})
+	if len(items) != 1 || len(items[0]) != 2 || items[0]["title"] != "One" || items[0]["id"] != tasks[0].ID {
+		t.Errorf("unexpected projection: %v", items)
+	}
+
+	if _, err := projectFields(tasks, []string{"id", "colour"}); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("expected ErrInvalidValue for unknown field, got %v", err)
+	}
+
+	unchanged, err := projectFields(tasks, nil)
+	if err != nil || len(unchanged.([]*Task)) != 1 {
+		t.Errorf("expected items unchanged without fields, got %v, %v", unchanged, err)
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var handlePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Person is someone in the team directory. Tasks, problems and goals are
+// assigned to people, and tasks can have a reviewer. OpenTasks and
+// OpenProblems count the live items assigned to them that are not done.
+type Person struct {
+	ID           int64     `json:"id"`
+	Name         string    `json:"name"`
+	Email        string    `json:"email"`
+	Handle       string    `json:"handle"`
+	Role         string    `json:"role"`
+	ManagerID    *int64    `json:"manager_id"`
+	Manager      string    `json:"manager"`
+	OpenTasks    int       `json:"open_tasks"`
+	OpenProblems int       `json:"open_problems"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Workload is the open work of a person: the tasks and problems assigned to
+// them that are not done, and the open tasks they are reviewing
+type Workload struct {
+	Person   *Person    `json:"person"`
+	Tasks    []*Task    `json:"tasks"`
+	Reviews  []*Task    `json:"reviews"`
+	Problems []*Problem `json:"problems"`
+}
+
+// personName selects the name of the person whose ID is in ref, or an empty
+// string
+func personName(ref string) string {
+	return "COALESCE((SELECT name FROM people WHERE id = " + ref + "), '')"
+}
+
+// personMatch matches the people a reference names: by handle, with or
+// without a leading @, by email or by name, ignoring case. It takes the
+// reference as its two arguments.
+const personMatch = "(SELECT id FROM people WHERE LOWER(?) IN (LOWER(name), NULLIF(LOWER(email), '')) OR LOWER(?) = NULLIF(LOWER(handle), ''))"
+
+func personMatchArgs(ref string) []interface{} {
+	ref = strings.TrimSpace(ref)
+	return []interface{}{ref, strings.TrimPrefix(ref, "@")}
+}
+
+// filterPerson restricts a query to rows whose column links to the person
+// named by ref, or to unassigned rows if ref is empty
+func (q *listQuery) filterPerson(column, ref string) {
+	if strings.TrimSpace(ref) == "" {
+		q.where = append(q.where, column+" IS NULL")
+		return
+	}
+	q.where = append(q.where, column+" IN "+personMatch)
+	q.args = append(q.args, personMatchArgs(ref)...)
+}
+
+// personSelect selects people with counts of their open work
+var personSelect = `
+	SELECT p.id, p.name, p.email, p.handle, p.role, p.manager_id, ` + personName("p.manager_id") + `,
+		(SELECT COUNT(*) FROM tasks t WHERE t.assignee_id = p.id AND t.deleted_at IS NULL AND t.status != 'completed'),
+		(SELECT COUNT(*) FROM problems x WHERE x.assignee_id = p.id AND x.deleted_at IS NULL AND x.status != 'resolved'),
+		p.created_at, p.updated_at
+	FROM people p`
+
+func scanPerson(scan func(dest ...interface{}) error) (*Person, error) {
+	var p Person
+	err := scan(&p.ID, &p.Name, &p.Email, &p.Handle, &p.Role, &p.ManagerID, &p.Manager, &p.OpenTasks, &p.OpenProblems, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// normalizePerson trims a person's fields and checks them
+func normalizePerson(name, email, handle string) (string, string, string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	email = strings.TrimSpace(email)
+	handle = strings.TrimPrefix(strings.TrimSpace(handle), "@")
+	if name == "" {
+		return "", "", "", fmt.Errorf("%w person: name is required", ErrInvalidValue)
+	}
+	if email != "" {
+		if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+			return "", "", "", fmt.Errorf("%w email %q", ErrInvalidValue, email)
+		}
+	}
+	if handle != "" && !handlePattern.MatchString(handle) {
+		return "", "", "", fmt.Errorf("%w handle %q (use letters, digits, '.', '_' and '-')", ErrInvalidValue, handle)
+	}
+	return name, email, handle, nil
+}
+
+// checkPersonUnique rejects an email or handle already used by someone else
+func (d *Database) checkPersonUnique(id int64, email, handle string) error {
+	var other int64
+	err := d.db.QueryRow(
+		"SELECT id FROM people WHERE id != ? AND ((email != '' AND LOWER(email) = LOWER(?)) OR (handle != '' AND LOWER(handle) = LOWER(?)))",
+		id, email, handle,
+	).Scan(&other)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w person: email or handle already used by person %d", ErrInvalidValue, other)
+}
+
+// checkManager checks that managerID can manage person id without anyone
+// ending up managing themselves
+func (d *Database) checkManager(id, managerID int64) error {
+	for next := &managerID; next != nil; {
+		if *next == id {
+			return fmt.Errorf("%w manager: person %d can't report to themselves", ErrInvalidValue, id)
+		}
+		manager, err := d.GetPerson(*next)
+		if errors.Is(err, ErrNotFound) && *next == managerID {
+			return fmt.Errorf("%w manager: person %d does not exist", ErrInvalidValue, managerID)
+		}
+		if err != nil {
+			return err
+		}
+		next = manager.ManagerID
+	}
+	return nil
+}
+
+// CreatePerson adds someone to the directory. Email and handle are optional
+// but unique, and managerID links to the person they report to.
+func (d *Database) CreatePerson(name, email, handle, role string, managerID *int64) (*Person, error) {
+	name, email, handle, err := normalizePerson(name, email, handle)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.checkPersonUnique(0, email, handle); err != nil {
+		return nil, err
+	}
+	if managerID != nil {
+		if err := d.checkManager(0, *managerID); err != nil {
+			return nil, err
+		}
+	}
+	result, err := d.db.Exec(
+		"INSERT INTO people (name, email, handle, role, manager_id) VALUES (?, ?, ?, ?, ?)",
+		name, email, handle, strings.TrimSpace(role), managerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	person, err := d.GetPerson(id)
+	if err != nil {
+		return nil, err
+	}
+	d.publish(ActionCreated, EntityPerson, person.ID, nil, person)
+	return person, nil
+}
+
+// GetPerson returns a person by ID
+func (d *Database) GetPerson(id int64) (*Person, error) {
+	p, err := scanPerson(d.db.QueryRow(personSelect+" WHERE p.id = ?", id).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("person with ID %d %w", id, ErrNotFound)
+	}
+	return p, err
+}
+
+// FindPerson returns the person a reference names: by handle, email or name,
+// ignoring case. Handles match before emails and names.
+func (d *Database) FindPerson(ref string) (*Person, error) {
+	args := append(personMatchArgs(ref), personMatchArgs(ref)[1])
+	p, err := scanPerson(d.db.QueryRow(personSelect+" WHERE p.id IN "+personMatch+" ORDER BY LOWER(p.handle) = LOWER(?) DESC, p.id LIMIT 1", args...).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("person %q %w", strings.TrimSpace(ref), ErrNotFound)
+	}
+	return p, err
+}
+
+// ListPeople returns the people in the directory by name, optionally only
+// those with a role
+func (d *Database) ListPeople(role *string) ([]*Person, error) {
+	query := personSelect
+	args := []interface{}{}
+	if role != nil {
+		query += " WHERE LOWER(p.role) = LOWER(?)"
+		args = append(args, strings.TrimSpace(*role))
+	}
+	rows, err := d.db.Query(query+" ORDER BY LOWER(p.name), p.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	people := []*Person{}
+	for rows.Next() {
+		p, err := scanPerson(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		people = append(people, p)
+	}
+	return people, rows.Err()
+}
+
+// UpdatePerson updates the fields that are set. A zero managerID removes the
+// person's manager.
+func (d *Database) UpdatePerson(id int64, name, email, handle, role *string, managerID *int64) (*Person, error) {
+	before, err := d.GetPerson(id)
+	if err != nil {
+		return nil, err
+	}
+	newName, newEmail, newHandle, newRole := before.Name, before.Email, before.Handle, before.Role
+	if name != nil {
+		newName = *name
+	}
+	if email != nil {
+		newEmail = *email
+	}
+	if handle != nil {
+		newHandle = *handle
+	}
+	if role != nil {
+		newRole = strings.TrimSpace(*role)
+	}
+	if newName, newEmail, newHandle, err = normalizePerson(newName, newEmail, newHandle); err != nil {
+		return nil, err
+	}
+	if err := d.checkPersonUnique(id, newEmail, newHandle); err != nil {
+		return nil, err
+	}
+	newManagerID := before.ManagerID
+	if managerID != nil {
+		newManagerID = nil
+		if *managerID != 0 {
+			if err := d.checkManager(id, *managerID); err != nil {
+				return nil, err
+			}
+			newManagerID = managerID
+		}
+	}
+
+	_, err = d.db.Exec(
+		"UPDATE people SET name = ?, email = ?, handle = ?, role = ?, manager_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		newName, newEmail, newHandle, newRole, newManagerID, id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	person, err := d.GetPerson(id)
+	if err != nil {
+		return nil, err
+	}
+	d.publish(ActionUpdated, EntityPerson, person.ID, before, person)
+	return person, nil
+}
+
+// DeletePerson removes someone from the directory. Their tasks, problems and
+// goals become unassigned, and the people reporting to them lose their
+// manager.
+func (d *Database) DeletePerson(id int64) error {
+	before, err := d.GetPerson(id)
+	if err != nil {
+		return err
+	}
+	if _, err := d.db.Exec("DELETE FROM people WHERE id = ?", id); err != nil {
+		return err
+	}
+	d.publish(ActionDeleted, EntityPerson, id, before, nil)
+	return nil
+}
+
+// resolvePerson returns the ID of the person a reference names, adding them
+// to the directory if nobody matches, so that assigning work to a new name
+// just works. An empty reference resolves to nil, for unassigned.
+func (d *Database) resolvePerson(ref string) (*int64, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return nil, nil
+	}
+	person, err := d.FindPerson(ref)
+	if errors.Is(err, ErrNotFound) {
+		var email, handle string
+		if addr, err := mail.ParseAddress(ref); err == nil && addr.Address == ref {
+			email = ref
+		} else if handlePattern.MatchString(strings.TrimPrefix(ref, "@")) {
+			handle = ref
+		}
+		person, err = d.CreatePerson(strings.TrimPrefix(ref, "@"), email, handle, "", nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &person.ID, nil
+}
+
+// GetWorkload returns a person's open work, soonest due first
+func (d *Database) GetWorkload(id int64) (*Workload, error) {
+	person, err := d.GetPerson(id)
+	if err != nil {
+		return nil, err
+	}
+	w := &Workload{Person: person, Tasks: []*Task{}, Reviews: []*Task{}, Problems: []*Problem{}}
+
+	for _, list := range []struct {
+		column string
+		tasks  *[]*Task
+	}{{"assignee_id", &w.Tasks}, {"reviewer_id", &w.Reviews}} {
+		q := listQuery{
+			table:   "tasks",
+			columns: taskColumns,
+			where:   []string{"deleted_at IS NULL", "status != 'completed'"},
+			sorts:   taskSorts,
+		}
+		q.filter(list.column+" = ?", id)
+		_, err := d.listPage(q, ListOptions{Sort: "due_at"}, func(rows *sql.Rows, sortValue *interface{}) (int64, error) {
+			t, err := scanTask(rows.Scan, sortValue)
+			if err != nil {
+				return 0, err
+			}
+			*list.tasks = append(*list.tasks, t)
+			return t.ID, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	q := listQuery{
+		table:   "problems",
+		columns: problemColumns,
+		where:   []string{"deleted_at IS NULL", "status != 'resolved'"},
+		sorts:   itemSorts,
+	}
+	q.filter("assignee_id = ?", id)
+	_, err = d.listPage(q, ListOptions{Sort: "created_at", Order: "asc"}, func(rows *sql.Rows, sortValue *interface{}) (int64, error) {
+		p, err := scanProblem(rows.Scan, sortValue)
+		if err != nil {
+			return 0, err
+		}
+		w.Problems = append(w.Problems, p)
+		return p.ID, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPeopleDirectory(t *testing.T) {
+	db := newTestDatabase(t)
+
+	lead, err := db.CreatePerson("Dana  Scully", "dana@example.com", "@dscully", "Engineering lead", nil)
+	if err != nil {
+		t.Fatalf("failed to create person: %v", err)
+	}
+	if lead.Name != "Dana Scully" || lead.Handle != "dscully" {
+		t.Errorf("expected a normalised person, got %+v", lead)
+	}
+	alice, err := db.CreatePerson("Alice", "", "alice", "Backend engineer", &lead.ID)
+	if err != nil {
+		t.Fatalf("failed to create person: %v", err)
+	}
+	if alice.Manager != "Dana Scully" {
+		t.Errorf("expected the manager's name, got %+v", alice)
+	}
+
+	for _, bad := range []struct{ name, email, handle string }{
+		{" ", "", ""},
+		{"Bob", "not an email", ""},
+		{"Bob", "", "bob smith"},
+		{"Bob", "DANA@example.com", ""},
+		{"Bob", "", "Alice"},
+	} {
+		if _, err := db.CreatePerson(bad.name, bad.email, bad.handle, "", nil); !errors.Is(err, ErrInvalidValue) {
+			t.Errorf("expected ErrInvalidValue for %+v, got %v", bad, err)
+		}
+	}
+	missing := int64(999)
+	if _, err := db.CreatePerson("Bob", "", "", "", &missing); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("expected ErrInvalidValue for a missing manager, got %v", err)
+	}
+	if _, err := db.UpdatePerson(lead.ID, nil, nil, nil, nil, &alice.ID); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("expected ErrInvalidValue for a management cycle, got %v", err)
+	}
+
+	for _, ref := range []string{"alice", "@ALICE", "Alice"} {
+		if found, err := db.FindPerson(ref); err != nil || found.ID != alice.ID {
+			t.Errorf("FindPerson(%q): expected alice, got %+v, %v", ref, found, err)
+		}
+	}
+	if found, err := db.FindPerson("Dana@Example.com"); err != nil || found.ID != lead.ID {
+		t.Errorf("expected to find the lead by email, got %+v, %v", found, err)
+	}
+	if _, err := db.FindPerson("nobody"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	role := "backend engineer"
+	if people, _ := db.ListPeople(&role); len(people) != 1 || people[0].ID != alice.ID {
+		t.Errorf("expected only alice with the role, got %+v", people)
+	}
+
+	noManager := int64(0)
+	handle := ""
+	updated, err := db.UpdatePerson(alice.ID, nil, nil, &handle, nil, &noManager)
+	if err != nil {
+		t.Fatalf("failed to update person: %v", err)
+	}
+	if updated.Handle != "" || updated.ManagerID != nil || updated.Role != "Backend engineer" {
+		t.Errorf("expected the handle and manager to be cleared, got %+v", updated)
+	}
+
+	if err := db.DeletePerson(lead.ID); err != nil {
+		t.Fatalf("failed to delete person: %v", err)
+	}
+	if err := db.DeletePerson(lead.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound deleting twice, got %v", err)
+	}
+}
+
+func TestAssignWork(t *testing.T) {
+	db := newTestDatabase(t)
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	alice, _ := db.CreatePerson("Alice Smith", "alice@example.com", "alice", "", nil)
+
+	soon := time.Now().Add(time.Hour)
+	api, err := db.CreateTask(project.ID, nil, "API", "", "", "", "", "", "@alice", "bob@example.com", nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	if api.AssigneeID == nil || *api.AssigneeID != alice.ID || api.Assignee != "Alice Smith" || api.Reviewer != "bob@example.com" {
+		t.Errorf("expected alice as assignee and a new reviewer, got %+v", api)
+	}
+	bob, err := db.FindPerson("bob@example.com")
+	if err != nil || bob.Email != "bob@example.com" {
+		t.Fatalf("expected the reviewer to be added to the directory, got %+v, %v", bob, err)
+	}
+	ui, _ := db.CreateTask(project.ID, nil, "UI", "", "", "", "", "", "Alice Smith", "", nil, &soon)
+	done, _ := db.CreateTask(project.ID, nil, "Done", "", "completed", "", "", "", "alice", "bob", nil, nil)
+	db.CreateTask(project.ID, nil, "Unassigned", "", "", "", "", "", "", "", nil, nil)
+	problem, _ := db.CreateProblem(&project.ID, nil, "Flaky build", "", "", "alice@example.com")
+	db.CreateProblem(&project.ID, nil, "Old bug", "", "resolved", "alice")
+
+	for ref, want := range map[string]int{"alice": 3, "ALICE@example.com": 3, "Bob": 0, "": 1, "nobody": 0} {
+		tasks, _, err := db.ListTasksPage(nil, nil, nil, &ref, nil, DueFilter{}, TagFilter{}, ListOptions{})
+		if err != nil {
+			t.Fatalf("failed to list tasks: %v", err)
+		}
+		if len(tasks) != want {
+			t.Errorf("assignee %q: expected %d tasks, got %d", ref, want, len(tasks))
+		}
+	}
+
+	workload, err := db.GetWorkload(alice.ID)
+	if err != nil {
+		t.Fatalf("failed to get workload: %v", err)
+	}
+	if len(workload.Tasks) != 2 || workload.Tasks[0].ID != ui.ID || workload.Tasks[1].ID != api.ID {
+		t.Errorf("expected alice's open tasks, soonest due first, got %+v", workload.Tasks)
+	}
+	if len(workload.Problems) != 1 || workload.Problems[0].ID != problem.ID || len(workload.Reviews) != 0 {
+		t.Errorf("expected alice's open problem and no reviews, got %+v", workload)
+	}
+	if workload.Person.OpenTasks != 2 || workload.Person.OpenProblems != 1 {
+		t.Errorf("expected the open counts on the person, got %+v", workload.Person)
+	}
+	if workload, _ := db.GetWorkload(bob.ID); len(workload.Reviews) != 1 || workload.Reviews[0].ID != api.ID {
+		t.Errorf("expected bob to review the open task, got %+v", workload.Reviews)
+	}
+
+	// Reassigning, then unassigning
+	bobRef, empty := "bob", ""
+	if task, err := db.UpdateTask(done.ID, nil, nil, nil, nil, nil, nil, &bobRef, &empty, nil, nil, nil); err != nil || task.Assignee != "bob" || task.ReviewerID != nil {
+		t.Errorf("expected the task to move to bob without a reviewer, got %+v, %v", task, err)
+	}
+	if updated, err := db.UpdateProblem(problem.ID, nil, nil, nil, &empty, nil, nil); err != nil || updated.AssigneeID != nil || updated.Assignee != "" {
+		t.Errorf("expected the problem to be unassigned, got %+v, %v", updated, err)
+	}
+
+	// Removing someone from the directory unassigns their work
+	db.DeletePerson(alice.ID)
+	if task, _ := db.GetTask(api.ID); task.AssigneeID != nil || task.Assignee != "" || task.Reviewer != "bob@example.com" {
+		t.Errorf("expected the task to be unassigned, got %+v", task)
+	}
+	if _, err := db.GetWorkload(alice.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a deleted person, got %v", err)
+	}
+}
+
+func TestMigratePeople(t *testing.T) {
+	database, err := OpenDatabase(filepath.Join(t.TempDir(), "loom.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer database.Close()
+	if _, err := database.applyMigrations(migrations[:15]); err != nil {
+		t.Fatalf("failed to apply migrations: %v", err)
+	}
+	_, err = database.db.Exec(`
+	INSERT INTO problems (title, description, status, assignee) VALUES ('One', '', 'open', 'Alice'), ('Two', '', 'open', ' alice '), ('Three', '', 'open', '');
+	INSERT INTO goals (title, description, goal_type, assignee) VALUES ('Grow', '', 'career', 'manager@example.com');
+	`)
+	if err != nil {
+		t.Fatalf("failed to insert assigned items: %v", err)
+	}
+	if _, err := database.Migrate(); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	people, _ := database.ListPeople(nil)
+	if len(people) != 2 || people[0].Name != "Alice" || people[0].OpenProblems != 2 || people[1].Name != "manager@example.com" {
+		t.Fatalf("expected a person for each distinct assignee, got %+v", people)
+	}
+	problems, _ := database.ListProblems(nil, nil, nil, nil)
+	for _, p := range problems {
+		if want := map[string]string{"One": "Alice", "Two": "Alice", "Three": ""}[p.Title]; p.Assignee != want {
+			t.Errorf("%s: expected assignee %q, got %q", p.Title, want, p.Assignee)
+		}
+	}
+	if goal, _ := database.GetGoal(1); goal.AssigneeID == nil || *goal.AssigneeID != people[1].ID {
+		t.Errorf("expected the goal to link to its assignee, got %+v", goal)
+	}
+}
@@ -0,0 +1,650 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// recurrenceLead is how long before it is due the scheduler creates the
+// next instance of a recurring task
+const recurrenceLead = 24 * time.Hour
+
+// maxRecurrencePeriods bounds the number of days, weeks, months or years a
+// rule is expanded over, so that a rule that never matches can't loop forever
+const maxRecurrencePeriods = 100000
+
+// RecurrenceFrequencies are the supported values of FREQ
+var RecurrenceFrequencies = []string{"DAILY", "WEEKLY", "MONTHLY", "YEARLY"}
+
+var weekdayCodes = map[string]time.Weekday{
+	"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+	"FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday,
+}
+
+// RecurrenceRule is the subset of an iCalendar RRULE (RFC 5545) tasks can
+// repeat on: FREQ with INTERVAL, BYDAY for weekly rules, BYMONTHDAY for
+// monthly rules, and an end given by COUNT or UNTIL. Occurrences fall at the
+// time of day of the first one, in its time zone.
+type RecurrenceRule struct {
+	Freq       string
+	Interval   int
+	ByDay      []time.Weekday
+	ByMonthDay []int
+	Count      int
+	Until      string
+}
+
+// ParseRecurrenceRule parses a rule such as "FREQ=WEEKLY;BYDAY=MO,TH". An
+// "RRULE:" prefix is allowed.
+func ParseRecurrenceRule(s string) (*RecurrenceRule, error) {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w recurrence rule %q: %s", ErrInvalidValue, s, fmt.Sprintf(format, args...))
+	}
+
+	r := &RecurrenceRule{Interval: 1}
+	body := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "RRULE:")
+	if body == "" {
+		return nil, invalid("FREQ is required")
+	}
+	for _, part := range strings.Split(body, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, invalid("expected KEY=VALUE, got %q", part)
+		}
+		switch key {
+		case "FREQ":
+			if !slices.Contains(RecurrenceFrequencies, value) {
+				return nil, invalid("FREQ must be one of %s", strings.Join(RecurrenceFrequencies, ", "))
+			}
+			r.Freq = value
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, invalid("INTERVAL must be a positive number")
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, invalid("COUNT must be a positive number")
+			}
+			r.Count = n
+		case "UNTIL":
+			if _, err := time.Parse("20060102", value); err != nil {
+				return nil, invalid("UNTIL must be a date such as 20261231")
+			}
+			r.Until = value
+		case "BYDAY":
+			for _, code := range strings.Split(value, ",") {
+				wd, ok := weekdayCodes[code]
+				if !ok {
+					return nil, invalid("BYDAY takes weekdays such as MO,WE,FR, got %q", code)
+				}
+				r.ByDay = append(r.ByDay, wd)
+			}
+		case "BYMONTHDAY":
+			for _, v := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(v)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return nil, invalid("BYMONTHDAY takes days from 1 to 31, or -1 to -31 from the end of the month")
+				}
+				r.ByMonthDay = append(r.ByMonthDay, n)
+			}
+		default:
+			return nil, invalid("%s is not supported", key)
+		}
+	}
+
+	switch {
+	case r.Freq == "":
+		return nil, invalid("FREQ is required")
+	case len(r.ByDay) > 0 && r.Freq != "WEEKLY":
+		return nil, invalid("BYDAY is only supported with FREQ=WEEKLY")
+	case len(r.ByMonthDay) > 0 && r.Freq != "MONTHLY":
+		return nil, invalid("BYMONTHDAY is only supported with FREQ=MONTHLY")
+	case r.Count > 0 && r.Until != "":
+		return nil, invalid("COUNT and UNTIL can't be combined")
+	}
+	return r, nil
+}
+
+// String returns the rule in a canonical form
+func (r *RecurrenceRule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		codes := make([]string, len(r.ByDay))
+		for i, wd := range r.ByDay {
+			codes[i] = strings.ToUpper(wd.String()[:2])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(codes, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, d := range r.ByMonthDay {
+			days[i] = strconv.Itoa(d)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if r.Until != "" {
+		parts = append(parts, "UNTIL="+r.Until)
+	}
+	return strings.Join(parts, ";")
+}
+
+// Next returns the first occurrence of the rule after the given time, or nil
+// once the rule has ended. dtstart is the first occurrence; COUNT includes it.
+func (r *RecurrenceRule) Next(dtstart, after time.Time) *time.Time {
+	var next *time.Time
+	r.each(dtstart, func(t time.Time) bool {
+		if t.After(after) {
+			next = &t
+			return false
+		}
+		return true
+	})
+	return next
+}
+
+// each calls fn with every occurrence from dtstart in order, until fn returns
+// false or the rule ends
+func (r *RecurrenceRule) each(dtstart time.Time, fn func(time.Time) bool) {
+	loc := dtstart.Location()
+	year, month, day := dtstart.Date()
+	hour, minute, sec := dtstart.Clock()
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, hour, minute, sec, 0, loc)
+	}
+
+	var until *time.Time
+	if r.Until != "" {
+		u, _ := time.ParseInLocation("20060102", r.Until, loc)
+		u = atTimeOfDay(u, true)
+		until = &u
+	}
+	n := 0
+	emit := func(t time.Time) bool {
+		if t.Before(dtstart) {
+			return true
+		}
+		if until != nil && t.After(*until) {
+			return false
+		}
+		n++
+		if r.Count > 0 && n > r.Count {
+			return false
+		}
+		return fn(t)
+	}
+
+	// Weeks start on Monday
+	weekdays := r.ByDay
+	if len(weekdays) == 0 {
+		weekdays = []time.Weekday{dtstart.Weekday()}
+	}
+	offsets := make([]int, len(weekdays))
+	for i, wd := range weekdays {
+		offsets[i] = (int(wd) + 6) % 7
+	}
+	sort.Ints(offsets)
+	monday := day - (int(dtstart.Weekday())+6)%7
+
+	monthDays := r.ByMonthDay
+	if len(monthDays) == 0 {
+		monthDays = []int{day}
+	}
+
+	for i := 0; i < maxRecurrencePeriods; i++ {
+		k := i * r.Interval
+		switch r.Freq {
+		case "DAILY":
+			if !emit(at(year, month, day+k)) {
+				return
+			}
+		case "WEEKLY":
+			for _, offset := range offsets {
+				if !emit(at(year, month, monday+7*k+offset)) {
+					return
+				}
+			}
+		case "MONTHLY":
+			m := month + time.Month(k)
+			last := time.Date(year, m+1, 0, 0, 0, 0, 0, loc).Day()
+			days := []int{}
+			for _, d := range monthDays {
+				if d < 0 {
+					d = last + d + 1
+				}
+				// Months without the day are skipped, as in RFC 5545
+				if d >= 1 && d <= last && !slices.Contains(days, d) {
+					days = append(days, d)
+				}
+			}
+			sort.Ints(days)
+			for _, d := range days {
+				if !emit(at(year, m, d)) {
+					return
+				}
+			}
+		case "YEARLY":
+			t := at(year+k, month, day)
+			if t.Day() != day {
+				// February 29th outside leap years
+				continue
+			}
+			if !emit(t) {
+				return
+			}
+		}
+	}
+}
+
+// checkRecurrence verifies, before a task is created, that it can repeat on
+// rule with the given due date. An empty rule is always valid.
+func checkRecurrence(rule string, dueAt *time.Time) error {
+	if rule == "" {
+		return nil
+	}
+	if _, err := ParseRecurrenceRule(rule); err != nil {
+		return err
+	}
+	if dueAt == nil || dueAt.IsZero() {
+		return fmt.Errorf("%w recurrence: a recurring task needs a due_at to repeat from", ErrInvalidValue)
+	}
+	return nil
+}
+
+// Recurrence repeats a task on a rule. Each instance is a task of its own,
+// created when the previous one is completed or by the scheduler shortly
+// before it is due. TaskID is the latest instance, which later instances are
+// copied from, and NextAt the due date of the next instance, or nil once the
+// rule has ended.
+type Recurrence struct {
+	ID        int64      `json:"id"`
+	Rule      string     `json:"rule"`
+	DTStart   time.Time  `json:"dtstart"`
+	NextAt    *time.Time `json:"next_at"`
+	Paused    bool       `json:"paused"`
+	TaskID    *int64     `json:"task_id"`
+	ProjectID *int64     `json:"project_id"`
+	Title     string     `json:"title"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+const recurrenceSelect = `
+	SELECT r.id, r.rule, r.dtstart, r.next_at, r.paused, t.id, t.project_id, COALESCE(t.title, ''), r.created_at, r.updated_at
+	FROM task_recurrences r
+	LEFT JOIN tasks t ON t.id = (SELECT MAX(id) FROM tasks WHERE recurrence_id = r.id AND deleted_at IS NULL)`
+
+func scanRecurrence(scan func(dest ...interface{}) error) (*Recurrence, error) {
+	var r Recurrence
+	err := scan(&r.ID, &r.Rule, &r.DTStart, &r.NextAt, &r.Paused, &r.TaskID, &r.ProjectID, &r.Title, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// GetRecurrence returns a recurrence by ID
+func (d *Database) GetRecurrence(id int64) (*Recurrence, error) {
+	r, err := scanRecurrence(d.db.QueryRow(recurrenceSelect+" WHERE r.id = ?", id).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("recurrence with ID %d %w", id, ErrNotFound)
+	}
+	return r, err
+}
+
+// ListRecurrences returns the recurrences whose latest instance is in a
+// project, or all of them, the next one due first
+func (d *Database) ListRecurrences(projectID *int64) ([]*Recurrence, error) {
+	query := recurrenceSelect
+	args := []interface{}{}
+	if projectID != nil {
+		query += " WHERE t.project_id = ?"
+		args = append(args, *projectID)
+	}
+	query += " ORDER BY r.next_at IS NULL, r.next_at, r.id"
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recurrences := []*Recurrence{}
+	for rows.Next() {
+		r, err := scanRecurrence(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		recurrences = append(recurrences, r)
+	}
+	return recurrences, rows.Err()
+}
+
+// SetTaskRecurrence makes a task repeat on a rule, counted from its due
+// date, or changes the rule of a recurring task. An empty rule stops the
+// task from repeating.
+func (d *Database) SetTaskRecurrence(taskID int64, rule string) (*Recurrence, error) {
+	task, err := d.GetTask(taskID)
+	if err != nil {
+		return nil, err
+	}
+	if rule == "" {
+		return nil, d.removeTaskRecurrence(task)
+	}
+
+	parsed, err := ParseRecurrenceRule(rule)
+	if err != nil {
+		return nil, err
+	}
+	if task.DueAt == nil {
+		return nil, fmt.Errorf("%w recurrence: task %d needs a due_at to repeat from", ErrInvalidValue, taskID)
+	}
+	dtstart := task.DueAt.In(d.location)
+	next := parsed.Next(dtstart, dtstart)
+
+	if task.RecurrenceID != nil {
+		before, err := d.GetRecurrence(*task.RecurrenceID)
+		if err != nil {
+			return nil, err
+		}
+		_, err = d.db.Exec(
+			"UPDATE task_recurrences SET rule = ?, dtstart = ?, next_at = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+			parsed.String(), dbTime(&dtstart), dbTime(next), before.ID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		recurrence, err := d.GetRecurrence(before.ID)
+		if err != nil {
+			return nil, err
+		}
+		d.publish(ActionUpdated, EntityTaskRecurrence, recurrence.ID, before, recurrence)
+		return recurrence, nil
+	}
+
+	result, err := d.db.Exec(
+		"INSERT INTO task_recurrences (rule, dtstart, next_at) VALUES (?, ?, ?)",
+		parsed.String(), dbTime(&dtstart), dbTime(next),
+	)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := d.db.Exec("UPDATE tasks SET recurrence_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", id, taskID); err != nil {
+		return nil, err
+	}
+
+	recurrence, err := d.GetRecurrence(id)
+	if err != nil {
+		return nil, err
+	}
+	d.publish(ActionCreated, EntityTaskRecurrence, recurrence.ID, nil, recurrence)
+	if after, err := d.GetTask(taskID); err == nil {
+		d.publish(ActionUpdated, EntityTask, taskID, task, after)
+	}
+	return recurrence, nil
+}
+
+// removeTaskRecurrence deletes the recurrence of a task. Earlier instances
+// stay, but no longer point at it.
+func (d *Database) removeTaskRecurrence(task *Task) error {
+	if task.RecurrenceID == nil {
+		return nil
+	}
+	before, err := d.GetRecurrence(*task.RecurrenceID)
+	if err != nil {
+		return err
+	}
+	if _, err := d.db.Exec("DELETE FROM task_recurrences WHERE id = ?", before.ID); err != nil {
+		return err
+	}
+	d.publish(ActionDeleted, EntityTaskRecurrence, before.ID, before, nil)
+	if after, err := d.GetTask(task.ID); err == nil {
+		d.publish(ActionUpdated, EntityTask, task.ID, task, after)
+	}
+	return nil
+}
+
+// PauseRecurrence stops a recurrence from creating instances until it is
+// resumed
+func (d *Database) PauseRecurrence(id int64) (*Recurrence, error) {
+	return d.setRecurrencePaused(id, true)
+}
+
+// ResumeRecurrence lets a paused recurrence create instances again.
+// Occurrences that fell while it was paused are skipped.
+func (d *Database) ResumeRecurrence(id int64) (*Recurrence, error) {
+	return d.setRecurrencePaused(id, false)
+}
+
+func (d *Database) setRecurrencePaused(id int64, paused bool) (*Recurrence, error) {
+	before, err := d.GetRecurrence(id)
+	if err != nil {
+		return nil, err
+	}
+	if before.Paused == paused {
+		return before, nil
+	}
+
+	next := before.NextAt
+	if !paused && next != nil && next.Before(time.Now()) {
+		rule, err := ParseRecurrenceRule(before.Rule)
+		if err != nil {
+			return nil, err
+		}
+		next = rule.Next(before.DTStart.In(d.location), time.Now())
+	}
+	_, err = d.db.Exec(
+		"UPDATE task_recurrences SET paused = ?, next_at = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		paused, dbTime(next), id,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	recurrence, err := d.GetRecurrence(id)
+	if err != nil {
+		return nil, err
+	}
+	d.publish(ActionUpdated, EntityTaskRecurrence, recurrence.ID, before, recurrence)
+	return recurrence, nil
+}
+
+// repeatTask creates the next instance of a recurring task that was just
+// completed, unless the recurrence is paused or has ended, or an instance is
+// still open
+func (d *Database) repeatTask(task *Task) (*Task, error) {
+	recurrence, err := d.GetRecurrence(*task.RecurrenceID)
+	if err != nil {
+		return nil, err
+	}
+	if recurrence.Paused || recurrence.NextAt == nil {
+		return nil, nil
+	}
+	var open bool
+	err = d.db.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM tasks WHERE recurrence_id = ? AND id != ? AND status != 'completed' AND deleted_at IS NULL)",
+		recurrence.ID, task.ID,
+	).Scan(&open)
+	if err != nil || open {
+		return nil, err
+	}
+	return d.materializeRecurrence(recurrence, time.Now())
+}
+
+// materializeRecurrence creates the instance of a recurrence due at NextAt
+// and moves NextAt on. The instance copies the latest one, without its
+// notes, dependencies or status. Occurrences that passed without an
+// instance, for example while the server was down, are folded into one.
+// NextAt is moved on in the same transaction as the instance is created,
+// and only if it has not moved already, so an occurrence that another
+// process or goroutine got to first creates nothing.
+func (d *Database) materializeRecurrence(recurrence *Recurrence, now time.Time) (*Task, error) {
+	if recurrence.TaskID == nil || recurrence.NextAt == nil {
+		return nil, nil
+	}
+	rule, err := ParseRecurrenceRule(recurrence.Rule)
+	if err != nil {
+		return nil, err
+	}
+	template, err := d.GetTask(*recurrence.TaskID)
+	if err != nil {
+		return nil, err
+	}
+
+	dtstart := recurrence.DTStart.In(d.location)
+	due := recurrence.NextAt.In(d.location)
+	for {
+		next := rule.Next(dtstart, due)
+		if next == nil || next.After(now) {
+			break
+		}
+		due = *next
+	}
+	var startAt *time.Time
+	if template.StartAt != nil && template.DueAt != nil {
+		s := due.Add(template.StartAt.Sub(*template.DueAt))
+		startAt = &s
+	}
+	parentTaskID := template.ParentTaskID
+	if parentTaskID != nil {
+		if _, err := d.GetTask(*parentTaskID); err != nil {
+			parentTaskID = nil
+		}
+	}
+	if err := checkDateRange(startAt, &due); err != nil {
+		return nil, err
+	}
+	if err := d.checkTaskProject(EntityTask, &template.ProjectID, nil); err != nil {
+		return nil, err
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Claiming the occurrence first takes the write lock, so a concurrent
+	// claim waits for this one and then finds NextAt has moved
+	claim, err := tx.Exec(
+		"UPDATE task_recurrences SET next_at = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND next_at = ?",
+		dbTime(rule.Next(dtstart, due)), recurrence.ID, dbTime(recurrence.NextAt),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := claim.RowsAffected(); err != nil || n == 0 {
+		return nil, err
+	}
+	result, err := tx.Exec(
+		"INSERT INTO tasks (project_id, parent_task_id, recurrence_id, title, description, status, priority, task_type, external_link, assignee_id, reviewer_id, start_at, due_at) VALUES (?, ?, ?, ?, ?, 'pending', ?, ?, ?, ?, ?, ?, ?)",
+		template.ProjectID, parentTaskID, recurrence.ID, template.Title, template.Description, template.Priority, template.TaskType, template.ExternalLink, template.AssigneeID, template.ReviewerID, dbTime(startAt), dbTime(&due),
+	)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("INSERT INTO task_tags (task_id, tag_id) SELECT ?, tag_id FROM task_tags WHERE task_id = ?", id, template.ID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	task, err := d.GetTask(id)
+	if err != nil {
+		return nil, err
+	}
+	d.publish(ActionCreated, EntityTask, task.ID, nil, task)
+	return task, nil
+}
+
+// MaterializeRecurrences creates the instances of recurring tasks that are
+// due within recurrenceLead of now and returns how many it created
+func (d *Database) MaterializeRecurrences(now time.Time) (int, error) {
+	rows, err := d.db.Query(
+		recurrenceSelect+" WHERE r.paused = 0 AND r.next_at <= ?",
+		now.Add(recurrenceLead).UTC().Format(dbTimeLayout),
+	)
+	if err != nil {
+		return 0, err
+	}
+	due := []*Recurrence{}
+	for rows.Next() {
+		r, err := scanRecurrence(rows.Scan)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, r := range due {
+		task, err := d.materializeRecurrence(r, now)
+		if err != nil {
+			return n, fmt.Errorf("recurrence %d: %w", r.ID, err)
+		}
+		if task != nil {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// StartRecurrenceScheduler creates upcoming instances of recurring tasks
+// now and then every interval, until the returned function is called
+func (d *Database) StartRecurrenceScheduler(interval time.Duration) func() {
+	scheduler := d.WithActor("loom:scheduler")
+	materialize := func() {
+		n, err := scheduler.MaterializeRecurrences(time.Now())
+		if err != nil {
+			log.Printf("Failed to create recurring tasks: %v", err)
+		}
+		if n > 0 {
+			log.Printf("Created %d recurring task(s)", n)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		materialize()
+		for {
+			select {
+			case <-ticker.C:
+				materialize()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
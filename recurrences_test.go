@@ -0,0 +1,246 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecurrenceRuleNext(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+	// A Monday, the day before the clocks go forward
+	dtstart := time.Date(2026, 3, 23, 9, 0, 0, 0, loc)
+
+	tests := []struct {
+		rule  string
+		after time.Time
+		want  []time.Time
+		ends  bool
+	}{
+		{"FREQ=DAILY;INTERVAL=3", dtstart, []time.Time{
+			time.Date(2026, 3, 26, 9, 0, 0, 0, loc), time.Date(2026, 3, 29, 9, 0, 0, 0, loc),
+		}, false},
+		{"RRULE:FREQ=WEEKLY;BYDAY=FR,MO", dtstart, []time.Time{
+			time.Date(2026, 3, 27, 9, 0, 0, 0, loc), time.Date(2026, 3, 30, 9, 0, 0, 0, loc), time.Date(2026, 4, 3, 9, 0, 0, 0, loc),
+		}, false},
+		{"FREQ=WEEKLY;INTERVAL=2", dtstart, []time.Time{
+			time.Date(2026, 4, 6, 9, 0, 0, 0, loc), time.Date(2026, 4, 20, 9, 0, 0, 0, loc),
+		}, false},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", dtstart, []time.Time{
+			time.Date(2026, 3, 31, 9, 0, 0, 0, loc), time.Date(2026, 4, 30, 9, 0, 0, 0, loc), time.Date(2026, 5, 31, 9, 0, 0, 0, loc),
+		}, false},
+		{"FREQ=MONTHLY;BYMONTHDAY=30", time.Date(2027, 1, 30, 9, 0, 0, 0, loc), []time.Time{
+			// February has no 30th
+			time.Date(2027, 3, 30, 9, 0, 0, 0, loc),
+		}, false},
+		{"FREQ=WEEKLY;COUNT=3", dtstart, []time.Time{
+			time.Date(2026, 3, 30, 9, 0, 0, 0, loc), time.Date(2026, 4, 6, 9, 0, 0, 0, loc),
+		}, true},
+		{"FREQ=DAILY;UNTIL=20260324", dtstart, []time.Time{
+			time.Date(2026, 3, 24, 9, 0, 0, 0, loc),
+		}, true},
+		{"FREQ=YEARLY", dtstart, []time.Time{
+			time.Date(2027, 3, 23, 9, 0, 0, 0, loc),
+		}, false},
+	}
+	for _, tt := range tests {
+		rule, err := ParseRecurrenceRule(tt.rule)
+		if err != nil {
+			t.Errorf("ParseRecurrenceRule(%q): %v", tt.rule, err)
+			continue
+		}
+		after := tt.after
+		for _, want := range tt.want {
+			next := rule.Next(dtstart, after)
+			if next == nil || !next.Equal(want) {
+				t.Errorf("%s: expected %v after %v, got %v", tt.rule, want, after, next)
+				break
+			}
+			after = *next
+		}
+		if next := rule.Next(dtstart, after); tt.ends && next != nil {
+			t.Errorf("%s: expected the rule to end, got %v", tt.rule, next)
+		}
+	}
+
+	for _, rule := range []string{"", "FREQ=HOURLY", "FREQ=DAILY;BYDAY=MO", "FREQ=WEEKLY;BYDAY=1MO", "FREQ=DAILY;COUNT=2;UNTIL=20261231", "FREQ=DAILY;BYSETPOS=1", "INTERVAL=2"} {
+		if _, err := ParseRecurrenceRule(rule); !errors.Is(err, ErrInvalidValue) {
+			t.Errorf("expected ErrInvalidValue for %q, got %v", rule, err)
+		}
+	}
+}
+
+func TestRecurringTaskCompletion(t *testing.T) {
+	db := newTestDatabase(t)
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	due := time.Now().Add(time.Hour).Truncate(time.Second)
+	start := due.Add(-2 * time.Hour)
+	task, _ := db.CreateTask(project.ID, nil, "Dependency audit", "Run the audit", "", "high", "chore", "", "", "", &start, &due)
+	db.CreateTaskNote(task.ID, "Found 3 outdated modules")
+
+	if _, err := db.SetTaskRecurrence(task.ID, "freq=weekly"); err != nil {
+		t.Fatalf("failed to set recurrence: %v", err)
+	}
+	task, _ = db.GetTask(task.ID)
+	recurrences, _ := db.ListRecurrences(nil)
+	if task.RecurrenceID == nil || len(recurrences) != 1 || recurrences[0].Rule != "FREQ=WEEKLY" || !recurrences[0].NextAt.Equal(due.AddDate(0, 0, 7)) {
+		t.Fatalf("expected a weekly recurrence due next week, got %+v", recurrences)
+	}
+
+	completed := "completed"
+	if _, err := db.UpdateTask(task.ID, nil, nil, &completed, nil, nil, nil, nil, nil, nil, nil, nil); err != nil {
+		t.Fatalf("failed to complete task: %v", err)
+	}
+	tasks, _ := db.ListTasks(nil, nil, nil)
+	if len(tasks) != 2 {
+		t.Fatalf("expected the next instance to be created, got %d tasks", len(tasks))
+	}
+	var next *Task
+	for _, candidate := range tasks {
+		if candidate.ID != task.ID {
+			next = candidate
+		}
+	}
+	if next.Status != "pending" || next.Priority != "high" || next.Description != "Run the audit" || *next.RecurrenceID != *task.RecurrenceID {
+		t.Errorf("expected a pending copy of the task, got %+v", next)
+	}
+	if !next.DueAt.Equal(due.AddDate(0, 0, 7)) || !next.StartAt.Equal(start.AddDate(0, 0, 7)) {
+		t.Errorf("expected the dates to move on a week, got %v to %v", next.StartAt, next.DueAt)
+	}
+	if notes, _ := db.ListTaskNotes(next.ID); len(notes) != 0 {
+		t.Errorf("expected the next instance to start without notes, got %d", len(notes))
+	}
+	recurrence, _ := db.GetRecurrence(*task.RecurrenceID)
+	if *recurrence.TaskID != next.ID || !recurrence.NextAt.Equal(due.AddDate(0, 0, 14)) {
+		t.Errorf("expected the recurrence to point at the new instance, got %+v", recurrence)
+	}
+
+	// Reopening and completing the old instance again doesn't create another
+	// while the new one is open
+	pending := "pending"
+	db.UpdateTask(task.ID, nil, nil, &pending, nil, nil, nil, nil, nil, nil, nil, nil)
+	db.UpdateTask(task.ID, nil, nil, &completed, nil, nil, nil, nil, nil, nil, nil, nil)
+	if tasks, _ := db.ListTasks(nil, nil, nil); len(tasks) != 2 {
+		t.Errorf("expected no extra instance while one is open, got %d tasks", len(tasks))
+	}
+
+	// A paused recurrence creates nothing
+	if _, err := db.PauseRecurrence(recurrence.ID); err != nil {
+		t.Fatalf("failed to pause recurrence: %v", err)
+	}
+	db.UpdateTask(next.ID, nil, nil, &completed, nil, nil, nil, nil, nil, nil, nil, nil)
+	if tasks, _ := db.ListTasks(nil, nil, nil); len(tasks) != 2 {
+		t.Errorf("expected no instance while paused, got %d tasks", len(tasks))
+	}
+
+	// Stopping the recurrence keeps the instances
+	if _, err := db.SetTaskRecurrence(next.ID, ""); err != nil {
+		t.Fatalf("failed to remove recurrence: %v", err)
+	}
+	if _, err := db.GetRecurrence(recurrence.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the recurrence to be deleted, got %v", err)
+	}
+	if loaded, _ := db.GetTask(next.ID); loaded.RecurrenceID != nil {
+		t.Errorf("expected the task to stop recurring, got %+v", loaded.RecurrenceID)
+	}
+}
+
+func TestMaterializeRecurrences(t *testing.T) {
+	db := newTestDatabase(t)
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	due := time.Now().AddDate(0, 0, -10).Truncate(time.Second)
+	task, _ := db.CreateTask(project.ID, nil, "Release checklist", "", "", "", "", "", "", "", nil, &due)
+	recurrence, err := db.SetTaskRecurrence(task.ID, "FREQ=DAILY;INTERVAL=3")
+	if err != nil {
+		t.Fatalf("failed to set recurrence: %v", err)
+	}
+
+	if _, err := db.SetTaskRecurrence(task.ID, "FREQ=SOMETIMES"); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("expected ErrInvalidValue for an invalid rule, got %v", err)
+	}
+	undated, _ := db.CreateTask(project.ID, nil, "Undated", "", "", "", "", "", "", "", nil, nil)
+	if _, err := db.SetTaskRecurrence(undated.ID, "FREQ=DAILY"); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("expected ErrInvalidValue for a task without a due date, got %v", err)
+	}
+
+	// Missed occurrences are folded into one instance, due at the latest
+	now := time.Now()
+	n, err := db.MaterializeRecurrences(now)
+	if err != nil {
+		t.Fatalf("failed to materialize recurrences: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 instance, got %d", n)
+	}
+	recurrence, _ = db.GetRecurrence(recurrence.ID)
+	latest, _ := db.GetTask(*recurrence.TaskID)
+	if latest.ID == task.ID || !latest.DueAt.Equal(due.AddDate(0, 0, 9)) {
+		t.Errorf("expected an instance due 9 days after the first, got %+v", latest.DueAt)
+	}
+
+	// The next occurrence is 2 days away, outside the lead time
+	if n, _ := db.MaterializeRecurrences(now); n != 0 {
+		t.Errorf("expected no instance before the lead time, got %d", n)
+	}
+	if n, _ := db.MaterializeRecurrences(now.AddDate(0, 0, 2)); n != 1 {
+		t.Errorf("expected the next instance a day before it is due, got %d", n)
+	}
+
+	// Resuming skips the occurrences that fell while paused
+	db.PauseRecurrence(recurrence.ID)
+	db.db.Exec("UPDATE task_recurrences SET next_at = ? WHERE id = ?", dbTime(&due), recurrence.ID)
+	if n, _ := db.MaterializeRecurrences(now); n != 0 {
+		t.Errorf("expected nothing from a paused recurrence, got %d", n)
+	}
+	resumed, err := db.ResumeRecurrence(recurrence.ID)
+	if err != nil {
+		t.Fatalf("failed to resume recurrence: %v", err)
+	}
+	if resumed.Paused || !resumed.NextAt.After(now) {
+		t.Errorf("expected the next occurrence to be in the future, got %+v", resumed)
+	}
+}
+
+func TestMaterializeRecurrencesConcurrently(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "loom.db")
+	db, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	due := time.Now().AddDate(0, 0, -10).Truncate(time.Second)
+	task, _ := db.CreateTask(project.ID, nil, "Water the plants", "", "", "", "", "", "", "", nil, &due)
+	if _, err := db.SetTaskRecurrence(task.ID, "FREQ=DAILY;INTERVAL=3"); err != nil {
+		t.Fatalf("failed to set recurrence: %v", err)
+	}
+
+	// A second process, such as a stdio server, sees the same due occurrence
+	other, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database again: %v", err)
+	}
+	defer other.Close()
+
+	now := time.Now()
+	counts := make(chan int, 2)
+	for _, d := range []*Database{db, other} {
+		go func() {
+			n, err := d.MaterializeRecurrences(now)
+			if err != nil {
+				t.Errorf("failed to materialize recurrences: %v", err)
+			}
+			counts <- n
+		}()
+	}
+	if n := <-counts + <-counts; n != 1 {
+		t.Errorf("expected 1 instance between both processes, got %d", n)
+	}
+	if tasks, _ := db.ListTasks(&project.ID, nil, nil); len(tasks) != 2 {
+		t.Errorf("expected the task and one instance, got %d tasks", len(tasks))
+	}
+}
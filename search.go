@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SearchEntities are the entity types that can be searched
+var SearchEntities = []string{EntityProject, EntityTask, EntityProblem, EntityOutcome, EntityGoal, EntityTaskNote}
+
+// Search result limits
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// SearchResult is a single full-text search match. Snippet is an excerpt of
+// the best matching field with matched terms wrapped in <mark></mark>. For
+// task notes, Title is the title of the task and TaskID is set.
+type SearchResult struct {
+	Entity  string  `json:"entity"`
+	ID      int64   `json:"id"`
+	TaskID  *int64  `json:"task_id,omitempty"`
+	Title   string  `json:"title"`
+	Snippet string  `json:"snippet"`
+	Rank    float64 `json:"rank"`
+}
+
+// Search finds projects, tasks, problems, outcomes, goals and task notes
+// whose title, description or note match query, best matches first. Each
+// word of query is matched as a prefix, and all words must match. entity
+// restricts results to one entity type; limit defaults to 20 and is capped
+// at 100.
+func (d *Database) Search(query string, entity *string, limit int) ([]*SearchResult, error) {
+	match := ftsQuery(query)
+	if match == "" {
+		return nil, fmt.Errorf("%w search query: must contain at least one word", ErrInvalidValue)
+	}
+	if err := validateOptionalEnum("search entity", entity, SearchEntities); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	// Titles weigh more than descriptions and notes when ranking
+	sqlQuery := `
+		SELECT search_index.entity, search_index.entity_id, task_notes.task_id,
+			COALESCE(NULLIF(search_index.title, ''), tasks.title, ''),
+			snippet(search_index, -1, '<mark>', '</mark>', '…', 16),
+			bm25(search_index, 0, 0, 5.0, 1.0) AS rank
+		FROM search_index
+		LEFT JOIN task_notes ON search_index.entity = 'task_note' AND task_notes.id = search_index.entity_id
+		LEFT JOIN tasks ON tasks.id = task_notes.task_id
+		WHERE search_index MATCH ?`
+	args := []interface{}{match}
+
+	if entity != nil {
+		sqlQuery += " AND search_index.entity = ?"
+		args = append(args, *entity)
+	}
+
+	sqlQuery += " ORDER BY rank LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := d.db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []*SearchResult{}
+	for rows.Next() {
+		var r SearchResult
+		var taskID *int64
+		if err := rows.Scan(&r.Entity, &r.ID, &taskID, &r.Title, &r.Snippet, &r.Rank); err != nil {
+			return nil, err
+		}
+		r.TaskID = taskID
+		results = append(results, &r)
+	}
+	return results, rows.Err()
+}
+
+// ftsQuery turns free text into an FTS5 query that matches every word as a
+// prefix. Each word is quoted so that punctuation and FTS5 operators in user
+// input are treated as plain text.
+func ftsQuery(query string) string {
+	var terms []string
+	for _, word := range strings.Fields(query) {
+		if strings.Trim(word, `"*^:()+-.,;!?'`) == "" {
+			continue
+		}
+		terms = append(terms, `"`+strings.ReplaceAll(word, `"`, `""`)+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func searchIDs(t *testing.T, db *Database, query string, entity *string) map[string][]int64 {
+	t.Helper()
+	results, err := db.Search(query, entity, 0)
+	if err != nil {
+		t.Fatalf("search %q failed: %v", query, err)
+	}
+	ids := map[string][]int64{}
+	for _, r := range results {
+		ids[r.Entity] = append(ids[r.Entity], r.ID)
+	}
+	return ids
+}
+
+func TestSearchFindsAllEntities(t *testing.T) {
+	db := newTestDatabase(t)
+
+	project, _ := db.CreateProject("Billing service", "Handles invoices", "", "", nil, nil)
+	task, _ := db.CreateTask(project.ID, nil, "Retry failed webhooks", "", "pending", "low", "general", "", "", "", nil, nil)
+	db.CreateProblem(&project.ID, nil, "Webhook timeouts", "Stripe webhooks time out under load", "open", "")
+	db.CreateOutcome(project.ID, nil, "Invoices sent on time", "", "open", nil, nil)
+	db.CreateGoal(nil, nil, "Learn about webhooks", "", "career", "", nil, nil)
+	note, _ := db.CreateTaskNote(task.ID, "Tried exponential backoff for the webhook queue")
+
+	ids := searchIDs(t, db, "webhook", nil)
+	if len(ids[EntityTask]) != 1 || len(ids[EntityProblem]) != 1 || len(ids[EntityGoal]) != 1 || len(ids[EntityTaskNote]) != 1 {
+		t.Fatalf("expected matches in tasks, problems, goals and notes, got %v", ids)
+	}
+	if len(ids[EntityProject]) != 0 || len(ids[EntityOutcome]) != 0 {
+		t.Errorf("unexpected matches: %v", ids)
+	}
+
+	// Prefix matching and stemming
+	if ids := searchIDs(t, db, "invoic", nil); len(ids[EntityProject]) != 1 || len(ids[EntityOutcome]) != 1 {
+		t.Errorf("expected prefix match on invoices, got %v", ids)
+	}
+
+	// Entity filter
+	entity := EntityTaskNote
+	results, err := db.Search("webhook", &entity, 0)
+	if err != nil {
+		t.Fatalf("search failed: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != note.ID {
+		t.Fatalf("expected only the note, got %+v", results)
+	}
+	if results[0].TaskID == nil || *results[0].TaskID != task.ID || results[0].Title != task.Title {
+		t.Errorf("expected note result to carry its task, got %+v", results[0])
+	}
+	if !strings.Contains(results[0].Snippet, "<mark>webhook</mark>") {
+		t.Errorf("expected highlighted snippet, got %q", results[0].Snippet)
+	}
+}
+
+func TestSearchRanksTitleMatchesFirst(t *testing.T) {
+	db := newTestDatabase(t)
+
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	body, _ := db.CreateTask(project.ID, nil, "Clean up", "Remove the old cache layer", "pending", "low", "general", "", "", "", nil, nil)
+	title, _ := db.CreateTask(project.ID, nil, "Cache invalidation", "", "pending", "low", "general", "", "", "", nil, nil)
+
+	results, err := db.Search("cache", nil, 0)
+	if err != nil {
+		t.Fatalf("search failed: %v", err)
+	}
+	if len(results) != 2 || results[0].ID != title.ID || results[1].ID != body.ID {
+		t.Errorf("expected title match to rank first, got %+v", results)
+	}
+}
+
+func TestSearchIndexFollowsChanges(t *testing.T) {
+	db := newTestDatabase(t)
+
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	task, _ := db.CreateTask(project.ID, nil, "Draft proposal", "", "pending", "low", "general", "", "", "", nil, nil)
+	db.CreateTaskNote(task.ID, "Proposal needs a budget section")
+
+	newTitle := "Draft roadmap"
+	db.UpdateTask(task.ID, &newTitle, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	if ids := searchIDs(t, db, "roadmap", nil); len(ids[EntityTask]) != 1 {
+		t.Errorf("expected updated title to be indexed, got %v", ids)
+	}
+	if ids := searchIDs(t, db, "draft proposal", nil); len(ids[EntityTask]) != 0 {
+		t.Errorf("expected old title to be removed from the index, got %v", ids)
+	}
+
+	// Deleting the project cascades to the task and its notes
+	db.DeleteProject(project.ID)
+	if ids := searchIDs(t, db, "budget", nil); len(ids) != 0 {
+		t.Errorf("expected cascaded deletes to be removed from the index, got %v", ids)
+	}
+}
+
+func TestSearchQueryIsSanitized(t *testing.T) {
+	db := newTestDatabase(t)
+
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	db.CreateTask(project.ID, nil, "Fix C++ build (NEAR release)", "", "pending", "low", "general", "", "", "", nil, nil)
+
+	for _, query := range []string{`c++`, `"build`, `NEAR(`, `build AND`, `-release`, `title:fix`} {
+		if _, err := db.Search(query, nil, 0); err != nil {
+			t.Errorf("search %q failed: %v", query, err)
+		}
+	}
+
+	if _, err := db.Search(`  ** `, nil, 0); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("expected ErrInvalidValue for empty query, got %v", err)
+	}
+	entity := "comment"
+	if _, err := db.Search("fix", &entity, 0); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("expected ErrInvalidValue for unknown entity, got %v", err)
+	}
+}
+
+func TestSearchMigrationIndexesExistingRows(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "loom.db")
+	db, err := OpenDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	// Stop just before the search index existed, then add data
+	if _, err := db.applyMigrations(migrations[:7]); err != nil {
+		t.Fatalf("failed to apply early migrations: %v", err)
+	}
+	// The Database methods expect the latest schema, so insert directly
+	if _, err := db.db.Exec(`
+		INSERT INTO projects (id, name) VALUES (1, 'Legacy project');
+		INSERT INTO tasks (project_id, title) VALUES (1, 'Legacy task');
+	`); err != nil {
+		t.Fatalf("failed to insert legacy rows: %v", err)
+	}
+
+	if _, err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	if ids := searchIDs(t, db, "legacy", nil); len(ids[EntityProject]) != 1 || len(ids[EntityTask]) != 1 {
+		t.Errorf("expected existing rows to be indexed, got %v", ids)
+	}
+}
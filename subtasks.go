@@ -0,0 +1,123 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// taskSubtree selects the IDs of the live subtasks of a task, at any depth.
+// param is the placeholder for the task's ID. Subtasks trashed on their own
+// are left out along with theirs.
+func taskSubtree(param string) string {
+	return `WITH RECURSIVE subtree(id) AS (
+		SELECT id FROM tasks WHERE parent_task_id = ` + param + ` AND deleted_at IS NULL
+		UNION ALL
+		SELECT t.id FROM tasks t JOIN subtree s ON t.parent_task_id = s.id WHERE t.deleted_at IS NULL
+	) SELECT id FROM subtree`
+}
+
+// checkTaskParent verifies that a task in projectID can be nested under
+// parentID: the parent must be a live task in the same project, and neither
+// the task itself nor one of its subtasks. id is zero for a new task.
+func (d *Database) checkTaskParent(id, projectID, parentID int64) error {
+	parent, err := d.GetTask(parentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: task with ID %d does not exist", ErrInvalidReference, parentID)
+	}
+	if err != nil {
+		return err
+	}
+	if parent.ProjectID != projectID {
+		return &ProjectMismatchError{Entity: "subtask", TaskID: parent.ID, TaskProjectID: parent.ProjectID, ProjectID: projectID}
+	}
+	if id == 0 {
+		return nil
+	}
+	if id == parentID {
+		return fmt.Errorf("%w parent task: task %d can't be its own parent", ErrInvalidValue, id)
+	}
+
+	// Walk up from the new parent, including trashed tasks so that restoring
+	// them can't complete a loop
+	var loops bool
+	err = d.db.QueryRow(`
+		WITH RECURSIVE ancestors(id) AS (
+			SELECT ?1
+			UNION ALL
+			SELECT t.parent_task_id FROM tasks t JOIN ancestors a ON t.id = a.id WHERE t.parent_task_id IS NOT NULL
+		)
+		SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = ?2)`,
+		parentID, id,
+	).Scan(&loops)
+	if err != nil {
+		return err
+	}
+	if loops {
+		return fmt.Errorf("%w parent task: task %d is a subtask of task %d", ErrInvalidValue, parentID, id)
+	}
+	return nil
+}
+
+// GetSubtasks returns the direct subtasks of a task
+func (d *Database) GetSubtasks(taskID int64) ([]*Task, error) {
+	return d.queryTasks("SELECT "+taskColumns+" FROM tasks WHERE parent_task_id = ? AND deleted_at IS NULL ORDER BY id", taskID)
+}
+
+// TaskTree is a task with its subtasks. TotalSubtasks and CompletedSubtasks
+// count subtasks at any depth, and Progress is the percentage of them that
+// are completed, or 100 once the task itself is completed.
+type TaskTree struct {
+	*Task
+	Progress          int         `json:"progress"`
+	TotalSubtasks     int         `json:"total_subtasks"`
+	CompletedSubtasks int         `json:"completed_subtasks"`
+	Subtasks          []*TaskTree `json:"subtasks"`
+}
+
+// GetTaskTree returns a task with all of its subtasks nested under it
+func (d *Database) GetTaskTree(id int64) (*TaskTree, error) {
+	task, err := d.GetTask(id)
+	if err != nil {
+		return nil, err
+	}
+	descendants, err := d.queryTasks("SELECT "+taskColumns+" FROM tasks WHERE id IN ("+taskSubtree("?")+") ORDER BY id", id)
+	if err != nil {
+		return nil, err
+	}
+
+	// A subtask can have a lower ID than its parent after a move, so create
+	// every node before nesting them
+	root := &TaskTree{Task: task, Subtasks: []*TaskTree{}}
+	nodes := map[int64]*TaskTree{task.ID: root}
+	for _, t := range descendants {
+		nodes[t.ID] = &TaskTree{Task: t, Subtasks: []*TaskTree{}}
+	}
+	for _, t := range descendants {
+		parent := nodes[*t.ParentTaskID]
+		parent.Subtasks = append(parent.Subtasks, nodes[t.ID])
+	}
+	root.rollUp()
+	return root, nil
+}
+
+// rollUp fills in the subtask counts and progress of a tree
+func (t *TaskTree) rollUp() {
+	t.TotalSubtasks, t.CompletedSubtasks = 0, 0
+	for _, sub := range t.Subtasks {
+		sub.rollUp()
+		t.TotalSubtasks += 1 + sub.TotalSubtasks
+		t.CompletedSubtasks += sub.CompletedSubtasks
+		if sub.Status == "completed" {
+			t.CompletedSubtasks++
+		}
+	}
+	switch {
+	case t.Status == "completed":
+		t.Progress = 100
+	case t.TotalSubtasks > 0:
+		t.Progress = t.CompletedSubtasks * 100 / t.TotalSubtasks
+	default:
+		t.Progress = 0
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTaskTree(t *testing.T) {
+	db := newTestDatabase(t)
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	feature, _ := db.CreateTask(project.ID, nil, "Feature", "", "", "", "", "", "", "", nil, nil)
+	design, _ := db.CreateTask(project.ID, &feature.ID, "Design", "", "completed", "", "", "", "", "", nil, nil)
+	build, _ := db.CreateTask(project.ID, &feature.ID, "Build", "", "", "", "", "", "", "", nil, nil)
+	api, _ := db.CreateTask(project.ID, &build.ID, "API", "", "completed", "", "", "", "", "", nil, nil)
+	db.CreateTask(project.ID, &build.ID, "UI", "", "", "", "", "", "", "", nil, nil)
+
+	if build.ParentTaskID == nil || *build.ParentTaskID != feature.ID {
+		t.Fatalf("expected build to be a subtask of the feature, got %+v", build.ParentTaskID)
+	}
+
+	tree, err := db.GetTaskTree(feature.ID)
+	if err != nil {
+		t.Fatalf("failed to get task tree: %v", err)
+	}
+	if tree.TotalSubtasks != 4 || tree.CompletedSubtasks != 2 || tree.Progress != 50 {
+		t.Errorf("expected 2 of 4 subtasks completed, got %d of %d (%d%%)", tree.CompletedSubtasks, tree.TotalSubtasks, tree.Progress)
+	}
+	if len(tree.Subtasks) != 2 || tree.Subtasks[0].ID != design.ID || tree.Subtasks[0].Progress != 100 {
+		t.Fatalf("expected design and build under the feature, got %+v", tree.Subtasks)
+	}
+	if sub := tree.Subtasks[1]; sub.ID != build.ID || len(sub.Subtasks) != 2 || sub.Progress != 50 {
+		t.Errorf("expected build with 2 subtasks at 50%%, got %+v", sub)
+	}
+
+	// Moving a task takes its subtasks with it
+	zero := int64(0)
+	if _, err := db.UpdateTask(build.ID, nil, nil, nil, nil, nil, nil, nil, nil, &zero, nil, nil); err != nil {
+		t.Fatalf("failed to move task to the top level: %v", err)
+	}
+	tree, _ = db.GetTaskTree(build.ID)
+	if tree.ParentTaskID != nil || tree.TotalSubtasks != 2 || tree.Subtasks[0].ID != api.ID {
+		t.Errorf("expected build to be a top-level task with its subtasks, got %+v", tree)
+	}
+	if _, err := db.UpdateTask(feature.ID, nil, nil, nil, nil, nil, nil, nil, nil, &build.ID, nil, nil); err != nil {
+		t.Fatalf("failed to move task: %v", err)
+	}
+	if tree, _ = db.GetTaskTree(build.ID); tree.TotalSubtasks != 4 || tree.Subtasks[0].ID != feature.ID {
+		t.Errorf("expected the feature nested under build, got %+v", tree.Subtasks)
+	}
+}
+
+func TestTaskParentValidation(t *testing.T) {
+	db := newTestDatabase(t)
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	other, _ := db.CreateProject("Other", "", "", "", nil, nil)
+	parent, _ := db.CreateTask(project.ID, nil, "Parent", "", "", "", "", "", "", "", nil, nil)
+	child, _ := db.CreateTask(project.ID, &parent.ID, "Child", "", "", "", "", "", "", "", nil, nil)
+	grandchild, _ := db.CreateTask(project.ID, &child.ID, "Grandchild", "", "", "", "", "", "", "", nil, nil)
+
+	var mismatch *ProjectMismatchError
+	if _, err := db.CreateTask(other.ID, &parent.ID, "Elsewhere", "", "", "", "", "", "", "", nil, nil); !errors.As(err, &mismatch) {
+		t.Errorf("expected ProjectMismatchError for a parent in another project, got %v", err)
+	}
+	missing := int64(999)
+	if _, err := db.CreateTask(project.ID, &missing, "Orphan", "", "", "", "", "", "", "", nil, nil); !errors.Is(err, ErrInvalidReference) {
+		t.Errorf("expected ErrInvalidReference for a missing parent, got %v", err)
+	}
+	if _, err := db.UpdateTask(parent.ID, nil, nil, nil, nil, nil, nil, nil, nil, &parent.ID, nil, nil); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("expected ErrInvalidValue for a task under itself, got %v", err)
+	}
+	if _, err := db.UpdateTask(parent.ID, nil, nil, nil, nil, nil, nil, nil, nil, &grandchild.ID, nil, nil); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("expected ErrInvalidValue for a task under its own subtask, got %v", err)
+	}
+
+	// Simulate data written before subtasks had to share their parent's project
+	if _, err := db.db.Exec("UPDATE tasks SET project_id = ? WHERE id = ?", other.ID, grandchild.ID); err != nil {
+		t.Fatalf("failed to corrupt task: %v", err)
+	}
+	issues, err := db.CheckIntegrity()
+	if err != nil {
+		t.Fatalf("failed to check integrity: %v", err)
+	}
+	if len(issues) != 1 || issues[0].Entity != EntityTask || issues[0].ID != grandchild.ID {
+		t.Errorf("expected one subtask issue, got %+v", issues)
+	}
+}
+
+func TestDeleteTaskTrashesSubtasks(t *testing.T) {
+	db := newTestDatabase(t)
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	parent, _ := db.CreateTask(project.ID, nil, "Parent", "", "", "", "", "", "", "", nil, nil)
+	child, _ := db.CreateTask(project.ID, &parent.ID, "Child", "", "", "", "", "", "", "", nil, nil)
+	grandchild, _ := db.CreateTask(project.ID, &child.ID, "Grandchild", "", "", "", "", "", "", "", nil, nil)
+	note, _ := db.CreateTaskNote(grandchild.ID, "Deep note")
+
+	if err := db.DeleteTask(parent.ID); err != nil {
+		t.Fatalf("failed to delete task: %v", err)
+	}
+	if tasks, _ := db.ListTasks(nil, nil, nil); len(tasks) != 0 {
+		t.Errorf("expected subtasks to be trashed with their parent, got %d tasks", len(tasks))
+	}
+	if _, err := db.Restore(EntityTask, child.ID); !errors.Is(err, ErrInvalidReference) {
+		t.Errorf("expected ErrInvalidReference restoring a subtask deleted with its parent, got %v", err)
+	}
+
+	if _, err := db.Restore(EntityTask, parent.ID); err != nil {
+		t.Fatalf("failed to restore task: %v", err)
+	}
+	if _, err := db.GetTaskNote(note.ID); err != nil {
+		t.Errorf("expected the subtask's note to be restored, got %v", err)
+	}
+
+	// A subtask deleted on its own can't come back while its parent is trashed
+	db.DeleteTask(child.ID)
+	db.DeleteTask(parent.ID)
+	if _, err := db.Restore(EntityTask, child.ID); !errors.Is(err, ErrInvalidReference) {
+		t.Errorf("expected ErrInvalidReference restoring a subtask of a trashed task, got %v", err)
+	}
+	if _, err := db.Restore(EntityTask, parent.ID); err != nil {
+		t.Fatalf("failed to restore task: %v", err)
+	}
+	if tree, _ := db.GetTaskTree(parent.ID); len(tree.Subtasks) != 0 {
+		t.Errorf("expected the separately deleted subtask to stay in the trash, got %+v", tree.Subtasks)
+	}
+}
@@ -0,0 +1,847 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SyncProviders are the issue trackers a project can be linked to
+var SyncProviders = []string{"github", "jira"}
+
+// syncRemotes describe how each provider names the remote project a link
+// syncs with
+var syncRemotes = map[string]struct {
+	pattern *regexp.Regexp
+	example string
+}{
+	"github": {regexp.MustCompile(`^[A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+$`), "owner/repo"},
+	"jira":   {regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`), "a project key such as APP"},
+}
+
+// DefaultSyncInterval is how often the server syncs linked projects
+const DefaultSyncInterval = 15 * time.Minute
+
+// SyncLink links a project to a remote project in an issue tracker, such as
+// a GitHub repository, whose issues are synced as tasks. SyncedUntil is the
+// newest issue update seen, from which the next sync carries on, along with
+// the issues that failed to sync.
+type SyncLink struct {
+	ID           int64      `json:"id"`
+	ProjectID    int64      `json:"project_id"`
+	Provider     string     `json:"provider"`
+	Remote       string     `json:"remote"`
+	LastSyncedAt *time.Time `json:"last_synced_at"`
+	SyncedUntil  *time.Time `json:"synced_until"`
+	LastError    string     `json:"last_error"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// RemoteIssue is an issue as an IssueTracker reports it, with its labels or
+// fields already mapped to task values. TaskType and Priority are empty when
+// nothing maps to them, and Status is empty for trackers whose issues are
+// only open or closed, in which case Done decides. Epics are synced as
+// projects, and Epic is the ID of the epic an issue belongs to, if any.
+type RemoteIssue struct {
+	ID        string
+	Title     string
+	Body      string
+	URL       string
+	Done      bool
+	Status    string
+	TaskType  string
+	Priority  string
+	IsEpic    bool
+	Epic      string
+	Comments  []*RemoteComment
+	UpdatedAt time.Time
+}
+
+// RemoteComment is a comment on an issue, synced as a task note
+type RemoteComment struct {
+	ID        string
+	Author    string
+	Body      string
+	CreatedAt time.Time
+}
+
+// IssueTracker reads and updates the issues of a remote project, named as in
+// a SyncLink's Remote. ListIssues only returns the issues updated since a
+// time when one is given, and SetIssueStatus moves an issue to the state
+// that matches a task status.
+type IssueTracker interface {
+	ListIssues(remote string, since *time.Time) ([]*RemoteIssue, error)
+	GetIssue(remote, id string) (*RemoteIssue, error)
+	SetIssueStatus(remote, id, status string) (*RemoteIssue, error)
+	AddComment(remote, id, body string) (*RemoteComment, error)
+}
+
+// SyncResult counts what one sync of a link changed on each side, and
+// describes each change. Conflicts are issues and tasks that had both
+// changed, where the newer one won. Errors are the issues that could not be
+// synced, which don't stop the others. A dry run reports the changes a sync
+// would make without making them.
+type SyncResult struct {
+	LinkID    int64    `json:"link_id"`
+	DryRun    bool     `json:"dry_run"`
+	Projects  int      `json:"projects"`
+	Created   int      `json:"created"`
+	Updated   int      `json:"updated"`
+	Notes     int      `json:"notes"`
+	Pushed    int      `json:"pushed"`
+	Comments  int      `json:"comments"`
+	Conflicts int      `json:"conflicts"`
+	Changes   []string `json:"changes,omitempty"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// SetIssueTrackers sets the client used to reach each provider
+func (d *Database) SetIssueTrackers(trackers map[string]IssueTracker) {
+	d.trackers = trackers
+}
+
+const syncLinkColumns = "id, project_id, provider, remote, last_synced_at, synced_until, last_error, created_at, updated_at"
+
+func scanSyncLink(scan func(dest ...interface{}) error) (*SyncLink, error) {
+	var l SyncLink
+	if err := scan(&l.ID, &l.ProjectID, &l.Provider, &l.Remote, &l.LastSyncedAt, &l.SyncedUntil, &l.LastError, &l.CreatedAt, &l.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// CreateSyncLink links a project to a remote project. Each remote project
+// can only be linked to one Loom project.
+func (d *Database) CreateSyncLink(projectID int64, provider, remote string) (*SyncLink, error) {
+	if err := validateEnum("sync provider", provider, SyncProviders); err != nil {
+		return nil, err
+	}
+	remote = strings.TrimSpace(remote)
+	if r := syncRemotes[provider]; !r.pattern.MatchString(remote) {
+		return nil, fmt.Errorf("%w %s remote %q (expected %s)", ErrInvalidValue, provider, remote, r.example)
+	}
+	if _, err := d.GetProject(projectID); err != nil {
+		return nil, fmt.Errorf("%w: project with ID %d does not exist", ErrInvalidReference, projectID)
+	}
+	var existing int64
+	err := d.db.QueryRow("SELECT project_id FROM sync_links WHERE provider = ? AND remote = ?", provider, remote).Scan(&existing)
+	if err == nil {
+		return nil, fmt.Errorf("%w sync link: %s %s is already linked to project %d", ErrInvalidValue, provider, remote, existing)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	result, err := d.db.Exec("INSERT INTO sync_links (project_id, provider, remote) VALUES (?, ?, ?)", projectID, provider, remote)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return d.GetSyncLink(id)
+}
+
+// GetSyncLink returns a sync link
+func (d *Database) GetSyncLink(id int64) (*SyncLink, error) {
+	link, err := scanSyncLink(d.db.QueryRow("SELECT "+syncLinkColumns+" FROM sync_links WHERE id = ?", id).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("sync link with ID %d %w", id, ErrNotFound)
+	}
+	return link, err
+}
+
+// ListSyncLinks lists the sync links, of one project if projectID is set
+func (d *Database) ListSyncLinks(projectID *int64) ([]*SyncLink, error) {
+	query := "SELECT " + syncLinkColumns + " FROM sync_links"
+	var args []interface{}
+	if projectID != nil {
+		query += " WHERE project_id = ?"
+		args = append(args, *projectID)
+	}
+	rows, err := d.db.Query(query+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []*SyncLink
+	for rows.Next() {
+		link, err := scanSyncLink(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// DeleteSyncLink unlinks a project from its remote project. The projects and
+// tasks imported from it are kept but no longer synced.
+func (d *Database) DeleteSyncLink(id int64) error {
+	result, err := d.db.Exec("DELETE FROM sync_links WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("sync link with ID %d %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// syncedTask is the state of an issue's task as of the last sync
+type syncedTask struct {
+	taskID          int64
+	remoteUpdatedAt time.Time
+	taskUpdatedAt   time.Time
+}
+
+// syncedProject is the state of an epic's project as of the last sync
+type syncedProject struct {
+	projectID       int64
+	remoteUpdatedAt time.Time
+}
+
+// syncRun is one sync of a link. In a dry run, changes are only described.
+type syncRun struct {
+	db      *Database
+	link    *SyncLink
+	tracker IssueTracker
+	dryRun  bool
+	epics   map[string]*syncedProject
+	failed  map[string]string
+	result  *SyncResult
+}
+
+// SyncIssues syncs a linked project with its remote project, asking only
+// for the issues updated since the last sync. Epics that are new are
+// imported as projects, and issues that are new as tasks, in their epic's
+// project if it has one. For the rest, whichever side changed since the
+// last sync is copied to the other: issue titles, bodies, states and labels
+// update the task, and task status changes move the issue to the matching
+// state. When both changed, the one changed last wins. New comments are
+// added to tasks as notes, and new task notes are pushed as comments, either
+// way. Issues that fail to sync are asked for again by the next sync.
+func (d *Database) SyncIssues(linkID int64, dryRun bool) (*SyncResult, error) {
+	link, err := d.GetSyncLink(linkID)
+	if err != nil {
+		return nil, err
+	}
+	tracker := d.trackers[link.Provider]
+	if tracker == nil {
+		return nil, fmt.Errorf("%w sync provider %q: it is not configured", ErrInvalidValue, link.Provider)
+	}
+	if _, err := d.GetProject(link.ProjectID); err != nil {
+		return nil, fmt.Errorf("%w: project with ID %d does not exist", ErrInvalidReference, link.ProjectID)
+	}
+
+	issues, err := tracker.ListIssues(link.Remote, link.SyncedUntil)
+	if err != nil {
+		if !dryRun {
+			d.finishSync(link.ID, link.SyncedUntil, err.Error())
+		}
+		return nil, fmt.Errorf("failed to list %s issues of %s: %w", link.Provider, link.Remote, err)
+	}
+	tasks, err := d.syncedTasks(link.ID)
+	if err != nil {
+		return nil, err
+	}
+	epics, err := d.syncedProjects(link.ID)
+	if err != nil {
+		return nil, err
+	}
+	failures, err := d.syncFailures(link.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &syncRun{
+		db:      d.WithActor("sync:" + link.Provider),
+		link:    link,
+		tracker: tracker,
+		dryRun:  dryRun,
+		epics:   epics,
+		failed:  map[string]string{},
+		result:  &SyncResult{LinkID: link.ID, DryRun: dryRun},
+	}
+
+	syncedUntil := link.SyncedUntil
+	listed := map[string]bool{}
+	for _, issue := range issues {
+		listed[issue.ID] = true
+		if syncedUntil == nil || issue.UpdatedAt.After(*syncedUntil) {
+			updatedAt := issue.UpdatedAt.UTC()
+			syncedUntil = &updatedAt
+		}
+	}
+
+	// Issues that failed last time are tried again, even if they have not
+	// changed since
+	for _, remoteID := range failures {
+		if listed[remoteID] {
+			continue
+		}
+		issue, err := tracker.GetIssue(link.Remote, remoteID)
+		if err != nil {
+			s.try(remoteID, err)
+			continue
+		}
+		issues = append(issues, issue)
+	}
+
+	// Sync epics first, so that new issues can go in their projects
+	for _, issue := range issues {
+		if issue.IsEpic {
+			s.try(issue.ID, s.syncEpic(issue))
+		}
+	}
+	seen := map[string]bool{}
+	for _, issue := range issues {
+		if !issue.IsEpic {
+			seen[issue.ID] = true
+			s.try(issue.ID, s.syncIssue(issue, tasks[issue.ID]))
+		}
+	}
+
+	// Tasks can change without their issues changing
+	var unchanged []string
+	for remoteID := range tasks {
+		if _, failed := s.failed[remoteID]; !seen[remoteID] && !failed {
+			unchanged = append(unchanged, remoteID)
+		}
+	}
+	sort.Strings(unchanged)
+	for _, remoteID := range unchanged {
+		s.try(remoteID, s.pushTask(remoteID, tasks[remoteID]))
+	}
+
+	if dryRun {
+		return s.result, nil
+	}
+	if err := d.saveSyncFailures(link.ID, s.failed); err != nil {
+		return nil, err
+	}
+	d.finishSync(link.ID, syncedUntil, strings.Join(s.result.Errors, "; "))
+	return s.result, nil
+}
+
+// try records the error syncing an issue, if any
+func (s *syncRun) try(remoteID string, err error) {
+	if err != nil {
+		s.failed[remoteID] = err.Error()
+		s.result.Errors = append(s.result.Errors, fmt.Sprintf("issue %s: %v", remoteID, err))
+	}
+}
+
+// change describes a change the sync makes
+func (s *syncRun) change(format string, args ...interface{}) {
+	s.result.Changes = append(s.result.Changes, fmt.Sprintf(format, args...))
+}
+
+// syncEpic imports an epic as a project, or updates its project when the
+// epic changes. Epics only sync this way, so changes to their projects are
+// not pushed.
+func (s *syncRun) syncEpic(issue *RemoteIssue) error {
+	remoteUpdatedAt := issue.UpdatedAt.UTC().Truncate(time.Second)
+	status := ""
+	if issue.Done {
+		status = "completed"
+	}
+
+	state := s.epics[issue.ID]
+	if state == nil {
+		s.change("create project %q from epic %s", issue.Title, issue.ID)
+		s.result.Projects++
+		if s.dryRun {
+			return nil
+		}
+		project, err := s.db.CreateProject(issue.Title, issue.Body, status, issue.URL, nil, nil)
+		if err != nil {
+			return err
+		}
+		s.epics[issue.ID] = &syncedProject{projectID: project.ID, remoteUpdatedAt: remoteUpdatedAt}
+		_, err = s.db.db.Exec("INSERT INTO synced_projects (link_id, remote_id, project_id, remote_updated_at) VALUES (?, ?, ?, ?)",
+			s.link.ID, issue.ID, project.ID, dbTime(&remoteUpdatedAt))
+		return err
+	}
+
+	project, err := s.db.GetProject(state.projectID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The project was deleted, so the epic's new issues go in the
+		// linked project instead
+		delete(s.epics, issue.ID)
+		return nil
+	}
+	if err != nil || !remoteUpdatedAt.After(state.remoteUpdatedAt) {
+		return err
+	}
+
+	var fields []string
+	name := syncedField(&fields, "name", project.Name, issue.Title)
+	var description *string
+	if issue.Body != project.Description {
+		description = &issue.Body
+		fields = append(fields, "description")
+	}
+	externalLink := syncedField(&fields, "external link", project.ExternalLink, issue.URL)
+	var newStatus *string
+	if done := project.Status == "completed"; issue.Done != done {
+		if !issue.Done {
+			status = "active"
+		}
+		newStatus = syncedField(&fields, "status", project.Status, status)
+	}
+	if len(fields) > 0 {
+		s.change("update project %d from epic %s: %s", project.ID, issue.ID, strings.Join(fields, ", "))
+		s.result.Updated++
+		if s.dryRun {
+			return nil
+		}
+		if _, err := s.db.UpdateProject(project.ID, name, description, newStatus, externalLink, nil, nil); err != nil {
+			return err
+		}
+	}
+	if s.dryRun {
+		return nil
+	}
+	_, err = s.db.db.Exec("UPDATE synced_projects SET remote_updated_at = ? WHERE link_id = ? AND remote_id = ?", dbTime(&remoteUpdatedAt), s.link.ID, issue.ID)
+	return err
+}
+
+// syncIssue syncs one issue with its task, creating the task if the issue is
+// new. state is nil for new issues.
+func (s *syncRun) syncIssue(issue *RemoteIssue, state *syncedTask) error {
+	// Stored times have whole seconds, so compare issue times the same way
+	remoteUpdatedAt := issue.UpdatedAt.UTC().Truncate(time.Second)
+
+	if state == nil {
+		s.change("create task %q from issue %s", issue.Title, issue.ID)
+		s.result.Created++
+		if s.dryRun {
+			return s.pullComments(nil, issue)
+		}
+		task, err := s.db.CreateTask(s.projectFor(issue), nil, issue.Title, issue.Body, issueStatus(issue, ""), issue.Priority, issue.TaskType, issue.URL, "", "", nil, nil)
+		if err != nil {
+			return err
+		}
+		// Record the task before anything else can fail, so that the next
+		// sync carries on with it rather than importing the issue again
+		if err := s.db.saveSyncedTask(s.link.ID, issue.ID, task.ID, remoteUpdatedAt, task.UpdatedAt); err != nil {
+			return err
+		}
+		return s.pullComments(task, issue)
+	}
+
+	task, err := s.db.GetTask(state.taskID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The task was deleted, so the issue is no longer synced
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	remoteChanged := remoteUpdatedAt.After(state.remoteUpdatedAt)
+	localChanged := task.UpdatedAt.After(state.taskUpdatedAt)
+	if remoteChanged && localChanged {
+		s.result.Conflicts++
+		if remoteUpdatedAt.After(task.UpdatedAt) {
+			s.change("conflict on issue %s and task %d: keeping the issue's changes", issue.ID, task.ID)
+			localChanged = false
+		} else {
+			s.change("conflict on issue %s and task %d: keeping the task's changes", issue.ID, task.ID)
+			remoteChanged = false
+		}
+	}
+
+	if remoteChanged {
+		var fields []string
+		title := syncedField(&fields, "title", task.Title, issue.Title)
+		var description *string
+		if issue.Body != task.Description {
+			description = &issue.Body
+			fields = append(fields, "description")
+		}
+		status := syncedField(&fields, "status", task.Status, s.taskStatus(issue, task.Status))
+		priority := syncedField(&fields, "priority", task.Priority, issue.Priority)
+		taskType := syncedField(&fields, "type", task.TaskType, issue.TaskType)
+		externalLink := syncedField(&fields, "external link", task.ExternalLink, issue.URL)
+		if len(fields) > 0 {
+			s.change("update task %d from issue %s: %s", task.ID, issue.ID, strings.Join(fields, ", "))
+			s.result.Updated++
+			if !s.dryRun {
+				task, err = s.db.UpdateTask(task.ID, title, description, status, priority, taskType, externalLink, nil, nil, nil, nil, nil)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if localChanged && s.taskStatus(issue, task.Status) != task.Status {
+		s.change("move issue %s to %s from task %d", issue.ID, task.Status, task.ID)
+		s.result.Pushed++
+		if !s.dryRun {
+			updated, err := s.tracker.SetIssueStatus(s.link.Remote, issue.ID, task.Status)
+			if err != nil {
+				return err
+			}
+			remoteUpdatedAt = laterSecond(remoteUpdatedAt, updated.UpdatedAt)
+		}
+	}
+
+	if err := s.pullComments(task, issue); err != nil {
+		return err
+	}
+	pushedAt, err := s.pushNotes(task, issue.ID)
+	if err != nil || s.dryRun {
+		return err
+	}
+	// Comments change the issue too, so they must not look like changes
+	// made on the other side next time
+	return s.db.saveSyncedTask(s.link.ID, issue.ID, task.ID, laterSecond(remoteUpdatedAt, pushedAt), task.UpdatedAt)
+}
+
+// pushTask syncs a task whose issue has not changed since the last sync, if
+// the task has changed or has notes to push
+func (s *syncRun) pushTask(remoteID string, state *syncedTask) error {
+	task, err := s.db.GetTask(state.taskID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	notes, err := s.db.unpushedNotes(task.ID)
+	if err != nil {
+		return err
+	}
+	if !task.UpdatedAt.After(state.taskUpdatedAt) && len(notes) == 0 {
+		return nil
+	}
+	issue, err := s.tracker.GetIssue(s.link.Remote, remoteID)
+	if err != nil {
+		return err
+	}
+	return s.syncIssue(issue, state)
+}
+
+// projectFor returns the project a new issue's task goes in: its epic's
+// project, or else the linked project
+func (s *syncRun) projectFor(issue *RemoteIssue) int64 {
+	if epic := s.epics[issue.Epic]; epic != nil {
+		if _, err := s.db.GetProject(epic.projectID); err == nil {
+			return epic.projectID
+		}
+	}
+	return s.link.ProjectID
+}
+
+// pullComments adds the issue's comments that are not notes yet to the task
+// as notes. task is nil for a new issue in a dry run.
+func (s *syncRun) pullComments(task *Task, issue *RemoteIssue) error {
+	for _, c := range issue.Comments {
+		if task != nil {
+			var exists bool
+			err := s.db.db.QueryRow(`
+				SELECT EXISTS (SELECT 1 FROM synced_notes s JOIN task_notes n ON n.id = s.note_id WHERE n.task_id = ? AND s.remote_id = ?)`,
+				task.ID, c.ID,
+			).Scan(&exists)
+			if err != nil {
+				return err
+			}
+			if exists {
+				continue
+			}
+		}
+
+		s.change("add comment %s on issue %s as a note", c.ID, issue.ID)
+		s.result.Notes++
+		if s.dryRun {
+			continue
+		}
+		text := c.Body
+		if c.Author != "" {
+			text = c.Author + ": " + c.Body
+		}
+		note, err := s.db.CreateTaskNote(task.ID, text)
+		if err != nil {
+			return err
+		}
+		if _, err := s.db.db.Exec("INSERT INTO synced_notes (note_id, remote_id) VALUES (?, ?)", note.ID, c.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pushNotes adds the task's notes that have not been synced yet to the
+// issue as comments, oldest first, returning when the last one was added
+func (s *syncRun) pushNotes(task *Task, issueID string) (time.Time, error) {
+	notes, err := s.db.unpushedNotes(task.ID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var pushedAt time.Time
+	for _, n := range notes {
+		s.change("add note %d on task %d as a comment on issue %s", n.ID, task.ID, issueID)
+		s.result.Comments++
+		if s.dryRun {
+			continue
+		}
+		comment, err := s.tracker.AddComment(s.link.Remote, issueID, n.Note)
+		if err != nil {
+			return pushedAt, err
+		}
+		if _, err := s.db.db.Exec("INSERT INTO synced_notes (note_id, remote_id) VALUES (?, ?)", n.ID, comment.ID); err != nil {
+			return pushedAt, err
+		}
+		pushedAt = comment.CreatedAt
+	}
+	return pushedAt, nil
+}
+
+// unpushedNotes returns the task's notes that have not been synced either
+// way, oldest first
+func (d *Database) unpushedNotes(taskID int64) ([]*TaskNote, error) {
+	rows, err := d.db.Query(`
+		SELECT id, note FROM task_notes
+		WHERE task_id = ? AND deleted_at IS NULL AND id NOT IN (SELECT note_id FROM synced_notes)
+		ORDER BY id`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notes []*TaskNote
+	for rows.Next() {
+		n := TaskNote{TaskID: taskID}
+		if err := rows.Scan(&n.ID, &n.Note); err != nil {
+			return nil, err
+		}
+		notes = append(notes, &n)
+	}
+	return notes, rows.Err()
+}
+
+// issueStatus returns the status a task whose status is current should have
+// to match an issue: the status the issue maps to if the tracker knows one,
+// or else completed for done issues and in_progress for reopened ones
+func issueStatus(issue *RemoteIssue, current string) string {
+	switch {
+	case issue.Status != "":
+		return issue.Status
+	case issue.Done && current != "completed":
+		return "completed"
+	case !issue.Done && current == "completed":
+		return "in_progress"
+	}
+	return current
+}
+
+// taskStatus returns the status a task whose status is current should move
+// to, to match an issue. When the workflow does not allow the status the
+// issue maps to, such as pending for a reopened issue whose task is
+// completed, it is the first status the workflow does allow that is done, or
+// not, as the issue is.
+func (s *syncRun) taskStatus(issue *RemoteIssue, current string) string {
+	status := issueStatus(issue, current)
+	if s.db.checkTransition(EntityTask, current, status) == nil {
+		return status
+	}
+	for _, to := range s.db.workflows[EntityTask][current] {
+		if (to == "completed") == issue.Done {
+			return to
+		}
+	}
+	return status
+}
+
+// syncedField returns the value to update a field to, adding its name to
+// fields, or nil if the remote value is empty or unchanged
+func syncedField(fields *[]string, name, current, value string) *string {
+	if value == "" || value == current {
+		return nil
+	}
+	*fields = append(*fields, name)
+	return &value
+}
+
+// laterSecond returns the later of a and b, to the second
+func laterSecond(a, b time.Time) time.Time {
+	b = b.UTC().Truncate(time.Second)
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+// syncedTasks returns the state of each synced issue of a link as of the
+// last sync, keyed by issue
+func (d *Database) syncedTasks(linkID int64) (map[string]*syncedTask, error) {
+	rows, err := d.db.Query("SELECT remote_id, task_id, remote_updated_at, task_updated_at FROM synced_tasks WHERE link_id = ?", linkID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	synced := map[string]*syncedTask{}
+	for rows.Next() {
+		var remoteID string
+		var s syncedTask
+		if err := rows.Scan(&remoteID, &s.taskID, &s.remoteUpdatedAt, &s.taskUpdatedAt); err != nil {
+			return nil, err
+		}
+		synced[remoteID] = &s
+	}
+	return synced, rows.Err()
+}
+
+// syncedProjects returns the project each synced epic of a link was
+// imported as, keyed by epic
+func (d *Database) syncedProjects(linkID int64) (map[string]*syncedProject, error) {
+	rows, err := d.db.Query("SELECT remote_id, project_id, remote_updated_at FROM synced_projects WHERE link_id = ?", linkID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	synced := map[string]*syncedProject{}
+	for rows.Next() {
+		var remoteID string
+		var s syncedProject
+		if err := rows.Scan(&remoteID, &s.projectID, &s.remoteUpdatedAt); err != nil {
+			return nil, err
+		}
+		synced[remoteID] = &s
+	}
+	return synced, rows.Err()
+}
+
+// syncFailures returns the issues a link failed to sync last time
+func (d *Database) syncFailures(linkID int64) ([]string, error) {
+	rows, err := d.db.Query("SELECT remote_id FROM sync_failures WHERE link_id = ? ORDER BY remote_id", linkID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var remoteIDs []string
+	for rows.Next() {
+		var remoteID string
+		if err := rows.Scan(&remoteID); err != nil {
+			return nil, err
+		}
+		remoteIDs = append(remoteIDs, remoteID)
+	}
+	return remoteIDs, rows.Err()
+}
+
+// saveSyncFailures replaces the issues a link failed to sync with those of
+// this sync, and their errors
+func (d *Database) saveSyncFailures(linkID int64, failures map[string]string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM sync_failures WHERE link_id = ?", linkID); err != nil {
+		return err
+	}
+	for remoteID, syncErr := range failures {
+		if _, err := tx.Exec("INSERT INTO sync_failures (link_id, remote_id, error) VALUES (?, ?, ?)", linkID, remoteID, syncErr); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// saveSyncedTask records when an issue and its task last changed as of this
+// sync
+func (d *Database) saveSyncedTask(linkID int64, remoteID string, taskID int64, remoteUpdatedAt, taskUpdatedAt time.Time) error {
+	_, err := d.db.Exec(`
+		INSERT INTO synced_tasks (link_id, remote_id, task_id, remote_updated_at, task_updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (link_id, remote_id) DO UPDATE SET remote_updated_at = excluded.remote_updated_at, task_updated_at = excluded.task_updated_at`,
+		linkID, remoteID, taskID, dbTime(&remoteUpdatedAt), dbTime(&taskUpdatedAt),
+	)
+	return err
+}
+
+// finishSync records when a link was synced, how far, and what went wrong,
+// if anything
+func (d *Database) finishSync(linkID int64, syncedUntil *time.Time, syncErr string) {
+	_, err := d.db.Exec("UPDATE sync_links SET last_synced_at = CURRENT_TIMESTAMP, synced_until = ?, last_error = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		dbTime(syncedUntil), syncErr, linkID)
+	if err != nil {
+		log.Printf("Failed to record sync of link %d: %v", linkID, err)
+	}
+}
+
+// SyncAllIssues syncs every linked project, carrying on past links that fail
+func (d *Database) SyncAllIssues(dryRun bool) ([]*SyncResult, error) {
+	links, err := d.ListSyncLinks(nil)
+	if err != nil {
+		return nil, err
+	}
+	var results []*SyncResult
+	var errs []error
+	for _, link := range links {
+		result, err := d.SyncIssues(link.ID, dryRun)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sync link %d: %w", link.ID, err))
+			continue
+		}
+		results = append(results, result)
+	}
+	return results, errors.Join(errs...)
+}
+
+// StartSyncScheduler syncs every linked project now and then every interval,
+// until the returned function is called. It does nothing when the interval
+// is zero.
+func (d *Database) StartSyncScheduler(interval time.Duration) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+
+	sync := func() {
+		results, err := d.SyncAllIssues(false)
+		if err != nil {
+			log.Printf("Failed to sync issues: %v", err)
+		}
+		for _, r := range results {
+			if len(r.Changes) > 0 || len(r.Errors) > 0 {
+				log.Printf("Synced link %d: %d changes, %d conflicts, %d errors", r.LinkID, len(r.Changes), r.Conflicts, len(r.Errors))
+			}
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		sync()
+		for {
+			select {
+			case <-ticker.C:
+				sync()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeGitHub serves the parts of the GitHub issues API that sync uses, for
+// the acme/app repository
+type fakeGitHub struct {
+	mu       sync.Mutex
+	issues   []map[string]interface{}
+	comments []string
+	now      time.Time
+	fail     bool
+}
+
+func newFakeGitHub(t *testing.T) (*fakeGitHub, *httptest.Server) {
+	t.Helper()
+	gh := &fakeGitHub{now: time.Now().UTC().Truncate(time.Second)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/acme/app/issues", func(w http.ResponseWriter, r *http.Request) {
+		gh.mu.Lock()
+		defer gh.mu.Unlock()
+		if gh.fail {
+			w.WriteHeader(http.StatusBadGateway)
+			json.NewEncoder(w).Encode(map[string]string{"message": "Server Error"})
+			return
+		}
+		if r.URL.Query().Get("page") != "1" {
+			json.NewEncoder(w).Encode([]interface{}{})
+			return
+		}
+		json.NewEncoder(w).Encode(gh.issues)
+	})
+	mux.HandleFunc("GET /repos/acme/app/issues/{number}", func(w http.ResponseWriter, r *http.Request) {
+		gh.mu.Lock()
+		defer gh.mu.Unlock()
+		json.NewEncoder(w).Encode(gh.issue(r.PathValue("number")))
+	})
+	mux.HandleFunc("PATCH /repos/acme/app/issues/{number}", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		gh.mu.Lock()
+		defer gh.mu.Unlock()
+		issue := gh.issue(r.PathValue("number"))
+		issue["state"] = req["state"]
+		issue["updated_at"] = gh.now
+		json.NewEncoder(w).Encode(issue)
+	})
+	mux.HandleFunc("POST /repos/acme/app/issues/{number}/comments", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		gh.mu.Lock()
+		defer gh.mu.Unlock()
+		gh.comments = append(gh.comments, r.PathValue("number")+": "+req["body"])
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": 1000 + len(gh.comments), "body": req["body"], "created_at": gh.now})
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer gh_test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"message": "Bad credentials"})
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return gh, srv
+}
+
+func (gh *fakeGitHub) add(number int, title, state string, labels ...string) {
+	var l []map[string]string
+	for _, name := range labels {
+		l = append(l, map[string]string{"name": name})
+	}
+	gh.issues = append(gh.issues, map[string]interface{}{
+		"number":     number,
+		"title":      title,
+		"body":       "Body of " + title,
+		"state":      state,
+		"html_url":   fmt.Sprintf("https://github.com/acme/app/issues/%d", number),
+		"updated_at": gh.now,
+		"labels":     l,
+	})
+}
+
+// update changes an issue as if someone edited it on GitHub at time at
+func (gh *fakeGitHub) update(number int, at time.Time, fields map[string]interface{}) {
+	gh.mu.Lock()
+	defer gh.mu.Unlock()
+	issue := gh.issue(fmt.Sprint(number))
+	for k, v := range fields {
+		issue[k] = v
+	}
+	issue["updated_at"] = at
+}
+
+func (gh *fakeGitHub) issue(number string) map[string]interface{} {
+	for _, issue := range gh.issues {
+		if fmt.Sprint(issue["number"]) == number {
+			return issue
+		}
+	}
+	return nil
+}
+
+func (gh *fakeGitHub) state(number int) string {
+	gh.mu.Lock()
+	defer gh.mu.Unlock()
+	return gh.issue(fmt.Sprint(number))["state"].(string)
+}
+
+// touchTask makes a task look changed at time at, since updated_at only
+// has whole seconds
+func touchTask(t *testing.T, db *Database, id int64, at time.Time) {
+	t.Helper()
+	if _, err := db.db.Exec("UPDATE tasks SET updated_at = ? WHERE id = ?", dbTime(&at), id); err != nil {
+		t.Fatalf("failed to touch task: %v", err)
+	}
+}
+
+func syncedTaskID(t *testing.T, db *Database, remoteID string) int64 {
+	t.Helper()
+	var id int64
+	if err := db.db.QueryRow("SELECT task_id FROM synced_tasks WHERE remote_id = ?", remoteID).Scan(&id); err != nil {
+		t.Fatalf("issue %s has no task: %v", remoteID, err)
+	}
+	return id
+}
+
+func TestSyncLinks(t *testing.T) {
+	db := newTestDatabase(t)
+	project, _ := db.CreateProject("App", "", "", "", nil, nil)
+
+	link, err := db.CreateSyncLink(project.ID, "github", " acme/app ")
+	if err != nil {
+		t.Fatalf("failed to create sync link: %v", err)
+	}
+	if link.Remote != "acme/app" || link.LastSyncedAt != nil {
+		t.Errorf("expected a new link to acme/app, got %+v", link)
+	}
+
+	for _, c := range []struct {
+		projectID        int64
+		provider, remote string
+		want             string
+	}{
+		{project.ID, "gitlab", "acme/app", "invalid sync provider"},
+		{project.ID, "github", "acme", "expected owner/repo"},
+		{project.ID, "github", "acme/app/issues", "expected owner/repo"},
+		{999, "github", "acme/other", "project with ID 999 does not exist"},
+		{project.ID, "github", "acme/app", "already linked to project"},
+	} {
+		if _, err := db.CreateSyncLink(c.projectID, c.provider, c.remote); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s %s: expected an error containing %q, got %v", c.provider, c.remote, c.want, err)
+		}
+	}
+
+	links, _ := db.ListSyncLinks(&project.ID)
+	if len(links) != 1 || links[0].ID != link.ID {
+		t.Errorf("expected the project's link, got %+v", links)
+	}
+	if _, err := db.SyncIssues(link.ID, false); err == nil || !strings.Contains(err.Error(), "not configured") {
+		t.Errorf("expected syncing without a GitHub client to fail, got %v", err)
+	}
+	if err := db.DeleteSyncLink(link.ID); err != nil {
+		t.Fatalf("failed to delete sync link: %v", err)
+	}
+	if _, err := db.GetSyncLink(link.ID); err == nil {
+		t.Error("expected the link to be gone")
+	}
+	if err := db.DeleteSyncLink(link.ID); err == nil {
+		t.Error("expected deleting a missing link to fail")
+	}
+}
+
+func TestSyncGitHubIssues(t *testing.T) {
+	db := newTestDatabase(t)
+	gh, srv := newFakeGitHub(t)
+	db.SetIssueTrackers(map[string]IssueTracker{"github": NewGitHubClient(srv.URL, "gh_test")})
+
+	project, _ := db.CreateProject("App", "", "", "", nil, nil)
+	link, _ := db.CreateSyncLink(project.ID, "github", "acme/app")
+	gh.add(1, "Login fails", "open", "bug", "Priority: High")
+	gh.add(2, "Add export", "closed", "enhancement")
+	gh.add(3, "Bump deps", "open", "type/chore", "p3")
+	gh.issues = append(gh.issues, map[string]interface{}{"number": 4, "title": "A pull request", "state": "open", "pull_request": map[string]string{}, "updated_at": gh.now})
+
+	// New issues are imported, with their labels mapped
+	result, err := db.SyncIssues(link.ID, false)
+	if err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+	if result.Created != 3 || len(result.Errors) != 0 {
+		t.Fatalf("expected 3 issues to be imported, got %+v", result)
+	}
+	login, _ := db.GetTask(syncedTaskID(t, db, "1"))
+	export, _ := db.GetTask(syncedTaskID(t, db, "2"))
+	deps, _ := db.GetTask(syncedTaskID(t, db, "3"))
+	if login.Title != "Login fails" || login.Description != "Body of Login fails" || login.TaskType != "bugfix" || login.Priority != "high" || login.Status != "pending" || login.ExternalLink != "https://github.com/acme/app/issues/1" {
+		t.Errorf("expected the issue's fields, got %+v", login)
+	}
+	if export.TaskType != "feature" || export.Status != "completed" || deps.TaskType != "chore" || deps.Priority != "low" {
+		t.Errorf("expected mapped labels and state, got %+v, %+v", export, deps)
+	}
+	link, _ = db.GetSyncLink(link.ID)
+	if link.LastSyncedAt == nil || link.LastError != "" {
+		t.Errorf("expected the sync to be recorded, got %+v", link)
+	}
+
+	// Nothing changed, so nothing happens
+	if result, _ := db.SyncIssues(link.ID, false); result.Created+result.Updated+result.Pushed+result.Comments != 0 {
+		t.Errorf("expected an idle sync, got %+v", result)
+	}
+
+	// Issue changes update their tasks
+	gh.update(1, gh.now.Add(time.Hour), map[string]interface{}{"title": "Login fails on Safari", "state": "closed"})
+	result, _ = db.SyncIssues(link.ID, false)
+	login, _ = db.GetTask(login.ID)
+	if result.Updated != 1 || login.Title != "Login fails on Safari" || login.Status != "completed" {
+		t.Errorf("expected the issue change to update the task, got %+v, %+v", result, login)
+	}
+
+	// Task changes and new notes are pushed back
+	inProgress, urgent, completed := "in_progress", "urgent", "completed"
+	if _, err := db.UpdateTask(export.ID, nil, nil, &inProgress, nil, nil, nil, nil, nil, nil, nil, nil); err != nil {
+		t.Fatalf("failed to reopen task: %v", err)
+	}
+	touchTask(t, db, export.ID, time.Now().Add(time.Minute))
+	db.CreateTaskNote(export.ID, "Started on the CSV part")
+	result, _ = db.SyncIssues(link.ID, false)
+	if result.Pushed != 1 || result.Comments != 1 || gh.state(2) != "open" {
+		t.Errorf("expected the issue to be reopened with a comment, got %+v, %s", result, gh.state(2))
+	}
+	if len(gh.comments) != 1 || gh.comments[0] != "2: Started on the CSV part" {
+		t.Errorf("expected the note as a comment, got %v", gh.comments)
+	}
+	if result, _ := db.SyncIssues(link.ID, false); result.Pushed+result.Comments+result.Updated != 0 {
+		t.Errorf("expected pushed changes not to be pushed again, got %+v", result)
+	}
+
+	// When both changed, the newer change wins
+	db.UpdateTask(login.ID, nil, nil, nil, &urgent, nil, nil, nil, nil, nil, nil, nil)
+	touchTask(t, db, login.ID, time.Now().Add(time.Hour))
+	gh.update(1, time.Now().Add(2*time.Hour), map[string]interface{}{"state": "open"})
+	result, _ = db.SyncIssues(link.ID, false)
+	login, _ = db.GetTask(login.ID)
+	if result.Conflicts != 1 || login.Status != "in_progress" {
+		t.Errorf("expected the newer issue change to win, got %+v, %+v", result, login)
+	}
+
+	db.UpdateTask(login.ID, nil, nil, &completed, nil, nil, nil, nil, nil, nil, nil, nil)
+	touchTask(t, db, login.ID, time.Now().Add(4*time.Hour))
+	gh.update(1, time.Now().Add(3*time.Hour), map[string]interface{}{"title": "Login fails everywhere"})
+	result, _ = db.SyncIssues(link.ID, false)
+	login, _ = db.GetTask(login.ID)
+	if result.Conflicts != 1 || result.Pushed != 1 || gh.state(1) != "closed" || login.Title != "Login fails on Safari" {
+		t.Errorf("expected the newer task change to win, got %+v, %+v, %s", result, login, gh.state(1))
+	}
+
+	// Deleted tasks are not imported again
+	if err := db.DeleteTask(deps.ID); err != nil {
+		t.Fatalf("failed to delete task: %v", err)
+	}
+	if result, _ := db.SyncIssues(link.ID, false); result.Created != 0 {
+		t.Errorf("expected the deleted task's issue not to be imported again, got %+v", result)
+	}
+
+	// Failures are recorded on the link
+	gh.fail = true
+	if _, err := db.SyncIssues(link.ID, false); err == nil || !strings.Contains(err.Error(), "Server Error") {
+		t.Errorf("expected the sync to fail, got %v", err)
+	}
+	link, _ = db.GetSyncLink(link.ID)
+	if !strings.Contains(link.LastError, "502") {
+		t.Errorf("expected the failure on the link, got %q", link.LastError)
+	}
+}
+
+func TestSyncCommands(t *testing.T) {
+	_, srv := newFakeGitHub(t)
+	dbPath := filepath.Join(t.TempDir(), "loom.db")
+	db, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	project, _ := db.CreateProject("App", "", "", "", nil, nil)
+	db.Close()
+
+	cfg := DefaultConfig()
+	cfg.DBPath = dbPath
+	cfg.GitHub.APIURL = srv.URL
+	cfg.GitHub.Token = "gh_test"
+
+	var out bytes.Buffer
+	if err := runCommand(cfg, []string{"sync", "link", "-project", fmt.Sprint(project.ID), "github", "acme/app"}, &out); err != nil {
+		t.Fatalf("sync link failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "as sync link 1") {
+		t.Errorf("expected the new link, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := runCommand(cfg, []string{"sync", "run"}, &out); err != nil {
+		t.Fatalf("sync run failed: %v", err)
+	}
+	out.Reset()
+	if err := runCommand(cfg, []string{"sync", "list"}, &out); err != nil {
+		t.Fatalf("sync list failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "acme/app") || strings.Contains(out.String(), "never") {
+		t.Errorf("expected the synced link, got:\n%s", out.String())
+	}
+
+	cfg.GitHub.Token = "wrong"
+	if err := runCommand(cfg, []string{"sync", "run", "1"}, &out); err == nil || !strings.Contains(err.Error(), "Bad credentials") {
+		t.Errorf("expected a bad token to fail, got %v", err)
+	}
+	out.Reset()
+	if err := runCommand(cfg, []string{"sync", "unlink", "1"}, &out); err != nil || !strings.Contains(out.String(), "Removed sync link 1") {
+		t.Errorf("sync unlink failed: %v\n%s", err, out.String())
+	}
+	if err := runCommand(cfg, []string{"sync", "link", "github", "acme/app"}, &out); err == nil || !strings.Contains(err.Error(), "usage") {
+		t.Errorf("expected a link without a project to fail, got %v", err)
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxTagLength is the longest tag name, in characters
+const maxTagLength = 50
+
+// TagEntities are the entity types that can be tagged
+var TagEntities = []string{EntityProject, EntityTask, EntityProblem, EntityOutcome, EntityGoal}
+
+// TagMatches are the ways a list can match several tags: items with all of
+// them, or with any of them
+var TagMatches = []string{"all", "any"}
+
+var tagColorPattern = regexp.MustCompile(`^#[0-9a-f]{6}$`)
+
+// Tag is a label that can be put on projects, tasks, problems, outcomes and
+// goals. Names are lower case and unique. Items counts the live items with
+// the tag.
+type Tag struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Color     string    `json:"color"`
+	Items     int       `json:"items"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NormalizeTag returns the stored form of a tag name: trimmed, lower case
+// and with runs of spaces collapsed. Commas and | separate tags in filters,
+// so names can't contain them.
+func NormalizeTag(name string) (string, error) {
+	tag := strings.Join(strings.Fields(strings.ToLower(name)), " ")
+	switch {
+	case tag == "":
+		return "", fmt.Errorf("%w tag: name is required", ErrInvalidValue)
+	case len([]rune(tag)) > maxTagLength:
+		return "", fmt.Errorf("%w tag %q: names are at most %d characters", ErrInvalidValue, name, maxTagLength)
+	case strings.ContainsAny(tag, ",|"):
+		return "", fmt.Errorf("%w tag %q: names can't contain , or |", ErrInvalidValue, name)
+	}
+	return tag, nil
+}
+
+// normalizeTagColor validates a colour given as #rrggbb. An empty colour is
+// allowed and leaves the choice to the client.
+func normalizeTagColor(color string) (string, error) {
+	color = strings.ToLower(strings.TrimSpace(color))
+	if color != "" && !tagColorPattern.MatchString(color) {
+		return "", fmt.Errorf("%w tag color %q (expected a hex colour such as #3b82f6)", ErrInvalidValue, color)
+	}
+	return color, nil
+}
+
+// tagColumn selects the names of the tags on an item, where ref is the
+// item's ID column. It is read with a tagList.
+func tagColumn(entity, ref string) string {
+	t := tagTables[entity]
+	return fmt.Sprintf("(SELECT GROUP_CONCAT(tags.name) FROM %s x JOIN tags ON tags.id = x.tag_id WHERE x.%s = %s)", t.table, t.column, ref)
+}
+
+// tagList scans a tagColumn into sorted tag names
+type tagList []string
+
+func (l *tagList) Scan(src interface{}) error {
+	*l = tagList{}
+	var s string
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("unexpected tag list %T", src)
+	}
+	*l = strings.Split(s, ",")
+	sort.Strings(*l)
+	return nil
+}
+
+// TagFilter restricts a list to items with the given tags: all of them, or
+// any of them when Any is set
+type TagFilter struct {
+	Tags []string
+	Any  bool
+}
+
+// ParseTagFilter builds a TagFilter from comma-separated tag names and a
+// match of "all" (the default) or "any". Names separated by | match any of
+// them.
+func ParseTagFilter(tags, match string) (TagFilter, error) {
+	var f TagFilter
+	if match != "" {
+		if err := validateEnum("tag match", match, TagMatches); err != nil {
+			return f, err
+		}
+		f.Any = match == "any"
+	}
+	sep := ","
+	if strings.Contains(tags, "|") {
+		if strings.Contains(tags, ",") {
+			return f, fmt.Errorf("%w tag filter %q: use either , or | between tags", ErrInvalidValue, tags)
+		}
+		sep, f.Any = "|", true
+	}
+	for _, name := range strings.Split(tags, sep) {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		tag, err := NormalizeTag(name)
+		if err != nil {
+			return f, err
+		}
+		f.Tags = append(f.Tags, tag)
+	}
+	return f, nil
+}
+
+// apply adds the filter's conditions to a query over entity's table
+func (f TagFilter) apply(q *listQuery, entity string) {
+	if len(f.Tags) == 0 {
+		return
+	}
+	t := tagTables[entity]
+	tagged := func(names []string) {
+		q.where = append(q.where, fmt.Sprintf("id IN (SELECT x.%s FROM %s x JOIN tags ON tags.id = x.tag_id WHERE tags.name IN (?%s))",
+			t.column, t.table, strings.Repeat(", ?", len(names)-1)))
+		for _, name := range names {
+			q.args = append(q.args, name)
+		}
+	}
+	if f.Any {
+		tagged(f.Tags)
+		return
+	}
+	for _, name := range f.Tags {
+		tagged([]string{name})
+	}
+}
+
+// tagSelect selects tags with a count of the live items carrying them
+var tagSelect = func() string {
+	counts := make([]string, 0, len(TagEntities))
+	for _, entity := range TagEntities {
+		t := tagTables[entity]
+		counts = append(counts, fmt.Sprintf("(SELECT COUNT(*) FROM %s x JOIN %s i ON i.id = x.%s WHERE x.tag_id = tags.id AND i.deleted_at IS NULL)", t.table, t.items, t.column))
+	}
+	return "SELECT id, name, color, " + strings.Join(counts, " + ") + ", created_at, updated_at FROM tags"
+}()
+
+func scanTag(scan func(dest ...interface{}) error) (*Tag, error) {
+	var t Tag
+	if err := scan(&t.ID, &t.Name, &t.Color, &t.Items, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// GetTag returns a tag by name
+func (d *Database) GetTag(name string) (*Tag, error) {
+	tag, err := NormalizeTag(name)
+	if err != nil {
+		return nil, err
+	}
+	t, err := scanTag(d.db.QueryRow(tagSelect+" WHERE name = ?", tag).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("tag %q %w", tag, ErrNotFound)
+	}
+	return t, err
+}
+
+// ListTags returns the tags in use, by name. A non-nil entity returns only
+// the tags on live items of that type.
+func (d *Database) ListTags(entity *string) ([]*Tag, error) {
+	query := tagSelect
+	if entity != nil {
+		if err := validateEnum("entity", *entity, TagEntities); err != nil {
+			return nil, err
+		}
+		t := tagTables[*entity]
+		query += fmt.Sprintf(" WHERE id IN (SELECT x.tag_id FROM %s x JOIN %s i ON i.id = x.%s WHERE i.deleted_at IS NULL)", t.table, t.items, t.column)
+	}
+	rows, err := d.db.Query(query + " ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*Tag{}
+	for rows.Next() {
+		t, err := scanTag(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// TagItem puts a tag on a project, task, problem, outcome or goal, creating
+// the tag if it is new. A non-empty color sets the tag's colour. Tagging an
+// item twice is a no-op.
+func (d *Database) TagItem(entity string, id int64, name, color string) (*Tag, error) {
+	if err := validateEnum("entity", entity, TagEntities); err != nil {
+		return nil, err
+	}
+	tag, err := NormalizeTag(name)
+	if err != nil {
+		return nil, err
+	}
+	if color, err = normalizeTagColor(color); err != nil {
+		return nil, err
+	}
+	before, err := d.getTaggedItem(entity, id)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := d.GetTag(tag)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	switch {
+	case existing == nil:
+		_, err = tx.Exec("INSERT INTO tags (name, color) VALUES (?, ?)", tag, color)
+	case color != "" && color != existing.Color:
+		_, err = tx.Exec("UPDATE tags SET color = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", color, existing.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	t := tagTables[entity]
+	result, err := tx.Exec(fmt.Sprintf("INSERT OR IGNORE INTO %s (%s, tag_id) SELECT ?, id FROM tags WHERE name = ?", t.table, t.column), id, tag)
+	if err != nil {
+		return nil, err
+	}
+	tagged, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if tagged > 0 {
+		if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", t.items), id); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	after, err := d.GetTag(tag)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		d.publish(ActionCreated, EntityTag, after.ID, nil, after)
+	} else if after.Color != existing.Color {
+		d.publish(ActionUpdated, EntityTag, after.ID, existing, after)
+	}
+	if tagged > 0 {
+		d.publishTaggedItem(entity, id, before)
+	}
+	return after, nil
+}
+
+// UntagItem removes a tag from an item. The tag itself is kept, with its
+// colour, for other items and later use.
+func (d *Database) UntagItem(entity string, id int64, name string) error {
+	if err := validateEnum("entity", entity, TagEntities); err != nil {
+		return err
+	}
+	tag, err := NormalizeTag(name)
+	if err != nil {
+		return err
+	}
+	before, err := d.getTaggedItem(entity, id)
+	if err != nil {
+		return err
+	}
+
+	t := tagTables[entity]
+	result, err := d.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s = ? AND tag_id = (SELECT id FROM tags WHERE name = ?)", t.table, t.column), id, tag)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("tag %q on %s %d %w", tag, entityName(entity), id, ErrNotFound)
+	}
+	if _, err := d.db.Exec(fmt.Sprintf("UPDATE %s SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", t.items), id); err != nil {
+		return err
+	}
+	d.publishTaggedItem(entity, id, before)
+	return nil
+}
+
+// getTaggedItem returns a live item that can be tagged
+func (d *Database) getTaggedItem(entity string, id int64) (interface{}, error) {
+	item, err := d.getItem(entity, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%s with ID %d %w", entityName(entity), id, ErrNotFound)
+	}
+	return item, err
+}
+
+// publishTaggedItem sends an update event for an item whose tags changed
+func (d *Database) publishTaggedItem(entity string, id int64, before interface{}) {
+	if after, err := d.getItem(entity, id); err == nil {
+		d.publish(ActionUpdated, entity, id, before, after)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTagItems(t *testing.T) {
+	db := newTestDatabase(t)
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	api, _ := db.CreateTask(project.ID, nil, "API", "", "", "", "", "", "", "", nil, nil)
+	ui, _ := db.CreateTask(project.ID, nil, "UI", "", "", "", "", "", "", "", nil, nil)
+	docs, _ := db.CreateTask(project.ID, nil, "Docs", "", "", "", "", "", "", "", nil, nil)
+	problem, _ := db.CreateProblem(&project.ID, nil, "Flaky build", "", "", "")
+
+	tag, err := db.TagItem(EntityTask, api.ID, "  Backend ", "#3B82F6")
+	if err != nil {
+		t.Fatalf("failed to tag task: %v", err)
+	}
+	if tag.Name != "backend" || tag.Color != "#3b82f6" || tag.Items != 1 {
+		t.Errorf("expected a normalised tag on one item, got %+v", tag)
+	}
+	db.TagItem(EntityTask, api.ID, "urgent", "")
+	db.TagItem(EntityTask, ui.ID, "urgent", "")
+	db.TagItem(EntityProblem, problem.ID, "backend", "")
+
+	// Tagging twice is a no-op, and an empty colour keeps the current one
+	if tag, err = db.TagItem(EntityTask, api.ID, "backend", ""); err != nil || tag.Color != "#3b82f6" {
+		t.Errorf("expected tagging twice to keep the colour, got %+v, %v", tag, err)
+	}
+	loaded, _ := db.GetTask(api.ID)
+	if len(loaded.Tags) != 2 || loaded.Tags[0] != "backend" || loaded.Tags[1] != "urgent" {
+		t.Errorf("expected the task's tags in order, got %v", loaded.Tags)
+	}
+	if loaded, _ := db.GetTask(docs.ID); loaded.Tags == nil || len(loaded.Tags) != 0 {
+		t.Errorf("expected an empty tag list, got %#v", loaded.Tags)
+	}
+
+	tests := []struct {
+		tags  string
+		match string
+		want  []int64
+	}{
+		{"backend", "", []int64{api.ID}},
+		{"backend,urgent", "", []int64{api.ID}},
+		{"backend,urgent", "any", []int64{api.ID, ui.ID}},
+		{"backend|urgent", "", []int64{api.ID, ui.ID}},
+		{"unknown", "", nil},
+	}
+	for _, tt := range tests {
+		filter, err := ParseTagFilter(tt.tags, tt.match)
+		if err != nil {
+			t.Fatalf("ParseTagFilter(%q, %q): %v", tt.tags, tt.match, err)
+		}
+		tasks, page, err := db.ListTasksPage(nil, nil, nil, nil, nil, DueFilter{}, filter, ListOptions{Sort: "id", Order: "asc"})
+		if err != nil {
+			t.Fatalf("failed to list tasks: %v", err)
+		}
+		if page.Total != len(tt.want) {
+			t.Errorf("%s (%s): expected %d tasks, got %d", tt.tags, tt.match, len(tt.want), page.Total)
+			continue
+		}
+		for i, task := range tasks {
+			if task.ID != tt.want[i] {
+				t.Errorf("%s (%s): expected task %d, got %d", tt.tags, tt.match, tt.want[i], task.ID)
+			}
+		}
+	}
+	filter, _ := ParseTagFilter("backend", "")
+	if problems, _, _ := db.ListProblemsPage(nil, nil, nil, nil, filter, ListOptions{}); len(problems) != 1 || problems[0].Tags[0] != "backend" {
+		t.Errorf("expected the tagged problem, got %+v", problems)
+	}
+
+	tags, err := db.ListTags(nil)
+	if err != nil {
+		t.Fatalf("failed to list tags: %v", err)
+	}
+	if len(tags) != 2 || tags[0].Name != "backend" || tags[0].Items != 2 || tags[1].Items != 2 {
+		t.Errorf("expected both tags on two items each, got %+v", tags)
+	}
+	problemEntity := EntityProblem
+	if tags, _ := db.ListTags(&problemEntity); len(tags) != 1 || tags[0].Name != "backend" {
+		t.Errorf("expected only the tag used on problems, got %+v", tags)
+	}
+
+	// Trashed items keep their tags but are not counted
+	db.DeleteTask(ui.ID)
+	if tag, _ := db.GetTag("urgent"); tag.Items != 1 {
+		t.Errorf("expected the trashed task not to be counted, got %d", tag.Items)
+	}
+
+	if err := db.UntagItem(EntityTask, api.ID, "Urgent"); err != nil {
+		t.Fatalf("failed to untag task: %v", err)
+	}
+	if err := db.UntagItem(EntityTask, api.ID, "urgent"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound untagging twice, got %v", err)
+	}
+	if _, err := db.TagItem(EntityTask, 999, "backend", ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a missing task, got %v", err)
+	}
+	for _, bad := range []struct{ entity, tag, color string }{
+		{EntityTaskNote, "backend", ""},
+		{EntityTask, " ", ""},
+		{EntityTask, "a,b", ""},
+		{EntityTask, "backend", "blue"},
+	} {
+		if _, err := db.TagItem(bad.entity, api.ID, bad.tag, bad.color); !errors.Is(err, ErrInvalidValue) {
+			t.Errorf("expected ErrInvalidValue for %+v, got %v", bad, err)
+		}
+	}
+	if _, err := ParseTagFilter("a", "some"); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("expected ErrInvalidValue for an unknown match, got %v", err)
+	}
+}
+
+func TestTagEvents(t *testing.T) {
+	db := newTestDatabase(t)
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+
+	recorded := recordEvents(t, db)
+	db.TagItem(EntityProject, project.ID, "q3", "")
+	db.TagItem(EntityProject, project.ID, "q3", "")
+	db.TagItem(EntityProject, project.ID, "q3", "#10b981")
+	events := *recorded
+	if len(events) != 3 || events[0].Entity != EntityTag || events[0].Action != ActionCreated ||
+		events[1].Entity != EntityProject || events[2].Entity != EntityTag || events[2].Action != ActionUpdated {
+		t.Fatalf("expected the tag's creation, the project's update and the colour change, got %+v", events)
+	}
+	if updated := events[1].Data.(*Project); len(updated.Tags) != 1 || updated.Tags[0] != "q3" {
+		t.Errorf("expected the update to carry the project's tags, got %+v", updated)
+	}
+	history := listHistory(t, db, EntityProject, project.ID)
+	if len(history) != 2 || history[0].Changes["tags"].New == nil {
+		t.Errorf("expected the history to record the tags, got %+v", history)
+	}
+}
+
+func TestRecurringTaskKeepsTags(t *testing.T) {
+	db := newTestDatabase(t)
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	due := time.Now().Add(time.Hour)
+	task, _ := db.CreateTask(project.ID, nil, "Backups", "", "", "", "", "", "", "", nil, &due)
+	db.TagItem(EntityTask, task.ID, "ops", "")
+	db.SetTaskRecurrence(task.ID, "FREQ=DAILY")
+
+	completed := "completed"
+	db.UpdateTask(task.ID, nil, nil, &completed, nil, nil, nil, nil, nil, nil, nil, nil)
+	filter, _ := ParseTagFilter("ops", "")
+	if tasks, _, _ := db.ListTasksPage(nil, nil, nil, nil, nil, DueFilter{}, filter, ListOptions{}); len(tasks) != 2 {
+		t.Errorf("expected the next instance to keep the tag, got %d tagged tasks", len(tasks))
+	}
+}
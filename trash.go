@@ -0,0 +1,402 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// DefaultTrashRetention is how long deleted items stay in the trash before
+// they are purged
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// TrashEntities are the entity types that can be in the trash
+var TrashEntities = []string{EntityProject, EntityTask, EntityProblem, EntityOutcome, EntityGoal, EntityTaskNote}
+
+// TrashEntry is a deleted item in the trash. Items counts the rows that were
+// trashed with it, including the item itself; restoring or purging the entry
+// acts on all of them.
+type TrashEntry struct {
+	ID        int64     `json:"id"`
+	Entity    string    `json:"entity"`
+	EntityID  int64     `json:"entity_id"`
+	Title     string    `json:"title"`
+	Actor     string    `json:"actor"`
+	DeletedAt time.Time `json:"deleted_at"`
+	Items     int       `json:"items"`
+}
+
+// trashCascades trash the dependents of an item that would otherwise be
+// removed by ON DELETE CASCADE. ?1 is the trash entry and ?2 the item's ID.
+// Notes go first because the subtree of a task only follows live subtasks.
+// Problems and goals keep their links to trashed projects and tasks; the
+// foreign keys clear them when the trash is purged.
+var trashCascades = map[string][]string{
+	EntityProject: {
+		"UPDATE task_notes SET deleted_at = CURRENT_TIMESTAMP, trash_id = ?1 WHERE deleted_at IS NULL AND task_id IN (SELECT id FROM tasks WHERE project_id = ?2 AND deleted_at IS NULL)",
+		"UPDATE tasks SET deleted_at = CURRENT_TIMESTAMP, trash_id = ?1 WHERE deleted_at IS NULL AND project_id = ?2",
+		"UPDATE outcomes SET deleted_at = CURRENT_TIMESTAMP, trash_id = ?1 WHERE deleted_at IS NULL AND project_id = ?2",
+	},
+	EntityTask: {
+		"UPDATE task_notes SET deleted_at = CURRENT_TIMESTAMP, trash_id = ?1 WHERE deleted_at IS NULL AND (task_id = ?2 OR task_id IN (" + taskSubtree("?2") + "))",
+		"UPDATE tasks SET deleted_at = CURRENT_TIMESTAMP, trash_id = ?1 WHERE deleted_at IS NULL AND id IN (" + taskSubtree("?2") + ")",
+	},
+}
+
+// trashParents find the parents an item can't be restored without
+var trashParents = map[string][]struct {
+	entity string
+	query  string
+}{
+	EntityTask: {
+		{EntityProject, "SELECT project_id FROM tasks WHERE id = ?"},
+		{EntityTask, "SELECT parent_task_id FROM tasks WHERE id = ?"},
+	},
+	EntityOutcome:  {{EntityProject, "SELECT project_id FROM outcomes WHERE id = ?"}},
+	EntityTaskNote: {{EntityTask, "SELECT task_id FROM task_notes WHERE id = ?"}},
+}
+
+// trashItemsCount counts the rows in a trash entry
+var trashItemsCount = func() string {
+	counts := make([]string, len(trashTables))
+	for i, t := range trashTables {
+		counts[i] = fmt.Sprintf("(SELECT COUNT(*) FROM %s WHERE trash_id = trash.id)", t.table)
+	}
+	return strings.Join(counts, " + ")
+}()
+
+func trashTable(entity string) string {
+	for _, t := range trashTables {
+		if t.entity == entity {
+			return t.table
+		}
+	}
+	return ""
+}
+
+// entityName is the entity as written in error messages, e.g. "task note"
+func entityName(entity string) string {
+	return strings.ReplaceAll(entity, "_", " ")
+}
+
+// trashTitle shortens a note to use as the title of its trash entry
+func trashTitle(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > 80 {
+		return string(r[:79]) + "…"
+	}
+	return s
+}
+
+// SetTrashRetention sets how long deleted items stay in the trash. Zero keeps
+// them until the trash is purged by hand.
+func (d *Database) SetTrashRetention(retention time.Duration) {
+	d.trashRetention = retention
+}
+
+// TrashRetention returns how long deleted items stay in the trash
+func (d *Database) TrashRetention() time.Duration {
+	return d.trashRetention
+}
+
+// moveToTrash soft-deletes an item and its dependents as a new trash entry
+func (d *Database) moveToTrash(entity string, id int64, title string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO trash (entity, entity_id, title, actor) VALUES (?, ?, ?, ?)", entity, id, title, d.actor)
+	if err != nil {
+		return err
+	}
+	trashID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	result, err = tx.Exec(fmt.Sprintf(
+		"UPDATE %s SET deleted_at = CURRENT_TIMESTAMP, trash_id = ? WHERE id = ? AND deleted_at IS NULL", trashTable(entity),
+	), trashID, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("%s with ID %d %w", entityName(entity), id, ErrNotFound)
+	}
+
+	for _, query := range trashCascades[entity] {
+		if _, err := tx.Exec(query, trashID, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// getItem returns a live project, task, problem, outcome, goal or task note
+func (d *Database) getItem(entity string, id int64) (interface{}, error) {
+	switch entity {
+	case EntityProject:
+		return d.GetProject(id)
+	case EntityTask:
+		return d.GetTask(id)
+	case EntityProblem:
+		return d.GetProblem(id)
+	case EntityOutcome:
+		return d.GetOutcome(id)
+	case EntityGoal:
+		return d.GetGoal(id)
+	case EntityTaskNote:
+		return d.GetTaskNote(id)
+	}
+	return nil, validateEnum("entity", entity, TrashEntities)
+}
+
+// isTrashed reports whether a row exists and is in the trash
+func (d *Database) isTrashed(entity string, id int64) (bool, error) {
+	var trashed bool
+	err := d.db.QueryRow(fmt.Sprintf("SELECT deleted_at IS NOT NULL FROM %s WHERE id = ?", trashTable(entity)), id).Scan(&trashed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return trashed, err
+}
+
+// GetTrashEntry returns an entry in the trash
+func (d *Database) GetTrashEntry(id int64) (*TrashEntry, error) {
+	var e TrashEntry
+	err := d.db.QueryRow(
+		"SELECT id, entity, entity_id, title, actor, deleted_at, "+trashItemsCount+" FROM trash WHERE id = ?",
+		id,
+	).Scan(&e.ID, &e.Entity, &e.EntityID, &e.Title, &e.Actor, &e.DeletedAt, &e.Items)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("trash entry with ID %d %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// ListTrashPage lists the trash, most recently deleted first. entity
+// restricts it to items of one type.
+func (d *Database) ListTrashPage(entity *string, opts ListOptions) ([]*TrashEntry, *PageInfo, error) {
+	if err := validateOptionalEnum("entity", entity, TrashEntities); err != nil {
+		return nil, nil, err
+	}
+
+	q := listQuery{
+		table:   "trash",
+		columns: "id, entity, entity_id, title, actor, deleted_at, " + trashItemsCount,
+		sorts:   newestFirstSorts,
+	}
+	if entity != nil {
+		q.filter("entity = ?", *entity)
+	}
+
+	var entries []*TrashEntry
+	page, err := d.listPage(q, opts, func(rows *sql.Rows, sortValue *interface{}) (int64, error) {
+		var e TrashEntry
+		if err := rows.Scan(&e.ID, &e.Entity, &e.EntityID, &e.Title, &e.Actor, &e.DeletedAt, &e.Items, sortValue); err != nil {
+			return 0, err
+		}
+		entries = append(entries, &e)
+		return e.ID, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return entries, page, nil
+}
+
+// Restore takes a deleted item out of the trash along with the dependents
+// deleted with it, and returns the restored item. An item that was deleted
+// as a dependent of another can only be restored with it.
+func (d *Database) Restore(entity string, id int64) (interface{}, error) {
+	if err := validateEnum("entity", entity, TrashEntities); err != nil {
+		return nil, err
+	}
+
+	var trashID sql.NullInt64
+	err := d.db.QueryRow(fmt.Sprintf("SELECT trash_id FROM %s WHERE id = ? AND deleted_at IS NOT NULL", trashTable(entity)), id).Scan(&trashID)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && !trashID.Valid {
+		return nil, fmt.Errorf("%s with ID %d in the trash %w", entityName(entity), id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := d.GetTrashEntry(trashID.Int64)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Entity != entity || entry.EntityID != id {
+		return nil, fmt.Errorf("%w: %s %d was deleted with %s %d; restore the %s instead",
+			ErrInvalidReference, entityName(entity), id, entityName(entry.Entity), entry.EntityID, entityName(entry.Entity))
+	}
+	return d.RestoreTrashEntry(entry.ID)
+}
+
+// RestoreTrashEntry restores every row in a trash entry and returns the item
+// it was created for. The item's project, task or parent task must not be in
+// the trash.
+func (d *Database) RestoreTrashEntry(id int64) (interface{}, error) {
+	entry, err := d.GetTrashEntry(id)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, parent := range trashParents[entry.Entity] {
+		var parentID sql.NullInt64
+		if err := d.db.QueryRow(parent.query, entry.EntityID).Scan(&parentID); err != nil {
+			return nil, err
+		}
+		if !parentID.Valid {
+			continue
+		}
+		trashed, err := d.isTrashed(parent.entity, parentID.Int64)
+		if err != nil {
+			return nil, err
+		}
+		if trashed {
+			return nil, fmt.Errorf("%w: %s %d is in the trash; restore it first", ErrInvalidReference, entityName(parent.entity), parentID.Int64)
+		}
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	for _, t := range trashTables {
+		if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET deleted_at = NULL, trash_id = NULL WHERE trash_id = ?", t.table), id); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM trash WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	item, err := d.getItem(entry.Entity, entry.EntityID)
+	if err != nil {
+		return nil, err
+	}
+	d.publish(ActionRestored, entry.Entity, entry.EntityID, nil, item)
+	return item, nil
+}
+
+// PurgeTrashEntry permanently deletes every row in a trash entry
+func (d *Database) PurgeTrashEntry(id int64) error {
+	entry, err := d.GetTrashEntry(id)
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, t := range trashTables {
+		if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE trash_id = ?", t.table), id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM trash WHERE id = ?", id); err != nil {
+		return err
+	}
+	// Purging a project also deletes tasks that were trashed on their own
+	// before it, leaving their entries empty
+	if _, err := tx.Exec("DELETE FROM trash WHERE " + trashItemsCount + " = 0"); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	d.publish(ActionPurged, entry.Entity, entry.EntityID, nil, nil)
+	return nil
+}
+
+// PurgeTrash permanently deletes the trash entries deleted more than
+// olderThan ago, oldest first, and returns how many were purged. Zero purges
+// the whole trash.
+func (d *Database) PurgeTrash(olderThan time.Duration) (int, error) {
+	cutoff := time.Now().UTC().Add(-olderThan).Format("2006-01-02 15:04:05")
+	rows, err := d.db.Query("SELECT id FROM trash WHERE deleted_at <= ? ORDER BY id", cutoff)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, id := range ids {
+		if err := d.PurgeTrashEntry(id); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				// Emptied by purging an earlier entry
+				continue
+			}
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// StartTrashPurger purges trash entries older than the retention period now
+// and then every interval, until the returned function is called. It does
+// nothing when retention is zero.
+func (d *Database) StartTrashPurger(interval time.Duration) func() {
+	if d.trashRetention <= 0 {
+		return func() {}
+	}
+
+	purger := d.WithActor("loom:retention")
+	purge := func() {
+		n, err := purger.PurgeTrash(d.trashRetention)
+		if err != nil {
+			log.Printf("Failed to purge trash: %v", err)
+		} else if n > 0 {
+			log.Printf("Purged %d item(s) from the trash", n)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		purge()
+		for {
+			select {
+			case <-ticker.C:
+				purge()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDeleteProjectMovesToTrash(t *testing.T) {
+	db := newTestDatabase(t)
+	project, _ := db.CreateProject("Launch", "", "", "", nil, nil)
+	task, _ := db.CreateTask(project.ID, nil, "Write notes", "", "", "", "", "", "", "", nil, nil)
+	note, _ := db.CreateTaskNote(task.ID, "Weeks of notes")
+	outcome, _ := db.CreateOutcome(project.ID, nil, "Shipped", "", "", nil, nil)
+	problem, _ := db.CreateProblem(&project.ID, &task.ID, "Blocked", "", "", "")
+
+	if err := db.WithActor("mcp:agent").DeleteProject(project.ID); err != nil {
+		t.Fatalf("failed to delete project: %v", err)
+	}
+
+	if _, err := db.GetTaskNote(note.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected note to be hidden, got %v", err)
+	}
+	if tasks, _ := db.ListTasks(nil, nil, nil); len(tasks) != 0 {
+		t.Errorf("expected trashed tasks to be left out of lists, got %d", len(tasks))
+	}
+	if err := db.DeleteProject(project.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound deleting a trashed project, got %v", err)
+	}
+	if _, err := db.CreateTask(project.ID, nil, "New", "", "", "", "", "", "", "", nil, nil); !errors.Is(err, ErrInvalidReference) {
+		t.Errorf("expected ErrInvalidReference for a trashed project, got %v", err)
+	}
+
+	entries, page, err := db.ListTrashPage(nil, ListOptions{})
+	if err != nil {
+		t.Fatalf("failed to list trash: %v", err)
+	}
+	if page.Total != 1 || entries[0].Entity != EntityProject || entries[0].Title != "Launch" || entries[0].Items != 4 || entries[0].Actor != "mcp:agent" {
+		t.Fatalf("expected one project entry with 4 items, got %+v", entries)
+	}
+
+	// Children can only come back with the project
+	if _, err := db.Restore(EntityTask, task.ID); !errors.Is(err, ErrInvalidReference) {
+		t.Errorf("expected ErrInvalidReference restoring a cascaded task, got %v", err)
+	}
+
+	restored, err := db.Restore(EntityProject, project.ID)
+	if err != nil {
+		t.Fatalf("failed to restore project: %v", err)
+	}
+	if p, ok := restored.(*Project); !ok || p.Name != "Launch" {
+		t.Errorf("expected the restored project, got %+v", restored)
+	}
+	for _, get := range []func() error{
+		func() error { _, err := db.GetTask(task.ID); return err },
+		func() error { _, err := db.GetTaskNote(note.ID); return err },
+		func() error { _, err := db.GetOutcome(outcome.ID); return err },
+	} {
+		if err := get(); err != nil {
+			t.Errorf("expected dependents to be restored, got %v", err)
+		}
+	}
+	if p, _ := db.GetProblem(problem.ID); p.ProjectID == nil || p.TaskID == nil {
+		t.Errorf("expected problem links to be kept, got %+v", p)
+	}
+	if entries, _, _ := db.ListTrashPage(nil, ListOptions{}); len(entries) != 0 {
+		t.Errorf("expected an empty trash, got %+v", entries)
+	}
+	if ids := searchIDs(t, db, "weeks", nil); len(ids[EntityTaskNote]) != 1 {
+		t.Errorf("expected restored note to be searchable, got %v", ids)
+	}
+}
+
+func TestRestoreKeepsSeparatelyTrashedItems(t *testing.T) {
+	db := newTestDatabase(t)
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	task, _ := db.CreateTask(project.ID, nil, "Deleted first", "", "", "", "", "", "", "", nil, nil)
+	note, _ := db.CreateTaskNote(task.ID, "Note")
+
+	if err := db.DeleteTaskNote(note.ID); err != nil {
+		t.Fatalf("failed to delete note: %v", err)
+	}
+	if err := db.DeleteTask(task.ID); err != nil {
+		t.Fatalf("failed to delete task: %v", err)
+	}
+	if err := db.DeleteProject(project.ID); err != nil {
+		t.Fatalf("failed to delete project: %v", err)
+	}
+
+	if _, err := db.Restore(EntityTask, task.ID); !errors.Is(err, ErrInvalidReference) {
+		t.Errorf("expected ErrInvalidReference restoring a task of a trashed project, got %v", err)
+	}
+	if _, err := db.Restore(EntityProject, project.ID); err != nil {
+		t.Fatalf("failed to restore project: %v", err)
+	}
+	if _, err := db.GetTask(task.ID); err == nil {
+		t.Error("expected task deleted on its own to stay in the trash")
+	}
+	if _, err := db.Restore(EntityTask, task.ID); err != nil {
+		t.Fatalf("failed to restore task: %v", err)
+	}
+	if _, err := db.GetTaskNote(note.ID); err == nil {
+		t.Error("expected note deleted on its own to stay in the trash")
+	}
+
+	if _, err := db.Restore(EntityTask, task.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound restoring a live task, got %v", err)
+	}
+	if _, err := db.Restore("comment", 1); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("expected ErrInvalidValue for unknown entity, got %v", err)
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	db := newTestDatabase(t)
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	task, _ := db.CreateTask(project.ID, nil, "T", "", "", "", "", "", "", "", nil, nil)
+	goal, _ := db.CreateGoal(nil, nil, "Recent", "", "", "", nil, nil)
+
+	db.DeleteTask(task.ID)
+	db.DeleteProject(project.ID)
+	db.DeleteGoal(goal.ID)
+	if _, err := db.db.Exec("UPDATE trash SET deleted_at = ? WHERE entity != 'goal'", time.Now().UTC().Add(-48*time.Hour).Format("2006-01-02 15:04:05")); err != nil {
+		t.Fatalf("failed to age trash: %v", err)
+	}
+
+	n, err := db.PurgeTrash(24 * time.Hour)
+	if err != nil {
+		t.Fatalf("failed to purge trash: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 entries purged, got %d", n)
+	}
+	var rows int
+	db.db.QueryRow("SELECT COUNT(*) FROM tasks").Scan(&rows)
+	if rows != 0 {
+		t.Errorf("expected task to be deleted for good, got %d rows", rows)
+	}
+
+	entries, _, _ := db.ListTrashPage(nil, ListOptions{})
+	if len(entries) != 1 || entries[0].Entity != EntityGoal {
+		t.Fatalf("expected the recent goal to stay in the trash, got %+v", entries)
+	}
+	if err := db.PurgeTrashEntry(entries[0].ID); err != nil {
+		t.Fatalf("failed to purge entry: %v", err)
+	}
+	if err := db.PurgeTrashEntry(entries[0].ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound purging twice, got %v", err)
+	}
+	if history := listHistory(t, db, EntityGoal, goal.ID); history[0].Action != ActionPurged {
+		t.Errorf("expected purge in history, got %+v", history[0])
+	}
+}
@@ -1,14 +1,21 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -21,66 +28,459 @@ type WebServer struct {
 	mcpHandler http.Handler
 	clients    map[chan string]bool
 	clientsMux sync.RWMutex
+
+	// requireToken makes every API, SSE and MCP request authenticate with
+	// an API token
+	requireToken bool
+	// corsOrigins are the origins besides the dashboard that browsers may
+	// call the API from; "*" allows any origin
+	corsOrigins []string
+	// ttsEngine is the echogarden engine that speaks voice messages, and
+	// ttsVoice the voice used when a message does not name one
+	ttsEngine string
+	ttsVoice  string
+
+	// stopping is cancelled when the servers begin shutting down, to end the
+	// streams that would otherwise keep them open
+	stopping context.Context
+	stop     context.CancelFunc
 }
 
-// NewWebServer creates a new web server instance
+// Server timeouts. Streams lift the write timeout, since they stay open for
+// as long as the client listens.
+const (
+	readHeaderTimeout = 10 * time.Second
+	readTimeout       = 30 * time.Second
+	writeTimeout      = 60 * time.Second
+	idleTimeout       = 2 * time.Minute
+
+	// voiceTimeout is how long speech synthesis may take, including the
+	// model download on first use
+	voiceTimeout = 5 * time.Minute
+
+	// shutdownTimeout is how long in-flight requests get to finish once the
+	// servers begin shutting down
+	shutdownTimeout = 10 * time.Second
+)
+
+// maxImportSize is the largest export POST /api/import accepts
+const maxImportSize = 64 << 20
+
+// NewWebServer creates a new web server instance. Every change made through
+// db is forwarded to SSE clients as a "change" event.
 func NewWebServer(db *Database, addr string, webAddr string, mcpHandler http.Handler) *WebServer {
-	return &WebServer{
+	ws := &WebServer{
 		db:         db,
 		addr:       addr,
 		webAddr:    webAddr,
 		mcpHandler: mcpHandler,
 		clients:    make(map[chan string]bool),
 	}
+	ws.stopping, ws.stop = context.WithCancel(context.Background())
+	if db != nil {
+		db.Subscribe(func(event ChangeEvent) {
+			ws.broadcast("change", event)
+		})
+	}
+	return ws
+}
+
+// Start runs the API and website servers on separate ports until ctx is
+// cancelled, then shuts them down gracefully. It returns early if either
+// server fails.
+func (ws *WebServer) Start(ctx context.Context) error {
+	apiListener, err := net.Listen("tcp", ws.addr)
+	if err != nil {
+		return fmt.Errorf("API server failed: %w", err)
+	}
+	webListener, err := net.Listen("tcp", ws.webAddr)
+	if err != nil {
+		apiListener.Close()
+		return fmt.Errorf("website server failed: %w", err)
+	}
+	return ws.serve(ctx, apiListener, webListener)
+}
+
+// serve runs the API and website servers on the given listeners until ctx is
+// cancelled or either server fails
+func (ws *WebServer) serve(ctx context.Context, apiListener, webListener net.Listener) error {
+	// Website server mux - serves the dashboard UI
+	webMux := http.NewServeMux()
+	webMux.HandleFunc("/", ws.handleDashboard)
+
+	servers := []struct {
+		name     string
+		server   *http.Server
+		listener net.Listener
+	}{
+		{"website", newHTTPServer(webMux), webListener},
+		{"API", newHTTPServer(ws.apiHandler()), apiListener},
+	}
+
+	errCh := make(chan error, len(servers))
+	for _, s := range servers {
+		go func() {
+			log.Printf("Starting Loom %s server at http://%s", s.name, s.listener.Addr())
+			if err := s.server.Serve(s.listener); !errors.Is(err, http.ErrServerClosed) {
+				errCh <- fmt.Errorf("%s server failed: %w", s.name, err)
+			}
+		}()
+	}
+
+	// Block until shutdown is requested or one of the servers fails
+	var serveErr error
+	select {
+	case <-ctx.Done():
+		log.Printf("Shutting down Loom servers")
+	case serveErr = <-errCh:
+	}
+
+	// End the SSE and MCP streams, then give in-flight requests time to
+	// finish before closing the remaining connections
+	ws.stop()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	errs := []error{serveErr}
+	for _, s := range servers {
+		if err := s.server.Shutdown(shutdownCtx); err != nil {
+			s.server.Close()
+			errs = append(errs, fmt.Errorf("%s server did not shut down cleanly: %w", s.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// newHTTPServer creates a server for handler with Loom's timeouts
+func newHTTPServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+}
+
+// stream lifts the write timeout for a long-lived stream, and ends it when
+// the servers begin shutting down, so shutdown does not wait on clients that
+// never hang up. Other requests pass through untouched.
+func (ws *WebServer) stream(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		defer context.AfterFunc(ws.stopping, cancel)()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
 }
 
-// Start begins the API and website servers on separate ports
-func (ws *WebServer) Start() error {
-	// API server mux - serves REST API, SSE, and MCP endpoints
+// apiHandler builds the API server handler, which serves the REST API, SSE,
+// and MCP endpoints
+func (ws *WebServer) apiHandler() http.Handler {
 	apiMux := http.NewServeMux()
 	apiMux.HandleFunc("/api/projects", ws.handleProjects)
 	apiMux.HandleFunc("/api/tasks", ws.handleTasks)
 	apiMux.HandleFunc("/api/problems", ws.handleProblems)
 	apiMux.HandleFunc("/api/outcomes", ws.handleOutcomes)
 	apiMux.HandleFunc("/api/goals", ws.handleGoals)
+	apiMux.HandleFunc("/api/projects/{id}", ws.handleProject)
+	apiMux.HandleFunc("/api/tasks/{id}", ws.handleTask)
+	apiMux.HandleFunc("/api/tasks/{id}/notes", ws.handleTaskNotes)
+	apiMux.HandleFunc("/api/tasks/{id}/notes/{note_id}", ws.handleTaskNote)
+	apiMux.HandleFunc("/api/tasks/{id}/dependencies", ws.handleTaskDependencies)
+	apiMux.HandleFunc("/api/tasks/{id}/dependencies/{depends_on_id}", ws.handleTaskDependency)
+	apiMux.HandleFunc("/api/tasks/{id}/blockers", ws.handleTaskBlockers)
+	apiMux.HandleFunc("/api/tasks/{id}/tree", ws.handleTaskTree)
+	apiMux.HandleFunc("/api/problems/{id}", ws.handleProblem)
+	apiMux.HandleFunc("/api/problems/{id}/projects", ws.handleProblemProjects)
+	apiMux.HandleFunc("/api/problems/{id}/projects/{project_id}", ws.handleProblemProject)
+	apiMux.HandleFunc("/api/outcomes/{id}", ws.handleOutcome)
+	apiMux.HandleFunc("/api/goals/{id}", ws.handleGoal)
+	apiMux.HandleFunc("/api/goals/{id}/projects", ws.handleGoalProjects)
+	apiMux.HandleFunc("/api/goals/{id}/projects/{project_id}", ws.handleGoalProject)
+	apiMux.HandleFunc("/api/search", ws.handleSearch)
+	apiMux.HandleFunc("/api/activity", ws.handleActivity)
+	apiMux.HandleFunc("/api/overdue", ws.handleOverdue)
+	apiMux.HandleFunc("/api/due-soon", ws.handleDueSoon)
+	apiMux.HandleFunc("/api/recurrences", ws.handleRecurrences)
+	apiMux.HandleFunc("/api/recurrences/{id}/pause", ws.handleRecurrencePause)
+	apiMux.HandleFunc("/api/recurrences/{id}/resume", ws.handleRecurrencePause)
+	apiMux.HandleFunc("/api/tags", ws.handleTags)
+	apiMux.HandleFunc("/api/people", ws.handlePeople)
+	apiMux.HandleFunc("/api/people/{id}", ws.handlePerson)
+	apiMux.HandleFunc("/api/people/{id}/workload", ws.handlePersonWorkload)
+	for _, entity := range TagEntities {
+		collection := tagTables[entity].items
+		apiMux.HandleFunc("/api/"+collection+"/{id}/tags", ws.handleItemTags(entity))
+		apiMux.HandleFunc("/api/"+collection+"/{id}/tags/{tag}", ws.handleItemTag(entity))
+	}
+	apiMux.HandleFunc("/api/export", ws.handleExport)
+	apiMux.HandleFunc("/api/import", ws.handleImport)
+	apiMux.HandleFunc("/api/sync-links", ws.handleSyncLinks)
+	apiMux.HandleFunc("/api/sync-links/{id}", ws.handleSyncLink)
+	apiMux.HandleFunc("/api/sync-links/{id}/sync", ws.handleSyncLinkSync)
+	apiMux.HandleFunc("/api/trash", ws.handleTrash)
+	apiMux.HandleFunc("/api/trash/{id}", ws.handleTrashEntry)
+	apiMux.HandleFunc("/api/trash/{id}/restore", ws.handleTrashRestore)
 	apiMux.HandleFunc("/api/voice", ws.handleVoice)
-	apiMux.HandleFunc("/events", ws.handleSSE)
+	apiMux.HandleFunc("/api/announce", ws.handleAnnounce)
+	apiMux.Handle("/events", ws.stream(http.HandlerFunc(ws.handleSSE)))
 	if ws.mcpHandler != nil {
-		apiMux.Handle("/sse", ws.mcpHandler)
+		apiMux.Handle("/sse", ws.stream(ws.mcpHandler))
 	}
+	var handler http.Handler = apiMux
+	if ws.requireToken {
+		handler = ws.authenticate(handler)
+	}
+	return ws.cors(handler)
+}
 
-	// Website server mux - serves the dashboard UI
-	webMux := http.NewServeMux()
-	webMux.HandleFunc("/", ws.handleDashboard)
+// cors wraps the API handler to let browsers call it from the dashboard and
+// the configured origins only, and answers CORS preflight requests. The MCP
+// endpoint refuses requests from any other origin outright, as the
+// Streamable HTTP spec asks. So that a web page cannot reach an API that
+// only listens on this machine through DNS rebinding, requests to it must
+// also name it by a host it is known by.
+func (ws *WebServer) cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !exposedAddr(ws.addr) && !ws.knownHost(requestHostname(r)) {
+			writeError(w, http.StatusForbidden, fmt.Sprintf("host %s is not allowed", r.Host))
+			return
+		}
 
-	errCh := make(chan error, 1)
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-Loom-Actor, Mcp-Session-Id, Mcp-Protocol-Version")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Total-Count, X-Next-Cursor, Mcp-Session-Id")
+		w.Header().Add("Vary", "Origin")
+
+		origin := r.Header.Get("Origin")
+		if origin != "" {
+			if !ws.allowedOrigin(origin) {
+				if r.URL.Path == "/sse" {
+					writeError(w, http.StatusForbidden, fmt.Sprintf("origin %s is not allowed", origin))
+					return
+				}
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+		}
 
-	// Start the website server in a goroutine
-	go func() {
-		log.Printf("Starting Loom website server at http://%s", ws.webAddr)
-		if err := http.ListenAndServe(ws.webAddr, webMux); err != nil {
-			errCh <- fmt.Errorf("website server failed: %w", err)
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.WriteHeader(http.StatusNoContent)
+			return
 		}
-	}()
+		next.ServeHTTP(w, r)
+	})
+}
 
-	// Start the API server in a goroutine
-	go func() {
-		log.Printf("Starting Loom API server at http://%s", ws.addr)
-		if err := http.ListenAndServe(ws.addr, apiMux); err != nil {
-			errCh <- fmt.Errorf("API server failed: %w", err)
+// allowedOrigin reports whether a browser page at origin may call the API.
+// The dashboard is always allowed at the hosts the servers are known by.
+// The request's own Host is not trusted for this, since DNS rebinding
+// controls it.
+func (ws *WebServer) allowedOrigin(origin string) bool {
+	if u, err := url.Parse(origin); err == nil && u.Scheme == "http" && u.Path == "" && ws.knownHost(u.Hostname()) {
+		if _, port, err := net.SplitHostPort(ws.webAddr); err == nil && u.Port() == port {
+			return true
 		}
-	}()
+	}
+	for _, allowed := range ws.corsOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimRight(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// knownHost reports whether hostname names the servers as they were
+// configured: a loopback name or address, the host of the API or dashboard
+// address, or any IP address if they listen on every interface. IP
+// addresses are safe to accept, since DNS rebinding needs a hostname.
+func (ws *WebServer) knownHost(hostname string) bool {
+	if hostname == "" {
+		return false
+	}
+	ip := net.ParseIP(hostname)
+	if strings.EqualFold(hostname, "localhost") || (ip != nil && ip.IsLoopback()) {
+		return true
+	}
+	for _, addr := range []string{ws.addr, ws.webAddr} {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(host, hostname) {
+			return true
+		}
+		if bind := net.ParseIP(host); ip != nil && (host == "" || (bind != nil && bind.IsUnspecified())) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestHostname returns the hostname a request was sent to, without its
+// port
+func requestHostname(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.Host); err == nil {
+		return host
+	}
+	return strings.Trim(r.Host, "[]")
+}
+
+// authenticate wraps the API handler so that every request needs a live API
+// token, given as a bearer token in the Authorization header. The dashboard's
+// EventSource cannot set headers, so /events also accepts it in the
+// access_token query parameter. CORS preflight requests carry no
+// credentials and are let through.
+func (ws *WebServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		secret, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if secret == "" && r.URL.Path == "/events" {
+			secret = r.URL.Query().Get("access_token")
+		}
+		token, err := ws.db.AuthenticateToken(strings.TrimSpace(secret))
+		if err == nil {
+			err = ws.authorizeRequest(token, r)
+		}
+		if err != nil {
+			if errors.Is(err, ErrUnauthorized) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="loom"`)
+			}
+			writeDatabaseError(w, err, "", 0)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(contextWithToken(r.Context(), token)))
+	})
+}
+
+// apiCollections maps the REST collections inside the project hierarchy to
+// their entity type
+var apiCollections = map[string]string{
+	"projects": EntityProject,
+	"tasks":    EntityTask,
+	"problems": EntityProblem,
+	"outcomes": EntityOutcome,
+	"goals":    EntityGoal,
+}
+
+// authorizeRequest checks that the token allows a request. Anything but a
+// read needs a write token, and a token limited to a project can only reach
+// that project and the items in it. MCP tool calls are checked one by one
+// by the MCP server.
+func (ws *WebServer) authorizeRequest(token *APIToken, r *http.Request) error {
+	if r.URL.Path == "/sse" {
+		return nil
+	}
+	// Speaking a message aloud changes nothing, so read tokens can listen
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && r.URL.Path != "/api/voice" {
+		if err := token.authorizeWrite(); err != nil {
+			return err
+		}
+	}
+	if token.ProjectID == nil {
+		return nil
+	}
+
+	if r.URL.Path == "/api/export" {
+		return scopeQueryToProject(token, r)
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	entity, ok := "", false
+	if len(parts) >= 2 && parts[0] == "api" {
+		entity, ok = apiCollections[parts[1]]
+	}
+	if !ok {
+		return token.authorizeAllProjects()
+	}
+
+	if len(parts) == 2 {
+		if entity == EntityProject {
+			return token.authorizeAllProjects()
+		}
+		if r.Method == http.MethodGet {
+			// List only the token's project
+			return scopeQueryToProject(token, r)
+		}
+	} else {
+		id, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil {
+			// Let the handler reject the malformed ID
+			return nil
+		}
+		if err := ws.db.authorizeItem(token, entity, id); err != nil {
+			return err
+		}
+		if len(parts) == 5 {
+			if id, err := strconv.ParseInt(parts[4], 10, 64); err == nil {
+				switch parts[3] {
+				case "notes":
+					err = ws.db.authorizeItem(token, EntityTaskNote, id)
+				case "dependencies":
+					err = ws.db.authorizeItem(token, EntityTask, id)
+				case "projects":
+					err = token.authorizeProject(id)
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if r.Method != http.MethodPost && r.Method != http.MethodPatch {
+		return nil
+	}
+	// Check the items the body refers to, leaving it for the handler to read
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	var args map[string]interface{}
+	if json.Unmarshal(body, &args) != nil {
+		return nil
+	}
+	if len(parts) == 2 && args["project_id"] == nil {
+		// New items must be created inside the token's project
+		return fmt.Errorf("%w: token %q is limited to project %d; set project_id", ErrForbidden, token.Name, *token.ProjectID)
+	}
+	return ws.db.authorizeReferences(token, args)
+}
 
-	// Block until one of the servers fails
-	return <-errCh
+// scopeQueryToProject limits a request to the token's project by setting
+// its project_id query parameter, or checks the one it already has. A
+// project_id that is not an ID is refused too, rather than left for the
+// handler to read as no filter at all.
+func scopeQueryToProject(token *APIToken, r *http.Request) error {
+	query := r.URL.Query()
+	if query.Get("project_id") == "" {
+		query.Set("project_id", strconv.FormatInt(*token.ProjectID, 10))
+		r.URL.RawQuery = query.Encode()
+	}
+	projectID, err := strconv.ParseInt(query.Get("project_id"), 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: token %q is limited to project %d, not project_id %q", ErrForbidden, token.Name, *token.ProjectID, query.Get("project_id"))
+	}
+	return token.authorizeProject(projectID)
 }
 
-// broadcast sends an event to all connected SSE clients
-func (ws *WebServer) broadcast(eventType string, data interface{}) {
+// broadcast sends an event to all connected SSE clients and returns the
+// number of clients it was delivered to
+func (ws *WebServer) broadcast(eventType string, data interface{}) int {
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		log.Printf("Error marshaling event data: %v", err)
-		return
+		return 0
 	}
 
 	event := fmt.Sprintf("event: %s\ndata: %s\n\n", eventType, jsonData)
@@ -88,13 +488,16 @@ func (ws *WebServer) broadcast(eventType string, data interface{}) {
 	ws.clientsMux.RLock()
 	defer ws.clientsMux.RUnlock()
 
+	delivered := 0
 	for client := range ws.clients {
 		select {
 		case client <- event:
+			delivered++
 		default:
 			// Client buffer full, skip
 		}
 	}
+	return delivered
 }
 
 // handleSSE handles Server-Sent Events connections
@@ -103,7 +506,6 @@ func (ws *WebServer) handleSSE(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	// Create a channel for this client
 	clientChan := make(chan string, 10)
@@ -142,19 +544,63 @@ func (ws *WebServer) handleSSE(w http.ResponseWriter, r *http.Request) {
 				f.Flush()
 			}
 		case <-r.Context().Done():
+			// Tell the client the server is going away rather than just
+			// dropping the connection, so it can wait and reconnect
+			if ws.stopping.Err() != nil {
+				fmt.Fprintf(w, "event: shutdown\ndata: {\"status\":\"shutdown\"}\n\n")
+				if f, ok := w.(http.Flusher); ok {
+					f.Flush()
+				}
+			}
 			return
 		}
 	}
 }
 
-// handleProjects handles the /api/projects endpoint
+// handleProjects handles the /api/projects collection endpoint
 func (ws *WebServer) handleProjects(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ws.listProjects(w, r)
+	case http.MethodPost:
+		ws.createProject(w, r)
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// listProjects lists projects matching the query parameters
+func (ws *WebServer) listProjects(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
-	projects, err := ws.db.ListProjects(nil)
+	var status *string
+	if s := r.URL.Query().Get("status"); s != "" {
+		status = &s
+	}
+
+	due, err := parseDueFilter(ws.db, r)
 	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tags, err := parseTagFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	opts, fields, err := parseListOptions(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	projects, page, err := ws.db.ListProjectsPage(status, due, tags, opts)
+	if err != nil {
+		writeDatabaseError(w, err, "project", 0)
 		return
 	}
 
@@ -162,168 +608,1997 @@ func (ws *WebServer) handleProjects(w http.ResponseWriter, r *http.Request) {
 		projects = []*Project{}
 	}
 
-	json.NewEncoder(w).Encode(projects)
+	writeList(w, projects, page, fields)
 }
 
-// handleTasks handles the /api/tasks endpoint
+// handleTasks handles the /api/tasks collection endpoint
 func (ws *WebServer) handleTasks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ws.listTasks(w, r)
+	case http.MethodPost:
+		ws.createTask(w, r)
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// listTasks lists tasks matching the query parameters
+func (ws *WebServer) listTasks(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	// Parse query parameters
-	var projectID *int64
 	var status *string
 	var taskType *string
+	var assignee *string
+	var ready *bool
 
-	if pidStr := r.URL.Query().Get("project_id"); pidStr != "" {
-		if pid, err := strconv.ParseInt(pidStr, 10, 64); err == nil {
-			projectID = &pid
+	projectID, ok := queryID(w, r, "project_id")
+	if !ok {
+		return
+	}
+
+	if s := r.URL.Query().Get("status"); s != "" {
+		status = &s
+	}
+
+	if t := r.URL.Query().Get("task_type"); t != "" {
+		taskType = &t
+	}
+
+	if a := r.URL.Query().Get("assignee"); a != "" {
+		assignee = &a
+	}
+
+	if readyStr := r.URL.Query().Get("ready"); readyStr != "" {
+		b, err := strconv.ParseBool(readyStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid ready: %q", readyStr))
+			return
+		}
+		ready = &b
+	}
+
+	due, err := parseDueFilter(ws.db, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tags, err := parseTagFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	opts, fields, err := parseListOptions(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tasks, page, err := ws.db.ListTasksPage(projectID, status, taskType, assignee, ready, due, tags, opts)
+	if err != nil {
+		writeDatabaseError(w, err, "task", 0)
+		return
+	}
+
+	if tasks == nil {
+		tasks = []*Task{}
+	}
+
+	writeList(w, tasks, page, fields)
+}
+
+// handleActivity handles GET /api/activity?entity=...&entity_id=...&actor=...
+func (ws *WebServer) handleActivity(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var entity *string
+	var entityID *int64
+	var actor *string
+
+	if e := r.URL.Query().Get("entity"); e != "" {
+		entity = &e
+	}
+
+	if idStr := r.URL.Query().Get("entity_id"); idStr != "" {
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid entity_id: %q", idStr))
+			return
+		}
+		if entity == nil {
+			writeError(w, http.StatusBadRequest, "entity is required with entity_id")
+			return
+		}
+		entityID = &id
+	}
+
+	if a := r.URL.Query().Get("actor"); a != "" {
+		actor = &a
+	}
+
+	opts, fields, err := parseListOptions(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	entries, page, err := ws.db.ListActivityPage(entity, entityID, actor, opts)
+	if err != nil {
+		writeDatabaseError(w, err, "activity", 0)
+		return
+	}
+
+	if entries == nil {
+		entries = []*Activity{}
+	}
+
+	writeList(w, entries, page, fields)
+}
+
+// handleOverdue handles GET /api/overdue
+func (ws *WebServer) handleOverdue(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	items, err := ws.db.ListOverdue()
+	if err != nil {
+		writeDatabaseError(w, err, "item", 0)
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// handleDueSoon handles GET /api/due-soon?days=... (default 7)
+func (ws *WebServer) handleDueSoon(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	days := 7
+	if daysStr := r.URL.Query().Get("days"); daysStr != "" {
+		var err error
+		if days, err = strconv.Atoi(daysStr); err != nil || days < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid days: %q", daysStr))
+			return
+		}
+	}
+
+	items, err := ws.db.ListDueSoon(time.Duration(days) * 24 * time.Hour)
+	if err != nil {
+		writeDatabaseError(w, err, "item", 0)
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// handleRecurrences handles GET /api/recurrences?project_id=...
+func (ws *WebServer) handleRecurrences(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	projectID, ok := queryID(w, r, "project_id")
+	if !ok {
+		return
+	}
+
+	recurrences, err := ws.db.ListRecurrences(projectID)
+	if err != nil {
+		writeDatabaseError(w, err, "recurrence", 0)
+		return
+	}
+	writeJSON(w, http.StatusOK, recurrences)
+}
+
+// handleTags handles GET /api/tags?entity=...
+func (ws *WebServer) handleTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var entity *string
+	if e := r.URL.Query().Get("entity"); e != "" {
+		entity = &e
+	}
+	tags, err := ws.db.ListTags(entity)
+	if err != nil {
+		writeDatabaseError(w, err, "tag", 0)
+		return
+	}
+	writeJSON(w, http.StatusOK, tags)
+}
+
+// handleItemTags returns the handler of POST /api/{collection}/{id}/tags,
+// which tags an item of the given type and returns the item
+func (ws *WebServer) handleItemTags(entity string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		id, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		var req struct {
+			Tag   string `json:"tag"`
+			Color string `json:"color"`
+		}
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+		if _, err := ws.db.WithActor(requestActor(r)).TagItem(entity, id, req.Tag, req.Color); err != nil {
+			writeDatabaseError(w, err, entityName(entity), id)
+			return
+		}
+		item, err := ws.db.getItem(entity, id)
+		if err != nil {
+			writeDatabaseError(w, err, entityName(entity), id)
+			return
+		}
+		writeJSON(w, http.StatusOK, item)
+	}
+}
+
+// handleItemTag returns the handler of DELETE
+// /api/{collection}/{id}/tags/{tag}, which removes a tag from an item of the
+// given type
+func (ws *WebServer) handleItemTag(entity string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.Method != http.MethodDelete {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		id, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		if err := ws.db.WithActor(requestActor(r)).UntagItem(entity, id, r.PathValue("tag")); err != nil {
+			writeDatabaseError(w, err, entityName(entity), id)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handlePeople handles GET /api/people?role=... and POST /api/people
+func (ws *WebServer) handlePeople(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		var role *string
+		if rl := r.URL.Query().Get("role"); rl != "" {
+			role = &rl
+		}
+		people, err := ws.db.ListPeople(role)
+		if err != nil {
+			writeDatabaseError(w, err, "person", 0)
+			return
+		}
+		writeJSON(w, http.StatusOK, people)
+	case http.MethodPost:
+		var req struct {
+			Name      string `json:"name"`
+			Email     string `json:"email"`
+			Handle    string `json:"handle"`
+			Role      string `json:"role"`
+			ManagerID *int64 `json:"manager_id"`
+		}
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+		person, err := ws.db.WithActor(requestActor(r)).CreatePerson(req.Name, req.Email, req.Handle, req.Role, req.ManagerID)
+		if err != nil {
+			writeDatabaseError(w, err, "person", 0)
+			return
+		}
+		writeJSON(w, http.StatusCreated, person)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handlePerson handles the /api/people/{id} endpoint
+func (ws *WebServer) handlePerson(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		person, err := ws.db.GetPerson(id)
+		if err != nil {
+			writeDatabaseError(w, err, "person", id)
+			return
+		}
+		writeJSON(w, http.StatusOK, person)
+	case http.MethodPatch:
+		var req struct {
+			Name      *string `json:"name"`
+			Email     *string `json:"email"`
+			Handle    *string `json:"handle"`
+			Role      *string `json:"role"`
+			ManagerID *int64  `json:"manager_id"`
+		}
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+		person, err := ws.db.WithActor(requestActor(r)).UpdatePerson(id, req.Name, req.Email, req.Handle, req.Role, req.ManagerID)
+		if err != nil {
+			writeDatabaseError(w, err, "person", id)
+			return
+		}
+		writeJSON(w, http.StatusOK, person)
+	case http.MethodDelete:
+		if err := ws.db.WithActor(requestActor(r)).DeletePerson(id); err != nil {
+			writeDatabaseError(w, err, "person", id)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handlePersonWorkload handles GET /api/people/{id}/workload
+func (ws *WebServer) handlePersonWorkload(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	workload, err := ws.db.GetWorkload(id)
+	if err != nil {
+		writeDatabaseError(w, err, "person", id)
+		return
+	}
+	writeJSON(w, http.StatusOK, workload)
+}
+
+// handleRecurrencePause handles POST /api/recurrences/{id}/pause and
+// POST /api/recurrences/{id}/resume
+func (ws *WebServer) handleRecurrencePause(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	db := ws.db.WithActor(requestActor(r))
+	var recurrence *Recurrence
+	var err error
+	if strings.HasSuffix(r.URL.Path, "/resume") {
+		recurrence, err = db.ResumeRecurrence(id)
+	} else {
+		recurrence, err = db.PauseRecurrence(id)
+	}
+	if err != nil {
+		writeDatabaseError(w, err, "recurrence", id)
+		return
+	}
+	writeJSON(w, http.StatusOK, recurrence)
+}
+
+// handleSyncLinks handles GET and POST /api/sync-links. GET can be limited
+// to one project with ?project_id=.
+func (ws *WebServer) handleSyncLinks(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		var projectID *int64
+		if pid := r.URL.Query().Get("project_id"); pid != "" {
+			id, err := strconv.ParseInt(pid, 10, 64)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "invalid project_id")
+				return
+			}
+			projectID = &id
+		}
+		links, err := ws.db.ListSyncLinks(projectID)
+		if err != nil {
+			writeDatabaseError(w, err, "sync link", 0)
+			return
+		}
+		writeJSON(w, http.StatusOK, links)
+	case http.MethodPost:
+		var req struct {
+			ProjectID int64  `json:"project_id"`
+			Provider  string `json:"provider"`
+			Remote    string `json:"remote"`
+		}
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+		link, err := ws.db.CreateSyncLink(req.ProjectID, req.Provider, req.Remote)
+		if err != nil {
+			writeDatabaseError(w, err, "sync link", 0)
+			return
+		}
+		writeJSON(w, http.StatusCreated, link)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleSyncLink handles GET and DELETE /api/sync-links/{id}
+func (ws *WebServer) handleSyncLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		link, err := ws.db.GetSyncLink(id)
+		if err != nil {
+			writeDatabaseError(w, err, "sync link", id)
+			return
+		}
+		writeJSON(w, http.StatusOK, link)
+	case http.MethodDelete:
+		if err := ws.db.DeleteSyncLink(id); err != nil {
+			writeDatabaseError(w, err, "sync link", id)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleSyncLinkSync handles POST /api/sync-links/{id}/sync?dry_run=true,
+// syncing the link now rather than waiting for the scheduler
+func (ws *WebServer) handleSyncLinkSync(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	dryRun := false
+	if s := r.URL.Query().Get("dry_run"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid dry_run: %q", s))
+			return
+		}
+		dryRun = b
+	}
+	result, err := ws.db.SyncIssues(id, dryRun)
+	if err != nil {
+		writeDatabaseError(w, err, "sync link", id)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleExport handles GET /api/export?format=json|csv|markdown&project_id=...
+func (ws *WebServer) handleExport(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if err := validateEnum("format", format, ExportFormats); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var projectID *int64
+	if pidStr := r.URL.Query().Get("project_id"); pidStr != "" {
+		pid, err := strconv.ParseInt(pidStr, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid project_id: %q", pidStr))
+			return
+		}
+		projectID = &pid
+	}
+
+	workspace, err := ws.db.ExportWorkspace(projectID)
+	if err != nil {
+		writeDatabaseError(w, err, "project", 0)
+		return
+	}
+	name := "loom-export"
+	if projectID != nil {
+		name += fmt.Sprintf("-project-%d", *projectID)
+	}
+	w.Header().Set("Content-Type", exportContentTypes[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+exportExtensions[format]))
+	if err := WriteExport(w, workspace, format); err != nil {
+		log.Printf("Failed to write export: %v", err)
+	}
+}
+
+// handleImport handles POST /api/import?preserve_ids=true, which adds a JSON
+// export to the database and tells dashboards to reload
+func (ws *WebServer) handleImport(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	preserveIDs := false
+	if s := r.URL.Query().Get("preserve_ids"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid preserve_ids: %q", s))
+			return
+		}
+		preserveIDs = b
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	var workspace Workspace
+	if !decodeJSONBody(w, r, &workspace) {
+		return
+	}
+	result, err := ws.db.WithActor(requestActor(r)).ImportWorkspace(&workspace, preserveIDs)
+	if err != nil {
+		writeDatabaseError(w, err, "item", 0)
+		return
+	}
+	writeJSON(w, http.StatusCreated, result)
+}
+
+// handleTrash handles GET /api/trash?entity=... to list the trash and
+// DELETE /api/trash?older_than_days=... to purge it
+func (ws *WebServer) handleTrash(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		var entity *string
+		if e := r.URL.Query().Get("entity"); e != "" {
+			entity = &e
+		}
+
+		opts, fields, err := parseListOptions(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		entries, page, err := ws.db.ListTrashPage(entity, opts)
+		if err != nil {
+			writeDatabaseError(w, err, "trash entry", 0)
+			return
+		}
+		if entries == nil {
+			entries = []*TrashEntry{}
+		}
+		writeList(w, entries, page, fields)
+	case http.MethodDelete:
+		daysStr := r.URL.Query().Get("older_than_days")
+		days, err := strconv.Atoi(daysStr)
+		if err != nil || days < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid older_than_days: %q", daysStr))
+			return
+		}
+
+		n, err := ws.db.WithActor(requestActor(r)).PurgeTrash(time.Duration(days) * 24 * time.Hour)
+		if err != nil {
+			writeDatabaseError(w, err, "trash entry", 0)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"purged": n})
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleTrashEntry handles GET and DELETE /api/trash/{id}. DELETE purges the
+// entry for good.
+func (ws *WebServer) handleTrashEntry(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		entry, err := ws.db.GetTrashEntry(id)
+		if err != nil {
+			writeDatabaseError(w, err, "trash entry", id)
+			return
+		}
+		writeJSON(w, http.StatusOK, entry)
+	case http.MethodDelete:
+		if err := ws.db.WithActor(requestActor(r)).PurgeTrashEntry(id); err != nil {
+			writeDatabaseError(w, err, "trash entry", id)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleTrashRestore handles POST /api/trash/{id}/restore, returning the
+// restored item
+func (ws *WebServer) handleTrashRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	item, err := ws.db.WithActor(requestActor(r)).RestoreTrashEntry(id)
+	if err != nil {
+		writeDatabaseError(w, err, "trash entry", id)
+		return
+	}
+	writeJSON(w, http.StatusOK, item)
+}
+
+// handleSearch handles GET /api/search?q=...&entity=...&limit=...
+func (ws *WebServer) handleSearch(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	query := r.URL.Query().Get("q")
+	if strings.TrimSpace(query) == "" {
+		writeError(w, http.StatusBadRequest, "missing search query parameter q")
+		return
+	}
+
+	var entity *string
+	if e := r.URL.Query().Get("entity"); e != "" {
+		entity = &e
+	}
+
+	limit := 0
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid limit: %q", l))
+			return
+		}
+		limit = n
+	}
+
+	results, err := ws.db.Search(query, entity, limit)
+	if err != nil {
+		writeDatabaseError(w, err, "search", 0)
+		return
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+// handleProblems handles the /api/problems collection endpoint
+func (ws *WebServer) handleProblems(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ws.listProblems(w, r)
+	case http.MethodPost:
+		ws.createProblem(w, r)
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// listProblems lists problems matching the query parameters
+func (ws *WebServer) listProblems(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var status *string
+	var assignee *string
+
+	projectID, ok := queryID(w, r, "project_id")
+	if !ok {
+		return
+	}
+
+	taskID, ok := queryID(w, r, "task_id")
+	if !ok {
+		return
+	}
+
+	if s := r.URL.Query().Get("status"); s != "" {
+		status = &s
+	}
+
+	if a := r.URL.Query().Get("assignee"); a != "" {
+		assignee = &a
+	}
+
+	tags, err := parseTagFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	opts, fields, err := parseListOptions(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	problems, page, err := ws.db.ListProblemsPage(projectID, taskID, status, assignee, tags, opts)
+	if err != nil {
+		writeDatabaseError(w, err, "problem", 0)
+		return
+	}
+
+	if problems == nil {
+		problems = []*Problem{}
+	}
+
+	writeList(w, problems, page, fields)
+}
+
+// handleOutcomes handles the /api/outcomes collection endpoint
+func (ws *WebServer) handleOutcomes(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ws.listOutcomes(w, r)
+	case http.MethodPost:
+		ws.createOutcome(w, r)
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// listOutcomes lists outcomes matching the query parameters
+func (ws *WebServer) listOutcomes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var status *string
+
+	projectID, ok := queryID(w, r, "project_id")
+	if !ok {
+		return
+	}
+
+	taskID, ok := queryID(w, r, "task_id")
+	if !ok {
+		return
+	}
+
+	if s := r.URL.Query().Get("status"); s != "" {
+		status = &s
+	}
+
+	due, err := parseDueFilter(ws.db, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tags, err := parseTagFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	opts, fields, err := parseListOptions(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	outcomes, page, err := ws.db.ListOutcomesPage(projectID, taskID, status, due, tags, opts)
+	if err != nil {
+		writeDatabaseError(w, err, "outcome", 0)
+		return
+	}
+
+	if outcomes == nil {
+		outcomes = []*Outcome{}
+	}
+
+	writeList(w, outcomes, page, fields)
+}
+
+// handleGoals handles the /api/goals collection endpoint
+func (ws *WebServer) handleGoals(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ws.listGoals(w, r)
+	case http.MethodPost:
+		ws.createGoal(w, r)
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// listGoals lists goals matching the query parameters
+func (ws *WebServer) listGoals(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var goalType *string
+	var assignee *string
+
+	projectID, ok := queryID(w, r, "project_id")
+	if !ok {
+		return
+	}
+
+	taskID, ok := queryID(w, r, "task_id")
+	if !ok {
+		return
+	}
+
+	if g := r.URL.Query().Get("goal_type"); g != "" {
+		goalType = &g
+	}
+
+	if a := r.URL.Query().Get("assignee"); a != "" {
+		assignee = &a
+	}
+
+	due, err := parseDueFilter(ws.db, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tags, err := parseTagFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	opts, fields, err := parseListOptions(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	goals, page, err := ws.db.ListGoalsPage(projectID, taskID, goalType, assignee, due, tags, opts)
+	if err != nil {
+		writeDatabaseError(w, err, "goal", 0)
+		return
+	}
+
+	if goals == nil {
+		goals = []*Goal{}
+	}
+
+	writeList(w, goals, page, fields)
+}
+
+// --- Resource handlers ---
+
+// createProject creates a project from the JSON request body
+func (ws *WebServer) createProject(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name         string `json:"name"`
+		Description  string `json:"description"`
+		Status       string `json:"status"`
+		ExternalLink string `json:"external_link"`
+		StartAt      string `json:"start_at"`
+		DueAt        string `json:"due_at"`
+	}
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	if req.Name == "" {
+		writeError(w, http.StatusUnprocessableEntity, "name is required")
+		return
+	}
+
+	startAt, dueAt, err := ws.db.ParseDates(&req.StartAt, &req.DueAt)
+	if err != nil {
+		writeDatabaseError(w, err, "project", 0)
+		return
+	}
+	project, err := ws.db.WithActor(requestActor(r)).CreateProject(req.Name, req.Description, req.Status, req.ExternalLink, startAt, dueAt)
+	if err != nil {
+		writeDatabaseError(w, err, "project", 0)
+		return
+	}
+	writeJSON(w, http.StatusCreated, project)
+}
+
+// handleProject handles the /api/projects/{id} endpoint
+func (ws *WebServer) handleProject(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		project, err := ws.db.GetProject(id)
+		if err != nil {
+			writeDatabaseError(w, err, "project", id)
+			return
+		}
+		writeJSON(w, http.StatusOK, project)
+	case http.MethodPatch:
+		var req struct {
+			Name         *string `json:"name"`
+			Description  *string `json:"description"`
+			Status       *string `json:"status"`
+			ExternalLink *string `json:"external_link"`
+			StartAt      *string `json:"start_at"`
+			DueAt        *string `json:"due_at"`
+		}
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+		if req.Name != nil && *req.Name == "" {
+			writeError(w, http.StatusUnprocessableEntity, "name cannot be empty")
+			return
+		}
+		startAt, dueAt, err := ws.db.ParseDates(req.StartAt, req.DueAt)
+		if err != nil {
+			writeDatabaseError(w, err, "project", id)
+			return
+		}
+		project, err := ws.db.WithActor(requestActor(r)).UpdateProject(id, req.Name, req.Description, req.Status, req.ExternalLink, startAt, dueAt)
+		if err != nil {
+			writeDatabaseError(w, err, "project", id)
+			return
+		}
+		writeJSON(w, http.StatusOK, project)
+	case http.MethodDelete:
+		if err := ws.db.WithActor(requestActor(r)).DeleteProject(id); err != nil {
+			writeDatabaseError(w, err, "project", id)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// createTask creates a task from the JSON request body
+func (ws *WebServer) createTask(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ProjectID    int64  `json:"project_id"`
+		ParentTaskID *int64 `json:"parent_task_id"`
+		Title        string `json:"title"`
+		Description  string `json:"description"`
+		Status       string `json:"status"`
+		Priority     string `json:"priority"`
+		TaskType     string `json:"task_type"`
+		ExternalLink string `json:"external_link"`
+		Assignee     string `json:"assignee"`
+		Reviewer     string `json:"reviewer"`
+		StartAt      string `json:"start_at"`
+		DueAt        string `json:"due_at"`
+		Recurrence   string `json:"recurrence"`
+	}
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	if req.ProjectID == 0 {
+		writeError(w, http.StatusUnprocessableEntity, "project_id is required")
+		return
+	}
+	if req.Title == "" {
+		writeError(w, http.StatusUnprocessableEntity, "title is required")
+		return
+	}
+
+	startAt, dueAt, err := ws.db.ParseDates(&req.StartAt, &req.DueAt)
+	if err != nil {
+		writeDatabaseError(w, err, "task", 0)
+		return
+	}
+	if err := checkRecurrence(req.Recurrence, dueAt); err != nil {
+		writeDatabaseError(w, err, "task", 0)
+		return
+	}
+	actorDB := ws.db.WithActor(requestActor(r))
+	task, err := actorDB.CreateTask(req.ProjectID, req.ParentTaskID, req.Title, req.Description, req.Status, req.Priority, req.TaskType, req.ExternalLink, req.Assignee, req.Reviewer, startAt, dueAt)
+	if err != nil {
+		writeDatabaseError(w, err, "task", 0)
+		return
+	}
+	if req.Recurrence != "" {
+		if task, err = setTaskRecurrence(actorDB, task.ID, req.Recurrence); err != nil {
+			writeDatabaseError(w, err, "task", 0)
+			return
+		}
+	}
+	writeJSON(w, http.StatusCreated, task)
+}
+
+// handleTask handles the /api/tasks/{id} endpoint
+func (ws *WebServer) handleTask(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		task, err := ws.db.GetTask(id)
+		if err != nil {
+			writeDatabaseError(w, err, "task", id)
+			return
+		}
+		writeJSON(w, http.StatusOK, task)
+	case http.MethodPatch:
+		var req struct {
+			Title        *string `json:"title"`
+			Description  *string `json:"description"`
+			Status       *string `json:"status"`
+			Priority     *string `json:"priority"`
+			TaskType     *string `json:"task_type"`
+			ExternalLink *string `json:"external_link"`
+			Assignee     *string `json:"assignee"`
+			Reviewer     *string `json:"reviewer"`
+			ParentTaskID *int64  `json:"parent_task_id"`
+			StartAt      *string `json:"start_at"`
+			DueAt        *string `json:"due_at"`
+			Recurrence   *string `json:"recurrence"`
+		}
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+		if req.Title != nil && *req.Title == "" {
+			writeError(w, http.StatusUnprocessableEntity, "title cannot be empty")
+			return
+		}
+		startAt, dueAt, err := ws.db.ParseDates(req.StartAt, req.DueAt)
+		if err != nil {
+			writeDatabaseError(w, err, "task", id)
+			return
+		}
+		if req.Recurrence != nil && *req.Recurrence != "" {
+			if _, err := ParseRecurrenceRule(*req.Recurrence); err != nil {
+				writeDatabaseError(w, err, "task", id)
+				return
+			}
+		}
+		actorDB := ws.db.WithActor(requestActor(r))
+		task, err := actorDB.UpdateTask(id, req.Title, req.Description, req.Status, req.Priority, req.TaskType, req.ExternalLink, req.Assignee, req.Reviewer, req.ParentTaskID, startAt, dueAt)
+		if err != nil {
+			writeDatabaseError(w, err, "task", id)
+			return
+		}
+		if req.Recurrence != nil {
+			if task, err = setTaskRecurrence(actorDB, id, *req.Recurrence); err != nil {
+				writeDatabaseError(w, err, "task", id)
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, task)
+	case http.MethodDelete:
+		if err := ws.db.WithActor(requestActor(r)).DeleteTask(id); err != nil {
+			writeDatabaseError(w, err, "task", id)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleTaskNotes handles the /api/tasks/{id}/notes endpoint
+func (ws *WebServer) handleTaskNotes(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	taskID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	if _, err := ws.db.GetTask(taskID); err != nil {
+		writeDatabaseError(w, err, "task", taskID)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		notes, err := ws.db.ListTaskNotes(taskID)
+		if err != nil {
+			writeDatabaseError(w, err, "task", taskID)
+			return
+		}
+		if notes == nil {
+			notes = []*TaskNote{}
+		}
+		writeJSON(w, http.StatusOK, notes)
+	case http.MethodPost:
+		var req struct {
+			Note string `json:"note"`
+		}
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+		if req.Note == "" {
+			writeError(w, http.StatusUnprocessableEntity, "note is required")
+			return
+		}
+		note, err := ws.db.WithActor(requestActor(r)).CreateTaskNote(taskID, req.Note)
+		if err != nil {
+			writeDatabaseError(w, err, "task", taskID)
+			return
+		}
+		writeJSON(w, http.StatusCreated, note)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleTaskNote handles the /api/tasks/{id}/notes/{note_id} endpoint
+func (ws *WebServer) handleTaskNote(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	taskID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	noteID, ok := pathID(w, r, "note_id")
+	if !ok {
+		return
+	}
+
+	// A note is only addressable through the task it belongs to
+	note, err := ws.db.GetTaskNote(noteID)
+	if err == nil && note.TaskID != taskID {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		writeDatabaseError(w, err, "task note", noteID)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, note)
+	case http.MethodPatch:
+		var req struct {
+			Note *string `json:"note"`
+		}
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+		if req.Note == nil || *req.Note == "" {
+			writeError(w, http.StatusUnprocessableEntity, "note is required")
+			return
+		}
+		note, err := ws.db.WithActor(requestActor(r)).UpdateTaskNote(noteID, *req.Note)
+		if err != nil {
+			writeDatabaseError(w, err, "task note", noteID)
+			return
+		}
+		writeJSON(w, http.StatusOK, note)
+	case http.MethodDelete:
+		if err := ws.db.WithActor(requestActor(r)).DeleteTaskNote(noteID); err != nil {
+			writeDatabaseError(w, err, "task note", noteID)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// createProblem creates a problem from the JSON request body
+func (ws *WebServer) createProblem(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ProjectID   *int64 `json:"project_id"`
+		TaskID      *int64 `json:"task_id"`
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Status      string `json:"status"`
+		Assignee    string `json:"assignee"`
+	}
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	if req.Title == "" {
+		writeError(w, http.StatusUnprocessableEntity, "title is required")
+		return
+	}
+
+	problem, err := ws.db.WithActor(requestActor(r)).CreateProblem(req.ProjectID, req.TaskID, req.Title, req.Description, req.Status, req.Assignee)
+	if err != nil {
+		writeDatabaseError(w, err, "problem", 0)
+		return
+	}
+	writeJSON(w, http.StatusCreated, problem)
+}
+
+// handleTaskDependencies handles the /api/tasks/{id}/dependencies endpoint
+func (ws *WebServer) handleTaskDependencies(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	taskID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	if _, err := ws.db.GetTask(taskID); err != nil {
+		writeDatabaseError(w, err, "task", taskID)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		tasks, err := ws.db.GetTaskDependencies(taskID)
+		if err != nil {
+			writeDatabaseError(w, err, "task", taskID)
+			return
+		}
+		writeJSON(w, http.StatusOK, tasks)
+	case http.MethodPost:
+		var req struct {
+			DependsOnID int64 `json:"depends_on_id"`
+		}
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+		if req.DependsOnID == 0 {
+			writeError(w, http.StatusUnprocessableEntity, "depends_on_id is required")
+			return
+		}
+		if err := ws.db.WithActor(requestActor(r)).AddTaskDependency(taskID, req.DependsOnID); err != nil {
+			writeDatabaseError(w, err, "task", taskID)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleTaskDependency handles the /api/tasks/{id}/dependencies/{depends_on_id} endpoint
+func (ws *WebServer) handleTaskDependency(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	taskID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	dependsOnID, ok := pathID(w, r, "depends_on_id")
+	if !ok {
+		return
+	}
+
+	if err := ws.db.WithActor(requestActor(r)).RemoveTaskDependency(taskID, dependsOnID); err != nil {
+		writeDatabaseError(w, err, "task", taskID)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleTaskBlockers handles GET /api/tasks/{id}/blockers
+func (ws *WebServer) handleTaskBlockers(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	taskID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	blockers, err := ws.db.GetTaskBlockers(taskID)
+	if err != nil {
+		writeDatabaseError(w, err, "task", taskID)
+		return
+	}
+	writeJSON(w, http.StatusOK, blockers)
+}
+
+// handleTaskTree handles GET /api/tasks/{id}/tree
+func (ws *WebServer) handleTaskTree(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	taskID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	tree, err := ws.db.GetTaskTree(taskID)
+	if err != nil {
+		writeDatabaseError(w, err, "task", taskID)
+		return
+	}
+	writeJSON(w, http.StatusOK, tree)
+}
+
+// handleProblem handles the /api/problems/{id} endpoint
+func (ws *WebServer) handleProblem(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		problem, err := ws.db.GetProblem(id)
+		if err != nil {
+			writeDatabaseError(w, err, "problem", id)
+			return
+		}
+		writeJSON(w, http.StatusOK, problem)
+	case http.MethodPatch:
+		var req struct {
+			Title       *string `json:"title"`
+			Description *string `json:"description"`
+			Status      *string `json:"status"`
+			Assignee    *string `json:"assignee"`
+			ProjectID   *int64  `json:"project_id"`
+			TaskID      *int64  `json:"task_id"`
+		}
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+		if req.Title != nil && *req.Title == "" {
+			writeError(w, http.StatusUnprocessableEntity, "title cannot be empty")
+			return
+		}
+		problem, err := ws.db.WithActor(requestActor(r)).UpdateProblem(id, req.Title, req.Description, req.Status, req.Assignee, req.ProjectID, req.TaskID)
+		if err != nil {
+			writeDatabaseError(w, err, "problem", id)
+			return
+		}
+		writeJSON(w, http.StatusOK, problem)
+	case http.MethodDelete:
+		if err := ws.db.WithActor(requestActor(r)).DeleteProblem(id); err != nil {
+			writeDatabaseError(w, err, "problem", id)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleProblemProjects handles the /api/problems/{id}/projects endpoint
+func (ws *WebServer) handleProblemProjects(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	problemID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	if _, err := ws.db.GetProblem(problemID); err != nil {
+		writeDatabaseError(w, err, "problem", problemID)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		projects, err := ws.db.GetProblemProjects(problemID)
+		if err != nil {
+			writeDatabaseError(w, err, "problem", problemID)
+			return
+		}
+		if projects == nil {
+			projects = []*Project{}
+		}
+		writeJSON(w, http.StatusOK, projects)
+	case http.MethodPost:
+		var req struct {
+			ProjectID int64 `json:"project_id"`
+		}
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+		if req.ProjectID == 0 {
+			writeError(w, http.StatusUnprocessableEntity, "project_id is required")
+			return
+		}
+		if err := ws.db.WithActor(requestActor(r)).LinkProblemToProject(problemID, req.ProjectID); err != nil {
+			writeDatabaseError(w, err, "problem", problemID)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleProblemProject handles the /api/problems/{id}/projects/{project_id} endpoint
+func (ws *WebServer) handleProblemProject(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	problemID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	projectID, ok := pathID(w, r, "project_id")
+	if !ok {
+		return
+	}
+
+	if err := ws.db.WithActor(requestActor(r)).UnlinkProblemFromProject(problemID, projectID); err != nil {
+		writeDatabaseError(w, err, "problem", problemID)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// createOutcome creates an outcome from the JSON request body
+func (ws *WebServer) createOutcome(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ProjectID   int64  `json:"project_id"`
+		TaskID      *int64 `json:"task_id"`
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Status      string `json:"status"`
+		StartAt     string `json:"start_at"`
+		DueAt       string `json:"due_at"`
+	}
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	if req.ProjectID == 0 {
+		writeError(w, http.StatusUnprocessableEntity, "project_id is required")
+		return
+	}
+	if req.Title == "" {
+		writeError(w, http.StatusUnprocessableEntity, "title is required")
+		return
+	}
+
+	startAt, dueAt, err := ws.db.ParseDates(&req.StartAt, &req.DueAt)
+	if err != nil {
+		writeDatabaseError(w, err, "outcome", 0)
+		return
+	}
+	outcome, err := ws.db.WithActor(requestActor(r)).CreateOutcome(req.ProjectID, req.TaskID, req.Title, req.Description, req.Status, startAt, dueAt)
+	if err != nil {
+		writeDatabaseError(w, err, "outcome", 0)
+		return
+	}
+	writeJSON(w, http.StatusCreated, outcome)
+}
+
+// handleOutcome handles the /api/outcomes/{id} endpoint
+func (ws *WebServer) handleOutcome(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		outcome, err := ws.db.GetOutcome(id)
+		if err != nil {
+			writeDatabaseError(w, err, "outcome", id)
+			return
+		}
+		writeJSON(w, http.StatusOK, outcome)
+	case http.MethodPatch:
+		var req struct {
+			Title       *string `json:"title"`
+			Description *string `json:"description"`
+			Status      *string `json:"status"`
+			ProjectID   *int64  `json:"project_id"`
+			TaskID      *int64  `json:"task_id"`
+			StartAt     *string `json:"start_at"`
+			DueAt       *string `json:"due_at"`
+		}
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+		if req.Title != nil && *req.Title == "" {
+			writeError(w, http.StatusUnprocessableEntity, "title cannot be empty")
+			return
+		}
+		startAt, dueAt, err := ws.db.ParseDates(req.StartAt, req.DueAt)
+		if err != nil {
+			writeDatabaseError(w, err, "outcome", id)
+			return
 		}
+		outcome, err := ws.db.WithActor(requestActor(r)).UpdateOutcome(id, req.Title, req.Description, req.Status, req.ProjectID, req.TaskID, startAt, dueAt)
+		if err != nil {
+			writeDatabaseError(w, err, "outcome", id)
+			return
+		}
+		writeJSON(w, http.StatusOK, outcome)
+	case http.MethodDelete:
+		if err := ws.db.WithActor(requestActor(r)).DeleteOutcome(id); err != nil {
+			writeDatabaseError(w, err, "outcome", id)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
 	}
+}
 
-	if s := r.URL.Query().Get("status"); s != "" {
-		status = &s
+// createGoal creates a goal from the JSON request body
+func (ws *WebServer) createGoal(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ProjectID   *int64 `json:"project_id"`
+		TaskID      *int64 `json:"task_id"`
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		GoalType    string `json:"goal_type"`
+		Assignee    string `json:"assignee"`
+		StartAt     string `json:"start_at"`
+		DueAt       string `json:"due_at"`
 	}
-
-	if t := r.URL.Query().Get("task_type"); t != "" {
-		taskType = &t
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	if req.Title == "" {
+		writeError(w, http.StatusUnprocessableEntity, "title is required")
+		return
 	}
 
-	tasks, err := ws.db.ListTasks(projectID, status, taskType)
+	startAt, dueAt, err := ws.db.ParseDates(&req.StartAt, &req.DueAt)
 	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
+		writeDatabaseError(w, err, "goal", 0)
 		return
 	}
-
-	if tasks == nil {
-		tasks = []*Task{}
+	goal, err := ws.db.WithActor(requestActor(r)).CreateGoal(req.ProjectID, req.TaskID, req.Title, req.Description, req.GoalType, req.Assignee, startAt, dueAt)
+	if err != nil {
+		writeDatabaseError(w, err, "goal", 0)
+		return
 	}
-
-	json.NewEncoder(w).Encode(tasks)
+	writeJSON(w, http.StatusCreated, goal)
 }
 
-// handleProblems handles the /api/problems endpoint
-func (ws *WebServer) handleProblems(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+// handleGoal handles the /api/goals/{id} endpoint
+func (ws *WebServer) handleGoal(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
 
-	var projectID *int64
-	var taskID *int64
-	var status *string
-	var assignee *string
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
 
-	if pidStr := r.URL.Query().Get("project_id"); pidStr != "" {
-		if pid, err := strconv.ParseInt(pidStr, 10, 64); err == nil {
-			projectID = &pid
+	switch r.Method {
+	case http.MethodGet:
+		goal, err := ws.db.GetGoal(id)
+		if err != nil {
+			writeDatabaseError(w, err, "goal", id)
+			return
+		}
+		writeJSON(w, http.StatusOK, goal)
+	case http.MethodPatch:
+		var req struct {
+			Title       *string `json:"title"`
+			Description *string `json:"description"`
+			GoalType    *string `json:"goal_type"`
+			Assignee    *string `json:"assignee"`
+			ProjectID   *int64  `json:"project_id"`
+			TaskID      *int64  `json:"task_id"`
+			StartAt     *string `json:"start_at"`
+			DueAt       *string `json:"due_at"`
 		}
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+		if req.Title != nil && *req.Title == "" {
+			writeError(w, http.StatusUnprocessableEntity, "title cannot be empty")
+			return
+		}
+		startAt, dueAt, err := ws.db.ParseDates(req.StartAt, req.DueAt)
+		if err != nil {
+			writeDatabaseError(w, err, "goal", id)
+			return
+		}
+		goal, err := ws.db.WithActor(requestActor(r)).UpdateGoal(id, req.Title, req.Description, req.GoalType, req.Assignee, req.ProjectID, req.TaskID, startAt, dueAt)
+		if err != nil {
+			writeDatabaseError(w, err, "goal", id)
+			return
+		}
+		writeJSON(w, http.StatusOK, goal)
+	case http.MethodDelete:
+		if err := ws.db.WithActor(requestActor(r)).DeleteGoal(id); err != nil {
+			writeDatabaseError(w, err, "goal", id)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
 	}
+}
 
-	if tidStr := r.URL.Query().Get("task_id"); tidStr != "" {
-		if tid, err := strconv.ParseInt(tidStr, 10, 64); err == nil {
-			taskID = &tid
-		}
+// handleGoalProjects handles the /api/goals/{id}/projects endpoint
+func (ws *WebServer) handleGoalProjects(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
 	}
 
-	if s := r.URL.Query().Get("status"); s != "" {
-		status = &s
+	goalID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	if _, err := ws.db.GetGoal(goalID); err != nil {
+		writeDatabaseError(w, err, "goal", goalID)
+		return
 	}
 
-	if a := r.URL.Query().Get("assignee"); a != "" {
-		assignee = &a
+	switch r.Method {
+	case http.MethodGet:
+		projects, err := ws.db.GetGoalProjects(goalID)
+		if err != nil {
+			writeDatabaseError(w, err, "goal", goalID)
+			return
+		}
+		if projects == nil {
+			projects = []*Project{}
+		}
+		writeJSON(w, http.StatusOK, projects)
+	case http.MethodPost:
+		var req struct {
+			ProjectID int64 `json:"project_id"`
+		}
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+		if req.ProjectID == 0 {
+			writeError(w, http.StatusUnprocessableEntity, "project_id is required")
+			return
+		}
+		if err := ws.db.WithActor(requestActor(r)).LinkGoalToProject(goalID, req.ProjectID); err != nil {
+			writeDatabaseError(w, err, "goal", goalID)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
 	}
+}
 
-	problems, err := ws.db.ListProblems(projectID, taskID, status, assignee)
-	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
+// handleGoalProject handles the /api/goals/{id}/projects/{project_id} endpoint
+func (ws *WebServer) handleGoalProject(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
 
-	if problems == nil {
-		problems = []*Problem{}
+	goalID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	projectID, ok := pathID(w, r, "project_id")
+	if !ok {
+		return
 	}
 
-	json.NewEncoder(w).Encode(problems)
+	if err := ws.db.WithActor(requestActor(r)).UnlinkGoalFromProject(goalID, projectID); err != nil {
+		writeDatabaseError(w, err, "goal", goalID)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
-// handleOutcomes handles the /api/outcomes endpoint
-func (ws *WebServer) handleOutcomes(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-
-	var projectID *int64
-	var taskID *int64
-	var status *string
+// --- JSON helpers ---
 
-	if pidStr := r.URL.Query().Get("project_id"); pidStr != "" {
-		if pid, err := strconv.ParseInt(pidStr, 10, 64); err == nil {
-			projectID = &pid
-		}
+// requestActor identifies the caller of a REST request for the activity log.
+// Requests authenticated with a token are recorded as the token. Otherwise
+// callers can name themselves with the X-Loom-Actor header, or their address
+// is used.
+func requestActor(r *http.Request) string {
+	if token := tokenFromContext(r.Context()); token != nil {
+		return token.Actor()
 	}
+	if name := strings.TrimSpace(r.Header.Get("X-Loom-Actor")); name != "" {
+		return "rest:" + name
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "rest:" + host
+}
 
-	if tidStr := r.URL.Query().Get("task_id"); tidStr != "" {
-		if tid, err := strconv.ParseInt(tidStr, 10, 64); err == nil {
-			taskID = &tid
+// parseDueFilter reads the due_before, due_after and overdue query
+// parameters of a list endpoint
+func parseDueFilter(db *Database, r *http.Request) (DueFilter, error) {
+	query := r.URL.Query()
+	var overdue bool
+	if s := query.Get("overdue"); s != "" {
+		var err error
+		if overdue, err = strconv.ParseBool(s); err != nil {
+			return DueFilter{}, fmt.Errorf("invalid overdue: %q", s)
 		}
 	}
+	return db.ParseDueFilter(query.Get("due_before"), query.Get("due_after"), overdue)
+}
 
-	if s := r.URL.Query().Get("status"); s != "" {
-		status = &s
+// parseTagFilter reads the tag and tag_match query parameters of a list
+// endpoint. tag may be repeated, and a list needs all of the tags unless
+// tag_match=any.
+func parseTagFilter(r *http.Request) (TagFilter, error) {
+	query := r.URL.Query()
+	return ParseTagFilter(strings.Join(query["tag"], ","), query.Get("tag_match"))
+}
+
+// parseListOptions reads the limit, cursor, sort, order and fields query
+// parameters of a list endpoint. Without a limit every row is returned.
+func parseListOptions(r *http.Request) (ListOptions, []string, error) {
+	q := r.URL.Query()
+	opts := ListOptions{
+		Cursor: q.Get("cursor"),
+		Sort:   q.Get("sort"),
+		Order:  q.Get("order"),
+	}
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			return opts, nil, fmt.Errorf("invalid limit: %q", l)
+		}
+		opts.Limit = n
 	}
+	return opts, parseFields(q.Get("fields")), nil
+}
 
-	outcomes, err := ws.db.ListOutcomes(projectID, taskID, status)
+// writeList writes a page of items as a JSON array, keeping only the given
+// fields of each item. The total count and the cursor for the next page are
+// sent in the X-Total-Count and X-Next-Cursor headers.
+func writeList(w http.ResponseWriter, items interface{}, page *PageInfo, fields []string) {
+	projected, err := projectFields(items, fields)
 	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
+		writeDatabaseError(w, err, "", 0)
 		return
 	}
-
-	if outcomes == nil {
-		outcomes = []*Outcome{}
+	w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	if page.NextCursor != "" {
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
 	}
-
-	json.NewEncoder(w).Encode(outcomes)
+	writeJSON(w, http.StatusOK, projected)
 }
 
-// handleGoals handles the /api/goals endpoint
-func (ws *WebServer) handleGoals(w http.ResponseWriter, r *http.Request) {
+// writeJSON writes data as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
 
-	var projectID *int64
-	var taskID *int64
-	var goalType *string
-	var assignee *string
+// writeError writes a JSON error response with the given status code
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
 
-	if pidStr := r.URL.Query().Get("project_id"); pidStr != "" {
-		if pid, err := strconv.ParseInt(pidStr, 10, 64); err == nil {
-			projectID = &pid
-		}
+// writeDatabaseError maps an error from the database layer to an HTTP status:
+// missing rows become 404, invalid enum values, references to missing or
+// mismatched projects and tasks, dependency cycles and constraint
+// violations become 422, status
+// changes the workflow forbids become 409, missing or invalid API tokens
+// become 401, requests the token does not allow become 403, and anything
+// else is a 500.
+func writeDatabaseError(w http.ResponseWriter, err error, entity string, id int64) {
+	switch {
+	case errors.Is(err, ErrUnauthorized):
+		writeError(w, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, ErrForbidden):
+		writeError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, sql.ErrNoRows):
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%s with ID %d not found", entity, id))
+	case errors.Is(err, ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrInvalidValue), errors.Is(err, ErrInvalidReference), errors.As(err, new(*ProjectMismatchError)), errors.As(err, new(*DependencyCycleError)):
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+	case errors.Is(err, ErrInvalidTransition):
+		writeError(w, http.StatusConflict, err.Error())
+	case strings.Contains(err.Error(), "constraint failed"):
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
 	}
+}
 
-	if tidStr := r.URL.Query().Get("task_id"); tidStr != "" {
-		if tid, err := strconv.ParseInt(tidStr, 10, 64); err == nil {
-			taskID = &tid
-		}
+// decodeJSONBody decodes the request body into v, writing a 400 response
+// and returning false if the body is not valid JSON
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return false
 	}
+	return true
+}
 
-	if g := r.URL.Query().Get("goal_type"); g != "" {
-		goalType = &g
+// pathID parses the named path segment as an ID, writing a 400 response
+// and returning false if it is not a positive integer
+func pathID(w http.ResponseWriter, r *http.Request, name string) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue(name), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid %s: %q", name, r.PathValue(name)))
+		return 0, false
 	}
+	return id, true
+}
 
-	if a := r.URL.Query().Get("assignee"); a != "" {
-		assignee = &a
+// queryID parses the named query parameter as an ID, returning nil if it is
+// not set, or writing a 400 response and returning false if it is not an
+// integer
+func queryID(w http.ResponseWriter, r *http.Request, name string) (*int64, bool) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return nil, true
 	}
-
-	goals, err := ws.db.ListGoals(projectID, taskID, goalType, assignee)
+	id, err := strconv.ParseInt(s, 10, 64)
 	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
-		return
-	}
-
-	if goals == nil {
-		goals = []*Goal{}
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid %s: %q", name, s))
+		return nil, false
 	}
-
-	json.NewEncoder(w).Encode(goals)
+	return &id, true
 }
 
 // handleVoice handles text-to-speech conversion
@@ -338,7 +2613,8 @@ func (ws *WebServer) handleVoice(w http.ResponseWriter, r *http.Request) {
 
 	// Parse the JSON request body
 	var req struct {
-		Text string `json:"text"`
+		Text  string `json:"text"`
+		Voice string `json:"voice"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
@@ -350,12 +2626,21 @@ func (ws *WebServer) handleVoice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Synthesis can take longer than other requests are allowed
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(voiceTimeout))
+
 	// Validate text length to prevent abuse
 	if len(req.Text) > 5000 {
 		http.Error(w, "Text too long (max 5000 characters)", http.StatusBadRequest)
 		return
 	}
 
+	// The voice name ends up on the command line, so only allow plain names
+	if req.Voice != "" && !voiceNamePattern.MatchString(req.Voice) {
+		http.Error(w, "Invalid voice name", http.StatusBadRequest)
+		return
+	}
+
 	// Create temporary file securely
 	tmpFile, err := os.CreateTemp("", "loom-tts-*.wav")
 	if err != nil {
@@ -372,10 +2657,22 @@ func (ws *WebServer) handleVoice(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
-	// Use echogarden to synthesize speech with Kokoro offline TTS
+	// Use echogarden to synthesize speech, by default with Kokoro offline TTS
 	// Kokoro provides higher quality natural-sounding voices than espeak
 	// The text is passed as a command argument - echogarden handles escaping internally
-	cmd := exec.Command("echogarden", "speak", req.Text, tmpFilePath, "--engine=kokoro")
+	engine := ws.ttsEngine
+	if engine == "" {
+		engine = DefaultTTSEngine
+	}
+	voice := req.Voice
+	if voice == "" {
+		voice = ws.ttsVoice
+	}
+	args := []string{"speak", req.Text, tmpFilePath, "--engine=" + engine}
+	if voice != "" {
+		args = append(args, "--voice="+voice)
+	}
+	cmd := exec.Command("echogarden", args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		log.Printf("TTS generation failed: %v\nOutput: %s", err, string(output))
@@ -403,23 +2700,80 @@ func (ws *WebServer) handleVoice(w http.ResponseWriter, r *http.Request) {
 	// Send the audio file as response
 	w.Header().Set("Content-Type", "audio/wav")
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(audioData)))
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Write(audioData)
 }
 
+// handleAnnounce relays a voice message to connected dashboard clients and
+// reports how many were listening. It lets MCP servers running in another
+// process (such as the stdio transport) speak on a running dashboard.
+func (ws *WebServer) handleAnnounce(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var msg VoiceMessage
+	if !decodeJSONBody(w, r, &msg) {
+		return
+	}
+	if err := msg.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	listeners := ws.broadcast("voice", msg)
+	writeJSON(w, http.StatusOK, map[string]int{"listeners": listeners})
+}
+
+// loopbackAddr returns addr bound to localhost. An address without a host
+// listens on every interface, so it is narrowed to 127.0.0.1; any other
+// host must already be a loopback address.
+func loopbackAddr(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if host == "" {
+		return net.JoinHostPort("127.0.0.1", port), nil
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return "", fmt.Errorf("%s is not a loopback address", host)
+	}
+	return addr, nil
+}
+
+// exposedAddr reports whether a server listening on addr can be reached from
+// other machines
+func exposedAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	_, err = loopbackAddr(addr)
+	return host == "" || err != nil
+}
+
 // apiBaseURL returns the base URL for the API server based on the request host and API address.
 func (ws *WebServer) apiBaseURL(r *http.Request) string {
-	hostname := r.Host
-	// Extract the hostname (without port) from the request
-	if h, _, err := net.SplitHostPort(r.Host); err == nil {
+	return serverOrigin(r.Host, ws.addr)
+}
+
+// serverOrigin returns the origin of the server listening on addr, reached
+// through the same hostname as host. The dashboard calls the API at the
+// hostname it was loaded from, so the API sees the dashboard's origin as the
+// request's hostname with the dashboard's port.
+func serverOrigin(host, addr string) string {
+	hostname := host
+	// Extract the hostname (without port) from the host
+	if h, _, err := net.SplitHostPort(host); err == nil {
 		hostname = h
 	}
-	// Extract the port from the API address
-	apiPort := ws.addr
-	if _, p, err := net.SplitHostPort(ws.addr); err == nil {
-		apiPort = p
+	// Extract the port from the server address
+	port := addr
+	if _, p, err := net.SplitHostPort(addr); err == nil {
+		port = p
 	}
-	return fmt.Sprintf("http://%s:%s", hostname, apiPort)
+	return "http://" + net.JoinHostPort(hostname, port)
 }
 
 // handleDashboard serves the main dashboard HTML
@@ -740,6 +3094,45 @@ const dashboardHTML = `<!DOCTYPE html>
             border-color: var(--accent-blue);
         }
 
+        /* Tags */
+        .tag-filter {
+            display: flex;
+            gap: 6px;
+            align-items: center;
+            flex-wrap: wrap;
+        }
+
+        .tag-chip {
+            display: inline-flex;
+            align-items: center;
+            padding: 3px 10px;
+            border-radius: 999px;
+            font-size: 12px;
+            font-weight: 500;
+            color: var(--tag-color);
+            background: color-mix(in srgb, var(--tag-color) 15%, transparent);
+            border: 1px solid color-mix(in srgb, var(--tag-color) 40%, transparent);
+        }
+
+        .tag-filter .tag-chip {
+            cursor: pointer;
+            opacity: 0.6;
+        }
+
+        .tag-filter .tag-chip.selected {
+            opacity: 1;
+            background: color-mix(in srgb, var(--tag-color) 35%, transparent);
+        }
+
+        .tag-match-toggle {
+            background: none;
+            border: none;
+            color: var(--text-secondary);
+            font-size: 12px;
+            cursor: pointer;
+            text-decoration: underline;
+        }
+
         /* Content Sections */
         .content-section {
             display: none;
@@ -837,32 +3230,151 @@ const dashboardHTML = `<!DOCTYPE html>
             font-weight: 500;
         }
 
-        .badge.status-pending { background: rgba(139, 153, 166, 0.2); color: var(--text-secondary); }
-        .badge.status-in_progress { background: rgba(29, 155, 240, 0.2); color: var(--accent-blue); }
-        .badge.status-completed { background: rgba(0, 186, 124, 0.2); color: var(--accent-green); }
-        .badge.status-blocked { background: rgba(244, 33, 46, 0.2); color: var(--accent-red); }
-        .badge.status-open { background: rgba(255, 217, 61, 0.2); color: var(--accent-yellow); }
-        .badge.status-resolved { background: rgba(0, 186, 124, 0.2); color: var(--accent-green); }
-        .badge.status-active { background: rgba(0, 186, 124, 0.2); color: var(--accent-green); }
-        .badge.status-planning { background: rgba(29, 155, 240, 0.2); color: var(--accent-blue); }
-        .badge.status-on_hold { background: rgba(255, 217, 61, 0.2); color: var(--accent-yellow); }
-        .badge.status-archived { background: rgba(139, 153, 166, 0.2); color: var(--text-secondary); }
+        .badge.status-pending { background: rgba(139, 153, 166, 0.2); color: var(--text-secondary); }
+        .badge.status-in_progress { background: rgba(29, 155, 240, 0.2); color: var(--accent-blue); }
+        .badge.status-completed { background: rgba(0, 186, 124, 0.2); color: var(--accent-green); }
+        .badge.status-blocked { background: rgba(244, 33, 46, 0.2); color: var(--accent-red); }
+        .badge.status-open { background: rgba(255, 217, 61, 0.2); color: var(--accent-yellow); }
+        .badge.status-resolved { background: rgba(0, 186, 124, 0.2); color: var(--accent-green); }
+        .badge.status-active { background: rgba(0, 186, 124, 0.2); color: var(--accent-green); }
+        .badge.status-planning { background: rgba(29, 155, 240, 0.2); color: var(--accent-blue); }
+        .badge.status-on_hold { background: rgba(255, 217, 61, 0.2); color: var(--accent-yellow); }
+        .badge.status-archived { background: rgba(139, 153, 166, 0.2); color: var(--text-secondary); }
+
+        .badge.priority-low { background: rgba(139, 153, 166, 0.2); color: var(--text-secondary); }
+        .badge.priority-medium { background: rgba(255, 217, 61, 0.2); color: var(--accent-yellow); }
+        .badge.priority-high { background: rgba(244, 33, 46, 0.2); color: var(--accent-red); }
+        .badge.priority-urgent { background: rgba(244, 33, 46, 0.4); color: #ff6b6b; }
+
+        .badge.type-general { background: rgba(139, 153, 166, 0.2); color: var(--text-secondary); }
+        .badge.type-feature { background: rgba(155, 89, 182, 0.2); color: var(--accent-purple); }
+        .badge.type-bugfix { background: rgba(244, 33, 46, 0.2); color: var(--accent-red); }
+        .badge.type-chore { background: rgba(29, 155, 240, 0.2); color: var(--accent-blue); }
+        .badge.type-investigation { background: rgba(255, 217, 61, 0.2); color: var(--accent-yellow); }
+
+        .badge.goal-short_term { background: rgba(29, 155, 240, 0.2); color: var(--accent-blue); }
+        .badge.goal-career { background: rgba(155, 89, 182, 0.2); color: var(--accent-purple); }
+        .badge.goal-values { background: rgba(0, 186, 124, 0.2); color: var(--accent-green); }
+        .badge.goal-requirement { background: rgba(255, 217, 61, 0.2); color: var(--accent-yellow); }
+
+        .badge.dependency-waiting { background: rgba(244, 33, 46, 0.2); color: var(--accent-red); }
+        .badge.dependency-ready { background: rgba(0, 186, 124, 0.2); color: var(--accent-green); }
+
+        .badge.due-upcoming { background: rgba(29, 155, 240, 0.2); color: var(--accent-blue); }
+        .badge.due-overdue { background: rgba(244, 33, 46, 0.2); color: var(--accent-red); }
+        .badge.recurring { background: rgba(155, 89, 182, 0.2); color: var(--accent-purple); }
+        .badge.person { background: var(--bg-hover); color: var(--text-primary); }
+
+        /* Subtasks */
+        .subtasks {
+            margin-top: 12px;
+            font-size: 12px;
+            color: var(--text-secondary);
+        }
+
+        .progress-bar {
+            height: 6px;
+            margin: 4px 0 8px;
+            border-radius: 3px;
+            background: var(--bg-hover);
+            overflow: hidden;
+        }
+
+        .progress-bar-fill {
+            height: 100%;
+            background: var(--accent-green);
+        }
+
+        .subtask-list {
+            list-style: none;
+            padding-left: 10px;
+            border-left: 2px solid var(--border-color);
+        }
+
+        .subtask-list .subtask-list { margin: 4px 0 0 4px; }
+
+        .subtask-item { padding: 3px 0; }
+
+        .subtask-row {
+            display: flex;
+            align-items: center;
+            gap: 6px;
+            cursor: pointer;
+            color: var(--text-primary);
+        }
+
+        .subtask-row:hover .subtask-title { color: var(--accent-blue); }
+        .subtask-item.completed > .subtask-row .subtask-title { text-decoration: line-through; color: var(--text-secondary); }
+
+        /* Calendar */
+        .calendar-controls {
+            display: flex;
+            align-items: center;
+            gap: 12px;
+            margin-bottom: 16px;
+        }
+
+        .calendar-month {
+            font-size: 16px;
+            font-weight: 600;
+            min-width: 160px;
+            text-align: center;
+        }
+
+        .calendar-grid {
+            display: grid;
+            grid-template-columns: repeat(7, 1fr);
+            gap: 4px;
+        }
+
+        .calendar-weekday {
+            padding: 6px;
+            font-size: 12px;
+            color: var(--text-secondary);
+            text-align: center;
+        }
+
+        .calendar-day {
+            min-height: 100px;
+            padding: 6px;
+            background: var(--bg-secondary);
+            border: 1px solid var(--border-color);
+            border-radius: 6px;
+            font-size: 12px;
+        }
+
+        .calendar-day.outside { opacity: 0.4; }
+        .calendar-day.today { border-color: var(--accent-blue); }
+
+        .calendar-day-number {
+            margin-bottom: 4px;
+            color: var(--text-secondary);
+        }
+
+        .calendar-item {
+            padding: 2px 6px;
+            margin-bottom: 3px;
+            border-radius: 4px;
+            background: var(--bg-hover);
+            color: var(--text-primary);
+            white-space: nowrap;
+            overflow: hidden;
+            text-overflow: ellipsis;
+            cursor: pointer;
+        }
 
-        .badge.priority-low { background: rgba(139, 153, 166, 0.2); color: var(--text-secondary); }
-        .badge.priority-medium { background: rgba(255, 217, 61, 0.2); color: var(--accent-yellow); }
-        .badge.priority-high { background: rgba(244, 33, 46, 0.2); color: var(--accent-red); }
-        .badge.priority-urgent { background: rgba(244, 33, 46, 0.4); color: #ff6b6b; }
+        .calendar-item:hover { color: var(--accent-blue); }
+        .calendar-item.overdue { background: rgba(244, 33, 46, 0.2); color: var(--accent-red); }
+        .calendar-item.done { text-decoration: line-through; color: var(--text-secondary); }
 
-        .badge.type-general { background: rgba(139, 153, 166, 0.2); color: var(--text-secondary); }
-        .badge.type-feature { background: rgba(155, 89, 182, 0.2); color: var(--accent-purple); }
-        .badge.type-bugfix { background: rgba(244, 33, 46, 0.2); color: var(--accent-red); }
-        .badge.type-chore { background: rgba(29, 155, 240, 0.2); color: var(--accent-blue); }
-        .badge.type-investigation { background: rgba(255, 217, 61, 0.2); color: var(--accent-yellow); }
+        /* People */
+        .card.selected { border-color: var(--accent-blue); }
 
-        .badge.goal-short_term { background: rgba(29, 155, 240, 0.2); color: var(--accent-blue); }
-        .badge.goal-career { background: rgba(155, 89, 182, 0.2); color: var(--accent-purple); }
-        .badge.goal-values { background: rgba(0, 186, 124, 0.2); color: var(--accent-green); }
-        .badge.goal-requirement { background: rgba(255, 217, 61, 0.2); color: var(--accent-yellow); }
+        .workload-title {
+            margin: 24px 0 12px;
+            font-size: 16px;
+            font-weight: 600;
+        }
 
         /* External Link */
         .external-link {
@@ -1088,6 +3600,14 @@ const dashboardHTML = `<!DOCTYPE html>
         .legend-dot.outcome { background: var(--node-outcome); }
         .legend-dot.goal { background: var(--node-goal); }
 
+        .legend-line {
+            width: 20px;
+            border-top: 2px dashed;
+        }
+
+        .legend-line.blocking { border-color: var(--accent-red); }
+        .legend-line.done { border-color: var(--accent-green); }
+
         .node-tooltip {
             position: absolute;
             background: var(--bg-secondary);
@@ -1338,6 +3858,58 @@ const dashboardHTML = `<!DOCTYPE html>
             font-size: 14px;
         }
 
+        /* Activity timeline */
+        .timeline {
+            border-left: 2px solid var(--border-color);
+            margin-left: 8px;
+            padding-left: 20px;
+        }
+
+        .timeline-entry {
+            position: relative;
+            margin-bottom: 16px;
+        }
+
+        .timeline-entry::before {
+            content: '';
+            position: absolute;
+            left: -26px;
+            top: 5px;
+            width: 10px;
+            height: 10px;
+            border-radius: 50%;
+            background: var(--accent-blue);
+        }
+
+        .timeline-entry.created::before {
+            background: var(--accent-green);
+        }
+
+        .timeline-entry.deleted::before {
+            background: var(--accent-red);
+        }
+
+        .timeline-header {
+            font-size: 13px;
+            color: var(--text-secondary);
+            margin-bottom: 4px;
+        }
+
+        .timeline-header strong {
+            color: var(--text-primary);
+            font-weight: 500;
+        }
+
+        .timeline-change {
+            font-size: 13px;
+            color: var(--text-secondary);
+            word-break: break-word;
+        }
+
+        .timeline-change .field {
+            color: var(--text-primary);
+        }
+
         .detail-field {
             margin-bottom: 16px;
         }
@@ -1382,6 +3954,16 @@ const dashboardHTML = `<!DOCTYPE html>
                     <span>🔗</span>
                     <span>Graph View</span>
                 </div>
+                <div class="nav-item" data-section="calendar" onclick="switchSection('calendar')">
+                    <span>📅</span>
+                    <span>Calendar</span>
+                    <span class="nav-badge" id="overdue-count">0</span>
+                </div>
+                <div class="nav-item" data-section="people" onclick="switchSection('people')">
+                    <span>👥</span>
+                    <span>People</span>
+                    <span class="nav-badge" id="people-count">0</span>
+                </div>
             </nav>
 
             <nav class="nav-section">
@@ -1525,7 +4107,38 @@ const dashboardHTML = `<!DOCTYPE html>
                         <span class="legend-dot goal"></span>
                         <span>Goal</span>
                     </div>
+                    <div class="legend-item">
+                        <span class="legend-line blocking"></span>
+                        <span>Waiting on</span>
+                    </div>
+                    <div class="legend-item">
+                        <span class="legend-line done"></span>
+                        <span>Dependency done</span>
+                    </div>
+                </div>
+            </section>
+
+            <!-- Calendar Section -->
+            <section class="content-section" id="section-calendar">
+                <div class="section-header">
+                    <h2 class="section-title">Due Dates</h2>
+                </div>
+                <div class="calendar-controls">
+                    <button class="graph-btn" onclick="changeCalendarMonth(-1)">‹ Prev</button>
+                    <span class="calendar-month" id="calendar-month"></span>
+                    <button class="graph-btn" onclick="changeCalendarMonth(1)">Next ›</button>
+                    <button class="graph-btn" onclick="calendarToday()">Today</button>
+                </div>
+                <div class="calendar-grid" id="calendar-grid"></div>
+            </section>
+
+            <!-- People Section -->
+            <section class="content-section" id="section-people">
+                <div class="section-header">
+                    <h2 class="section-title">People</h2>
                 </div>
+                <div class="cards-grid" id="people-grid"></div>
+                <div id="person-workload"></div>
             </section>
 
             <!-- Projects Section -->
@@ -1542,6 +4155,7 @@ const dashboardHTML = `<!DOCTYPE html>
                         <option value="completed">Completed</option>
                         <option value="archived">Archived</option>
                     </select>
+                    <div class="tag-filter" id="project-tag-filter"></div>
                 </div>
                 <div class="cards-grid" id="projects-grid"></div>
             </section>
@@ -1577,6 +4191,7 @@ const dashboardHTML = `<!DOCTYPE html>
                     <select class="filter-select" id="task-project-filter" onchange="filterTasks()">
                         <option value="">All Projects</option>
                     </select>
+                    <div class="tag-filter" id="task-tag-filter"></div>
                 </div>
                 <div class="cards-grid" id="tasks-grid"></div>
             </section>
@@ -1594,6 +4209,7 @@ const dashboardHTML = `<!DOCTYPE html>
                         <option value="resolved">Resolved</option>
                         <option value="blocked">Blocked</option>
                     </select>
+                    <div class="tag-filter" id="problem-tag-filter"></div>
                 </div>
                 <div class="cards-grid" id="problems-grid"></div>
             </section>
@@ -1611,6 +4227,7 @@ const dashboardHTML = `<!DOCTYPE html>
                         <option value="completed">Completed</option>
                         <option value="blocked">Blocked</option>
                     </select>
+                    <div class="tag-filter" id="outcome-tag-filter"></div>
                 </div>
                 <div class="cards-grid" id="outcomes-grid"></div>
             </section>
@@ -1628,6 +4245,7 @@ const dashboardHTML = `<!DOCTYPE html>
                         <option value="values">Values</option>
                         <option value="requirement">Requirement</option>
                     </select>
+                    <div class="tag-filter" id="goal-tag-filter"></div>
                 </div>
                 <div class="cards-grid" id="goals-grid"></div>
             </section>
@@ -1659,13 +4277,42 @@ const dashboardHTML = `<!DOCTYPE html>
             tasks: [],
             problems: [],
             outcomes: [],
-            goals: []
+            goals: [],
+            people: []
         };
 
         let projectsMap = {};
+        let tagColors = {};
         let searchQuery = '';
+        let searchMatches = null;
+        let searchTimer = null;
         let eventSource = null;
         let voiceMuted = localStorage.getItem('voiceMuted') === 'true';
+        let apiToken = localStorage.getItem('loomToken') || '';
+        let askedForToken = false;
+
+        // Call the API with the dashboard's token, asking for one the first
+        // time the API turns the dashboard away
+        function apiFetch(path, options) {
+            options = Object.assign({}, options);
+            if (apiToken) {
+                options.headers = Object.assign({}, options.headers, { 'Authorization': 'Bearer ' + apiToken });
+            }
+            return fetch(API_BASE_URL + path, options).then(response => {
+                if (response.status === 401) askForToken();
+                return response;
+            });
+        }
+
+        function askForToken() {
+            if (askedForToken) return;
+            askedForToken = true;
+            const token = window.prompt('This Loom server needs an API token. Create one with "loom token create NAME" and paste it here:');
+            if (token && token.trim()) {
+                localStorage.setItem('loomToken', token.trim());
+                location.reload();
+            }
+        }
 
         // Initialize
         document.addEventListener('DOMContentLoaded', () => {
@@ -1695,7 +4342,9 @@ const dashboardHTML = `<!DOCTYPE html>
             }
         }
 
-        async function speakText(text) {
+        let currentAudio = null;
+
+        async function speakText(text, voice, urgency) {
             if (voiceMuted) {
                 console.log('Voice muted, skipping announcement:', text);
                 return;
@@ -1703,12 +4352,12 @@ const dashboardHTML = `<!DOCTYPE html>
 
             console.log('Speaking text:', text);
             try {
-                const response = await fetch(API_BASE_URL + '/api/voice', {
+                const response = await apiFetch('/api/voice', {
                     method: 'POST',
                     headers: {
                         'Content-Type': 'application/json',
                     },
-                    body: JSON.stringify({ text: text })
+                    body: JSON.stringify({ text: text, voice: voice || '' })
                 });
 
                 if (!response.ok) {
@@ -1731,6 +4380,12 @@ const dashboardHTML = `<!DOCTYPE html>
                     URL.revokeObjectURL(audioUrl);
                 };
 
+                // Urgent messages cut off whatever is currently being spoken
+                if (urgency === 'high' && currentAudio) {
+                    currentAudio.pause();
+                }
+                currentAudio = audio;
+
                 console.log('Playing audio...');
                 await audio.play();
             } catch (error) {
@@ -1744,7 +4399,7 @@ const dashboardHTML = `<!DOCTYPE html>
                 eventSource.close();
             }
 
-            eventSource = new EventSource(API_BASE_URL + '/events');
+            eventSource = new EventSource(API_BASE_URL + '/events' + (apiToken ? '?access_token=' + encodeURIComponent(apiToken) : ''));
 
             eventSource.onopen = () => {
                 updateConnectionStatus(true);
@@ -1760,8 +4415,23 @@ const dashboardHTML = `<!DOCTYPE html>
                 updateConnectionStatus(true);
             });
 
-            eventSource.addEventListener('refresh', () => {
-                refreshData();
+            eventSource.addEventListener('change', (event) => {
+                try {
+                    const change = JSON.parse(event.data);
+                    applyChange(change);
+                    if (searchQuery) runSearch();
+                    if (historyTarget && change.entity === historyTarget.type && change.id === historyTarget.id) loadHistory();
+                } catch (error) {
+                    console.error('Failed to apply change event:', error);
+                    refreshData();
+                }
+            });
+
+            eventSource.addEventListener('shutdown', () => {
+                // The server is stopping; reconnect once it is back
+                eventSource.close();
+                updateConnectionStatus(false);
+                setTimeout(connectSSE, 5000);
             });
 
             eventSource.addEventListener('heartbeat', () => {
@@ -1772,13 +4442,99 @@ const dashboardHTML = `<!DOCTYPE html>
                 try {
                     const data = JSON.parse(event.data);
                     console.log('Voice event received:', data);
-                    speakText(data.text);
+                    speakText(data.text, data.voice, data.urgency);
                 } catch (error) {
                     console.error('Failed to parse voice event:', error);
                 }
             });
         }
 
+        // Collections in data keyed by the entity type of change events
+        const changeCollections = {
+            project: 'projects',
+            task: 'tasks',
+            problem: 'problems',
+            outcome: 'outcomes',
+            goal: 'goals'
+        };
+
+        // Patch local data from a single change event instead of refetching every list
+        function applyChange(change) {
+            if (change.action === 'restored' || change.action === 'purged' || change.action === 'imported') {
+                // Restores bring back dependents, purges unlink items and
+                // imports add many at once, none of which get events of
+                // their own
+                refreshData();
+                return;
+            }
+
+            if (change.entity === 'tag') {
+                if (change.data) tagColors[change.data.name] = change.data.color;
+                renderCurrentSection();
+                return;
+            }
+
+            if (change.entity === 'person') {
+                if (change.action !== 'created') {
+                    // Items carry the names of the people they are assigned to
+                    refreshData();
+                    return;
+                }
+                data.people.push(change.data);
+                data.people.sort((a, b) => a.name.localeCompare(b.name));
+                updateStats();
+                renderCurrentSection();
+                return;
+            }
+
+            const key = changeCollections[change.entity];
+            if (!key) {
+                // Notes and project links are not shown in the lists
+                return;
+            }
+
+            const items = data[key];
+            const index = items.findIndex(item => item.id === change.id);
+
+            if (change.action === 'deleted') {
+                if (index !== -1) {
+                    items.splice(index, 1);
+                }
+                applyCascade(change.entity, change.id);
+            } else if (index !== -1) {
+                items[index] = change.data;
+            } else {
+                items.unshift(change.data);
+            }
+
+            if (change.entity === 'project') {
+                projectsMap = {};
+                data.projects.forEach(p => projectsMap[p.id] = p);
+                updateProjectFilter();
+            }
+
+            updateStats();
+            renderCurrentSection();
+        }
+
+        // Drop the dependents that are moved to the trash with a deleted item
+        function applyCascade(entity, id) {
+            // Problems and goals keep their links until the trash is purged,
+            // and task notes are not shown in the lists
+            if (entity === 'project') {
+                data.tasks = data.tasks.filter(t => t.project_id !== id);
+                data.outcomes = data.outcomes.filter(o => o.project_id !== id);
+            } else if (entity === 'task') {
+                // Subtasks at any depth go with their parent
+                let parents = [id];
+                while (parents.length > 0) {
+                    const subtasks = data.tasks.filter(t => parents.includes(t.parent_task_id)).map(t => t.id);
+                    data.tasks = data.tasks.filter(t => !subtasks.includes(t.id));
+                    parents = subtasks;
+                }
+            }
+        }
+
         function updateConnectionStatus(connected) {
             const status = document.getElementById('connection-status');
             if (connected) {
@@ -1793,12 +4549,14 @@ const dashboardHTML = `<!DOCTYPE html>
         // Fetch all data
         async function refreshData() {
             try {
-                const [projects, tasks, problems, outcomes, goals] = await Promise.all([
-                    fetch(API_BASE_URL + '/api/projects').then(r => r.json()),
-                    fetch(API_BASE_URL + '/api/tasks').then(r => r.json()),
-                    fetch(API_BASE_URL + '/api/problems').then(r => r.json()),
-                    fetch(API_BASE_URL + '/api/outcomes').then(r => r.json()),
-                    fetch(API_BASE_URL + '/api/goals').then(r => r.json())
+                const [projects, tasks, problems, outcomes, goals, tags, people] = await Promise.all([
+                    apiFetch('/api/projects').then(r => r.json()),
+                    apiFetch('/api/tasks').then(r => r.json()),
+                    apiFetch('/api/problems').then(r => r.json()),
+                    apiFetch('/api/outcomes').then(r => r.json()),
+                    apiFetch('/api/goals').then(r => r.json()),
+                    apiFetch('/api/tags').then(r => r.json()),
+                    apiFetch('/api/people').then(r => r.json())
                 ]);
 
                 data.projects = projects || [];
@@ -1806,6 +4564,9 @@ const dashboardHTML = `<!DOCTYPE html>
                 data.problems = problems || [];
                 data.outcomes = outcomes || [];
                 data.goals = goals || [];
+                data.people = people || [];
+                tagColors = {};
+                (tags || []).forEach(t => { if (t.color) tagColors[t.name] = t.color; });
 
                 // Build project map
                 projectsMap = {};
@@ -1831,6 +4592,9 @@ const dashboardHTML = `<!DOCTYPE html>
             document.getElementById('problems-count').textContent = data.problems.length;
             document.getElementById('outcomes-count').textContent = data.outcomes.length;
             document.getElementById('goals-count').textContent = data.goals.length;
+            document.getElementById('people-count').textContent = data.people.length;
+            document.getElementById('overdue-count').textContent = ['project', 'task', 'outcome', 'goal']
+                .reduce((n, type) => n + data[type + 's'].filter(item => isOverdue(item, type)).length, 0);
         }
 
         // Update project filter dropdown
@@ -1864,6 +4628,8 @@ const dashboardHTML = `<!DOCTYPE html>
             const titles = {
                 'overview': 'Overview',
                 'graph': 'Graph View',
+                'calendar': 'Calendar',
+                'people': 'People',
                 'projects': 'Projects',
                 'tasks': 'Tasks',
                 'problems': 'Problems',
@@ -1888,6 +4654,12 @@ const dashboardHTML = `<!DOCTYPE html>
                 case 'graph':
                     initGraph();
                     break;
+                case 'calendar':
+                    renderCalendar();
+                    break;
+                case 'people':
+                    renderPeople();
+                    break;
                 case 'projects':
                     filterProjects();
                     break;
@@ -1906,20 +4678,100 @@ const dashboardHTML = `<!DOCTYPE html>
             }
         }
 
-        // Search handler
+        // Search handler: debounce typing, then ask the server
         function handleSearch(query) {
-            searchQuery = query.toLowerCase();
+            searchQuery = query.trim();
+            clearTimeout(searchTimer);
+            if (!searchQuery) {
+                searchMatches = null;
+                renderCurrentSection();
+                return;
+            }
+            searchTimer = setTimeout(runSearch, 200);
+        }
+
+        // Run a full-text search and remember the IDs that matched. A
+        // matching task note counts as a match for its task.
+        async function runSearch() {
+            const query = searchQuery;
+            if (!query) return;
+            try {
+                const results = await apiFetch('/api/search?limit=100&q=' + encodeURIComponent(query)).then(r => r.json());
+                if (query !== searchQuery) return;
+
+                const matches = { project: new Set(), task: new Set(), problem: new Set(), outcome: new Set(), goal: new Set() };
+                (Array.isArray(results) ? results : []).forEach(result => {
+                    if (result.entity === 'task_note') {
+                        matches.task.add(result.task_id);
+                    } else if (matches[result.entity]) {
+                        matches[result.entity].add(result.id);
+                    }
+                });
+                searchMatches = matches;
+            } catch (err) {
+                console.error('Error searching:', err);
+            }
             renderCurrentSection();
         }
 
         // Filter by search
-        function filterBySearch(items, fields) {
-            if (!searchQuery) return items;
+        function filterBySearch(items, entity) {
+            if (!searchQuery || !searchMatches) return items;
+            return items.filter(item => searchMatches[entity].has(item.id));
+        }
+
+        // Tags selected in each section's filter, and whether items need
+        // all of them or any
+        const selectedTags = { project: [], task: [], problem: [], outcome: [], goal: [] };
+        const tagMatchAny = { project: false, task: false, problem: false, outcome: false, goal: false };
+        const TAG_PALETTE = ['#3b82f6', '#10b981', '#f59e0b', '#ef4444', '#8b5cf6', '#ec4899', '#14b8a6', '#f97316'];
+
+        // A tag's colour, or one picked from its name if it has none
+        function tagColor(name) {
+            if (tagColors[name]) return tagColors[name];
+            let hash = 0;
+            for (const c of name) hash = (hash * 31 + c.charCodeAt(0)) >>> 0;
+            return TAG_PALETTE[hash % TAG_PALETTE.length];
+        }
+
+        function renderTagChips(tags) {
+            return (tags || []).map(tag =>
+                ` + "`" + `<span class="tag-chip" style="--tag-color: ${tagColor(tag)}">${escapeHtml(tag)}</span>` + "`" + `
+            ).join('');
+        }
+
+        // Show a chip for each tag on the section's items
+        function renderTagFilter(entity) {
+            const container = document.getElementById(entity + '-tag-filter');
+            const names = [...new Set(data[entity + 's'].flatMap(item => item.tags || []))].sort();
+            selectedTags[entity] = selectedTags[entity].filter(name => names.includes(name));
+            container.innerHTML = names.map(name => ` + "`" + `
+                <span class="tag-chip ${selectedTags[entity].includes(name) ? 'selected' : ''}" style="--tag-color: ${tagColor(name)}"
+                    data-tag="${escapeHtml(name)}" onclick="toggleTagFilter('${entity}', this.dataset.tag)">${escapeHtml(name)}</span>
+            ` + "`" + `).join('') + (selectedTags[entity].length > 1
+                ? ` + "`" + `<button class="tag-match-toggle" onclick="toggleTagMatch('${entity}')">${tagMatchAny[entity] ? 'Matching any' : 'Matching all'}</button>` + "`" + `
+                : '');
+        }
+
+        function toggleTagFilter(entity, name) {
+            const selected = selectedTags[entity];
+            const index = selected.indexOf(name);
+            if (index === -1) selected.push(name); else selected.splice(index, 1);
+            renderCurrentSection();
+        }
+
+        function toggleTagMatch(entity) {
+            tagMatchAny[entity] = !tagMatchAny[entity];
+            renderCurrentSection();
+        }
+
+        // Filter by the selected tags, as with tag= and tag_match on the API
+        function filterByTags(items, entity) {
+            const selected = selectedTags[entity];
+            if (selected.length === 0) return items;
             return items.filter(item => {
-                return fields.some(field => {
-                    const value = item[field];
-                    return value && value.toString().toLowerCase().includes(searchQuery);
-                });
+                const tags = item.tags || [];
+                return tagMatchAny[entity] ? selected.some(t => tags.includes(t)) : selected.every(t => tags.includes(t));
             });
         }
 
@@ -1974,12 +4826,14 @@ const dashboardHTML = `<!DOCTYPE html>
         // Render Projects
         // Filter and render projects
         function filterProjects() {
+            renderTagFilter('project');
             const status = document.getElementById('project-status-filter').value;
             
             let filtered = [...data.projects];
             if (status) filtered = filtered.filter(p => p.status === status);
             
-            filtered = filterBySearch(filtered, ['name', 'description']);
+            filtered = filterBySearch(filtered, 'project');
+            filtered = filterByTags(filtered, 'project');
 
             const grid = document.getElementById('projects-grid');
             if (filtered.length === 0) {
@@ -2011,9 +4865,11 @@ const dashboardHTML = `<!DOCTYPE html>
                         <div class="card-description">${escapeHtml(project.description) || 'No description'}</div>
                         <div class="card-meta">
                             <span class="badge status-${project.status}">${project.status.replace('_', ' ')}</span>
+                            ${renderDueBadge(project, 'project')}
                             <span class="badge status-pending">Pending: ${tasksByStatus.pending}</span>
                             <span class="badge status-in_progress">In Progress: ${tasksByStatus.in_progress}</span>
                             <span class="badge status-completed">Completed: ${tasksByStatus.completed}</span>
+                            ${renderTagChips(project.tags)}
                         </div>
                         ${project.external_link ? ` + "`" + `<a href="${escapeHtml(project.external_link)}" target="_blank" class="external-link" onclick="event.stopPropagation()">🔗 External Link</a>` + "`" + ` : ''}
                     </div>
@@ -2027,6 +4883,7 @@ const dashboardHTML = `<!DOCTYPE html>
 
         // Filter and render tasks
         function filterTasks() {
+            renderTagFilter('task');
             const status = document.getElementById('task-status-filter').value;
             const priority = document.getElementById('task-priority-filter').value;
             const type = document.getElementById('task-type-filter').value;
@@ -2038,7 +4895,12 @@ const dashboardHTML = `<!DOCTYPE html>
             if (type) filtered = filtered.filter(t => t.task_type === type);
             if (projectId) filtered = filtered.filter(t => String(t.project_id) === projectId);
 
-            filtered = filterBySearch(filtered, ['title', 'description']);
+            filtered = filterBySearch(filtered, 'task');
+            filtered = filterByTags(filtered, 'task');
+
+            // Subtasks are shown inside their parent's card when it is shown
+            const shown = new Set(filtered.map(t => t.id));
+            filtered = filtered.filter(t => !t.parent_task_id || !shown.has(t.parent_task_id));
 
             const grid = document.getElementById('tasks-grid');
             if (filtered.length === 0) {
@@ -2065,8 +4927,15 @@ const dashboardHTML = `<!DOCTYPE html>
                             <span class="badge status-${task.status}">${task.status.replace('_', ' ')}</span>
                             <span class="badge priority-${task.priority}">Priority: ${task.priority}</span>
                             <span class="badge type-${task.task_type}">${task.task_type}</span>
+                            ${renderDependencyBadge(task)}
+                            ${renderDueBadge(task, 'task')}
+                            ${task.recurrence_id ? '<span class="badge recurring">🔁 Recurring</span>' : ''}
+                            ${renderPersonBadge('👤', task.assignee)}
+                            ${renderPersonBadge('👀', task.reviewer)}
+                            ${renderTagChips(task.tags)}
                         </div>
                         ${task.external_link ? ` + "`" + `<a href="${escapeHtml(task.external_link)}" target="_blank" class="external-link" onclick="event.stopPropagation()">🔗 External Link</a>` + "`" + ` : ''}
+                        ${renderSubtasks(task)}
                     </div>
                     <div class="card-footer">
                         <span>Created: ${formatDate(task.created_at)}</span>
@@ -2076,12 +4945,245 @@ const dashboardHTML = `<!DOCTYPE html>
             ` + "`" + `;
         }
 
+        function getSubtasks(task) {
+            return data.tasks.filter(t => t.parent_task_id === task.id);
+        }
+
+        // Roll up completion the same way as get_task_tree: the share of
+        // subtasks at any depth that are completed, or 100 once the task is
+        function taskProgress(task) {
+            let total = 0, completed = 0;
+            for (const sub of getSubtasks(task)) {
+                const p = taskProgress(sub);
+                total += 1 + p.total;
+                completed += p.completed + (sub.status === 'completed' ? 1 : 0);
+            }
+            const percent = task.status === 'completed' ? 100 : (total > 0 ? Math.floor(completed * 100 / total) : 0);
+            return { total, completed, percent };
+        }
+
+        // Render a task's progress and its subtasks as a nested list
+        function renderSubtasks(task) {
+            if (getSubtasks(task).length === 0) return '';
+            const progress = taskProgress(task);
+            return ` + "`" + `
+                <div class="subtasks">
+                    <div>${progress.completed}/${progress.total} subtasks done • ${progress.percent}%</div>
+                    <div class="progress-bar"><div class="progress-bar-fill" style="width: ${progress.percent}%"></div></div>
+                    ${renderSubtaskList(task)}
+                </div>
+            ` + "`" + `;
+        }
+
+        function renderSubtaskList(task) {
+            const subtasks = getSubtasks(task);
+            if (subtasks.length === 0) return '';
+            return '<ul class="subtask-list">' + subtasks.map(sub => ` + "`" + `
+                <li class="subtask-item ${sub.status}">
+                    <div class="subtask-row" onclick="event.stopPropagation(); showRelatedItems('task', ${sub.id})">
+                        <span class="badge status-${sub.status}">${sub.status.replace('_', ' ')}</span>
+                        <span class="subtask-title">${escapeHtml(sub.title)}</span>
+                    </div>
+                    ${renderSubtaskList(sub)}
+                </li>
+            ` + "`" + `).join('') + '</ul>';
+        }
+
+        // Show whether a task with dependencies is waiting on them or ready
+        function renderDependencyBadge(task) {
+            if (task.blocked_by && task.blocked_by.length > 0) {
+                return '<span class="badge dependency-waiting">⛔ Waiting on ' + task.blocked_by.length + '</span>';
+            }
+            if (task.ready && task.depends_on && task.depends_on.length > 0) {
+                return '<span class="badge dependency-ready">▶ Ready</span>';
+            }
+            return '';
+        }
+
+        // Statuses in which an item is no longer overdue, as in list_overdue
+        const DONE_STATUSES = { project: ['completed', 'archived'], task: ['completed'], outcome: ['completed'], goal: [] };
+
+        function isOverdue(item, type) {
+            return !!item.due_at && new Date(item.due_at) < new Date() && !DONE_STATUSES[type].includes(item.status);
+        }
+
+        // Format a start or due date, leaving out the time for dates that
+        // fall at the start or end of a day
+        function formatDueDate(dateStr) {
+            const date = new Date(dateStr);
+            const options = { weekday: 'short', month: 'short', day: 'numeric' };
+            if (date.getFullYear() !== new Date().getFullYear()) options.year = 'numeric';
+            const wholeDay = (date.getHours() === 0 && date.getMinutes() === 0) || (date.getHours() === 23 && date.getMinutes() === 59);
+            if (!wholeDay) {
+                options.hour = '2-digit';
+                options.minute = '2-digit';
+            }
+            return date.toLocaleDateString('en-US', options);
+        }
+
+        function renderDueBadge(item, type) {
+            if (!item.due_at) return '';
+            if (isOverdue(item, type)) {
+                return '<span class="badge due-overdue">⏰ Overdue • ' + formatDueDate(item.due_at) + '</span>';
+            }
+            return '<span class="badge due-upcoming">📅 Due ' + formatDueDate(item.due_at) + '</span>';
+        }
+
+        // Render an item's start and due dates in the details modal
+        function renderDateFields(item, type) {
+            if (!item.start_at && !item.due_at) return '';
+            const parts = [];
+            if (item.start_at) parts.push('Starts: ' + formatDueDate(item.start_at));
+            if (item.due_at) parts.push('Due: ' + formatDueDate(item.due_at));
+            return ` + "`" + `
+                <div class="detail-field">
+                    <div class="detail-label">Dates</div>
+                    <div class="detail-value">${parts.join(' • ')} ${renderDueBadge(item, type)}</div>
+                </div>
+            ` + "`" + `;
+        }
+
+        // ==================== CALENDAR ====================
+
+        // First day of the month shown in the calendar
+        let calendarMonth = new Date(new Date().getFullYear(), new Date().getMonth(), 1);
+
+        function changeCalendarMonth(delta) {
+            calendarMonth = new Date(calendarMonth.getFullYear(), calendarMonth.getMonth() + delta, 1);
+            renderCalendar();
+        }
+
+        function calendarToday() {
+            calendarMonth = new Date(new Date().getFullYear(), new Date().getMonth(), 1);
+            renderCalendar();
+        }
+
+        function dayKey(date) {
+            return date.getFullYear() + '-' + (date.getMonth() + 1) + '-' + date.getDate();
+        }
+
+        // Render the month as a grid of weeks starting on Monday, with every
+        // dated item on the day it is due
+        function renderCalendar() {
+            const byDay = {};
+            const icons = { project: '📁', task: '✅', outcome: '🎯', goal: '🏆' };
+            const dated = [
+                ...data.projects.map(p => ({ item: p, type: 'project', title: p.name })),
+                ...data.tasks.map(t => ({ item: t, type: 'task', title: t.title })),
+                ...data.outcomes.map(o => ({ item: o, type: 'outcome', title: o.title })),
+                ...data.goals.map(g => ({ item: g, type: 'goal', title: g.title }))
+            ].filter(d => d.item.due_at);
+            dated.sort((a, b) => new Date(a.item.due_at) - new Date(b.item.due_at));
+            dated.forEach(d => {
+                const key = dayKey(new Date(d.item.due_at));
+                (byDay[key] = byDay[key] || []).push(d);
+            });
+
+            document.getElementById('calendar-month').textContent =
+                calendarMonth.toLocaleDateString('en-US', { month: 'long', year: 'numeric' });
+
+            const weekdays = ['Mon', 'Tue', 'Wed', 'Thu', 'Fri', 'Sat', 'Sun'];
+            let html = weekdays.map(d => '<div class="calendar-weekday">' + d + '</div>').join('');
+
+            const start = new Date(calendarMonth);
+            start.setDate(1 - (start.getDay() + 6) % 7);
+            const today = dayKey(new Date());
+            for (let i = 0; i < 42; i++) {
+                const day = new Date(start.getFullYear(), start.getMonth(), start.getDate() + i);
+                if (i === 35 && day.getMonth() !== calendarMonth.getMonth()) break;
+                const key = dayKey(day);
+                const classes = ['calendar-day'];
+                if (day.getMonth() !== calendarMonth.getMonth()) classes.push('outside');
+                if (key === today) classes.push('today');
+                const items = (byDay[key] || []).map(d => {
+                    const state = isOverdue(d.item, d.type) ? ' overdue' : (DONE_STATUSES[d.type].includes(d.item.status) ? ' done' : '');
+                    return ` + "`" + `<div class="calendar-item${state}" title="${escapeHtml(d.title)}" onclick="showRelatedItems('${d.type}', ${d.item.id})">${icons[d.type]} ${escapeHtml(d.title)}</div>` + "`" + `;
+                }).join('');
+                html += ` + "`" + `<div class="${classes.join(' ')}"><div class="calendar-day-number">${day.getDate()}</div>${items}</div>` + "`" + `;
+            }
+            document.getElementById('calendar-grid').innerHTML = html;
+        }
+
+        // ==================== PEOPLE ====================
+
+        let selectedPerson = null;
+
+        function renderPersonBadge(icon, name) {
+            return name ? ` + "`" + `<span class="badge person">${icon} ${escapeHtml(name)}</span>` + "`" + ` : '';
+        }
+
+        // The open work of a person, worked out from the loaded lists the
+        // same way as get_workload
+        function personWorkload(person) {
+            const byDue = (a, b) => (a.due_at ? new Date(a.due_at) : Infinity) - (b.due_at ? new Date(b.due_at) : Infinity);
+            const open = data.tasks.filter(t => t.status !== 'completed');
+            return {
+                tasks: open.filter(t => t.assignee_id === person.id).sort(byDue),
+                reviews: open.filter(t => t.reviewer_id === person.id).sort(byDue),
+                problems: data.problems.filter(p => p.assignee_id === person.id && p.status !== 'resolved')
+            };
+        }
+
+        function selectPerson(id) {
+            selectedPerson = selectedPerson === id ? null : id;
+            renderPeople();
+        }
+
+        function renderPeople() {
+            const grid = document.getElementById('people-grid');
+            const workloadEl = document.getElementById('person-workload');
+            if (data.people.length === 0) {
+                grid.innerHTML = renderEmptyState('No people yet', 'Add people with the create_person MCP tool, or assign work to someone by name.');
+                workloadEl.innerHTML = '';
+                return;
+            }
+
+            grid.innerHTML = data.people.map(person => {
+                const work = personWorkload(person);
+                const details = [person.role, person.handle ? '@' + person.handle : '', person.email].filter(Boolean).map(escapeHtml).join(' • ');
+                return ` + "`" + `
+                    <div class="card clickable${selectedPerson === person.id ? ' selected' : ''}" onclick="selectPerson(${person.id})">
+                        <div class="card-header">
+                            <div>
+                                <div class="card-title">👤 ${escapeHtml(person.name)}</div>
+                                <div class="card-id">ID: ${person.id}${details ? ' • ' + details : ''}</div>
+                            </div>
+                        </div>
+                        <div class="card-body">
+                            <div class="card-meta">
+                                <span class="badge">✅ ${work.tasks.length} open tasks</span>
+                                <span class="badge">👀 ${work.reviews.length} reviews</span>
+                                <span class="badge">⚠️ ${work.problems.length} open problems</span>
+                                ${person.manager ? ` + "`" + `<span class="badge person">Reports to ${escapeHtml(person.manager)}</span>` + "`" + ` : ''}
+                            </div>
+                        </div>
+                    </div>
+                ` + "`" + `;
+            }).join('');
+
+            const person = data.people.find(p => p.id === selectedPerson);
+            if (!person) {
+                workloadEl.innerHTML = '';
+                return;
+            }
+            const work = personWorkload(person);
+            const group = (title, items, render) => ` + "`" + `
+                <h3 class="workload-title">${title} (${items.length})</h3>
+                <div class="cards-grid">${items.length ? items.map(render).join('') : renderEmptyState('Nothing here', 'No open items.')}</div>
+            ` + "`" + `;
+            workloadEl.innerHTML = group(escapeHtml(person.name) + "'s tasks", work.tasks, renderTaskCard) +
+                group('Reviewing', work.reviews, renderTaskCard) +
+                group('Problems', work.problems, renderProblemCard);
+        }
+
         // Filter and render problems
         function filterProblems() {
+            renderTagFilter('problem');
             const status = document.getElementById('problem-status-filter').value;
             let filtered = [...data.problems];
             if (status) filtered = filtered.filter(p => p.status === status);
-            filtered = filterBySearch(filtered, ['title', 'description']);
+            filtered = filterBySearch(filtered, 'problem');
+            filtered = filterByTags(filtered, 'problem');
 
             const grid = document.getElementById('problems-grid');
             if (filtered.length === 0) {
@@ -2106,6 +5208,8 @@ const dashboardHTML = `<!DOCTYPE html>
                         <div class="card-description">${escapeHtml(problem.description) || 'No description'}</div>
                         <div class="card-meta">
                             <span class="badge status-${problem.status}">${problem.status.replace('_', ' ')}</span>
+                            ${renderPersonBadge('👤', problem.assignee)}
+                            ${renderTagChips(problem.tags)}
                         </div>
                     </div>
                     <div class="card-footer">
@@ -2118,10 +5222,12 @@ const dashboardHTML = `<!DOCTYPE html>
 
         // Filter and render outcomes
         function filterOutcomes() {
+            renderTagFilter('outcome');
             const status = document.getElementById('outcome-status-filter').value;
             let filtered = [...data.outcomes];
             if (status) filtered = filtered.filter(o => o.status === status);
-            filtered = filterBySearch(filtered, ['title', 'description']);
+            filtered = filterBySearch(filtered, 'outcome');
+            filtered = filterByTags(filtered, 'outcome');
 
             const grid = document.getElementById('outcomes-grid');
             if (filtered.length === 0) {
@@ -2146,6 +5252,8 @@ const dashboardHTML = `<!DOCTYPE html>
                         <div class="card-description">${escapeHtml(outcome.description) || 'No description'}</div>
                         <div class="card-meta">
                             <span class="badge status-${outcome.status}">${outcome.status.replace('_', ' ')}</span>
+                            ${renderDueBadge(outcome, 'outcome')}
+                            ${renderTagChips(outcome.tags)}
                         </div>
                     </div>
                     <div class="card-footer">
@@ -2158,10 +5266,12 @@ const dashboardHTML = `<!DOCTYPE html>
 
         // Filter and render goals
         function filterGoals() {
+            renderTagFilter('goal');
             const type = document.getElementById('goal-type-filter').value;
             let filtered = [...data.goals];
             if (type) filtered = filtered.filter(g => g.goal_type === type);
-            filtered = filterBySearch(filtered, ['title', 'description']);
+            filtered = filterBySearch(filtered, 'goal');
+            filtered = filterByTags(filtered, 'goal');
 
             const grid = document.getElementById('goals-grid');
             if (filtered.length === 0) {
@@ -2186,6 +5296,9 @@ const dashboardHTML = `<!DOCTYPE html>
                         <div class="card-description">${escapeHtml(goal.description) || 'No description'}</div>
                         <div class="card-meta">
                             <span class="badge goal-${goal.goal_type}">${goal.goal_type.replace('_', ' ')}</span>
+                            ${renderDueBadge(goal, 'goal')}
+                            ${renderPersonBadge('👤', goal.assignee)}
+                            ${renderTagChips(goal.tags)}
                         </div>
                     </div>
                     <div class="card-footer">
@@ -2269,9 +5382,18 @@ const dashboardHTML = `<!DOCTYPE html>
 
             titleEl.innerHTML = title;
             subtitleEl.textContent = subtitle;
-            bodyEl.innerHTML = bodyHtml;
+            bodyEl.innerHTML = bodyHtml + ` + "`" + `
+                <div class="related-section">
+                    <div class="related-section-header">
+                        <span class="related-section-title">🕘 History</span>
+                    </div>
+                    <div id="modal-history"><div class="related-empty">Loading history…</div></div>
+                </div>
+            ` + "`" + `;
             modal.classList.add('active');
             document.body.style.overflow = 'hidden';
+            historyTarget = { type, id };
+            loadHistory();
         }
 
         // Close modal
@@ -2279,6 +5401,50 @@ const dashboardHTML = `<!DOCTYPE html>
             const modal = document.getElementById('related-modal');
             modal.classList.remove('active');
             document.body.style.overflow = '';
+            historyTarget = null;
+        }
+
+        // The item whose history is shown in the open modal
+        let historyTarget = null;
+
+        // Load the activity timeline for the item in the open modal
+        async function loadHistory() {
+            const target = historyTarget;
+            if (!target) return;
+            try {
+                const url = '/api/activity?limit=50&entity=' + target.type + '&entity_id=' + target.id;
+                const entries = await apiFetch(url).then(r => r.json());
+                if (historyTarget !== target) return;
+                document.getElementById('modal-history').innerHTML = renderHistory(Array.isArray(entries) ? entries : []);
+            } catch (err) {
+                console.error('Error loading history:', err);
+            }
+        }
+
+        // Render activity entries as a timeline, newest first
+        function renderHistory(entries) {
+            if (entries.length === 0) {
+                return '<div class="related-empty">No recorded changes</div>';
+            }
+            return '<div class="timeline">' + entries.map(entry => {
+                const changes = Object.entries(entry.changes || {}).map(([field, change]) => {
+                    const value = v => v === null || v === '' ? '<em>empty</em>' : escapeHtml(truncate(String(v), 80));
+                    const text = entry.action === 'updated'
+                        ? ` + "`" + `${value(change.old)} → ${value(change.new)}` + "`" + `
+                        : value(entry.action === 'deleted' ? change.old : change.new);
+                    return ` + "`" + `<div class="timeline-change"><span class="field">${escapeHtml(field.replace(/_/g, ' '))}:</span> ${text}</div>` + "`" + `;
+                }).join('');
+                return ` + "`" + `
+                    <div class="timeline-entry ${entry.action}">
+                        <div class="timeline-header"><strong>${entry.action}</strong> by ${escapeHtml(entry.actor || 'unknown')} • ${formatDate(entry.created_at)}</div>
+                        ${changes}
+                    </div>
+                ` + "`" + `;
+            }).join('') + '</div>';
+        }
+
+        function truncate(text, max) {
+            return text.length > max ? text.slice(0, max - 1) + '…' : text;
         }
 
         // Close modal on escape key
@@ -2309,6 +5475,7 @@ const dashboardHTML = `<!DOCTYPE html>
                     <div class="detail-value"><a href="${escapeHtml(project.external_link)}" target="_blank" style="color: var(--accent-blue);">🔗 ${escapeHtml(project.external_link)}</a></div>
                 </div>
                 ` + "`" + ` : ''}
+                ${renderDateFields(project, 'project')}
                 <div class="detail-field">
                     <div class="detail-label">Timestamps</div>
                     <div class="detail-value">Created: ${formatDate(project.created_at)} • Updated: ${formatDate(project.updated_at)}</div>
@@ -2329,23 +5496,30 @@ const dashboardHTML = `<!DOCTYPE html>
             const problems = data.problems.filter(p => p.task_id === task.id);
             const outcomes = data.outcomes.filter(o => o.task_id === task.id);
             const goals = data.goals.filter(g => g.task_id === task.id);
+            const dependsOn = data.tasks.filter(t => (task.depends_on || []).includes(t.id));
+            const dependents = data.tasks.filter(t => (t.depends_on || []).includes(task.id));
+            const parent = task.parent_task_id ? data.tasks.find(t => t.id === task.parent_task_id) : null;
 
             let html = ` + "`" + `
                 <div class="detail-badges">
                     <span class="badge status-${task.status}">${task.status.replace('_', ' ')}</span>
                     <span class="badge priority-${task.priority}">Priority: ${task.priority}</span>
                     <span class="badge type-${task.task_type}">${task.task_type}</span>
+                    ${renderDependencyBadge(task)}
+                    ${task.recurrence_id ? '<span class="badge recurring">🔁 Recurring</span>' : ''}
                 </div>
                 <div class="detail-field">
                     <div class="detail-label">Description</div>
                     <div class="detail-value">${escapeHtml(task.description) || 'No description'}</div>
                 </div>
+                ${renderSubtasks(task)}
                 ${task.external_link ? ` + "`" + `
                 <div class="detail-field">
                     <div class="detail-label">External Link</div>
                     <div class="detail-value"><a href="${escapeHtml(task.external_link)}" target="_blank" style="color: var(--accent-blue);">🔗 ${escapeHtml(task.external_link)}</a></div>
                 </div>
                 ` + "`" + ` : ''}
+                ${renderDateFields(task, 'task')}
                 <div class="detail-field">
                     <div class="detail-label">Timestamps</div>
                     <div class="detail-value">Created: ${formatDate(task.created_at)} • Updated: ${formatDate(task.updated_at)}</div>
@@ -2355,6 +5529,11 @@ const dashboardHTML = `<!DOCTYPE html>
             if (project) {
                 html += renderRelatedSection('Parent Project', '📁', [project], renderRelatedProject);
             }
+            if (parent) {
+                html += renderRelatedSection('Parent Task', '✅', [parent], renderRelatedTask);
+            }
+            html += renderRelatedSection('Depends On', '⛓', dependsOn, renderRelatedTask);
+            html += renderRelatedSection('Blocking', '🚧', dependents, renderRelatedTask);
             html += renderRelatedSection('Problems', '⚠️', problems, renderRelatedProblem);
             html += renderRelatedSection('Outcomes', '🎯', outcomes, renderRelatedOutcome);
             html += renderRelatedSection('Goals', '🏆', goals, renderRelatedGoal);
@@ -2404,6 +5583,7 @@ const dashboardHTML = `<!DOCTYPE html>
                     <div class="detail-label">Description</div>
                     <div class="detail-value">${escapeHtml(outcome.description) || 'No description'}</div>
                 </div>
+                ${renderDateFields(outcome, 'outcome')}
                 <div class="detail-field">
                     <div class="detail-label">Timestamps</div>
                     <div class="detail-value">Created: ${formatDate(outcome.created_at)} • Updated: ${formatDate(outcome.updated_at)}</div>
@@ -2433,6 +5613,7 @@ const dashboardHTML = `<!DOCTYPE html>
                     <div class="detail-label">Description</div>
                     <div class="detail-value">${escapeHtml(goal.description) || 'No description'}</div>
                 </div>
+                ${renderDateFields(goal, 'goal')}
                 <div class="detail-field">
                     <div class="detail-label">Timestamps</div>
                     <div class="detail-value">Created: ${formatDate(goal.created_at)} • Updated: ${formatDate(goal.updated_at)}</div>
@@ -2674,6 +5855,15 @@ const dashboardHTML = `<!DOCTYPE html>
                     source: 'project-' + t.project_id,
                     target: 'task-' + t.id
                 });
+                // Link to the tasks it depends on, which may be in other projects
+                (t.depends_on || []).forEach(id => {
+                    graphEdges.push({
+                        source: 'task-' + id,
+                        target: 'task-' + t.id,
+                        dependency: true,
+                        blocking: (t.blocked_by || []).includes(id)
+                    });
+                });
             });
             
             data.problems.forEach(p => {
@@ -2966,11 +6156,20 @@ const dashboardHTML = `<!DOCTYPE html>
                 const target = graphNodes.find(n => n.id === edge.target);
                 if (!source || !target) return;
                 
+                // Dependencies are dashed: red while they block, green once done
+                let edgeColor = 'rgba(139, 153, 166, 0.4)';
+                let arrowColor = 'rgba(139, 153, 166, 0.6)';
+                if (edge.dependency) {
+                    edgeColor = arrowColor = edge.blocking ? 'rgba(244, 33, 46, 0.7)' : 'rgba(0, 186, 124, 0.6)';
+                }
+                
                 ctx.beginPath();
-                ctx.strokeStyle = 'rgba(139, 153, 166, 0.4)';
+                ctx.strokeStyle = edgeColor;
+                ctx.setLineDash(edge.dependency ? [6 / graphScale, 4 / graphScale] : []);
                 ctx.moveTo(source.x, source.y);
                 ctx.lineTo(target.x, target.y);
                 ctx.stroke();
+                ctx.setLineDash([]);
                 
                 // Draw arrow
                 const angle = Math.atan2(target.y - source.y, target.x - source.x);
@@ -2980,7 +6179,7 @@ const dashboardHTML = `<!DOCTYPE html>
                 const arrowSize = 8 / graphScale;
                 
                 ctx.beginPath();
-                ctx.fillStyle = 'rgba(139, 153, 166, 0.6)';
+                ctx.fillStyle = arrowColor;
                 ctx.moveTo(arrowX, arrowY);
                 ctx.lineTo(
                     arrowX - arrowSize * Math.cos(angle - Math.PI / 6),
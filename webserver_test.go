@@ -1,12 +1,18 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -143,7 +149,7 @@ func TestHandleProjectsWithData(t *testing.T) {
 	defer cleanup()
 
 	// Create test project
-	_, err := testDB.CreateProject("Test Project", "A test description", "", "https://example.com")
+	_, err := testDB.CreateProject("Test Project", "A test description", "", "https://example.com", nil, nil)
 	if err != nil {
 		t.Fatalf("Failed to create test project: %v", err)
 	}
@@ -199,9 +205,9 @@ func TestHandleTasksWithFilters(t *testing.T) {
 	defer cleanup()
 
 	// Create test project and tasks
-	project, _ := testDB.CreateProject("Test Project", "", "", "")
-	testDB.CreateTask(project.ID, "Task 1", "", "pending", "high", "feature", "")
-	testDB.CreateTask(project.ID, "Task 2", "", "completed", "low", "bugfix", "")
+	project, _ := testDB.CreateProject("Test Project", "", "", "", nil, nil)
+	testDB.CreateTask(project.ID, nil, "Task 1", "", "pending", "high", "feature", "", "", "", nil, nil)
+	testDB.CreateTask(project.ID, nil, "Task 2", "", "completed", "low", "bugfix", "", "", "", nil, nil)
 
 	tests := []struct {
 		name          string
@@ -259,7 +265,7 @@ func TestHandleProblemsWithData(t *testing.T) {
 	defer cleanup()
 
 	// Create test problem
-	project, _ := testDB.CreateProject("Test Project", "", "", "")
+	project, _ := testDB.CreateProject("Test Project", "", "", "", nil, nil)
 	_, err := testDB.CreateProblem(&project.ID, nil, "Test Problem", "A problem description", "open", "")
 	if err != nil {
 		t.Fatalf("Failed to create test problem: %v", err)
@@ -310,8 +316,8 @@ func TestHandleOutcomesWithData(t *testing.T) {
 	defer cleanup()
 
 	// Create test outcome
-	project, _ := testDB.CreateProject("Test Project", "", "", "")
-	_, err := testDB.CreateOutcome(project.ID, nil, "Test Outcome", "An outcome description", "open")
+	project, _ := testDB.CreateProject("Test Project", "", "", "", nil, nil)
+	_, err := testDB.CreateOutcome(project.ID, nil, "Test Outcome", "An outcome description", "open", nil, nil)
 	if err != nil {
 		t.Fatalf("Failed to create test outcome: %v", err)
 	}
@@ -361,7 +367,7 @@ func TestHandleGoalsWithData(t *testing.T) {
 	defer cleanup()
 
 	// Create test goal
-	_, err := testDB.CreateGoal(nil, nil, "Test Goal", "A goal description", "short_term", "")
+	_, err := testDB.CreateGoal(nil, nil, "Test Goal", "A goal description", "short_term", "", nil, nil)
 	if err != nil {
 		t.Fatalf("Failed to create test goal: %v", err)
 	}
@@ -455,32 +461,88 @@ func TestBroadcast(t *testing.T) {
 func TestCORSHeaders(t *testing.T) {
 	ws, _, cleanup := setupTestWebServer(t)
 	defer cleanup()
+	ws.webAddr = "127.0.0.1:3000"
+	ws.mcpHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	request := func(method, path, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Host = "localhost:8080"
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if method == "OPTIONS" {
+			req.Header.Set("Access-Control-Request-Method", "PATCH")
+		}
+		rr := httptest.NewRecorder()
+		ws.apiHandler().ServeHTTP(rr, req)
+		return rr
+	}
 
-	endpoints := []string{"/api/projects", "/api/tasks", "/api/problems", "/api/outcomes", "/api/goals"}
+	for _, endpoint := range []string{"/api/projects", "/api/tasks", "/api/problems", "/api/outcomes", "/api/goals"} {
+		rr := request("GET", endpoint, "http://localhost:3000")
+		if cors := rr.Header().Get("Access-Control-Allow-Origin"); cors != "http://localhost:3000" {
+			t.Errorf("%s: expected the dashboard origin to be allowed, got %q", endpoint, cors)
+		}
+		rr = request("GET", endpoint, "http://evil.example")
+		if cors := rr.Header().Get("Access-Control-Allow-Origin"); cors != "" || rr.Code != http.StatusOK {
+			t.Errorf("%s: expected no CORS header for another origin, got %q (%d)", endpoint, cors, rr.Code)
+		}
+	}
 
-	for _, endpoint := range endpoints {
-		t.Run(endpoint, func(t *testing.T) {
-			req := httptest.NewRequest("GET", endpoint, nil)
-			rr := httptest.NewRecorder()
+	rr := request("OPTIONS", "/api/tasks/1", "http://localhost:3000")
+	if rr.Code != http.StatusNoContent || rr.Header().Get("Access-Control-Allow-Origin") != "http://localhost:3000" {
+		t.Errorf("Expected the preflight to be answered for the dashboard, got %d: %v", rr.Code, rr.Header())
+	}
 
-			switch endpoint {
-			case "/api/projects":
-				ws.handleProjects(rr, req)
-			case "/api/tasks":
-				ws.handleTasks(rr, req)
-			case "/api/problems":
-				ws.handleProblems(rr, req)
-			case "/api/outcomes":
-				ws.handleOutcomes(rr, req)
-			case "/api/goals":
-				ws.handleGoals(rr, req)
-			}
+	// The MCP endpoint refuses other origins outright
+	if rr := request("POST", "/sse", "http://evil.example"); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for MCP from another origin, got %d", rr.Code)
+	}
+	for _, origin := range []string{"", "http://localhost:3000"} {
+		if rr := request("POST", "/sse", origin); rr.Code != http.StatusOK {
+			t.Errorf("Expected MCP requests from origin %q through, got %d", origin, rr.Code)
+		}
+	}
 
-			cors := rr.Header().Get("Access-Control-Allow-Origin")
-			if cors != "*" {
-				t.Errorf("Expected CORS header *, got %s", cors)
-			}
-		})
+	ws.corsOrigins = []string{"https://app.example/"}
+	if cors := request("GET", "/api/tasks", "https://app.example").Header().Get("Access-Control-Allow-Origin"); cors != "https://app.example" {
+		t.Errorf("Expected a configured origin to be allowed, got %q", cors)
+	}
+	if rr := request("POST", "/sse", "https://app.example"); rr.Code != http.StatusOK {
+		t.Errorf("Expected MCP from a configured origin through, got %d", rr.Code)
+	}
+	ws.corsOrigins = []string{"*"}
+	if cors := request("GET", "/api/tasks", "http://evil.example").Header().Get("Access-Control-Allow-Origin"); cors != "http://evil.example" {
+		t.Errorf("Expected * to allow any origin, got %q", cors)
+	}
+	ws.corsOrigins = nil
+
+	// A server on all interfaces lets the dashboard in by IP address, which
+	// DNS rebinding cannot fake, but not by any hostname
+	for origin, want := range map[string]string{"http://192.168.1.5:3000": "http://192.168.1.5:3000", "http://rebound.example:3000": ""} {
+		ws.webAddr = ":3000"
+		if cors := request("GET", "/api/tasks", origin).Header().Get("Access-Control-Allow-Origin"); cors != want {
+			t.Errorf("%s: expected CORS header %q, got %q", origin, want, cors)
+		}
+	}
+
+	// A server on this machine only refuses hostnames rebound to it
+	ws.addr, ws.webAddr = "127.0.0.1:8080", "127.0.0.1:3000"
+	rebound := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, nil)
+		req.Host = "rebound.example:8080"
+		req.Header.Set("Origin", "http://rebound.example:3000")
+		rr := httptest.NewRecorder()
+		ws.apiHandler().ServeHTTP(rr, req)
+		return rr
+	}
+	for _, path := range []string{"/sse", "/api/projects"} {
+		if rr := rebound(path); rr.Code != http.StatusForbidden || rr.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("%s: expected status 403 for a rebound host, got %d", path, rr.Code)
+		}
+	}
+	if rr := request("POST", "/sse", "http://localhost:3000"); rr.Code != http.StatusOK {
+		t.Errorf("Expected MCP through at localhost, got %d", rr.Code)
 	}
 }
 
@@ -548,3 +610,1142 @@ func containsHelper(s, substr string) bool {
 	}
 	return false
 }
+
+func TestHandleAnnounce(t *testing.T) {
+	ws, _, cleanup := setupTestWebServer(t)
+	defer cleanup()
+
+	clientChan := make(chan string, 10)
+	ws.clientsMux.Lock()
+	ws.clients[clientChan] = true
+	ws.clientsMux.Unlock()
+
+	req := httptest.NewRequest("POST", "/api/announce", strings.NewReader(`{"text":"Task Demo created","urgency":"high"}`))
+	rr := httptest.NewRecorder()
+	ws.handleAnnounce(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+	if !contains(rr.Body.String(), `"listeners":1`) {
+		t.Errorf("Expected one listener in response, got %s", rr.Body.String())
+	}
+
+	select {
+	case msg := <-clientChan:
+		if !contains(msg, "event: voice") {
+			t.Errorf("Expected voice event, got: %s", msg)
+		}
+		if !contains(msg, `"text":"Task Demo created"`) || !contains(msg, `"urgency":"high"`) {
+			t.Errorf("Expected announcement text and urgency, got: %s", msg)
+		}
+	case <-time.After(time.Second):
+		t.Error("Timeout waiting for voice event")
+	}
+
+	ws.clientsMux.Lock()
+	delete(ws.clients, clientChan)
+	close(clientChan)
+	ws.clientsMux.Unlock()
+}
+
+func TestHandleAnnounceValidation(t *testing.T) {
+	ws, _, cleanup := setupTestWebServer(t)
+	defer cleanup()
+
+	tests := []struct {
+		name     string
+		method   string
+		body     string
+		expected int
+	}{
+		{"wrong method", "GET", "", http.StatusMethodNotAllowed},
+		{"invalid body", "POST", "not json", http.StatusBadRequest},
+		{"empty text", "POST", `{"text":""}`, http.StatusBadRequest},
+		{"invalid voice", "POST", `{"text":"hi","voice":"a b"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/announce", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			ws.handleAnnounce(rr, req)
+			if rr.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, rr.Code)
+			}
+		})
+	}
+}
+
+// doAPIRequest sends a request through the API server mux and returns the recorded response.
+func doAPIRequest(t *testing.T, ws *WebServer, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rr := httptest.NewRecorder()
+	ws.apiHandler().ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAPIProjectLifecycle(t *testing.T) {
+	ws, _, cleanup := setupTestWebServer(t)
+	defer cleanup()
+
+	rr := doAPIRequest(t, ws, "POST", "/api/projects", `{"name":"REST Project","description":"via REST"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var project Project
+	if err := json.NewDecoder(rr.Body).Decode(&project); err != nil {
+		t.Fatalf("Failed to decode project: %v", err)
+	}
+	if project.Name != "REST Project" || project.Status != "active" {
+		t.Errorf("Unexpected project: %+v", project)
+	}
+
+	path := "/api/projects/" + strconv.FormatInt(project.ID, 10)
+
+	rr = doAPIRequest(t, ws, "PATCH", path, `{"status":"on_hold"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&project); err != nil {
+		t.Fatalf("Failed to decode project: %v", err)
+	}
+	if project.Status != "on_hold" || project.Name != "REST Project" {
+		t.Errorf("Expected only status to change, got %+v", project)
+	}
+
+	rr = doAPIRequest(t, ws, "GET", path, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+
+	rr = doAPIRequest(t, ws, "DELETE", path, "")
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = doAPIRequest(t, ws, "GET", path, "")
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404 after delete, got %d", rr.Code)
+	}
+	if !contains(rr.Body.String(), `"error"`) {
+		t.Errorf("Expected JSON error body, got %s", rr.Body.String())
+	}
+}
+
+func TestAPIErrorResponses(t *testing.T) {
+	ws, db, cleanup := setupTestWebServer(t)
+	defer cleanup()
+
+	project, _ := db.CreateProject("Project", "", "", "", nil, nil)
+	projectPath := "/api/projects/" + strconv.FormatInt(project.ID, 10)
+	task, _ := db.CreateTask(project.ID, nil, "Done", "", "completed", "low", "general", "", "", "", nil, nil)
+	taskPath := "/api/tasks/" + strconv.FormatInt(task.ID, 10)
+	other, _ := db.CreateProject("Other", "", "", "", nil, nil)
+	mismatched := `{"project_id":` + strconv.FormatInt(other.ID, 10) + `,"task_id":` + strconv.FormatInt(task.ID, 10) + `,"title":"Mismatch"}`
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		expected int
+	}{
+		{"missing project name", "POST", "/api/projects", `{"description":"no name"}`, http.StatusUnprocessableEntity},
+		{"invalid json", "POST", "/api/projects", `{`, http.StatusBadRequest},
+		{"missing task title", "POST", "/api/tasks", `{"project_id":1}`, http.StatusUnprocessableEntity},
+		{"task for unknown project", "POST", "/api/tasks", `{"project_id":9999,"title":"Orphan"}`, http.StatusUnprocessableEntity},
+		{"outcome without project", "POST", "/api/outcomes", `{"title":"Outcome"}`, http.StatusUnprocessableEntity},
+		{"empty name on update", "PATCH", projectPath, `{"name":""}`, http.StatusUnprocessableEntity},
+		{"update unknown task", "PATCH", "/api/tasks/9999", `{"title":"x"}`, http.StatusNotFound},
+		{"delete unknown problem", "DELETE", "/api/problems/9999", "", http.StatusNotFound},
+		{"get unknown goal", "GET", "/api/goals/9999", "", http.StatusNotFound},
+		{"invalid id", "GET", "/api/outcomes/abc", "", http.StatusBadRequest},
+		{"method not allowed", "PUT", "/api/projects", "", http.StatusMethodNotAllowed},
+		{"invalid task status", "POST", "/api/tasks", `{"project_id":1,"title":"Typo","status":"in-progress"}`, http.StatusUnprocessableEntity},
+		{"invalid project status", "PATCH", projectPath, `{"status":"done"}`, http.StatusUnprocessableEntity},
+		{"forbidden status transition", "PATCH", taskPath, `{"status":"pending"}`, http.StatusConflict},
+		{"problem on another project's task", "POST", "/api/problems", mismatched, http.StatusUnprocessableEntity},
+		{"goal for unknown task", "POST", "/api/goals", `{"title":"Goal","task_id":9999}`, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := doAPIRequest(t, ws, tt.method, tt.path, tt.body)
+			if rr.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d: %s", tt.expected, rr.Code, rr.Body.String())
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Expected JSON content type, got %s", ct)
+			}
+		})
+	}
+}
+
+func TestAPICreateAndUpdateEntities(t *testing.T) {
+	ws, db, cleanup := setupTestWebServer(t)
+	defer cleanup()
+
+	project, _ := db.CreateProject("Project", "", "", "", nil, nil)
+	pid := strconv.FormatInt(project.ID, 10)
+
+	rr := doAPIRequest(t, ws, "POST", "/api/tasks", `{"project_id":`+pid+`,"title":"Task","status":"pending","priority":"high"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 for task, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var task Task
+	json.NewDecoder(rr.Body).Decode(&task)
+	tid := strconv.FormatInt(task.ID, 10)
+
+	rr = doAPIRequest(t, ws, "PATCH", "/api/tasks/"+tid, `{"status":"in_progress"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for task update, got %d: %s", rr.Code, rr.Body.String())
+	}
+	json.NewDecoder(rr.Body).Decode(&task)
+	if task.Status != "in_progress" || task.Priority != "high" {
+		t.Errorf("Unexpected task after update: %+v", task)
+	}
+
+	rr = doAPIRequest(t, ws, "POST", "/api/problems", `{"title":"Problem","task_id":`+tid+`,"assignee":"alice"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 for problem, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var problem Problem
+	json.NewDecoder(rr.Body).Decode(&problem)
+	if problem.TaskID == nil || *problem.TaskID != task.ID || problem.Assignee != "alice" {
+		t.Errorf("Unexpected problem: %+v", problem)
+	}
+
+	rr = doAPIRequest(t, ws, "POST", "/api/outcomes", `{"project_id":`+pid+`,"title":"Outcome","status":"open"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 for outcome, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var outcome Outcome
+	json.NewDecoder(rr.Body).Decode(&outcome)
+	rr = doAPIRequest(t, ws, "PATCH", "/api/outcomes/"+strconv.FormatInt(outcome.ID, 10), `{"status":"completed"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for outcome update, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = doAPIRequest(t, ws, "POST", "/api/goals", `{"title":"Goal","goal_type":"career"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 for goal, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var goal Goal
+	json.NewDecoder(rr.Body).Decode(&goal)
+	if goal.GoalType != "career" || goal.ProjectID != nil {
+		t.Errorf("Unexpected goal: %+v", goal)
+	}
+}
+
+func TestAPITaskNotes(t *testing.T) {
+	ws, db, cleanup := setupTestWebServer(t)
+	defer cleanup()
+
+	project, _ := db.CreateProject("Project", "", "", "", nil, nil)
+	task, _ := db.CreateTask(project.ID, nil, "Task", "", "pending", "medium", "", "", "", "", nil, nil)
+	otherTask, _ := db.CreateTask(project.ID, nil, "Other", "", "pending", "medium", "", "", "", "", nil, nil)
+	notesPath := "/api/tasks/" + strconv.FormatInt(task.ID, 10) + "/notes"
+
+	rr := doAPIRequest(t, ws, "POST", notesPath, `{"note":"First note"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var note TaskNote
+	json.NewDecoder(rr.Body).Decode(&note)
+	notePath := notesPath + "/" + strconv.FormatInt(note.ID, 10)
+
+	rr = doAPIRequest(t, ws, "PATCH", notePath, `{"note":"Edited note"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = doAPIRequest(t, ws, "GET", notesPath, "")
+	var notes []TaskNote
+	json.NewDecoder(rr.Body).Decode(&notes)
+	if len(notes) != 1 || notes[0].Note != "Edited note" {
+		t.Errorf("Expected one edited note, got %+v", notes)
+	}
+
+	// Notes cannot be reached through a different task
+	wrongPath := "/api/tasks/" + strconv.FormatInt(otherTask.ID, 10) + "/notes/" + strconv.FormatInt(note.ID, 10)
+	if rr := doAPIRequest(t, ws, "DELETE", wrongPath, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 through another task, got %d", rr.Code)
+	}
+
+	if rr := doAPIRequest(t, ws, "GET", "/api/tasks/9999/notes", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown task, got %d", rr.Code)
+	}
+
+	if rr := doAPIRequest(t, ws, "DELETE", notePath, ""); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", rr.Code)
+	}
+}
+
+func TestAPIGoalProjectLinks(t *testing.T) {
+	ws, db, cleanup := setupTestWebServer(t)
+	defer cleanup()
+
+	project, _ := db.CreateProject("Project", "", "", "", nil, nil)
+	goal, _ := db.CreateGoal(nil, nil, "Goal", "", "", "", nil, nil)
+	linksPath := "/api/goals/" + strconv.FormatInt(goal.ID, 10) + "/projects"
+
+	rr := doAPIRequest(t, ws, "POST", linksPath, `{"project_id":`+strconv.FormatInt(project.ID, 10)+`}`)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = doAPIRequest(t, ws, "GET", linksPath, "")
+	var projects []Project
+	json.NewDecoder(rr.Body).Decode(&projects)
+	if len(projects) != 1 || projects[0].ID != project.ID {
+		t.Errorf("Expected linked project, got %+v", projects)
+	}
+
+	unlinkPath := linksPath + "/" + strconv.FormatInt(project.ID, 10)
+	if rr := doAPIRequest(t, ws, "DELETE", unlinkPath, ""); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", rr.Code)
+	}
+	if rr := doAPIRequest(t, ws, "DELETE", unlinkPath, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for missing link, got %d", rr.Code)
+	}
+
+	problem, _ := db.CreateProblem(nil, nil, "Problem", "", "open", "")
+	problemLinks := "/api/problems/" + strconv.FormatInt(problem.ID, 10) + "/projects"
+	if rr := doAPIRequest(t, ws, "POST", problemLinks, `{"project_id":9999}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 linking to unknown project, got %d", rr.Code)
+	}
+}
+
+func TestAPIPreflight(t *testing.T) {
+	ws, _, cleanup := setupTestWebServer(t)
+	defer cleanup()
+
+	rr := doAPIRequest(t, ws, "OPTIONS", "/api/tasks/1", "")
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", rr.Code)
+	}
+	if methods := rr.Header().Get("Access-Control-Allow-Methods"); !contains(methods, "PATCH") {
+		t.Errorf("Expected PATCH in allowed methods, got %s", methods)
+	}
+}
+
+func TestAPISearch(t *testing.T) {
+	ws, db, cleanup := setupTestWebServer(t)
+	defer cleanup()
+
+	project, _ := db.CreateProject("Search project", "", "", "", nil, nil)
+	db.CreateTask(project.ID, nil, "Write search docs", "", "pending", "low", "general", "", "", "", nil, nil)
+
+	rr := doAPIRequest(t, ws, "GET", "/api/search?q=search", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var results []SearchResult
+	json.NewDecoder(rr.Body).Decode(&results)
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %+v", results)
+	}
+
+	rr = doAPIRequest(t, ws, "GET", "/api/search?q=search&entity=project&limit=1", "")
+	json.NewDecoder(rr.Body).Decode(&results)
+	if len(results) != 1 || results[0].Entity != "project" {
+		t.Errorf("Expected only the project, got %+v", results)
+	}
+
+	rr = doAPIRequest(t, ws, "GET", "/api/search?q=zzz", "")
+	if strings.TrimSpace(rr.Body.String()) != "[]" {
+		t.Errorf("Expected empty JSON array, got %s", rr.Body.String())
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		expected int
+	}{
+		{"missing query", "/api/search", http.StatusBadRequest},
+		{"invalid limit", "/api/search?q=x&limit=abc", http.StatusBadRequest},
+		{"unknown entity", "/api/search?q=x&entity=comment", http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := doAPIRequest(t, ws, "GET", tt.path, "")
+			if rr.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d: %s", tt.expected, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestAPIListPagination(t *testing.T) {
+	ws, db, cleanup := setupTestWebServer(t)
+	defer cleanup()
+
+	project, _ := db.CreateProject("Project", "", "", "", nil, nil)
+	db.CreateTask(project.ID, nil, "Low", "", "pending", "low", "general", "", "", "", nil, nil)
+	db.CreateTask(project.ID, nil, "Urgent", "", "pending", "urgent", "general", "", "", "", nil, nil)
+
+	rr := doAPIRequest(t, ws, "GET", "/api/tasks?limit=1&sort=priority&fields=id,title", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("X-Total-Count") != "2" {
+		t.Errorf("Expected X-Total-Count 2, got %q", rr.Header().Get("X-Total-Count"))
+	}
+	cursor := rr.Header().Get("X-Next-Cursor")
+	if cursor == "" {
+		t.Fatal("Expected X-Next-Cursor header")
+	}
+	var items []map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&items)
+	if len(items) != 1 || len(items[0]) != 2 || items[0]["title"] != "Urgent" {
+		t.Fatalf("Expected only id and title of the urgent task, got %v", items)
+	}
+
+	rr = doAPIRequest(t, ws, "GET", "/api/tasks?limit=1&sort=priority&cursor="+cursor, "")
+	var tasks []Task
+	json.NewDecoder(rr.Body).Decode(&tasks)
+	if len(tasks) != 1 || tasks[0].Title != "Low" || rr.Header().Get("X-Next-Cursor") != "" {
+		t.Errorf("Expected last page with the low task, got %+v", tasks)
+	}
+
+	// Without a limit every row is returned
+	rr = doAPIRequest(t, ws, "GET", "/api/projects", "")
+	if rr.Header().Get("X-Total-Count") != "1" || rr.Header().Get("X-Next-Cursor") != "" {
+		t.Errorf("Expected a single page of 1 project, got headers %v", rr.Header())
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		expected int
+	}{
+		{"invalid limit", "/api/tasks?limit=abc", http.StatusBadRequest},
+		{"zero limit", "/api/goals?limit=0", http.StatusBadRequest},
+		{"unknown sort", "/api/problems?sort=priority", http.StatusUnprocessableEntity},
+		{"unknown order", "/api/outcomes?order=up", http.StatusUnprocessableEntity},
+		{"unknown field", "/api/projects?fields=colour", http.StatusUnprocessableEntity},
+		{"invalid cursor", "/api/tasks?cursor=bogus", http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := doAPIRequest(t, ws, "GET", tt.path, "")
+			if rr.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d: %s", tt.expected, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestAPIActivity(t *testing.T) {
+	ws, _, cleanup := setupTestWebServer(t)
+	defer cleanup()
+
+	req := httptest.NewRequest("POST", "/api/projects", strings.NewReader(`{"name":"Audited"}`))
+	req.Header.Set("X-Loom-Actor", "release-script")
+	rr := httptest.NewRecorder()
+	ws.apiHandler().ServeHTTP(rr, req)
+	var project Project
+	json.NewDecoder(rr.Body).Decode(&project)
+
+	rr = doAPIRequest(t, ws, "PATCH", "/api/projects/"+strconv.FormatInt(project.ID, 10), `{"name":"Audited v2"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = doAPIRequest(t, ws, "GET", "/api/activity?entity=project&entity_id="+strconv.FormatInt(project.ID, 10), "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var entries []Activity
+	json.NewDecoder(rr.Body).Decode(&entries)
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %+v", entries)
+	}
+	if entries[1].Actor != "rest:release-script" {
+		t.Errorf("Expected actor from header, got %q", entries[1].Actor)
+	}
+	if !strings.HasPrefix(entries[0].Actor, "rest:") || entries[0].Changes["name"].New != "Audited v2" {
+		t.Errorf("Expected rename by a REST caller, got %+v", entries[0])
+	}
+
+	rr = doAPIRequest(t, ws, "GET", "/api/activity?actor=rest:release-script", "")
+	if rr.Header().Get("X-Total-Count") != "1" {
+		t.Errorf("Expected 1 entry by the script, got %s", rr.Body.String())
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		expected int
+	}{
+		{"id without entity", "/api/activity?entity_id=1", http.StatusBadRequest},
+		{"invalid id", "/api/activity?entity=task&entity_id=x", http.StatusBadRequest},
+		{"unknown entity", "/api/activity?entity=comment", http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := doAPIRequest(t, ws, "GET", tt.path, "")
+			if rr.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d: %s", tt.expected, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestAPITrash(t *testing.T) {
+	ws, _, cleanup := setupTestWebServer(t)
+	defer cleanup()
+
+	rr := doAPIRequest(t, ws, "POST", "/api/projects", `{"name":"Doomed"}`)
+	var project Project
+	json.NewDecoder(rr.Body).Decode(&project)
+	projectPath := "/api/projects/" + strconv.FormatInt(project.ID, 10)
+
+	rr = doAPIRequest(t, ws, "DELETE", projectPath, "")
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr = doAPIRequest(t, ws, "GET", projectPath, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected trashed project to be hidden, got %d", rr.Code)
+	}
+
+	rr = doAPIRequest(t, ws, "GET", "/api/trash?entity=project", "")
+	var entries []TrashEntry
+	json.NewDecoder(rr.Body).Decode(&entries)
+	if len(entries) != 1 || entries[0].EntityID != project.ID {
+		t.Fatalf("Expected the project in the trash, got %+v", entries)
+	}
+	entryPath := "/api/trash/" + strconv.FormatInt(entries[0].ID, 10)
+
+	rr = doAPIRequest(t, ws, "POST", entryPath+"/restore", "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"name":"Doomed"`) {
+		t.Fatalf("Expected the restored project, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr = doAPIRequest(t, ws, "GET", projectPath, ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected restored project to be visible, got %d", rr.Code)
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		expected int
+	}{
+		{"restore twice", "POST", entryPath + "/restore", http.StatusNotFound},
+		{"purge missing entry", "DELETE", entryPath, http.StatusNotFound},
+		{"purge without age", "DELETE", "/api/trash", http.StatusBadRequest},
+		{"purge", "DELETE", "/api/trash?older_than_days=0", http.StatusOK},
+		{"unknown entity", "GET", "/api/trash?entity=comment", http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := doAPIRequest(t, ws, tt.method, tt.path, "")
+			if rr.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d: %s", tt.expected, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestAPITaskDependencies(t *testing.T) {
+	ws, db, cleanup := setupTestWebServer(t)
+	defer cleanup()
+
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	first, _ := db.CreateTask(project.ID, nil, "First", "", "", "", "", "", "", "", nil, nil)
+	second, _ := db.CreateTask(project.ID, nil, "Second", "", "", "", "", "", "", "", nil, nil)
+	secondPath := "/api/tasks/" + strconv.FormatInt(second.ID, 10)
+
+	rr := doAPIRequest(t, ws, "POST", secondPath+"/dependencies", fmt.Sprintf(`{"depends_on_id":%d}`, first.ID))
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = doAPIRequest(t, ws, "GET", secondPath+"/dependencies", "")
+	var dependencies []Task
+	json.NewDecoder(rr.Body).Decode(&dependencies)
+	if len(dependencies) != 1 || dependencies[0].ID != first.ID {
+		t.Errorf("Expected the first task as a dependency, got %+v", dependencies)
+	}
+
+	rr = doAPIRequest(t, ws, "GET", "/api/tasks?ready=false", "")
+	var tasks []Task
+	json.NewDecoder(rr.Body).Decode(&tasks)
+	if len(tasks) != 1 || tasks[0].ID != second.ID || len(tasks[0].BlockedBy) != 1 {
+		t.Errorf("Expected only the second task to be waiting, got %+v", tasks)
+	}
+
+	firstPath := "/api/tasks/" + strconv.FormatInt(first.ID, 10)
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		expected int
+	}{
+		{"cycle", "POST", firstPath + "/dependencies", fmt.Sprintf(`{"depends_on_id":%d}`, second.ID), http.StatusUnprocessableEntity},
+		{"self", "POST", firstPath + "/dependencies", fmt.Sprintf(`{"depends_on_id":%d}`, first.ID), http.StatusUnprocessableEntity},
+		{"missing task", "POST", firstPath + "/dependencies", `{"depends_on_id":999}`, http.StatusUnprocessableEntity},
+		{"invalid ready", "GET", "/api/tasks?ready=maybe", "", http.StatusBadRequest},
+		{"blockers", "GET", secondPath + "/blockers", "", http.StatusOK},
+		{"remove", "DELETE", secondPath + "/dependencies/" + strconv.FormatInt(first.ID, 10), "", http.StatusNoContent},
+		{"remove twice", "DELETE", secondPath + "/dependencies/" + strconv.FormatInt(first.ID, 10), "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := doAPIRequest(t, ws, tt.method, tt.path, tt.body)
+			if rr.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d: %s", tt.expected, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestAPITaskTree(t *testing.T) {
+	ws, db, cleanup := setupTestWebServer(t)
+	defer cleanup()
+
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	parent, _ := db.CreateTask(project.ID, nil, "Parent", "", "", "", "", "", "", "", nil, nil)
+	parentPath := "/api/tasks/" + strconv.FormatInt(parent.ID, 10)
+
+	rr := doAPIRequest(t, ws, "POST", "/api/tasks", fmt.Sprintf(`{"project_id":%d,"parent_task_id":%d,"title":"Child"}`, project.ID, parent.ID))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var child Task
+	json.NewDecoder(rr.Body).Decode(&child)
+
+	rr = doAPIRequest(t, ws, "GET", parentPath+"/tree", "")
+	var tree TaskTree
+	json.NewDecoder(rr.Body).Decode(&tree)
+	if rr.Code != http.StatusOK || tree.TotalSubtasks != 1 || tree.Subtasks[0].ID != child.ID {
+		t.Fatalf("Expected the parent with one subtask, got %d: %+v", rr.Code, tree)
+	}
+
+	rr = doAPIRequest(t, ws, "PATCH", parentPath, fmt.Sprintf(`{"parent_task_id":%d}`, child.ID))
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 moving a task under its subtask, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = doAPIRequest(t, ws, "PATCH", "/api/tasks/"+strconv.FormatInt(child.ID, 10), `{"parent_task_id":0}`)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"parent_task_id":null`) {
+		t.Errorf("Expected the subtask to become a top-level task, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAPIDueDates(t *testing.T) {
+	ws, db, cleanup := setupTestWebServer(t)
+	defer cleanup()
+
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	rr := doAPIRequest(t, ws, "POST", "/api/tasks", fmt.Sprintf(`{"project_id":%d,"title":"Late","due_at":"2020-01-31"}`, project.ID))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var late Task
+	json.NewDecoder(rr.Body).Decode(&late)
+	db.CreateTask(project.ID, nil, "Undated", "", "", "", "", "", "", "", nil, nil)
+
+	rr = doAPIRequest(t, ws, "PATCH", "/api/tasks/"+strconv.FormatInt(late.ID, 10), `{"start_at":"2020-02-15"}`)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a start after the due date, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = doAPIRequest(t, ws, "POST", "/api/projects", `{"name":"Bad","due_at":"someday"}`)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for an invalid date, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = doAPIRequest(t, ws, "GET", "/api/tasks?overdue=true", "")
+	var tasks []Task
+	json.NewDecoder(rr.Body).Decode(&tasks)
+	if rr.Code != http.StatusOK || len(tasks) != 1 || tasks[0].ID != late.ID {
+		t.Errorf("Expected only the late task, got %d: %+v", rr.Code, tasks)
+	}
+	if rr = doAPIRequest(t, ws, "GET", "/api/tasks?overdue=maybe", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid overdue filter, got %d", rr.Code)
+	}
+
+	rr = doAPIRequest(t, ws, "GET", "/api/overdue", "")
+	var overdue DueItems
+	json.NewDecoder(rr.Body).Decode(&overdue)
+	if rr.Code != http.StatusOK || len(overdue.Tasks) != 1 || overdue.Projects == nil {
+		t.Errorf("Expected the late task to be overdue, got %d: %+v", rr.Code, overdue)
+	}
+	rr = doAPIRequest(t, ws, "GET", "/api/due-soon?days=3", "")
+	var dueSoon DueItems
+	json.NewDecoder(rr.Body).Decode(&dueSoon)
+	if rr.Code != http.StatusOK || len(dueSoon.Tasks) != 0 {
+		t.Errorf("Expected nothing due soon, got %d: %+v", rr.Code, dueSoon)
+	}
+	if rr = doAPIRequest(t, ws, "GET", "/api/due-soon?days=-1", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for negative days, got %d", rr.Code)
+	}
+}
+
+func TestAPIRecurrences(t *testing.T) {
+	ws, db, cleanup := setupTestWebServer(t)
+	defer cleanup()
+
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	rr := doAPIRequest(t, ws, "POST", "/api/tasks", fmt.Sprintf(`{"project_id":%d,"title":"Standup notes","due_at":"tomorrow","recurrence":"FREQ=WEEKLY;BYDAY=MO,WE,FR"}`, project.ID))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var task Task
+	json.NewDecoder(rr.Body).Decode(&task)
+	if task.RecurrenceID == nil {
+		t.Fatalf("Expected a recurring task, got %+v", task)
+	}
+	rr = doAPIRequest(t, ws, "PATCH", "/api/tasks/"+strconv.FormatInt(task.ID, 10), `{"recurrence":"FREQ=DAILY;BYDAY=MO"}`)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for an invalid rule, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = doAPIRequest(t, ws, "GET", fmt.Sprintf("/api/recurrences?project_id=%d", project.ID), "")
+	var recurrences []Recurrence
+	json.NewDecoder(rr.Body).Decode(&recurrences)
+	if rr.Code != http.StatusOK || len(recurrences) != 1 || recurrences[0].Rule != "FREQ=WEEKLY;BYDAY=MO,WE,FR" {
+		t.Errorf("Expected the recurrence to be listed, got %d: %+v", rr.Code, recurrences)
+	}
+
+	path := "/api/recurrences/" + strconv.FormatInt(*task.RecurrenceID, 10)
+	rr = doAPIRequest(t, ws, "POST", path+"/pause", "")
+	var recurrence Recurrence
+	json.NewDecoder(rr.Body).Decode(&recurrence)
+	if rr.Code != http.StatusOK || !recurrence.Paused {
+		t.Errorf("Expected the recurrence to be paused, got %d: %+v", rr.Code, recurrence)
+	}
+	rr = doAPIRequest(t, ws, "POST", path+"/resume", "")
+	json.NewDecoder(rr.Body).Decode(&recurrence)
+	if rr.Code != http.StatusOK || recurrence.Paused {
+		t.Errorf("Expected the recurrence to be resumed, got %d: %+v", rr.Code, recurrence)
+	}
+	if rr = doAPIRequest(t, ws, "POST", "/api/recurrences/999/pause", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing recurrence, got %d", rr.Code)
+	}
+}
+
+func TestAPITags(t *testing.T) {
+	ws, db, cleanup := setupTestWebServer(t)
+	defer cleanup()
+
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+	goal, _ := db.CreateGoal(&project.ID, nil, "Ship v2", "", "", "", nil, nil)
+	db.CreateGoal(&project.ID, nil, "Hire", "", "", "", nil, nil)
+
+	path := "/api/goals/" + strconv.FormatInt(goal.ID, 10) + "/tags"
+	rr := doAPIRequest(t, ws, "POST", path, `{"tag":"Q3","color":"#10B981"}`)
+	var tagged Goal
+	json.NewDecoder(rr.Body).Decode(&tagged)
+	if rr.Code != http.StatusOK || len(tagged.Tags) != 1 || tagged.Tags[0] != "q3" {
+		t.Fatalf("Expected the goal with its tag, got %d: %+v", rr.Code, tagged)
+	}
+	db.TagItem(EntityGoal, goal.ID, "okr", "")
+	if rr = doAPIRequest(t, ws, "POST", path, `{"tag":"a|b"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for an invalid tag, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr = doAPIRequest(t, ws, "POST", "/api/goals/999/tags", `{"tag":"q3"}`); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing goal, got %d", rr.Code)
+	}
+
+	for query, want := range map[string]int{"tag=q3": 1, "tag=q3&tag=okr": 1, "tag=q3,hiring&tag_match=any": 1, "tag=hiring": 0} {
+		rr = doAPIRequest(t, ws, "GET", "/api/goals?"+query, "")
+		var goals []Goal
+		json.NewDecoder(rr.Body).Decode(&goals)
+		if rr.Code != http.StatusOK || len(goals) != want {
+			t.Errorf("%s: expected %d goals, got %d: %+v", query, want, rr.Code, goals)
+		}
+	}
+	if rr = doAPIRequest(t, ws, "GET", "/api/goals?tag=q3&tag_match=most", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid tag_match, got %d", rr.Code)
+	}
+
+	rr = doAPIRequest(t, ws, "GET", "/api/tags?entity=goal", "")
+	var tags []Tag
+	json.NewDecoder(rr.Body).Decode(&tags)
+	if rr.Code != http.StatusOK || len(tags) != 2 || tags[1].Name != "q3" || tags[1].Color != "#10b981" {
+		t.Errorf("Expected both tags, got %d: %+v", rr.Code, tags)
+	}
+
+	if rr = doAPIRequest(t, ws, "DELETE", path+"/Q3", ""); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr = doAPIRequest(t, ws, "DELETE", path+"/q3", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 removing a tag twice, got %d", rr.Code)
+	}
+}
+
+func TestAPIPeople(t *testing.T) {
+	ws, db, cleanup := setupTestWebServer(t)
+	defer cleanup()
+
+	project, _ := db.CreateProject("P", "", "", "", nil, nil)
+
+	rr := doAPIRequest(t, ws, "POST", "/api/people", `{"name":"Alice Smith","email":"alice@example.com","role":"Backend engineer"}`)
+	var alice Person
+	json.NewDecoder(rr.Body).Decode(&alice)
+	if rr.Code != http.StatusCreated || alice.Email != "alice@example.com" {
+		t.Fatalf("Expected status 201 with the person, got %d: %+v", rr.Code, alice)
+	}
+	if rr = doAPIRequest(t, ws, "POST", "/api/people", `{"name":"Bob","email":"bob"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for an invalid email, got %d: %s", rr.Code, rr.Body.String())
+	}
+	path := "/api/people/" + strconv.FormatInt(alice.ID, 10)
+
+	rr = doAPIRequest(t, ws, "POST", "/api/tasks", `{"project_id":`+strconv.FormatInt(project.ID, 10)+`,"title":"API","assignee":"alice@example.com","reviewer":"Carol"}`)
+	var task Task
+	json.NewDecoder(rr.Body).Decode(&task)
+	if rr.Code != http.StatusCreated || task.AssigneeID == nil || *task.AssigneeID != alice.ID || task.Reviewer != "Carol" {
+		t.Fatalf("Expected the task to be assigned, got %d: %+v", rr.Code, task)
+	}
+	rr = doAPIRequest(t, ws, "GET", "/api/tasks?assignee=carol", "")
+	var tasks []Task
+	json.NewDecoder(rr.Body).Decode(&tasks)
+	if rr.Code != http.StatusOK || len(tasks) != 0 {
+		t.Errorf("Expected no tasks assigned to the reviewer, got %d: %+v", rr.Code, tasks)
+	}
+	rr = doAPIRequest(t, ws, "PATCH", "/api/tasks/"+strconv.FormatInt(task.ID, 10), `{"assignee":"carol"}`)
+	json.NewDecoder(rr.Body).Decode(&task)
+	if rr.Code != http.StatusOK || task.Assignee != "Carol" {
+		t.Errorf("Expected the task to move to carol, got %d: %+v", rr.Code, task)
+	}
+
+	rr = doAPIRequest(t, ws, "GET", path+"/workload", "")
+	var workload Workload
+	json.NewDecoder(rr.Body).Decode(&workload)
+	if rr.Code != http.StatusOK || workload.Person.ID != alice.ID || len(workload.Tasks) != 0 {
+		t.Errorf("Expected alice's empty workload, got %d: %+v", rr.Code, workload)
+	}
+	if rr = doAPIRequest(t, ws, "GET", "/api/people/999/workload", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing person, got %d", rr.Code)
+	}
+
+	rr = doAPIRequest(t, ws, "PATCH", path, `{"handle":"asmith"}`)
+	json.NewDecoder(rr.Body).Decode(&alice)
+	if rr.Code != http.StatusOK || alice.Handle != "asmith" {
+		t.Errorf("Expected the handle to change, got %d: %+v", rr.Code, alice)
+	}
+	rr = doAPIRequest(t, ws, "GET", "/api/people?role=backend%20engineer", "")
+	var people []Person
+	json.NewDecoder(rr.Body).Decode(&people)
+	if rr.Code != http.StatusOK || len(people) != 1 || people[0].ID != alice.ID {
+		t.Errorf("Expected alice, got %d: %+v", rr.Code, people)
+	}
+
+	if rr = doAPIRequest(t, ws, "DELETE", path, ""); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr = doAPIRequest(t, ws, "GET", path, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 after deleting, got %d", rr.Code)
+	}
+}
+
+func TestAPIAuthentication(t *testing.T) {
+	ws, db, cleanup := setupTestWebServer(t)
+	defer cleanup()
+	ws.requireToken = true
+
+	mine, _ := db.CreateProject("Mine", "", "", "", nil, nil)
+	other, _ := db.CreateProject("Other", "", "", "", nil, nil)
+	otherTask, _ := db.CreateTask(other.ID, nil, "Other", "", "", "", "", "", "", "", nil, nil)
+	_, writer, _ := db.CreateAPIToken("writer", AccessWrite, nil)
+	_, reader, _ := db.CreateAPIToken("reader", AccessRead, nil)
+	_, scoped, _ := db.CreateAPIToken("scoped", AccessWrite, &mine.ID)
+
+	request := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		ws.apiHandler().ServeHTTP(rr, req)
+		return rr
+	}
+
+	for _, token := range []string{"", "loom_nope"} {
+		rr := request("GET", "/api/projects", token, "")
+		if rr.Code != http.StatusUnauthorized || rr.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("Expected status 401 for token %q, got %d", token, rr.Code)
+		}
+	}
+	if rr := request("OPTIONS", "/api/projects", "", ""); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected preflight requests through without a token, got %d", rr.Code)
+	}
+	if rr := request("GET", "/sse", "", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected MCP to need a token, got %d", rr.Code)
+	}
+
+	// Read tokens can only read
+	if rr := request("GET", "/api/tasks", reader, ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected the reader to list tasks, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := request("POST", "/api/projects", reader, `{"name":"Nope"}`); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a read token, got %d", rr.Code)
+	}
+
+	// Changes are recorded as the token
+	rr := request("POST", "/api/projects", writer, `{"name":"Written"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	actor := "token:writer"
+	if entries, _, _ := db.ListActivityPage(nil, nil, &actor, ListOptions{}); len(entries) != 1 {
+		t.Errorf("Expected the change to be recorded as the token, got %+v", entries)
+	}
+
+	// Project-scoped tokens stay inside their project
+	rr = request("GET", "/api/tasks", scoped, "")
+	var tasks []Task
+	json.NewDecoder(rr.Body).Decode(&tasks)
+	if rr.Code != http.StatusOK || len(tasks) != 0 {
+		t.Errorf("Expected only the project's tasks, got %d: %+v", rr.Code, tasks)
+	}
+	for _, c := range []struct{ method, path, body string }{
+		{"GET", "/api/projects", ""},
+		{"GET", fmt.Sprintf("/api/tasks?project_id=%d", other.ID), ""},
+		{"GET", "/api/tasks?project_id=abc", ""},
+		{"GET", fmt.Sprintf("/api/goals?project_id=%d&project_id=%d", other.ID, mine.ID), ""},
+		{"GET", fmt.Sprintf("/api/tasks/%d", otherTask.ID), ""},
+		{"POST", "/api/problems", `{"title":"Loose"}`},
+		{"POST", "/api/tasks", fmt.Sprintf(`{"project_id":%d,"title":"Elsewhere"}`, other.ID)},
+		{"GET", "/api/people", ""},
+	} {
+		if rr := request(c.method, c.path, scoped, c.body); rr.Code != http.StatusForbidden {
+			t.Errorf("%s %s: expected status 403, got %d: %s", c.method, c.path, rr.Code, rr.Body.String())
+		}
+	}
+	rr = request("POST", "/api/tasks", scoped, fmt.Sprintf(`{"project_id":%d,"title":"Inside"}`, mine.ID))
+	var task Task
+	json.NewDecoder(rr.Body).Decode(&task)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 inside the project, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := request("GET", "/api/problems?task_id=abc", writer, ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid filter, got %d", rr.Code)
+	}
+	if rr := request("PATCH", fmt.Sprintf("/api/tasks/%d", task.ID), scoped, `{"status":"in_progress"}`); rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200 updating inside the project, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := request("POST", fmt.Sprintf("/api/tasks/%d/dependencies", task.ID), scoped, fmt.Sprintf(`{"depends_on_id":%d}`, otherTask.ID)); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 depending on another project's task, got %d", rr.Code)
+	}
+}
+
+func TestAPIExportImport(t *testing.T) {
+	ws, db, cleanup := setupTestWebServer(t)
+	defer cleanup()
+	project, _, _ := seedWorkspace(t, db)
+
+	rr := doAPIRequest(t, ws, "GET", "/api/export", "")
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Disposition") != `attachment; filename="loom-export.json"` {
+		t.Fatalf("Expected a JSON export, got %d %v: %s", rr.Code, rr.Header(), rr.Body.String())
+	}
+	exported := rr.Body.String()
+
+	rr = doAPIRequest(t, ws, "GET", fmt.Sprintf("/api/export?format=markdown&project_id=%d", project.ID), "")
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/markdown") || !strings.Contains(rr.Body.String(), "## Launch") {
+		t.Errorf("Expected a markdown export of the project, got %d: %s", rr.Code, rr.Body.String())
+	}
+	for path, want := range map[string]int{
+		"/api/export?format=xml":        http.StatusBadRequest,
+		"/api/export?project_id=999":    http.StatusNotFound,
+		"/api/import?preserve_ids=true": http.StatusUnprocessableEntity,
+	} {
+		method := "GET"
+		if strings.HasPrefix(path, "/api/import") {
+			method = "POST"
+		}
+		if rr := doAPIRequest(t, ws, method, path, exported); rr.Code != want {
+			t.Errorf("%s %s: expected status %d, got %d: %s", method, path, want, rr.Code, rr.Body.String())
+		}
+	}
+
+	client := make(chan string, 10)
+	ws.clientsMux.Lock()
+	ws.clients[client] = true
+	ws.clientsMux.Unlock()
+
+	rr = doAPIRequest(t, ws, "POST", "/api/import", exported)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var result ImportResult
+	json.NewDecoder(rr.Body).Decode(&result)
+	if result.Created[EntityProject] != 2 || result.IDs[EntityProject][project.ID] == project.ID {
+		t.Errorf("Expected the projects to be imported with new IDs, got %+v", result)
+	}
+	if projects, _ := db.ListProjects(nil); len(projects) != 4 {
+		t.Errorf("Expected 4 projects after the import, got %d", len(projects))
+	}
+	if event := <-client; !strings.HasPrefix(event, "event: change\n") || !strings.Contains(event, `"action":"imported","entity":"workspace"`) || len(client) != 0 {
+		t.Errorf("Expected dashboards to be sent a single imported event, got %q and %d more", event, len(client))
+	}
+
+	// Tokens limited to a project export only that project, and can't import
+	ws.requireToken = true
+	_, scoped, _ := db.CreateAPIToken("scoped", AccessWrite, &project.ID)
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+scoped)
+		rr := httptest.NewRecorder()
+		ws.apiHandler().ServeHTTP(rr, req)
+		return rr
+	}
+	rr = request("GET", "/api/export", "")
+	var w Workspace
+	json.NewDecoder(rr.Body).Decode(&w)
+	if rr.Code != http.StatusOK || len(w.Projects) != 1 || w.Projects[0].ID != project.ID {
+		t.Errorf("Expected only the token's project, got %d: %+v", rr.Code, w.Projects)
+	}
+	if rr := request("GET", "/api/export?project_id=2", ""); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 exporting another project, got %d", rr.Code)
+	}
+	if rr := request("POST", "/api/import", exported); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 importing with a scoped token, got %d", rr.Code)
+	}
+}
+
+func TestAPISyncLinks(t *testing.T) {
+	ws, db, cleanup := setupTestWebServer(t)
+	defer cleanup()
+	gh, srv := newFakeGitHub(t)
+	gh.add(1, "Login fails", "open", "bug")
+	db.SetIssueTrackers(map[string]IssueTracker{"github": NewGitHubClient(srv.URL, "gh_test")})
+	project, _ := db.CreateProject("App", "", "", "", nil, nil)
+
+	rr := doAPIRequest(t, ws, "POST", "/api/sync-links", fmt.Sprintf(`{"project_id":%d,"provider":"github","remote":"acme/app"}`, project.ID))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var link SyncLink
+	json.NewDecoder(rr.Body).Decode(&link)
+	if rr := doAPIRequest(t, ws, "POST", "/api/sync-links", `{"project_id":1,"provider":"github","remote":"acme"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a bad remote, got %d", rr.Code)
+	}
+
+	rr = doAPIRequest(t, ws, "POST", fmt.Sprintf("/api/sync-links/%d/sync?dry_run=true", link.ID), "")
+	var preview SyncResult
+	json.NewDecoder(rr.Body).Decode(&preview)
+	if tasks, _ := db.ListTasks(&project.ID, nil, nil); rr.Code != http.StatusOK || !preview.DryRun || preview.Created != 1 || len(tasks) != 0 {
+		t.Errorf("Expected the import to be previewed only, got %d: %+v and %d tasks", rr.Code, preview, len(tasks))
+	}
+	if rr := doAPIRequest(t, ws, "POST", fmt.Sprintf("/api/sync-links/%d/sync?dry_run=maybe", link.ID), ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid dry_run, got %d", rr.Code)
+	}
+
+	rr = doAPIRequest(t, ws, "POST", fmt.Sprintf("/api/sync-links/%d/sync", link.ID), "")
+	var result SyncResult
+	json.NewDecoder(rr.Body).Decode(&result)
+	if rr.Code != http.StatusOK || result.Created != 1 {
+		t.Errorf("Expected the issue to be imported, got %d: %+v", rr.Code, result)
+	}
+	rr = doAPIRequest(t, ws, "GET", fmt.Sprintf("/api/sync-links?project_id=%d", project.ID), "")
+	var links []SyncLink
+	json.NewDecoder(rr.Body).Decode(&links)
+	if len(links) != 1 || links[0].LastSyncedAt == nil {
+		t.Errorf("Expected the synced link, got %+v", links)
+	}
+
+	// Only tokens for all projects can manage sync links
+	ws.requireToken = true
+	_, scoped, _ := db.CreateAPIToken("scoped", AccessWrite, &project.ID)
+	req := httptest.NewRequest("GET", "/api/sync-links", nil)
+	req.Header.Set("Authorization", "Bearer "+scoped)
+	rr = httptest.NewRecorder()
+	ws.apiHandler().ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 with a scoped token, got %d", rr.Code)
+	}
+	ws.requireToken = false
+
+	if rr := doAPIRequest(t, ws, "DELETE", fmt.Sprintf("/api/sync-links/%d", link.ID), ""); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := doAPIRequest(t, ws, "POST", fmt.Sprintf("/api/sync-links/%d/sync", link.ID), ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 syncing a removed link, got %d", rr.Code)
+	}
+}
+
+func TestLoopbackAddr(t *testing.T) {
+	for addr, want := range map[string]string{":8080": "127.0.0.1:8080", "localhost:8080": "localhost:8080", "[::1]:8080": "[::1]:8080", "0.0.0.0:8080": "", "example.com:80": ""} {
+		got, err := loopbackAddr(addr)
+		if got != want || (want == "") != (err != nil) {
+			t.Errorf("loopbackAddr(%q) = %q, %v; want %q", addr, got, err, want)
+		}
+	}
+}
+
+func TestExposedAddr(t *testing.T) {
+	for addr, want := range map[string]bool{"127.0.0.1:8080": false, "localhost:8080": false, "[::1]:8080": false, ":8080": true, "0.0.0.0:8080": true, "192.168.1.5:8080": true} {
+		if got := exposedAddr(addr); got != want {
+			t.Errorf("exposedAddr(%q) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	ws, db, cleanup := setupTestWebServer(t)
+	defer cleanup()
+	ws.mcpHandler = NewMCPHandler(NewMCPServer(db, func(VoiceMessage) (int, error) { return 0, nil }, nil))
+
+	apiListener, _ := net.Listen("tcp", "127.0.0.1:0")
+	webListener, _ := net.Listen("tcp", "127.0.0.1:0")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- ws.serve(ctx, apiListener, webListener) }()
+
+	base := "http://" + apiListener.Addr().String()
+	events, err := http.Get(base + "/events")
+	if err != nil {
+		t.Fatalf("failed to open SSE stream: %v", err)
+	}
+	defer events.Body.Close()
+	mcpReq, _ := http.NewRequest(http.MethodGet, base+"/sse", nil)
+	mcpReq.Header.Set("Accept", "text/event-stream")
+	mcpStream, err := http.DefaultClient.Do(mcpReq)
+	if err != nil || mcpStream.StatusCode != http.StatusOK {
+		t.Fatalf("failed to open MCP stream: %v", err)
+	}
+	defer mcpStream.Body.Close()
+
+	reader := bufio.NewReader(events.Body)
+	if line, _ := reader.ReadString('\n'); line != "event: connected\n" {
+		t.Fatalf("expected the connected event, got %q", line)
+	}
+
+	cancel()
+	var sawShutdown bool
+	for {
+		line, err := reader.ReadString('\n')
+		if line == "event: shutdown\n" {
+			sawShutdown = true
+		}
+		if err != nil {
+			break
+		}
+	}
+	if !sawShutdown {
+		t.Error("expected SSE clients to be sent a shutdown event")
+	}
+	if _, err := io.Copy(io.Discard, mcpStream.Body); err != nil {
+		t.Errorf("expected the MCP stream to end cleanly, got %v", err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected a clean shutdown, got %v", err)
+		}
+	case <-time.After(shutdownTimeout):
+		t.Fatal("servers did not shut down")
+	}
+	if _, err := http.Get(base + "/api/projects"); err == nil {
+		t.Error("expected the API server to stop accepting connections")
+	}
+}